@@ -0,0 +1,50 @@
+// Command simulator load-tests an API deployment with a fleet of virtual
+// agents, each registering, uploading telemetry, fetching its policy and
+// polling for commands as the agent does, and reports request rates,
+// failures and latencies per operation. It runs until the duration passes
+// or it is interrupted.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/simulator"
+)
+
+func main() {
+	var opts simulator.Options
+	flag.StringVar(&opts.Endpoint, "api", "http://localhost:8080", "API endpoint to load")
+	flag.IntVar(&opts.Agents, "agents", 100, "Number of virtual agents")
+	flag.StringVar(&opts.Name, "name", "sim", "Fleet name; reruns with the same name reuse its devices")
+	flag.DurationVar(&opts.Interval, "interval", 15*time.Minute, "Time between one agent's uploads")
+	flag.DurationVar(&opts.Ramp, "ramp", time.Minute, "Time over which agents start")
+	flag.DurationVar(&opts.PolicyInterval, "policy-interval", time.Minute, "Time between one agent's policy fetches, 0 for none")
+	flag.BoolVar(&opts.PollCommands, "commands", true, "Long-poll for commands and ack them")
+	flag.StringVar(&opts.Encoding, "encoding", "json", "Payload encoding: json, protobuf or msgpack")
+	flag.IntVar(&opts.Software, "software", 80, "Installed programs per device")
+	flag.Float64Var(&opts.ErrorRate, "error-rate", 0.01, "Share of uploads reporting a failed collector")
+	duration := flag.Duration("duration", 0, "How long to run, 0 until interrupted")
+	report := flag.Duration("report", 30*time.Second, "Interval between reports, 0 for only the final one")
+	flag.Parse()
+
+	fleet, err := simulator.New(opts)
+	if err != nil {
+		log.Fatalf("Invalid simulation: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	fleet.Run(ctx, os.Stdout, *report)
+	fleet.Stats().Report(os.Stdout)
+}
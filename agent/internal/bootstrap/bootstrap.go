@@ -0,0 +1,248 @@
+// Package bootstrap finds the API for an agent installed without one, so
+// devices can be imaged with the same configuration at every site. The
+// agent looks under its DNS domain, then each parent domain, for a TXT
+// record at _inventory-agent.<domain> such as
+//
+//	"api=https://inventory.example.com; org=3"
+//
+// or else a document at https://<domain>/.well-known/inventory-agent.json
+// such as
+//
+//	{"api_endpoint": "https://inventory.example.com", "org_id": 3}
+//
+// and saves the endpoint and the organization to enroll into in its
+// configuration, so discovery runs only until it first succeeds.
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+const (
+	txtPrefix     = "_inventory-agent."
+	wellKnownPath = "/.well-known/inventory-agent.json"
+	// maxDocumentSize bounds a well-known document read
+	maxDocumentSize = 64 << 10
+)
+
+// ErrNotFound is returned when no domain publishes bootstrap settings
+var ErrNotFound = errors.New("no bootstrap settings published")
+
+// Settings are the bootstrap settings a domain publishes
+type Settings struct {
+	APIEndpoint string `json:"api_endpoint"`
+	// OrgID is the organization devices enroll into, the API's default
+	// when zero
+	OrgID int64 `json:"org_id,omitempty"`
+}
+
+// Discoverer looks up published settings
+type Discoverer struct {
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	client    *http.Client
+}
+
+// New creates a discoverer using the system resolver
+func New() *Discoverer {
+	return &Discoverer{
+		lookupTXT: net.DefaultResolver.LookupTXT,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Apply discovers the API for an agent configured without one and saves
+// it. It does nothing when an endpoint is configured or discovery is
+// disabled, and retries lookups that fail in a way retrying may fix.
+func Apply(ctx context.Context, cfg *config.AgentConfig) error {
+	if cfg.APIEndpoint != "" || cfg.DisableBootstrap {
+		return nil
+	}
+
+	domain := cfg.BootstrapDomain
+	if domain == "" {
+		var err error
+		if domain, err = MachineDomain(); err != nil {
+			return fmt.Errorf("failed to read the machine's domain: %w", err)
+		}
+		if domain == "" {
+			return fmt.Errorf("machine has no DNS domain to discover the API under")
+		}
+	}
+
+	d := New()
+	var settings *Settings
+	err := retry.Do(ctx, retry.NewBackoff(cfg.RetryConfig, 5*time.Second), cfg.RetryConfig.MaxRetries, func(ctx context.Context) error {
+		var err error
+		settings, err = d.Discover(ctx, domain)
+		if errors.Is(err, ErrNotFound) {
+			return retry.Permanent(err)
+		}
+		if err != nil {
+			log.Printf("Bootstrap discovery under %s failed: %v", domain, err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.APIEndpoint = settings.APIEndpoint
+	cfg.OrgID = settings.OrgID
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save discovered settings: %w", err)
+	}
+	log.Printf("Discovered API endpoint %s (org %d) under %s", settings.APIEndpoint, settings.OrgID, domain)
+	return nil
+}
+
+// Discover returns the settings published for domain or its nearest parent
+// domain that publishes any, trying the TXT record before the well-known
+// document at each level. It returns ErrNotFound when none does, or the
+// first lookup error when a lookup failed in a way retrying may fix.
+func (d *Discoverer) Discover(ctx context.Context, domain string) (*Settings, error) {
+	var lookupErr error
+	for _, name := range candidates(domain) {
+		settings, err := d.fromTXT(ctx, name)
+		if settings != nil {
+			return settings, nil
+		}
+		if err != nil && lookupErr == nil {
+			lookupErr = err
+		}
+
+		if settings := d.fromWellKnown(ctx, name); settings != nil {
+			return settings, nil
+		}
+	}
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return nil, ErrNotFound
+}
+
+// candidates returns domain and its parents with at least two labels,
+// nearest first
+func candidates(domain string) []string {
+	labels := strings.Split(strings.Trim(strings.ToLower(domain), "."), ".")
+	var names []string
+	for i := 0; len(labels)-i >= 2; i++ {
+		names = append(names, strings.Join(labels[i:], "."))
+	}
+	return names
+}
+
+// fromTXT reads the TXT record published for domain. A domain without one
+// isn't an error; a record that doesn't name a valid endpoint is skipped.
+func (d *Discoverer) fromTXT(ctx context.Context, domain string) (*Settings, error) {
+	records, err := d.lookupTXT(ctx, txtPrefix+domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, record := range records {
+		settings, err := parseTXT(record)
+		if err != nil {
+			log.Printf("Ignoring bootstrap record for %s: %v", domain, err)
+			continue
+		}
+		return settings, nil
+	}
+	return nil, nil
+}
+
+// parseTXT reads a record of key=value pairs separated by semicolons or
+// spaces: api, the endpoint, and optionally org. Other keys are ignored.
+func parseTXT(record string) (*Settings, error) {
+	var settings Settings
+	fields := strings.FieldsFunc(record, func(r rune) bool { return r == ';' || r == ' ' || r == '\t' })
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "api":
+			settings.APIEndpoint = value
+		case "org":
+			org, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid org %q", value)
+			}
+			settings.OrgID = org
+		}
+	}
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// fromWellKnown reads the well-known document of domain. Since most
+// domains serve none, failing to fetch it is taken as there being none; a
+// document that is served but invalid is logged and skipped.
+func (d *Discoverer) fromWellKnown(ctx context.Context, domain string) *Settings {
+	endpoint := "https://" + domain + wellKnownPath
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil
+	}
+
+	var settings Settings
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&settings); err != nil {
+		log.Printf("Ignoring bootstrap document %s: %v", endpoint, err)
+		return nil
+	}
+	if err := settings.validate(); err != nil {
+		log.Printf("Ignoring bootstrap document %s: %v", endpoint, err)
+		return nil
+	}
+	return &settings
+}
+
+// validate checks the settings name an HTTPS endpoint and a valid org, and
+// trims the endpoint's trailing slash
+func (s *Settings) validate() error {
+	u, err := url.Parse(s.APIEndpoint)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid API endpoint %q", s.APIEndpoint)
+	}
+	// Anyone able to answer for the domain could otherwise point devices at
+	// their own server without a certificate for it
+	if u.Scheme != "https" {
+		return fmt.Errorf("API endpoint %q isn't HTTPS", s.APIEndpoint)
+	}
+	if s.OrgID < 0 {
+		return fmt.Errorf("invalid org %d", s.OrgID)
+	}
+	s.APIEndpoint = strings.TrimRight(s.APIEndpoint, "/")
+	return nil
+}
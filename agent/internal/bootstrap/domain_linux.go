@@ -0,0 +1,36 @@
+package bootstrap
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// MachineDomain returns the domain of the machine's fully qualified host
+// name, or else the domain resolv.conf names; empty when it has neither.
+// resolv.conf's search list isn't used: in a Kubernetes pod it names the
+// cluster's service domains, not the network's.
+func MachineDomain() (string, error) {
+	if hostname, err := os.Hostname(); err == nil {
+		if _, domain, ok := strings.Cut(hostname, "."); ok {
+			return domain, nil
+		}
+	}
+
+	f, err := os.Open("/etc/resolv.conf")
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "domain" {
+			return fields[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
@@ -0,0 +1,23 @@
+package bootstrap
+
+import "golang.org/x/sys/windows/registry"
+
+// MachineDomain returns the DNS domain the machine is joined to or
+// configured with, empty when it has none
+func MachineDomain() (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+
+	// Domain is set by joining a domain or by DHCP; NV Domain is the
+	// primary DNS suffix set by hand or group policy
+	for _, name := range []string{"Domain", "NV Domain"} {
+		if domain, _, err := key.GetStringValue(name); err == nil && domain != "" {
+			return domain, nil
+		}
+	}
+	return "", nil
+}
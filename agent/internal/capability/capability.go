@@ -1,21 +1,24 @@
 package capability
 
 import (
+	"github.com/yourorg/inventory-agent/shared/models"
 )
 
-type Capability struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
-}
+// Capability is shared with the API, which matches policies against it
+type Capability = models.Capability
 
 func GetCapabilities() []Capability {
-	return []Capability{
+	return append([]Capability{
 		{Name: "os.info", Version: "1.0"},
 		{Name: "cpu.utilization", Version: "1.0"},
 		{Name: "memory.usage", Version: "1.0"},
 		{Name: "disk.utilization", Version: "1.0"},
 		{Name: "software.inventory", Version: "1.0"},
-	}
+		{Name: "network.wireless", Version: "1.0"},
+		{Name: "runtimes.installed", Version: "1.0"},
+		{Name: "network.listeners", Version: "1.0"},
+		{Name: "sessions.resources", Version: "1.0"},
+	}, platformCapabilities...)
 }
 
 func GetSupportedMetrics() []string {
@@ -0,0 +1,4 @@
+package capability
+
+// platformCapabilities are the collectors only the Linux agent has
+var platformCapabilities []Capability
@@ -0,0 +1,7 @@
+package capability
+
+// platformCapabilities are the collectors only the Windows agent has
+var platformCapabilities = []Capability{
+	{Name: "power.settings", Version: "1.0"},
+	{Name: "compliance.screenlock", Version: "1.0"},
+}
@@ -0,0 +1,58 @@
+// Package clock tracks how far the device's clock is from the API's, so a
+// device with a wrong clock still reports when it collected in time the API
+// accepts. The skew is measured from the Date header of each API response,
+// against the local time halfway through the request, and timestamps the
+// agent sends are taken from Now, which corrects for it.
+package clock
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// minSkew is the smallest skew corrected for. The Date header has whole
+// seconds and a request takes time to cross the network, so a smaller
+// measured skew says nothing about the clock.
+const minSkew = 2 * time.Second
+
+var skew atomic.Int64
+
+// Observe measures the skew from a response to a request sent at sent. A
+// response without a valid Date header is ignored.
+func Observe(resp *http.Response, sent time.Time) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	received := time.Now()
+	// Date is truncated to the second, so on average it is half a second
+	// behind when the server wrote it
+	local := sent.Add(received.Sub(sent) / 2)
+	measured := date.Add(500 * time.Millisecond).Sub(local)
+	if measured > -minSkew && measured < minSkew {
+		measured = 0
+	}
+
+	previous := time.Duration(skew.Swap(int64(measured)))
+	if diff := measured - previous; diff >= minSkew || diff <= -minSkew {
+		if measured == 0 {
+			log.Printf("Clock agrees with the API again")
+		} else {
+			log.Printf("Clock is %s off the API's (API minus device); correcting timestamps", measured.Round(time.Second))
+		}
+	}
+}
+
+// Skew returns the last measured skew, API time minus local time, zero when
+// it is too small to correct for or hasn't been measured
+func Skew() time.Duration {
+	return time.Duration(skew.Load())
+}
+
+// Now returns the current time corrected for the skew
+func Now() time.Time {
+	return time.Now().Add(Skew())
+}
@@ -0,0 +1,182 @@
+package collectors
+
+import (
+	"encoding/hex"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	wintrust                                 = windows.NewLazySystemDLL("wintrust.dll")
+	procWTHelperProvDataFromStateData        = wintrust.NewProc("WTHelperProvDataFromStateData")
+	procWTHelperGetProvSignerFromChain       = wintrust.NewProc("WTHelperGetProvSignerFromChain")
+	procWTHelperGetProvCertFromChain         = wintrust.NewProc("WTHelperGetProvCertFromChain")
+	procCryptCATAdminAcquireContext2         = wintrust.NewProc("CryptCATAdminAcquireContext2")
+	procCryptCATAdminReleaseContext          = wintrust.NewProc("CryptCATAdminReleaseContext")
+	procCryptCATAdminCalcHashFromFileHandle2 = wintrust.NewProc("CryptCATAdminCalcHashFromFileHandle2")
+	procCryptCATAdminEnumCatalogFromHash     = wintrust.NewProc("CryptCATAdminEnumCatalogFromHash")
+	procCryptCATAdminReleaseCatalogContext   = wintrust.NewProc("CryptCATAdminReleaseCatalogContext")
+	procCryptCATCatalogInfoFromContext       = wintrust.NewProc("CryptCATCatalogInfoFromContext")
+)
+
+// driverActionVerify is DRIVER_ACTION_VERIFY, the subsystem whose catalogs
+// sign Windows' own files
+var driverActionVerify = mustGUID("{F750E6C3-38EE-11D1-85E5-00C04FC295EE}")
+
+// CRYPT_PROVIDER_CERT, up to the certificate
+type cryptProviderCert struct {
+	Size uint32
+	Cert *windows.CertContext
+}
+
+// CATALOG_INFO
+type catalogInfo struct {
+	Size        uint32
+	CatalogFile [windows.MAX_PATH]uint16
+}
+
+// WINTRUST_CATALOG_INFO
+type wintrustCatalogInfo struct {
+	Size                   uint32
+	CatalogVersion         uint32
+	CatalogFilePath        *uint16
+	MemberTag              *uint16
+	MemberFilePath         *uint16
+	MemberFile             windows.Handle
+	CalculatedFileHash     *byte
+	CalculatedFileHashSize uint32
+	CatalogContext         uintptr
+	CatAdmin               windows.Handle
+}
+
+// fileSigner is who signed an executable and whether the signature holds
+type fileSigner struct {
+	subject string
+	status  string
+}
+
+// fileSignature checks an executable's Authenticode signature, embedded or,
+// as for most of Windows' own files, in a system catalog. Revocation isn't
+// checked, so it needs no network.
+func fileSignature(path string) fileSigner {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return fileSigner{}
+	}
+
+	file := &windows.WinTrustFileInfo{FilePath: pathPtr}
+	file.Size = uint32(unsafe.Sizeof(*file))
+	signer, err := verifyTrust(windows.WTD_CHOICE_FILE, unsafe.Pointer(file))
+	if err == nil {
+		return signer
+	}
+	if err != windows.Errno(windows.TRUST_E_NOSIGNATURE) && err != windows.Errno(windows.TRUST_E_SUBJECT_FORM_UNKNOWN) {
+		return fileSigner{status: SignatureInvalid}
+	}
+
+	if signer, ok := catalogSignature(path, pathPtr); ok {
+		return signer
+	}
+	return fileSigner{status: SignatureUnsigned}
+}
+
+// catalogSignature checks a file against the system catalog that lists its
+// hash, if any does
+func catalogSignature(path string, pathPtr *uint16) (fileSigner, bool) {
+	algorithm, _ := windows.UTF16PtrFromString("SHA256")
+	var admin windows.Handle
+	if r, _, _ := procCryptCATAdminAcquireContext2.Call(uintptr(unsafe.Pointer(&admin)), uintptr(unsafe.Pointer(&driverActionVerify)),
+		uintptr(unsafe.Pointer(algorithm)), 0, 0); r == 0 {
+		return fileSigner{}, false
+	}
+	defer procCryptCATAdminReleaseContext.Call(uintptr(admin), 0)
+
+	f, err := windows.CreateFile(pathPtr, windows.GENERIC_READ, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return fileSigner{}, false
+	}
+	defer windows.CloseHandle(f)
+
+	hash := make([]byte, 64)
+	size := uint32(len(hash))
+	if r, _, _ := procCryptCATAdminCalcHashFromFileHandle2.Call(uintptr(admin), uintptr(f), uintptr(unsafe.Pointer(&size)),
+		uintptr(unsafe.Pointer(&hash[0])), 0); r == 0 {
+		return fileSigner{}, false
+	}
+	hash = hash[:size]
+
+	catalog, _, _ := procCryptCATAdminEnumCatalogFromHash.Call(uintptr(admin), uintptr(unsafe.Pointer(&hash[0])), uintptr(size), 0, 0)
+	if catalog == 0 {
+		return fileSigner{}, false
+	}
+	defer procCryptCATAdminReleaseCatalogContext.Call(uintptr(admin), catalog, 0)
+
+	info := catalogInfo{Size: uint32(unsafe.Sizeof(catalogInfo{}))}
+	if r, _, _ := procCryptCATCatalogInfoFromContext.Call(catalog, uintptr(unsafe.Pointer(&info)), 0); r == 0 {
+		return fileSigner{}, false
+	}
+
+	tag, _ := windows.UTF16PtrFromString(strings.ToUpper(hex.EncodeToString(hash)))
+	member := &wintrustCatalogInfo{
+		CatalogFilePath:        &info.CatalogFile[0],
+		MemberTag:              tag,
+		MemberFilePath:         pathPtr,
+		MemberFile:             f,
+		CalculatedFileHash:     &hash[0],
+		CalculatedFileHashSize: size,
+		CatAdmin:               admin,
+	}
+	member.Size = uint32(unsafe.Sizeof(*member))
+	signer, err := verifyTrust(windows.WTD_CHOICE_CATALOG, unsafe.Pointer(member))
+	if err != nil {
+		return fileSigner{status: SignatureInvalid}, true
+	}
+	return signer, true
+}
+
+// verifyTrust runs WinVerifyTrust on a file or catalog member and, when the
+// signature verifies, reads the signing certificate's subject
+func verifyTrust(choice uint32, subject unsafe.Pointer) (fileSigner, error) {
+	data := &windows.WinTrustData{
+		UIChoice:                        windows.WTD_UI_NONE,
+		RevocationChecks:                windows.WTD_REVOKE_NONE,
+		UnionChoice:                     choice,
+		FileOrCatalogOrBlobOrSgnrOrCert: subject,
+		StateAction:                     windows.WTD_STATEACTION_VERIFY,
+		ProvFlags:                       windows.WTD_REVOCATION_CHECK_NONE,
+	}
+	data.Size = uint32(unsafe.Sizeof(*data))
+	err := windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	defer func() {
+		data.StateAction = windows.WTD_STATEACTION_CLOSE
+		windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	}()
+	if err != nil {
+		return fileSigner{}, err
+	}
+
+	signer := fileSigner{status: SignatureValid}
+	provData, _, _ := procWTHelperProvDataFromStateData.Call(uintptr(data.StateData))
+	if provData == 0 {
+		return signer, nil
+	}
+	sgnr, _, _ := procWTHelperGetProvSignerFromChain.Call(provData, 0, 0, 0)
+	if sgnr == 0 {
+		return signer, nil
+	}
+	certPtr, _, _ := procWTHelperGetProvCertFromChain.Call(sgnr, 0)
+	if certPtr == 0 {
+		return signer, nil
+	}
+	cert := *(**cryptProviderCert)(unsafe.Pointer(&certPtr))
+
+	name := make([]uint16, 256)
+	n := windows.CertGetNameString(cert.Cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, &name[0], uint32(len(name)))
+	if n > 1 {
+		signer.subject = windows.UTF16ToString(name[:n])
+	}
+	return signer, nil
+}
@@ -0,0 +1,89 @@
+package collectors
+
+// Results of the built-in collectors, the same on every platform
+
+type OSInfo struct {
+	Caption  string `json:"caption"`
+	Version  string `json:"version"`
+	Make     string `json:"make"`
+	Model    string `json:"model"`
+	Serial   string `json:"serial"`
+	Hostname string `json:"hostname"`
+	Domain   string `json:"domain"`
+	LastUser string `json:"last_user"`
+	// LastPatchAt is when the most recent update was installed (RFC 3339)
+	LastPatchAt string `json:"last_patch_at,omitempty"`
+}
+
+type CPUUtilization struct {
+	CPUPercent float64 `json:"cpu_percent"`
+}
+
+type MemoryUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+type DiskUtilization struct {
+	Name       string `json:"name"`
+	TotalBytes int64  `json:"total_bytes"`
+	FreeBytes  int64  `json:"free_bytes"`
+	UsedBytes  int64  `json:"used_bytes"`
+}
+
+type SoftwareItem struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Publisher   string `json:"publisher"`
+	InstallDate string `json:"install_date"`
+}
+
+type OSInfoCollector struct {
+	*BaseCollector
+}
+
+func NewOSInfoCollector() *OSInfoCollector {
+	return &OSInfoCollector{
+		BaseCollector: NewBaseCollector("os.info", true), // Always enabled
+	}
+}
+
+type CPUCollector struct {
+	*BaseCollector
+}
+
+func NewCPUCollector() *CPUCollector {
+	return &CPUCollector{
+		BaseCollector: NewBaseCollector("cpu.utilization", false), // Disabled by default
+	}
+}
+
+type MemoryCollector struct {
+	*BaseCollector
+}
+
+func NewMemoryCollector() *MemoryCollector {
+	return &MemoryCollector{
+		BaseCollector: NewBaseCollector("memory.usage", false), // Disabled by default
+	}
+}
+
+type DiskCollector struct {
+	*BaseCollector
+}
+
+func NewDiskCollector() *DiskCollector {
+	return &DiskCollector{
+		BaseCollector: NewBaseCollector("disk.utilization", false), // Disabled by default
+	}
+}
+
+type SoftwareCollector struct {
+	*BaseCollector
+}
+
+func NewSoftwareCollector() *SoftwareCollector {
+	return &SoftwareCollector{
+		BaseCollector: NewBaseCollector("software.inventory", false), // Disabled by default
+	}
+}
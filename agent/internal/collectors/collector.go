@@ -2,11 +2,15 @@ package collectors
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// ErrCollectorNotFound is returned for a collector the agent doesn't have
+var ErrCollectorNotFound = errors.New("collector not found")
+
 type Collector interface {
 	Name() string
 	Collect(ctx context.Context) (interface{}, error)
@@ -64,7 +68,7 @@ func (r *CollectorRegistry) SetEnabled(name string, enabled bool) error {
 	defer r.mu.Unlock()
 	c, ok := r.collectors[name]
 	if !ok {
-		return fmt.Errorf("collector %s not found", name)
+		return fmt.Errorf("%w: %s", ErrCollectorNotFound, name)
 	}
 	// Note: This assumes collectors have a SetEnabled method
 	// Implementation depends on collector interface
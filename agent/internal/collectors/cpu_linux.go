@@ -0,0 +1,67 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Collect samples the host's CPU time counters a second apart and reports
+// the share of that second not spent idle
+func (c *CPUCollector) Collect(ctx context.Context) (interface{}, error) {
+	busy1, total1, err := readCPUTimes()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-time.After(1 * time.Second):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	busy2, total2, err := readCPUTimes()
+	if err != nil {
+		return nil, err
+	}
+	if total2 <= total1 {
+		return &CPUUtilization{}, nil
+	}
+
+	percent := float64(busy2-busy1) / float64(total2-total1) * 100
+	return &CPUUtilization{CPUPercent: percent}, nil
+}
+
+// readCPUTimes returns the busy and total time of all CPUs from /proc/stat,
+// in clock ticks. Idle and iowait count as not busy; guest time is already
+// part of user time.
+func readCPUTimes() (busy, total uint64, err error) {
+	data, err := os.ReadFile(hostProc("stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected %s format", hostProc("stat"))
+	}
+
+	// user nice system idle iowait irq softirq steal guest guest_nice
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unexpected %s format: %w", hostProc("stat"), err)
+		}
+		total += v
+		if i != 3 && i != 4 {
+			busy += v
+		}
+	}
+	return busy, total, nil
+}
@@ -7,25 +7,11 @@ import (
 	"github.com/StackExchange/wmi"
 )
 
-type CPUUtilization struct {
-	CPUPercent float64 `json:"cpu_percent"`
-}
-
 type Win32_PerfFormattedData_PerfOS_Processor struct {
 	Name             string
 	PercentProcessorTime uint64
 }
 
-type CPUCollector struct {
-	*BaseCollector
-}
-
-func NewCPUCollector() *CPUCollector {
-	return &CPUCollector{
-		BaseCollector: NewBaseCollector("cpu.utilization", false), // Disabled by default
-	}
-}
-
 func (c *CPUCollector) Collect(ctx context.Context) (interface{}, error) {
 	// Method 1: Use PerfMon counter for _Total
 	var perfData []Win32_PerfFormattedData_PerfOS_Processor
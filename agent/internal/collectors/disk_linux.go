@@ -0,0 +1,64 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Collect reports each block-device filesystem the host has mounted, named
+// by its mount point. The mounts are read from the host's init process so a
+// container sees the host's rather than its own; loop devices, such as snap
+// packages, and a device mounted twice are reported once or not at all.
+func (c *DiskCollector) Collect(ctx context.Context) (interface{}, error) {
+	f, err := os.Open(hostProc("1", "mounts"))
+	if err != nil {
+		if f, err = os.Open(hostProc("mounts")); err != nil {
+			return nil, err
+		}
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	var disks []DiskUtilization
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		device, mountPoint := fields[0], unescapeMount(fields[1])
+		if !strings.HasPrefix(device, "/dev/") || strings.HasPrefix(device, "/dev/loop") || seen[device] {
+			continue
+		}
+
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(hostRoot(mountPoint), &st); err != nil || st.Blocks == 0 {
+			continue
+		}
+		seen[device] = true
+
+		// Blocks reserved for root count as used, as they are to anyone else
+		totalBytes := int64(st.Blocks) * int64(st.Bsize)
+		freeBytes := int64(st.Bavail) * int64(st.Bsize)
+		disks = append(disks, DiskUtilization{
+			Name:       mountPoint,
+			TotalBytes: totalBytes,
+			FreeBytes:  freeBytes,
+			UsedBytes:  totalBytes - freeBytes,
+		})
+	}
+	return disks, scanner.Err()
+}
+
+// unescapeMount undoes the octal escapes /proc/mounts writes for spaces,
+// tabs, newlines and backslashes in mount points
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	r := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	return r.Replace(s)
+}
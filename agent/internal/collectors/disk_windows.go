@@ -6,13 +6,6 @@ import (
 	"github.com/StackExchange/wmi"
 )
 
-type DiskUtilization struct {
-	Name      string `json:"name"`
-	TotalBytes int64  `json:"total_bytes"`
-	FreeBytes  int64  `json:"free_bytes"`
-	UsedBytes  int64  `json:"used_bytes"`
-}
-
 type Win32_LogicalDisk struct {
 	DeviceID  string
 	DriveType uint32
@@ -20,16 +13,6 @@ type Win32_LogicalDisk struct {
 	FreeSpace uint64
 }
 
-type DiskCollector struct {
-	*BaseCollector
-}
-
-func NewDiskCollector() *DiskCollector {
-	return &DiskCollector{
-		BaseCollector: NewBaseCollector("disk.utilization", false), // Disabled by default
-	}
-}
-
 func (c *DiskCollector) Collect(ctx context.Context) (interface{}, error) {
 	var diskData []Win32_LogicalDisk
 	// DriveType=3 means local disk
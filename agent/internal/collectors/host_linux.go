@@ -0,0 +1,44 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// On Linux the collectors read the host from /proc, /sys and /etc. An agent
+// running in a container sees the host's through mounts named by HOST_PROC,
+// HOST_SYS, HOST_ETC and HOST_ROOT (the host's root filesystem, for disk
+// usage and package databases), and the node's name through NODE_NAME, as
+// the Kubernetes downward API sets it.
+func hostPath(env, def string, elem ...string) string {
+	root := os.Getenv(env)
+	if root == "" {
+		root = def
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+func hostProc(elem ...string) string { return hostPath("HOST_PROC", "/proc", elem...) }
+func hostSys(elem ...string) string  { return hostPath("HOST_SYS", "/sys", elem...) }
+func hostEtc(elem ...string) string  { return hostPath("HOST_ETC", "/etc", elem...) }
+func hostRoot(elem ...string) string { return hostPath("HOST_ROOT", "/", elem...) }
+
+// hostRelative returns a path under HOST_ROOT as the host sees it
+func hostRelative(path string) string {
+	rel, err := filepath.Rel(hostRoot(), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.Join("/", rel)
+}
+
+// readTrimmed returns a file's content without surrounding space, empty
+// when it can't be read
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,68 @@
+package collectors
+
+import "sort"
+
+// Signature states of a listener's executable
+const (
+	SignatureValid    = "valid"
+	SignatureUnsigned = "unsigned"
+	SignatureInvalid  = "invalid" // signed, but the signature doesn't verify
+)
+
+// Listener is a socket accepting connections, or a bound UDP socket, with
+// the process that owns it
+type Listener struct {
+	Protocol string `json:"protocol"` // tcp or udp
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	PID      int    `json:"pid,omitempty"` // unset when the owner couldn't be found
+	Process  string `json:"process,omitempty"`
+	Path     string `json:"path,omitempty"`
+	// Signer is the subject of the executable's code signing certificate,
+	// and Signature whether it verifies; Windows only
+	Signer    string `json:"signer,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// Services are the services running in the process, several when
+	// they share a host process such as svchost
+	Services []string `json:"services,omitempty"`
+}
+
+type ListenersCollector struct {
+	*BaseCollector
+}
+
+func NewListenersCollector() *ListenersCollector {
+	return &ListenersCollector{
+		BaseCollector: NewBaseCollector("network.listeners", false), // Disabled by default
+	}
+}
+
+// processInfo is what's reported of the process that owns a socket
+type processInfo struct {
+	name      string
+	path      string
+	signer    string
+	signature string
+	services  []string
+}
+
+func (p processInfo) apply(l *Listener) {
+	l.Process = p.name
+	l.Path = p.path
+	l.Signer = p.signer
+	l.Signature = p.signature
+	l.Services = p.services
+}
+
+func sortListeners(listeners []Listener) {
+	sort.Slice(listeners, func(i, j int) bool {
+		a, b := listeners[i], listeners[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Address < b.Address
+	})
+}
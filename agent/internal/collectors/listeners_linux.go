@@ -0,0 +1,150 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Collect reads the host's listening TCP and bound UDP sockets from its
+// init process's network tables, and finds each socket's process by its
+// inode among the open files of the host's processes, which takes root
+func (c *ListenersCollector) Collect(ctx context.Context) (interface{}, error) {
+	listeners := []Listener{}
+	inodes := make(map[string]int) // socket inode to its index in listeners
+
+	tables := []struct {
+		file, protocol string
+	}{
+		{"tcp", "tcp"}, {"tcp6", "tcp"}, {"udp", "udp"}, {"udp6", "udp"},
+	}
+	for _, t := range tables {
+		f, err := os.Open(hostProc("1", "net", t.file))
+		if err != nil {
+			if t.file == "tcp" {
+				return nil, err
+			}
+			continue // no IPv6
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			// 0A is LISTEN; UDP sockets that aren't connected are 07
+			if (t.protocol == "tcp" && fields[3] != "0A") || (t.protocol == "udp" && fields[3] != "07") {
+				continue
+			}
+			addr, port, ok := parseProcNetAddr(fields[1])
+			if !ok {
+				continue
+			}
+			inodes[fields[9]] = len(listeners)
+			listeners = append(listeners, Listener{Protocol: t.protocol, Address: addr, Port: port})
+		}
+		f.Close()
+	}
+
+	owners := socketOwners(inodes)
+	processes := make(map[int]processInfo)
+	for inode, i := range inodes {
+		pid, ok := owners[inode]
+		if !ok {
+			continue
+		}
+		info, ok := processes[pid]
+		if !ok {
+			info = linuxProcess(pid)
+			processes[pid] = info
+		}
+		listeners[i].PID = pid
+		info.apply(&listeners[i])
+	}
+
+	sortListeners(listeners)
+	return listeners, nil
+}
+
+// parseProcNetAddr parses a /proc/net address such as 0100007F:0016, whose
+// IP is in host byte order by 32-bit word
+func parseProcNetAddr(s string) (string, int, bool) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+	raw, err := hex.DecodeString(ipHex)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return "", 0, false
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	return net.IP(raw).String(), int(port), true
+}
+
+// socketOwners maps each socket inode to the first process found holding it
+func socketOwners(inodes map[string]int) map[string]int {
+	owners := make(map[string]int)
+	procs, err := os.ReadDir(hostProc())
+	if err != nil {
+		return owners
+	}
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		fds, err := os.ReadDir(hostProc(p.Name(), "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(hostProc(p.Name(), "fd", fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")
+			if _, ok := inodes[inode]; ok {
+				if _, seen := owners[inode]; !seen {
+					owners[inode] = pid
+				}
+			}
+		}
+	}
+	return owners
+}
+
+// linuxProcess describes a process, with the systemd unit it runs in as its
+// service
+func linuxProcess(pid int) processInfo {
+	dir := strconv.Itoa(pid)
+	info := processInfo{name: readTrimmed(hostProc(dir, "comm"))}
+	if exe, err := os.Readlink(hostProc(dir, "exe")); err == nil {
+		info.path = strings.TrimSuffix(exe, " (deleted)")
+	}
+
+	if data, err := os.ReadFile(hostProc(dir, "cgroup")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			parts := strings.SplitN(line, ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			if unit := filepath.Base(parts[2]); strings.HasSuffix(unit, ".service") {
+				info.services = []string{unit}
+				break
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,227 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	iphlpapi                = windows.NewLazySystemDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = iphlpapi.NewProc("GetExtendedTcpTable")
+	procGetExtendedUdpTable = iphlpapi.NewProc("GetExtendedUdpTable")
+)
+
+const (
+	tcpTableOwnerPIDListener = 3 // TCP_TABLE_OWNER_PID_LISTENER
+	udpTableOwnerPID         = 1 // UDP_TABLE_OWNER_PID
+)
+
+// MIB_TCPROW_OWNER_PID
+type tcpRowOwnerPID struct {
+	State      uint32
+	LocalAddr  [4]byte
+	LocalPort  uint32
+	RemoteAddr [4]byte
+	RemotePort uint32
+	OwningPID  uint32
+}
+
+// MIB_TCP6ROW_OWNER_PID
+type tcp6RowOwnerPID struct {
+	LocalAddr     [16]byte
+	LocalScopeID  uint32
+	LocalPort     uint32
+	RemoteAddr    [16]byte
+	RemoteScopeID uint32
+	RemotePort    uint32
+	State         uint32
+	OwningPID     uint32
+}
+
+// MIB_UDPROW_OWNER_PID
+type udpRowOwnerPID struct {
+	LocalAddr [4]byte
+	LocalPort uint32
+	OwningPID uint32
+}
+
+// MIB_UDP6ROW_OWNER_PID
+type udp6RowOwnerPID struct {
+	LocalAddr    [16]byte
+	LocalScopeID uint32
+	LocalPort    uint32
+	OwningPID    uint32
+}
+
+func (c *ListenersCollector) Collect(ctx context.Context) (interface{}, error) {
+	listeners := []Listener{}
+
+	tables := []struct {
+		proc   *windows.LazyProc
+		family uint32
+		class  uint32
+		read   func(buf []byte) []Listener
+	}{
+		{procGetExtendedTcpTable, windows.AF_INET, tcpTableOwnerPIDListener, func(buf []byte) []Listener {
+			var out []Listener
+			for _, row := range tableRows[tcpRowOwnerPID](buf) {
+				out = append(out, Listener{Protocol: "tcp", Address: net.IP(row.LocalAddr[:]).String(), Port: tablePort(row.LocalPort), PID: int(row.OwningPID)})
+			}
+			return out
+		}},
+		{procGetExtendedTcpTable, windows.AF_INET6, tcpTableOwnerPIDListener, func(buf []byte) []Listener {
+			var out []Listener
+			for _, row := range tableRows[tcp6RowOwnerPID](buf) {
+				out = append(out, Listener{Protocol: "tcp", Address: net.IP(row.LocalAddr[:]).String(), Port: tablePort(row.LocalPort), PID: int(row.OwningPID)})
+			}
+			return out
+		}},
+		{procGetExtendedUdpTable, windows.AF_INET, udpTableOwnerPID, func(buf []byte) []Listener {
+			var out []Listener
+			for _, row := range tableRows[udpRowOwnerPID](buf) {
+				out = append(out, Listener{Protocol: "udp", Address: net.IP(row.LocalAddr[:]).String(), Port: tablePort(row.LocalPort), PID: int(row.OwningPID)})
+			}
+			return out
+		}},
+		{procGetExtendedUdpTable, windows.AF_INET6, udpTableOwnerPID, func(buf []byte) []Listener {
+			var out []Listener
+			for _, row := range tableRows[udp6RowOwnerPID](buf) {
+				out = append(out, Listener{Protocol: "udp", Address: net.IP(row.LocalAddr[:]).String(), Port: tablePort(row.LocalPort), PID: int(row.OwningPID)})
+			}
+			return out
+		}},
+	}
+	for _, t := range tables {
+		buf, err := socketTable(t.proc, t.family, t.class)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, t.read(buf)...)
+	}
+
+	services := servicesByPID()
+	signers := make(map[string]fileSigner)
+	processes := make(map[int]processInfo)
+	for i := range listeners {
+		pid := listeners[i].PID
+		info, ok := processes[pid]
+		if !ok {
+			info = windowsProcess(pid, signers)
+			info.services = services[uint32(pid)]
+			processes[pid] = info
+		}
+		info.apply(&listeners[i])
+	}
+
+	sortListeners(listeners)
+	return listeners, nil
+}
+
+// socketTable returns an IP Helper socket table, growing the buffer while
+// sockets are opened between the calls
+func socketTable(proc *windows.LazyProc, family, class uint32) ([]byte, error) {
+	size := uint32(16 * 1024)
+	for {
+		buf := make([]byte, size)
+		r, _, _ := proc.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0, uintptr(family), uintptr(class), 0)
+		switch windows.Errno(r) {
+		case 0:
+			return buf, nil
+		case windows.ERROR_INSUFFICIENT_BUFFER:
+			continue
+		default:
+			return nil, fmt.Errorf("%s: %w", proc.Name, windows.Errno(r))
+		}
+	}
+}
+
+// tableRows returns the rows of an IP Helper table, which start after its
+// DWORD count
+func tableRows[T any](buf []byte) []T {
+	n := *(*uint32)(unsafe.Pointer(&buf[0]))
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(&buf[4])), n)
+}
+
+// tablePort converts a port from the tables' network byte order
+func tablePort(port uint32) int {
+	return int(port&0xff)<<8 | int(port>>8&0xff)
+}
+
+// windowsProcess describes a process, checking the signature of each
+// executable once per collection
+func windowsProcess(pid int, signers map[string]fileSigner) processInfo {
+	switch pid {
+	case 0:
+		return processInfo{name: "System Idle Process"}
+	case 4:
+		return processInfo{name: "System"}
+	}
+
+	info := processInfo{}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return info
+	}
+	defer windows.CloseHandle(h)
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &size); err != nil {
+		return info
+	}
+	info.path = windows.UTF16ToString(buf[:size])
+	info.name = filepath.Base(info.path)
+
+	signer, ok := signers[info.path]
+	if !ok {
+		signer = fileSignature(info.path)
+		signers[info.path] = signer
+	}
+	info.signer, info.signature = signer.subject, signer.status
+	return info
+}
+
+// servicesByPID maps the ID of each process running services to their
+// names
+func servicesByPID() map[uint32][]string {
+	services := make(map[uint32][]string)
+	mgr, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_ENUMERATE_SERVICE)
+	if err != nil {
+		return services
+	}
+	defer windows.CloseServiceHandle(mgr)
+
+	var needed, count, resume uint32
+	buf := make([]byte, 64*1024)
+	for {
+		err := windows.EnumServicesStatusEx(mgr, windows.SC_ENUM_PROCESS_INFO, windows.SERVICE_WIN32, windows.SERVICE_ACTIVE,
+			&buf[0], uint32(len(buf)), &needed, &count, &resume, nil)
+		if count > 0 {
+			entries := unsafe.Slice((*windows.ENUM_SERVICE_STATUS_PROCESS)(unsafe.Pointer(&buf[0])), count)
+			for _, e := range entries {
+				pid := e.ServiceStatusProcess.ProcessId
+				services[pid] = append(services[pid], windows.UTF16PtrToString(e.ServiceName))
+			}
+		}
+		if err != windows.ERROR_MORE_DATA {
+			break
+		}
+		if needed > uint32(len(buf)) {
+			buf = make([]byte, needed)
+		}
+	}
+
+	for _, names := range services {
+		sort.Strings(names)
+	}
+	return services
+}
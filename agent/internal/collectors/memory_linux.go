@@ -0,0 +1,50 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Collect reads the host's memory from /proc/meminfo. Memory the kernel
+// can reclaim, such as the page cache, counts as free.
+func (c *MemoryCollector) Collect(ctx context.Context) (interface{}, error) {
+	f, err := os.Open(hostProc("meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var totalKB, availableKB int64 = -1, -1
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			totalKB = v
+		case "MemAvailable:":
+			availableKB = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if totalKB < 0 || availableKB < 0 {
+		return nil, fmt.Errorf("MemTotal or MemAvailable missing from %s", hostProc("meminfo"))
+	}
+
+	return &MemoryUsage{
+		UsedBytes:  (totalKB - availableKB) * 1024,
+		TotalBytes: totalKB * 1024,
+	}, nil
+}
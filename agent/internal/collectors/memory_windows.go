@@ -6,26 +6,11 @@ import (
 	"github.com/StackExchange/wmi"
 )
 
-type MemoryUsage struct {
-	UsedBytes  int64 `json:"used_bytes"`
-	TotalBytes int64 `json:"total_bytes"`
-}
-
 type Win32_OperatingSystem_Memory struct {
 	TotalVisibleMemorySize uint64
 	FreePhysicalMemory     uint64
 }
 
-type MemoryCollector struct {
-	*BaseCollector
-}
-
-func NewMemoryCollector() *MemoryCollector {
-	return &MemoryCollector{
-		BaseCollector: NewBaseCollector("memory.usage", false), // Disabled by default
-	}
-}
-
 func (c *MemoryCollector) Collect(ctx context.Context) (interface{}, error) {
 	var memData []Win32_OperatingSystem_Memory
 	err := wmi.Query("SELECT TotalVisibleMemorySize, FreePhysicalMemory FROM Win32_OperatingSystem", &memData)
@@ -0,0 +1,69 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+)
+
+// Collect describes the host from os-release, the kernel and the DMI
+// firmware tables. Nodes have no interactive user, so LastUser is left
+// empty, and LastPatchAt is when the package database last changed.
+func (c *OSInfoCollector) Collect(ctx context.Context) (interface{}, error) {
+	info := &OSInfo{
+		Version: readTrimmed(hostProc("sys", "kernel", "osrelease")),
+		Make:    readTrimmed(hostSys("class", "dmi", "id", "sys_vendor")),
+		Model:   readTrimmed(hostSys("class", "dmi", "id", "product_name")),
+		// Readable by root only
+		Serial: readTrimmed(hostSys("class", "dmi", "id", "product_serial")),
+	}
+
+	release, err := readKeyValues(hostEtc("os-release"))
+	if err != nil {
+		release, _ = readKeyValues(hostRoot("usr", "lib", "os-release"))
+	}
+	info.Caption = release["PRETTY_NAME"]
+	if info.Caption == "" {
+		info.Caption = strings.TrimSpace(release["NAME"] + " " + release["VERSION"])
+	}
+
+	// The node's name when running as a pod, otherwise the host's
+	info.Hostname = os.Getenv("NODE_NAME")
+	if info.Hostname == "" {
+		info.Hostname = readTrimmed(hostProc("sys", "kernel", "hostname"))
+	}
+	if info.Hostname == "" {
+		info.Hostname, _ = os.Hostname()
+	}
+	if domain := readTrimmed(hostProc("sys", "kernel", "domainname")); domain != "(none)" {
+		info.Domain = domain
+	}
+
+	info.LastPatchAt = lastPackageChange()
+	return info, nil
+}
+
+// lastPackageChange returns when the newest package database found was
+// last written, in RFC 3339, or "" when there is none
+func lastPackageChange() string {
+	var latest time.Time
+	for _, path := range packageDatabases {
+		if fi, err := os.Stat(hostRoot(path)); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	if latest.IsZero() {
+		return ""
+	}
+	return latest.UTC().Format(time.RFC3339)
+}
+
+// packageDatabases are the package databases of Debian, Alpine and RPM
+// based distributions, relative to the host's root
+var packageDatabases = []string{
+	"var/lib/dpkg/status",
+	"lib/apk/db/installed",
+	"var/lib/rpm/rpmdb.sqlite",
+	"var/lib/rpm/Packages",
+}
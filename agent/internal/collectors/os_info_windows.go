@@ -3,23 +3,14 @@ package collectors
 import (
 	"context"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/StackExchange/wmi"
 	"golang.org/x/sys/windows/registry"
 )
 
-type OSInfo struct {
-	Caption   string `json:"caption"`
-	Version   string `json:"version"`
-	Make      string `json:"make"`
-	Model     string `json:"model"`
-	Serial    string `json:"serial"`
-	Hostname  string `json:"hostname"`
-	Domain    string `json:"domain"`
-	LastUser  string `json:"last_user"`
-}
-
 type Win32_OperatingSystem struct {
 	Caption           string
 	Version           string
@@ -38,14 +29,8 @@ type Win32_BIOS struct {
 	SerialNumber string
 }
 
-type OSInfoCollector struct {
-	*BaseCollector
-}
-
-func NewOSInfoCollector() *OSInfoCollector {
-	return &OSInfoCollector{
-		BaseCollector: NewBaseCollector("os.info", true), // Always enabled
-	}
+type Win32_QuickFixEngineering struct {
+	InstalledOn string
 }
 
 func (c *OSInfoCollector) Collect(ctx context.Context) (interface{}, error) {
@@ -84,6 +69,13 @@ func (c *OSInfoCollector) Collect(ctx context.Context) (interface{}, error) {
 		info.Serial = strings.TrimSpace(biosInfo[0].SerialNumber)
 	}
 
+	// Query WMI for installed updates
+	var hotfixes []Win32_QuickFixEngineering
+	err = wmi.Query("SELECT InstalledOn FROM Win32_QuickFixEngineering", &hotfixes)
+	if err == nil {
+		info.LastPatchAt = lastPatchTime(hotfixes)
+	}
+
 	// Fallback: try to get last logged in user from registry
 	if info.LastUser == "" {
 		info.LastUser = getLastLoggedInUser()
@@ -112,4 +104,28 @@ func getLastLoggedInUser() string {
 		return lastUser[idx+1:]
 	}
 	return lastUser
-}
\ No newline at end of file
+}
+// lastPatchTime returns the newest hotfix install date. InstalledOn is
+// usually M/D/YYYY but some updates report a hex FILETIME instead.
+func lastPatchTime(hotfixes []Win32_QuickFixEngineering) string {
+	var latest time.Time
+	for _, hf := range hotfixes {
+		value := strings.TrimSpace(hf.InstalledOn)
+		installed, err := time.Parse("1/2/2006", value)
+		if err != nil {
+			ft, err := strconv.ParseInt(value, 16, 64)
+			if err != nil || ft <= 0 {
+				continue
+			}
+			// FILETIME counts 100ns intervals since 1601-01-01
+			installed = time.Unix(0, 0).UTC().Add(time.Duration(ft-116444736000000000) * 100)
+		}
+		if installed.After(latest) {
+			latest = installed
+		}
+	}
+	if latest.IsZero() {
+		return ""
+	}
+	return latest.UTC().Format(time.RFC3339)
+}
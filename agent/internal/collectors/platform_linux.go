@@ -0,0 +1,7 @@
+package collectors
+
+// PlatformCollectors returns the collectors that only exist on this
+// platform
+func PlatformCollectors() []Collector {
+	return nil
+}
@@ -0,0 +1,207 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// PowerSettings is the active power plan's sleep settings and what the
+// platform supports
+type PowerSettings struct {
+	PlanName string `json:"plan_name"`
+	PlanGUID string `json:"plan_guid"`
+	// Timeouts plugged in and on battery; a laptop's policy usually differs
+	OnAC      PowerTimeouts `json:"ac"`
+	OnBattery PowerTimeouts `json:"battery"`
+	// PolicyManaged is set when Group Policy sets any of the timeouts, so
+	// they were taken from the policy rather than the plan
+	PolicyManaged bool `json:"policy_managed"`
+	// ModernStandby is set on devices that sleep in S0 low-power idle
+	// (connected standby) rather than S3
+	ModernStandby    bool `json:"modern_standby"`
+	HibernateEnabled bool `json:"hibernate_enabled"`
+	FastStartup      bool `json:"fast_startup"`
+}
+
+// PowerTimeouts are idle timeouts in seconds, 0 for never
+type PowerTimeouts struct {
+	DisplayOffSeconds int `json:"display_off_seconds"`
+	SleepSeconds      int `json:"sleep_seconds"`
+	HibernateSeconds  int `json:"hibernate_seconds"`
+}
+
+type PowerCollector struct {
+	*BaseCollector
+}
+
+func NewPowerCollector() *PowerCollector {
+	return &PowerCollector{
+		BaseCollector: NewBaseCollector("power.settings", false), // Disabled by default
+	}
+}
+
+var (
+	powrprof                   = windows.NewLazySystemDLL("powrprof.dll")
+	procPowerGetActiveScheme   = powrprof.NewProc("PowerGetActiveScheme")
+	procPowerReadFriendlyName  = powrprof.NewProc("PowerReadFriendlyName")
+	procPowerReadACValueIndex  = powrprof.NewProc("PowerReadACValueIndex")
+	procPowerReadDCValueIndex  = powrprof.NewProc("PowerReadDCValueIndex")
+	procCallNtPowerInformation = powrprof.NewProc("CallNtPowerInformation")
+)
+
+// Power setting subgroups and settings, from winnt.h
+var (
+	guidVideoSubgroup = mustGUID("{7516B95F-F776-4464-8C53-06167F40CC99}")
+	guidVideoIdle     = mustGUID("{3C0BC021-C8A8-4E07-A973-6B14CBCB2B7E}")
+	guidSleepSubgroup = mustGUID("{238C9FA8-0AAD-41ED-83F4-97BE242C8F20}")
+	guidStandbyIdle   = mustGUID("{29F6C1DB-86DA-48C5-9FDB-F2B67B1F44DA}")
+	guidHibernateIdle = mustGUID("{9D7815A6-7EE4-497E-8888-515A05F02364}")
+)
+
+// systemPowerCapabilities is SYSTEM_POWER_CAPABILITIES up to its spare
+// bytes, which is all that's read of it
+type systemPowerCapabilities struct {
+	PowerButtonPresent        byte
+	SleepButtonPresent        byte
+	LidPresent                byte
+	SystemS1                  byte
+	SystemS2                  byte
+	SystemS3                  byte
+	SystemS4                  byte
+	SystemS5                  byte
+	HiberFilePresent          byte
+	FullWake                  byte
+	VideoDimPresent           byte
+	ApmPresent                byte
+	UpsPresent                byte
+	ThermalControl            byte
+	ProcessorThrottle         byte
+	ProcessorMinThrottle      byte
+	ProcessorMaxThrottle      byte
+	FastSystemS4              byte
+	Hiberboot                 byte
+	WakeAlarmPresent          byte
+	AoAc                      byte
+	DiskSpinDown              byte
+	HiberFileType             byte
+	AoAcConnectivitySupported byte
+	_                         [52]byte
+}
+
+// systemPowerCapabilitiesLevel is CallNtPowerInformation's
+// SystemPowerCapabilities
+const systemPowerCapabilitiesLevel = 4
+
+func mustGUID(s string) windows.GUID {
+	guid, err := windows.GUIDFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return guid
+}
+
+func (c *PowerCollector) Collect(ctx context.Context) (interface{}, error) {
+	scheme, err := activePowerScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &PowerSettings{
+		PlanName: powerSchemeName(scheme),
+		PlanGUID: strings.ToLower(strings.Trim(scheme.String(), "{}")),
+	}
+
+	timeouts := []struct {
+		subgroup, setting *windows.GUID
+		ac, dc            *int
+	}{
+		{&guidVideoSubgroup, &guidVideoIdle, &settings.OnAC.DisplayOffSeconds, &settings.OnBattery.DisplayOffSeconds},
+		{&guidSleepSubgroup, &guidStandbyIdle, &settings.OnAC.SleepSeconds, &settings.OnBattery.SleepSeconds},
+		{&guidSleepSubgroup, &guidHibernateIdle, &settings.OnAC.HibernateSeconds, &settings.OnBattery.HibernateSeconds},
+	}
+	for _, t := range timeouts {
+		ac, acPolicy := readPowerValue(procPowerReadACValueIndex, "ACSettingIndex", scheme, t.subgroup, t.setting)
+		dc, dcPolicy := readPowerValue(procPowerReadDCValueIndex, "DCSettingIndex", scheme, t.subgroup, t.setting)
+		*t.ac, *t.dc = ac, dc
+		settings.PolicyManaged = settings.PolicyManaged || acPolicy || dcPolicy
+	}
+
+	var caps systemPowerCapabilities
+	r, _, _ := procCallNtPowerInformation.Call(systemPowerCapabilitiesLevel, 0, 0,
+		uintptr(unsafe.Pointer(&caps)), unsafe.Sizeof(caps))
+	if r == 0 {
+		settings.ModernStandby = caps.AoAc != 0
+		settings.HibernateEnabled = caps.SystemS4 != 0 && caps.HiberFilePresent != 0
+		settings.FastStartup = caps.Hiberboot != 0 && settings.HibernateEnabled && hiberbootEnabled()
+	}
+
+	return settings, nil
+}
+
+// activePowerScheme returns the GUID of the active power plan
+func activePowerScheme() (*windows.GUID, error) {
+	var scheme *windows.GUID
+	if r, _, _ := procPowerGetActiveScheme.Call(0, uintptr(unsafe.Pointer(&scheme))); r != 0 {
+		return nil, fmt.Errorf("PowerGetActiveScheme: %w", windows.Errno(r))
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(scheme)))
+
+	guid := *scheme
+	return &guid, nil
+}
+
+func powerSchemeName(scheme *windows.GUID) string {
+	var size uint32
+	procPowerReadFriendlyName.Call(0, uintptr(unsafe.Pointer(scheme)), 0, 0, 0, uintptr(unsafe.Pointer(&size)))
+	if size < 2 {
+		return ""
+	}
+
+	buf := make([]uint16, size/2)
+	r, _, _ := procPowerReadFriendlyName.Call(0, uintptr(unsafe.Pointer(scheme)), 0, 0,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if r != 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf)
+}
+
+// readPowerValue returns a timeout in seconds and whether it was set by
+// Group Policy, which overrides the plan's own value without changing it
+func readPowerValue(proc *windows.LazyProc, policyValue string, scheme, subgroup, setting *windows.GUID) (int, bool) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SOFTWARE\Policies\Microsoft\Power\PowerSettings\`+setting.String(), registry.QUERY_VALUE)
+	if err == nil {
+		value, _, err := key.GetIntegerValue(policyValue)
+		key.Close()
+		if err == nil {
+			return int(value), true
+		}
+	}
+
+	var value uint32
+	r, _, _ := proc.Call(0, uintptr(unsafe.Pointer(scheme)), uintptr(unsafe.Pointer(subgroup)),
+		uintptr(unsafe.Pointer(setting)), uintptr(unsafe.Pointer(&value)))
+	if r != 0 {
+		return 0, false
+	}
+	return int(value), false
+}
+
+// hiberbootEnabled reads whether fast startup is turned on
+func hiberbootEnabled() bool {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SYSTEM\CurrentControlSet\Control\Session Manager\Power`, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+
+	value, _, err := key.GetIntegerValue("HiberbootEnabled")
+	return err == nil && value != 0
+}
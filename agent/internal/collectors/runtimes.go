@@ -0,0 +1,157 @@
+package collectors
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Runtime kinds
+const (
+	RuntimeDotNetFramework = "dotnet-framework"
+	RuntimeDotNet          = "dotnet"
+	RuntimeJava            = "java"
+	RuntimePython          = "python"
+)
+
+// InstalledRuntime is one installed language runtime. Runtimes are found
+// where they install themselves rather than through the installed programs
+// list, which misses copies unpacked from archives or bundled with other
+// software.
+type InstalledRuntime struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"` // e.g. Microsoft.NETCore.App, or the JDK's image type
+	Vendor  string `json:"vendor,omitempty"`
+	Version string `json:"version"`
+	Path    string `json:"path,omitempty"`
+}
+
+type RuntimesCollector struct {
+	*BaseCollector
+}
+
+func NewRuntimesCollector() *RuntimesCollector {
+	return &RuntimesCollector{
+		BaseCollector: NewBaseCollector("runtimes.installed", false), // Disabled by default
+	}
+}
+
+// dotnetRuntimes lists the shared frameworks, such as Microsoft.NETCore.App
+// and Microsoft.AspNetCore.App, of a .NET install directory
+func dotnetRuntimes(root string) []InstalledRuntime {
+	frameworks, err := os.ReadDir(filepath.Join(root, "shared"))
+	if err != nil {
+		return nil
+	}
+
+	var runtimes []InstalledRuntime
+	for _, framework := range frameworks {
+		versions, err := os.ReadDir(filepath.Join(root, "shared", framework.Name()))
+		if err != nil {
+			continue
+		}
+		for _, version := range versions {
+			if !version.IsDir() {
+				continue
+			}
+			runtimes = append(runtimes, InstalledRuntime{
+				Kind:    RuntimeDotNet,
+				Name:    framework.Name(),
+				Vendor:  "Microsoft",
+				Version: version.Name(),
+				Path:    filepath.Join(root, "shared", framework.Name(), version.Name()),
+			})
+		}
+	}
+	return runtimes
+}
+
+// javaRuntime describes the Java runtime in home from its release file,
+// which has its version and, for most builds since Java 9, its vendor.
+// Without one it is only reported when version, from where the runtime
+// registered itself, is known.
+func javaRuntime(home, version string) (InstalledRuntime, bool) {
+	rt := InstalledRuntime{Kind: RuntimeJava, Name: "JRE", Version: version, Path: home}
+	if release, err := readKeyValues(filepath.Join(home, "release")); err == nil {
+		if v := release["JAVA_VERSION"]; v != "" {
+			rt.Version = v
+		}
+		rt.Vendor = release["IMPLEMENTOR"]
+		if release["IMAGE_TYPE"] == "JDK" {
+			rt.Name = "JDK"
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, "lib", "tools.jar")); err == nil {
+		rt.Name = "JDK" // Java 8 and earlier
+	}
+	return rt, rt.Version != ""
+}
+
+// javaHomes lists the directories under each parent that hold a Java
+// runtime, such as C:\Program Files\Eclipse Adoptium\jdk-17.0.9.9-hotspot
+func javaHomes(parents ...string) []string {
+	var homes []string
+	for _, parent := range parents {
+		entries, err := os.ReadDir(parent)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			home := filepath.Join(parent, entry.Name())
+			if _, err := os.Stat(filepath.Join(home, "release")); err == nil {
+				homes = append(homes, home)
+			}
+		}
+	}
+	return homes
+}
+
+// sortRuntimes orders runtimes by kind, name and version, dropping any
+// found twice at the same path
+func sortRuntimes(runtimes []InstalledRuntime) []InstalledRuntime {
+	sort.SliceStable(runtimes, func(i, j int) bool {
+		a, b := runtimes[i], runtimes[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+
+	seen := make(map[string]bool)
+	unique := []InstalledRuntime{}
+	for _, rt := range runtimes {
+		key := rt.Kind + "|" + rt.Name + "|" + rt.Version + "|" + strings.ToLower(filepath.Clean(rt.Path))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, rt)
+	}
+	return unique
+}
+
+// readKeyValues reads a file of KEY=value lines, such as os-release, with
+// optionally quoted values
+func readKeyValues(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,55 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"regexp"
+)
+
+// pythonBinary matches versioned interpreters such as python3.11, not
+// python3.11-config
+var pythonBinary = regexp.MustCompile(`^python(\d+\.\d+)$`)
+
+// Collect finds the host's .NET, Java and Python runtimes where distribution
+// packages and the usual tarball installs put them
+func (c *RuntimesCollector) Collect(ctx context.Context) (interface{}, error) {
+	var runtimes []InstalledRuntime
+
+	for _, dir := range []string{"usr/share/dotnet", "usr/lib/dotnet", "usr/lib64/dotnet", "opt/dotnet"} {
+		runtimes = append(runtimes, dotnetRuntimes(hostRoot(dir))...)
+	}
+
+	for _, home := range javaHomes(hostRoot("usr/lib/jvm"), hostRoot("usr/java"), hostRoot("opt/java")) {
+		// Distributions symlink their default runtime; report the target
+		if info, err := os.Lstat(home); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if rt, ok := javaRuntime(home, ""); ok {
+			runtimes = append(runtimes, rt)
+		}
+	}
+
+	for _, dir := range []string{"usr/bin", "usr/local/bin", "opt/python/bin"} {
+		entries, err := os.ReadDir(hostRoot(dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			m := pythonBinary.FindStringSubmatch(entry.Name())
+			if m == nil || entry.IsDir() {
+				continue
+			}
+			runtimes = append(runtimes, InstalledRuntime{
+				Kind:    RuntimePython,
+				Name:    "python" + m[1],
+				Version: m[1],
+				Path:    hostRoot(dir, entry.Name()),
+			})
+		}
+	}
+
+	for i := range runtimes {
+		runtimes[i].Path = hostRelative(runtimes[i].Path)
+	}
+	return sortRuntimes(runtimes), nil
+}
@@ -0,0 +1,268 @@
+package collectors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// dotNetFrameworkReleases maps the Release value of the .NET Framework 4.5
+// and later registry key to the lowest Release of each version, newest
+// first
+var dotNetFrameworkReleases = []struct {
+	release uint64
+	version string
+}{
+	{533320, "4.8.1"},
+	{528040, "4.8"},
+	{461808, "4.7.2"},
+	{461308, "4.7.1"},
+	{460798, "4.7"},
+	{394802, "4.6.2"},
+	{394254, "4.6.1"},
+	{393295, "4.6"},
+	{379893, "4.5.2"},
+	{378675, "4.5.1"},
+	{378389, "4.5"},
+}
+
+// javaSoftKeys are where Oracle's installers, and some others', register
+// Java runtimes by version
+var javaSoftKeys = []string{
+	`SOFTWARE\JavaSoft\Java Runtime Environment`,
+	`SOFTWARE\JavaSoft\Java Development Kit`,
+	`SOFTWARE\JavaSoft\JRE`,
+	`SOFTWARE\JavaSoft\JDK`,
+	`SOFTWARE\WOW6432Node\JavaSoft\Java Runtime Environment`,
+	`SOFTWARE\WOW6432Node\JavaSoft\Java Development Kit`,
+	`SOFTWARE\WOW6432Node\JavaSoft\JRE`,
+	`SOFTWARE\WOW6432Node\JavaSoft\JDK`,
+}
+
+// javaVendorDirs are the Program Files directories Java distributions
+// install under
+var javaVendorDirs = []string{
+	"Java", "Eclipse Adoptium", "Eclipse Foundation", "AdoptOpenJDK", "Zulu",
+	"Microsoft", "Amazon Corretto", "BellSoft", "Semeru", "RedHat",
+}
+
+var patchLevelVersion = regexp.MustCompile(`#define\s+PY_VERSION\s+"([^"]+)"`)
+
+func (c *RuntimesCollector) Collect(ctx context.Context) (interface{}, error) {
+	var runtimes []InstalledRuntime
+	runtimes = append(runtimes, dotNetFrameworks()...)
+
+	programFiles := []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)")}
+	for _, dir := range programFiles {
+		if dir != "" {
+			runtimes = append(runtimes, dotnetRuntimes(filepath.Join(dir, "dotnet"))...)
+		}
+	}
+
+	runtimes = append(runtimes, javaRuntimes(programFiles)...)
+	runtimes = append(runtimes, pythonRuntimes()...)
+
+	return sortRuntimes(runtimes), nil
+}
+
+func dotNetFrameworks() []InstalledRuntime {
+	ndp, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\NET Framework Setup\NDP`, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil
+	}
+	defer ndp.Close()
+
+	versions, err := ndp.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil
+	}
+
+	var runtimes []InstalledRuntime
+	for _, name := range versions {
+		// v4 is read from its Full profile below; v4.0 is the client
+		// profile's leftover key
+		if !strings.HasPrefix(name, "v") || name == "v4" || name == "v4.0" {
+			continue
+		}
+		key, err := registry.OpenKey(ndp, name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		install, _, _ := key.GetIntegerValue("Install")
+		version, _, _ := key.GetStringValue("Version")
+		key.Close()
+		if install == 1 && version != "" {
+			runtimes = append(runtimes, InstalledRuntime{Kind: RuntimeDotNetFramework, Name: ".NET Framework", Vendor: "Microsoft", Version: version})
+		}
+	}
+
+	if key, err := registry.OpenKey(ndp, `v4\Full`, registry.QUERY_VALUE); err == nil {
+		release, _, err := key.GetIntegerValue("Release")
+		version, _, _ := key.GetStringValue("Version")
+		key.Close()
+		if err == nil {
+			for _, r := range dotNetFrameworkReleases {
+				if release >= r.release {
+					version = r.version
+					break
+				}
+			}
+		}
+		if version != "" {
+			runtimes = append(runtimes, InstalledRuntime{Kind: RuntimeDotNetFramework, Name: ".NET Framework", Vendor: "Microsoft", Version: version})
+		}
+	}
+
+	return runtimes
+}
+
+func javaRuntimes(programFiles []string) []InstalledRuntime {
+	var runtimes []InstalledRuntime
+	for _, path := range javaSoftKeys {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		versions, _ := key.ReadSubKeyNames(-1)
+		for _, version := range versions {
+			sub, err := registry.OpenKey(key, version, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			home, _, err := sub.GetStringValue("JavaHome")
+			sub.Close()
+			if err != nil || home == "" {
+				continue
+			}
+			if rt, ok := javaRuntime(home, version); ok {
+				runtimes = append(runtimes, rt)
+			}
+		}
+		key.Close()
+	}
+
+	var parents []string
+	for _, dir := range programFiles {
+		if dir == "" {
+			continue
+		}
+		for _, vendor := range javaVendorDirs {
+			parents = append(parents, filepath.Join(dir, vendor))
+		}
+	}
+	for _, home := range javaHomes(parents...) {
+		if rt, ok := javaRuntime(home, ""); ok {
+			runtimes = append(runtimes, rt)
+		}
+	}
+
+	return runtimes
+}
+
+// pythonRuntimes lists the Pythons registered as PEP 514 describes, for the
+// machine and for each user whose profile is loaded; python.org's installer
+// installs for the user by default
+func pythonRuntimes() []InstalledRuntime {
+	type root struct {
+		key  registry.Key
+		path string
+	}
+	roots := []root{
+		{registry.LOCAL_MACHINE, `SOFTWARE\Python`},
+		{registry.LOCAL_MACHINE, `SOFTWARE\WOW6432Node\Python`},
+	}
+	if users, err := registry.OpenKey(registry.USERS, "", registry.ENUMERATE_SUB_KEYS); err == nil {
+		sids, _ := users.ReadSubKeyNames(-1)
+		users.Close()
+		for _, sid := range sids {
+			if strings.HasPrefix(sid, "S-1-5-21-") && !strings.HasSuffix(sid, "_Classes") {
+				roots = append(roots, root{registry.USERS, sid + `\SOFTWARE\Python`})
+			}
+		}
+	}
+
+	var runtimes []InstalledRuntime
+	for _, r := range roots {
+		key, err := registry.OpenKey(r.key, r.path, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		companies, _ := key.ReadSubKeyNames(-1)
+		for _, company := range companies {
+			// The py launcher registers itself here too
+			if company == "PyLauncher" {
+				continue
+			}
+			runtimes = append(runtimes, pythonCompanyRuntimes(key, company)...)
+		}
+		key.Close()
+	}
+	return runtimes
+}
+
+func pythonCompanyRuntimes(parent registry.Key, company string) []InstalledRuntime {
+	key, err := registry.OpenKey(parent, company, registry.ENUMERATE_SUB_KEYS|registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+
+	vendor, _, _ := key.GetStringValue("DisplayName")
+	if vendor == "" {
+		vendor = company
+		if company == "PythonCore" {
+			vendor = "Python Software Foundation"
+		}
+	}
+
+	tags, _ := key.ReadSubKeyNames(-1)
+	var runtimes []InstalledRuntime
+	for _, tag := range tags {
+		tagKey, err := registry.OpenKey(key, tag, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		name, _, _ := tagKey.GetStringValue("DisplayName")
+		version, _, _ := tagKey.GetStringValue("Version")
+		if version == "" {
+			version, _, _ = tagKey.GetStringValue("SysVersion")
+		}
+		tagKey.Close()
+		if name == "" {
+			name = tag
+		}
+
+		dir := ""
+		if installKey, err := registry.OpenKey(key, tag+`\InstallPath`, registry.QUERY_VALUE); err == nil {
+			dir, _, _ = installKey.GetStringValue("")
+			installKey.Close()
+		}
+		if dir == "" {
+			continue
+		}
+
+		// PythonCore tags are the version, e.g. 3.12 or 3.12-32; the
+		// headers have the patch release
+		if data, err := os.ReadFile(filepath.Join(dir, "include", "patchlevel.h")); err == nil {
+			if m := patchLevelVersion.FindSubmatch(data); m != nil {
+				version = string(m[1])
+			}
+		}
+		if version == "" {
+			version = strings.TrimSuffix(tag, "-32")
+		}
+
+		runtimes = append(runtimes, InstalledRuntime{
+			Kind:    RuntimePython,
+			Name:    name,
+			Vendor:  vendor,
+			Version: version,
+			Path:    dir,
+		})
+	}
+	return runtimes
+}
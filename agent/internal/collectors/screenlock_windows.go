@@ -0,0 +1,156 @@
+package collectors
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// ScreenLockCompliance is the settings that lock an idle device: the
+// machine's inactivity limit, whether waking from sleep asks for a sign-in,
+// and the screen saver of each signed-in user
+type ScreenLockCompliance struct {
+	// InactivityTimeoutSeconds is the "Interactive logon: Machine
+	// inactivity limit" security policy, 0 when it isn't set
+	InactivityTimeoutSeconds int  `json:"inactivity_timeout_seconds"`
+	LockOnResumeAC           bool `json:"lock_on_resume_ac"`
+	LockOnResumeBattery      bool `json:"lock_on_resume_battery"`
+	// LockOnResumePolicyManaged is set when Group Policy sets whether
+	// waking asks for a sign-in
+	LockOnResumePolicyManaged bool              `json:"lock_on_resume_policy_managed"`
+	Users                     []UserScreenSaver `json:"users"`
+}
+
+// UserScreenSaver is one user's screen saver settings, as Group Policy sets
+// them where it does
+type UserScreenSaver struct {
+	User           string `json:"user"`
+	Enabled        bool   `json:"enabled"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	// Secure is set when the screen saver asks for a sign-in to leave
+	Secure        bool `json:"secure"`
+	PolicyManaged bool `json:"policy_managed"`
+	// LockAfterSeconds is how long the user's session can be idle before
+	// it locks, through the secure screen saver or the inactivity limit,
+	// whichever comes first; 0 when it never locks by itself
+	LockAfterSeconds int `json:"lock_after_seconds"`
+}
+
+type ScreenLockCollector struct {
+	*BaseCollector
+}
+
+func NewScreenLockCollector() *ScreenLockCollector {
+	return &ScreenLockCollector{
+		BaseCollector: NewBaseCollector("compliance.screenlock", false), // Disabled by default
+	}
+}
+
+// The power setting for requiring a sign-in on wake, which has no subgroup
+var (
+	guidNoSubgroup  = mustGUID("{FEA3413E-7E05-4911-9A71-700331F1C294}")
+	guidConsoleLock = mustGUID("{0E796BDB-100D-47D6-A2D5-F7D2DAA51F51}")
+)
+
+func (c *ScreenLockCollector) Collect(ctx context.Context) (interface{}, error) {
+	result := &ScreenLockCompliance{Users: []UserScreenSaver{}}
+
+	if key, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SOFTWARE\Microsoft\Windows\CurrentVersion\Policies\System`, registry.QUERY_VALUE); err == nil {
+		if value, _, err := key.GetIntegerValue("InactivityTimeoutSecs"); err == nil {
+			result.InactivityTimeoutSeconds = int(value)
+		}
+		key.Close()
+	}
+
+	if scheme, err := activePowerScheme(); err == nil {
+		ac, acPolicy := readPowerValue(procPowerReadACValueIndex, "ACSettingIndex", scheme, &guidNoSubgroup, &guidConsoleLock)
+		dc, dcPolicy := readPowerValue(procPowerReadDCValueIndex, "DCSettingIndex", scheme, &guidNoSubgroup, &guidConsoleLock)
+		result.LockOnResumeAC = ac != 0
+		result.LockOnResumeBattery = dc != 0
+		result.LockOnResumePolicyManaged = acPolicy || dcPolicy
+	}
+
+	// Only the hives of users with a session, or whose profile is otherwise
+	// loaded, can be read
+	users, err := registry.OpenKey(registry.USERS, "", registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	sids, err := users.ReadSubKeyNames(-1)
+	users.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sid := range sids {
+		if !strings.HasPrefix(sid, "S-1-5-21-") || strings.HasSuffix(sid, "_Classes") {
+			continue
+		}
+		saver := userScreenSaver(sid)
+		saver.LockAfterSeconds = lockAfter(saver, result.InactivityTimeoutSeconds)
+		result.Users = append(result.Users, saver)
+	}
+
+	return result, nil
+}
+
+// userScreenSaver reads a user's screen saver settings, each from the
+// user's policy when it has it and otherwise from the user's own choice
+func userScreenSaver(sid string) UserScreenSaver {
+	saver := UserScreenSaver{User: accountName(sid)}
+
+	var keys []registry.Key
+	if key, err := registry.OpenKey(registry.USERS,
+		sid+`\Software\Policies\Microsoft\Windows\Control Panel\Desktop`, registry.QUERY_VALUE); err == nil {
+		defer key.Close()
+		keys = append(keys, key)
+	}
+	policyKeys := len(keys)
+	if key, err := registry.OpenKey(registry.USERS, sid+`\Control Panel\Desktop`, registry.QUERY_VALUE); err == nil {
+		defer key.Close()
+		keys = append(keys, key)
+	}
+
+	read := func(name string) string {
+		for i, key := range keys {
+			if value, _, err := key.GetStringValue(name); err == nil {
+				if i < policyKeys {
+					saver.PolicyManaged = true
+				}
+				return strings.TrimSpace(value)
+			}
+		}
+		return ""
+	}
+	saver.Enabled = read("ScreenSaveActive") == "1"
+	saver.TimeoutSeconds, _ = strconv.Atoi(read("ScreenSaveTimeOut"))
+	saver.Secure = read("ScreenSaverIsSecure") == "1"
+
+	return saver
+}
+
+func lockAfter(saver UserScreenSaver, inactivityTimeout int) int {
+	lock := inactivityTimeout
+	if saver.Enabled && saver.Secure && saver.TimeoutSeconds > 0 && (lock == 0 || saver.TimeoutSeconds < lock) {
+		lock = saver.TimeoutSeconds
+	}
+	return lock
+}
+
+// accountName returns DOMAIN\user for a SID, or the SID when the account
+// can't be looked up
+func accountName(sid string) string {
+	s, err := windows.StringToSid(sid)
+	if err != nil {
+		return sid
+	}
+	account, domain, _, err := s.LookupAccount("")
+	if err != nil {
+		return sid
+	}
+	return domain + `\` + account
+}
@@ -0,0 +1,91 @@
+package collectors
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// SessionResources is what one user session uses of a shared host, such as
+// a Remote Desktop Session Host or a multi-user VDI machine
+type SessionResources struct {
+	SessionID  string `json:"session_id"`
+	User       string `json:"user"`
+	State      string `json:"state"`             // e.g. active or disconnected
+	Station    string `json:"station,omitempty"` // e.g. Console or RDP-Tcp#12, or the TTY
+	ClientName string `json:"client_name,omitempty"`
+	Processes  int    `json:"processes"`
+	// CPUPercent is the share of the whole host's CPU the session's
+	// processes used over the sample, so sessions add up to the host's
+	// utilization
+	CPUPercent float64 `json:"cpu_percent"`
+	// MemoryBytes is the resident memory (working set) of its processes
+	MemoryBytes int64 `json:"memory_bytes"`
+}
+
+// sessionUsage is the CPU time used so far, and current memory, of a
+// session's processes
+type sessionUsage struct {
+	processes int
+	cpu       time.Duration
+	memory    int64
+}
+
+// sessionSampleInterval is how long CPU time is measured over
+const sessionSampleInterval = time.Second
+
+type SessionsCollector struct {
+	*BaseCollector
+}
+
+func NewSessionsCollector() *SessionsCollector {
+	return &SessionsCollector{
+		BaseCollector: NewBaseCollector("sessions.resources", false), // Disabled by default
+	}
+}
+
+// Collect reports each signed-in user's session, busiest first. CPU is
+// measured from two samples of the sessions' processes a second apart;
+// processes started in between count from when they started.
+func (c *SessionsCollector) Collect(ctx context.Context) (interface{}, error) {
+	sessions, err := userSessions()
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return sessions, nil
+	}
+
+	first, err := sessionUsages()
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	select {
+	case <-time.After(sessionSampleInterval):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	second, err := sessionUsages()
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(started)
+	cpus := logicalCPUs()
+
+	for i := range sessions {
+		usage := second[sessions[i].SessionID]
+		sessions[i].Processes = usage.processes
+		sessions[i].MemoryBytes = usage.memory
+		if used := usage.cpu - first[sessions[i].SessionID].cpu; used > 0 && cpus > 0 {
+			percent := float64(used) / float64(elapsed) / float64(cpus) * 100
+			sessions[i].CPUPercent = math.Round(math.Min(percent, 100)*10) / 10
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].CPUPercent > sessions[j].CPUPercent
+	})
+	return sessions, nil
+}
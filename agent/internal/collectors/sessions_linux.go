@@ -0,0 +1,118 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc, which Linux fixes
+// at 100 for user space
+const clockTicks = 100
+
+// userSessions lists the host's systemd-logind sessions, such as SSH and
+// desktop sign-ins, from its runtime directory
+func userSessions() ([]SessionResources, error) {
+	dir := hostRoot("run", "systemd", "sessions")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SessionResources{}, nil // no logind
+		}
+		return nil, err
+	}
+
+	sessions := []SessionResources{}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".") {
+			continue // a .ref pipe
+		}
+		values, err := readKeyValues(filepath.Join(dir, entry.Name()))
+		if err != nil || values["USER"] == "" {
+			continue
+		}
+		sessions = append(sessions, SessionResources{
+			SessionID:  entry.Name(),
+			User:       values["USER"],
+			State:      values["STATE"],
+			Station:    values["TTY"],
+			ClientName: values["REMOTE_HOST"],
+		})
+	}
+	return sessions, nil
+}
+
+// sessionUsages totals the processes of every session, which logind keeps
+// in the session's session-<id>.scope cgroup
+func sessionUsages() (map[string]sessionUsage, error) {
+	procs, err := os.ReadDir(hostProc())
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int64(os.Getpagesize())
+	usages := make(map[string]sessionUsage)
+	for _, p := range procs {
+		if _, err := strconv.Atoi(p.Name()); err != nil {
+			continue
+		}
+		id := processSession(p.Name())
+		if id == "" {
+			continue
+		}
+
+		u := usages[id]
+		u.processes++
+		// Fields after the command, which may hold spaces, from state on;
+		// utime and stime are the 12th and 13th
+		stat := readTrimmed(hostProc(p.Name(), "stat"))
+		if i := strings.LastIndexByte(stat, ')'); i >= 0 {
+			if fields := strings.Fields(stat[i+1:]); len(fields) > 12 {
+				utime, _ := strconv.ParseInt(fields[11], 10, 64)
+				stime, _ := strconv.ParseInt(fields[12], 10, 64)
+				u.cpu += time.Duration(utime+stime) * time.Second / clockTicks
+			}
+		}
+		if statm := strings.Fields(readTrimmed(hostProc(p.Name(), "statm"))); len(statm) > 1 {
+			resident, _ := strconv.ParseInt(statm[1], 10, 64)
+			u.memory += resident * pageSize
+		}
+		usages[id] = u
+	}
+	return usages, nil
+}
+
+// processSession returns the logind session a process belongs to, from
+// its cgroup
+func processSession(pid string) string {
+	data, err := os.ReadFile(hostProc(pid, "cgroup"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, part := range strings.Split(line, "/") {
+			if id, ok := strings.CutPrefix(part, "session-"); ok && strings.HasSuffix(id, ".scope") {
+				return strings.TrimSuffix(id, ".scope")
+			}
+		}
+	}
+	return ""
+}
+
+// logicalCPUs counts the host's processors from /proc/stat, which a
+// container's CPU limit doesn't change
+func logicalCPUs() int {
+	data, err := os.ReadFile(hostProc("stat"))
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "cpu") && len(line) > 3 && line[3] >= '0' && line[3] <= '9' {
+			n++
+		}
+	}
+	return n
+}
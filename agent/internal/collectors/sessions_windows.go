@@ -0,0 +1,128 @@
+package collectors
+
+import (
+	"strconv"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	wtsapi32                       = windows.NewLazySystemDLL("wtsapi32.dll")
+	procWTSQuerySessionInformation = wtsapi32.NewProc("WTSQuerySessionInformationW")
+	procWTSEnumerateProcessesEx    = wtsapi32.NewProc("WTSEnumerateProcessesExW")
+	procWTSFreeMemoryEx            = wtsapi32.NewProc("WTSFreeMemoryExW")
+)
+
+// WTS_INFO_CLASS values
+const (
+	wtsUserName   = 5
+	wtsDomainName = 7
+	wtsClientName = 10
+)
+
+const (
+	wtsAnySession            = 0xFFFFFFFE
+	wtsTypeProcessInfoLevel1 = 1
+)
+
+// WTS_PROCESS_INFO_EXW
+type wtsProcessInfoEx struct {
+	SessionID          uint32
+	ProcessID          uint32
+	ProcessName        *uint16
+	UserSid            *windows.SID
+	NumberOfThreads    uint32
+	HandleCount        uint32
+	PagefileUsage      uint32
+	PeakPagefileUsage  uint32
+	WorkingSetSize     uint32
+	PeakWorkingSetSize uint32
+	UserTime           int64 // 100ns units
+	KernelTime         int64
+}
+
+var sessionStates = map[uint32]string{
+	windows.WTSActive:       "active",
+	windows.WTSConnected:    "connected",
+	windows.WTSDisconnected: "disconnected",
+	windows.WTSIdle:         "idle",
+}
+
+// userSessions lists the Remote Desktop Services sessions a user is signed
+// in to, which includes the console; session 0, where services run, has
+// none
+func userSessions() ([]SessionResources, error) {
+	var infos *windows.WTS_SESSION_INFO
+	var count uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &infos, &count); err != nil {
+		return nil, err
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(infos)))
+
+	sessions := []SessionResources{}
+	for _, info := range unsafe.Slice(infos, count) {
+		user := sessionString(info.SessionID, wtsUserName)
+		if user == "" {
+			continue
+		}
+		if domain := sessionString(info.SessionID, wtsDomainName); domain != "" {
+			user = domain + `\` + user
+		}
+		state := sessionStates[info.State]
+		if state == "" {
+			state = "other"
+		}
+		sessions = append(sessions, SessionResources{
+			SessionID:  strconv.Itoa(int(info.SessionID)),
+			User:       user,
+			State:      state,
+			Station:    windows.UTF16PtrToString(info.WindowStationName),
+			ClientName: sessionString(info.SessionID, wtsClientName),
+		})
+	}
+	return sessions, nil
+}
+
+func sessionString(session uint32, class uintptr) string {
+	var buf *uint16
+	var size uint32
+	r, _, _ := procWTSQuerySessionInformation.Call(0, uintptr(session), class,
+		uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&size)))
+	if r == 0 || buf == nil {
+		return ""
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buf)))
+	return windows.UTF16PtrToString(buf)
+}
+
+// sessionUsages totals the processes of every session
+func sessionUsages() (map[string]sessionUsage, error) {
+	level := uint32(1)
+	var infos *wtsProcessInfoEx
+	var count uint32
+	r, _, err := procWTSEnumerateProcessesEx.Call(0, uintptr(unsafe.Pointer(&level)), wtsAnySession,
+		uintptr(unsafe.Pointer(&infos)), uintptr(unsafe.Pointer(&count)))
+	if r == 0 {
+		return nil, err
+	}
+	defer procWTSFreeMemoryEx.Call(wtsTypeProcessInfoLevel1, uintptr(unsafe.Pointer(infos)), uintptr(count))
+
+	usages := make(map[string]sessionUsage)
+	for _, p := range unsafe.Slice(infos, count) {
+		id := strconv.Itoa(int(p.SessionID))
+		u := usages[id]
+		u.processes++
+		u.cpu += time.Duration(p.UserTime+p.KernelTime) * 100
+		u.memory += int64(p.WorkingSetSize)
+		usages[id] = u
+	}
+	return usages, nil
+}
+
+// logicalCPUs counts the processors in every processor group; the Go
+// runtime sees only its own group's, at most 64
+func logicalCPUs() int {
+	return int(windows.GetActiveProcessorCount(windows.ALL_PROCESSOR_GROUPS))
+}
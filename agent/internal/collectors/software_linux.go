@@ -0,0 +1,100 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Collect lists the packages installed on the host from the dpkg or apk
+// database. RPM's database isn't plain text and isn't read.
+func (c *SoftwareCollector) Collect(ctx context.Context) (interface{}, error) {
+	if software, err := readDpkgStatus(hostRoot("var", "lib", "dpkg", "status")); !os.IsNotExist(err) {
+		return software, err
+	}
+	if software, err := readApkInstalled(hostRoot("lib", "apk", "db", "installed")); !os.IsNotExist(err) {
+		return software, err
+	}
+	return nil, fmt.Errorf("no supported package database found")
+}
+
+// readDpkgStatus reads the installed packages of a dpkg status file, dated
+// by when their file list was written
+func readDpkgStatus(path string) ([]SoftwareItem, error) {
+	software := []SoftwareItem{}
+	err := readStanzas(path, ": ", func(fields map[string]string) {
+		if !strings.HasSuffix(fields["Status"], " installed") {
+			return
+		}
+		item := SoftwareItem{
+			Name:      fields["Package"],
+			Version:   fields["Version"],
+			Publisher: fields["Maintainer"],
+		}
+		for _, list := range []string{item.Name + ".list", item.Name + ":" + fields["Architecture"] + ".list"} {
+			if fi, err := os.Stat(hostRoot("var", "lib", "dpkg", "info", list)); err == nil {
+				item.InstallDate = fi.ModTime().UTC().Format("2006-01-02")
+				break
+			}
+		}
+		software = append(software, item)
+	})
+	return software, err
+}
+
+// readApkInstalled reads the packages of an apk installed database, whose
+// entries have one-letter keys: P name, V version and m maintainer. It
+// doesn't record when a package was installed.
+func readApkInstalled(path string) ([]SoftwareItem, error) {
+	software := []SoftwareItem{}
+	err := readStanzas(path, ":", func(fields map[string]string) {
+		if fields["P"] == "" {
+			return
+		}
+		software = append(software, SoftwareItem{
+			Name:      fields["P"],
+			Version:   fields["V"],
+			Publisher: fields["m"],
+		})
+	})
+	return software, err
+}
+
+// readStanzas calls fn with the fields of each blank-line separated stanza
+// of key, separator, value lines. Continuation lines, which start with a
+// space, are skipped.
+func readStanzas(path, sep string, fn func(map[string]string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fields := make(map[string]string)
+	flush := func() {
+		if len(fields) > 0 {
+			fn(fields)
+			fields = make(map[string]string)
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, sep); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	flush()
+	return scanner.Err()
+}
@@ -8,23 +8,6 @@ import (
 	"golang.org/x/sys/windows/registry"
 )
 
-type SoftwareItem struct {
-	Name      string `json:"name"`
-	Version   string `json:"version"`
-	Publisher string `json:"publisher"`
-	InstallDate string `json:"install_date"`
-}
-
-type SoftwareCollector struct {
-	*BaseCollector
-}
-
-func NewSoftwareCollector() *SoftwareCollector {
-	return &SoftwareCollector{
-		BaseCollector: NewBaseCollector("software.inventory", false), // Disabled by default
-	}
-}
-
 func (c *SoftwareCollector) Collect(ctx context.Context) (interface{}, error) {
 	var software []SoftwareItem
 
@@ -0,0 +1,89 @@
+package collectors
+
+import "strings"
+
+// NetworkWireless is the device's Wi-Fi connections and VPN adapters
+type NetworkWireless struct {
+	WiFi []WiFiInterface `json:"wifi"`
+	VPN  []VPNAdapter    `json:"vpn"`
+}
+
+// WiFiInterface is a wireless adapter and the network it is connected to,
+// if any
+type WiFiInterface struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	SSID      string `json:"ssid,omitempty"`
+	BSSID     string `json:"bssid,omitempty"` // the access point's MAC address
+	// SignalPercent is the signal quality, 0 to 100
+	SignalPercent int    `json:"signal_percent,omitempty"`
+	RSSIDBm       int    `json:"rssi_dbm,omitempty"`
+	Band          string `json:"band,omitempty"` // 2.4GHz, 5GHz or 6GHz
+	Channel       int    `json:"channel,omitempty"`
+	PHY           string `json:"phy,omitempty"` // e.g. 802.11ax
+	RxRateMbps    int    `json:"rx_rate_mbps,omitempty"`
+	TxRateMbps    int    `json:"tx_rate_mbps,omitempty"`
+}
+
+// VPNAdapter is a VPN client's virtual adapter
+type VPNAdapter struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+}
+
+type WirelessCollector struct {
+	*BaseCollector
+}
+
+func NewWirelessCollector() *WirelessCollector {
+	return &WirelessCollector{
+		BaseCollector: NewBaseCollector("network.wireless", false), // Disabled by default
+	}
+}
+
+// vpnAdapterNames are parts of the names VPN clients give their adapters
+var vpnAdapterNames = []string{
+	"vpn", "anyconnect", "globalprotect", "pangp", "fortinet", "fortissl",
+	"juniper", "pulse secure", "zscaler", "wireguard", "wintun", "tap-windows",
+	"openvpn", "nordlynx", "tailscale", "zerotier", "checkpoint", "sonicwall",
+}
+
+func isVPNAdapter(name string) bool {
+	name = strings.ToLower(name)
+	for _, n := range vpnAdapterNames {
+		if strings.Contains(name, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// wifiBand names the band of a channel's centre frequency in MHz
+func wifiBand(mhz int) string {
+	switch {
+	case mhz >= 2400 && mhz < 2500:
+		return "2.4GHz"
+	case mhz >= 5150 && mhz < 5925:
+		return "5GHz"
+	case mhz >= 5925 && mhz < 7125:
+		return "6GHz"
+	}
+	return ""
+}
+
+// wifiChannel returns the channel number of a centre frequency in MHz
+func wifiChannel(mhz int) int {
+	switch {
+	case mhz == 2484:
+		return 14
+	case mhz >= 2412 && mhz < 2484:
+		return (mhz - 2407) / 5
+	case mhz == 5935:
+		return 2
+	case mhz >= 5950 && mhz < 7125:
+		return (mhz - 5950) / 5
+	case mhz >= 5150 && mhz < 5925:
+		return (mhz - 5000) / 5
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Collect reports the host's wireless interfaces and VPN tunnels from sysfs.
+// The SSID, band and rates take netlink to read, so only the signal is
+// reported, from the host's /proc/net/wireless.
+func (c *WirelessCollector) Collect(ctx context.Context) (interface{}, error) {
+	entries, err := os.ReadDir(hostSys("class", "net"))
+	if err != nil {
+		return nil, err
+	}
+
+	signals := wirelessSignals()
+	result := &NetworkWireless{WiFi: []WiFiInterface{}, VPN: []VPNAdapter{}}
+	for _, entry := range entries {
+		name := entry.Name()
+		up := interfaceUp(name)
+
+		if _, err := os.Stat(hostSys("class", "net", name, "wireless")); err == nil {
+			iface := WiFiInterface{Name: name, Connected: up && readTrimmed(hostSys("class", "net", name, "carrier")) == "1"}
+			if s, ok := signals[name]; ok && iface.Connected {
+				iface.SignalPercent = s.percent
+				iface.RSSIDBm = s.dBm
+			}
+			result.WiFi = append(result.WiFi, iface)
+			continue
+		}
+
+		if isTunnel(name) {
+			result.VPN = append(result.VPN, VPNAdapter{Name: name, Connected: up})
+		}
+	}
+
+	return result, nil
+}
+
+// interfaceUp reports whether an interface is administratively up
+// (IFF_UP); tunnels report an operstate of unknown whatever their state
+func interfaceUp(name string) bool {
+	flags, err := strconv.ParseUint(strings.TrimPrefix(readTrimmed(hostSys("class", "net", name, "flags")), "0x"), 16, 32)
+	return err == nil && flags&0x1 != 0
+}
+
+// isTunnel reports whether an interface is a TUN/TAP device, a WireGuard
+// tunnel or one named like a VPN client's
+func isTunnel(name string) bool {
+	if _, err := os.Stat(hostSys("class", "net", name, "tun_flags")); err == nil {
+		return true
+	}
+	if strings.Contains(readTrimmed(hostSys("class", "net", name, "uevent")), "DEVTYPE=wireguard") {
+		return true
+	}
+	return isVPNAdapter(name)
+}
+
+type wirelessSignal struct {
+	percent int
+	dBm     int
+}
+
+// wirelessSignals reads the link quality, out of 70, and signal level of
+// each wireless interface in the host's network namespace
+func wirelessSignals() map[string]wirelessSignal {
+	signals := make(map[string]wirelessSignal)
+	f, err := os.Open(hostProc("1", "net", "wireless"))
+	if err != nil {
+		if f, err = os.Open(hostProc("net", "wireless")); err != nil {
+			return signals
+		}
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		fields := strings.Fields(rest)
+		if !ok || len(fields) < 3 {
+			continue
+		}
+		link, err1 := strconv.ParseFloat(strings.TrimSuffix(fields[1], "."), 64)
+		level, err2 := strconv.ParseFloat(strings.TrimSuffix(fields[2], "."), 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		signals[strings.TrimSpace(name)] = wirelessSignal{percent: min(int(link*100/70), 100), dBm: int(level)}
+	}
+	return signals
+}
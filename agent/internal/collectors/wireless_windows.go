@@ -0,0 +1,222 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/StackExchange/wmi"
+	"golang.org/x/sys/windows"
+)
+
+// Native Wifi API; wlanapi.dll is missing on servers without the Wireless
+// LAN Service feature
+var (
+	wlanapi                   = windows.NewLazySystemDLL("wlanapi.dll")
+	procWlanOpenHandle        = wlanapi.NewProc("WlanOpenHandle")
+	procWlanCloseHandle       = wlanapi.NewProc("WlanCloseHandle")
+	procWlanEnumInterfaces    = wlanapi.NewProc("WlanEnumInterfaces")
+	procWlanQueryInterface    = wlanapi.NewProc("WlanQueryInterface")
+	procWlanGetNetworkBssList = wlanapi.NewProc("WlanGetNetworkBssList")
+	procWlanFreeMemory        = wlanapi.NewProc("WlanFreeMemory")
+)
+
+const (
+	wlanInterfaceStateConnected     = 1
+	wlanIntfOpcodeCurrentConnection = 7
+)
+
+// WLAN_INTERFACE_INFO_LIST
+type wlanInterfaceInfoList struct {
+	NumberOfItems uint32
+	Index         uint32
+	InterfaceInfo [1]wlanInterfaceInfo
+}
+
+// WLAN_INTERFACE_INFO
+type wlanInterfaceInfo struct {
+	InterfaceGUID windows.GUID
+	Description   [256]uint16
+	State         uint32
+}
+
+// WLAN_CONNECTION_ATTRIBUTES, without the security attributes that follow
+type wlanConnectionAttributes struct {
+	State         uint32
+	Mode          uint32
+	ProfileName   [256]uint16
+	SSIDLength    uint32
+	SSID          [32]byte
+	BSSType       uint32
+	BSSID         [6]byte
+	PHYType       uint32
+	PHYIndex      uint32
+	SignalQuality uint32
+	RxRate        uint32 // kbps
+	TxRate        uint32
+}
+
+// WLAN_BSS_LIST
+type wlanBSSList struct {
+	TotalSize     uint32
+	NumberOfItems uint32
+	Entries       [1]wlanBSSEntry
+}
+
+// WLAN_BSS_ENTRY
+type wlanBSSEntry struct {
+	SSIDLength            uint32
+	SSID                  [32]byte
+	PHYID                 uint32
+	BSSID                 [6]byte
+	BSSType               uint32
+	PHYType               uint32
+	RSSI                  int32
+	LinkQuality           uint32
+	InRegDomain           uint8
+	BeaconPeriod          uint16
+	Timestamp             uint64
+	HostTimestamp         uint64
+	CapabilityInformation uint16
+	ChCenterFrequency     uint32 // kHz
+	RateSetLength         uint32
+	RateSet               [126]uint16
+	IEOffset              uint32
+	IESize                uint32
+}
+
+// DOT11_PHY_TYPE values from 802.11a on
+var phyTypes = map[uint32]string{
+	4:  "802.11a",
+	5:  "802.11b",
+	6:  "802.11g",
+	7:  "802.11n",
+	8:  "802.11ac",
+	9:  "802.11ad",
+	10: "802.11ax",
+	11: "802.11be",
+}
+
+type Win32_NetworkAdapter struct {
+	Name                string
+	NetConnectionStatus *uint16
+}
+
+func (c *WirelessCollector) Collect(ctx context.Context) (interface{}, error) {
+	wifi, err := wifiInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	vpn, err := vpnAdapters()
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetworkWireless{WiFi: wifi, VPN: vpn}, nil
+}
+
+func wifiInterfaces() ([]WiFiInterface, error) {
+	wifi := []WiFiInterface{}
+	if wlanapi.Load() != nil {
+		return wifi, nil
+	}
+
+	var version uint32
+	var handle windows.Handle
+	if r, _, _ := procWlanOpenHandle.Call(2, 0, uintptr(unsafe.Pointer(&version)), uintptr(unsafe.Pointer(&handle))); r != 0 {
+		// The WLAN AutoConfig service isn't running, so there's no Wi-Fi
+		if windows.Errno(r) == windows.ERROR_SERVICE_NOT_ACTIVE {
+			return wifi, nil
+		}
+		return nil, fmt.Errorf("WlanOpenHandle: %w", windows.Errno(r))
+	}
+	defer procWlanCloseHandle.Call(uintptr(handle), 0)
+
+	var list *wlanInterfaceInfoList
+	if r, _, _ := procWlanEnumInterfaces.Call(uintptr(handle), 0, uintptr(unsafe.Pointer(&list))); r != 0 {
+		return nil, fmt.Errorf("WlanEnumInterfaces: %w", windows.Errno(r))
+	}
+	defer procWlanFreeMemory.Call(uintptr(unsafe.Pointer(list)))
+
+	for _, info := range unsafe.Slice(&list.InterfaceInfo[0], list.NumberOfItems) {
+		iface := WiFiInterface{
+			Name:      windows.UTF16ToString(info.Description[:]),
+			Connected: info.State == wlanInterfaceStateConnected,
+		}
+		if iface.Connected {
+			currentConnection(handle, &info.InterfaceGUID, &iface)
+		}
+		wifi = append(wifi, iface)
+	}
+
+	return wifi, nil
+}
+
+// currentConnection fills in the network an interface is connected to. The
+// band and RSSI come from the access point's entry in the interface's scan
+// results, which may not have it.
+func currentConnection(handle windows.Handle, guid *windows.GUID, iface *WiFiInterface) {
+	var size, valueType uint32
+	var conn *wlanConnectionAttributes
+	r, _, _ := procWlanQueryInterface.Call(uintptr(handle), uintptr(unsafe.Pointer(guid)), wlanIntfOpcodeCurrentConnection, 0,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&conn)), uintptr(unsafe.Pointer(&valueType)))
+	if r != 0 {
+		return
+	}
+	defer procWlanFreeMemory.Call(uintptr(unsafe.Pointer(conn)))
+
+	iface.SSID = string(conn.SSID[:min(conn.SSIDLength, 32)])
+	iface.BSSID = formatMAC(conn.BSSID)
+	iface.SignalPercent = int(conn.SignalQuality)
+	iface.PHY = phyTypes[conn.PHYType]
+	iface.RxRateMbps = int(conn.RxRate / 1000)
+	iface.TxRateMbps = int(conn.TxRate / 1000)
+
+	var list *wlanBSSList
+	r, _, _ = procWlanGetNetworkBssList.Call(uintptr(handle), uintptr(unsafe.Pointer(guid)), 0, 0, 0, 0, uintptr(unsafe.Pointer(&list)))
+	if r != 0 {
+		return
+	}
+	defer procWlanFreeMemory.Call(uintptr(unsafe.Pointer(list)))
+
+	for _, bss := range unsafe.Slice(&list.Entries[0], list.NumberOfItems) {
+		if bss.BSSID != conn.BSSID {
+			continue
+		}
+		mhz := int(bss.ChCenterFrequency / 1000)
+		iface.Band = wifiBand(mhz)
+		iface.Channel = wifiChannel(mhz)
+		iface.RSSIDBm = int(bss.RSSI)
+		break
+	}
+}
+
+func formatMAC(mac [6]byte) string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
+}
+
+func vpnAdapters() ([]VPNAdapter, error) {
+	var adapters []Win32_NetworkAdapter
+	err := wmi.Query("SELECT Name, NetConnectionStatus FROM Win32_NetworkAdapter", &adapters)
+	if err != nil {
+		return nil, err
+	}
+
+	vpn := []VPNAdapter{}
+	for _, adapter := range adapters {
+		// WAN Miniport adapters are Windows' own, present whether or not a
+		// VPN is configured
+		if !isVPNAdapter(adapter.Name) || strings.HasPrefix(adapter.Name, "WAN Miniport") {
+			continue
+		}
+		vpn = append(vpn, VPNAdapter{
+			Name: adapter.Name,
+			// NetConnectionStatus 2 is connected
+			Connected: adapter.NetConnectionStatus != nil && *adapter.NetConnectionStatus == 2,
+		})
+	}
+
+	return vpn, nil
+}
@@ -0,0 +1,145 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+const (
+	// maxInlineResult is the largest result acked inline; larger ones are
+	// uploaded as an artifact the ack refers to
+	maxInlineResult = 256 << 10
+
+	// artifactTimeout bounds uploading one artifact, chunks and retries
+	// included
+	artifactTimeout = 30 * time.Minute
+)
+
+// artifact is an upload the API has accepted the declaration of
+type artifact struct {
+	ArtifactID uuid.UUID `json:"artifact_id"`
+	Name       string    `json:"name"`
+	SizeBytes  int64     `json:"size_bytes"`
+	SHA256     string    `json:"sha256"`
+	ChunkSize  int       `json:"chunk_size_bytes"`
+}
+
+// resultForAck returns the result to ack a command with. A result too large
+// to ack inline is uploaded as a result.json artifact and replaced by a
+// reference to it, keeping its status and error. If the upload fails the
+// full result is acked after all.
+func (cp *CommandPoller) resultForAck(commandID uuid.UUID, result map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(result)
+	if err != nil || len(data) <= maxInlineResult {
+		return result
+	}
+
+	ref, err := cp.uploadArtifact(commandID, "result.json", "application/json", data)
+	if err != nil {
+		log.Printf("Failed to upload %d byte result of command %s, acking it inline: %v", len(data), commandID, err)
+		return result
+	}
+
+	stub := map[string]interface{}{"result_artifact": ref}
+	for _, key := range []string{"status", "error"} {
+		if v, ok := result[key]; ok {
+			stub[key] = v
+		}
+	}
+	return stub
+}
+
+// uploadArtifact uploads data as an artifact of a command in the chunks the
+// API asks for, retrying each as uploads are, and returns the reference to
+// ack it with
+func (cp *CommandPoller) uploadArtifact(commandID uuid.UUID, name, contentType string, data []byte) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), artifactTimeout)
+	defer cancel()
+
+	sum := sha256.Sum256(data)
+	a := artifact{Name: name, SizeBytes: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+	base := fmt.Sprintf("%s/v1/agents/%s/commands/%s/artifacts", cp.config.APIEndpoint, cp.config.DeviceID, commandID)
+	backoff := retry.NewBackoff(cp.config.RetryConfig, time.Second)
+	attempts := cp.config.RetryConfig.MaxRetries + 1
+
+	declaration, _ := json.Marshal(map[string]interface{}{
+		"name": name, "content_type": contentType, "size_bytes": a.SizeBytes, "sha256": a.SHA256,
+	})
+	err := retry.Do(ctx, backoff, attempts, func(ctx context.Context) error {
+		return cp.artifactRequest(ctx, "POST", base, "application/json", declaration, http.StatusCreated, &a)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare artifact: %w", err)
+	}
+	if a.ChunkSize <= 0 {
+		return nil, fmt.Errorf("API returned chunk size %d", a.ChunkSize)
+	}
+
+	for index := 0; index*a.ChunkSize < len(data); index++ {
+		chunk := data[index*a.ChunkSize : min(len(data), (index+1)*a.ChunkSize)]
+		endpoint := fmt.Sprintf("%s/%s/chunks/%d", base, a.ArtifactID, index)
+		err := retry.Do(ctx, backoff, attempts, func(ctx context.Context) error {
+			return cp.artifactRequest(ctx, "PUT", endpoint, "application/octet-stream", chunk, http.StatusNoContent, nil)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload chunk %d: %w", index, err)
+		}
+	}
+
+	err = retry.Do(ctx, backoff, attempts, func(ctx context.Context) error {
+		return cp.artifactRequest(ctx, "POST", fmt.Sprintf("%s/%s/complete", base, a.ArtifactID), "", nil, http.StatusOK, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete artifact: %w", err)
+	}
+
+	return map[string]interface{}{
+		"artifact_id": a.ArtifactID,
+		"name":        a.Name,
+		"size_bytes":  a.SizeBytes,
+		"sha256":      a.SHA256,
+	}, nil
+}
+
+// artifactRequest sends one artifact request, decoding the response into
+// out when given
+func (cp *CommandPoller) artifactRequest(ctx context.Context, method, endpoint, contentType string, body []byte, want int, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set("Authorization", "Bearer "+cp.config.AuthToken)
+	req.Header.Set("User-Agent", version.UserAgent())
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := cp.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return retry.ResponseError(resp, fmt.Errorf("unexpected status code: %d", resp.StatusCode))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
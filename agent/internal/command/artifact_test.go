@@ -0,0 +1,119 @@
+package command
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/fakeapi"
+)
+
+// newTestPoller returns a poller talking to a fresh fake API, retrying
+// without waiting long
+func newTestPoller(t *testing.T) (*CommandPoller, *fakeapi.Server) {
+	t.Setenv("AGENT_CONFIG_PATH", filepath.Join(t.TempDir(), "config.json"))
+	api := fakeapi.New()
+	t.Cleanup(api.Close)
+
+	cfg := api.AgentConfig()
+	cfg.RetryConfig.MaxBackoff = 10 * time.Millisecond
+	return NewCommandPoller(cfg, nil), api
+}
+
+func TestResultForAckUploadsLargeResult(t *testing.T) {
+	cp, api := newTestPoller(t)
+	api.SetArtifactChunkSize(100 << 10)
+	// A failed chunk is sent again on its own
+	api.Script(fakeapi.ArtifactChunk, fakeapi.Status(http.StatusServiceUnavailable))
+
+	commandID := uuid.New()
+	result := map[string]interface{}{
+		"status": "completed",
+		"output": strings.Repeat("x", maxInlineResult),
+	}
+	acked := cp.resultForAck(commandID, result)
+
+	ref, ok := acked["result_artifact"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("acked result %v has no result_artifact", keysOf(acked))
+	}
+	if acked["status"] != "completed" || acked["output"] != nil {
+		t.Errorf("acked result keeps %v, want status and result_artifact", keysOf(acked))
+	}
+
+	artifacts := api.Artifacts()
+	if len(artifacts) != 1 {
+		t.Fatalf("fake has %d artifacts, want 1", len(artifacts))
+	}
+	a := artifacts[0]
+	if !a.Complete || a.CommandID != commandID || a.Name != "result.json" {
+		t.Errorf("artifact %s of command %s complete %v, want complete result.json of %s", a.Name, a.CommandID, a.Complete, commandID)
+	}
+	if ref["artifact_id"] != a.ArtifactID || ref["sha256"] != a.SHA256 {
+		t.Errorf("ack refers to artifact %v with sha256 %v, uploaded %s with %s", ref["artifact_id"], ref["sha256"], a.ArtifactID, a.SHA256)
+	}
+	want := int((a.SizeBytes + int64(a.ChunkSize) - 1) / int64(a.ChunkSize))
+	if sent := len(api.Requests(fakeapi.ArtifactChunk)); sent != want+1 {
+		t.Errorf("agent sent %d chunk requests, want %d and one retry", sent, want)
+	}
+}
+
+func TestResultForAckKeepsSmallResultInline(t *testing.T) {
+	cp, api := newTestPoller(t)
+
+	result := map[string]interface{}{"status": "completed", "output": "ok"}
+	acked := cp.resultForAck(uuid.New(), result)
+	if acked["output"] != "ok" {
+		t.Errorf("acked result %v, want it inline", acked)
+	}
+	if n := len(api.Requests("")); n != 0 {
+		t.Errorf("agent made %d requests for a small result", n)
+	}
+}
+
+func TestReleaseManifest(t *testing.T) {
+	cp, api := newTestPoller(t)
+	want := api.AddRelease(7, "9.9.9", bytes.Repeat([]byte{1}, 1024))
+
+	m, err := cp.releaseManifest(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ReleaseID != 7 || m.Version != want.Version || m.SHA256 != want.SHA256 {
+		t.Errorf("got manifest %+v, want %+v", m, want)
+	}
+	if !strings.HasPrefix(m.URL, cp.config.APIEndpoint+"/") {
+		t.Errorf("manifest URL %q isn't served by the API", m.URL)
+	}
+
+	if _, err := cp.releaseManifest(8); err == nil {
+		t.Error("fetching an unknown release's manifest succeeded")
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	cp, api := newTestPoller(t)
+
+	commandID := uuid.New()
+	cp.reportProgress(commandID, map[string]interface{}{"stage": "downloading"})
+
+	progress := api.Progress()
+	if len(progress) != 1 {
+		t.Fatalf("fake has %d progress reports, want 1", len(progress))
+	}
+	if progress[0].CommandID != commandID || progress[0].Result["stage"] != "downloading" {
+		t.Errorf("got progress %+v for command %s", progress[0], commandID)
+	}
+}
+
+func keysOf(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -4,26 +4,33 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
 	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+	"github.com/yourorg/inventory-agent/shared/models"
 )
 
-type Command struct {
-	CommandID    string                 `json:"command_id"`
-	Type         string                 `json:"type"`
-	Parameters   map[string]interface{} `json:"parameters"`
-	IssuedAt     time.Time              `json:"issued_at"`
-	TTLSeconds   int                    `json:"ttl_seconds"`
-	Status       string                 `json:"status"`
-	Result       map[string]interface{} `json:"result,omitempty"`
-	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
-}
+const (
+	// commandWait is how long the server may hold a poll open waiting for
+	// a command; it stays under the HTTP client timeout
+	commandWait = 25 * time.Second
+
+	// pollInterval paces polling when the server doesn't hold polls open,
+	// and is the least polls back off to after errors
+	pollInterval = 60 * time.Second
+)
+
+// Command is a command as the API serves it, shared with the API
+type Command = models.Command
 
 type CommandPoller struct {
 	config      *config.AgentConfig
@@ -32,6 +39,7 @@ type CommandPoller struct {
 	stopChan    chan struct{}
 	wg          sync.WaitGroup
 	semaphore   chan struct{} // Limit concurrent commands
+	started     time.Time
 }
 
 func NewCommandPoller(cfg *config.AgentConfig, sched *scheduler.Scheduler) *CommandPoller {
@@ -43,6 +51,7 @@ func NewCommandPoller(cfg *config.AgentConfig, sched *scheduler.Scheduler) *Comm
 		},
 		stopChan:  make(chan struct{}),
 		semaphore: make(chan struct{}, 2), // Max 2 concurrent commands
+		started:   time.Now(),
 	}
 }
 
@@ -59,70 +68,109 @@ func (cp *CommandPoller) Stop() {
 func (cp *CommandPoller) pollLoop(ctx context.Context) {
 	defer cp.wg.Done()
 
-	ticker := time.NewTicker(60 * time.Second)
-	defer ticker.Stop()
+	cp.resumeUpgrade()
+
+	// Cancel a held poll on stop rather than waiting it out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-cp.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := retry.NewBackoff(cp.config.RetryConfig, pollInterval)
+	failures := 0
 
 	for {
+		// Poll again straight away while the server holds polls open, so
+		// commands arrive as soon as they're issued
+		start := time.Now()
+		delay := time.Duration(0)
+		n, err := cp.Poll(ctx)
+		if err != nil {
+			log.Printf("Command poll failed: %v", err)
+			failures++
+			if delay = backoff.Next(failures, err); delay < pollInterval {
+				delay = pollInterval
+			}
+		} else {
+			failures = 0
+			if n == 0 && time.Since(start) < commandWait/2 {
+				delay = pollInterval
+			}
+		}
+
 		select {
 		case <-cp.stopChan:
 			return
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if err := cp.Poll(ctx); err != nil {
-				log.Printf("Command poll failed: %v", err)
-			}
+		case <-time.After(delay):
 		}
 	}
 }
 
-func (cp *CommandPoller) Poll(ctx context.Context) error {
+// Poll fetches pending commands, letting the server hold the request for up
+// to commandWait, and starts them. It returns how many were received.
+func (cp *CommandPoller) Poll(ctx context.Context) (int, error) {
 	if cp.config.APIEndpoint == "" || cp.config.AuthToken == "" {
-		return nil // Not configured for cloud mode
+		return 0, nil // Not configured for cloud mode
 	}
 
-	endpoint := fmt.Sprintf("%s/v1/agents/%s/commands", cp.config.APIEndpoint, cp.config.DeviceID)
+	endpoint := fmt.Sprintf("%s/v1/agents/%s/commands?wait=%s", cp.config.APIEndpoint, cp.config.DeviceID, commandWait)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+cp.config.AuthToken)
+	req.Header.Set("User-Agent", version.UserAgent())
 
 	resp, err := cp.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return 0, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return 0, retry.ResponseError(resp, fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
 
 	var commands []Command
 	if err := json.NewDecoder(resp.Body).Decode(&commands); err != nil {
-		return fmt.Errorf("failed to decode commands: %w", err)
+		return 0, fmt.Errorf("failed to decode commands: %w", err)
 	}
 
 	// Process commands concurrently with limit
 	for _, cmd := range commands {
+		// A ping checks the agent is responsive, so isn't held up or turned
+		// away by commands already running
+		if cmd.Type == "agent.ping" {
+			go cp.processCommand(cmd)
+			continue
+		}
 		select {
 		case cp.semaphore <- struct{}{}:
-			go cp.processCommand(cmd)
+			go func(cmd Command) {
+				defer func() { <-cp.semaphore }()
+				cp.processCommand(cmd)
+			}(cmd)
 		default:
 			log.Printf("Command queue full, skipping command %s", cmd.CommandID)
 		}
 	}
 
-	return nil
+	return len(commands), nil
 }
 
 func (cp *CommandPoller) processCommand(cmd Command) {
-	defer func() { <-cp.semaphore }()
-
-	// Check if expired
-	if cmd.IssuedAt.Add(time.Duration(cmd.TTLSeconds) * time.Second).Before(time.Now()) {
+	// Check if expired, counting the TTL from the command's release as the
+	// API does
+	if cmd.ExpiresAt().Before(time.Now()) {
 		log.Printf("Command %s expired", cmd.CommandID)
 		cp.ackCommand(cmd.CommandID, map[string]interface{}{"error": "expired"}, nil)
 		return
@@ -130,19 +178,49 @@ func (cp *CommandPoller) processCommand(cmd Command) {
 
 	// Execute command
 	result, err := cp.Execute(cmd)
+	if errors.Is(err, errAckDeferred) {
+		return
+	}
 	if err != nil {
 		log.Printf("Command %s execution failed: %v", cmd.CommandID, err)
-		cp.ackCommand(cmd.CommandID, map[string]interface{}{"error": err.Error()}, err)
+		// A command that got partway, such as an installer that ran and
+		// failed, acks what it has alongside the error
+		if result == nil {
+			result = map[string]interface{}{}
+		}
+		result["error"] = err.Error()
+		cp.ackCommand(cmd.CommandID, cp.resultForAck(cmd.CommandID, result), err)
 		return
 	}
 
-	cp.ackCommand(cmd.CommandID, result, nil)
+	cp.ackCommand(cmd.CommandID, cp.resultForAck(cmd.CommandID, result), nil)
 }
 
 func (cp *CommandPoller) Execute(cmd Command) (map[string]interface{}, error) {
+	// Enforced here too in case the policy changed after the command was issued
+	if !cp.config.CommandAllowed(cmd.Type) {
+		return nil, fmt.Errorf("command type %s is not allowed by policy", cmd.Type)
+	}
+
 	switch cmd.Type {
+	case "agent.ping":
+		return cp.executePing(cmd)
 	case "collect.now":
 		return cp.executeCollectNow(cmd)
+	case "inventory.resync":
+		return cp.executeResync(cmd)
+	case "file.fetch":
+		return cp.executeFileFetch(cmd)
+	case "registry.query":
+		return cp.executeRegistryQuery(cmd)
+	case "service.restart":
+		return cp.executeServiceRestart(cmd)
+	case "msi.install", "package.install":
+		return cp.executeInstall(cmd)
+	case "agent.uninstall":
+		return cp.executeUninstall(cmd)
+	case "agent.upgrade":
+		return cp.executeUpgrade(cmd)
 	default:
 		return nil, fmt.Errorf("unknown command type: %s", cmd.Type)
 	}
@@ -177,7 +255,7 @@ func (cp *CommandPoller) executeCollectNow(cmd Command) (map[string]interface{},
 	}, nil
 }
 
-func (cp *CommandPoller) ackCommand(commandID string, result map[string]interface{}, err error) {
+func (cp *CommandPoller) ackCommand(commandID uuid.UUID, result map[string]interface{}, err error) {
 	if cp.config.APIEndpoint == "" || cp.config.AuthToken == "" {
 		return
 	}
@@ -203,17 +281,22 @@ func (cp *CommandPoller) ackCommand(commandID string, result map[string]interfac
 		return
 	}
 
+	// The API records the correlation ID with the ack's audit entry
+	correlationID := uuid.NewString()
 	req.Header.Set("Authorization", "Bearer "+cp.config.AuthToken)
+	req.Header.Set("User-Agent", version.UserAgent())
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Correlation-ID", correlationID)
 
 	resp, err := cp.client.Do(req)
 	if err != nil {
-		log.Printf("Ack request failed: %v", err)
+		log.Printf("Ack request for command %s failed (correlation %s): %v", commandID, correlationID, err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Printf("Ack request returned status %d", resp.StatusCode)
+		log.Printf("Ack request for command %s returned status %d (correlation %s, request %s)",
+			commandID, resp.StatusCode, correlationID, resp.Header.Get("X-Request-ID"))
 	}
 }
\ No newline at end of file
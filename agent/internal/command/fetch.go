@@ -0,0 +1,137 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+const (
+	// defaultFetchMaxBytes caps file.fetch uploads when the configuration
+	// doesn't
+	defaultFetchMaxBytes = 100 << 20
+
+	// fetchTimeout bounds a file.fetch upload, which may be far larger than
+	// anything else the agent sends
+	fetchTimeout = 10 * time.Minute
+)
+
+// executeFileFetch uploads a file to the presigned URL in the command. Only
+// files under the configured fetch_paths may be fetched, whatever the
+// server asks for; the ack reports the file's size and SHA-256 so the
+// upload can be checked against it.
+func (cp *CommandPoller) executeFileFetch(cmd Command) (map[string]interface{}, error) {
+	path, _ := cmd.Parameters["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("invalid path parameter")
+	}
+	uploadURL, _ := cmd.Parameters["upload_url"].(string)
+	if u, err := url.Parse(uploadURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upload_url parameter")
+	}
+
+	resolved, err := fetchablePath(path, cp.config.FetchPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	limit := cp.config.FetchMaxBytes
+	if limit <= 0 {
+		limit = defaultFetchMaxBytes
+	}
+	if info.Size() > limit {
+		return nil, fmt.Errorf("%s is %d bytes, over the %d byte limit", path, info.Size(), limit)
+	}
+
+	// Logs grow while they're read, so only the size seen now is sent and
+	// hashed
+	size := info.Size()
+	hash := sha256.New()
+	body := io.TeeReader(io.LimitReader(f, size), hash)
+
+	log.Printf("Executing file.fetch for %s (%d bytes)", resolved, size)
+
+	req, err := http.NewRequest("PUT", uploadURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload request: %w", err)
+	}
+	// The presigned URL carries its own authorization; the agent's token
+	// isn't sent to the store
+	req.ContentLength = size
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("upload returned status %d", resp.StatusCode)
+	}
+
+	return map[string]interface{}{
+		"status":      "completed",
+		"path":        resolved,
+		"size_bytes":  size,
+		"sha256":      hex.EncodeToString(hash.Sum(nil)),
+		"modified_at": info.ModTime().UTC(),
+	}, nil
+}
+
+// fetchablePath resolves path, following symlinks, and returns it when it
+// is one of the allowed paths or lies under one of them. Nothing may be
+// fetched when none are allowed.
+func fetchablePath(path string, allowed []string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path must be absolute")
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	for _, a := range allowed {
+		if !filepath.IsAbs(a) {
+			continue
+		}
+		root, err := filepath.EvalSymlinks(filepath.Clean(a))
+		if err != nil {
+			continue
+		}
+		// Rel compares case-insensitively on Windows
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not under an allowed fetch path", path)
+}
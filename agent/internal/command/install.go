@@ -0,0 +1,250 @@
+package command
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/collectors"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+const (
+	// maxInstallerBytes caps installer downloads
+	maxInstallerBytes = 2 << 30
+
+	// installDownloadTimeout bounds an installer download
+	installDownloadTimeout = 30 * time.Minute
+
+	// defaultInstallTimeout is how long an installer may run when the
+	// command doesn't say; maxInstallTimeout is the longest it may ask for
+	defaultInstallTimeout = 30 * time.Minute
+	maxInstallTimeout     = 2 * time.Hour
+)
+
+// Exit codes Windows Installer, and many other installers, use for a
+// successful install that needs a reboot to finish
+const (
+	exitRebootRequired  = 3010 // ERROR_SUCCESS_REBOOT_REQUIRED
+	exitRebootInitiated = 1641 // ERROR_SUCCESS_REBOOT_INITIATED
+)
+
+// softwareUpdate is a program whose version an install changed
+type softwareUpdate struct {
+	Name            string `json:"name"`
+	PreviousVersion string `json:"previous_version"`
+	Version         string `json:"version"`
+}
+
+// executeInstall downloads the installer a msi.install or package.install
+// command names, checks it against the command's SHA-256, and runs it
+// silently: an MSI through msiexec, anything else as an executable given
+// the command's args. The ack reports the exit code and what the install
+// changed in the software inventory, whether or not it succeeded.
+func (cp *CommandPoller) executeInstall(cmd Command) (map[string]interface{}, error) {
+	if !installSupported {
+		return nil, fmt.Errorf("%s is only supported on Windows", cmd.Type)
+	}
+
+	rawURL, _ := cmd.Parameters["url"].(string)
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url parameter")
+	}
+	want, _ := cmd.Parameters["sha256"].(string)
+	if b, err := hex.DecodeString(want); err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid sha256 parameter")
+	}
+	var args []string
+	if list, ok := cmd.Parameters["args"].([]interface{}); ok {
+		for _, a := range list {
+			s, ok := a.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid args parameter")
+			}
+			args = append(args, s)
+		}
+	}
+	timeout := defaultInstallTimeout
+	if secs, ok := cmd.Parameters["timeout_seconds"].(float64); ok && secs > 0 {
+		if timeout = time.Duration(secs) * time.Second; timeout > maxInstallTimeout {
+			return nil, fmt.Errorf("timeout_seconds cannot exceed %d", int(maxInstallTimeout.Seconds()))
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "inventory-install-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	installer := filepath.Join(dir, installerName(u, cmd.Type))
+	size, err := downloadInstaller(rawURL, installer, want)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := installedSoftware()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read software inventory: %w", err)
+	}
+
+	// The query string of a presigned URL is a credential, so isn't logged
+	log.Printf("Executing %s for %s%s (%d bytes)", cmd.Type, u.Host, u.Path, size)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	runErr := installerCommand(ctx, cmd.Type, installer, args).Run()
+	duration := time.Since(start)
+
+	result := map[string]interface{}{
+		"status":           "completed",
+		"file":             filepath.Base(installer),
+		"size_bytes":       size,
+		"sha256":           strings.ToLower(want),
+		"duration_seconds": duration.Seconds(),
+	}
+
+	// The inventory is compared even after a failure, which may have left
+	// a partial install behind
+	if after, err := installedSoftware(); err == nil {
+		added, removed, updated := softwareDelta(before, after)
+		result["software_added"] = added
+		result["software_removed"] = removed
+		result["software_updated"] = updated
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result["status"] = "failed"
+		return result, fmt.Errorf("installer still running after %s and was stopped", timeout)
+	case errors.As(runErr, &exitErr):
+		code := exitErr.ExitCode()
+		result["exit_code"] = code
+		if code == exitRebootRequired || code == exitRebootInitiated {
+			result["reboot_required"] = true
+			return result, nil
+		}
+		result["status"] = "failed"
+		return result, fmt.Errorf("installer exited with code %d", code)
+	case runErr != nil:
+		return nil, fmt.Errorf("failed to run installer: %w", runErr)
+	}
+	result["exit_code"] = 0
+	return result, nil
+}
+
+// installerName names the downloaded file after the URL's, so installers
+// that look at their own name still work, keeping the extension the
+// command type needs
+func installerName(u *url.URL, commandType string) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || strings.ContainsAny(name, `\:*?"<>|`) {
+		name = "installer"
+	}
+	ext := ".exe"
+	if commandType == "msi.install" {
+		ext = ".msi"
+	}
+	if !strings.EqualFold(filepath.Ext(name), ext) {
+		name += ext
+	}
+	return name
+}
+
+// downloadInstaller saves the file at rawURL to dest and checks it against
+// the expected SHA-256, returning its size
+func downloadInstaller(rawURL, dest, want string) (int64, error) {
+	client := &http.Client{Timeout: installDownloadTimeout}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxInstallerBytes {
+		return 0, fmt.Errorf("installer is %d bytes, over the %d byte limit", resp.ContentLength, int64(maxInstallerBytes))
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create installer file: %w", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, maxInstallerBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	if size > maxInstallerBytes {
+		return 0, fmt.Errorf("installer is over the %d byte limit", int64(maxInstallerBytes))
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(got, want) {
+		return 0, fmt.Errorf("installer checksum mismatch: got sha256 %s", got)
+	}
+	return size, nil
+}
+
+// installedSoftware reads the software inventory as the software.inventory
+// collector reports it
+func installedSoftware() ([]collectors.SoftwareItem, error) {
+	items, err := collectors.NewSoftwareCollector().Collect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	software, _ := items.([]collectors.SoftwareItem)
+	return software, nil
+}
+
+// softwareDelta compares two inventories by program name
+func softwareDelta(before, after []collectors.SoftwareItem) (added, removed []collectors.SoftwareItem, updated []softwareUpdate) {
+	previous := make(map[string]collectors.SoftwareItem, len(before))
+	for _, item := range before {
+		previous[strings.ToLower(item.Name)] = item
+	}
+
+	added, removed, updated = []collectors.SoftwareItem{}, []collectors.SoftwareItem{}, []softwareUpdate{}
+	for _, item := range after {
+		key := strings.ToLower(item.Name)
+		old, ok := previous[key]
+		delete(previous, key)
+		switch {
+		case !ok:
+			added = append(added, item)
+		case old.Version != item.Version:
+			updated = append(updated, softwareUpdate{Name: item.Name, PreviousVersion: old.Version, Version: item.Version})
+		}
+	}
+	for _, item := range previous {
+		removed = append(removed, item)
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Name < removed[j].Name })
+
+	return added, removed, updated
+}
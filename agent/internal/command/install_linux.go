@@ -0,0 +1,14 @@
+package command
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Installs are Windows-only; on Linux the agent runs as a container and
+// leaves the node's packages alone
+const installSupported = false
+
+func installerCommand(ctx context.Context, commandType, installer string, args []string) *exec.Cmd {
+	return exec.CommandContext(ctx, installer, args...)
+}
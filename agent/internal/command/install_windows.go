@@ -0,0 +1,36 @@
+package command
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const installSupported = true
+
+// installerCommand runs an MSI through msiexec without UI or a reboot, or
+// an executable installer directly. args are appended to the command line
+// as given, since installers parse quoting their own way, e.g. msiexec
+// wants INSTALLDIR="C:\Program Files\App" with the quotes around the value.
+func installerCommand(ctx context.Context, commandType, installer string, args []string) *exec.Cmd {
+	var cmd *exec.Cmd
+	var line string
+	if commandType == "msi.install" {
+		msiexec := filepath.Join(os.Getenv("SystemRoot"), "System32", "msiexec.exe")
+		cmd = exec.CommandContext(ctx, msiexec)
+		line = `"` + msiexec + `" /i "` + installer + `" /qn /norestart`
+	} else {
+		cmd = exec.CommandContext(ctx, installer)
+		line = `"` + installer + `"`
+	}
+	if len(args) > 0 {
+		line += " " + strings.Join(args, " ")
+	}
+
+	cmd.Dir = filepath.Dir(installer)
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: line, HideWindow: true}
+	return cmd
+}
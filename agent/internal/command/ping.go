@@ -0,0 +1,31 @@
+package command
+
+import (
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/clock"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+// executePing answers an agent.ping without doing any work, so the ack
+// shows the agent is polling and acking. It reports how long the command
+// took to arrive from its release, on the API's clock, along with the
+// agent's version and how busy it is.
+func (cp *CommandPoller) executePing(cmd Command) (map[string]interface{}, error) {
+	received := clock.Now()
+
+	return map[string]interface{}{
+		"status":         "completed",
+		"received_at":    received,
+		"delivery_ms":    received.Sub(cmd.ReleasedAt()).Milliseconds(),
+		"clock_skew_ms":  clock.Skew().Milliseconds(),
+		"version":        version.Version,
+		"commit":         version.Commit,
+		"uptime_seconds": int64(time.Since(cp.started).Seconds()),
+		"queue": map[string]interface{}{
+			"commands_running": len(cp.semaphore),
+			"command_slots":    cap(cp.semaphore),
+			"payloads_queued":  cp.scheduler.QueuedPayloads(),
+		},
+	}, nil
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	// maxRegistryKeys caps the keys one registry.query reads
+	maxRegistryKeys = 32
+
+	// maxRegistryEntries caps the values and the subkeys listed per key,
+	// so a query of a large key doesn't outgrow the ack
+	maxRegistryEntries = 256
+)
+
+// registryHives maps the names a registry path may start with to the short
+// name of the hive. HKEY_CURRENT_USER isn't here: the agent runs as
+// LocalSystem, so users' hives are read under HKEY_USERS.
+var registryHives = map[string]string{
+	"HKLM":                "HKLM",
+	"HKEY_LOCAL_MACHINE":  "HKLM",
+	"HKU":                 "HKU",
+	"HKEY_USERS":          "HKU",
+	"HKCR":                "HKCR",
+	"HKEY_CLASSES_ROOT":   "HKCR",
+	"HKCC":                "HKCC",
+	"HKEY_CURRENT_CONFIG": "HKCC",
+}
+
+// registryPath is a registry key as a hive and the path under it
+type registryPath struct {
+	Hive string
+	Path string
+}
+
+func (p registryPath) String() string {
+	if p.Path == "" {
+		return p.Hive
+	}
+	return p.Hive + `\` + p.Path
+}
+
+// within reports whether p is root or one of its subkeys. Key names are
+// case-insensitive.
+func (p registryPath) within(root registryPath) bool {
+	if p.Hive != root.Hive {
+		return false
+	}
+	if root.Path == "" || strings.EqualFold(p.Path, root.Path) {
+		return true
+	}
+	return len(p.Path) > len(root.Path) &&
+		strings.EqualFold(p.Path[:len(root.Path)], root.Path) && p.Path[len(root.Path)] == '\\'
+}
+
+// parseRegistryPath splits a path such as HKLM\SOFTWARE\Policies into its
+// hive and key path
+func parseRegistryPath(s string) (registryPath, error) {
+	hive, path, _ := strings.Cut(strings.TrimRight(strings.TrimSpace(s), `\`), `\`)
+	short, ok := registryHives[strings.ToUpper(hive)]
+	if !ok {
+		return registryPath{}, fmt.Errorf("unknown registry hive in %q", s)
+	}
+	if path != "" {
+		for _, name := range strings.Split(path, `\`) {
+			if name == "" {
+				return registryPath{}, fmt.Errorf("invalid registry path %q", s)
+			}
+		}
+	}
+	return registryPath{Hive: short, Path: path}, nil
+}
+
+// registryValue is a registry value with its type, e.g. REG_DWORD. Data is
+// a string, a list of strings, an integer or hex-encoded bytes.
+type registryValue struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// registryKey is what registry.query read of one key. Values holds the
+// requested values, or every value when none were named; the default value
+// is named "". Subkeys are only listed when no values were named.
+type registryKey struct {
+	Key           string                   `json:"key"`
+	Exists        bool                     `json:"exists"`
+	Values        map[string]registryValue `json:"values,omitempty"`
+	MissingValues []string                 `json:"missing_values,omitempty"`
+	Subkeys       []string                 `json:"subkeys,omitempty"`
+	Truncated     bool                     `json:"truncated,omitempty"`
+}
+
+// registryQuery is one key a registry.query reads, and the values to read
+// from it; nil reads them all
+type registryQuery struct {
+	Key    registryPath
+	Values []string
+}
+
+// executeRegistryQuery reads the keys and values a command names, which
+// must all lie under the configured registry_paths, and returns them in the
+// ack. Nothing is ever written.
+func (cp *CommandPoller) executeRegistryQuery(cmd Command) (map[string]interface{}, error) {
+	queries, err := parseRegistryQueries(cmd.Parameters["keys"])
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []registryPath
+	for _, s := range cp.config.RegistryPaths {
+		if p, err := parseRegistryPath(s); err == nil {
+			allowed = append(allowed, p)
+		}
+	}
+	for _, q := range queries {
+		ok := false
+		for _, root := range allowed {
+			if q.Key.within(root) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s is not under an allowed registry path", q.Key)
+		}
+	}
+
+	log.Printf("Executing registry.query for %d keys", len(queries))
+
+	keys := make([]registryKey, 0, len(queries))
+	for _, q := range queries {
+		key, err := readRegistryKey(q.Key, q.Values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", q.Key, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return map[string]interface{}{
+		"status": "completed",
+		"keys":   keys,
+	}, nil
+}
+
+// parseRegistryQueries reads the keys parameter: a list of
+// {"key": "HKLM\\...", "values": ["Name", ...]}, where values is optional
+func parseRegistryQueries(param interface{}) ([]registryQuery, error) {
+	list, ok := param.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("invalid keys parameter")
+	}
+	if len(list) > maxRegistryKeys {
+		return nil, fmt.Errorf("at most %d keys may be queried at once", maxRegistryKeys)
+	}
+
+	queries := make([]registryQuery, 0, len(list))
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid keys parameter")
+		}
+		s, _ := entry["key"].(string)
+		key, err := parseRegistryPath(s)
+		if err != nil {
+			return nil, err
+		}
+		q := registryQuery{Key: key}
+		if values, ok := entry["values"].([]interface{}); ok {
+			if len(values) > maxRegistryEntries {
+				return nil, fmt.Errorf("at most %d values may be queried per key", maxRegistryEntries)
+			}
+			q.Values = make([]string, 0, len(values))
+			for _, v := range values {
+				name, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid values for %s", key)
+				}
+				q.Values = append(q.Values, name)
+			}
+		} else if entry["values"] != nil {
+			return nil, fmt.Errorf("invalid values for %s", key)
+		}
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
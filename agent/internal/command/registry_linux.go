@@ -0,0 +1,8 @@
+package command
+
+import "errors"
+
+// readRegistryKey fails: there is no registry outside Windows
+func readRegistryKey(path registryPath, values []string) (registryKey, error) {
+	return registryKey{}, errors.New("registry.query is only supported on Windows")
+}
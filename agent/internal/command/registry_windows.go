@@ -0,0 +1,115 @@
+package command
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+var registryRoots = map[string]registry.Key{
+	"HKLM": registry.LOCAL_MACHINE,
+	"HKU":  registry.USERS,
+	"HKCR": registry.CLASSES_ROOT,
+	"HKCC": registry.CURRENT_CONFIG,
+}
+
+var registryTypes = map[uint32]string{
+	registry.NONE:                       "REG_NONE",
+	registry.SZ:                         "REG_SZ",
+	registry.EXPAND_SZ:                  "REG_EXPAND_SZ",
+	registry.BINARY:                     "REG_BINARY",
+	registry.DWORD:                      "REG_DWORD",
+	registry.DWORD_BIG_ENDIAN:           "REG_DWORD_BIG_ENDIAN",
+	registry.LINK:                       "REG_LINK",
+	registry.MULTI_SZ:                   "REG_MULTI_SZ",
+	registry.RESOURCE_LIST:              "REG_RESOURCE_LIST",
+	registry.FULL_RESOURCE_DESCRIPTOR:   "REG_FULL_RESOURCE_DESCRIPTOR",
+	registry.RESOURCE_REQUIREMENTS_LIST: "REG_RESOURCE_REQUIREMENTS_LIST",
+	registry.QWORD:                      "REG_QWORD",
+}
+
+// readRegistryKey reads the named values of a key, or all of them and its
+// subkey names when values is nil. The key is opened for reading only; a
+// key that doesn't exist is reported as such rather than as an error.
+func readRegistryKey(path registryPath, values []string) (registryKey, error) {
+	result := registryKey{Key: path.String()}
+
+	k, err := registry.OpenKey(registryRoots[path.Hive], path.Path, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, registry.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	defer k.Close()
+	result.Exists = true
+
+	if values == nil {
+		names, err := k.ReadValueNames(maxRegistryEntries + 1)
+		if err != nil && len(names) == 0 {
+			return result, fmt.Errorf("failed to list values: %w", err)
+		}
+		if len(names) > maxRegistryEntries {
+			names, result.Truncated = names[:maxRegistryEntries], true
+		}
+		values = names
+
+		subkeys, err := k.ReadSubKeyNames(maxRegistryEntries + 1)
+		if err != nil && len(subkeys) == 0 {
+			return result, fmt.Errorf("failed to list subkeys: %w", err)
+		}
+		if len(subkeys) > maxRegistryEntries {
+			subkeys, result.Truncated = subkeys[:maxRegistryEntries], true
+		}
+		sort.Strings(subkeys)
+		result.Subkeys = subkeys
+	}
+
+	result.Values = make(map[string]registryValue, len(values))
+	for _, name := range values {
+		value, err := readRegistryValue(k, name)
+		if errors.Is(err, registry.ErrNotExist) {
+			result.MissingValues = append(result.MissingValues, name)
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read value %q: %w", name, err)
+		}
+		result.Values[name] = value
+	}
+
+	return result, nil
+}
+
+// readRegistryValue reads a value as the type it is stored as
+func readRegistryValue(k registry.Key, name string) (registryValue, error) {
+	// A nil buffer only reports the size and type
+	n, typ, err := k.GetValue(name, nil)
+	if err != nil {
+		return registryValue{}, err
+	}
+
+	value := registryValue{Type: registryTypes[typ]}
+	if value.Type == "" {
+		value.Type = fmt.Sprintf("REG_%d", typ)
+	}
+
+	switch typ {
+	case registry.SZ, registry.EXPAND_SZ:
+		// Left unexpanded, as stored
+		value.Data, _, err = k.GetStringValue(name)
+	case registry.MULTI_SZ:
+		value.Data, _, err = k.GetStringsValue(name)
+	case registry.DWORD, registry.QWORD:
+		value.Data, _, err = k.GetIntegerValue(name)
+	default:
+		buf := make([]byte, n)
+		if n, _, err = k.GetValue(name, buf); err == nil {
+			value.Data = hex.EncodeToString(buf[:n])
+		}
+	}
+	return value, err
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// executeResync sends a complete inventory from scratch, for after the
+// server's copy of the device's data was repaired or found to have drifted.
+// Payloads still queued for retry are dropped rather than sent after it,
+// and the schema version and metric schemas are fetched from the API again.
+func (cp *CommandPoller) executeResync(cmd Command) (map[string]interface{}, error) {
+	log.Printf("Executing inventory.resync")
+
+	payload, dropped, err := cp.scheduler.Resync(context.Background())
+
+	metrics := make([]string, 0, len(payload.Metrics))
+	for name := range payload.Metrics {
+		metrics = append(metrics, name)
+	}
+	sort.Strings(metrics)
+
+	result := map[string]interface{}{
+		"status":           "completed",
+		"ingestion_id":     payload.IngestionID,
+		"collected_at":     payload.CollectedAt,
+		"metrics":          metrics,
+		"payloads_dropped": dropped,
+	}
+	if len(payload.Errors) > 0 {
+		result["collector_errors"] = payload.Errors
+	}
+	if err != nil {
+		result["status"] = "failed"
+		return result, fmt.Errorf("failed to send inventory: %w", err)
+	}
+	return result, nil
+}
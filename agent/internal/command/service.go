@@ -0,0 +1,48 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// serviceWait is how long service.restart waits for a service to stop, and
+// then to start
+const serviceWait = 60 * time.Second
+
+// executeServiceRestart restarts the service the command names, which the
+// policy's restartable_services must list, and acks with its state before
+// and after. A stopped service is started.
+func (cp *CommandPoller) executeServiceRestart(cmd Command) (map[string]interface{}, error) {
+	name, _ := cmd.Parameters["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("invalid name parameter")
+	}
+
+	// Service names are case-insensitive
+	allowed := false
+	for _, s := range cp.config.RestartableServices {
+		if strings.EqualFold(s, name) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("service %s is not restartable by policy", name)
+	}
+
+	log.Printf("Executing service.restart for %s", name)
+
+	previous, current, err := restartService(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"status":         "completed",
+		"service":        name,
+		"previous_state": previous,
+		"state":          current,
+	}, nil
+}
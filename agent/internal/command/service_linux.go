@@ -0,0 +1,8 @@
+package command
+
+import "errors"
+
+// restartService fails: service.restart manages Windows services only
+func restartService(name string) (string, string, error) {
+	return "", "", errors.New("service.restart is only supported on Windows")
+}
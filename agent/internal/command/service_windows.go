@@ -0,0 +1,92 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+var serviceStates = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "start_pending",
+	svc.StopPending:     "stop_pending",
+	svc.Running:         "running",
+	svc.ContinuePending: "continue_pending",
+	svc.PausePending:    "pause_pending",
+	svc.Paused:          "paused",
+}
+
+// restartService stops a service, waiting for it to stop, then starts it
+// and waits for it to run. It returns the service's state before and after.
+func restartService(name string) (string, string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		return "", "", fmt.Errorf("service %s does not exist", name)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open service %s: %w", name, err)
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to query service %s: %w", name, err)
+	}
+	previous := serviceStates[status.State]
+
+	if status.State != svc.Stopped {
+		// A service already stopping, e.g. one stuck on its way down, is
+		// waited for rather than sent another stop
+		if status.State != svc.StopPending {
+			if _, err := s.Control(svc.Stop); err != nil && !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+				return "", "", fmt.Errorf("failed to stop service %s: %w", name, err)
+			}
+		}
+		if status, err = waitForService(s, svc.Stopped); err != nil {
+			return "", "", fmt.Errorf("service %s, previously %s: %w", name, previous, err)
+		}
+	}
+
+	if err := s.Start(); err != nil {
+		return "", "", fmt.Errorf("failed to start service %s: %w", name, err)
+	}
+	status, err = waitForService(s, svc.Running)
+	if err != nil {
+		return "", "", fmt.Errorf("service %s, previously %s: %w", name, previous, err)
+	}
+
+	return previous, serviceStates[status.State], nil
+}
+
+// waitForService polls a service until it reaches state, for up to
+// serviceWait
+func waitForService(s *mgr.Service, state svc.State) (svc.Status, error) {
+	deadline := time.Now().Add(serviceWait)
+	for {
+		status, err := s.Query()
+		if err != nil {
+			return status, fmt.Errorf("failed to query state: %w", err)
+		}
+		if status.State == state {
+			return status, nil
+		}
+		// A service that stops while starting has failed to start
+		if state == svc.Running && status.State == svc.Stopped {
+			return status, fmt.Errorf("stopped while starting (exit code %d)", status.Win32ExitCode)
+		}
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("still %s after %s", serviceStates[status.State], serviceWait)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+)
+
+// uninstallDelay is how long a scheduled uninstall waits before stopping
+// the service, so the command's ack reaches the API first
+const uninstallDelay = 30 * time.Second
+
+// uninstallPlan is what an uninstall removes
+type uninstallPlan struct {
+	Service string
+	// ProductCode is the MSI's product code when the agent was installed
+	// from it, in which case Windows Installer removes the service and
+	// program files
+	ProductCode string
+	// Executable is removed along with the service otherwise
+	Executable string
+	// RemovePaths are the configuration and data the agent wrote
+	RemovePaths []string
+}
+
+// executeUninstall schedules the agent's removal from the device: once the
+// ack is sent, a separate process stops the service, uninstalls it, and
+// deletes the agent's configuration, including its token, and data. The
+// API retires the device when it gets the ack.
+func (cp *CommandPoller) executeUninstall(cmd Command) (map[string]interface{}, error) {
+	if !uninstallSupported {
+		return nil, fmt.Errorf("agent.uninstall is only supported on Windows")
+	}
+
+	plan, err := cp.uninstallPlan()
+	if err != nil {
+		return nil, err
+	}
+	if err := scheduleUninstall(plan, uninstallDelay); err != nil {
+		return nil, fmt.Errorf("failed to schedule uninstall: %w", err)
+	}
+	log.Printf("Uninstall scheduled in %s", uninstallDelay)
+
+	result := map[string]interface{}{
+		"status":        "scheduled",
+		"delay_seconds": int(uninstallDelay.Seconds()),
+		"service":       plan.Service,
+		"removes":       plan.RemovePaths,
+	}
+	if plan.ProductCode != "" {
+		result["msi_product_code"] = plan.ProductCode
+	} else {
+		result["executable"] = plan.Executable
+	}
+	return result, nil
+}
+
+func (cp *CommandPoller) uninstallPlan() (*uninstallPlan, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the agent's executable: %w", err)
+	}
+	code, err := installedProductCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the agent's installation: %w", err)
+	}
+
+	plan := &uninstallPlan{Service: config.ServiceName, ProductCode: code, Executable: exe}
+	seen := make(map[string]bool)
+	for _, p := range []string{config.Path(), cp.config.LocalOutputPath, filepath.Dir(config.DefaultConfigPath)} {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			plan.RemovePaths = append(plan.RemovePaths, p)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,18 @@
+package command
+
+import (
+	"fmt"
+	"time"
+)
+
+// On Linux the agent runs as a container, removed with its DaemonSet or by
+// its runtime rather than by itself
+const uninstallSupported = false
+
+func installedProductCode() (string, error) {
+	return "", nil
+}
+
+func scheduleUninstall(plan *uninstallPlan, delay time.Duration) error {
+	return fmt.Errorf("not supported on Linux")
+}
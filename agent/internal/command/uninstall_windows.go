@@ -0,0 +1,85 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/powershell"
+	"golang.org/x/sys/windows/registry"
+)
+
+const uninstallSupported = true
+
+// productName is the name the MSI registers the agent under in Programs
+// and Features
+const productName = "Inventory Agent"
+
+var productCodePattern = regexp.MustCompile(`^\{[0-9A-Fa-f]{8}(-[0-9A-Fa-f]{4}){3}-[0-9A-Fa-f]{12}\}$`)
+
+// installedProductCode finds the MSI product code the agent was installed
+// under, or returns "" when it wasn't installed from the MSI
+func installedProductCode() (string, error) {
+	for _, path := range []string{
+		`SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`,
+		`SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`,
+	} {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.ENUMERATE_SUB_KEYS)
+		if err == registry.ErrNotExist {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		names, err := key.ReadSubKeyNames(-1)
+		key.Close()
+		if err != nil {
+			return "", err
+		}
+
+		for _, name := range names {
+			// An MSI's entry is named after its product code
+			if !productCodePattern.MatchString(name) {
+				continue
+			}
+			sub, err := registry.OpenKey(registry.LOCAL_MACHINE, path+`\`+name, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			displayName, _, _ := sub.GetStringValue("DisplayName")
+			msi, _, _ := sub.GetIntegerValue("WindowsInstaller")
+			sub.Close()
+			if strings.TrimSpace(displayName) == productName && msi == 1 {
+				return name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// scheduleUninstall starts a detached PowerShell process that waits for
+// delay, stops the service, removes it through msiexec or sc.exe, and
+// deletes the plan's paths. The process outlives the service it stops.
+func scheduleUninstall(plan *uninstallPlan, delay time.Duration) error {
+	system32 := filepath.Join(os.Getenv("SystemRoot"), "System32")
+
+	var script strings.Builder
+	fmt.Fprintf(&script, "$ErrorActionPreference = 'SilentlyContinue'\n")
+	fmt.Fprintf(&script, "Start-Sleep -Seconds %d\n", int(delay.Seconds()))
+	fmt.Fprintf(&script, "Stop-Service -Name %s -Force\n", powershell.Quote(plan.Service))
+	if plan.ProductCode != "" {
+		fmt.Fprintf(&script, "Start-Process -FilePath %s -ArgumentList '/x', %s, '/qn', '/norestart' -Wait\n",
+			powershell.Quote(filepath.Join(system32, "msiexec.exe")), powershell.Quote(plan.ProductCode))
+	} else {
+		fmt.Fprintf(&script, "& %s delete %s\n", powershell.Quote(filepath.Join(system32, "sc.exe")), powershell.Quote(plan.Service))
+		fmt.Fprintf(&script, "Remove-Item -LiteralPath %s -Force\n", powershell.Quote(plan.Executable))
+	}
+	for _, p := range plan.RemovePaths {
+		fmt.Fprintf(&script, "Remove-Item -LiteralPath %s -Recurse -Force\n", powershell.Quote(p))
+	}
+
+	return powershell.StartDetached(script.String())
+}
@@ -0,0 +1,179 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/clock"
+	"github.com/yourorg/inventory-agent/agent/internal/update"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+// errAckDeferred is returned by a command whose ack is sent later, by the
+// agent that runs after a restart
+var errAckDeferred = errors.New("ack deferred")
+
+// executeUpgrade installs the release an agent.upgrade names. It reports
+// progress as the release downloads and is verified, then hands it to a
+// separate installer and leaves the ack to whichever agent starts
+// afterwards: the new one once it's running, or the previous one, put back,
+// if the new one didn't confirm in time.
+func (cp *CommandPoller) executeUpgrade(cmd Command) (map[string]interface{}, error) {
+	if !update.Supported() {
+		return nil, fmt.Errorf("agent.upgrade is only supported on Windows")
+	}
+
+	releaseID, ok := cmd.Parameters["release_id"].(float64)
+	if !ok || releaseID < 1 || releaseID != float64(int64(releaseID)) {
+		return nil, fmt.Errorf("invalid release_id parameter")
+	}
+
+	m, err := cp.releaseManifest(int64(releaseID))
+	if err != nil {
+		return nil, err
+	}
+	if m.Version == version.Version {
+		return map[string]interface{}{
+			"status":  "completed",
+			"stage":   update.StageInstalled,
+			"version": version.Version,
+			"note":    "already running this version",
+		}, nil
+	}
+
+	failed := func(err error) (map[string]interface{}, error) {
+		return map[string]interface{}{"stage": update.StageFailed, "version": version.Version, "target_version": m.Version}, err
+	}
+
+	cp.reportProgress(cmd.CommandID, map[string]interface{}{"stage": update.StageDownloading, "target_version": m.Version})
+	staged, err := update.Download(cp.config, m)
+	if err != nil {
+		return failed(err)
+	}
+	cp.reportProgress(cmd.CommandID, map[string]interface{}{"stage": update.StageVerifying, "target_version": m.Version})
+
+	err = update.Install(staged, &update.State{
+		CommandID:       cmd.CommandID.String(),
+		ReleaseID:       m.ReleaseID,
+		Version:         m.Version,
+		PreviousVersion: version.Version,
+		StartedAt:       clock.Now(),
+	})
+	if err != nil {
+		return failed(fmt.Errorf("failed to start installer: %w", err))
+	}
+	log.Printf("Installing agent %s; the service will restart", m.Version)
+	return nil, errAckDeferred
+}
+
+// releaseManifest fetches the manifest of a release for this platform
+func (cp *CommandPoller) releaseManifest(releaseID int64) (*update.Manifest, error) {
+	endpoint := fmt.Sprintf("%s/v1/agents/%s/releases/%d?platform=%s&arch=%s", cp.config.APIEndpoint, cp.config.DeviceID,
+		releaseID, url.QueryEscape(runtime.GOOS), url.QueryEscape(runtime.GOARCH))
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+cp.config.AuthToken)
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := cp.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("release manifest request returned status %d", resp.StatusCode)
+	}
+
+	var m update.Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid release manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// reportProgress records a running command's progress with the API. It's
+// informational, so a failure is only logged.
+func (cp *CommandPoller) reportProgress(commandID uuid.UUID, result map[string]interface{}) {
+	endpoint := fmt.Sprintf("%s/v1/agents/%s/commands/%s/progress", cp.config.APIEndpoint, cp.config.DeviceID, commandID)
+	data, _ := json.Marshal(map[string]interface{}{"result": result})
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to create progress request: %v", err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+cp.config.AuthToken)
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cp.client.Do(req)
+	if err != nil {
+		log.Printf("Progress report for command %s failed: %v", commandID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 204 {
+		log.Printf("Progress report for command %s returned status %d", commandID, resp.StatusCode)
+	}
+}
+
+// resumeUpgrade acks an agent.upgrade left in progress by the restart it
+// caused. Clearing the state first confirms the new agent is running, so
+// the installer keeps it.
+func (cp *CommandPoller) resumeUpgrade() {
+	state, err := update.LoadState()
+	if err != nil {
+		log.Printf("Failed to read upgrade state: %v", err)
+		update.ClearState()
+		return
+	}
+	if state == nil {
+		return
+	}
+	commandID, err := uuid.Parse(state.CommandID)
+	if err != nil {
+		log.Printf("Upgrade state has an invalid command ID %q", state.CommandID)
+		update.ClearState()
+		return
+	}
+	if err := update.ClearState(); err != nil {
+		log.Printf("Failed to clear upgrade state: %v", err)
+	}
+
+	switch version.Version {
+	case state.Version:
+		log.Printf("Upgraded from %s to %s", state.PreviousVersion, state.Version)
+		cp.ackCommand(commandID, map[string]interface{}{
+			"status":           "completed",
+			"stage":            update.StageInstalled,
+			"version":          version.Version,
+			"previous_version": state.PreviousVersion,
+		}, nil)
+	case state.PreviousVersion:
+		err := fmt.Errorf("agent still at %s after installing %s; rolled back", version.Version, state.Version)
+		log.Printf("Upgrade failed: %v", err)
+		cp.ackCommand(commandID, map[string]interface{}{
+			"stage":          update.StageRolledBack,
+			"version":        version.Version,
+			"target_version": state.Version,
+		}, err)
+	default:
+		// Installed, but the release isn't the version its manifest gives
+		err := fmt.Errorf("agent is at %s after installing %s", version.Version, state.Version)
+		log.Printf("Upgrade failed: %v", err)
+		cp.ackCommand(commandID, map[string]interface{}{
+			"stage":            update.StageFailed,
+			"version":          version.Version,
+			"previous_version": state.PreviousVersion,
+			"target_version":   state.Version,
+		}, err)
+	}
+}
@@ -20,6 +20,37 @@ const (
 	DefaultMaxBackoff     = 5 * time.Minute
 )
 
+// ServiceName is the name the agent is installed as a system service under
+const ServiceName = "InventoryAgent"
+
+// Encodings the agent can upload telemetry in. The binary ones cost less
+// CPU to produce than JSON, on the agent and on the API.
+const (
+	PayloadEncodingJSON     = "json"
+	PayloadEncodingProtobuf = "protobuf"
+	PayloadEncodingMsgpack  = "msgpack"
+)
+
+// Output writer types
+const (
+	OutputLocal = "local" // the latest payload as JSON in a file
+	OutputCloud = "cloud" // uploads to the API
+	OutputNATS  = "nats"  // publishes to the API's telemetry stream directly
+)
+
+// OutputConfig declares one output writer. Options are specific to the
+// writer's type; a writer that isn't enabled is left out.
+type OutputConfig struct {
+	Type    string          `json:"type"`
+	Enabled *bool           `json:"enabled,omitempty"` // true when unset
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// IsEnabled reports whether the writer is used
+func (o OutputConfig) IsEnabled() bool {
+	return o.Enabled == nil || *o.Enabled
+}
+
 type RetryConfig struct {
 	MaxRetries        int           `json:"max_retries"`
 	BackoffMultiplier float64       `json:"backoff_multiplier"`
@@ -32,17 +63,37 @@ type AgentConfig struct {
 	AuthToken          string                 `json:"auth_token,omitempty"`
 	CollectionInterval time.Duration          `json:"collection_interval"`
 	EnabledMetrics     map[string]bool        `json:"enabled_metrics"`
+	AllowedCommands    []string               `json:"allowed_commands"` // nil allows every command type
 	LocalOutputPath    string                 `json:"local_output_path"`
 	LogLevel           string                 `json:"log_level"`
 	RetryConfig        RetryConfig            `json:"retry_config"`
+	TraceRequests      bool                   `json:"trace_requests,omitempty"` // send a W3C traceparent with each upload
+	PayloadEncoding    string                 `json:"payload_encoding,omitempty"` // json (default), protobuf or msgpack
+	ValidateMetrics    bool                   `json:"validate_metrics,omitempty"` // check collector output against the metric schemas before sending
+	OrgID              int64                  `json:"org_id,omitempty"` // organization to enroll into, the API's default when zero
+	BootstrapDomain    string                 `json:"bootstrap_domain,omitempty"` // domain to discover the API under, instead of the machine's
+	DisableBootstrap   bool                   `json:"disable_bootstrap,omitempty"` // don't discover the API when no endpoint is configured
+	Outputs            []OutputConfig         `json:"outputs,omitempty"` // unset writes the local file, and uploads when api_endpoint is set
+	Tags               map[string]string      `json:"tags,omitempty"` // sent with every payload, with a Kubernetes node's labels
+	FetchPaths         []string               `json:"fetch_paths,omitempty"` // files and directories file.fetch may upload; none when empty
+	FetchMaxBytes      int64                  `json:"fetch_max_bytes,omitempty"` // largest file file.fetch uploads, 100 MB when zero
+	RegistryPaths      []string               `json:"registry_paths,omitempty"` // registry keys registry.query may read, with their subkeys; none when empty
+	RestartableServices []string              `json:"restartable_services,omitempty"` // services service.restart may restart, from the policy
 }
 
-// Load reads configuration from file with fallback to defaults
-func Load() (*AgentConfig, error) {
-	configPath := os.Getenv("AGENT_CONFIG_PATH")
-	if configPath == "" {
-		configPath = DefaultConfigPath
+// Path returns the configuration file's path: AGENT_CONFIG_PATH, or
+// DefaultConfigPath when it isn't set
+func Path() string {
+	if path := os.Getenv("AGENT_CONFIG_PATH"); path != "" {
+		return path
 	}
+	return DefaultConfigPath
+}
+
+// Load reads configuration from file with fallback to defaults, then
+// applies AGENT_* environment variables over it
+func Load() (*AgentConfig, error) {
+	configPath := Path()
 
 	cfg := &AgentConfig{
 		CollectionInterval: DefaultCollectionInterval,
@@ -67,9 +118,20 @@ func Load() (*AgentConfig, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	if err := cfg.applyEnv(); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
+
 	// Generate device ID if not set
 	if cfg.DeviceID == "" {
-		cfg.DeviceID = uuid.New().String()
+		id, err := machineDeviceID()
+		if err != nil {
+			return nil, err
+		}
+		if id == "" {
+			id = uuid.New().String()
+		}
+		cfg.DeviceID = id
 		if err := cfg.Save(); err != nil {
 			return nil, fmt.Errorf("failed to save generated device ID: %w", err)
 		}
@@ -85,10 +147,7 @@ func Load() (*AgentConfig, error) {
 
 // Save writes configuration to file
 func (c *AgentConfig) Save() error {
-	configPath := os.Getenv("AGENT_CONFIG_PATH")
-	if configPath == "" {
-		configPath = DefaultConfigPath
-	}
+	configPath := Path()
 
 	// Ensure directory exists
 	dir := filepath.Dir(configPath)
@@ -115,6 +174,19 @@ func (c *AgentConfig) Save() error {
 	return nil
 }
 
+// CommandAllowed reports whether the policy allowlist permits a command type
+func (c *AgentConfig) CommandAllowed(commandType string) bool {
+	if c.AllowedCommands == nil {
+		return true
+	}
+	for _, t := range c.AllowedCommands {
+		if t == commandType {
+			return true
+		}
+	}
+	return false
+}
+
 // Validate checks configuration for required fields and valid values
 func (c *AgentConfig) Validate() error {
 	if c.DeviceID == "" {
@@ -141,5 +213,17 @@ func (c *AgentConfig) Validate() error {
 		return fmt.Errorf("max_backoff must be at least 1 second")
 	}
 
+	for i, o := range c.Outputs {
+		if o.Type == "" {
+			return fmt.Errorf("outputs[%d]: type is required", i)
+		}
+	}
+
+	switch c.PayloadEncoding {
+	case "", PayloadEncodingJSON, PayloadEncodingProtobuf, PayloadEncodingMsgpack:
+	default:
+		return fmt.Errorf("payload_encoding must be json, protobuf or msgpack")
+	}
+
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// applyEnv overrides settings from AGENT_* environment variables, so an
+// agent run as a container is configured without a file. Each variable may
+// instead be given as <NAME>_FILE, the path of a file holding the value,
+// such as a mounted Kubernetes secret.
+func (c *AgentConfig) applyEnv() error {
+	strs := []struct {
+		name  string
+		value *string
+	}{
+		{"AGENT_DEVICE_ID", &c.DeviceID},
+		{"AGENT_API_ENDPOINT", &c.APIEndpoint},
+		{"AGENT_AUTH_TOKEN", &c.AuthToken},
+		{"AGENT_LOCAL_OUTPUT_PATH", &c.LocalOutputPath},
+		{"AGENT_LOG_LEVEL", &c.LogLevel},
+		{"AGENT_PAYLOAD_ENCODING", &c.PayloadEncoding},
+		{"AGENT_BOOTSTRAP_DOMAIN", &c.BootstrapDomain},
+	}
+	for _, s := range strs {
+		value, ok, err := envValue(s.name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*s.value = value
+		}
+	}
+
+	if value, ok, err := envValue("AGENT_ORG_ID"); err != nil {
+		return err
+	} else if ok {
+		if c.OrgID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("AGENT_ORG_ID must be an integer")
+		}
+	}
+
+	if value, ok, err := envValue("AGENT_COLLECTION_INTERVAL"); err != nil {
+		return err
+	} else if ok {
+		if c.CollectionInterval, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("AGENT_COLLECTION_INTERVAL must be a duration such as 15m")
+		}
+	}
+
+	if value, ok, err := envValue("AGENT_DISABLE_BOOTSTRAP"); err != nil {
+		return err
+	} else if ok {
+		if c.DisableBootstrap, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("AGENT_DISABLE_BOOTSTRAP must be true or false")
+		}
+	}
+
+	// A comma-separated list of the collectors to enable; os.info always is
+	if value, ok, err := envValue("AGENT_ENABLED_METRICS"); err != nil {
+		return err
+	} else if ok {
+		c.EnabledMetrics = map[string]bool{"os.info": true}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				c.EnabledMetrics[name] = true
+			}
+		}
+	}
+
+	// key=value pairs separated by commas
+	if value, ok, err := envValue("AGENT_TAGS"); err != nil {
+		return err
+	} else if ok {
+		c.Tags = make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			key, v, _ := strings.Cut(pair, "=")
+			if key == "" {
+				return fmt.Errorf("AGENT_TAGS must be key=value pairs separated by commas")
+			}
+			c.Tags[key] = v
+		}
+	}
+
+	// A comma-separated list of the paths file.fetch may upload
+	if value, ok, err := envValue("AGENT_FETCH_PATHS"); err != nil {
+		return err
+	} else if ok {
+		c.FetchPaths = nil
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				c.FetchPaths = append(c.FetchPaths, path)
+			}
+		}
+	}
+
+	// The outputs list as JSON
+	if value, ok, err := envValue("AGENT_OUTPUTS"); err != nil {
+		return err
+	} else if ok {
+		c.Outputs = nil
+		if err := json.Unmarshal([]byte(value), &c.Outputs); err != nil {
+			return fmt.Errorf("AGENT_OUTPUTS must be a JSON list of outputs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// envValue returns the value of an environment variable, or else the
+// trimmed content of the file its _FILE variant names, and whether either
+// was set
+func envValue(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// machineDeviceID derives a device ID from the machine ID file that
+// AGENT_MACHINE_ID_FILE names, such as the host's /etc/machine-id mounted
+// into a container, so the agent keeps the host's identity when its own
+// state is lost with the container. It returns "" when the variable isn't
+// set.
+func machineDeviceID() (string, error) {
+	path := os.Getenv("AGENT_MACHINE_ID_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read AGENT_MACHINE_ID_FILE: %w", err)
+	}
+	machineID := strings.TrimSpace(string(data))
+	if machineID == "" {
+		return "", fmt.Errorf("AGENT_MACHINE_ID_FILE %s is empty", path)
+	}
+	return uuid.NewSHA1(machineIDNamespace, []byte(machineID)).String(), nil
+}
+
+// machineIDNamespace scopes device IDs derived from machine IDs, which
+// mustn't be used as they are since they are meant to stay private
+var machineIDNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("inventory-agent/machine-id"))
@@ -0,0 +1,455 @@
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/capability"
+	"github.com/yourorg/inventory-agent/agent/internal/command"
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/output"
+	"github.com/yourorg/inventory-agent/agent/internal/policy"
+	"github.com/yourorg/inventory-agent/agent/internal/registration"
+	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+	"github.com/yourorg/inventory-agent/shared/schemas"
+	"github.com/yourorg/inventory-agent/shared/validation"
+)
+
+// pollTimeout bounds the wait for the API to store an upload or see a
+// command through, both of which happen asynchronously
+const pollTimeout = 60 * time.Second
+
+// Harness holds one virtual agent's state across the checks
+type Harness struct {
+	api        string
+	adminToken string
+	client     *http.Client
+	config     *config.AgentConfig
+	validator  *validation.Validator
+	scheduler  *scheduler.Scheduler
+	uploads    *recordingWriter
+}
+
+// recordingWriter passes payloads to the cloud writer and keeps the last
+// one with the upload's outcome, which the scheduler only logs
+type recordingWriter struct {
+	writer  scheduler.Writer
+	payload *scheduler.TelemetryPayload
+	err     error
+}
+
+func (w *recordingWriter) Write(payload interface{}) error {
+	w.payload, _ = payload.(*scheduler.TelemetryPayload)
+	w.err = w.writer.Write(payload)
+	return w.err
+}
+
+// TestContract checks the agent against the API at CONTRACT_API, using
+// CONTRACT_ADMIN_TOKEN to set up policies and commands and to read back what
+// the API stored. Each check builds on the ones before it, so the first to
+// fail stops the rest. The agent's config is kept in a temporary directory,
+// so the machine's own agent is left alone.
+func TestContract(t *testing.T) {
+	endpoint := os.Getenv("CONTRACT_API")
+	if endpoint == "" {
+		t.Skip("CONTRACT_API is not set; make contract-test runs these checks against a throwaway API")
+	}
+	adminToken := os.Getenv("CONTRACT_ADMIN_TOKEN")
+	if adminToken == "" {
+		adminToken = "admin-token"
+	}
+
+	dir := t.TempDir()
+	t.Setenv("AGENT_CONFIG_PATH", filepath.Join(dir, "config.json"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	h := &Harness{
+		api:        endpoint,
+		adminToken: adminToken,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		config: &config.AgentConfig{
+			APIEndpoint:        endpoint,
+			CollectionInterval: config.DefaultCollectionInterval,
+			EnabledMetrics:     map[string]bool{"os.info": true},
+			LocalOutputPath:    filepath.Join(dir, "inventory.json"),
+			LogLevel:           config.DefaultLogLevel,
+			RetryConfig: config.RetryConfig{
+				MaxRetries:        3,
+				BackoffMultiplier: config.DefaultBackoffMultiplier,
+				MaxBackoff:        5 * time.Second,
+			},
+		},
+		validator: validation.NewValidator(),
+	}
+
+	versions, err := schemas.Versions("telemetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range versions {
+		if err := h.validator.LoadSchemaVersionFS("telemetry", v, schemas.FS, schemas.VersionPath("telemetry", v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{"wait for the API", h.waitReady},
+		{"schema versions", h.checkSchemaVersions},
+		{"registration", h.checkRegistration},
+		{"policy", h.checkPolicy},
+		{"ingest", h.checkIngest},
+		{"command", h.checkCommand},
+	}
+	for _, step := range steps {
+		passed := t.Run(step.name, func(t *testing.T) {
+			if err := step.run(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !passed {
+			t.FailNow()
+		}
+	}
+}
+
+// waitReady waits for /readyz, since the API may still be migrating its
+// database when the checks start
+func (h *Harness) waitReady(ctx context.Context) error {
+	return h.poll(ctx, func() (bool, error) {
+		resp, err := h.client.Get(h.api + "/readyz")
+		if err != nil {
+			return false, nil
+		}
+		resp.Body.Close()
+		return resp.StatusCode == 200, nil
+	})
+}
+
+// checkSchemaVersions checks the API accepts the telemetry schema version
+// the agent sends
+func (h *Harness) checkSchemaVersions(ctx context.Context) error {
+	var body struct {
+		Data struct {
+			Versions []int `json:"versions"`
+		} `json:"data"`
+	}
+	if err := h.call(ctx, "GET", "/v1/schemas/telemetry", "", nil, 200, &body); err != nil {
+		return err
+	}
+	for _, v := range body.Data.Versions {
+		if v == scheduler.TelemetrySchemaVersion {
+			return nil
+		}
+	}
+	return fmt.Errorf("API accepts telemetry schema versions %v, not the agent's %d", body.Data.Versions, scheduler.TelemetrySchemaVersion)
+}
+
+// checkRegistration registers a new device and checks the API recorded its
+// capabilities and version as the agent sent them
+func (h *Harness) checkRegistration(ctx context.Context) error {
+	if err := registration.New(h.config).Register(ctx); err != nil {
+		return err
+	}
+	if h.config.DeviceID == "" || h.config.AuthToken == "" {
+		return fmt.Errorf("registration left device ID %q and auth token set %v", h.config.DeviceID, h.config.AuthToken != "")
+	}
+
+	var body struct {
+		Device struct {
+			AgentVersion string                  `json:"agent_version"`
+			Capabilities []capability.Capability `json:"capabilities"`
+		} `json:"device"`
+	}
+	if err := h.call(ctx, "GET", "/v1/devices/"+h.config.DeviceID, h.adminToken, nil, 200, &body); err != nil {
+		return err
+	}
+	if body.Device.AgentVersion != version.Version {
+		return fmt.Errorf("API recorded agent version %q, sent %q", body.Device.AgentVersion, version.Version)
+	}
+	if !sameCapabilities(body.Device.Capabilities, capability.GetCapabilities()) {
+		return fmt.Errorf("API recorded capabilities %v, sent %v", body.Device.Capabilities, capability.GetCapabilities())
+	}
+	return nil
+}
+
+// checkPolicy creates a device policy and checks the agent fetches and
+// applies it, and reports converging on it
+func (h *Harness) checkPolicy(ctx context.Context) error {
+	request := map[string]interface{}{
+		"scope":     "device",
+		"device_id": h.config.DeviceID,
+		"config": map[string]interface{}{
+			"interval_seconds": 300,
+			"metrics": map[string]interface{}{
+				"cpu.utilization": map[string]interface{}{"enabled": true},
+				"memory.usage":    map[string]interface{}{"enabled": true},
+			},
+			"allowed_commands": []string{"collect.now"},
+		},
+	}
+	var created struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+	}
+	if err := h.call(ctx, "POST", "/v1/policies", h.adminToken, request, 201, &created); err != nil {
+		return err
+	}
+
+	h.uploads = &recordingWriter{writer: output.NewCloudWriter(h.config)}
+	h.scheduler = scheduler.New(h.config, []scheduler.Writer{h.uploads})
+
+	manager := policy.NewPolicyManager(h.config, h.scheduler)
+	if err := manager.FetchPolicy(ctx); err != nil {
+		return err
+	}
+
+	served := manager.GetCurrentPolicy()
+	switch {
+	case served == nil:
+		return fmt.Errorf("no policy applied")
+	case served.Version != created.Data.Version:
+		return fmt.Errorf("agent applied policy version %d, created %d", served.Version, created.Data.Version)
+	case served.Config.IntervalSeconds != 300:
+		return fmt.Errorf("agent applied interval %ds, set 300s", served.Config.IntervalSeconds)
+	case !served.Config.Metrics["cpu.utilization"].Enabled || !served.Config.Metrics["memory.usage"].Enabled:
+		return fmt.Errorf("agent applied metrics %v, enabled cpu.utilization and memory.usage", served.Config.Metrics)
+	case !h.config.CommandAllowed("collect.now"):
+		return fmt.Errorf("agent doesn't allow collect.now after applying allowed_commands %v", served.Config.AllowedCommands)
+	}
+
+	var status struct {
+		Data struct {
+			PolicyVersion  int      `json:"policy_version"`
+			Converged      bool     `json:"converged"`
+			FailedSettings []string `json:"failed_settings"`
+		} `json:"data"`
+	}
+	if err := h.call(ctx, "GET", "/v1/devices/"+h.config.DeviceID+"/policy-status", h.adminToken, nil, 200, &status); err != nil {
+		return err
+	}
+	switch {
+	case status.Data.PolicyVersion != created.Data.Version:
+		return fmt.Errorf("agent reported applying policy version %d, created %d", status.Data.PolicyVersion, created.Data.Version)
+	case !status.Data.Converged:
+		return fmt.Errorf("agent reported not converging on its policy, failed settings %v", status.Data.FailedSettings)
+	}
+	return nil
+}
+
+// checkIngest uploads a collection run in each payload encoding and checks
+// the payload matches the telemetry schema and the API stored it as sent
+func (h *Harness) checkIngest(ctx context.Context) error {
+	for _, encoding := range []string{config.PayloadEncodingJSON, config.PayloadEncodingProtobuf, config.PayloadEncodingMsgpack} {
+		h.config.PayloadEncoding = encoding
+		if err := h.checkUpload(ctx); err != nil {
+			return fmt.Errorf("%s: %w", encoding, err)
+		}
+	}
+	h.config.PayloadEncoding = ""
+	return nil
+}
+
+func (h *Harness) checkUpload(ctx context.Context) error {
+	if err := h.scheduler.TriggerNow(); err != nil {
+		return err
+	}
+	sent := h.uploads.payload
+	if sent == nil {
+		return fmt.Errorf("the scheduler wrote no telemetry payload")
+	}
+
+	result, err := h.validator.ValidateTelemetryWithResult(sent.SchemaVersion, sent)
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		return fmt.Errorf("payload doesn't match telemetry schema version %d: %v", sent.SchemaVersion, result.Errors)
+	}
+	if h.uploads.err != nil {
+		return fmt.Errorf("upload failed: %w", h.uploads.err)
+	}
+
+	var stored struct {
+		Telemetry struct {
+			IngestionID string                 `json:"ingestion_id"`
+			Metrics     map[string]interface{} `json:"metrics"`
+		} `json:"telemetry"`
+	}
+	err = h.poll(ctx, func() (bool, error) {
+		err := h.call(ctx, "GET", "/v1/devices/"+h.config.DeviceID, h.adminToken, nil, 200, &stored)
+		return err == nil && stored.Telemetry.IngestionID == sent.IngestionID, err
+	})
+	if err != nil {
+		return fmt.Errorf("payload %s wasn't stored: %w", sent.IngestionID, err)
+	}
+
+	for metric := range sent.Metrics {
+		if _, ok := stored.Telemetry.Metrics[metric]; !ok {
+			return fmt.Errorf("API stored metrics %v, missing %s", keys(stored.Telemetry.Metrics), metric)
+		}
+	}
+	return nil
+}
+
+// checkCommand issues collect.now and checks the agent receives, runs and
+// acknowledges it
+func (h *Harness) checkCommand(ctx context.Context) error {
+	request := map[string]interface{}{
+		"device_id":  h.config.DeviceID,
+		"type":       "collect.now",
+		"parameters": map[string]interface{}{"metrics": []string{"cpu.utilization"}},
+	}
+	var created struct {
+		Data struct {
+			CommandID string `json:"command_id"`
+		} `json:"data"`
+	}
+	if err := h.call(ctx, "POST", "/v1/commands", h.adminToken, request, 201, &created); err != nil {
+		return err
+	}
+
+	poller := command.NewCommandPoller(h.config, h.scheduler)
+	n, err := poller.Poll(ctx)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("agent received no commands")
+	}
+
+	// The poller runs and acknowledges the command in the background
+	var commands struct {
+		Data []struct {
+			CommandID string                 `json:"command_id"`
+			Status    string                 `json:"status"`
+			Result    map[string]interface{} `json:"result"`
+		} `json:"data"`
+	}
+	var status string
+	err = h.poll(ctx, func() (bool, error) {
+		if err := h.call(ctx, "GET", "/v1/commands?device_id="+h.config.DeviceID, h.adminToken, nil, 200, &commands); err != nil {
+			return false, err
+		}
+		for _, cmd := range commands.Data {
+			if cmd.CommandID == created.Data.CommandID {
+				status = cmd.Status
+				return status == "completed" || status == "failed" || status == "expired", nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("command %s didn't finish, last status %q: %w", created.Data.CommandID, status, err)
+	}
+	if status != "completed" {
+		return fmt.Errorf("command %s finished as %s", created.Data.CommandID, status)
+	}
+	return nil
+}
+
+// call makes a request to the API, with token as the bearer token if set,
+// and decodes the response into out when it has the expected status
+func (h *Harness) call(ctx context.Context, method, path, token string, body interface{}, expect int, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, h.api+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != expect {
+		return fmt.Errorf("%s %s returned %d, expected %d: %s", method, path, resp.StatusCode, expect, data)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s returned a body that doesn't decode: %w", method, path, err)
+	}
+	return nil
+}
+
+// poll calls done every second until it reports true, fails, or
+// pollTimeout passes
+func (h *Harness) poll(ctx context.Context, done func() (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func sameCapabilities(a, b []capability.Capability) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[capability.Capability]bool, len(a))
+	for _, c := range a {
+		seen[c] = true
+	}
+	for _, c := range b {
+		if !seen[c] {
+			return false
+		}
+	}
+	return true
+}
+
+func keys(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
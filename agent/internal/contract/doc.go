@@ -0,0 +1,8 @@
+// Package contract checks that this agent and an API deployment still
+// understand each other. Its test drives the agent's own registration,
+// policy, upload and command code against a live API, then checks what the
+// API stored and served against what the agent sent and the shared schemas,
+// so a protocol change that would break deployed agents fails before it
+// ships. make contract-test runs it against a throwaway API, Postgres and
+// NATS.
+package contract
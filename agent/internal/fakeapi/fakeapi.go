@@ -0,0 +1,963 @@
+// Package fakeapi serves the agent-facing endpoints of the API from an
+// httptest server, so collector, scheduler and output tests can exercise the
+// agent's HTTP code without the real backend. By default the fake behaves as
+// the API does: it registers devices, serves a policy with an ETag and 304s,
+// records policy status reports, accepts uploads and batches in every payload
+// encoding, hands out queued commands, records progress reports, acks and
+// chunked command artifacts, serves release manifests and downloads, and
+// serves the shared schemas.
+// Each route can be scripted to answer its next requests differently (an
+// error status, a Retry-After, a malformed body or a slow reply) before
+// falling back to that behavior, and every request is recorded for the test
+// to inspect.
+package fakeapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/update"
+	"github.com/yourorg/inventory-agent/shared/models"
+	telemetryv1 "github.com/yourorg/inventory-agent/shared/proto/telemetry/v1"
+	"github.com/yourorg/inventory-agent/shared/schemas"
+	"google.golang.org/protobuf/proto"
+)
+
+// Token is the auth token the fake issues on registration and requires of
+// every other agent request
+const Token = "fake-agent-token"
+
+// DefaultArtifactChunkSize is the chunk size the fake asks artifacts to be
+// uploaded in, as the API does
+const DefaultArtifactChunkSize = 4 << 20
+
+// Route names one of the endpoints the fake serves
+type Route string
+
+const (
+	// Register is POST /v1/agents/register
+	Register Route = "register"
+	// Policy is GET /v1/agents/{id}/policy
+	Policy Route = "policy"
+	// PolicyStatus is POST /v1/agents/{id}/policy/status
+	PolicyStatus Route = "policy_status"
+	// Inventory is POST /v1/agents/{id}/inventory
+	Inventory Route = "inventory"
+	// InventoryBatch is POST /v1/agents/{id}/inventory/batch
+	InventoryBatch Route = "inventory_batch"
+	// Commands is GET /v1/agents/{id}/commands
+	Commands Route = "commands"
+	// Ack is POST /v1/agents/{id}/commands/{command_id}/ack
+	Ack Route = "ack"
+	// Progress is POST /v1/agents/{id}/commands/{command_id}/progress
+	Progress Route = "progress"
+	// ArtifactCreate is POST /v1/agents/{id}/commands/{command_id}/artifacts
+	ArtifactCreate Route = "artifact_create"
+	// ArtifactChunk is PUT
+	// /v1/agents/{id}/commands/{command_id}/artifacts/{artifact_id}/chunks/{index}
+	ArtifactChunk Route = "artifact_chunk"
+	// ArtifactComplete is POST
+	// /v1/agents/{id}/commands/{command_id}/artifacts/{artifact_id}/complete
+	ArtifactComplete Route = "artifact_complete"
+	// Release is GET /v1/agents/{id}/releases/{release_id}
+	Release Route = "release"
+	// ReleaseDownload is GET /v1/agents/{id}/releases/{release_id}/download
+	ReleaseDownload Route = "release_download"
+	// SchemaVersions is GET /v1/schemas/telemetry
+	SchemaVersions Route = "schema_versions"
+	// MetricSchema is GET /v1/schemas/{metric}
+	MetricSchema Route = "metric_schema"
+)
+
+// Response is a scripted answer to one request. A zero Status answers with
+// the route's normal behavior once Delay has passed.
+type Response struct {
+	Status int
+	Header http.Header
+	// Body is sent as is; nil sends {"error": <status text>} for an error
+	// status and nothing otherwise
+	Body []byte
+	// Delay holds the response back, or until the client gives up
+	Delay time.Duration
+}
+
+// Status answers with a bare status code
+func Status(code int) Response {
+	return Response{Status: code}
+}
+
+// RetryAfter answers with a status code and a Retry-After in seconds
+func RetryAfter(code int, after time.Duration) Response {
+	header := http.Header{}
+	header.Set("Retry-After", strconv.Itoa(int(after/time.Second)))
+	return Response{Status: code, Header: header}
+}
+
+// Malformed answers 200 with a truncated JSON body
+func Malformed() Response {
+	return Response{Status: http.StatusOK, Body: []byte(`{"data": [`)}
+}
+
+// Slow answers normally after d
+func Slow(d time.Duration) Response {
+	return Response{Delay: d}
+}
+
+// JSON answers with a status code and v encoded as JSON
+func JSON(code int, v interface{}) Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("fakeapi: encoding scripted body: %v", err))
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return Response{Status: code, Header: header, Body: body}
+}
+
+// Request is a request the fake received
+type Request struct {
+	Route  Route
+	Method string
+	Path   string
+	Header http.Header
+	// Body is the body as sent, before any gzip is undone
+	Body []byte
+}
+
+// Upload is a payload the fake accepted on the inventory or batch route
+type Upload struct {
+	DeviceID    string
+	ContentType string
+	Payload     models.TelemetryPayload
+}
+
+// CommandAck is an ack the fake accepted
+type CommandAck struct {
+	DeviceID  string
+	CommandID uuid.UUID
+	Result    map[string]interface{}
+	Error     string
+}
+
+// CommandProgress is a progress report the fake accepted
+type CommandProgress struct {
+	DeviceID  string
+	CommandID uuid.UUID
+	Result    map[string]interface{}
+}
+
+// Artifact is a command artifact the agent declared, with the chunks it
+// has uploaded so far joined in order
+type Artifact struct {
+	ArtifactID  uuid.UUID
+	DeviceID    string
+	CommandID   uuid.UUID
+	Name        string
+	ContentType string
+	SizeBytes   int64
+	SHA256      string
+	ChunkSize   int
+	Data        []byte
+	// Complete is set once the agent completed the artifact and its chunks
+	// matched its SHA-256
+	Complete bool
+}
+
+// chunks is how many chunks the artifact is uploaded in
+func (a *Artifact) chunks() int {
+	return int((a.SizeBytes + int64(a.ChunkSize) - 1) / int64(a.ChunkSize))
+}
+
+// artifactUpload is an artifact and the chunks received for it
+type artifactUpload struct {
+	Artifact
+	received map[int][]byte
+}
+
+// release is a release the fake serves
+type release struct {
+	manifest update.Manifest
+	data     []byte
+}
+
+// Server is a fake API. Its methods are safe to call while the agent is
+// calling it.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	scripts  map[Route][]Response
+	requests []Request
+	uploads  []Upload
+	acks     []CommandAck
+	progress []CommandProgress
+	statuses []models.PolicyStatus
+	policy   models.Policy
+	etag     string
+	commands []models.Command
+
+	chunkSize int
+	artifacts []*artifactUpload
+	releases  map[int64]*release
+}
+
+// New starts a fake API serving a policy that enables nothing. Close it when
+// done.
+func New() *Server {
+	s := &Server{
+		scripts:   make(map[Route][]Response),
+		chunkSize: DefaultArtifactChunkSize,
+		releases:  make(map[int64]*release),
+	}
+	s.SetPolicy(models.Policy{Version: 1, Config: models.PolicyConfig{IntervalSeconds: 900}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/agents/register", s.route(Register, false, s.register))
+	mux.HandleFunc("GET /v1/agents/{id}/policy", s.route(Policy, true, s.getPolicy))
+	mux.HandleFunc("POST /v1/agents/{id}/policy/status", s.route(PolicyStatus, true, s.reportPolicyStatus))
+	mux.HandleFunc("POST /v1/agents/{id}/inventory", s.route(Inventory, true, s.ingest))
+	mux.HandleFunc("POST /v1/agents/{id}/inventory/batch", s.route(InventoryBatch, true, s.ingestBatch))
+	mux.HandleFunc("GET /v1/agents/{id}/commands", s.route(Commands, true, s.getCommands))
+	mux.HandleFunc("POST /v1/agents/{id}/commands/{command_id}/ack", s.route(Ack, true, s.ack))
+	mux.HandleFunc("POST /v1/agents/{id}/commands/{command_id}/progress", s.route(Progress, true, s.reportProgress))
+	mux.HandleFunc("POST /v1/agents/{id}/commands/{command_id}/artifacts", s.route(ArtifactCreate, true, s.createArtifact))
+	mux.HandleFunc("PUT /v1/agents/{id}/commands/{command_id}/artifacts/{artifact_id}/chunks/{index}", s.route(ArtifactChunk, true, s.putArtifactChunk))
+	mux.HandleFunc("POST /v1/agents/{id}/commands/{command_id}/artifacts/{artifact_id}/complete", s.route(ArtifactComplete, true, s.completeArtifact))
+	mux.HandleFunc("GET /v1/agents/{id}/releases/{release_id}", s.route(Release, true, s.getRelease))
+	mux.HandleFunc("GET /v1/agents/{id}/releases/{release_id}/download", s.route(ReleaseDownload, true, s.downloadRelease))
+	mux.HandleFunc("GET /v1/schemas/telemetry", s.route(SchemaVersions, false, s.getSchemaVersions))
+	mux.HandleFunc("GET /v1/schemas/{metric}", s.route(MetricSchema, false, s.getMetricSchema))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AgentConfig returns an agent configuration pointed at the fake, with a
+// device ID and the token the fake accepts, as after registration. The agent
+// saves its configuration as it goes, so tests should point
+// AGENT_CONFIG_PATH at a temporary file.
+func (s *Server) AgentConfig() *config.AgentConfig {
+	return &config.AgentConfig{
+		DeviceID:           uuid.NewString(),
+		APIEndpoint:        s.URL,
+		AuthToken:          Token,
+		CollectionInterval: config.DefaultCollectionInterval,
+		EnabledMetrics:     map[string]bool{"os.info": true},
+		LogLevel:           config.DefaultLogLevel,
+		RetryConfig: config.RetryConfig{
+			MaxRetries:        config.DefaultMaxRetries,
+			BackoffMultiplier: config.DefaultBackoffMultiplier,
+			MaxBackoff:        config.DefaultMaxBackoff,
+		},
+	}
+}
+
+// Script queues responses for the next requests to a route, answered in
+// order after any already queued
+func (s *Server) Script(route Route, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[route] = append(s.scripts[route], responses...)
+}
+
+// SetPolicy replaces the policy served, changing its ETag
+func (s *Server) SetPolicy(p models.Policy) {
+	data, _ := json.Marshal(p)
+	hash := md5.Sum(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = p
+	s.etag = `"` + hex.EncodeToString(hash[:]) + `"`
+}
+
+// QueueCommand adds a command for the next command poll to deliver and
+// returns it as queued, with an ID, issue time, TTL and status filled in
+// where missing
+func (s *Server) QueueCommand(cmd models.Command) models.Command {
+	if cmd.CommandID == uuid.Nil {
+		cmd.CommandID = uuid.New()
+	}
+	if cmd.IssuedAt.IsZero() {
+		cmd.IssuedAt = time.Now()
+	}
+	if cmd.TTLSeconds == 0 {
+		cmd.TTLSeconds = 300
+	}
+	if cmd.Status == "" {
+		cmd.Status = "pending"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, cmd)
+	return cmd
+}
+
+// SetArtifactChunkSize changes the chunk size artifacts declared from now
+// on are uploaded in, so a test can have a small one span several chunks
+func (s *Server) SetArtifactChunkSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunkSize = size
+}
+
+// AddRelease serves data as release id of version and returns its
+// manifest. The manifest served also carries the URL to download data
+// from, which names the requesting device.
+func (s *Server) AddRelease(id int64, version string, data []byte) update.Manifest {
+	sum := sha256.Sum256(data)
+	size := int64(len(data))
+	m := update.Manifest{ReleaseID: id, Version: version, SHA256: hex.EncodeToString(sum[:]), SizeBytes: &size}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releases[id] = &release{manifest: m, data: data}
+	return m
+}
+
+// Requests returns the requests received on a route, oldest first, or on
+// every route when route is empty
+func (s *Server) Requests(route Route) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requests []Request
+	for _, r := range s.requests {
+		if route == "" || r.Route == route {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// Uploads returns the payloads accepted, oldest first
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Upload(nil), s.uploads...)
+}
+
+// Acks returns the command acks accepted, oldest first
+func (s *Server) Acks() []CommandAck {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CommandAck(nil), s.acks...)
+}
+
+// Progress returns the command progress reports accepted, oldest first
+func (s *Server) Progress() []CommandProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CommandProgress(nil), s.progress...)
+}
+
+// Artifacts returns the artifacts declared, oldest first, each with the
+// chunks received so far
+func (s *Server) Artifacts() []Artifact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	artifacts := make([]Artifact, len(s.artifacts))
+	for i, a := range s.artifacts {
+		artifacts[i] = a.Artifact
+		artifacts[i].Data = a.joined()
+	}
+	return artifacts
+}
+
+// PolicyStatuses returns the policy status reports accepted, oldest first
+func (s *Server) PolicyStatuses() []models.PolicyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.PolicyStatus(nil), s.statuses...)
+}
+
+// route records each request, answers with the route's next scripted
+// response if any, checks the agent's token when authed, and otherwise
+// calls handle
+func (s *Server) route(route Route, authed bool, handle http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Route:  route,
+			Method: r.Method,
+			Path:   r.URL.RequestURI(),
+			Header: r.Header.Clone(),
+			Body:   body,
+		})
+		var scripted *Response
+		if queue := s.scripts[route]; len(queue) > 0 {
+			scripted = &queue[0]
+			s.scripts[route] = queue[1:]
+		}
+		s.mu.Unlock()
+
+		if scripted != nil {
+			if scripted.Delay > 0 {
+				select {
+				case <-time.After(scripted.Delay):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			if scripted.Status != 0 {
+				writeScripted(w, scripted)
+				return
+			}
+		}
+
+		if authed && r.Header.Get("Authorization") != "Bearer "+Token {
+			writeError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		handle(w, r)
+	}
+}
+
+func writeScripted(w http.ResponseWriter, resp *Response) {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	if resp.Body == nil && resp.Status >= 400 {
+		writeError(w, resp.Status, http.StatusText(resp.Status))
+		return
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DeviceID string `json:"device_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.DeviceID == "" {
+		req.DeviceID = uuid.NewString()
+	}
+
+	s.mu.Lock()
+	version := s.policy.Version
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"device_id":      req.DeviceID,
+		"auth_token":     Token,
+		"policy_version": version,
+	})
+}
+
+func (s *Server) getPolicy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	policy, etag := s.policy, s.etag
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (s *Server) reportPolicyStatus(w http.ResponseWriter, r *http.Request) {
+	var status models.PolicyStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	s.statuses = append(s.statuses, status)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) ingest(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err == nil && r.Header.Get("Content-Encoding") == "gzip" {
+		body, err = gunzip(body)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	payload, err := decodePayload(body, contentType)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.uploads = append(s.uploads, Upload{DeviceID: r.PathValue("id"), ContentType: contentType, Payload: payload})
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+// decodePayload reads an upload in any of the agent's payload encodings
+func decodePayload(body []byte, contentType string) (models.TelemetryPayload, error) {
+	var payload models.TelemetryPayload
+
+	switch contentType {
+	case "application/x-protobuf":
+		var pb telemetryv1.TelemetryPayload
+		if err := proto.Unmarshal(body, &pb); err != nil {
+			return payload, err
+		}
+		payload = payloadFromProto(&pb)
+	case "application/msgpack":
+		if _, err := payload.UnmarshalMsg(body); err != nil {
+			return payload, err
+		}
+	case "application/json", "":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return payload, err
+		}
+	default:
+		return payload, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	return payload, checkPayload(&payload)
+}
+
+// decodeBatch reads a batch upload in any of the agent's payload encodings,
+// returning the error each payload failed with, if any, alongside it
+func decodeBatch(body []byte, contentType string) ([]models.TelemetryPayload, []error, error) {
+	var payloads []models.TelemetryPayload
+	var errs []error
+
+	switch contentType {
+	case "application/x-protobuf":
+		var pb telemetryv1.TelemetryBatch
+		if err := proto.Unmarshal(body, &pb); err != nil {
+			return nil, nil, err
+		}
+		for _, p := range pb.Payloads {
+			payloads = append(payloads, payloadFromProto(p))
+		}
+	case "application/msgpack":
+		var batch models.TelemetryBatch
+		if _, err := batch.UnmarshalMsg(body); err != nil {
+			return nil, nil, err
+		}
+		payloads = batch
+	case "application/json", "":
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, nil, err
+		}
+		payloads = make([]models.TelemetryPayload, len(raw))
+		errs = make([]error, len(raw))
+		for i := range raw {
+			errs[i] = json.Unmarshal(raw[i], &payloads[i])
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	if errs == nil {
+		errs = make([]error, len(payloads))
+	}
+	for i := range payloads {
+		if errs[i] == nil {
+			errs[i] = checkPayload(&payloads[i])
+		}
+	}
+	return payloads, errs, nil
+}
+
+func payloadFromProto(pb *telemetryv1.TelemetryPayload) models.TelemetryPayload {
+	return models.TelemetryPayload{
+		DeviceID:      pb.DeviceId,
+		IngestionID:   pb.IngestionId,
+		AgentVersion:  pb.AgentVersion,
+		CollectedAt:   pb.CollectedAt.AsTime(),
+		Metrics:       pb.Metrics.AsMap(),
+		Errors:        pb.Errors,
+		SchemaVersion: int(pb.SchemaVersion),
+		ClockSkewMs:   pb.ClockSkewMs,
+		Tags:          pb.Tags,
+	}
+}
+
+// checkPayload checks what the fake needs of a payload to record it
+func checkPayload(payload *models.TelemetryPayload) error {
+	if payload.DeviceID == "" {
+		return errors.New("device_id is required")
+	}
+	return nil
+}
+
+// ingestBatch accepts each valid payload of a batch and answers with each
+// one's outcome, as the API does
+func (s *Server) ingestBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err == nil && r.Header.Get("Content-Encoding") == "gzip" {
+		body, err = gunzip(body)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	payloads, errs, err := decodeBatch(body, contentType)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid telemetry batch: expected an array of payloads")
+		return
+	}
+	if len(payloads) == 0 {
+		writeError(w, http.StatusBadRequest, "Telemetry batch is empty")
+		return
+	}
+
+	results := make([]map[string]interface{}, len(payloads))
+	accepted := 0
+	s.mu.Lock()
+	for i := range payloads {
+		if errs[i] != nil {
+			results[i] = map[string]interface{}{"index": i, "status": "rejected", "error": "Invalid telemetry payload"}
+			continue
+		}
+		s.uploads = append(s.uploads, Upload{DeviceID: r.PathValue("id"), ContentType: contentType, Payload: payloads[i]})
+		results[i] = map[string]interface{}{"index": i, "status": "accepted", "ingestion_id": payloads[i].IngestionID}
+		accepted++
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"accepted": accepted,
+		"rejected": len(payloads) - accepted,
+		"results":  results,
+	})
+}
+
+// getCommands hands out the queued commands at once, where the API would
+// hold the request open until one is queued or the wait passes
+func (s *Server) getCommands(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	commands := s.commands
+	s.commands = nil
+	s.mu.Unlock()
+
+	if commands == nil {
+		commands = []models.Command{}
+	}
+	writeJSON(w, http.StatusOK, commands)
+}
+
+func (s *Server) ack(w http.ResponseWriter, r *http.Request) {
+	commandID, err := uuid.Parse(r.PathValue("command_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid command ID")
+		return
+	}
+	var req struct {
+		Result map[string]interface{} `json:"result"`
+		Error  string                 `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	s.acks = append(s.acks, CommandAck{
+		DeviceID:  r.PathValue("id"),
+		CommandID: commandID,
+		Result:    req.Result,
+		Error:     req.Error,
+	})
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "acknowledged"})
+}
+
+func (s *Server) reportProgress(w http.ResponseWriter, r *http.Request) {
+	commandID, err := uuid.Parse(r.PathValue("command_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid command ID")
+		return
+	}
+	var req struct {
+		Result map[string]interface{} `json:"result"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Result == nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	s.progress = append(s.progress, CommandProgress{DeviceID: r.PathValue("id"), CommandID: commandID, Result: req.Result})
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// joined returns the chunks received, in order, stopping at the first
+// missing one
+func (a *artifactUpload) joined() []byte {
+	var data []byte
+	for i := 0; i < a.chunks(); i++ {
+		chunk, ok := a.received[i]
+		if !ok {
+			break
+		}
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+// findArtifact returns the artifact in the path, or nil when the device
+// didn't declare it for the command. The caller holds s.mu.
+func (s *Server) findArtifact(r *http.Request) *artifactUpload {
+	for _, a := range s.artifacts {
+		if a.ArtifactID.String() == r.PathValue("artifact_id") && a.DeviceID == r.PathValue("id") &&
+			a.CommandID.String() == r.PathValue("command_id") {
+			return a
+		}
+	}
+	return nil
+}
+
+func (s *Server) createArtifact(w http.ResponseWriter, r *http.Request) {
+	commandID, err := uuid.Parse(r.PathValue("command_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid command ID")
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		ContentType string `json:"content_type"`
+		SizeBytes   int64  `json:"size_bytes"`
+		SHA256      string `json:"sha256"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.SizeBytes <= 0 || len(req.SHA256) != 64 {
+		writeError(w, http.StatusBadRequest, "Invalid artifact")
+		return
+	}
+
+	s.mu.Lock()
+	a := &artifactUpload{
+		Artifact: Artifact{
+			ArtifactID:  uuid.New(),
+			DeviceID:    r.PathValue("id"),
+			CommandID:   commandID,
+			Name:        req.Name,
+			ContentType: req.ContentType,
+			SizeBytes:   req.SizeBytes,
+			SHA256:      req.SHA256,
+			ChunkSize:   s.chunkSize,
+		},
+		received: make(map[int][]byte),
+	}
+	s.artifacts = append(s.artifacts, a)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"artifact_id":      a.ArtifactID,
+		"command_id":       a.CommandID,
+		"name":             a.Name,
+		"content_type":     a.ContentType,
+		"size_bytes":       a.SizeBytes,
+		"sha256":           a.SHA256,
+		"chunk_size_bytes": a.ChunkSize,
+	})
+}
+
+// putArtifactChunk stores a chunk, which must be the artifact's chunk size
+// unless it is the last, replacing one sent before
+func (s *Server) putArtifactChunk(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.findArtifact(r)
+	if a == nil {
+		writeError(w, http.StatusNotFound, "Artifact not found")
+		return
+	}
+	if a.Complete {
+		writeError(w, http.StatusConflict, "Artifact is already complete")
+		return
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= a.chunks() {
+		writeError(w, http.StatusBadRequest, "Invalid chunk index")
+		return
+	}
+	want := int64(a.ChunkSize)
+	if index == a.chunks()-1 {
+		want = a.SizeBytes - int64(index)*int64(a.ChunkSize)
+	}
+	if int64(len(data)) != want {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Chunk %d must be %d bytes", index, want))
+		return
+	}
+
+	a.received[index] = data
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeArtifact checks every chunk is in and matches the declared
+// SHA-256
+func (s *Server) completeArtifact(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.findArtifact(r)
+	if a == nil {
+		writeError(w, http.StatusNotFound, "Artifact not found")
+		return
+	}
+
+	if !a.Complete {
+		var missing []int
+		for i := 0; i < a.chunks(); i++ {
+			if _, ok := a.received[i]; !ok {
+				missing = append(missing, i)
+			}
+		}
+		if len(missing) > 0 {
+			writeError(w, http.StatusConflict, fmt.Sprintf("Missing chunks %v", missing))
+			return
+		}
+		sum := sha256.Sum256(a.joined())
+		if hex.EncodeToString(sum[:]) != a.SHA256 {
+			writeError(w, http.StatusConflict, "Artifact does not match its sha256")
+			return
+		}
+		a.Complete = true
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"artifact_id": a.ArtifactID,
+		"name":        a.Name,
+		"size_bytes":  a.SizeBytes,
+		"sha256":      a.SHA256,
+	})
+}
+
+// findRelease returns the release in the path, or nil when the fake
+// doesn't serve it
+func (s *Server) findRelease(r *http.Request) *release {
+	id, err := strconv.ParseInt(r.PathValue("release_id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.releases[id]
+}
+
+// getRelease serves a release's manifest, pointing its URL at the download
+// route for the requesting device
+func (s *Server) getRelease(w http.ResponseWriter, r *http.Request) {
+	rel := s.findRelease(r)
+	if rel == nil {
+		writeError(w, http.StatusNotFound, "Release not found")
+		return
+	}
+	m := rel.manifest
+	m.URL = fmt.Sprintf("%s/v1/agents/%s/releases/%d/download", s.URL, r.PathValue("id"), m.ReleaseID)
+	writeJSON(w, http.StatusOK, m)
+}
+
+func (s *Server) downloadRelease(w http.ResponseWriter, r *http.Request) {
+	rel := s.findRelease(r)
+	if rel == nil {
+		writeError(w, http.StatusNotFound, "Release not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(rel.data)))
+	w.Write(rel.data)
+}
+
+func (s *Server) getSchemaVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := schemas.Versions("telemetry")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to read schema")
+		return
+	}
+	latest := 0
+	if len(versions) > 0 {
+		latest = versions[len(versions)-1]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{"name": "telemetry", "versions": versions, "latest": latest},
+	})
+}
+
+func (s *Server) getMetricSchema(w http.ResponseWriter, r *http.Request) {
+	versions, err := schemas.Versions("telemetry")
+	if err != nil || len(versions) == 0 {
+		writeError(w, http.StatusInternalServerError, "Failed to read schema")
+		return
+	}
+	version := versions[len(versions)-1]
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || !slices.Contains(versions, version) {
+			writeError(w, http.StatusNotFound, "Schema version not found")
+			return
+		}
+	}
+
+	data, err := schemas.MetricSchema(version, r.PathValue("metric"))
+	switch {
+	case errors.Is(err, schemas.ErrUnknownMetric):
+		writeError(w, http.StatusNotFound, "Metric not found")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to read schema")
+	default:
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(data)
+	}
+}
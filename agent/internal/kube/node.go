@@ -0,0 +1,123 @@
+// Package kube reads the labels of the Kubernetes node the agent runs on,
+// when it runs in a pod on that node. It talks to the API server with the
+// pod's service account, which needs to be allowed to get nodes.
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// NodeLabels fetches a node's labels from the API server
+type NodeLabels struct {
+	nodeURL   string
+	tokenPath string
+	client    *http.Client
+
+	mu     sync.Mutex
+	labels map[string]string
+}
+
+// InCluster reports whether the agent runs in a pod that was told its node's
+// name, as NODE_NAME from the downward API
+func InCluster() bool {
+	return os.Getenv("NODE_NAME") != "" && os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// NewInCluster returns a reader for the labels of the node named by
+// NODE_NAME, using the API server address and service account Kubernetes
+// gives every pod
+func NewInCluster() (*NodeLabels, error) {
+	node := os.Getenv("NODE_NAME")
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if node == "" || host == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod with NODE_NAME set")
+	}
+	if port == "" {
+		port = "443"
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("service account CA has no certificates")
+	}
+
+	return &NodeLabels{
+		nodeURL:   "https://" + net.JoinHostPort(host, port) + "/api/v1/nodes/" + url.PathEscape(node),
+		tokenPath: serviceAccountDir + "/token",
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// Labels returns the node's labels. When they can't be fetched it returns
+// the last ones it got, so a brief API server outage doesn't drop the tags.
+func (n *NodeLabels) Labels(ctx context.Context) map[string]string {
+	labels, err := n.fetch(ctx)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to read node labels: %v", err)
+		return n.labels
+	}
+	n.labels = labels
+	return labels
+}
+
+func (n *NodeLabels) fetch(ctx context.Context) (map[string]string, error) {
+	// The token is rotated while the pod runs, so it's read each time
+	token, err := os.ReadFile(n.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.nodeURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API server returned status %d", resp.StatusCode)
+	}
+
+	var node struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&node); err != nil {
+		return nil, fmt.Errorf("failed to decode node: %w", err)
+	}
+	return node.Metadata.Labels, nil
+}
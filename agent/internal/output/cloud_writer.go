@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,7 +15,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/clock"
 	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
+	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
 )
 
 type CloudWriter struct {
@@ -22,8 +29,13 @@ type CloudWriter struct {
 	queue      []*queuedPayload
 	queueMu    sync.Mutex
 	maxQueue   int
+	backoff    retry.Backoff
 	stopChan   chan struct{}
 	wg         sync.WaitGroup
+	// schemaVersion is the telemetry schema version agreed with the API,
+	// 0 until its versions have been fetched
+	schemaVersion int
+	schemaMu      sync.Mutex
 }
 
 type queuedPayload struct {
@@ -50,19 +62,35 @@ func NewCloudWriter(cfg *config.AgentConfig) *CloudWriter {
 		client:   client,
 		queue:    make([]*queuedPayload, 0),
 		maxQueue: 100, // Max 100 items in queue
+		backoff:  retry.NewBackoff(cfg.RetryConfig, time.Second),
 		stopChan: make(chan struct{}),
 	}
 }
 
+// Write uploads a payload, queueing it for retry when the upload fails in a
+// way retrying may fix
 func (w *CloudWriter) Write(payload interface{}) error {
-	return w.sendPayload(payload)
+	err := w.sendPayload(payload)
+	if err != nil && !retry.IsPermanent(err) {
+		w.queuePayload(payload, err)
+	}
+	return err
 }
 
 func (w *CloudWriter) sendPayload(payload interface{}) error {
 	endpoint := fmt.Sprintf("%s/v1/agents/%s/inventory", w.config.APIEndpoint, w.config.DeviceID)
 
+	// Send the schema version the API accepts
+	if run, ok := payload.(*scheduler.TelemetryPayload); ok {
+		if v := w.negotiatedSchemaVersion(); v != run.SchemaVersion {
+			downgraded := *run
+			downgraded.SchemaVersion = v
+			payload = &downgraded
+		}
+	}
+
 	// Marshal payload
-	data, err := json.Marshal(payload)
+	data, contentType, err := encodePayload(payload, w.config.PayloadEncoding)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
@@ -86,20 +114,31 @@ func (w *CloudWriter) sendPayload(payload interface{}) error {
 	}
 
 	// Set headers
+	// Each upload carries a correlation ID the API logs and returns with
+	// its own request ID, so a failed upload logged here can be found in
+	// the API's logs
+	correlationID := uuid.NewString()
 	req.Header.Set("Authorization", "Bearer "+w.config.AuthToken)
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Correlation-ID", correlationID)
 	if len(data) > 1024 {
 		req.Header.Set("Content-Encoding", "gzip")
 	}
+	if w.config.TraceRequests {
+		req.Header.Set("traceparent", newTraceparent())
+	}
 
 	// Send request
+	sent := time.Now()
 	resp, err := w.client.Do(req)
 	if err != nil {
-		// Network error - queue for retry
-		w.queuePayload(payload)
-		return fmt.Errorf("network error: %w", err)
+		// Network error - worth retrying
+		return fmt.Errorf("network error (correlation %s): %w", correlationID, err)
 	}
 	defer resp.Body.Close()
+	clock.Observe(resp, sent)
+	trace := fmt.Sprintf("correlation %s, request %s", correlationID, resp.Header.Get("X-Request-ID"))
 
 	// Handle response
 	switch resp.StatusCode {
@@ -107,22 +146,110 @@ func (w *CloudWriter) sendPayload(payload interface{}) error {
 		// Success
 		return nil
 	case 401:
-		log.Printf("Authentication failed - token may be invalid")
-		return fmt.Errorf("authentication failed")
+		log.Printf("Authentication failed - token may be invalid (%s)", trace)
+		return retry.Permanent(fmt.Errorf("authentication failed (%s)", trace))
 	case 400:
 		// Bad request - don't retry
-		return fmt.Errorf("bad request")
+		return retry.Permanent(fmt.Errorf("bad request (%s)", trace))
 	case 403:
 		// Forbidden - don't retry
-		return fmt.Errorf("forbidden")
+		return retry.Permanent(fmt.Errorf("forbidden (%s)", trace))
+	default:
+		// Server errors and throttling are retried, after the Retry-After
+		// the API sent if any
+		return retry.ResponseError(resp, fmt.Errorf("server error: %d (%s)", resp.StatusCode, trace))
+	}
+}
+
+// negotiatedSchemaVersion returns the telemetry schema version to send: the
+// agent's own when the API accepts it, otherwise the newest one the API
+// lists below it. The API's versions are fetched once; until that succeeds,
+// or when the API predates schema versions, the agent's own is sent.
+func (w *CloudWriter) negotiatedSchemaVersion() int {
+	w.schemaMu.Lock()
+	defer w.schemaMu.Unlock()
+
+	if w.schemaVersion != 0 {
+		return w.schemaVersion
+	}
+
+	versions, err := w.fetchSchemaVersions()
+	if err != nil {
+		log.Printf("Failed to fetch telemetry schema versions, sending version %d: %v", scheduler.TelemetrySchemaVersion, err)
+		return scheduler.TelemetrySchemaVersion
+	}
+
+	w.schemaVersion = scheduler.TelemetrySchemaVersion
+	accepted := false
+	best := 0
+	for _, v := range versions {
+		if v == scheduler.TelemetrySchemaVersion {
+			accepted = true
+		}
+		if v < scheduler.TelemetrySchemaVersion && v > best {
+			best = v
+		}
+	}
+	if !accepted && best > 0 {
+		log.Printf("API doesn't accept telemetry schema version %d, sending version %d", scheduler.TelemetrySchemaVersion, best)
+		w.schemaVersion = best
+	}
+	return w.schemaVersion
+}
+
+// fetchSchemaVersions lists the telemetry schema versions the API accepts,
+// none when it predates them
+func (w *CloudWriter) fetchSchemaVersions() ([]int, error) {
+	req, err := http.NewRequest("GET", w.config.APIEndpoint+"/v1/schemas/telemetry", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+	case 404:
+		// The API predates schema versions and ignores them
+		return nil, nil
 	default:
-		// Server error - queue for retry
-		w.queuePayload(payload)
-		return fmt.Errorf("server error: %d", resp.StatusCode)
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Versions []int `json:"versions"`
+		} `json:"data"`
 	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Data.Versions, nil
+}
+
+// newTraceparent starts a sampled W3C trace for one upload so the API's
+// spans for it, from the request to the database write, share a trace
+func newTraceparent() string {
+	ids := make([]byte, 24)
+	rand.Read(ids)
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(ids[:16]), hex.EncodeToString(ids[16:]))
 }
 
-func (w *CloudWriter) queuePayload(payload interface{}) {
+// queuePayload queues a payload whose upload failed with err for retry
+func (w *CloudWriter) queuePayload(payload interface{}, err error) {
+	w.enqueue(&queuedPayload{
+		payload:     payload,
+		attempts:    0,
+		nextAttempt: time.Now().Add(w.backoff.Next(0, err)),
+	})
+}
+
+func (w *CloudWriter) enqueue(item *queuedPayload) {
 	w.queueMu.Lock()
 	defer w.queueMu.Unlock()
 
@@ -130,20 +257,28 @@ func (w *CloudWriter) queuePayload(payload interface{}) {
 		// Remove oldest item
 		w.queue = w.queue[1:]
 	}
+	w.queue = append(w.queue, item)
+}
 
-	w.queue = append(w.queue, &queuedPayload{
-		payload:     payload,
-		attempts:    0,
-		nextAttempt: time.Now().Add(w.calculateBackoff(0)),
-	})
+// Queued returns how many payloads are waiting to be retried
+func (w *CloudWriter) Queued() int {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	return len(w.queue)
 }
 
-func (w *CloudWriter) calculateBackoff(attempts int) time.Duration {
-	backoff := time.Duration(float64(time.Second) * float64(attempts+1) * w.config.RetryConfig.BackoffMultiplier)
-	if backoff > w.config.RetryConfig.MaxBackoff {
-		backoff = w.config.RetryConfig.MaxBackoff
-	}
-	return backoff
+// Reset drops the payloads waiting to be retried and the schema version
+// agreed with the API, which is asked again on the next upload
+func (w *CloudWriter) Reset() int {
+	w.queueMu.Lock()
+	dropped := len(w.queue)
+	w.queue = make([]*queuedPayload, 0)
+	w.queueMu.Unlock()
+
+	w.schemaMu.Lock()
+	w.schemaVersion = 0
+	w.schemaMu.Unlock()
+	return dropped
 }
 
 func (w *CloudWriter) Start(ctx context.Context) {
@@ -159,7 +294,9 @@ func (w *CloudWriter) Stop() {
 func (w *CloudWriter) retryLoop(ctx context.Context) {
 	defer w.wg.Done()
 
-	ticker := time.NewTicker(30 * time.Second)
+	// Often enough that short jittered delays aren't all rounded up to one
+	// tick
+	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	for {
@@ -175,30 +312,32 @@ func (w *CloudWriter) retryLoop(ctx context.Context) {
 }
 
 func (w *CloudWriter) processQueue() {
+	// Take the due payloads off the queue, so uploads don't hold the lock
 	w.queueMu.Lock()
-	defer w.queueMu.Unlock()
-
 	now := time.Now()
-	var remaining []*queuedPayload
-
+	var due, waiting []*queuedPayload
 	for _, item := range w.queue {
 		if item.nextAttempt.After(now) {
-			remaining = append(remaining, item)
-			continue
+			waiting = append(waiting, item)
+		} else {
+			due = append(due, item)
 		}
+	}
+	w.queue = waiting
+	w.queueMu.Unlock()
 
-		if item.attempts >= w.config.RetryConfig.MaxRetries {
-			log.Printf("Dropping payload after %d attempts", item.attempts)
+	for _, item := range due {
+		err := w.sendPayload(item.payload)
+		if err == nil {
 			continue
 		}
 
-		if err := w.sendPayload(item.payload); err != nil {
-			item.attempts++
-			item.nextAttempt = now.Add(w.calculateBackoff(item.attempts))
-			remaining = append(remaining, item)
+		item.attempts++
+		if retry.IsPermanent(err) || item.attempts >= w.config.RetryConfig.MaxRetries {
+			log.Printf("Dropping payload after %d attempts: %v", item.attempts, err)
+			continue
 		}
-		// Success - don't add to remaining
+		item.nextAttempt = time.Now().Add(w.backoff.Next(item.attempts, err))
+		w.enqueue(item)
 	}
-
-	w.queue = remaining
 }
\ No newline at end of file
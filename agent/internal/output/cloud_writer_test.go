@@ -0,0 +1,73 @@
+package output
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/fakeapi"
+	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+)
+
+func TestCloudWriterUploadsEachEncoding(t *testing.T) {
+	t.Setenv("AGENT_CONFIG_PATH", filepath.Join(t.TempDir(), "config.json"))
+	api := fakeapi.New()
+	defer api.Close()
+
+	for _, encoding := range []string{config.PayloadEncodingJSON, config.PayloadEncodingProtobuf, config.PayloadEncodingMsgpack} {
+		t.Run(encoding, func(t *testing.T) {
+			cfg := api.AgentConfig()
+			cfg.PayloadEncoding = encoding
+			sent := &scheduler.TelemetryPayload{
+				DeviceID:      cfg.DeviceID,
+				IngestionID:   uuid.NewString(),
+				AgentVersion:  "1.2.3",
+				CollectedAt:   time.Now().UTC().Truncate(time.Millisecond),
+				Metrics:       map[string]interface{}{"os.info": map[string]interface{}{"name": "Windows"}},
+				SchemaVersion: scheduler.TelemetrySchemaVersion,
+				Tags:          map[string]string{"site": "lab"},
+			}
+
+			if err := NewCloudWriter(cfg).Write(sent); err != nil {
+				t.Fatal(err)
+			}
+
+			var got *fakeapi.Upload
+			for _, u := range api.Uploads() {
+				if u.Payload.IngestionID == sent.IngestionID {
+					got = &u
+				}
+			}
+			switch {
+			case got == nil:
+				t.Fatalf("fake didn't receive payload %s", sent.IngestionID)
+			case got.DeviceID != cfg.DeviceID:
+				t.Errorf("uploaded to device %s, want %s", got.DeviceID, cfg.DeviceID)
+			case !got.Payload.CollectedAt.Equal(sent.CollectedAt):
+				t.Errorf("collected_at arrived as %v, sent %v", got.Payload.CollectedAt, sent.CollectedAt)
+			case got.Payload.Tags["site"] != "lab" || got.Payload.Metrics["os.info"] == nil:
+				t.Errorf("payload arrived as %+v, sent %+v", got.Payload, sent)
+			}
+		})
+	}
+}
+
+func TestCloudWriterQueuesRetryableFailure(t *testing.T) {
+	t.Setenv("AGENT_CONFIG_PATH", filepath.Join(t.TempDir(), "config.json"))
+	api := fakeapi.New()
+	defer api.Close()
+	api.Script(fakeapi.Inventory, fakeapi.RetryAfter(http.StatusServiceUnavailable, time.Second))
+
+	cfg := api.AgentConfig()
+	w := NewCloudWriter(cfg)
+	sent := &scheduler.TelemetryPayload{DeviceID: cfg.DeviceID, IngestionID: uuid.NewString(), CollectedAt: time.Now()}
+	if err := w.Write(sent); err == nil {
+		t.Fatal("upload answered 503 succeeded")
+	}
+	if n := w.Queued(); n != 1 {
+		t.Errorf("queue holds %d payloads after a 503, want 1", n)
+	}
+}
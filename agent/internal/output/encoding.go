@@ -0,0 +1,205 @@
+package output
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+	telemetryv1 "github.com/yourorg/inventory-agent/shared/proto/telemetry/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// encodePayload encodes a payload for upload in the configured encoding,
+// returning the body and its Content-Type. Only collection runs have a
+// binary encoding; anything else is sent as JSON.
+func encodePayload(payload interface{}, encoding string) ([]byte, string, error) {
+	run, ok := payload.(*scheduler.TelemetryPayload)
+	if !ok || encoding == "" || encoding == config.PayloadEncodingJSON {
+		data, err := json.Marshal(payload)
+		return data, "application/json", err
+	}
+
+	// Collectors report structs, which neither binary encoding knows how to
+	// write, so the metrics are first reduced to what their JSON would hold
+	metrics, err := plainValue(reflect.ValueOf(run.Metrics))
+	if err != nil {
+		return nil, "", err
+	}
+	fields, _ := metrics.(map[string]interface{})
+
+	switch encoding {
+	case config.PayloadEncodingProtobuf:
+		st, err := structpb.NewStruct(fields)
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := proto.Marshal(&telemetryv1.TelemetryPayload{
+			DeviceId:      run.DeviceID,
+			IngestionId:   run.IngestionID,
+			AgentVersion:  run.AgentVersion,
+			CollectedAt:   timestamppb.New(run.CollectedAt),
+			Metrics:       st,
+			Errors:        run.Errors,
+			SchemaVersion: uint32(run.SchemaVersion),
+			ClockSkewMs:   run.ClockSkewMs,
+			Tags:          run.Tags,
+		})
+		return data, "application/x-protobuf", err
+	case config.PayloadEncodingMsgpack:
+		plain := *run
+		plain.Metrics = fields
+		data, err := plain.MarshalMsg(nil)
+		return data, "application/msgpack", err
+	default:
+		return nil, "", fmt.Errorf("unknown payload encoding %q", encoding)
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// plainValue converts v to the maps, slices, strings, numbers and bools
+// encoding/json would write for it, honouring json field tags, so a value
+// encodes the same in every format
+func plainValue(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() || (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+
+	switch {
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case v.Type().Implements(jsonMarshalerType):
+		data, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		var plain interface{}
+		err = json.Unmarshal(data, &plain)
+		return plain, err
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return plainValue(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := plainValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		fields := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := plainValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			fields[fmt.Sprint(iter.Key().Interface())] = value
+		}
+		return fields, nil
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		if err := plainFields(v, fields); err != nil {
+			return nil, err
+		}
+		return fields, nil
+	default:
+		return nil, fmt.Errorf("unsupported metric value of type %s", v.Type())
+	}
+}
+
+// plainFields adds a struct's exported fields to fields under their JSON
+// names. Untagged embedded structs are flattened into their parent, as
+// encoding/json does.
+func plainFields(v reflect.Value, fields map[string]interface{}) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		value := v.Field(i)
+
+		if field.Anonymous && name == "" {
+			if value.Kind() == reflect.Pointer {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				if err := plainFields(value, fields); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(opts, "omitempty") && emptyValue(value) {
+			continue
+		}
+
+		plain, err := plainValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fields[name] = plain
+	}
+	return nil
+}
+
+// emptyValue reports whether omitempty drops v, by encoding/json's rules
+func emptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
@@ -3,12 +3,40 @@ package output
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
+// Local output modes
+const (
+	// LocalModeOverwrite replaces the file with the latest payload
+	LocalModeOverwrite = "overwrite"
+	// LocalModeNDJSON appends each payload as one line to a rotated file,
+	// for log shippers to tail
+	LocalModeNDJSON = "ndjson"
+)
+
+// Rotation bounds an NDJSON file. The file is renamed to path.1, shifting
+// older files up to path.MaxFiles and deleting the oldest, before a write
+// would take it over MaxSize or once its first line is older than MaxAge.
+// Zero limits don't rotate.
+type Rotation struct {
+	MaxSize  int64
+	MaxAge   time.Duration
+	MaxFiles int
+}
+
 type LocalWriter struct {
 	outputPath string
+	// rotation is set in NDJSON mode
+	rotation *Rotation
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	started  time.Time
 }
 
 func NewLocalWriter(outputPath string) *LocalWriter {
@@ -17,7 +45,20 @@ func NewLocalWriter(outputPath string) *LocalWriter {
 	}
 }
 
+// NewNDJSONWriter creates a local writer appending each payload as one line
+// to outputPath, rotated as given
+func NewNDJSONWriter(outputPath string, rotation Rotation) *LocalWriter {
+	return &LocalWriter{
+		outputPath: outputPath,
+		rotation:   &rotation,
+	}
+}
+
 func (w *LocalWriter) Write(payload interface{}) error {
+	if w.rotation != nil {
+		return w.appendLine(payload)
+	}
+
 	// Ensure directory exists
 	dir := filepath.Dir(w.outputPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -43,4 +84,127 @@ func (w *LocalWriter) Write(payload interface{}) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// appendLine writes payload as one line of the NDJSON file, rotating the
+// file first when the line would take it past its limits
+func (w *LocalWriter) appendLine(payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	data = append(data, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if w.size > 0 && w.needsRotation(int64(len(data))) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	// One write per line, so a reader tailing the file never sees part of
+	// a line followed by another
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to append payload: %w", err)
+	}
+	return nil
+}
+
+func (w *LocalWriter) needsRotation(next int64) bool {
+	if w.rotation.MaxSize > 0 && w.size+next > w.rotation.MaxSize {
+		return true
+	}
+	return w.rotation.MaxAge > 0 && time.Since(w.started) >= w.rotation.MaxAge
+}
+
+// open opens the NDJSON file for appending, carrying on with one a
+// previous run left
+func (w *LocalWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	f, err := os.OpenFile(w.outputPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat output file: %w", err)
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.started = time.Now()
+	if w.size > 0 {
+		w.started = firstCollectedAt(w.outputPath, info.ModTime())
+	}
+	return nil
+}
+
+// firstCollectedAt returns the collected_at of the first line of an NDJSON
+// file, which dates the file without relying on file system timestamps, or
+// fallback when it can't be read
+func firstCollectedAt(path string, fallback time.Time) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return fallback
+	}
+	defer f.Close()
+
+	var first struct {
+		CollectedAt time.Time `json:"collected_at"`
+	}
+	if err := json.NewDecoder(f).Decode(&first); err != nil || first.CollectedAt.IsZero() {
+		return fallback
+	}
+	return first.CollectedAt
+}
+
+// rotate shifts the NDJSON file and its predecessors up by one and starts
+// a new file
+func (w *LocalWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		log.Printf("Failed to close %s before rotating it: %v", w.outputPath, err)
+	}
+	w.file = nil
+
+	if w.rotation.MaxFiles > 0 {
+		os.Remove(rotatedPath(w.outputPath, w.rotation.MaxFiles))
+		for i := w.rotation.MaxFiles - 1; i >= 1; i-- {
+			if err := os.Rename(rotatedPath(w.outputPath, i), rotatedPath(w.outputPath, i+1)); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to rotate %s: %v", rotatedPath(w.outputPath, i), err)
+			}
+		}
+		if err := os.Rename(w.outputPath, rotatedPath(w.outputPath, 1)); err != nil {
+			return fmt.Errorf("failed to rotate output file: %w", err)
+		}
+	} else if err := os.Remove(w.outputPath); err != nil {
+		return fmt.Errorf("failed to rotate output file: %w", err)
+	}
+
+	return w.open()
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Stop closes the NDJSON file
+func (w *LocalWriter) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
@@ -0,0 +1,164 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/agent/internal/clock"
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
+	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+// Headers the API's telemetry writer reads from a report an agent published
+// directly
+const (
+	natsAgentHeader     = "Agent-Version"
+	natsClockSkewHeader = "Agent-Clock-Skew-Ms"
+)
+
+// DefaultNATSSubject is the subject the API's telemetry stream ingests
+const DefaultNATSSubject = "telemetry.ingest"
+
+// natsPublishTimeout bounds one publish, including its retries, and
+// natsAckWait each attempt's wait for the stream to store it
+const (
+	natsPublishTimeout = time.Minute
+	natsAckWait        = 10 * time.Second
+)
+
+// NATSOptions configures a nats output
+type NATSOptions struct {
+	// URL lists the NATS servers, comma separated
+	URL string `json:"url"`
+	// Credentials is a NATS credentials file, for servers requiring one
+	Credentials string `json:"credentials,omitempty"`
+	// Subject is the subject published to, DefaultNATSSubject when empty
+	Subject string `json:"subject,omitempty"`
+}
+
+// NATSWriter publishes telemetry straight to the API's JetStream telemetry
+// stream, in the form the API queues uploads in, for agents colocated with
+// the backend. The API's telemetry writer stores the reports without the
+// HTTP ingest hop, so they skip its schema checks and quotas; what a device
+// may publish is bounded by its NATS permissions.
+type NATSWriter struct {
+	config  *config.AgentConfig
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+	backoff retry.Backoff
+}
+
+// natsTelemetry is a report as the API queues it
+type natsTelemetry struct {
+	DeviceID         string                 `json:"device_id"`
+	CollectedAt      time.Time              `json:"collected_at"`
+	Metrics          map[string]interface{} `json:"metrics"`
+	Tags             map[string]string      `json:"tags"`
+	Seq              int64                  `json:"seq"`
+	ServerReceivedAt time.Time              `json:"server_received_at"`
+	IngestionID      string                 `json:"ingestion_id"`
+	Errors           map[string]string      `json:"errors,omitempty"`
+}
+
+// NewNATSWriter creates a writer publishing to the servers in opts. The
+// connection is made in the background and re-made whenever it drops, so
+// an unreachable server fails publishes rather than the agent's start.
+func NewNATSWriter(cfg *config.AgentConfig, opts NATSOptions) (*NATSWriter, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	if opts.Subject == "" {
+		opts.Subject = DefaultNATSSubject
+	}
+
+	natsOpts := []nats.Option{
+		nats.Name("inventory-agent " + cfg.DeviceID),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("NATS disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("NATS reconnected to %s", nc.ConnectedUrlRedacted())
+		}),
+	}
+	if opts.Credentials != "" {
+		natsOpts = append(natsOpts, nats.UserCredentials(opts.Credentials))
+	}
+
+	conn, err := nats.Connect(opts.URL, natsOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to initialize JetStream: %w", err)
+	}
+
+	return &NATSWriter{
+		config:  cfg,
+		conn:    conn,
+		js:      js,
+		subject: opts.Subject,
+		backoff: retry.NewBackoff(cfg.RetryConfig, time.Second),
+	}, nil
+}
+
+// Write publishes a collection run and waits for the stream to store it,
+// retrying for up to a minute. The ingestion ID is the message ID, so the
+// stream keeps a run published twice only once.
+func (w *NATSWriter) Write(payload interface{}) error {
+	run, ok := payload.(*scheduler.TelemetryPayload)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", payload)
+	}
+	if run.DeviceID == "" {
+		return fmt.Errorf("agent isn't registered")
+	}
+
+	data, err := json.Marshal(natsTelemetry{
+		DeviceID:         run.DeviceID,
+		CollectedAt:      run.CollectedAt,
+		Metrics:          run.Metrics,
+		Tags:             run.Tags,
+		ServerReceivedAt: clock.Now().UTC(),
+		IngestionID:      run.IngestionID,
+		Errors:           run.Errors,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	msg := nats.NewMsg(w.subject)
+	msg.Data = data
+	msg.Header.Set(natsAgentHeader, version.Version)
+	msg.Header.Set(natsClockSkewHeader, strconv.FormatInt(run.ClockSkewMs, 10))
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsPublishTimeout)
+	defer cancel()
+	return retry.Do(ctx, w.backoff, w.config.RetryConfig.MaxRetries, func(ctx context.Context) error {
+		_, err := w.js.PublishMsg(msg, nats.MsgId(run.IngestionID), nats.AckWait(natsAckWait))
+		if err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", w.subject, err)
+		}
+		return nil
+	})
+}
+
+// Stop flushes and closes the connection
+func (w *NATSWriter) Stop() {
+	if err := w.conn.Drain(); err != nil {
+		w.conn.Close()
+	}
+}
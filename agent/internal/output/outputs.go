@@ -0,0 +1,155 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+)
+
+// Factory creates a writer of one output type from the agent configuration
+// and the output's options
+type Factory func(cfg *config.AgentConfig, options json.RawMessage) (scheduler.Writer, error)
+
+// Starter is a writer with background work, started with the agent
+type Starter interface {
+	Start(ctx context.Context)
+}
+
+// Stopper is a writer holding resources, released when the agent stops
+type Stopper interface {
+	Stop()
+}
+
+var factories = map[string]Factory{
+	config.OutputLocal: newLocalOutput,
+	config.OutputCloud: newCloudOutput,
+	config.OutputNATS:  newNATSOutput,
+}
+
+// LocalOptions configures a local output
+type LocalOptions struct {
+	// Path is the file written, local_output_path when empty
+	Path string `json:"path,omitempty"`
+	// Mode is LocalModeOverwrite, the default, or LocalModeNDJSON
+	Mode string `json:"mode,omitempty"`
+	// The NDJSON file's rotation limits, 10 MB, none and 5 files when zero
+	MaxSizeMB   int `json:"max_size_mb,omitempty"`
+	MaxAgeHours int `json:"max_age_hours,omitempty"`
+	MaxFiles    int `json:"max_files,omitempty"`
+}
+
+// CloudOptions configures a cloud output
+type CloudOptions struct {
+	// MaxQueue bounds the payloads kept for retry, 100 when zero
+	MaxQueue int `json:"max_queue,omitempty"`
+}
+
+// NewWriters creates the enabled writers declared in cfg.Outputs, or the
+// default ones when none are: the local file, and uploads to the API when
+// an endpoint is configured. A cloud output is left out while there is no
+// endpoint.
+func NewWriters(cfg *config.AgentConfig) ([]scheduler.Writer, error) {
+	outputs := cfg.Outputs
+	if outputs == nil {
+		outputs = []config.OutputConfig{{Type: config.OutputLocal}, {Type: config.OutputCloud}}
+	}
+
+	var writers []scheduler.Writer
+	for i, o := range outputs {
+		if !o.IsEnabled() {
+			continue
+		}
+		factory, ok := factories[o.Type]
+		if !ok {
+			return nil, fmt.Errorf("outputs[%d]: unknown type %q", i, o.Type)
+		}
+		if o.Type == config.OutputCloud && cfg.APIEndpoint == "" {
+			if cfg.Outputs != nil {
+				log.Printf("Cloud output disabled: no API endpoint configured")
+			}
+			continue
+		}
+		w, err := factory(cfg, o.Options)
+		if err != nil {
+			return nil, fmt.Errorf("outputs[%d] (%s): %w", i, o.Type, err)
+		}
+		writers = append(writers, w)
+	}
+	return writers, nil
+}
+
+// decodeOptions reads options into v, rejecting fields it doesn't have so a
+// misspelt option isn't silently ignored
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
+}
+
+func newLocalOutput(cfg *config.AgentConfig, options json.RawMessage) (scheduler.Writer, error) {
+	var opts LocalOptions
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Path == "" {
+		opts.Path = cfg.LocalOutputPath
+	}
+	if opts.MaxSizeMB < 0 || opts.MaxAgeHours < 0 || opts.MaxFiles < 0 {
+		return nil, fmt.Errorf("rotation limits must not be negative")
+	}
+
+	switch opts.Mode {
+	case "", LocalModeOverwrite:
+		return NewLocalWriter(opts.Path), nil
+	case LocalModeNDJSON:
+		rotation := Rotation{
+			MaxSize:  10 << 20,
+			MaxAge:   time.Duration(opts.MaxAgeHours) * time.Hour,
+			MaxFiles: 5,
+		}
+		if opts.MaxSizeMB > 0 {
+			rotation.MaxSize = int64(opts.MaxSizeMB) << 20
+		}
+		if opts.MaxFiles > 0 {
+			rotation.MaxFiles = opts.MaxFiles
+		}
+		return NewNDJSONWriter(opts.Path, rotation), nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q", opts.Mode)
+	}
+}
+
+func newCloudOutput(cfg *config.AgentConfig, options json.RawMessage) (scheduler.Writer, error) {
+	var opts CloudOptions
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if opts.MaxQueue < 0 {
+		return nil, fmt.Errorf("max_queue must not be negative")
+	}
+	w := NewCloudWriter(cfg)
+	if opts.MaxQueue > 0 {
+		w.maxQueue = opts.MaxQueue
+	}
+	return w, nil
+}
+
+func newNATSOutput(cfg *config.AgentConfig, options json.RawMessage) (scheduler.Writer, error) {
+	var opts NATSOptions
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	return NewNATSWriter(cfg, opts)
+}
@@ -1,33 +1,30 @@
 package policy
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/yourorg/inventory-agent/agent/internal/clock"
+	"github.com/yourorg/inventory-agent/agent/internal/collectors"
 	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
 	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+	"github.com/yourorg/inventory-agent/shared/models"
 )
 
-type Policy struct {
-	Version        int                    `json:"version"`
-	Collect        CollectConfig          `json:"collect"`
-}
-
-type CollectConfig struct {
-	IntervalSeconds int                    `json:"interval_seconds"`
-	Metrics         map[string]MetricConfig `json:"metrics"`
-}
-
-type MetricConfig struct {
-	Enabled bool `json:"enabled"`
-}
+// Policy is the policy as the API serves it, shared with the API
+type Policy = models.Policy
 
 type PolicyManager struct {
 	config      *config.AgentConfig
@@ -62,19 +59,34 @@ func (pm *PolicyManager) Stop() {
 func (pm *PolicyManager) pollLoop(ctx context.Context) {
 	defer pm.wg.Done()
 
-	ticker := time.NewTicker(pm.pollInterval)
-	defer ticker.Stop()
+	// After failures polls back off from the usual interval, up to the
+	// configured maximum
+	backoff := retry.NewBackoff(pm.config.RetryConfig, pm.pollInterval)
+	failures := 0
+	var lastErr error
 
 	for {
+		delay := pm.pollInterval
+		if failures > 0 {
+			if delay = backoff.Next(failures, lastErr); delay < pm.pollInterval {
+				delay = pm.pollInterval
+			}
+		}
+
 		select {
 		case <-pm.stopChan:
 			return
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if err := pm.FetchPolicy(ctx); err != nil {
-				log.Printf("Policy fetch failed: %v", err)
-			}
+		case <-time.After(delay):
+		}
+
+		if err := pm.FetchPolicy(ctx); err != nil {
+			log.Printf("Policy fetch failed: %v", err)
+			failures++
+			lastErr = err
+		} else {
+			failures = 0
 		}
 	}
 }
@@ -92,16 +104,19 @@ func (pm *PolicyManager) FetchPolicy(ctx context.Context) error {
 	}
 
 	req.Header.Set("Authorization", "Bearer "+pm.config.AuthToken)
+	req.Header.Set("User-Agent", version.UserAgent())
 	if pm.etag != "" {
 		req.Header.Set("If-None-Match", pm.etag)
 	}
 
 	client := &http.Client{Timeout: 30 * time.Second}
+	sent := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	clock.Observe(resp, sent)
 
 	switch resp.StatusCode {
 	case 200:
@@ -128,43 +143,118 @@ func (pm *PolicyManager) FetchPolicy(ctx context.Context) error {
 		return nil
 
 	default:
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return retry.ResponseError(resp, fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
 }
 
+// ApplyPolicy applies a policy and reports the outcome of each setting to
+// the API, so admins can see whether the device converged on it
 func (pm *PolicyManager) ApplyPolicy(policy *Policy) error {
+	status, err := pm.apply(policy)
+	pm.reportStatus(status)
+	return err
+}
+
+func (pm *PolicyManager) apply(policy *Policy) (*models.PolicyStatus, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	status := &models.PolicyStatus{
+		Version:            policy.Version,
+		ETag:               pm.etag,
+		Settings:           make(map[string]models.SettingStatus),
+		UnsupportedMetrics: []string{},
+	}
+
 	// Update scheduler interval
-	if policy.Collect.IntervalSeconds > 0 {
-		interval := time.Duration(policy.Collect.IntervalSeconds) * time.Second
+	if policy.Config.IntervalSeconds > 0 {
+		interval := time.Duration(policy.Config.IntervalSeconds) * time.Second
 		pm.scheduler.UpdateInterval(interval)
 
 		// Update config
 		pm.config.CollectionInterval = interval
-		if err := pm.config.Save(); err != nil {
-			log.Printf("Failed to save updated config: %v", err)
-		}
+		status.Settings["interval_seconds"] = models.SettingStatus{Applied: true}
 	}
 
 	// Update collector enabled status
-	for metricName, metricConfig := range policy.Collect.Metrics {
-		if err := pm.scheduler.SetCollectorEnabled(metricName, metricConfig.Enabled); err != nil {
+	for metricName, metricConfig := range policy.Config.Metrics {
+		err := pm.scheduler.SetCollectorEnabled(metricName, metricConfig.Enabled)
+		if errors.Is(err, collectors.ErrCollectorNotFound) {
+			status.UnsupportedMetrics = append(status.UnsupportedMetrics, metricName)
+			continue
+		}
+		if err != nil {
 			log.Printf("Failed to set collector %s enabled=%v: %v", metricName, metricConfig.Enabled, err)
-		} else {
-			// Update config
-			if pm.config.EnabledMetrics == nil {
-				pm.config.EnabledMetrics = make(map[string]bool)
-			}
-			pm.config.EnabledMetrics[metricName] = metricConfig.Enabled
+			status.Settings["metrics."+metricName] = models.SettingStatus{Error: err.Error()}
+			continue
+		}
+		// Update config
+		if pm.config.EnabledMetrics == nil {
+			pm.config.EnabledMetrics = make(map[string]bool)
 		}
+		pm.config.EnabledMetrics[metricName] = metricConfig.Enabled
+		status.Settings["metrics."+metricName] = models.SettingStatus{Applied: true}
+	}
+	sort.Strings(status.UnsupportedMetrics)
+	if len(status.UnsupportedMetrics) > 0 {
+		log.Printf("Policy version %d configures metrics without a collector: %v", policy.Version, status.UnsupportedMetrics)
+	}
+
+	// Persisted so the allowlists hold across restarts before the next fetch
+	pm.config.AllowedCommands = policy.Config.AllowedCommands
+	if policy.Config.AllowedCommands != nil {
+		status.Settings["allowed_commands"] = models.SettingStatus{Applied: true}
+	}
+	pm.config.RestartableServices = policy.Config.RestartableServices
+	if len(policy.Config.RestartableServices) > 0 {
+		status.Settings["restartable_services"] = models.SettingStatus{Applied: true}
 	}
 
 	pm.currentPolicy = policy
 	log.Printf("Applied policy version %d", policy.Version)
 
-	return pm.config.Save()
+	err := pm.config.Save()
+	if err != nil {
+		status.Settings["config_save"] = models.SettingStatus{Error: err.Error()}
+	} else {
+		status.Settings["config_save"] = models.SettingStatus{Applied: true}
+	}
+	status.AppliedAt = clock.Now()
+	return status, err
+}
+
+// reportStatus sends the outcome of applying a policy to the API. The next
+// policy change reports again, so a failure is only logged.
+func (pm *PolicyManager) reportStatus(status *models.PolicyStatus) {
+	if pm.config.APIEndpoint == "" || pm.config.AuthToken == "" {
+		return
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/agents/%s/policy/status", pm.config.APIEndpoint, pm.config.DeviceID)
+	data, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("Failed to marshal policy status: %v", err)
+		return
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to create policy status request: %v", err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+pm.config.AuthToken)
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Policy status report failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 204 {
+		log.Printf("Policy status report returned status %d", resp.StatusCode)
+	}
 }
 
 func (pm *PolicyManager) GetCurrentPolicy() *Policy {
@@ -0,0 +1,10 @@
+// Package powershell runs PowerShell scripts the agent writes for work that
+// has to outlive it, such as uninstalling or upgrading its own service.
+package powershell
+
+import "strings"
+
+// Quote quotes s as a PowerShell literal string
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -12,7 +12,10 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/yourorg/inventory-agent/agent/internal/capability"
+	"github.com/yourorg/inventory-agent/agent/internal/clock"
 	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
 )
 
 type RegistrationRequest struct {
@@ -20,6 +23,9 @@ type RegistrationRequest struct {
 	Hostname    string                 `json:"hostname,omitempty"`
 	Capabilities []capability.Capability `json:"capabilities"`
 	AgentVersion string                 `json:"agent_version"`
+	AgentCommit  string                 `json:"agent_commit,omitempty"`
+	AgentBuildDate string               `json:"agent_build_date,omitempty"`
+	OrgID       int64                  `json:"org_id,omitempty"`
 }
 
 type RegistrationResponse struct {
@@ -57,39 +63,41 @@ func (r *Registrar) Register(ctx context.Context) error {
 		}
 	}
 
-	hostname := "unknown"
-	if h, err := os.Hostname(); err == nil {
-		hostname = h
+	// In a container the hostname is the pod's; NODE_NAME, set from the
+	// downward API, names the node it runs on
+	hostname := os.Getenv("NODE_NAME")
+	if hostname == "" {
+		hostname = "unknown"
+		if h, err := os.Hostname(); err == nil {
+			hostname = h
+		}
 	}
 
 	req := RegistrationRequest{
 		DeviceID:     r.config.DeviceID,
 		Hostname:     hostname,
 		Capabilities: capability.GetCapabilities(),
-		AgentVersion: "1.0.0",
+		AgentVersion: version.Version,
+		AgentCommit:  version.Commit,
+		AgentBuildDate: version.Date,
+		OrgID:        r.config.OrgID,
 	}
 
-	var lastErr error
-	for attempt := 0; attempt < r.maxRetries; attempt++ {
-		if err := r.attemptRegister(ctx, req); err != nil {
-			lastErr = err
-			log.Printf("Registration attempt %d failed: %v", attempt+1, err)
-
-			// Exponential backoff
-			backoff := time.Duration(attempt+1) * time.Second
-			select {
-			case <-time.After(backoff):
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-			continue
+	attempts := 0
+	err := retry.Do(ctx, retry.NewBackoff(r.config.RetryConfig, time.Second), r.maxRetries, func(ctx context.Context) error {
+		attempts++
+		err := r.attemptRegister(ctx, req)
+		if err != nil {
+			log.Printf("Registration attempt %d failed: %v", attempts, err)
 		}
-
-		log.Printf("Registration successful for device %s", r.config.DeviceID)
-		return nil
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("registration failed after %d attempts: %w", attempts, err)
 	}
 
-	return fmt.Errorf("registration failed after %d attempts: %w", r.maxRetries, lastErr)
+	log.Printf("Registration successful for device %s", r.config.DeviceID)
+	return nil
 }
 
 func (r *Registrar) attemptRegister(ctx context.Context, req RegistrationRequest) error {
@@ -106,12 +114,15 @@ func (r *Registrar) attemptRegister(ctx context.Context, req RegistrationRequest
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", version.UserAgent())
 
+	sent := time.Now()
 	resp, err := r.client.Do(httpReq)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	clock.Observe(resp, sent)
 
 	switch resp.StatusCode {
 	case 200, 201:
@@ -135,7 +146,7 @@ func (r *Registrar) attemptRegister(ctx context.Context, req RegistrationRequest
 		return r.reRegister(ctx, req)
 
 	default:
-		return fmt.Errorf("registration failed with status %d", resp.StatusCode)
+		return retry.ResponseError(resp, fmt.Errorf("registration failed with status %d", resp.StatusCode))
 	}
 }
 
@@ -147,5 +158,5 @@ func (r *Registrar) reRegister(ctx context.Context, req RegistrationRequest) err
 	}
 
 	// If no token, this is an error state
-	return fmt.Errorf("device appears registered but no auth token available")
+	return retry.Permanent(fmt.Errorf("device appears registered but no auth token available"))
 }
\ No newline at end of file
@@ -0,0 +1,173 @@
+// Package retry spaces out the agent's repeated attempts at a failing call
+// to the API: registration, uploads, policy polls and command polls. Delays
+// grow exponentially and are drawn at random up to that bound ("full
+// jitter"), so a fleet of agents that failed together doesn't retry in step.
+// A server's Retry-After is honored over the computed delay, errors that
+// retrying can't fix end the retries, and every wait ends early when the
+// context is cancelled.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+)
+
+// Backoff computes the delay before each retry
+type Backoff struct {
+	// Base bounds the delay before the first retry
+	Base time.Duration
+	// Max bounds every delay; zero leaves them unbounded
+	Max time.Duration
+	// Multiplier grows the bound with each retry; below 1 it is taken as 2
+	Multiplier float64
+}
+
+// NewBackoff returns the backoff the agent's retry_config describes,
+// starting from base
+func NewBackoff(cfg config.RetryConfig, base time.Duration) Backoff {
+	return Backoff{Base: base, Max: cfg.MaxBackoff, Multiplier: cfg.BackoffMultiplier}
+}
+
+// Delay returns a random delay before retry number attempt, counting from
+// 0, up to Base*Multiplier^attempt capped at Max
+func (b Backoff) Delay(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	bound := float64(b.Base) * math.Pow(multiplier, float64(attempt))
+	if b.Max > 0 && bound > float64(b.Max) {
+		bound = float64(b.Max)
+	}
+	if bound >= math.MaxInt64 {
+		bound = math.MaxInt64 - 1
+	}
+	if bound < 1 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// Next returns the delay before retry number attempt after err: the
+// jittered backoff, or the wait the server asked for when that is longer
+func (b Backoff) Next(attempt int, err error) time.Duration {
+	delay := b.Delay(attempt)
+	var retryAfter *RetryAfterError
+	if errors.As(err, &retryAfter) && retryAfter.After > delay {
+		delay = retryAfter.After
+	}
+	return delay
+}
+
+// Do runs op until it succeeds, returns a permanent error, has been tried
+// maxAttempts times (0 tries for as long as ctx lasts), or ctx is done. It
+// returns op's last error, or ctx's error when cancelled while waiting.
+func Do(ctx context.Context, b Backoff, maxAttempts int, op func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := op(ctx)
+		if err == nil || IsPermanent(err) {
+			return err
+		}
+		if maxAttempts > 0 && attempt+1 >= maxAttempts {
+			return err
+		}
+		if err := Wait(ctx, b.Next(attempt, err)); err != nil {
+			return err
+		}
+	}
+}
+
+// Wait sleeps for d, returning ctx's error if it is done first
+func Wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying won't fix, such as a rejected
+// request
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked
+// Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryAfterError is a failure after which the server asked for the next
+// attempt to wait at least After
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.After)
+}
+
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// ResponseError classifies a response the caller doesn't accept. 408, 429
+// and 5xx statuses are worth retrying, after the response's Retry-After if
+// it has one; any other status is permanent. err describes the failure.
+func ResponseError(resp *http.Response, err error) error {
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		if after := RetryAfter(resp); after > 0 {
+			return &RetryAfterError{Err: err, After: after}
+		}
+		return err
+	default:
+		return Permanent(err)
+	}
+}
+
+// RetryAfter reads a response's Retry-After header, given in seconds or as
+// an HTTP date, returning 0 when it is absent, malformed or past
+func RetryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
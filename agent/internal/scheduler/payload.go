@@ -0,0 +1,12 @@
+package scheduler
+
+import "github.com/yourorg/inventory-agent/shared/models"
+
+// TelemetrySchemaVersion is the telemetry schema version this agent's
+// payloads follow, shared/schemas/telemetry.v2.schema.json
+const TelemetrySchemaVersion = 2
+
+// TelemetryPayload is one collection run, shared with the API. Metrics must
+// hold only plain values (maps, slices, strings, numbers) to encode as
+// msgpack.
+type TelemetryPayload = models.TelemetryPayload
@@ -2,30 +2,45 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"log"
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/clock"
 	"github.com/yourorg/inventory-agent/agent/internal/collectors"
 	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/schemacheck"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
 )
 
-type TelemetryPayload struct {
-	DeviceID     string                 `json:"device_id"`
-	AgentVersion string                 `json:"agent_version"`
-	CollectedAt  time.Time              `json:"collected_at"`
-	Metrics      map[string]interface{} `json:"metrics"`
-}
-
 type Writer interface {
 	Write(payload interface{}) error
 }
 
+// Queuer is a writer that keeps payloads it failed to write for retry
+type Queuer interface {
+	Queued() int
+}
+
+// Resetter is a writer keeping state between payloads, such as payloads
+// held for retry, that a resync drops. Reset returns how many queued
+// payloads it dropped.
+type Resetter interface {
+	Reset() int
+}
+
 type Scheduler struct {
 	config      *config.AgentConfig
 	registry    *collectors.CollectorRegistry
 	writers     []Writer
+	// checker validates collector output when validate_metrics is set
+	checker     *schemacheck.Checker
+	// tagSource adds tags to the configured ones, such as a node's labels
+	tagSource   func(ctx context.Context) map[string]string
 	ticker      *time.Ticker
 	stopChan    chan struct{}
 	wg          sync.WaitGroup
@@ -41,18 +56,49 @@ func New(cfg *config.AgentConfig, writers []Writer) *Scheduler {
 	registry.Register(collectors.NewCPUCollector())
 	registry.Register(collectors.NewMemoryCollector())
 	registry.Register(collectors.NewDiskCollector())
+	registry.Register(collectors.NewWirelessCollector())
+	registry.Register(collectors.NewRuntimesCollector())
+	registry.Register(collectors.NewListenersCollector())
+	registry.Register(collectors.NewSessionsCollector())
+	for _, c := range collectors.PlatformCollectors() {
+		registry.Register(c)
+	}
 
 	// Apply initial configuration
 	for name, enabled := range cfg.EnabledMetrics {
 		registry.SetEnabled(name, enabled)
 	}
 
-	return &Scheduler{
+	s := &Scheduler{
 		config:   cfg,
 		registry: registry,
 		writers:  writers,
 		stopChan: make(chan struct{}),
 	}
+	if cfg.ValidateMetrics {
+		s.checker = schemacheck.New(cfg, TelemetrySchemaVersion)
+	}
+	return s
+}
+
+// SetTagSource sets a function whose tags are sent with every payload along
+// with the configured tags, which take precedence over them. Set it before
+// starting the scheduler.
+func (s *Scheduler) SetTagSource(source func(ctx context.Context) map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tagSource = source
+}
+
+// QueuedPayloads returns how many payloads the writers are holding for retry
+func (s *Scheduler) QueuedPayloads() int {
+	n := 0
+	for _, w := range s.writers {
+		if q, ok := w.(Queuer); ok {
+			n += q.Queued()
+		}
+	}
+	return n
 }
 
 func (s *Scheduler) Start(ctx context.Context) {
@@ -121,40 +167,149 @@ func (s *Scheduler) run(ctx context.Context) {
 }
 
 func (s *Scheduler) collectAndWrite(ctx context.Context) error {
+	payload, stats := s.collect(ctx)
+
+	// Write to all configured writers
+	for _, writer := range s.writers {
+		if err := writer.Write(payload); err != nil {
+			log.Printf("Writer failed: %v", err)
+			// Continue with other writers
+		}
+	}
+
+	log.Printf("Collection completed: %d metrics collected in %dms", len(payload.Metrics)-1, stats.DurationMs)
+	return nil
+}
+
+// Resync starts the agent's output over: it drops the payloads writers hold
+// for retry and what they and the schema checker learned from the API, then
+// collects and writes a complete inventory at once. It returns the payload
+// and how many queued payloads were dropped, and fails if a writer did.
+func (s *Scheduler) Resync(ctx context.Context) (*TelemetryPayload, int, error) {
+	dropped := 0
+	for _, w := range s.writers {
+		if r, ok := w.(Resetter); ok {
+			dropped += r.Reset()
+		}
+	}
+	if s.checker != nil {
+		s.checker.Reset()
+	}
+
+	payload, _ := s.collect(ctx)
+	var errs []error
+	for _, writer := range s.writers {
+		if err := writer.Write(payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	log.Printf("Resync completed: %d metrics collected, %d queued payloads dropped", len(payload.Metrics)-1, dropped)
+	return payload, dropped, errors.Join(errs...)
+}
+
+// collect runs the enabled collectors into a payload, returning it with the
+// run's stats
+func (s *Scheduler) collect(ctx context.Context) (*TelemetryPayload, *CollectionStats) {
 	enabledCollectors := s.registry.Enabled()
 
 	payload := &TelemetryPayload{
 		DeviceID:     s.config.DeviceID,
-		AgentVersion: "1.0.0", // TODO: inject from build
-		CollectedAt:  time.Now().UTC(),
+		IngestionID:  uuid.New().String(),
+		AgentVersion: version.Version,
+		SchemaVersion: TelemetrySchemaVersion,
+		// In the API's time, which it checks collected_at against
+		CollectedAt:  clock.Now().UTC(),
+		ClockSkewMs:  clock.Skew().Milliseconds(),
 		Metrics:      make(map[string]interface{}),
 	}
+	payload.Tags = s.tags(ctx)
 
 	// Collect from all enabled collectors
+	stats := newCollectionStats()
 	for _, collector := range enabledCollectors {
 		collectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 
+		started := time.Now()
 		result, err := collector.Collect(collectCtx)
+		elapsed := time.Since(started)
 		cancel()
 
 		if err != nil {
 			log.Printf("Collector %s failed: %v", collector.Name(), err)
+			if payload.Errors == nil {
+				payload.Errors = make(map[string]string)
+			}
+			payload.Errors[collector.Name()] = err.Error()
+			stats.record(collector.Name(), elapsed, nil, true)
+			continue
+		}
+
+		if problem := s.checkOutput(ctx, collector.Name(), result); problem != "" {
+			log.Printf("Collector %s produced %s", collector.Name(), problem)
+			if payload.Errors == nil {
+				payload.Errors = make(map[string]string)
+			}
+			payload.Errors[collector.Name()] = problem
+			stats.record(collector.Name(), elapsed, nil, true)
 			continue
 		}
 
 		payload.Metrics[collector.Name()] = result
+		stats.record(collector.Name(), elapsed, result, false)
 	}
+	payload.Metrics[CollectionStatsMetric] = stats
 
-	// Write to all configured writers
-	for _, writer := range s.writers {
-		if err := writer.Write(payload); err != nil {
-			log.Printf("Writer failed: %v", err)
-			// Continue with other writers
-		}
+	return payload, stats
+}
+
+// tags merges the tag source's tags with the configured ones, or returns nil
+// when there are none
+func (s *Scheduler) tags(ctx context.Context) map[string]string {
+	s.mu.RLock()
+	source := s.tagSource
+	s.mu.RUnlock()
+
+	var sourced map[string]string
+	if source != nil {
+		sourced = source(ctx)
+	}
+	if len(s.config.Tags) == 0 && len(sourced) == 0 {
+		return nil
 	}
 
-	log.Printf("Collection completed: %d metrics collected", len(payload.Metrics))
-	return nil
+	tags := make(map[string]string, len(s.config.Tags)+len(sourced))
+	for k, v := range sourced {
+		tags[k] = v
+	}
+	for k, v := range s.config.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// checkOutput checks a collector's output against its metric's schema when
+// validate_metrics is set, and describes what is wrong with it, or returns ""
+// when nothing is. Output that can't be checked is sent as it is.
+func (s *Scheduler) checkOutput(ctx context.Context, name string, output interface{}) string {
+	if s.checker == nil {
+		return ""
+	}
+
+	result, err := s.checker.Check(ctx, name, output)
+	if err != nil {
+		log.Printf("Failed to check collector %s output, sending it unchecked: %v", name, err)
+		return ""
+	}
+	if result == nil || result.Valid {
+		return ""
+	}
+
+	problems := make([]string, len(result.Errors))
+	for i, e := range result.Errors {
+		problems[i] = e.Field + ": " + e.Message
+	}
+	return "invalid output: " + strings.Join(problems, "; ")
 }
 
 func (s *Scheduler) SetCollectorEnabled(name string, enabled bool) error {
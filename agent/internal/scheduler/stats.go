@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"reflect"
+	"time"
+)
+
+// CollectionStatsMetric is the metric reporting how the agent's own
+// collection run went, so the server can spot devices where a collector is
+// slow or failing
+const CollectionStatsMetric = "agent.collection_stats"
+
+// CollectionStats reports a collection run
+type CollectionStats struct {
+	// DurationMs is the time the collectors took in all
+	DurationMs int64                     `json:"duration_ms"`
+	Collectors map[string]CollectorStats `json:"collectors"`
+}
+
+// CollectorStats reports one collector's part of a run
+type CollectorStats struct {
+	DurationMs int64 `json:"duration_ms"`
+	// Items is the number of entries a collector reporting a list
+	// returned, or 1 for any other result
+	Items int `json:"items"`
+	// Errors is 1 when the collector failed or its output was rejected
+	Errors int `json:"errors"`
+}
+
+func newCollectionStats() *CollectionStats {
+	return &CollectionStats{Collectors: make(map[string]CollectorStats)}
+}
+
+// record adds a collector's run that took d and returned result, or failed
+func (s *CollectionStats) record(name string, d time.Duration, result interface{}, failed bool) {
+	stats := CollectorStats{DurationMs: d.Milliseconds()}
+	if failed {
+		stats.Errors = 1
+	} else {
+		stats.Items = itemCount(result)
+	}
+	s.Collectors[name] = stats
+	s.DurationMs += stats.DurationMs
+}
+
+// itemCount counts the entries of a list or map result; anything else is
+// one item
+func itemCount(result interface{}) int {
+	v := reflect.ValueOf(result)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len()
+	default:
+		return 1
+	}
+}
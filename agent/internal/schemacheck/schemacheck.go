@@ -0,0 +1,138 @@
+// Package schemacheck checks collector output against the schema of its
+// metric before it is sent, so a collector producing malformed data is
+// caught on the device instead of being rejected by the API. Schemas come
+// from the API's schema registry, GET /v1/schemas/{metric}, or from the copy
+// of the shared schemas built into the agent when the API can't serve one.
+package schemacheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+	"github.com/yourorg/inventory-agent/shared/schemas"
+	"github.com/yourorg/inventory-agent/shared/validation"
+)
+
+// maxSchemaSize bounds a schema read from the API
+const maxSchemaSize = 1 << 20
+
+type Checker struct {
+	config    *config.AgentConfig
+	version   int
+	client    *http.Client
+	validator *validation.Validator
+	// loaded records, per metric, whether a schema describes it. A metric
+	// is only recorded once the API has answered for it, so a schema taken
+	// from the built-in copy while the API is unreachable is fetched again.
+	loaded map[string]bool
+	mu     sync.Mutex
+}
+
+// New creates a checker using the metric schemas of a telemetry schema
+// version
+func New(cfg *config.AgentConfig, schemaVersion int) *Checker {
+	return &Checker{
+		config:    cfg,
+		version:   schemaVersion,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		validator: validation.NewValidator(),
+		loaded:    make(map[string]bool),
+	}
+}
+
+// Check validates one collector's output against its metric's schema. It
+// returns nil when no schema describes the metric.
+func (c *Checker) Check(ctx context.Context, metric string, output interface{}) (*validation.ValidationResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	described, err := c.load(ctx, metric)
+	if err != nil || !described {
+		return nil, err
+	}
+	return c.validator.ValidateWithResult(metric, output)
+}
+
+// Reset forgets which metrics' schemas were loaded, so each is fetched from
+// the API again when next checked
+func (c *Checker) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = make(map[string]bool)
+}
+
+// load compiles the schema of a metric unless it is already known, and
+// reports whether there is one
+func (c *Checker) load(ctx context.Context, metric string) (bool, error) {
+	if described, ok := c.loaded[metric]; ok {
+		return described, nil
+	}
+
+	data, err := c.fetch(ctx, metric)
+	answered := err == nil
+	if err != nil {
+		log.Printf("Failed to fetch schema of %s, using the built-in one: %v", metric, err)
+	}
+
+	if data == nil {
+		data, err = schemas.MetricSchema(c.version, metric)
+		if errors.Is(err, schemas.ErrUnknownMetric) {
+			if answered {
+				c.loaded[metric] = false
+			}
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := c.validator.LoadSchemaFromBytes(metric, data); err != nil {
+		return false, err
+	}
+	if answered {
+		c.loaded[metric] = true
+	}
+	return true, nil
+}
+
+// fetch reads a metric's schema from the API's registry. It returns no
+// schema when the agent isn't configured for cloud mode or the API has none
+// for the metric, including an API that predates the registry.
+func (c *Checker) fetch(ctx context.Context, metric string) ([]byte, error) {
+	if c.config.APIEndpoint == "" {
+		return nil, nil
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/schemas/%s?version=%d", c.config.APIEndpoint, url.PathEscape(metric), c.version)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+	case 404:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxSchemaSize))
+}
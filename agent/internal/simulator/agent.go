@@ -0,0 +1,267 @@
+package simulator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/capability"
+	"github.com/yourorg/inventory-agent/agent/internal/retry"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+	"github.com/yourorg/inventory-agent/shared/models"
+)
+
+// Operations recorded in the statistics
+const (
+	opRegister = "register"
+	opUpload   = "upload"
+	opPolicy   = "policy"
+	opCommands = "commands"
+	opAck      = "ack"
+)
+
+const (
+	// commandWait is how long the API may hold a command poll, as the
+	// agent asks
+	commandWait = 25 * time.Second
+	// commandPollInterval paces command polls when the API doesn't hold
+	// them open
+	commandPollInterval = 60 * time.Second
+)
+
+// errStatus is a response with a status the agent doesn't accept
+type errStatus int
+
+func (e errStatus) Error() string { return fmt.Sprintf("unexpected status %d", int(e)) }
+
+// virtualAgent is one simulated device
+type virtualAgent struct {
+	fleet    *Fleet
+	deviceID string
+	token    string
+	etag     string
+
+	// mu guards the device, which uploads triggered by commands share with
+	// scheduled ones
+	mu     sync.Mutex
+	device *device
+}
+
+func (a *virtualAgent) run(ctx context.Context) {
+	backoff := retry.Backoff{Base: time.Second, Max: time.Minute}
+	if err := retry.Do(ctx, backoff, 0, a.register); err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	loops := []func(context.Context){a.uploadLoop}
+	if a.fleet.opts.PolicyInterval > 0 {
+		loops = append(loops, a.policyLoop)
+	}
+	if a.fleet.opts.PollCommands {
+		loops = append(loops, a.commandLoop)
+	}
+	for _, loop := range loops {
+		wg.Add(1)
+		go func(loop func(context.Context)) {
+			defer wg.Done()
+			loop(ctx)
+		}(loop)
+	}
+	wg.Wait()
+}
+
+func (a *virtualAgent) register(ctx context.Context) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"device_id":     a.deviceID,
+		"hostname":      a.device.hostname,
+		"capabilities":  capability.GetCapabilities(),
+		"agent_version": version.Version,
+	})
+
+	var resp struct {
+		AuthToken string `json:"auth_token"`
+	}
+	status, err := a.do(ctx, opRegister, "POST", "/v1/agents/register", "application/json", body, &resp)
+	if err != nil {
+		if status >= 400 && status < 500 && status != 408 && status != 429 {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+	if status != 200 && status != 201 {
+		return retry.Permanent(errStatus(status))
+	}
+	a.token = resp.AuthToken
+	a.fleet.stats.agentRegistered()
+	return nil
+}
+
+// uploadLoop uploads telemetry every interval, starting at a random point in
+// the first so the fleet's uploads are spread out
+func (a *virtualAgent) uploadLoop(ctx context.Context) {
+	interval := a.fleet.opts.Interval
+	a.mu.Lock()
+	delay := time.Duration(a.device.rng.Float64() * float64(interval))
+	a.mu.Unlock()
+
+	for sleep(ctx, delay) {
+		a.upload(ctx)
+
+		a.mu.Lock()
+		delay = time.Duration(float64(interval) * (0.9 + 0.2*a.device.rng.Float64()))
+		a.mu.Unlock()
+	}
+}
+
+func (a *virtualAgent) upload(ctx context.Context) {
+	a.mu.Lock()
+	payload := a.device.payload(a.deviceID, a.fleet.schemaVersion, a.fleet.opts.ErrorRate)
+	a.mu.Unlock()
+
+	data, contentType, err := encode(payload, a.fleet.opts.Encoding)
+	if err != nil {
+		a.fleet.stats.record(opUpload, 0, "encode: "+err.Error())
+		return
+	}
+	a.do(ctx, opUpload, "POST", "/v1/agents/"+a.deviceID+"/inventory", contentType, data, nil)
+}
+
+func (a *virtualAgent) policyLoop(ctx context.Context) {
+	for sleep(ctx, a.fleet.opts.PolicyInterval) {
+		var policy models.Policy
+		status, err := a.do(ctx, opPolicy, "GET", "/v1/agents/"+a.deviceID+"/policy", "", nil, &policy)
+		if err != nil || status != 200 {
+			continue
+		}
+
+		a.mu.Lock()
+		for metric, cfg := range policy.Config.Metrics {
+			a.device.enabled[metric] = cfg.Enabled
+		}
+		a.mu.Unlock()
+	}
+}
+
+// commandLoop polls for commands as the agent does: again at once while the
+// API holds polls open, otherwise after a pause
+func (a *virtualAgent) commandLoop(ctx context.Context) {
+	delay := time.Duration(0)
+	for sleep(ctx, delay) {
+		start := time.Now()
+		var commands []models.Command
+		_, err := a.do(ctx, opCommands, "GET", "/v1/agents/"+a.deviceID+"/commands?wait="+commandWait.String(), "", nil, &commands)
+
+		delay = 0
+		if err != nil || len(commands) == 0 && time.Since(start) < commandWait/2 {
+			delay = commandPollInterval
+		}
+		for _, cmd := range commands {
+			a.execute(ctx, cmd)
+		}
+	}
+}
+
+// execute runs collect.now by uploading at once, rejects other commands as
+// the agent does when it doesn't know them, and acks the command
+func (a *virtualAgent) execute(ctx context.Context, cmd models.Command) {
+	ack := map[string]interface{}{}
+	if cmd.Type == "collect.now" {
+		a.upload(ctx)
+		ack["result"] = map[string]interface{}{"status": "completed", "metrics": cmd.Parameters["metrics"]}
+	} else {
+		msg := fmt.Sprintf("unknown command type: %s", cmd.Type)
+		ack["result"] = map[string]interface{}{"error": msg}
+		ack["error"] = msg
+	}
+
+	body, _ := json.Marshal(ack)
+	a.do(ctx, opAck, "POST", fmt.Sprintf("/v1/agents/%s/commands/%s/ack", a.deviceID, cmd.CommandID), "application/json", body, nil)
+}
+
+// do sends a request, recording its latency and outcome under op. A 2xx or
+// 304 response is decoded into out when there is one. It returns the
+// response status, 0 when there was no response.
+func (a *virtualAgent) do(ctx context.Context, op, method, path, contentType string, body []byte, out interface{}) (int, error) {
+	var reader io.Reader
+	compressed := false
+	if body != nil {
+		reader = bytes.NewReader(body)
+		// Bodies over 1KB are compressed, as the agent does
+		if len(body) > 1024 {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(body)
+			gz.Close()
+			reader = &buf
+			compressed = true
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.fleet.opts.Endpoint+path, reader)
+	if err != nil {
+		a.fleet.stats.record(op, 0, err.Error())
+		return 0, err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("X-Correlation-ID", uuid.NewString())
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	if op == opPolicy && a.etag != "" {
+		req.Header.Set("If-None-Match", a.etag)
+	}
+
+	start := time.Now()
+	resp, err := a.fleet.client.Do(req)
+	if err != nil {
+		// Requests cut short by the end of the run aren't failures
+		if ctx.Err() == nil {
+			a.fleet.stats.record(op, time.Since(start), "network")
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err != nil {
+		if ctx.Err() == nil {
+			a.fleet.stats.record(op, latency, "network")
+		}
+		return resp.StatusCode, err
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode != 304 {
+		a.fleet.stats.record(op, latency, strconv.Itoa(resp.StatusCode))
+		return resp.StatusCode, errStatus(resp.StatusCode)
+	}
+
+	if op == opPolicy {
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			a.etag = etag
+		}
+	}
+	if out != nil && resp.StatusCode != 304 && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			a.fleet.stats.record(op, latency, "malformed response")
+			return resp.StatusCode, errors.New("malformed response")
+		}
+	}
+	a.fleet.stats.record(op, latency, "")
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,247 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+	"github.com/yourorg/inventory-agent/shared/models"
+	telemetryv1 "github.com/yourorg/inventory-agent/shared/proto/telemetry/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Hardware and software the simulated devices are drawn from
+var (
+	osVersions = []struct{ caption, version string }{
+		{"Microsoft Windows 11 Enterprise", "10.0.22631"},
+		{"Microsoft Windows 11 Pro", "10.0.22621"},
+		{"Microsoft Windows 10 Enterprise", "10.0.19045"},
+		{"Microsoft Windows 10 Pro", "10.0.19044"},
+	}
+	hardware = []struct{ make, model string }{
+		{"Dell Inc.", "Latitude 5440"},
+		{"Dell Inc.", "OptiPlex 7010"},
+		{"LENOVO", "ThinkPad T14 Gen 4"},
+		{"HP", "EliteBook 840 G10"},
+		{"Microsoft Corporation", "Surface Laptop 5"},
+	}
+	programs = []struct{ name, publisher string }{
+		{"Google Chrome", "Google LLC"},
+		{"Microsoft Edge", "Microsoft Corporation"},
+		{"Mozilla Firefox", "Mozilla"},
+		{"Microsoft 365 Apps for enterprise", "Microsoft Corporation"},
+		{"Microsoft Teams", "Microsoft Corporation"},
+		{"Zoom Workplace", "Zoom Video Communications, Inc."},
+		{"Slack", "Slack Technologies Inc."},
+		{"7-Zip", "Igor Pavlov"},
+		{"Notepad++", "Notepad++ Team"},
+		{"Adobe Acrobat Reader", "Adobe"},
+		{"Visual Studio Code", "Microsoft Corporation"},
+		{"Git", "The Git Development Community"},
+		{"Python 3.12", "Python Software Foundation"},
+		{"Node.js", "Node.js Foundation"},
+		{"Microsoft Visual C++ 2015-2022 Redistributable (x64)", "Microsoft Corporation"},
+		{"Microsoft .NET Runtime 8.0", "Microsoft Corporation"},
+		{"Java 8 Update 401", "Oracle Corporation"},
+		{"CrowdStrike Windows Sensor", "CrowdStrike, Inc."},
+		{"Cisco Secure Client", "Cisco Systems, Inc."},
+		{"VLC media player", "VideoLAN"},
+		{"WinSCP", "Martin Prikryl"},
+		{"PuTTY", "Simon Tatham"},
+		{"Docker Desktop", "Docker Inc."},
+		{"Microsoft OneDrive", "Microsoft Corporation"},
+		{"TeamViewer", "TeamViewer"},
+	}
+	users = []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi", "ivan", "judy"}
+)
+
+// failingMetrics are the collectors reported as failed in an upload with an
+// error
+var failingMetrics = []struct{ metric, err string }{
+	{"software.inventory", "WMI query timed out"},
+	{"disk.utilization", "access denied"},
+}
+
+// device is a simulated device's fixed identity and varying usage
+type device struct {
+	hostname   string
+	os         int
+	hardware   int
+	serial     string
+	lastUser   string
+	lastPatch  time.Time
+	memory     float64
+	disks      []disk
+	software   []map[string]interface{}
+	cpuPercent float64
+	memUsed    float64
+	enabled    map[string]bool
+	rng        *rand.Rand
+}
+
+type disk struct {
+	name  string
+	total float64
+	used  float64
+}
+
+func newDevice(hostname string, rng *rand.Rand, software int) *device {
+	d := &device{
+		hostname:   hostname,
+		os:         rng.Intn(len(osVersions)),
+		hardware:   rng.Intn(len(hardware)),
+		serial:     fmt.Sprintf("SIM%08X", rng.Uint32()),
+		lastUser:   users[rng.Intn(len(users))],
+		lastPatch:  time.Now().Add(-time.Duration(rng.Intn(45*24)) * time.Hour),
+		memory:     float64(int64(8<<30) << rng.Intn(3)),
+		cpuPercent: 5 + rng.Float64()*20,
+		enabled:    make(map[string]bool),
+		rng:        rng,
+	}
+	d.memUsed = d.memory * (0.3 + rng.Float64()*0.4)
+
+	d.disks = []disk{{name: "C:", total: float64(int64(256<<30) << rng.Intn(3))}}
+	if rng.Intn(4) == 0 {
+		d.disks = append(d.disks, disk{name: "D:", total: float64(int64(1) << 40)})
+	}
+	for i := range d.disks {
+		d.disks[i].used = d.disks[i].total * (0.2 + rng.Float64()*0.6)
+	}
+
+	for _, i := range rng.Perm(len(programs)) {
+		if len(d.software) == software {
+			break
+		}
+		p := programs[i]
+		d.software = append(d.software, map[string]interface{}{
+			"name":         p.name,
+			"version":      fmt.Sprintf("%d.%d.%d", 1+rng.Intn(120), rng.Intn(10), rng.Intn(10000)),
+			"publisher":    p.publisher,
+			"install_date": time.Now().AddDate(0, 0, -rng.Intn(700)).Format("20060102"),
+		})
+	}
+	// Catalog entries run out before large inventories do, so the rest are
+	// made-up line-of-business apps
+	for i := len(d.software); i < software; i++ {
+		d.software = append(d.software, map[string]interface{}{
+			"name":         fmt.Sprintf("Contoso Line of Business App %d", i),
+			"version":      fmt.Sprintf("%d.%d", 1+rng.Intn(9), rng.Intn(20)),
+			"publisher":    "Contoso Ltd.",
+			"install_date": time.Now().AddDate(0, 0, -rng.Intn(700)).Format("20060102"),
+		})
+	}
+	return d
+}
+
+// payload returns the device's next upload. Usage drifts between uploads;
+// with probability errorRate one collector is reported as failed.
+func (d *device) payload(deviceID string, schemaVersion int, errorRate float64) *models.TelemetryPayload {
+	d.cpuPercent = clamp(d.cpuPercent+(d.rng.Float64()-0.5)*20, 1, 100)
+	d.memUsed = clamp(d.memUsed+(d.rng.Float64()-0.5)*0.1*d.memory, 0.1*d.memory, d.memory)
+
+	osVersion, hw := osVersions[d.os], hardware[d.hardware]
+	metrics := map[string]interface{}{
+		"os.info": map[string]interface{}{
+			"caption":       osVersion.caption,
+			"version":       osVersion.version,
+			"make":          hw.make,
+			"model":         hw.model,
+			"serial":        d.serial,
+			"hostname":      d.hostname,
+			"domain":        "CORP",
+			"last_user":     d.lastUser,
+			"last_patch_at": d.lastPatch.UTC().Format(time.RFC3339),
+		},
+		"cpu.utilization": map[string]interface{}{"cpu_percent": d.cpuPercent},
+		"memory.usage":    map[string]interface{}{"used_bytes": d.memUsed, "total_bytes": d.memory},
+	}
+
+	disks := make([]interface{}, len(d.disks))
+	for i := range d.disks {
+		disk := &d.disks[i]
+		disk.used = clamp(disk.used+(d.rng.Float64()-0.4)*float64(1<<28), 0, disk.total)
+		disks[i] = map[string]interface{}{
+			"name":        disk.name,
+			"total_bytes": disk.total,
+			"used_bytes":  disk.used,
+			"free_bytes":  disk.total - disk.used,
+		}
+	}
+	metrics["disk.utilization"] = disks
+
+	software := make([]interface{}, len(d.software))
+	for i, p := range d.software {
+		software[i] = p
+	}
+	metrics["software.inventory"] = software
+
+	// os.info is always collected; the policy turns the others off
+	for metric := range metrics {
+		if enabled, ok := d.enabled[metric]; ok && !enabled && metric != "os.info" {
+			delete(metrics, metric)
+		}
+	}
+
+	var errs map[string]string
+	if d.rng.Float64() < errorRate {
+		failure := failingMetrics[d.rng.Intn(len(failingMetrics))]
+		if _, ok := metrics[failure.metric]; ok {
+			delete(metrics, failure.metric)
+			errs = map[string]string{failure.metric: failure.err}
+		}
+	}
+
+	return &models.TelemetryPayload{
+		DeviceID:      deviceID,
+		IngestionID:   uuid.NewString(),
+		AgentVersion:  version.Version,
+		CollectedAt:   time.Now().UTC(),
+		Metrics:       metrics,
+		Errors:        errs,
+		SchemaVersion: schemaVersion,
+	}
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// encode encodes a payload as the agent would in the given encoding,
+// returning the body and its Content-Type
+func encode(p *models.TelemetryPayload, encoding string) ([]byte, string, error) {
+	switch encoding {
+	case config.PayloadEncodingProtobuf:
+		st, err := structpb.NewStruct(p.Metrics)
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := proto.Marshal(&telemetryv1.TelemetryPayload{
+			DeviceId:      p.DeviceID,
+			IngestionId:   p.IngestionID,
+			AgentVersion:  p.AgentVersion,
+			CollectedAt:   timestamppb.New(p.CollectedAt),
+			Metrics:       st,
+			Errors:        p.Errors,
+			SchemaVersion: uint32(p.SchemaVersion),
+		})
+		return data, "application/x-protobuf", err
+	case config.PayloadEncodingMsgpack:
+		data, err := p.MarshalMsg(nil)
+		return data, "application/msgpack", err
+	default:
+		data, err := json.Marshal(p)
+		return data, "application/json", err
+	}
+}
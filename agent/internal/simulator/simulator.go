@@ -0,0 +1,165 @@
+// Package simulator emulates a fleet of agents against an API deployment to
+// find its capacity before real devices are onboarded. Each virtual agent
+// registers, uploads telemetry shaped like a Windows device's at a jittered
+// interval, fetches its policy and long-polls for commands, acking the ones
+// it receives, as the agent does. Every request's latency and outcome is
+// recorded per operation for the report.
+//
+// Virtual agents don't run the agent's collectors, so the simulator runs
+// anywhere, and device IDs are derived from the fleet name, so a rerun with
+// the same name re-registers the same devices instead of adding new ones.
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/shared/schemas"
+)
+
+// Options describes the fleet to simulate
+type Options struct {
+	// Endpoint is the API's base URL
+	Endpoint string
+	// Agents is the number of virtual agents
+	Agents int
+	// Name identifies the fleet; device IDs and hostnames derive from it
+	Name string
+	// Interval is the time between one agent's uploads, jittered by 10%.
+	// Policy intervals are not applied, so the load stays as configured.
+	Interval time.Duration
+	// Ramp spreads the agents' registrations over this long
+	Ramp time.Duration
+	// PolicyInterval is the time between one agent's policy fetches; zero
+	// doesn't fetch policies
+	PolicyInterval time.Duration
+	// PollCommands long-polls for commands and acks them
+	PollCommands bool
+	// Encoding is the payload encoding: json, protobuf or msgpack
+	Encoding string
+	// Software is the number of installed programs each device reports
+	Software int
+	// ErrorRate is the share of uploads reporting a failed collector
+	ErrorRate float64
+}
+
+// Fleet runs the virtual agents of a simulation
+type Fleet struct {
+	opts          Options
+	client        *http.Client
+	schemaVersion int
+	stats         *Stats
+	namespace     uuid.UUID
+}
+
+// New creates a fleet from opts
+func New(opts Options) (*Fleet, error) {
+	if opts.Agents <= 0 {
+		return nil, fmt.Errorf("at least one agent is required")
+	}
+	if opts.Interval <= 0 {
+		return nil, fmt.Errorf("upload interval must be positive")
+	}
+	switch opts.Encoding {
+	case "":
+		opts.Encoding = config.PayloadEncodingJSON
+	case config.PayloadEncodingJSON, config.PayloadEncodingProtobuf, config.PayloadEncodingMsgpack:
+	default:
+		return nil, fmt.Errorf("unknown payload encoding %q", opts.Encoding)
+	}
+
+	versions, err := schemas.Versions("telemetry")
+	if err != nil || len(versions) == 0 {
+		return nil, fmt.Errorf("failed to read telemetry schema versions: %v", err)
+	}
+
+	// One connection pool for the whole fleet, large enough that agents
+	// reuse connections rather than each dialing per request
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = opts.Agents
+	transport.MaxIdleConnsPerHost = opts.Agents
+
+	return &Fleet{
+		opts:          opts,
+		client:        &http.Client{Transport: transport, Timeout: 2 * commandWait},
+		schemaVersion: versions[len(versions)-1],
+		stats:         newStats(),
+		namespace:     uuid.NewSHA1(uuid.NameSpaceURL, []byte("inventory-agent-simulator/"+opts.Name)),
+	}, nil
+}
+
+// Stats returns the fleet's statistics, updated as it runs
+func (f *Fleet) Stats() *Stats {
+	return f.stats
+}
+
+// Run starts the agents and runs them until ctx is done, writing the report
+// to w every reportEvery (never when zero)
+func (f *Fleet) Run(ctx context.Context, w io.Writer, reportEvery time.Duration) {
+	log.Printf("Simulating %d agents against %s, uploading every %s", f.opts.Agents, f.opts.Endpoint, f.opts.Interval)
+
+	var wg sync.WaitGroup
+	for i := 0; i < f.opts.Agents; i++ {
+		a := f.newAgent(i)
+		start := time.Duration(0)
+		if f.opts.Ramp > 0 {
+			start = time.Duration(int64(f.opts.Ramp) * int64(i) / int64(f.opts.Agents))
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sleep(ctx, start) {
+				a.run(ctx)
+			}
+		}()
+	}
+
+	if reportEvery > 0 {
+		ticker := time.NewTicker(reportEvery)
+		defer ticker.Stop()
+	report:
+		for {
+			select {
+			case <-ctx.Done():
+				break report
+			case <-ticker.C:
+				f.stats.Report(w)
+			}
+		}
+	}
+
+	wg.Wait()
+}
+
+func (f *Fleet) newAgent(index int) *virtualAgent {
+	name := fmt.Sprintf("%s-%05d", f.opts.Name, index)
+	return &virtualAgent{
+		fleet:    f,
+		deviceID: uuid.NewSHA1(f.namespace, []byte(name)).String(),
+		device:   newDevice(name, rand.New(rand.NewSource(int64(index)+1)), f.opts.Software),
+	}
+}
+
+// sleep waits for d, reporting false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,151 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Latencies are counted in buckets growing by bucketGrowth from bucketMin,
+// so a long run at fleet scale takes constant memory and percentiles are
+// within 10% of the true value
+const (
+	bucketMin    = 100 * time.Microsecond
+	bucketGrowth = 1.1
+	bucketCount  = 160 // bucketMin*1.1^160 is over an hour
+)
+
+// Stats counts the requests of a simulation per operation
+type Stats struct {
+	mu         sync.Mutex
+	start      time.Time
+	registered int
+	ops        map[string]*opStats
+}
+
+type opStats struct {
+	requests int
+	failures map[string]int
+	buckets  [bucketCount + 1]int
+	total    time.Duration
+	max      time.Duration
+}
+
+func newStats() *Stats {
+	return &Stats{start: time.Now(), ops: make(map[string]*opStats)}
+}
+
+func (s *Stats) agentRegistered() {
+	s.mu.Lock()
+	s.registered++
+	s.mu.Unlock()
+}
+
+// record counts a request of op that took latency, failed for the given
+// reason unless it is empty
+func (s *Stats) record(op string, latency time.Duration, failure string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.ops[op]
+	if !ok {
+		o = &opStats{failures: make(map[string]int)}
+		s.ops[op] = o
+	}
+	o.requests++
+	if failure != "" {
+		o.failures[failure]++
+	}
+	o.buckets[bucket(latency)]++
+	o.total += latency
+	if latency > o.max {
+		o.max = latency
+	}
+}
+
+func bucket(latency time.Duration) int {
+	if latency <= bucketMin {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(latency)/float64(bucketMin)) / math.Log(bucketGrowth)))
+	if i > bucketCount {
+		return bucketCount
+	}
+	return i
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile latency, at most the largest latency seen
+func (o *opStats) percentile(p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(o.requests)))
+	seen := 0
+	for i, n := range o.buckets {
+		seen += n
+		if seen >= rank && n > 0 {
+			bound := time.Duration(float64(bucketMin) * math.Pow(bucketGrowth, float64(i)))
+			if bound > o.max {
+				return o.max
+			}
+			return bound
+		}
+	}
+	return o.max
+}
+
+// Report writes each operation's request rate, failures and latency
+// percentiles since the simulation started, then the failures by reason
+func (s *Stats) Report(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.start)
+	fmt.Fprintf(w, "\n%s elapsed, %d agents registered\n", elapsed.Round(time.Second), s.registered)
+
+	ops := make([]string, 0, len(s.ops))
+	for op := range s.ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "operation\trequests\treq/s\tfailed\tmean\tp50\tp95\tp99\tmax\t")
+	for _, op := range ops {
+		o := s.ops[op]
+		failed := 0
+		for _, n := range o.failures {
+			failed += n
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%s\t%s\t%s\t%s\t%s\t\n", op, o.requests,
+			float64(o.requests)/elapsed.Seconds(), failed,
+			round(o.total/time.Duration(o.requests)), round(o.percentile(50)),
+			round(o.percentile(95)), round(o.percentile(99)), round(o.max))
+	}
+	tw.Flush()
+
+	for _, op := range ops {
+		o := s.ops[op]
+		reasons := make([]string, 0, len(o.failures))
+		for reason := range o.failures {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			fmt.Fprintf(w, "  %s failed: %s x%d\n", op, reason, o.failures[reason])
+		}
+	}
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(100 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,10 @@
+package update
+
+import "fmt"
+
+// On Linux the agent runs as a container, upgraded by changing its image
+const supported = false
+
+func startInstaller(staged string) error {
+	return fmt.Errorf("not supported on Linux")
+}
@@ -0,0 +1,74 @@
+package update
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/powershell"
+)
+
+const supported = true
+
+// startInstaller starts a detached PowerShell process that installs the
+// release at staged and waits for the new agent to remove the state file.
+// An executable is copied over the agent's, which is put back if the new
+// one doesn't confirm; an MSI is installed with msiexec, and the service is
+// restarted if that fails, so the agent still running reports it.
+func startInstaller(staged string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the agent's executable: %w", err)
+	}
+	system32 := filepath.Join(os.Getenv("SystemRoot"), "System32")
+	service := powershell.Quote(config.ServiceName)
+
+	var script strings.Builder
+	fmt.Fprintf(&script, "$ErrorActionPreference = 'Stop'\n")
+	// Give the agent time to send the command's progress before it's stopped
+	fmt.Fprintf(&script, "Start-Sleep -Seconds 5\n")
+	fmt.Fprintf(&script, "function Wait-Confirmed {\n")
+	fmt.Fprintf(&script, "  $deadline = (Get-Date).AddSeconds(%d)\n", int(confirmTimeout.Seconds()))
+	fmt.Fprintf(&script, "  while ((Get-Date) -lt $deadline) {\n")
+	fmt.Fprintf(&script, "    if (-not (Test-Path -LiteralPath %s)) { return $true }\n", powershell.Quote(statePath()))
+	fmt.Fprintf(&script, "    Start-Sleep -Seconds 5\n")
+	fmt.Fprintf(&script, "  }\n")
+	fmt.Fprintf(&script, "  return $false\n")
+	fmt.Fprintf(&script, "}\n")
+
+	if strings.EqualFold(filepath.Ext(staged), ".msi") {
+		fmt.Fprintf(&script, "$ok = $false\n")
+		fmt.Fprintf(&script, "try {\n")
+		fmt.Fprintf(&script, "  $p = Start-Process -FilePath %s -ArgumentList '/i', %s, '/qn', '/norestart' -Wait -PassThru\n",
+			powershell.Quote(filepath.Join(system32, "msiexec.exe")), powershell.Quote(`"`+staged+`"`))
+		// 3010 and 1641 are success with a reboot required or started
+		fmt.Fprintf(&script, "  if (@(0, 3010, 1641) -contains $p.ExitCode) { $ok = Wait-Confirmed }\n")
+		fmt.Fprintf(&script, "} catch {}\n")
+		fmt.Fprintf(&script, "if (-not $ok) { Restart-Service -Name %s -Force -ErrorAction SilentlyContinue }\n", service)
+	} else {
+		previous := powershell.Quote(exe + ".previous")
+		fmt.Fprintf(&script, "$backedUp = $false\n")
+		fmt.Fprintf(&script, "$ok = $false\n")
+		fmt.Fprintf(&script, "try {\n")
+		fmt.Fprintf(&script, "  Remove-Item -LiteralPath %s -Force -ErrorAction SilentlyContinue\n", previous)
+		fmt.Fprintf(&script, "  Stop-Service -Name %s -Force\n", service)
+		fmt.Fprintf(&script, "  Copy-Item -LiteralPath %s -Destination %s -Force\n", powershell.Quote(exe), previous)
+		fmt.Fprintf(&script, "  $backedUp = $true\n")
+		fmt.Fprintf(&script, "  Copy-Item -LiteralPath %s -Destination %s -Force\n", powershell.Quote(staged), powershell.Quote(exe))
+		fmt.Fprintf(&script, "  Start-Service -Name %s\n", service)
+		fmt.Fprintf(&script, "  $ok = Wait-Confirmed\n")
+		fmt.Fprintf(&script, "} catch {}\n")
+		fmt.Fprintf(&script, "if (-not $ok) {\n")
+		fmt.Fprintf(&script, "  Stop-Service -Name %s -Force -ErrorAction SilentlyContinue\n", service)
+		fmt.Fprintf(&script, "  if ($backedUp) { Copy-Item -LiteralPath %s -Destination %s -Force -ErrorAction SilentlyContinue }\n", previous, powershell.Quote(exe))
+		fmt.Fprintf(&script, "  Start-Service -Name %s -ErrorAction SilentlyContinue\n", service)
+		fmt.Fprintf(&script, "} else {\n")
+		fmt.Fprintf(&script, "  Remove-Item -LiteralPath %s -Force -ErrorAction SilentlyContinue\n", previous)
+		fmt.Fprintf(&script, "}\n")
+	}
+	fmt.Fprintf(&script, "Remove-Item -LiteralPath %s -Recurse -Force -ErrorAction SilentlyContinue\n", powershell.Quote(stagingDir()))
+
+	return powershell.StartDetached(script.String())
+}
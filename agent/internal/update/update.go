@@ -0,0 +1,230 @@
+// Package update installs agent releases over the running agent. A release
+// is downloaded and checked against its manifest's SHA-256 here, then
+// handed to a separate process that stops the service, puts the release in
+// place and starts it again, putting the previous agent back if the new one
+// doesn't start. The state file records the upgrade across the restart, so
+// whichever agent comes up reports how it went.
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
+)
+
+const (
+	// maxReleaseBytes caps release downloads
+	maxReleaseBytes = 1 << 30
+
+	// downloadTimeout bounds a release download
+	downloadTimeout = 30 * time.Minute
+
+	// confirmTimeout is how long the new agent has to start and confirm
+	// the upgrade before the previous one is put back
+	confirmTimeout = 5 * time.Minute
+)
+
+// Stages an upgrade reports, as the API records a rollout's
+const (
+	StageDownloading = "downloading"
+	StageVerifying   = "verifying"
+	StageInstalled   = "installed"
+	StageFailed      = "failed"
+	StageRolledBack  = "rolled_back"
+)
+
+// Manifest describes a release to install, as the API serves it
+type Manifest struct {
+	RolloutID int64  `json:"rollout_id"`
+	ReleaseID int64  `json:"release_id"`
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	SizeBytes *int64 `json:"size_bytes,omitempty"`
+}
+
+// State records an upgrade in progress across the agent's restart
+type State struct {
+	CommandID       string    `json:"command_id"`
+	ReleaseID       int64     `json:"release_id"`
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previous_version"`
+	StartedAt       time.Time `json:"started_at"`
+}
+
+// Supported reports whether the agent can upgrade itself on this platform
+func Supported() bool {
+	return supported
+}
+
+// Dir is where the agent keeps its upgrade state and downloads, beside its
+// configuration
+func Dir() string {
+	return filepath.Dir(config.Path())
+}
+
+func statePath() string {
+	return filepath.Join(Dir(), "upgrade.json")
+}
+
+func stagingDir() string {
+	return filepath.Join(Dir(), "upgrade")
+}
+
+// LoadState returns the upgrade in progress, or nil when there is none
+func LoadState() (*State, error) {
+	data, err := os.ReadFile(statePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid upgrade state: %w", err)
+	}
+	return &s, nil
+}
+
+// ClearState removes the upgrade state. Removing it is also how the new
+// agent confirms it started, so the previous one isn't put back.
+func ClearState() error {
+	err := os.Remove(statePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func saveState(s *State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(), data, 0600)
+}
+
+// Download saves the release a manifest describes to the staging directory
+// and checks its size and SHA-256, returning its path. A release served by
+// the API is fetched with the agent's token.
+func Download(cfg *config.AgentConfig, m *Manifest) (string, error) {
+	u, err := url.Parse(m.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("invalid release url")
+	}
+
+	req, err := http.NewRequest("GET", m.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	if cfg.APIEndpoint != "" && strings.HasPrefix(m.URL, strings.TrimSuffix(cfg.APIEndpoint, "/")+"/") {
+		req.Header.Set("Authorization", "Bearer "+cfg.AuthToken)
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxReleaseBytes {
+		return "", fmt.Errorf("release is %d bytes, over the %d byte limit", resp.ContentLength, int64(maxReleaseBytes))
+	}
+
+	ext, err := artifactExt(u, resp.Header.Get("Content-Disposition"))
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.RemoveAll(stagingDir()); err != nil {
+		return "", fmt.Errorf("failed to clear staging directory: %w", err)
+	}
+	if err := os.MkdirAll(stagingDir(), 0700); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	dest := filepath.Join(stagingDir(), "inventory-agent-"+sanitize(m.Version)+ext)
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("failed to create release file: %w", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, maxReleaseBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	if size > maxReleaseBytes {
+		return "", fmt.Errorf("release is over the %d byte limit", int64(maxReleaseBytes))
+	}
+	if m.SizeBytes != nil && size != *m.SizeBytes {
+		return "", fmt.Errorf("release is %d bytes, not the %d the manifest gives", size, *m.SizeBytes)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(got, m.SHA256) {
+		return "", fmt.Errorf("release checksum mismatch: got sha256 %s", got)
+	}
+	return dest, nil
+}
+
+// Install hands the downloaded release at staged to a separate process that
+// installs it and restarts the agent, recording state for the agent that
+// starts afterwards to report. Once it returns, the agent is about to be
+// stopped.
+func Install(staged string, state *State) error {
+	if !supported {
+		return fmt.Errorf("self-update is not supported on this platform")
+	}
+	if err := saveState(state); err != nil {
+		return fmt.Errorf("failed to save upgrade state: %w", err)
+	}
+	if err := startInstaller(staged); err != nil {
+		ClearState()
+		return err
+	}
+	return nil
+}
+
+// artifactExt works out whether a release is an MSI or an executable, from
+// the file name the server gives or else the URL's
+func artifactExt(u *url.URL, disposition string) (string, error) {
+	name := path.Base(u.Path)
+	if _, params, err := mime.ParseMediaType(disposition); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".msi", ".exe":
+		return ext, nil
+	default:
+		return "", fmt.Errorf("release %q is not an .msi or .exe", name)
+	}
+}
+
+// sanitize keeps a version string usable in a file name
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, s)
+}
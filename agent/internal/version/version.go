@@ -0,0 +1,28 @@
+// Package version holds the agent's build metadata, set at link time:
+//
+//	go build -ldflags "-X github.com/yourorg/inventory-agent/agent/internal/version.Version=1.4.0 \
+//	  -X github.com/yourorg/inventory-agent/agent/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/yourorg/inventory-agent/agent/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// The Makefile and MSI build pass them. Plain go build leaves the defaults.
+package version
+
+var (
+	// Version is the release, e.g. "1.4.0"
+	Version = "dev"
+	// Commit is the git commit built from
+	Commit = "unknown"
+	// Date is when the binary was built, in RFC 3339
+	Date = "unknown"
+)
+
+// String describes the build, e.g. "1.4.0 (commit 3f0c2a1, built 2024-05-01T12:00:00Z)"
+func String() string {
+	return Version + " (commit " + Commit + ", built " + Date + ")"
+}
+
+// UserAgent is the User-Agent header the agent sends to the API, e.g.
+// "inventory-agent/1.4.0 (3f0c2a1)"
+func UserAgent() string {
+	return "inventory-agent/" + Version + " (" + Commit + ")"
+}
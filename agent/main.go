@@ -11,12 +11,15 @@ import (
 	"time"
 
 	"github.com/kardianos/service"
+	"github.com/yourorg/inventory-agent/agent/internal/bootstrap"
 	"github.com/yourorg/inventory-agent/agent/internal/command"
 	"github.com/yourorg/inventory-agent/agent/internal/config"
+	"github.com/yourorg/inventory-agent/agent/internal/kube"
 	"github.com/yourorg/inventory-agent/agent/internal/output"
 	"github.com/yourorg/inventory-agent/agent/internal/policy"
 	"github.com/yourorg/inventory-agent/agent/internal/registration"
 	"github.com/yourorg/inventory-agent/agent/internal/scheduler"
+	"github.com/yourorg/inventory-agent/agent/internal/version"
 )
 
 type agentService struct {
@@ -24,11 +27,12 @@ type agentService struct {
 	scheduler  *scheduler.Scheduler
 	policyMgr  *policy.PolicyManager
 	commandPoller *command.CommandPoller
+	writers     []scheduler.Writer
 	registrar  *registration.Registrar
 }
 
 func (a *agentService) Start(s service.Service) error {
-	log.Println("Starting Inventory Agent service")
+	log.Printf("Starting Inventory Agent service %s", version.String())
 
 	// Load configuration
 	cfg, err := config.Load()
@@ -40,6 +44,11 @@ func (a *agentService) Start(s service.Service) error {
 	// Initialize components
 	ctx := context.Background()
 
+	// Zero-touch bootstrap: find the API published for the device's domain
+	if err := bootstrap.Apply(ctx, a.config); err != nil {
+		log.Printf("Bootstrap discovery failed, continuing with local mode: %v", err)
+	}
+
 	// Registration (Phase 2)
 	a.registrar = registration.New(a.config)
 	if err := a.registrar.Register(ctx); err != nil {
@@ -47,18 +56,27 @@ func (a *agentService) Start(s service.Service) error {
 	}
 
 	// Initialize outputs
-	var writers []scheduler.Writer
-	localWriter := output.NewLocalWriter(a.config.LocalOutputPath)
-	writers = append(writers, localWriter)
-
-	if a.config.APIEndpoint != "" {
-		cloudWriter := output.NewCloudWriter(a.config)
-		writers = append(writers, cloudWriter)
+	writers, err := output.NewWriters(a.config)
+	if err != nil {
+		return fmt.Errorf("invalid outputs: %w", err)
 	}
+	if len(writers) == 0 {
+		log.Printf("No outputs enabled; collected inventory won't be written anywhere")
+	}
+	a.writers = writers
 
 	// Initialize scheduler
 	a.scheduler = scheduler.New(a.config, writers)
 
+	// On a Kubernetes node, tag payloads with the node's labels
+	if kube.InCluster() {
+		if labels, err := kube.NewInCluster(); err != nil {
+			log.Printf("Node labels unavailable, sending configured tags only: %v", err)
+		} else {
+			a.scheduler.SetTagSource(labels.Labels)
+		}
+	}
+
 	// Initialize policy manager (Phase 5)
 	a.policyMgr = policy.NewPolicyManager(a.config, a.scheduler)
 
@@ -69,6 +87,12 @@ func (a *agentService) Start(s service.Service) error {
 	go a.scheduler.Start(ctx)
 	go a.policyMgr.Start(ctx)
 	go a.commandPoller.Start(ctx)
+	for _, w := range a.writers {
+		// Writers with background work, such as retrying queued uploads
+		if r, ok := w.(output.Starter); ok {
+			r.Start(ctx)
+		}
+	}
 
 	log.Println("Inventory Agent started successfully")
 	return nil
@@ -90,6 +114,11 @@ func (a *agentService) Stop(s service.Service) error {
 	if a.scheduler != nil {
 		a.scheduler.Stop()
 	}
+	for _, w := range a.writers {
+		if r, ok := w.(output.Stopper); ok {
+			r.Stop()
+		}
+	}
 
 	// Wait for context cancellation
 	<-ctx.Done()
@@ -102,16 +131,29 @@ func main() {
 	svcFlag := flag.String("service", "", "Control the system service (install, uninstall, start, stop)")
 	configFlag := flag.String("config", "", "Path to configuration file")
 	versionFlag := flag.Bool("version", false, "Show version information")
+	containerFlag := flag.Bool("container", false, "Run in the foreground as a container, without the system service (or set AGENT_CONTAINER=true)")
 	flag.Parse()
 
 	if *versionFlag {
-		fmt.Printf("Inventory Agent v1.0.0\nBuild: %s\n", "development")
+		fmt.Printf("Inventory Agent %s\nCommit: %s\nBuilt: %s\n", version.Version, version.Commit, version.Date)
 		os.Exit(0)
 	}
 
+	// Override config path if specified
+	if *configFlag != "" {
+		os.Setenv("AGENT_CONFIG_PATH", *configFlag)
+	}
+
+	// A container has no service manager; its runtime starts and stops the
+	// agent with signals
+	if *containerFlag || os.Getenv("AGENT_CONTAINER") == "true" {
+		runContainer(&agentService{})
+		return
+	}
+
 	// Service configuration
 	svcConfig := &service.Config{
-		Name:        "InventoryAgent",
+		Name:        config.ServiceName,
 		DisplayName: "Inventory Agent",
 		Description: "Collects system inventory and telemetry data",
 	}
@@ -155,11 +197,6 @@ func main() {
 		return
 	}
 
-	// Override config path if specified
-	if *configFlag != "" {
-		os.Setenv("AGENT_CONFIG_PATH", *configFlag)
-	}
-
 	// Run as service or interactively
 	if service.Interactive() {
 		// Interactive mode - handle signals
@@ -180,4 +217,17 @@ func main() {
 			log.Fatalf("Service failed: %v", err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// runContainer runs the agent until it is sent SIGINT or SIGTERM
+func runContainer(agentSvc *agentService) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	if err := agentSvc.Start(nil); err != nil {
+		log.Fatalf("Agent failed: %v", err)
+	}
+
+	<-sigChan
+	agentSvc.Stop(nil)
+}
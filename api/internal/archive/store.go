@@ -0,0 +1,80 @@
+// Package archive writes aged telemetry to S3-compatible object storage,
+// which keeps it for as long as retention rules require once Postgres no
+// longer does.
+package archive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// partSize is the multipart upload part size. Archives are streamed, so
+// their size isn't known up front; this bounds memory per upload and allows
+// archives of up to 10,000 parts.
+const partSize = 64 << 20
+
+// Config locates the archive bucket. Endpoint is a host[:port] such as
+// s3.amazonaws.com or a MinIO server.
+type Config struct {
+	Endpoint  string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	// Prefix is prepended to every object key
+	Prefix string
+	UseSSL bool
+}
+
+// Store puts archive objects into a bucket
+type Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewStore connects to the configured bucket, or returns nil when no
+// endpoint is configured
+func NewStore(cfg Config) (*Store, error) {
+	if cfg.Endpoint == "" {
+		return nil, nil
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("archive bucket is required")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+// Bucket is the bucket objects are put into
+func (s *Store) Bucket() string {
+	return s.bucket
+}
+
+// Key returns the full object key of name, including the prefix
+func (s *Store) Key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+// Put uploads r as the object key, reading it to the end
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    partSize,
+	})
+	return err
+}
@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+)
+
+// maxRecordedBody bounds the request bodies copied into the audit log.
+// Larger bodies are recorded by size only.
+const maxRecordedBody = 64 << 10
+
+// resourceTypes maps the first one or two segments of an admin route to the
+// resource type used in the audit log, matching what handlers already write
+var resourceTypes = map[string]string{
+	"devices/import":     "expected_device",
+	"devices/expected":   "expected_device",
+	"devices":            "agent",
+	"policies":           "policy",
+	"commands/batches":   "command_batch",
+	"commands/schedules": "command_schedule",
+	"commands":           "command",
+	"groups":             "group",
+	"filters":            "saved_filter",
+	"custom-fields":      "custom_field",
+	"licenses":           "license",
+	"exports":            "export",
+	"webhooks":           "webhook",
+	"alert-rules":        "alert_rule",
+	"alerts":             "alert",
+	"orgs":               "org",
+	"releases":           "release",
+	"rollouts":           "rollout",
+}
+
+// readOnlyRoutes are POST routes that don't change anything
+var readOnlyRoutes = map[string]bool{
+	"/v1/graphql": true,
+}
+
+// sensitiveKeys are redacted from recorded request bodies
+var sensitiveKeys = []string{"secret", "token", "password"}
+
+// Middleware writes an audit_log row for every mutating request that reaches
+// it, whether or not the handler succeeds: the actor, method, route, target
+// resource, response status and the request body, which for updates is the
+// set of changes asked for. It must run after admin authentication.
+func Middleware(db *pgxpool.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		handlerErr := c.Next()
+
+		// Requests that matched no admin route have nothing to audit
+		route := c.Route().Path
+		if !strings.HasPrefix(route, "/v1/") || readOnlyRoutes[route] {
+			return handlerErr
+		}
+
+		// An error returned by the handler is turned into a response by the
+		// app's error handler after this runs, so take its status instead
+		status := c.Response().StatusCode()
+		if handlerErr != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := handlerErr.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		actor, _ := c.Locals("admin_user").(string)
+		resourceType, resourceID := resource(c, route)
+
+		details := map[string]interface{}{
+			"method": c.Method(),
+			"route":  route,
+			"path":   c.Path(),
+			"status": status,
+		}
+		if q := string(c.Request().URI().QueryString()); q != "" {
+			details["query"] = q
+		}
+		recordBody(details, c.Body())
+
+		err := Record(c.UserContext(), db, actor, c.Method()+" "+route, resourceType, resourceID, details)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to audit request", "method", c.Method(), "path", c.Path(), "error", err)
+		}
+
+		return handlerErr
+	}
+}
+
+// resource derives the audited resource from the route: its leading
+// segments after /v1 give the type and its :id (or :key) parameter the ID
+func resource(c *fiber.Ctx, route string) (string, string) {
+	segments := strings.SplitN(strings.TrimPrefix(route, "/v1/"), "/", 3)
+
+	resourceType := segments[0]
+	if t, ok := resourceTypes[segments[0]]; ok {
+		resourceType = t
+	}
+	if len(segments) > 1 {
+		if t, ok := resourceTypes[segments[0]+"/"+segments[1]]; ok {
+			resourceType = t
+		}
+	}
+
+	resourceID := c.Params("id")
+	if resourceID == "" {
+		resourceID = c.Params("key")
+	}
+	return resourceType, resourceID
+}
+
+// recordBody adds the request body to details as JSON with sensitive fields
+// redacted, or only its size if it is large or not JSON
+func recordBody(details map[string]interface{}, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	var parsed interface{}
+	if len(body) > maxRecordedBody || json.Unmarshal(body, &parsed) != nil {
+		details["body_bytes"] = len(body)
+		return
+	}
+
+	details["changes"] = redact(parsed)
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isSensitive(key) {
+				v[key] = "[redacted]"
+			} else {
+				v[key] = redact(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redact(value)
+		}
+	}
+	return v
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
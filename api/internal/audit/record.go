@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/yourorg/inventory-agent/api/internal/requestid"
+)
+
+// Execer runs a statement on a pool or in a transaction
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// Record writes an audit_log row tagged with the request and correlation IDs
+// ctx carries, which are left NULL for work no request started
+func Record(ctx context.Context, db Execer, actor, action, resourceType, resourceID string, details interface{}) error {
+	requestID, correlationID := requestid.FromContext(ctx)
+	_, err := db.Exec(ctx, `
+		INSERT INTO audit_log (actor, action, resource_type, resource_id, details, request_id, correlation_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''), NULLIF($7, ''))`,
+		actor, action, resourceType, resourceID, details, requestID, correlationID)
+	return err
+}
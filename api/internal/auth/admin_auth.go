@@ -4,12 +4,24 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
 )
 
-func AdminAuthMiddleware() fiber.Handler {
+// UnidentifiedAdmin is the admin user recorded for a token that doesn't
+// identify its admin
+const UnidentifiedAdmin = "admin"
+
+// AdminAuthMiddleware authenticates admin requests. A token in tokens, which
+// maps tokens to the admins they belong to, identifies its admin; any other
+// accepted token is recorded as UnidentifiedAdmin and can't review commands.
+func AdminAuthMiddleware(tokens map[string]string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Extract Bearer token
+		// Extract Bearer token. Browsers can't set headers on a WebSocket
+		// handshake, so those may pass the token as ?access_token= instead.
 		auth := c.Get("Authorization")
+		if auth == "" && c.Get(fiber.HeaderUpgrade) == "websocket" && c.Query("access_token") != "" {
+			auth = "Bearer " + c.Query("access_token")
+		}
 		if auth == "" {
 			return c.Status(401).JSON(fiber.Map{"error": "Authorization header required"})
 		}
@@ -24,11 +36,19 @@ func AdminAuthMiddleware() fiber.Handler {
 			return c.Status(401).JSON(fiber.Map{"error": "Token cannot be empty"})
 		}
 
+		if user, ok := tokens[token]; ok {
+			c.Locals("admin_user", user)
+			c.Locals("admin_identified", true)
+			c.SetUserContext(logging.With(c.UserContext(), "admin_user", user))
+			return c.Next()
+		}
+
 		// TODO: Implement proper admin JWT validation
 		// For now, accept any token (implement proper validation later)
 		if token == "admin-token" || len(token) > 10 {
-			// Set admin user in context
-			c.Locals("admin_user", "admin")
+			user := UnidentifiedAdmin
+			c.Locals("admin_user", user)
+			c.SetUserContext(logging.With(c.UserContext(), "admin_user", user))
 			return c.Next()
 		}
 
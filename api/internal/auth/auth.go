@@ -1,11 +1,14 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
 	"github.com/yourorg/inventory-agent/api/internal/models"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -39,31 +42,51 @@ func AuthMiddleware(db *pgxpool.Pool) fiber.Handler {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
 		}
 
-		// Query agent
-		var agent models.Agent
-		err = db.QueryRow(c.Context(),
-			"SELECT device_id, org_id, hostname, status, capabilities, auth_token_hash FROM agents WHERE device_id = $1",
-			deviceID).Scan(&agent.DeviceID, &agent.OrgID, &agent.Hostname, &agent.Status,
-			&agent.Capabilities, &agent.AuthTokenHash)
+		agent, err := AuthenticateDevice(c.UserContext(), db, deviceID, token)
+		if errors.Is(err, ErrDeviceInactive) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
 		if err != nil {
-			return c.Status(401).JSON(fiber.Map{"error": "Device not found"})
+			return c.Status(401).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		// Verify token
-		if err := bcrypt.CompareHashAndPassword([]byte(agent.AuthTokenHash), []byte(token)); err != nil {
-			return c.Status(401).JSON(fiber.Map{"error": "Invalid token"})
-		}
+		// Store agent in context, and name it in the request's logs
+		c.Locals("agent", agent)
+		c.SetUserContext(logging.With(c.UserContext(), "device_id", agent.DeviceID.String()))
 
-		// Check if agent is active
-		if agent.Status != "active" {
-			return c.Status(403).JSON(fiber.Map{"error": "Device is not active"})
-		}
+		return c.Next()
+	}
+}
 
-		// Store agent in context
-		c.Locals("agent", &agent)
+// Reasons a device fails to authenticate
+var (
+	ErrDeviceNotFound = errors.New("Device not found")
+	ErrInvalidToken   = errors.New("Invalid token")
+	ErrDeviceInactive = errors.New("Device is not active")
+)
 
-		return c.Next()
+// AuthenticateDevice checks a device's auth token and that the device may
+// still call the agent API, returning the device
+func AuthenticateDevice(ctx context.Context, db *pgxpool.Pool, deviceID uuid.UUID, token string) (*models.Agent, error) {
+	var agent models.Agent
+	err := db.QueryRow(ctx,
+		"SELECT device_id, org_id, hostname, status, capabilities, auth_token_hash FROM agents WHERE device_id = $1",
+		deviceID).Scan(&agent.DeviceID, &agent.OrgID, &agent.Hostname, &agent.Status,
+		&agent.Capabilities, &agent.AuthTokenHash)
+	if err != nil {
+		return nil, ErrDeviceNotFound
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(agent.AuthTokenHash), []byte(token)); err != nil {
+		return nil, ErrInvalidToken
 	}
+
+	// Offline and inactive only reflect missed check-ins
+	if agent.Status != "active" && agent.Status != "offline" && agent.Status != "inactive" {
+		return nil, ErrDeviceInactive
+	}
+
+	return &agent, nil
 }
 
 func GetAgentFromContext(c *fiber.Ctx) (*models.Agent, error) {
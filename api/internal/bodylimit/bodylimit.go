@@ -0,0 +1,85 @@
+// Package bodylimit caps request bodies route by route. The server streams
+// request bodies instead of buffering them, so a body is only read once a
+// handler asks for it; Middleware refuses one over its route's limit before
+// that, from its Content-Length, and reads a chunked one only up to the
+// limit. Only the few routes that take large bodies, such as release
+// uploads, are given more than the default.
+package bodylimit
+
+import (
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Route sets the limit of one route, or leaves it unlimited when Limit is
+// 0. Path segments starting with ':' match any segment, as in the router.
+type Route struct {
+	Method string
+	Path   string
+	Limit  int
+}
+
+func (r Route) matches(method, path string) bool {
+	if r.Method != method {
+		return false
+	}
+	want := strings.Split(strings.Trim(r.Path, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i, segment := range want {
+		if !strings.HasPrefix(segment, ":") && segment != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware answers 413 to a request whose body is over limit, or over
+// the limit of the route it matches in routes
+func Middleware(limit int, routes ...Route) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		max := limit
+		for _, r := range routes {
+			if r.matches(c.Method(), c.Path()) {
+				max = r.Limit
+				break
+			}
+		}
+
+		if max <= 0 {
+			return c.Next()
+		}
+
+		length := c.Request().Header.ContentLength()
+		if length > max {
+			return tooLarge(c)
+		}
+
+		// A body of known length can't be read past it, but a chunked one
+		// has to be read here to know its size
+		stream := c.Context().RequestBodyStream()
+		if length < 0 && stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(max)+1))
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "Failed to read request body"})
+			}
+			if len(body) > max {
+				return tooLarge(c)
+			}
+			c.Request().SetBody(body)
+		}
+
+		return c.Next()
+	}
+}
+
+// tooLarge also closes the connection, as the rest of the body is left
+// unread on it
+func tooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(413).JSON(fiber.Map{"error": "Request body too large"})
+}
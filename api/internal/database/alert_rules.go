@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// alertRuleMatchSQL renders a query returning (device_id, value) for every
+// device the rule currently matches. Bind values are appended to args, which
+// must already hold the rule ID as $1.
+func alertRuleMatchSQL(r *models.AlertRule, deviceID *uuid.UUID, args []interface{}) (string, []interface{}) {
+	scope := ` AND a.status <> 'retired'`
+	if r.GroupID != nil {
+		args = append(args, *r.GroupID)
+		scope += ` AND a.device_id IN (SELECT device_id FROM device_group_members WHERE group_id = $` + strconv.Itoa(len(args)) + `)`
+	}
+	if deviceID != nil {
+		args = append(args, *deviceID)
+		scope += ` AND a.device_id = $` + strconv.Itoa(len(args))
+	}
+
+	if r.Kind == models.AlertNoTelemetry {
+		args = append(args, r.Threshold)
+		return `
+			SELECT a.device_id, (EXTRACT(EPOCH FROM NOW() - COALESCE(l.server_received_at, a.first_seen_at)) / 3600)::float8 AS value
+			FROM agents a
+			LEFT JOIN telemetry_latest l ON l.device_id = a.device_id
+			WHERE COALESCE(l.server_received_at, a.first_seen_at) < NOW() - make_interval(secs => $` + strconv.Itoa(len(args)) + `::float8 * 3600)` + scope, args
+	}
+
+	args = append(args, r.Metric, r.Field)
+	metric := `$` + strconv.Itoa(len(args)-1)
+	field := `e.elem->$` + strconv.Itoa(len(args))
+
+	// Each value expression yields NULL for elements missing the field or
+	// holding the wrong type, so they never match
+	var value, op, agg string
+	switch r.Kind {
+	case models.AlertAge:
+		value = `CASE jsonb_typeof(` + field + `)
+				WHEN 'string' THEN (EXTRACT(EPOCH FROM NOW() - try_timestamptz(` + field + ` #>> '{}')) / 3600)::float8
+				WHEN 'number' THEN (EXTRACT(EPOCH FROM NOW() - to_timestamp((` + field + `)::text::float8)) / 3600)::float8
+			END`
+		op, agg = ">", "MAX"
+	default:
+		value = `CASE WHEN jsonb_typeof(` + field + `) = 'number' THEN (` + field + `)::text::float8 END`
+		if r.PercentOf != "" {
+			args = append(args, r.PercentOf)
+			total := `e.elem->$` + strconv.Itoa(len(args))
+			value = `CASE WHEN jsonb_typeof(` + field + `) = 'number' AND jsonb_typeof(` + total + `) = 'number'
+				THEN (` + field + `)::text::float8 / NULLIF((` + total + `)::text::float8, 0) * 100 END`
+		}
+		// Report the worst value among matching elements
+		op, agg = r.Operator, "MAX"
+		if op == "<" || op == "<=" {
+			agg = "MIN"
+		}
+	}
+
+	args = append(args, r.Threshold)
+	return `
+		SELECT a.device_id, ` + agg + `(v.value) AS value
+		FROM agents a
+		JOIN telemetry_latest l ON l.device_id = a.device_id
+		CROSS JOIN LATERAL (
+			SELECT ` + value + ` AS value
+			FROM jsonb_array_elements(CASE jsonb_typeof(l.metrics->` + metric + `)
+				WHEN 'array' THEN l.metrics->` + metric + `
+				ELSE jsonb_build_array(l.metrics->` + metric + `) END) e(elem)
+		) v
+		WHERE v.value ` + op + ` $` + strconv.Itoa(len(args)) + `::float8` + scope + `
+		GROUP BY a.device_id`, args
+}
+
+// EvaluateAlertRule fires the rule for newly matching devices and resolves
+// firing alerts for devices that no longer match, returning the alerts that
+// changed state. With deviceID set only that device is evaluated.
+func EvaluateAlertRule(ctx context.Context, db *pgxpool.Pool, r *models.AlertRule, deviceID *uuid.UUID) ([]models.Alert, error) {
+	matches, args := alertRuleMatchSQL(r, deviceID, []interface{}{r.RuleID})
+
+	resolveScope := ``
+	if deviceID != nil {
+		args = append(args, *deviceID)
+		resolveScope = ` AND device_id = $` + strconv.Itoa(len(args))
+	}
+
+	rows, err := db.Query(ctx, `
+		WITH matches AS (`+matches+`
+		),
+		fired AS (
+			INSERT INTO alerts (rule_id, device_id, value)
+			SELECT $1, device_id, value FROM matches
+			ON CONFLICT (rule_id, device_id) WHERE status = 'firing' DO UPDATE SET
+				value = EXCLUDED.value,
+				last_evaluated_at = NOW()
+			RETURNING alert_id, device_id, value, fired_at, xmax = 0 AS inserted
+		),
+		resolved AS (
+			UPDATE alerts SET status = 'resolved', resolved_at = NOW(), last_evaluated_at = NOW()
+			WHERE rule_id = $1 AND status = 'firing'`+resolveScope+`
+			  AND device_id NOT IN (SELECT device_id FROM matches)
+			RETURNING alert_id, device_id, value, fired_at
+		)
+		SELECT alert_id, device_id, value, fired_at, 'firing' FROM fired WHERE inserted
+		UNION ALL
+		SELECT alert_id, device_id, value, fired_at, 'resolved' FROM resolved`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changed []models.Alert
+	for rows.Next() {
+		alert := models.Alert{RuleID: r.RuleID, RuleName: r.Name, Severity: r.Severity}
+		if err := rows.Scan(&alert.AlertID, &alert.DeviceID, &alert.Value, &alert.FiredAt, &alert.Status); err != nil {
+			return nil, err
+		}
+		changed = append(changed, alert)
+	}
+	return changed, rows.Err()
+}
+
+// ResolveDisabledAlerts resolves alerts still firing for rules that have
+// since been disabled
+func ResolveDisabledAlerts(ctx context.Context, db *pgxpool.Pool) ([]models.Alert, error) {
+	rows, err := db.Query(ctx, `
+		UPDATE alerts al SET status = 'resolved', resolved_at = NOW(), last_evaluated_at = NOW()
+		FROM alert_rules r
+		WHERE r.rule_id = al.rule_id AND NOT r.enabled AND al.status = 'firing'
+		RETURNING al.alert_id, al.rule_id, r.name, r.severity, al.device_id, al.value, al.fired_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resolved []models.Alert
+	for rows.Next() {
+		alert := models.Alert{Status: models.AlertResolved}
+		if err := rows.Scan(&alert.AlertID, &alert.RuleID, &alert.RuleName, &alert.Severity,
+			&alert.DeviceID, &alert.Value, &alert.FiredAt); err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, alert)
+	}
+	return resolved, rows.Err()
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CommandAllowedSQL returns a condition that holds when the effective policy
+// of the device in the given qualified column or parameter allows the
+// command type bound to parameter $typeArg. The policy is resolved like
+// models.ResolveEffectivePolicy: device over group over global, highest
+// version first, using the currently effective version of staged policies.
+// A policy without allowed_commands, or no policy at all, allows every type.
+// A quarantined device is allowed none.
+func CommandAllowedSQL(device string, typeArg int) string {
+	return `NOT EXISTS (SELECT 1 FROM agents qa WHERE qa.device_id = ` + device + ` AND qa.lifecycle_state = 'quarantined')
+	AND COALESCE((
+		SELECT CASE WHEN jsonb_typeof(p.cfg->'allowed_commands') = 'array'
+		            THEN p.cfg->'allowed_commands' ? $` + strconv.Itoa(typeArg) + `::text
+		            ELSE TRUE END
+		FROM (
+			SELECT CASE WHEN effective_at > NOW() THEN previous_config ELSE config END AS cfg,
+			       CASE scope WHEN 'device' THEN 0 WHEN 'group' THEN 1 ELSE 2 END AS rank,
+			       CASE WHEN effective_at > NOW() THEN version - 1 ELSE version END AS version
+			FROM policies
+			WHERE ((scope = 'global')
+			   OR (scope = 'group' AND group_id IN (SELECT gm.group_id FROM device_group_members gm WHERE gm.device_id = ` + device + `))
+			   OR (scope = 'device' AND device_id = ` + device + `))
+			  AND (effective_at <= NOW() OR previous_config IS NOT NULL)
+		) p
+		ORDER BY p.rank, p.version DESC
+		LIMIT 1
+	), TRUE)`
+}
+
+// CommandAllowed reports whether a device may receive a command type: it
+// isn't quarantined and its effective policy allows the type
+func CommandAllowed(ctx context.Context, db *pgxpool.Pool, deviceID uuid.UUID, commandType string) (bool, error) {
+	var allowed bool
+	err := db.QueryRow(ctx, `SELECT `+CommandAllowedSQL("$1::uuid", 2), deviceID, commandType).Scan(&allowed)
+	return allowed, err
+}
+
+// DueCommandDevices returns the devices with pending commands matching
+// where, e.g. "batch_id = $1", that are already released
+func DueCommandDevices(ctx context.Context, db *pgxpool.Pool, where string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := db.Query(ctx, `
+		SELECT DISTINCT device_id FROM commands
+		WHERE `+where+` AND status = 'pending' AND (not_before IS NULL OR not_before <= NOW())`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deviceIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	return deviceIDs, rows.Err()
+}
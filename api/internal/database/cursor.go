@@ -0,0 +1,63 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cursor is the opaque next_cursor of keyset-paginated list endpoints. It
+// records the sort time and unique key of the last row returned; all list
+// endpoints sort by (time, key) descending.
+type Cursor struct {
+	Time time.Time `json:"t"`
+	Key  string    `json:"k"`
+}
+
+func EncodeCursor(t time.Time, key string) string {
+	data, _ := json.Marshal(Cursor{Time: t, Key: key})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Time.IsZero() || c.Key == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// UUIDCursorWhere renders the keyset condition for rows after c when the
+// tie-breaking key is a UUID column
+func UUIDCursorWhere(c *Cursor, timeCol, keyCol string, args []interface{}) (string, []interface{}, error) {
+	key, err := uuid.Parse(c.Key)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid cursor")
+	}
+	return cursorWhere(timeCol, keyCol, len(args)), append(args, c.Time, key), nil
+}
+
+// Int64CursorWhere renders the keyset condition for rows after c when the
+// tie-breaking key is an integer column
+func Int64CursorWhere(c *Cursor, timeCol, keyCol string, args []interface{}) (string, []interface{}, error) {
+	key, err := strconv.ParseInt(c.Key, 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid cursor")
+	}
+	return cursorWhere(timeCol, keyCol, len(args)), append(args, c.Time, key), nil
+}
+
+// cursorWhere compares against the two placeholders following the n
+// arguments already bound
+func cursorWhere(timeCol, keyCol string, n int) string {
+	return ` AND (` + timeCol + `, ` + keyCol + `) < ($` + strconv.Itoa(n+1) + `, $` + strconv.Itoa(n+2) + `)`
+}
@@ -3,24 +3,44 @@ package database
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/tracing"
 )
 
-func Connect(dsn string) (*pgxpool.Pool, error) {
+// PoolOptions size the connection pool. A zero StatementTimeout leaves the
+// server's statement_timeout in place.
+type PoolOptions struct {
+	MaxConns          int
+	MinConns          int
+	StatementTimeout  time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+func Connect(dsn string, opts PoolOptions) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database URL: %w", err)
 	}
 
 	// Configure connection pool
-	config.MaxConns = 25
-	config.MinConns = 5
+	config.MaxConns = int32(opts.MaxConns)
+	config.MinConns = int32(opts.MinConns)
 	config.MaxConnLifetime = time.Hour
 	config.MaxConnIdleTime = 10 * time.Minute
-	config.HealthCheckPeriod = 30 * time.Second
+	config.HealthCheckPeriod = opts.HealthCheckPeriod
+	if opts.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+	}
+	config.ConnConfig.Tracer = tracing.QueryTracer{}
+
+	// Statements are prepared on first use and kept per connection, so the
+	// fixed queries of the repository package are parsed and planned once
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	config.ConnConfig.StatementCacheCapacity = 512
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
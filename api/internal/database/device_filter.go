@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// DeviceFilterSQL renders a DeviceFilter as AND-ed conditions over the agents
+// table aliased as "a", appending bind values to args.
+func DeviceFilterSQL(f *models.DeviceFilter, args []interface{}) (string, []interface{}) {
+	// Retired devices never match a filter
+	where := ` AND a.status <> 'retired'`
+
+	if f.Status != "" {
+		args = append(args, f.Status)
+		where += ` AND a.status = $` + strconv.Itoa(len(args))
+	}
+
+	if f.Lifecycle != "" {
+		args = append(args, f.Lifecycle)
+		where += ` AND a.lifecycle_state = $` + strconv.Itoa(len(args))
+	}
+
+	if f.Hostname != "" {
+		args = append(args, GlobToLike(f.Hostname))
+		where += ` AND a.hostname ILIKE $` + strconv.Itoa(len(args))
+	}
+
+	if f.Tag != "" {
+		key, value, _ := strings.Cut(f.Tag, "=")
+		args = append(args, map[string]string{key: value})
+		where += ` AND EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = a.device_id AND t.tags @> $` +
+			strconv.Itoa(len(args)) + `::jsonb)`
+	}
+
+	if f.AdminTag != "" {
+		key, value, _ := strings.Cut(f.AdminTag, "=")
+		args = append(args, key, value)
+		where += ` AND EXISTS (SELECT 1 FROM device_tags tg WHERE tg.device_id = a.device_id AND tg.tag_key = $` +
+			strconv.Itoa(len(args)-1) + ` AND tg.tag_value = $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	if f.OSVersion != "" {
+		args = append(args, EscapeLike(f.OSVersion)+"%")
+		where += ` AND EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = a.device_id AND t.metrics->'os.info'->>'version' LIKE $` +
+			strconv.Itoa(len(args)) + `)`
+	}
+
+	if f.OSCaption != "" {
+		args = append(args, "%"+EscapeLike(f.OSCaption)+"%")
+		where += ` AND EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = a.device_id AND t.metrics->'os.info'->>'caption' ILIKE $` +
+			strconv.Itoa(len(args)) + `)`
+	}
+
+	if f.DiskFreeBelowPercent > 0 {
+		var cond string
+		cond, args = MetricThresholdSQL("disk_free_min_pct", "<", f.DiskFreeBelowPercent, args)
+		where += cond
+	}
+
+	if f.CPUAbovePercent > 0 {
+		var cond string
+		cond, args = MetricThresholdSQL("cpu_percent", ">", f.CPUAbovePercent, args)
+		where += cond
+	}
+
+	if f.MemoryAbovePercent > 0 {
+		var cond string
+		cond, args = MetricThresholdSQL("memory_used_pct", ">", f.MemoryAbovePercent, args)
+		where += cond
+	}
+
+	if f.LastSeenOlderThanHours > 0 {
+		args = append(args, f.LastSeenOlderThanHours)
+		where += ` AND a.last_seen_at < NOW() - make_interval(hours => $` + strconv.Itoa(len(args)) + `::int)`
+	}
+
+	if f.LastSeenWithinHours > 0 {
+		args = append(args, f.LastSeenWithinHours)
+		where += ` AND a.last_seen_at >= NOW() - make_interval(hours => $` + strconv.Itoa(len(args)) + `::int)`
+	}
+
+	return where, args
+}
+
+// MetricThresholdSQL matches devices in agents "a" whose latest telemetry
+// has a generated metric column (cpu_percent, memory_used_pct or
+// disk_free_min_pct) compared by op to value. The columns are indexed, so
+// the match doesn't parse each device's metrics.
+func MetricThresholdSQL(column, op string, value float64, args []interface{}) (string, []interface{}) {
+	args = append(args, value)
+	return ` AND EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = a.device_id AND t.` + column + ` ` + op + ` $` +
+		strconv.Itoa(len(args)) + `)`, args
+}
+
+// RefreshSmartGroup syncs a smart group's membership with the devices its
+// filter currently matches, returning how many members were added and removed.
+func RefreshSmartGroup(ctx context.Context, tx pgx.Tx, groupID int64, f *models.DeviceFilter) (int64, int64, error) {
+	where, args := DeviceFilterSQL(f, []interface{}{groupID})
+
+	removed, err := tx.Exec(ctx, `
+		DELETE FROM device_group_members m
+		WHERE m.group_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM agents a WHERE a.device_id = m.device_id`+where+`)`, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	added, err := tx.Exec(ctx, `
+		INSERT INTO device_group_members (group_id, device_id, added_by)
+		SELECT $1, a.device_id, 'smart-group'
+		FROM agents a
+		WHERE 1=1`+where+`
+		ON CONFLICT (group_id, device_id) DO NOTHING`, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE device_groups SET last_evaluated_at = NOW() WHERE group_id = $1", groupID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return added.RowsAffected(), removed.RowsAffected(), nil
+}
+
+// GlobToLike converts a * wildcard pattern to a LIKE pattern
+func GlobToLike(pattern string) string {
+	return strings.ReplaceAll(EscapeLike(pattern), "*", "%")
+}
+
+// EscapeLike escapes LIKE wildcards so s matches literally
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,40 @@
+package database
+
+// DeviceHealthJoin computes the health of each device in the agents table
+// aliased as "a" into the alias "h". The score starts at 100 and loses points
+// for:
+//
+//	telemetry recency    10 after 1h, 25 after 24h, 40 after 7 days
+//	failed commands      5 each over the last 7 days, at most 20
+//	disk pressure        5 below 20% free on any disk, 15 below 10%, 25 below 5%
+//	patch age            5 after 30 days, 10 after 60, 20 after 90
+//	collector errors     5 per failing collector on the latest run, at most 15
+//
+// Missing disk or patch data costs nothing. Disk pressure reads the fullest
+// disk from telemetry_latest's generated disk_free_min_pct column.
+const DeviceHealthJoin = `
+	LEFT JOIN LATERAL (
+		SELECT f.*, GREATEST(0, 100
+			- CASE WHEN f.last_seen_hours > 168 THEN 40 WHEN f.last_seen_hours > 24 THEN 25 WHEN f.last_seen_hours > 1 THEN 10 ELSE 0 END
+			- LEAST(f.failed_commands * 5, 20)
+			- CASE WHEN f.min_disk_free_percent < 5 THEN 25 WHEN f.min_disk_free_percent < 10 THEN 15 WHEN f.min_disk_free_percent < 20 THEN 5 ELSE 0 END
+			- CASE WHEN f.patch_age_days > 90 THEN 20 WHEN f.patch_age_days > 60 THEN 10 WHEN f.patch_age_days > 30 THEN 5 ELSE 0 END
+			- LEAST(f.collector_errors * 5, 15)) AS score
+		FROM (
+			SELECT
+				EXTRACT(EPOCH FROM NOW() - a.last_seen_at)::float8 / 3600 AS last_seen_hours,
+				(SELECT COUNT(*) FROM commands c
+				 WHERE c.device_id = a.device_id AND c.status = 'failed'
+				   AND c.completed_at > NOW() - INTERVAL '7 days')::int AS failed_commands,
+				t.disk_free_min_pct AS min_disk_free_percent,
+				(EXTRACT(EPOCH FROM NOW() - try_timestamptz(t.metrics->'os.info'->>'last_patch_at')) / 86400)::int AS patch_age_days,
+				CASE WHEN jsonb_typeof(t.errors) = 'object'
+					THEN (SELECT COUNT(*) FROM jsonb_object_keys(t.errors))::int ELSE 0 END AS collector_errors
+			FROM (SELECT 1) one
+			LEFT JOIN telemetry_latest t ON t.device_id = a.device_id
+		) f
+	) h ON TRUE`
+
+// DeviceHealthColumns selects the DeviceHealthJoin columns in the field
+// order of models.DeviceHealth
+const DeviceHealthColumns = `h.score, h.last_seen_hours, h.failed_commands, h.min_disk_free_percent, h.patch_age_days, h.collector_errors`
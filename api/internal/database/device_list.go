@@ -0,0 +1,258 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// DeviceListWhere renders the device list query parameters as a WHERE clause
+// over the agents table aliased as "a":
+//
+//	status, lifecycle, hostname (substring), group_id,
+//	agent_version (exact), os_version (prefix of os.info version),
+//	custom_field=key=value and tag=key[=value] (both repeatable),
+//	disk_free_below_percent, cpu_above_percent and memory_above_percent
+//	(thresholds on latest telemetry), failed_collector (a collector that
+//	failed on the latest run, or "any")
+func DeviceListWhere(q url.Values) (string, []interface{}, error) {
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if status := q.Get("status"); status != "" {
+		args = append(args, status)
+		where += ` AND a.status = $` + strconv.Itoa(len(args))
+	}
+
+	if lifecycle := q.Get("lifecycle"); lifecycle != "" {
+		args = append(args, lifecycle)
+		where += ` AND a.lifecycle_state = $` + strconv.Itoa(len(args))
+	}
+
+	if hostname := q.Get("hostname"); hostname != "" {
+		args = append(args, "%"+EscapeLike(hostname)+"%")
+		where += ` AND a.hostname ILIKE $` + strconv.Itoa(len(args))
+	}
+
+	if agentVersion := q.Get("agent_version"); agentVersion != "" {
+		args = append(args, agentVersion)
+		where += ` AND a.agent_version = $` + strconv.Itoa(len(args))
+	}
+
+	if osVersion := q.Get("os_version"); osVersion != "" {
+		args = append(args, EscapeLike(osVersion)+"%")
+		where += ` AND EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = a.device_id AND t.metrics->'os.info'->>'version' LIKE $` +
+			strconv.Itoa(len(args)) + `)`
+	}
+
+	if groupIDStr := q.Get("group_id"); groupIDStr != "" {
+		groupID, err := strconv.ParseInt(groupIDStr, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid group ID")
+		}
+		args = append(args, groupID)
+		where += ` AND a.device_id IN (SELECT device_id FROM device_group_members WHERE group_id = $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	// A collector that is disabled is absent from both metrics and errors,
+	// so only errors tells a failed one apart
+	if collector := q.Get("failed_collector"); collector == "any" {
+		where += ` AND EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = a.device_id AND t.errors <> '{}'::jsonb)`
+	} else if collector != "" {
+		args = append(args, collector)
+		where += ` AND EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = a.device_id AND t.errors ? $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	// custom_field=key=value matches devices whose field renders as value
+	for _, raw := range q["custom_field"] {
+		key, value, ok := strings.Cut(raw, "=")
+		if !ok || key == "" {
+			return "", nil, fmt.Errorf("custom_field must be in key=value form")
+		}
+		args = append(args, key, value)
+		where += ` AND a.custom_fields->>$` + strconv.Itoa(len(args)-1) + ` = $` + strconv.Itoa(len(args))
+	}
+
+	for _, threshold := range []struct{ param, column, op string }{
+		{"disk_free_below_percent", "disk_free_min_pct", "<"},
+		{"cpu_above_percent", "cpu_percent", ">"},
+		{"memory_above_percent", "memory_used_pct", ">"},
+	} {
+		raw := q.Get(threshold.param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s must be a number", threshold.param)
+		}
+		var cond string
+		cond, args = MetricThresholdSQL(threshold.column, threshold.op, value, args)
+		where += cond
+	}
+
+	tagWhere, args := TagFilterSQL(q["tag"], "a.device_id", args)
+	where += tagWhere
+
+	return where, args, nil
+}
+
+// deviceSortColumns maps the fields the device list sorts by to their
+// column, over agents "a" and the DeviceHealthJoin alias "h"
+var deviceSortColumns = map[string]string{
+	"last_seen_at":  "a.last_seen_at",
+	"first_seen_at": "a.first_seen_at",
+	"hostname":      "a.hostname",
+	"agent_version": "a.agent_version",
+	"health":        "h.score",
+}
+
+// DeviceListOrder renders ?sort=field[:asc|desc] as an ORDER BY clause over
+// the device list, tie-broken by last check-in. Times sort newest first by
+// default and other fields ascending; "last_seen" and "health" are accepted
+// as before. keyset reports whether the order is the one cursors page by,
+// last_seen_at descending.
+func DeviceListOrder(sort string) (orderBy string, keyset bool, err error) {
+	switch sort {
+	case "", "last_seen":
+		sort = "last_seen_at:desc"
+	case "health":
+		sort = "health:asc"
+	}
+
+	field, dir, hasDir := strings.Cut(sort, ":")
+	column, ok := deviceSortColumns[field]
+	if !ok {
+		return "", false, fmt.Errorf("sort must be one of last_seen_at, first_seen_at, hostname, agent_version or health")
+	}
+	if !hasDir {
+		dir = "asc"
+		if strings.HasSuffix(field, "_at") {
+			dir = "desc"
+		}
+	}
+	if dir != "asc" && dir != "desc" {
+		return "", false, fmt.Errorf("sort direction must be asc or desc")
+	}
+
+	if field == "last_seen_at" && dir == "desc" {
+		return ` ORDER BY a.last_seen_at DESC, a.device_id DESC`, true, nil
+	}
+	return ` ORDER BY ` + column + ` ` + strings.ToUpper(dir) + `, a.last_seen_at DESC, a.device_id DESC`, false, nil
+}
+
+// TagFilterSQL renders tag=key=value filters as conditions on the given
+// device_id column. A bare key matches any value.
+func TagFilterSQL(tags []string, column string, args []interface{}) (string, []interface{}) {
+	var where string
+
+	for _, raw := range tags {
+		key, value, hasValue := strings.Cut(raw, "=")
+		args = append(args, key)
+		cond := `tg.tag_key = $` + strconv.Itoa(len(args))
+		if hasValue {
+			args = append(args, value)
+			cond += ` AND tg.tag_value = $` + strconv.Itoa(len(args))
+		}
+		where += ` AND EXISTS (SELECT 1 FROM device_tags tg WHERE tg.device_id = ` + column + ` AND ` + cond + `)`
+	}
+
+	return where, args
+}
+
+// SoftwareSearchWhere renders software search query parameters as a WHERE
+// clause over device_software "s", software_titles "t" and agents "a":
+//
+//	name and publisher (substring), version (exact),
+//	version_lt / version_lte / version_gt / version_gte (numeric comparison,
+//	never matching installs whose version has no numeric components)
+func SoftwareSearchWhere(q url.Values) (string, []interface{}, error) {
+	name := q.Get("name")
+	if name == "" {
+		return "", nil, fmt.Errorf("name is required")
+	}
+
+	where := ` WHERE s.removed_at IS NULL AND a.status <> 'retired'`
+	args := []interface{}{"%" + EscapeLike(name) + "%"}
+	where += ` AND t.name ILIKE $1`
+
+	if publisher := q.Get("publisher"); publisher != "" {
+		args = append(args, "%"+EscapeLike(publisher)+"%")
+		where += ` AND t.publisher ILIKE $` + strconv.Itoa(len(args))
+	}
+
+	if version := q.Get("version"); version != "" {
+		args = append(args, version)
+		where += ` AND s.version = $` + strconv.Itoa(len(args))
+	}
+
+	for _, cmp := range []struct{ param, op string }{
+		{"version_lt", "<"},
+		{"version_lte", "<="},
+		{"version_gt", ">"},
+		{"version_gte", ">="},
+	} {
+		value := q.Get(cmp.param)
+		if value == "" {
+			continue
+		}
+		parts := models.ParseVersion(value)
+		if len(parts) == 0 {
+			return "", nil, fmt.Errorf("invalid %s", cmp.param)
+		}
+		args = append(args, parts)
+		where += ` AND cardinality(s.version_parts) > 0 AND s.version_parts ` + cmp.op + ` $` + strconv.Itoa(len(args)) + `::int[]`
+	}
+
+	return where, args, nil
+}
+
+// AuditLogWhere renders audit log query parameters as a WHERE clause over
+// audit_log "l": actor, action, resource_type, resource_id, request_id,
+// correlation_id and since (RFC 3339)
+func AuditLogWhere(q url.Values) (string, []interface{}, error) {
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	for _, col := range []string{"actor", "action", "resource_type", "resource_id", "request_id", "correlation_id"} {
+		if value := q.Get(col); value != "" {
+			args = append(args, value)
+			where += ` AND l.` + col + ` = $` + strconv.Itoa(len(args))
+		}
+	}
+
+	if sinceStr := q.Get("since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			return "", nil, fmt.Errorf("since must be an RFC 3339 timestamp")
+		}
+		args = append(args, since)
+		where += ` AND l.timestamp >= $` + strconv.Itoa(len(args))
+	}
+
+	return where, args, nil
+}
+
+// TelemetryWhere renders telemetry query parameters as a WHERE clause over
+// telemetry "t": device_id (required) and hours (default 24, max 168)
+func TelemetryWhere(q url.Values) (string, []interface{}, error) {
+	deviceID, err := uuid.Parse(q.Get("device_id"))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid device ID")
+	}
+
+	hours := 24
+	if h := q.Get("hours"); h != "" {
+		if parsed, err := strconv.Atoi(h); err == nil && parsed > 0 && parsed <= 168 {
+			hours = parsed
+		}
+	}
+
+	return ` WHERE t.device_id = $1 AND t.collected_at >= NOW() - make_interval(hours => $2::int)`,
+		[]interface{}{deviceID, hours}, nil
+}
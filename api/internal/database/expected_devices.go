@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LinkExpectedDevices links unlinked expected devices to the registered
+// devices they describe, limited to deviceID when it is non-nil. A serial
+// number reported in os.info telemetry matches first; a hostname matches
+// only when the expected device or the registered one has no serial to
+// compare. Each device is linked at most once. It returns the number of
+// expected devices linked.
+func LinkExpectedDevices(ctx context.Context, db *pgxpool.Pool, deviceID *uuid.UUID) (int64, error) {
+	tag, err := db.Exec(ctx, `
+		WITH candidates AS (
+			SELECT a.device_id, a.org_id, a.hostname, a.last_seen_at,
+			       NULLIF(t.metrics->'os.info'->>'serial', '') AS serial
+			FROM agents a
+			LEFT JOIN telemetry_latest t ON t.device_id = a.device_id
+			WHERE a.status <> 'retired'
+			  AND ($1::uuid IS NULL OR a.device_id = $1)
+			  AND NOT EXISTS (SELECT 1 FROM expected_devices l WHERE l.device_id = a.device_id)
+		),
+		matches AS (
+			SELECT e.expected_id, c.device_id, TRUE AS by_serial, c.last_seen_at
+			FROM expected_devices e
+			JOIN candidates c ON c.org_id = e.org_id AND lower(c.serial) = lower(e.serial_number)
+			WHERE e.device_id IS NULL
+
+			UNION ALL
+			SELECT e.expected_id, c.device_id, FALSE, c.last_seen_at
+			FROM expected_devices e
+			JOIN candidates c ON c.org_id = e.org_id AND lower(c.hostname) = lower(e.hostname)
+			WHERE e.device_id IS NULL AND (e.serial_number IS NULL OR c.serial IS NULL)
+		),
+		best_device AS (
+			SELECT DISTINCT ON (expected_id) expected_id, device_id, by_serial
+			FROM matches
+			ORDER BY expected_id, by_serial DESC, last_seen_at DESC
+		),
+		best AS (
+			SELECT DISTINCT ON (device_id) expected_id, device_id
+			FROM best_device
+			ORDER BY device_id, by_serial DESC, expected_id
+		)
+		UPDATE expected_devices e SET device_id = b.device_id, linked_at = NOW()
+		FROM best b
+		WHERE e.expected_id = b.expected_id AND e.device_id IS NULL`, deviceID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// TransitionLifecycle moves a device to the lifecycle state to if
+// models.CanTransition allows it from the device's current state, and
+// records the transition. Retiring a device retires its status with it. It
+// returns the state the device left, or "" when the device doesn't exist or
+// can't move to the state from where it is.
+func TransitionLifecycle(ctx context.Context, db querier, deviceID uuid.UUID, to, actor, reason string) (string, error) {
+	var from string
+	err := db.QueryRow(ctx, `
+		WITH moved AS (
+			UPDATE agents a SET lifecycle_state = $2,
+			       status = CASE WHEN $2 = 'retired' THEN 'retired' ELSE a.status END
+			FROM agents prev
+			WHERE a.device_id = $1 AND prev.device_id = a.device_id AND a.lifecycle_state = ANY($3)
+			RETURNING prev.lifecycle_state AS from_state
+		), recorded AS (
+			INSERT INTO device_lifecycle_transitions (device_id, from_state, to_state, actor, reason)
+			SELECT $1, from_state, $2, NULLIF($4, ''), NULLIF($5, '') FROM moved
+		)
+		SELECT from_state FROM moved`,
+		deviceID, to, models.LifecycleSources(to), actor, reason).Scan(&from)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return from, err
+}
+
+// RecordEnrollment records the transition that enrolled a newly registered
+// device, from the expected status of the imported expected device it was
+// linked to, if any
+func RecordEnrollment(ctx context.Context, db querier, deviceID uuid.UUID, fromExpected bool) error {
+	var from *string
+	if fromExpected {
+		expected := models.ExpectedDeviceExpected
+		from = &expected
+	}
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO device_lifecycle_transitions (device_id, from_state, to_state, actor)
+		VALUES ($1, $2, $3, 'agent')`, deviceID, from, models.LifecycleEnrolled)
+	return err
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MigrationsDir holds the schema migrations, relative to the API's working
+// directory
+const MigrationsDir = "internal/database/migrations"
+
+// LatestMigration returns the version of the newest migration in dir, taken
+// from the number its file names start with
+func LatestMigration(dir string) (uint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s: no version", name)
+		}
+		if uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+	return latest, nil
+}
+
+// MigrationVersion returns the schema version migrations have brought the
+// database to, 0 before any has run, and whether the last one failed partway
+func MigrationVersion(ctx context.Context, pool *pgxpool.Pool) (version uint, dirty bool, err error) {
+	var v int64
+	err = pool.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations").Scan(&v, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(v), dirty, nil
+}
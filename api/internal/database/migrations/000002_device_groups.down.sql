@@ -0,0 +1,8 @@
+-- +migrate Down
+
+DROP TRIGGER IF EXISTS update_device_groups_updated_at ON device_groups;
+
+ALTER TABLE policies DROP CONSTRAINT IF EXISTS fk_policies_group_id;
+
+DROP TABLE IF EXISTS device_group_members;
+DROP TABLE IF EXISTS device_groups;
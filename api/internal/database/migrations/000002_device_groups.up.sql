@@ -0,0 +1,33 @@
+-- +migrate Up
+-- Device groups and static group membership
+
+CREATE TABLE device_groups (
+    group_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    name TEXT NOT NULL,
+    description TEXT,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, name)
+);
+
+CREATE INDEX idx_device_groups_org_id ON device_groups(org_id);
+
+CREATE TABLE device_group_members (
+    group_id BIGINT NOT NULL REFERENCES device_groups(group_id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES agents(device_id) ON DELETE CASCADE,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    added_by TEXT,
+    PRIMARY KEY (group_id, device_id)
+);
+
+CREATE INDEX idx_device_group_members_device_id ON device_group_members(device_id);
+
+-- Group-scoped policies now reference real groups. Existing rows used the
+-- agent org_id as a stand-in, so the constraint is only enforced going forward.
+ALTER TABLE policies
+    ADD CONSTRAINT fk_policies_group_id FOREIGN KEY (group_id)
+    REFERENCES device_groups(group_id) ON DELETE CASCADE NOT VALID;
+
+CREATE TRIGGER update_device_groups_updated_at BEFORE UPDATE ON device_groups FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
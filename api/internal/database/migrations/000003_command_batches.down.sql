@@ -0,0 +1,6 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_commands_batch_id;
+ALTER TABLE commands DROP COLUMN IF EXISTS batch_id;
+
+DROP TABLE IF EXISTS command_batches;
@@ -0,0 +1,20 @@
+-- +migrate Up
+-- Command batches for commands fanned out to many devices
+
+CREATE TABLE command_batches (
+    batch_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type TEXT NOT NULL,
+    parameters JSONB,
+    ttl_seconds INT NOT NULL DEFAULT 300,
+    target_type TEXT NOT NULL CHECK (target_type IN ('group')),
+    target_group_id BIGINT REFERENCES device_groups(group_id) ON DELETE SET NULL,
+    device_count INT NOT NULL DEFAULT 0,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_command_batches_created_at ON command_batches(created_at DESC);
+
+ALTER TABLE commands ADD COLUMN batch_id UUID REFERENCES command_batches(batch_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_commands_batch_id ON commands(batch_id) WHERE batch_id IS NOT NULL;
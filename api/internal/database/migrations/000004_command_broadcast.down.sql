@@ -0,0 +1,9 @@
+-- +migrate Down
+
+ALTER TABLE command_batches DROP COLUMN IF EXISTS rate_per_minute;
+ALTER TABLE command_batches DROP COLUMN IF EXISTS target_filter;
+ALTER TABLE command_batches DROP CONSTRAINT IF EXISTS command_batches_target_type_check;
+ALTER TABLE command_batches ADD CONSTRAINT command_batches_target_type_check CHECK (target_type IN ('group'));
+
+DROP INDEX IF EXISTS idx_commands_not_before;
+ALTER TABLE commands DROP COLUMN IF EXISTS not_before;
@@ -0,0 +1,12 @@
+-- +migrate Up
+-- Filter-targeted command broadcasts with throttled rollout
+
+-- Commands are held back from agents until not_before; TTL counts from then
+ALTER TABLE commands ADD COLUMN not_before TIMESTAMPTZ;
+
+CREATE INDEX idx_commands_not_before ON commands(not_before) WHERE status = 'pending' AND not_before IS NOT NULL;
+
+ALTER TABLE command_batches DROP CONSTRAINT IF EXISTS command_batches_target_type_check;
+ALTER TABLE command_batches ADD CONSTRAINT command_batches_target_type_check CHECK (target_type IN ('group', 'filter'));
+ALTER TABLE command_batches ADD COLUMN target_filter JSONB;
+ALTER TABLE command_batches ADD COLUMN rate_per_minute INT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_commands_parent_command_id;
+ALTER TABLE commands DROP COLUMN IF EXISTS parent_command_id;
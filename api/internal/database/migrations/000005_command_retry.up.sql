@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Link retried commands to the command they replace
+
+ALTER TABLE commands ADD COLUMN parent_command_id UUID REFERENCES commands(command_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_commands_parent_command_id ON commands(parent_command_id) WHERE parent_command_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- +migrate Up
+-- Allow command batches that target an explicit list of devices
+
+ALTER TABLE command_batches DROP CONSTRAINT IF EXISTS command_batches_target_type_check;
+ALTER TABLE command_batches ADD CONSTRAINT command_batches_target_type_check CHECK (target_type IN ('group', 'filter', 'devices'));
@@ -0,0 +1,14 @@
+-- +migrate Down
+
+UPDATE commands SET status = 'expired' WHERE status = 'cancelled';
+ALTER TABLE commands DROP CONSTRAINT IF EXISTS commands_status_check;
+ALTER TABLE commands ADD CONSTRAINT commands_status_check CHECK (status IN ('pending', 'executing', 'completed', 'failed', 'expired'));
+
+DROP INDEX IF EXISTS idx_agents_purge_after;
+ALTER TABLE agents DROP COLUMN IF EXISTS purge_after;
+ALTER TABLE agents DROP COLUMN IF EXISTS retired_by;
+ALTER TABLE agents DROP COLUMN IF EXISTS retired_at;
+
+UPDATE agents SET status = 'inactive' WHERE status = 'retired';
+ALTER TABLE agents DROP CONSTRAINT IF EXISTS agents_status_check;
+ALTER TABLE agents ADD CONSTRAINT agents_status_check CHECK (status IN ('active', 'inactive', 'offline'));
@@ -0,0 +1,14 @@
+-- +migrate Up
+-- Device decommissioning: retired status, cancelled commands and scheduled telemetry purge
+
+ALTER TABLE agents DROP CONSTRAINT IF EXISTS agents_status_check;
+ALTER TABLE agents ADD CONSTRAINT agents_status_check CHECK (status IN ('active', 'inactive', 'offline', 'retired'));
+
+ALTER TABLE agents ADD COLUMN retired_at TIMESTAMPTZ;
+ALTER TABLE agents ADD COLUMN retired_by TEXT;
+ALTER TABLE agents ADD COLUMN purge_after TIMESTAMPTZ;
+
+CREATE INDEX idx_agents_purge_after ON agents(purge_after) WHERE purge_after IS NOT NULL;
+
+ALTER TABLE commands DROP CONSTRAINT IF EXISTS commands_status_check;
+ALTER TABLE commands ADD CONSTRAINT commands_status_check CHECK (status IN ('pending', 'executing', 'completed', 'failed', 'expired', 'cancelled'));
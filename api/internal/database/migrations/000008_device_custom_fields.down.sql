@@ -0,0 +1,7 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_agents_custom_fields;
+ALTER TABLE agents DROP COLUMN IF EXISTS custom_fields;
+ALTER TABLE agents DROP COLUMN IF EXISTS notes;
+
+DROP TABLE IF EXISTS custom_field_definitions;
@@ -0,0 +1,15 @@
+-- +migrate Up
+-- Admin-editable device notes and typed custom fields
+
+CREATE TABLE custom_field_definitions (
+    field_key TEXT PRIMARY KEY CHECK (field_key ~ '^[a-z][a-z0-9_]{0,62}$'),
+    label TEXT NOT NULL,
+    field_type TEXT NOT NULL CHECK (field_type IN ('string', 'number', 'boolean', 'date')),
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE agents ADD COLUMN notes TEXT;
+ALTER TABLE agents ADD COLUMN custom_fields JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_agents_custom_fields ON agents USING GIN (custom_fields);
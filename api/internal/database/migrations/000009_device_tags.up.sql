@@ -0,0 +1,13 @@
+-- +migrate Up
+-- Admin-assigned device tags, kept separate from agent-reported telemetry tags
+
+CREATE TABLE device_tags (
+    device_id UUID NOT NULL REFERENCES agents(device_id) ON DELETE CASCADE,
+    tag_key TEXT NOT NULL CHECK (length(tag_key) BETWEEN 1 AND 128),
+    tag_value TEXT NOT NULL DEFAULT '' CHECK (length(tag_value) <= 256),
+    updated_by TEXT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (device_id, tag_key)
+);
+
+CREATE INDEX idx_device_tags_key_value ON device_tags(tag_key, tag_value);
@@ -0,0 +1,9 @@
+-- +migrate Down
+
+ALTER TABLE command_batches DROP COLUMN IF EXISTS saved_filter_id;
+
+DROP INDEX IF EXISTS idx_device_groups_filter_id;
+ALTER TABLE device_groups DROP COLUMN IF EXISTS last_evaluated_at;
+ALTER TABLE device_groups DROP COLUMN IF EXISTS filter_id;
+
+DROP TABLE IF EXISTS saved_filters;
@@ -0,0 +1,25 @@
+-- +migrate Up
+-- Saved device filters, smart groups and filter-targeted command batches
+
+CREATE TABLE saved_filters (
+    filter_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    name TEXT NOT NULL,
+    description TEXT,
+    filter JSONB NOT NULL,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, name)
+);
+
+CREATE TRIGGER update_saved_filters_updated_at BEFORE UPDATE ON saved_filters FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- A group with a filter is a smart group whose membership is recomputed
+-- from the filter rather than edited directly
+ALTER TABLE device_groups ADD COLUMN filter_id BIGINT REFERENCES saved_filters(filter_id) ON DELETE RESTRICT;
+ALTER TABLE device_groups ADD COLUMN last_evaluated_at TIMESTAMPTZ;
+
+CREATE INDEX idx_device_groups_filter_id ON device_groups(filter_id) WHERE filter_id IS NOT NULL;
+
+ALTER TABLE command_batches ADD COLUMN saved_filter_id BIGINT REFERENCES saved_filters(filter_id) ON DELETE SET NULL;
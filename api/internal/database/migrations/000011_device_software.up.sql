@@ -0,0 +1,16 @@
+-- +migrate Up
+-- Software inventory extracted from software.inventory telemetry for fleet-wide search
+
+CREATE TABLE device_software (
+    device_id UUID NOT NULL REFERENCES agents(device_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    version TEXT NOT NULL DEFAULT '',
+    version_parts INT[] NOT NULL DEFAULT '{}',
+    publisher TEXT,
+    install_date TEXT,
+    collected_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (device_id, name, version)
+);
+
+CREATE INDEX idx_device_software_name ON device_software (lower(name));
+CREATE INDEX idx_device_software_name_version ON device_software (name, version_parts);
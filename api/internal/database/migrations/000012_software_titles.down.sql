@@ -0,0 +1,28 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_device_software_title_version;
+DELETE FROM device_software WHERE removed_at IS NOT NULL;
+
+ALTER TABLE device_software ADD COLUMN name TEXT;
+ALTER TABLE device_software ADD COLUMN publisher TEXT;
+ALTER TABLE device_software ADD COLUMN collected_at TIMESTAMPTZ;
+
+UPDATE device_software s
+SET name = t.name, publisher = t.publisher, collected_at = s.last_seen_at
+FROM software_titles t
+WHERE t.title_id = s.title_id;
+
+ALTER TABLE device_software DROP CONSTRAINT device_software_pkey;
+ALTER TABLE device_software DROP COLUMN removed_at;
+ALTER TABLE device_software DROP COLUMN last_seen_at;
+ALTER TABLE device_software DROP COLUMN first_seen_at;
+ALTER TABLE device_software DROP COLUMN title_id;
+
+ALTER TABLE device_software ALTER COLUMN name SET NOT NULL;
+ALTER TABLE device_software ALTER COLUMN collected_at SET NOT NULL;
+ALTER TABLE device_software ADD PRIMARY KEY (device_id, name, version);
+
+CREATE INDEX idx_device_software_name ON device_software (lower(name));
+CREATE INDEX idx_device_software_name_version ON device_software (name, version_parts);
+
+DROP TABLE IF EXISTS software_titles;
@@ -0,0 +1,48 @@
+-- +migrate Up
+-- Normalize extracted software into titles plus per-device installs with first/last seen
+
+CREATE TABLE software_titles (
+    title_id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    publisher TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Titles are deduplicated case-insensitively on name and publisher
+CREATE UNIQUE INDEX idx_software_titles_key ON software_titles ((lower(name)), (lower(publisher)));
+CREATE INDEX idx_software_titles_name ON software_titles (lower(name));
+
+INSERT INTO software_titles (name, publisher)
+SELECT DISTINCT ON (lower(name), lower(COALESCE(publisher, ''))) name, COALESCE(publisher, '')
+FROM device_software
+ORDER BY lower(name), lower(COALESCE(publisher, '')), name;
+
+ALTER TABLE device_software ADD COLUMN title_id BIGINT REFERENCES software_titles(title_id) ON DELETE CASCADE;
+ALTER TABLE device_software ADD COLUMN first_seen_at TIMESTAMPTZ;
+ALTER TABLE device_software ADD COLUMN last_seen_at TIMESTAMPTZ;
+ALTER TABLE device_software ADD COLUMN removed_at TIMESTAMPTZ;
+
+UPDATE device_software s
+SET title_id = t.title_id, first_seen_at = s.collected_at, last_seen_at = s.collected_at
+FROM software_titles t
+WHERE lower(t.name) = lower(s.name) AND lower(t.publisher) = lower(COALESCE(s.publisher, ''));
+
+-- Case variants of the same title collapse onto one row per device and version
+DELETE FROM device_software s
+USING device_software d
+WHERE s.device_id = d.device_id AND s.title_id = d.title_id AND s.version = d.version
+  AND s.name > d.name;
+
+ALTER TABLE device_software DROP CONSTRAINT device_software_pkey;
+DROP INDEX IF EXISTS idx_device_software_name;
+DROP INDEX IF EXISTS idx_device_software_name_version;
+ALTER TABLE device_software DROP COLUMN name;
+ALTER TABLE device_software DROP COLUMN publisher;
+ALTER TABLE device_software DROP COLUMN collected_at;
+
+ALTER TABLE device_software ALTER COLUMN title_id SET NOT NULL;
+ALTER TABLE device_software ALTER COLUMN first_seen_at SET NOT NULL;
+ALTER TABLE device_software ALTER COLUMN last_seen_at SET NOT NULL;
+ALTER TABLE device_software ADD PRIMARY KEY (device_id, title_id, version);
+
+CREATE INDEX idx_device_software_title_version ON device_software (title_id, version_parts) WHERE removed_at IS NULL;
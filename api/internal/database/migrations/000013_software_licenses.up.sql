@@ -0,0 +1,18 @@
+-- +migrate Up
+-- Software license entitlements compared against installed inventory
+
+CREATE TABLE software_licenses (
+    license_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    product TEXT NOT NULL,
+    name_pattern TEXT NOT NULL,
+    publisher TEXT NOT NULL DEFAULT '',
+    seats INT NOT NULL CHECK (seats >= 0),
+    notes TEXT,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, product)
+);
+
+CREATE TRIGGER update_software_licenses_updated_at BEFORE UPDATE ON software_licenses FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,21 @@
+-- +migrate Up
+-- Asynchronous CSV/XLSX export jobs; files are written by the export runner
+
+CREATE TABLE export_jobs (
+    job_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind TEXT NOT NULL CHECK (kind IN ('devices', 'software', 'telemetry', 'audit')),
+    format TEXT NOT NULL CHECK (format IN ('csv', 'xlsx')),
+    params JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    row_count BIGINT,
+    file_path TEXT,
+    error TEXT,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_export_jobs_pending ON export_jobs (created_at) WHERE status = 'pending';
+CREATE INDEX idx_export_jobs_expires ON export_jobs (expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,18 @@
+-- +migrate Up
+-- Hourly and daily aggregates of numeric telemetry fields, kept after raw
+-- telemetry partitions are dropped
+
+CREATE TABLE telemetry_rollups (
+    device_id UUID NOT NULL REFERENCES agents(device_id) ON DELETE CASCADE,
+    metric TEXT NOT NULL,
+    field TEXT NOT NULL,
+    resolution TEXT NOT NULL CHECK (resolution IN ('1h', '1d')),
+    bucket TIMESTAMPTZ NOT NULL,
+    avg_value DOUBLE PRECISION NOT NULL,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    samples BIGINT NOT NULL,
+    PRIMARY KEY (device_id, metric, field, resolution, bucket)
+);
+
+CREATE INDEX idx_telemetry_rollups_bucket ON telemetry_rollups (resolution, bucket);
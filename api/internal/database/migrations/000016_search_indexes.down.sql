@@ -0,0 +1,8 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_software_titles_name_trgm;
+DROP INDEX IF EXISTS idx_device_tags_value_trgm;
+DROP INDEX IF EXISTS idx_device_tags_key_trgm;
+DROP INDEX IF EXISTS idx_telemetry_latest_last_user_trgm;
+DROP INDEX IF EXISTS idx_telemetry_latest_serial_trgm;
+DROP INDEX IF EXISTS idx_agents_hostname_trgm;
@@ -0,0 +1,11 @@
+-- +migrate Up
+-- Trigram indexes backing the global search endpoint
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_agents_hostname_trgm ON agents USING gin (hostname gin_trgm_ops);
+CREATE INDEX idx_telemetry_latest_serial_trgm ON telemetry_latest USING gin ((metrics->'os.info'->>'serial') gin_trgm_ops);
+CREATE INDEX idx_telemetry_latest_last_user_trgm ON telemetry_latest USING gin ((metrics->'os.info'->>'last_user') gin_trgm_ops);
+CREATE INDEX idx_device_tags_key_trgm ON device_tags USING gin (tag_key gin_trgm_ops);
+CREATE INDEX idx_device_tags_value_trgm ON device_tags USING gin (tag_value gin_trgm_ops);
+CREATE INDEX idx_software_titles_name_trgm ON software_titles USING gin (name gin_trgm_ops);
@@ -0,0 +1,4 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,5 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS alert_rules;
+DROP FUNCTION IF EXISTS try_timestamptz(TEXT);
@@ -0,0 +1,54 @@
+-- +migrate Up
+-- Alert rules evaluated against latest telemetry, and the alerts they raise.
+-- A device has at most one firing alert per rule; resolved alerts are kept
+-- as history.
+
+CREATE TABLE alert_rules (
+    rule_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    name TEXT NOT NULL,
+    description TEXT,
+    kind TEXT NOT NULL CHECK (kind IN ('threshold', 'age', 'no_telemetry')),
+    metric TEXT,
+    field TEXT,
+    percent_of TEXT,
+    operator TEXT,
+    threshold DOUBLE PRECISION NOT NULL,
+    severity TEXT NOT NULL DEFAULT 'warning' CHECK (severity IN ('info', 'warning', 'critical')),
+    group_id BIGINT REFERENCES device_groups(group_id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, name)
+);
+
+CREATE TRIGGER update_alert_rules_updated_at BEFORE UPDATE ON alert_rules FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE alerts (
+    alert_id BIGSERIAL PRIMARY KEY,
+    rule_id BIGINT NOT NULL REFERENCES alert_rules(rule_id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES agents(device_id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'firing' CHECK (status IN ('firing', 'resolved')),
+    value DOUBLE PRECISION,
+    fired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_evaluated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    acknowledged_by TEXT,
+    acknowledged_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_alerts_firing ON alerts (rule_id, device_id) WHERE status = 'firing';
+CREATE INDEX idx_alerts_fired_at ON alerts (fired_at DESC, alert_id DESC);
+CREATE INDEX idx_alerts_device_id ON alerts (device_id, fired_at DESC);
+
+-- Age rules read timestamps out of agent-reported JSON; a malformed value
+-- should leave that device unmatched rather than fail the whole evaluation
+CREATE OR REPLACE FUNCTION try_timestamptz(value TEXT)
+RETURNS TIMESTAMPTZ AS $$
+BEGIN
+    RETURN value::timestamptz;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ language 'plpgsql' STABLE;
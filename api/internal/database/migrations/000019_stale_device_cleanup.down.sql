@@ -0,0 +1,4 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS stale_device_runs;
+DROP TABLE IF EXISTS org_settings;
@@ -0,0 +1,26 @@
+-- +migrate Up
+-- Per-org settings, starting with automatic retirement of devices that
+-- haven't been seen for a number of days, and a log of each cleanup run
+
+CREATE TABLE org_settings (
+    org_id BIGINT PRIMARY KEY,
+    stale_device_days INT CHECK (stale_device_days >= 0),
+    purge_stale_devices BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_org_settings_updated_at BEFORE UPDATE ON org_settings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE stale_device_runs (
+    run_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT NOT NULL,
+    stale_device_days INT NOT NULL,
+    purge BOOLEAN NOT NULL,
+    devices_retired INT NOT NULL,
+    devices JSONB NOT NULL,
+    ran_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_stale_device_runs_org ON stale_device_runs (org_id, ran_at DESC);
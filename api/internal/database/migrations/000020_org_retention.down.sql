@@ -0,0 +1,7 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_device_software_removed_at;
+
+ALTER TABLE org_settings DROP COLUMN IF EXISTS software_history_retention_days;
+ALTER TABLE org_settings DROP COLUMN IF EXISTS rollup_retention_days;
+ALTER TABLE org_settings DROP COLUMN IF EXISTS telemetry_retention_days;
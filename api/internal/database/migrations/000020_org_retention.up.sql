@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Per-org retention in days for each class of stored data. NULL uses the
+-- server default.
+
+ALTER TABLE org_settings ADD COLUMN telemetry_retention_days INT CHECK (telemetry_retention_days > 0);
+ALTER TABLE org_settings ADD COLUMN rollup_retention_days INT CHECK (rollup_retention_days > 0);
+ALTER TABLE org_settings ADD COLUMN software_history_retention_days INT CHECK (software_history_retention_days > 0);
+
+CREATE INDEX idx_device_software_removed_at ON device_software (removed_at) WHERE removed_at IS NOT NULL;
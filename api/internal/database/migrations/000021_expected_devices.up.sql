@@ -0,0 +1,28 @@
+-- +migrate Up
+-- Devices expected from procurement data, imported ahead of their agents.
+-- Each is linked to the device that registers with a matching serial number
+-- or hostname.
+
+CREATE TABLE expected_devices (
+    expected_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    hostname TEXT,
+    serial_number TEXT,
+    owner TEXT,
+    site TEXT,
+    device_id UUID UNIQUE REFERENCES agents(device_id) ON DELETE SET NULL,
+    status TEXT GENERATED ALWAYS AS (CASE WHEN device_id IS NULL THEN 'expected' ELSE 'linked' END) STORED,
+    linked_at TIMESTAMPTZ,
+    imported_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (hostname IS NOT NULL OR serial_number IS NOT NULL)
+);
+
+CREATE TRIGGER update_expected_devices_updated_at BEFORE UPDATE ON expected_devices FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- A serial identifies one device; without one the hostname does
+CREATE UNIQUE INDEX idx_expected_devices_serial ON expected_devices (org_id, lower(serial_number)) WHERE serial_number IS NOT NULL;
+CREATE UNIQUE INDEX idx_expected_devices_hostname ON expected_devices (org_id, lower(hostname)) WHERE serial_number IS NULL;
+CREATE INDEX idx_expected_devices_unlinked_hostname ON expected_devices (org_id, lower(hostname)) WHERE device_id IS NULL;
+CREATE INDEX idx_expected_devices_status ON expected_devices (status, created_at DESC);
@@ -0,0 +1,5 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS agent_rollout_devices;
+DROP TABLE IF EXISTS agent_rollouts;
+DROP TABLE IF EXISTS agent_releases;
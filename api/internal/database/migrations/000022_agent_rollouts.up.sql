@@ -0,0 +1,64 @@
+-- +migrate Up
+-- Agent release artifacts, staged rollouts of a release through rings of
+-- devices, and each device's progress through its upgrade
+
+CREATE TABLE agent_releases (
+    release_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    version TEXT NOT NULL,
+    platform TEXT NOT NULL DEFAULT 'windows',
+    arch TEXT NOT NULL DEFAULT 'amd64',
+    url TEXT,
+    file_path TEXT,
+    sha256 TEXT NOT NULL CHECK (sha256 ~ '^[0-9a-f]{64}$'),
+    size_bytes BIGINT,
+    signature TEXT,
+    notes TEXT,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, version, platform, arch),
+    CHECK (url IS NOT NULL OR file_path IS NOT NULL)
+);
+
+CREATE TRIGGER update_agent_releases_updated_at BEFORE UPDATE ON agent_releases FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- rings is an ordered array of {name, percent, group_ids}; a device is
+-- offered the release once a ring it falls in is reached
+CREATE TABLE agent_rollouts (
+    rollout_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    release_id BIGINT NOT NULL REFERENCES agent_releases(release_id),
+    platform TEXT NOT NULL,
+    arch TEXT NOT NULL,
+    name TEXT NOT NULL,
+    rings JSONB NOT NULL,
+    current_ring INT NOT NULL DEFAULT 0 CHECK (current_ring >= 0),
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'completed', 'cancelled')),
+    max_failures INT CHECK (max_failures > 0),
+    paused_reason TEXT,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_agent_rollouts_updated_at BEFORE UPDATE ON agent_rollouts FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- One rollout in progress per platform at a time
+CREATE UNIQUE INDEX idx_agent_rollouts_in_progress ON agent_rollouts (org_id, platform, arch) WHERE status IN ('active', 'paused');
+CREATE INDEX idx_agent_rollouts_platform ON agent_rollouts (org_id, platform, arch, created_at DESC) WHERE status <> 'cancelled';
+
+CREATE TABLE agent_rollout_devices (
+    rollout_id BIGINT NOT NULL REFERENCES agent_rollouts(rollout_id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES agents(device_id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('offered', 'downloading', 'verifying', 'installed', 'failed', 'rolled_back')),
+    from_version TEXT,
+    error TEXT,
+    offered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (rollout_id, device_id)
+);
+
+CREATE TRIGGER update_agent_rollout_devices_updated_at BEFORE UPDATE ON agent_rollout_devices FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE INDEX idx_agent_rollout_devices_status ON agent_rollout_devices (rollout_id, status);
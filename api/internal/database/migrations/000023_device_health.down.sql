@@ -0,0 +1,2 @@
+-- +migrate Down
+ALTER TABLE telemetry_latest DROP COLUMN IF EXISTS errors;
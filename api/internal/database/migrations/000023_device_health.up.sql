@@ -0,0 +1,3 @@
+-- +migrate Up
+-- Collectors that failed on the device's latest run, keyed by collector name
+ALTER TABLE telemetry_latest ADD COLUMN IF NOT EXISTS errors JSONB;
@@ -0,0 +1,11 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_commands_awaiting_approval;
+ALTER TABLE commands DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE commands DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE commands DROP COLUMN IF EXISTS requested_by;
+
+UPDATE commands SET status = 'cancelled', completed_at = COALESCE(completed_at, NOW())
+WHERE status IN ('awaiting_approval', 'rejected');
+ALTER TABLE commands DROP CONSTRAINT IF EXISTS commands_status_check;
+ALTER TABLE commands ADD CONSTRAINT commands_status_check CHECK (status IN ('pending', 'executing', 'completed', 'failed', 'expired', 'cancelled'));
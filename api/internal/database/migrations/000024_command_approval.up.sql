@@ -0,0 +1,12 @@
+-- +migrate Up
+-- Dual-control approval: commands of sensitive types wait in
+-- awaiting_approval until a second admin approves or rejects them
+
+ALTER TABLE commands DROP CONSTRAINT IF EXISTS commands_status_check;
+ALTER TABLE commands ADD CONSTRAINT commands_status_check CHECK (status IN ('awaiting_approval', 'pending', 'executing', 'completed', 'failed', 'expired', 'cancelled', 'rejected'));
+
+ALTER TABLE commands ADD COLUMN requested_by TEXT;
+ALTER TABLE commands ADD COLUMN reviewed_by TEXT;
+ALTER TABLE commands ADD COLUMN reviewed_at TIMESTAMPTZ;
+
+CREATE INDEX idx_commands_awaiting_approval ON commands(issued_at) WHERE status = 'awaiting_approval';
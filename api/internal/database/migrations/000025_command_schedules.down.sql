@@ -0,0 +1,6 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_commands_schedule_id;
+ALTER TABLE command_batches DROP COLUMN IF EXISTS schedule_id;
+ALTER TABLE commands DROP COLUMN IF EXISTS schedule_id;
+DROP TABLE IF EXISTS command_schedules;
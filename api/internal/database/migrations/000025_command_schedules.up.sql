@@ -0,0 +1,33 @@
+-- +migrate Up
+-- Recurring commands for a device or group. The command scheduler creates a
+-- command (or a batch for a group) each time a schedule comes due.
+
+CREATE TABLE command_schedules (
+    schedule_id BIGSERIAL PRIMARY KEY,
+    org_id BIGINT DEFAULT 1,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    parameters JSONB,
+    ttl_seconds INT NOT NULL DEFAULT 3600,
+    device_id UUID REFERENCES agents(device_id) ON DELETE CASCADE,
+    group_id BIGINT REFERENCES device_groups(group_id) ON DELETE CASCADE,
+    cron TEXT NOT NULL,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (org_id, name),
+    CHECK ((device_id IS NULL) <> (group_id IS NULL))
+);
+
+CREATE INDEX idx_command_schedules_next_run_at ON command_schedules(next_run_at) WHERE enabled;
+
+CREATE TRIGGER update_command_schedules_updated_at BEFORE UPDATE ON command_schedules FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE commands ADD COLUMN schedule_id BIGINT REFERENCES command_schedules(schedule_id) ON DELETE SET NULL;
+ALTER TABLE command_batches ADD COLUMN schedule_id BIGINT REFERENCES command_schedules(schedule_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_commands_schedule_id ON commands(schedule_id) WHERE schedule_id IS NOT NULL;
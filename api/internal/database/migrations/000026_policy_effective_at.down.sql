@@ -0,0 +1,4 @@
+-- +migrate Down
+
+ALTER TABLE policies DROP COLUMN IF EXISTS previous_config;
+ALTER TABLE policies DROP COLUMN IF EXISTS effective_at;
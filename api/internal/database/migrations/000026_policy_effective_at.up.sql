@@ -0,0 +1,5 @@
+-- +migrate Up
+-- A policy change can be staged to take effect later. Until effective_at the
+-- agent endpoint keeps serving previous_config at the previous version.
+ALTER TABLE policies ADD COLUMN effective_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE policies ADD COLUMN previous_config JSONB;
@@ -0,0 +1,5 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS device_lifecycle_transitions;
+DROP INDEX IF EXISTS idx_agents_lifecycle_state;
+ALTER TABLE agents DROP COLUMN IF EXISTS lifecycle_state;
@@ -0,0 +1,27 @@
+-- +migrate Up
+-- Explicit device lifecycle (enrolled -> active -> quarantined -> retired)
+-- with a history of transitions. status keeps reporting connectivity.
+
+ALTER TABLE agents ADD COLUMN lifecycle_state TEXT NOT NULL DEFAULT 'enrolled'
+    CHECK (lifecycle_state IN ('enrolled', 'active', 'quarantined', 'retired'));
+
+UPDATE agents SET lifecycle_state = CASE
+    WHEN status = 'retired' THEN 'retired'
+    WHEN EXISTS (SELECT 1 FROM telemetry_latest t WHERE t.device_id = agents.device_id) THEN 'active'
+    ELSE 'enrolled'
+END;
+
+CREATE INDEX idx_agents_lifecycle_state ON agents(lifecycle_state);
+
+-- from_state is NULL for the transition that enrolled the device
+CREATE TABLE device_lifecycle_transitions (
+    transition_id BIGSERIAL PRIMARY KEY,
+    device_id UUID NOT NULL REFERENCES agents(device_id) ON DELETE CASCADE,
+    from_state TEXT,
+    to_state TEXT NOT NULL,
+    actor TEXT,
+    reason TEXT,
+    transitioned_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_device_lifecycle_transitions_device ON device_lifecycle_transitions(device_id, transitioned_at DESC);
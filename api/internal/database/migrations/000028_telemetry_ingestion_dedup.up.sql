@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Agents send an ingestion_id with each report and resend it on retry, so a
+-- report redelivered or retried is stored once. telemetry is partitioned by
+-- collected_at, which every unique index must include; a retry carries the
+-- same collected_at.
+CREATE UNIQUE INDEX idx_telemetry_ingestion ON telemetry(device_id, ingestion_id, collected_at);
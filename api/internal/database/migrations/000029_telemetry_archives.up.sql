@@ -0,0 +1,22 @@
+-- +migrate Up
+-- Telemetry partitions exported to object storage before being dropped.
+-- Each archive is one gzipped NDJSON object of the partition's rows plus a
+-- manifest object describing it.
+CREATE TABLE telemetry_archives (
+    archive_id BIGSERIAL PRIMARY KEY,
+    partition_name TEXT NOT NULL UNIQUE,
+    partition_date DATE NOT NULL,
+    bucket TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    manifest_key TEXT NOT NULL,
+    format TEXT NOT NULL DEFAULT 'ndjson.gz',
+    row_count BIGINT NOT NULL,
+    device_count INTEGER NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    first_collected_at TIMESTAMPTZ,
+    last_collected_at TIMESTAMPTZ,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_telemetry_archives_date ON telemetry_archives(partition_date);
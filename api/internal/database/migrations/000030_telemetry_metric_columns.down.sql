@@ -0,0 +1,15 @@
+-- +migrate Down
+
+ALTER TABLE telemetry
+    DROP COLUMN IF EXISTS cpu_percent,
+    DROP COLUMN IF EXISTS memory_used_pct,
+    DROP COLUMN IF EXISTS disk_free_min_pct;
+
+ALTER TABLE telemetry_latest
+    DROP COLUMN IF EXISTS cpu_percent,
+    DROP COLUMN IF EXISTS memory_used_pct,
+    DROP COLUMN IF EXISTS disk_free_min_pct;
+
+DROP FUNCTION IF EXISTS telemetry_cpu_percent(JSONB);
+DROP FUNCTION IF EXISTS telemetry_memory_used_pct(JSONB);
+DROP FUNCTION IF EXISTS telemetry_disk_free_min_pct(JSONB);
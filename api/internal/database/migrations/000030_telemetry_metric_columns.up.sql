@@ -0,0 +1,53 @@
+-- +migrate Up
+-- Hot metric fields as generated columns, so filtering e.g. devices with
+-- less than 10% disk free reads an index instead of parsing every device's
+-- metrics JSON. The extraction functions must never raise, or ingest would
+-- fail: fields that are missing or not numbers give NULL.
+CREATE OR REPLACE FUNCTION telemetry_cpu_percent(metrics JSONB)
+RETURNS DOUBLE PRECISION AS $$
+    SELECT CASE WHEN jsonb_typeof(metrics->'cpu.utilization'->'cpu_percent') = 'number'
+        THEN (metrics->'cpu.utilization'->>'cpu_percent')::float8 END
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+
+CREATE OR REPLACE FUNCTION telemetry_memory_used_pct(metrics JSONB)
+RETURNS DOUBLE PRECISION AS $$
+    SELECT CASE WHEN jsonb_typeof(metrics->'memory.usage'->'used_bytes') = 'number'
+                 AND jsonb_typeof(metrics->'memory.usage'->'total_bytes') = 'number'
+        THEN CASE WHEN (metrics->'memory.usage'->>'total_bytes')::numeric > 0
+            THEN ((metrics->'memory.usage'->>'used_bytes')::numeric * 100
+                / (metrics->'memory.usage'->>'total_bytes')::numeric)::float8 END
+        END
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+
+-- disk.utilization may be a single disk object or an array of disks; the
+-- fullest disk counts
+CREATE OR REPLACE FUNCTION telemetry_disk_free_min_pct(metrics JSONB)
+RETURNS DOUBLE PRECISION AS $$
+    SELECT MIN(CASE WHEN jsonb_typeof(d->'free_bytes') = 'number' AND jsonb_typeof(d->'total_bytes') = 'number'
+        THEN CASE WHEN (d->>'total_bytes')::numeric > 0
+            THEN (d->>'free_bytes')::numeric * 100 / (d->>'total_bytes')::numeric END
+        END)::float8
+    FROM jsonb_array_elements(CASE jsonb_typeof(metrics->'disk.utilization')
+        WHEN 'array' THEN metrics->'disk.utilization'
+        WHEN 'object' THEN jsonb_build_array(metrics->'disk.utilization')
+        ELSE '[]'::jsonb END) d
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE;
+
+-- Adding stored columns rewrites both tables, telemetry's partitions
+-- included
+ALTER TABLE telemetry_latest
+    ADD COLUMN cpu_percent DOUBLE PRECISION GENERATED ALWAYS AS (telemetry_cpu_percent(metrics)) STORED,
+    ADD COLUMN memory_used_pct DOUBLE PRECISION GENERATED ALWAYS AS (telemetry_memory_used_pct(metrics)) STORED,
+    ADD COLUMN disk_free_min_pct DOUBLE PRECISION GENERATED ALWAYS AS (telemetry_disk_free_min_pct(metrics)) STORED;
+
+ALTER TABLE telemetry
+    ADD COLUMN cpu_percent DOUBLE PRECISION GENERATED ALWAYS AS (telemetry_cpu_percent(metrics)) STORED,
+    ADD COLUMN memory_used_pct DOUBLE PRECISION GENERATED ALWAYS AS (telemetry_memory_used_pct(metrics)) STORED,
+    ADD COLUMN disk_free_min_pct DOUBLE PRECISION GENERATED ALWAYS AS (telemetry_disk_free_min_pct(metrics)) STORED;
+
+-- Fleet filters read telemetry_latest. History queries already narrow
+-- telemetry by device and time, so it isn't indexed on these columns and
+-- ingest doesn't pay for three more indexes.
+CREATE INDEX idx_telemetry_latest_cpu_percent ON telemetry_latest(cpu_percent);
+CREATE INDEX idx_telemetry_latest_memory_used_pct ON telemetry_latest(memory_used_pct);
+CREATE INDEX idx_telemetry_latest_disk_free_min_pct ON telemetry_latest(disk_free_min_pct);
@@ -0,0 +1,4 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS ingest_usage;
+DROP TABLE IF EXISTS ingest_quotas;
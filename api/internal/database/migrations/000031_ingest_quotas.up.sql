@@ -0,0 +1,31 @@
+-- +migrate Up
+-- Per-device and per-org overrides of the server's default ingest quotas,
+-- and the ingest counted against them. NULL keeps the server default and 0
+-- lifts the limit.
+
+CREATE TABLE ingest_quotas (
+    scope TEXT NOT NULL CHECK (scope IN ('device', 'org')),
+    scope_id TEXT NOT NULL,
+    payloads_per_hour BIGINT CHECK (payloads_per_hour >= 0),
+    bytes_per_day BIGINT CHECK (bytes_per_day >= 0),
+    updated_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, scope_id)
+);
+
+CREATE TRIGGER update_ingest_quotas_updated_at BEFORE UPDATE ON ingest_quotas FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Usage is counted in fixed windows, clock hours and UTC days, each with
+-- both the payloads and the bytes received in it
+CREATE TABLE ingest_usage (
+    scope TEXT NOT NULL,
+    scope_id TEXT NOT NULL,
+    period TEXT NOT NULL CHECK (period IN ('hour', 'day')),
+    window_start TIMESTAMPTZ NOT NULL,
+    payloads BIGINT NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, scope_id, period, window_start)
+);
+
+CREATE INDEX idx_ingest_usage_window ON ingest_usage (window_start);
@@ -0,0 +1,4 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS usage_active_devices;
+DROP TABLE IF EXISTS usage_metering;
@@ -0,0 +1,31 @@
+-- +migrate Up
+-- Daily usage per org for chargeback between business units. Ingest is
+-- added up by the API instances as telemetry arrives; active devices,
+-- commands issued and stored rows are measured by the metering worker.
+
+CREATE TABLE usage_metering (
+    org_id BIGINT NOT NULL,
+    day DATE NOT NULL,
+    ingested_payloads BIGINT NOT NULL DEFAULT 0,
+    ingested_bytes BIGINT NOT NULL DEFAULT 0,
+    commands_issued BIGINT NOT NULL DEFAULT 0,
+    -- Devices that reported telemetry that day
+    active_devices INT NOT NULL DEFAULT 0,
+    -- Raw telemetry rows held when last measured that day; NULL until then
+    stored_rows BIGINT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, day)
+);
+
+CREATE INDEX idx_usage_metering_day ON usage_metering (day);
+
+-- Which devices reported on each day, so devices active in a month are
+-- counted once however many days they reported
+CREATE TABLE usage_active_devices (
+    org_id BIGINT NOT NULL,
+    day DATE NOT NULL,
+    device_id UUID NOT NULL,
+    PRIMARY KEY (org_id, day, device_id)
+);
+
+CREATE INDEX idx_usage_active_devices_day ON usage_active_devices (day);
@@ -0,0 +1,7 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_audit_log_correlation_id;
+DROP INDEX IF EXISTS idx_audit_log_request_id;
+
+ALTER TABLE audit_log DROP COLUMN IF EXISTS correlation_id;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS request_id;
@@ -0,0 +1,8 @@
+-- +migrate Up
+-- The API request that wrote each audit row and the correlation ID its
+-- caller sent, so an audit entry can be matched with the request's logs
+ALTER TABLE audit_log ADD COLUMN request_id TEXT;
+ALTER TABLE audit_log ADD COLUMN correlation_id TEXT;
+
+CREATE INDEX idx_audit_log_request_id ON audit_log(request_id) WHERE request_id IS NOT NULL;
+CREATE INDEX idx_audit_log_correlation_id ON audit_log(correlation_id) WHERE correlation_id IS NOT NULL;
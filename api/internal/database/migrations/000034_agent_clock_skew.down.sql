@@ -0,0 +1,3 @@
+-- +migrate Down
+
+ALTER TABLE agents DROP COLUMN IF EXISTS clock_skew_ms;
@@ -0,0 +1,4 @@
+-- +migrate Up
+-- How far each device's clock was from the API's, API minus device, as its
+-- last report carried it, so devices with wrong clocks can be found
+ALTER TABLE agents ADD COLUMN clock_skew_ms BIGINT;
@@ -0,0 +1,4 @@
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_telemetry_latest_errors;
+ALTER TABLE telemetry DROP COLUMN IF EXISTS errors;
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- Collectors that failed on each run, keyed by collector name, kept with the
+-- run's history as telemetry_latest keeps them for the latest run
+ALTER TABLE telemetry ADD COLUMN IF NOT EXISTS errors JSONB;
+
+-- Finds the devices whose latest run failed a given collector
+CREATE INDEX IF NOT EXISTS idx_telemetry_latest_errors ON telemetry_latest USING GIN (errors);
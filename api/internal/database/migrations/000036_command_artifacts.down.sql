@@ -0,0 +1,4 @@
+-- +migrate Down
+
+DROP TABLE IF EXISTS command_artifact_chunks;
+DROP TABLE IF EXISTS command_artifacts;
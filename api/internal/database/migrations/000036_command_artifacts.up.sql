@@ -0,0 +1,24 @@
+-- +migrate Up
+-- Command output too large to ack inline, uploaded by the agent in chunks
+-- and referenced from the command's result. Completed once every chunk is
+-- in and their SHA-256 matches the one declared up front.
+CREATE TABLE IF NOT EXISTS command_artifacts (
+    artifact_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    command_id UUID NOT NULL REFERENCES commands(command_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes >= 0),
+    sha256 TEXT NOT NULL,
+    chunk_size INT NOT NULL CHECK (chunk_size > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_artifacts_command ON command_artifacts(command_id);
+
+CREATE TABLE IF NOT EXISTS command_artifact_chunks (
+    artifact_id UUID NOT NULL REFERENCES command_artifacts(artifact_id) ON DELETE CASCADE,
+    chunk_index INT NOT NULL CHECK (chunk_index >= 0),
+    data BYTEA NOT NULL,
+    PRIMARY KEY (artifact_id, chunk_index)
+);
@@ -0,0 +1,19 @@
+-- +migrate Up
+-- Each device's report of applying its policy, replaced by the next one.
+-- expected_version is the version the device was due when it reported; it
+-- converged if it applied that policy with no failed settings.
+CREATE TABLE IF NOT EXISTS device_policy_status (
+    device_id UUID PRIMARY KEY REFERENCES agents(device_id) ON DELETE CASCADE,
+    policy_version INT NOT NULL,
+    expected_version INT NOT NULL,
+    etag TEXT,
+    converged BOOLEAN NOT NULL,
+    settings JSONB NOT NULL DEFAULT '{}',
+    failed_settings TEXT[] NOT NULL DEFAULT '{}',
+    unsupported_metrics TEXT[] NOT NULL DEFAULT '{}',
+    applied_at TIMESTAMPTZ NOT NULL,
+    reported_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_policy_status_reported ON device_policy_status(reported_at DESC, device_id DESC);
+CREATE INDEX IF NOT EXISTS idx_device_policy_status_unconverged ON device_policy_status(reported_at DESC) WHERE NOT converged;
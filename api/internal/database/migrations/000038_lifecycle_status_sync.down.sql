@@ -0,0 +1,3 @@
+-- +migrate Down
+
+ALTER TABLE agents DROP CONSTRAINT IF EXISTS agents_retired_check;
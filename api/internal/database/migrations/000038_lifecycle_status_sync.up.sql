@@ -0,0 +1,18 @@
+-- +migrate Up
+-- status reports connectivity, but is 'retired' exactly when lifecycle_state
+-- is: retiring a device sets both in one statement. Devices retired on only
+-- one of them so far are retired on both.
+
+WITH moved AS (
+    UPDATE agents a SET lifecycle_state = 'retired'
+    FROM agents prev
+    WHERE prev.device_id = a.device_id AND a.status = 'retired' AND a.lifecycle_state <> 'retired'
+    RETURNING a.device_id, prev.lifecycle_state AS from_state
+)
+INSERT INTO device_lifecycle_transitions (device_id, from_state, to_state, actor, reason)
+SELECT device_id, from_state, 'retired', 'system', 'retired status' FROM moved;
+
+UPDATE agents SET status = 'retired' WHERE lifecycle_state = 'retired' AND status <> 'retired';
+
+ALTER TABLE agents ADD CONSTRAINT agents_retired_check
+    CHECK ((status = 'retired') = (lifecycle_state = 'retired'));
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Retention columns of org_settings
+const (
+	RetentionTelemetry       = "telemetry_retention_days"
+	RetentionRollups         = "rollup_retention_days"
+	RetentionSoftwareHistory = "software_history_retention_days"
+)
+
+// OrgRetentionDays returns the retention in days of one data class for
+// every org with devices, falling back to defaultDays for orgs that haven't
+// set it. column must be one of the Retention constants.
+func OrgRetentionDays(ctx context.Context, db *pgxpool.Pool, column string, defaultDays int) (map[int64]int, error) {
+	rows, err := db.Query(ctx, `
+		SELECT o.org_id, COALESCE(st.`+column+`, $1)
+		FROM (SELECT DISTINCT org_id FROM agents WHERE org_id IS NOT NULL) o
+		LEFT JOIN org_settings st ON st.org_id = o.org_id`, defaultDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	retention := make(map[int64]int)
+	for rows.Next() {
+		var orgID int64
+		var days int
+		if err := rows.Scan(&orgID, &days); err != nil {
+			return nil, err
+		}
+		retention[orgID] = days
+	}
+	return retention, rows.Err()
+}
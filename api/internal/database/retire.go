@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// RetireDevice retires a device locked FOR UPDATE by the caller's
+// transaction: it moves to the retired lifecycle state, its token is
+// revoked, pending commands are cancelled and device-scoped policies and
+// group memberships are removed. With purge the device purger later deletes
+// its telemetry and record. The counts of what was removed are added to
+// details, which is then written to the audit log.
+func RetireDevice(ctx context.Context, tx pgx.Tx, deviceID uuid.UUID, actor string, purge bool, details map[string]interface{}) (time.Time, error) {
+	// A device that is already retired is only being scheduled for purge
+	if _, err := TransitionLifecycle(ctx, tx, deviceID, models.LifecycleRetired, actor, ""); err != nil {
+		return time.Time{}, err
+	}
+
+	// An empty hash never matches a bcrypt comparison, revoking the token
+	var retiredAt time.Time
+	err := tx.QueryRow(ctx, `
+		UPDATE agents
+		SET auth_token_hash = '',
+		    retired_at = COALESCE(retired_at, NOW()), retired_by = COALESCE(retired_by, $2),
+		    purge_after = CASE WHEN $3 THEN NOW() ELSE NULL END
+		WHERE device_id = $1
+		RETURNING retired_at`, deviceID, actor, purge).Scan(&retiredAt)
+	if err != nil {
+		return retiredAt, err
+	}
+
+	cancelled, err := tx.Exec(ctx, `
+		UPDATE commands SET status = 'cancelled', completed_at = NOW()
+		WHERE device_id = $1 AND status IN ('awaiting_approval', 'pending', 'executing')`, deviceID)
+	if err != nil {
+		return retiredAt, err
+	}
+
+	policies, err := tx.Exec(ctx,
+		"DELETE FROM policies WHERE scope = 'device' AND device_id = $1", deviceID)
+	if err != nil {
+		return retiredAt, err
+	}
+
+	memberships, err := tx.Exec(ctx,
+		"DELETE FROM device_group_members WHERE device_id = $1", deviceID)
+	if err != nil {
+		return retiredAt, err
+	}
+
+	details["purge"] = purge
+	details["commands_cancelled"] = cancelled.RowsAffected()
+	details["policies_removed"] = policies.RowsAffected()
+	details["memberships_removed"] = memberships.RowsAffected()
+
+	err = audit.Record(ctx, tx, actor, "retire", "agent", deviceID.String(), details)
+	return retiredAt, err
+}
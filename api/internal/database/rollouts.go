@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// DeviceRollout returns the newest rollout for the platform whose open rings
+// include the device, together with its release, or nil if there is none.
+// A device falls in a ring through one of the ring's groups or when its hash
+// bucket for the rollout, stable between polls, is below the ring's percent.
+// Completed rollouts include every device, so devices missed by the rollout
+// that superseded them still converge on the last completed release.
+func DeviceRollout(ctx context.Context, db *pgxpool.Pool, deviceID uuid.UUID, orgID int64, platform, arch string) (*models.Rollout, *models.AgentRelease, error) {
+	var (
+		rollout models.Rollout
+		release models.AgentRelease
+	)
+	err := db.QueryRow(ctx, `
+		SELECT r.rollout_id, r.status, rel.release_id, rel.version, COALESCE(rel.url, ''),
+		       rel.file_path IS NOT NULL, rel.sha256, rel.size_bytes, COALESCE(rel.signature, '')
+		FROM agent_rollouts r
+		JOIN agent_releases rel ON rel.release_id = r.release_id
+		WHERE r.org_id = $2 AND r.platform = $3 AND r.arch = $4 AND r.status <> 'cancelled'
+		  AND (r.status = 'completed' OR EXISTS (
+			SELECT 1 FROM jsonb_array_elements(r.rings) WITH ORDINALITY AS g(ring, pos)
+			WHERE g.pos - 1 <= r.current_ring
+			  AND (mod(hashtext(r.rollout_id::text || ':' || $1::text)::bigint + 2147483648, 100) < (g.ring->>'percent')::int
+			       OR EXISTS (
+					SELECT 1 FROM device_group_members m
+					WHERE m.device_id = $1
+					  AND m.group_id IN (SELECT jsonb_array_elements_text(COALESCE(g.ring->'group_ids', '[]'))::bigint)))))
+		ORDER BY r.created_at DESC, r.rollout_id DESC
+		LIMIT 1`, deviceID, orgID, platform, arch).Scan(
+		&rollout.RolloutID, &rollout.Status, &release.ReleaseID, &release.Version, &release.URL,
+		&release.Uploaded, &release.SHA256, &release.SizeBytes, &release.Signature)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rollout.ReleaseID = release.ReleaseID
+	rollout.Version = release.Version
+	return &rollout, &release, nil
+}
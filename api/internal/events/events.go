@@ -0,0 +1,133 @@
+// Package events publishes state changes to a JetStream stream that live
+// admin clients subscribe to
+package events
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+const (
+	// StreamName is the JetStream stream holding published events
+	StreamName = "EVENTS"
+
+	// SubjectPrefix precedes the event type in each subject, e.g.
+	// events.device.online
+	SubjectPrefix = "events."
+
+	// MetricsSubjects matches the per-device live metrics subjects. These
+	// are plain NATS subjects outside the stream: only the latest values
+	// matter, so nothing is retained.
+	MetricsSubjects = "live.devices.*.metrics"
+
+	// retention bounds how far back a reconnecting client can resume
+	retention = 24 * time.Hour
+)
+
+// CommandsSubject returns the subject that wakes a device's long-polling
+// command requests. Like live metrics it is a plain NATS subject: a device
+// that isn't waiting picks its commands up on its next poll.
+func CommandsSubject(deviceID uuid.UUID) string {
+	return "commands.devices." + deviceID.String()
+}
+
+// MetricsSubject returns the live metrics subject for a device
+func MetricsSubject(deviceID uuid.UUID) string {
+	return "live.devices." + deviceID.String() + ".metrics"
+}
+
+// Subject returns the NATS subject an event type is published on
+func Subject(eventType string) string {
+	return SubjectPrefix + eventType
+}
+
+// TypeOf returns the event type carried by a subject
+func TypeOf(subject string) string {
+	return strings.TrimPrefix(subject, SubjectPrefix)
+}
+
+// EnsureStream creates the events stream if it doesn't exist yet
+func EnsureStream(js nats.JetStreamContext) error {
+	cfg := &nats.StreamConfig{
+		Name:     StreamName,
+		Subjects: []string{Subject(">")},
+		Storage:  nats.FileStorage,
+		Replicas: 1,
+		MaxAge:   retention,
+	}
+
+	if _, err := js.StreamInfo(StreamName); err == nil {
+		_, err = js.UpdateStream(cfg)
+		return err
+	}
+
+	_, err := js.AddStream(cfg)
+	return err
+}
+
+// Publisher publishes events without blocking the request that caused them.
+// A nil Publisher discards events.
+type Publisher struct {
+	nc *nats.Conn
+	js nats.JetStream
+}
+
+func NewPublisher(nc *nats.Conn, js nats.JetStream) *Publisher {
+	return &Publisher{nc: nc, js: js}
+}
+
+// Publish sends an event; failures are logged and otherwise ignored so a
+// NATS outage never fails the underlying write
+func (p *Publisher) Publish(evt models.Event) {
+	if p == nil || p.js == nil {
+		return
+	}
+
+	data, err := json.Marshal(evt)
+	if err != nil {
+		slog.Error("Failed to encode event", "event_type", evt.Type, "error", err)
+		return
+	}
+
+	if _, err := p.js.PublishAsync(Subject(evt.Type), data); err != nil {
+		slog.Error("Failed to publish event", "event_type", evt.Type, "error", err)
+	}
+}
+
+// PublishMetrics sends a device's latest key metrics to live subscribers
+func (p *Publisher) PublishMetrics(status models.DeviceLiveStatus) {
+	if p == nil || p.nc == nil || len(status.Metrics) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		slog.Error("Failed to encode live metrics", "error", err)
+		return
+	}
+
+	if err := p.nc.Publish(MetricsSubject(status.DeviceID), data); err != nil {
+		slog.Error("Failed to publish live metrics", "error", err)
+	}
+}
+
+// NotifyCommands wakes the long-polling command requests of devices that
+// have new commands
+func (p *Publisher) NotifyCommands(deviceIDs ...uuid.UUID) {
+	if p == nil || p.nc == nil {
+		return
+	}
+
+	for _, deviceID := range deviceIDs {
+		if err := p.nc.Publish(CommandsSubject(deviceID), nil); err != nil {
+			slog.Error("Failed to notify device of commands", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// Export kinds, one per exportable list endpoint
+const (
+	KindDevices   = "devices"
+	KindSoftware  = "software"
+	KindTelemetry = "telemetry"
+	KindAudit     = "audit"
+)
+
+// Query is a fully bound export: a header row plus the SQL producing one
+// record per row in the same column order. A telemetry export's SQL names
+// the telemetry table with a %s verb, filled in by Run with the table of
+// the shard holding Device's telemetry.
+type Query struct {
+	Kind   string
+	Header []string
+	SQL    string
+	Args   []interface{}
+	Device uuid.UUID
+}
+
+// Build turns an export kind and the list endpoint's query parameters into
+// an unpaginated export query
+func Build(kind string, params url.Values) (*Query, error) {
+	switch kind {
+	case KindDevices:
+		where, args, err := database.DeviceListWhere(params)
+		if err != nil {
+			return nil, err
+		}
+		return &Query{
+			Kind:   kind,
+			Header: []string{"device_id", "hostname", "status", "lifecycle_state", "agent_version", "first_seen_at", "last_seen_at", "notes", "custom_fields", "tags"},
+			SQL: `
+				SELECT a.device_id, a.hostname, a.status, a.lifecycle_state, a.agent_version, a.first_seen_at, a.last_seen_at,
+				       a.notes, a.custom_fields,
+				       (SELECT jsonb_object_agg(tag_key, tag_value) FROM device_tags WHERE device_tags.device_id = a.device_id)
+				FROM agents a` + where + `
+				ORDER BY a.hostname`,
+			Args: args,
+		}, nil
+
+	case KindSoftware:
+		where, args, err := database.SoftwareSearchWhere(params)
+		if err != nil {
+			return nil, err
+		}
+		return &Query{
+			Kind:   kind,
+			Header: []string{"name", "version", "publisher", "device_id", "hostname", "install_date", "first_seen_at", "last_seen_at"},
+			SQL: `
+				SELECT t.name, s.version, t.publisher, a.device_id, a.hostname, s.install_date,
+				       s.first_seen_at, s.last_seen_at
+				FROM device_software s
+				JOIN software_titles t ON t.title_id = s.title_id
+				JOIN agents a ON a.device_id = s.device_id` + where + `
+				ORDER BY t.name, s.version_parts DESC, a.hostname`,
+			Args: args,
+		}, nil
+
+	case KindTelemetry:
+		where, args, err := database.TelemetryWhere(params)
+		if err != nil {
+			return nil, err
+		}
+		// One row per metric per sample so the file pivots cleanly in Excel
+		return &Query{
+			Kind:   kind,
+			Header: []string{"device_id", "collected_at", "metric", "value"},
+			SQL: `
+				SELECT t.device_id, t.collected_at, m.key, m.value::text
+				FROM %s t, jsonb_each(t.metrics) m` + where + `
+				ORDER BY t.collected_at DESC, m.key`,
+			Args:   args,
+			Device: args[0].(uuid.UUID),
+		}, nil
+
+	case KindAudit:
+		where, args, err := database.AuditLogWhere(params)
+		if err != nil {
+			return nil, err
+		}
+		return &Query{
+			Kind:   kind,
+			Header: []string{"log_id", "timestamp", "actor", "action", "resource_type", "resource_id", "details", "request_id", "correlation_id"},
+			SQL: `
+				SELECT l.log_id, l.timestamp, l.actor, l.action, l.resource_type, l.resource_id, l.details,
+				       l.request_id, l.correlation_id
+				FROM audit_log l` + where + `
+				ORDER BY l.timestamp DESC`,
+			Args: args,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown export kind: %s", kind)
+	}
+}
+
+// Run executes the query and writes the header and every row to w, returning
+// the number of data rows written. The writer is not closed. Telemetry
+// exports read from the replica of the device's telemetry shard rather than
+// db.
+func Run(ctx context.Context, db *pgxpool.Pool, telemetry *repository.Telemetry, q *Query, w Writer) (int64, error) {
+	sql := q.SQL
+	if q.Kind == KindTelemetry {
+		shard, err := telemetry.ForDevice(ctx, q.Device)
+		if err != nil {
+			return 0, err
+		}
+		db, sql = shard.Replica(), fmt.Sprintf(q.SQL, shard.Table())
+	}
+
+	if err := w.Write(q.Header); err != nil {
+		return 0, err
+	}
+
+	rows, err := db.Query(ctx, sql, q.Args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	record := make([]string, len(q.Header))
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return count, err
+		}
+		for i, v := range values {
+			record[i] = Value(v)
+		}
+		if err := w.Write(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/requestid"
+	agentv1 "github.com/yourorg/inventory-agent/shared/proto/agent/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// commandRecheck is how often WatchCommands looks for commands without
+// being woken, which picks up commands whose not_before has passed
+const commandRecheck = 30 * time.Second
+
+// AgentService serves the agent protocol over gRPC (see
+// shared/proto/agent/v1) with the same logic as the agent REST endpoints
+type AgentService struct {
+	agentv1.UnimplementedAgentServiceServer
+
+	registration *RegistrationHandler
+	inventory    *InventoryHandler
+	policies     *PolicyHandler
+	commands     *CommandHandler
+}
+
+func NewAgentService(registration *RegistrationHandler, inventory *InventoryHandler, policies *PolicyHandler, commands *CommandHandler) *AgentService {
+	return &AgentService{
+		registration: registration,
+		inventory:    inventory,
+		policies:     policies,
+		commands:     commands,
+	}
+}
+
+// agentKey holds the authenticated device in a call's context
+type agentKey struct{}
+
+func agentFromContext(ctx context.Context) *models.Agent {
+	agent, _ := ctx.Value(agentKey{}).(*models.Agent)
+	return agent
+}
+
+// UnaryInterceptor authenticates every unary call but Register
+func (s *AgentService) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod == agentv1.AgentService_Register_FullMethodName {
+			return handler(ctx, req)
+		}
+		ctx, err := s.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor authenticates every streaming call
+func (s *AgentService) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := s.authenticate(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate checks the device-id and authorization metadata the way
+// auth.AuthMiddleware checks REST requests
+func (s *AgentService) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, ok := strings.CutPrefix(firstMetadata(md, "authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, status.Error(codes.Unauthenticated, "Bearer token required")
+	}
+
+	deviceID, err := uuid.Parse(firstMetadata(md, "device-id"))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Invalid device ID")
+	}
+
+	agent, err := auth.AuthenticateDevice(ctx, s.registration.db, deviceID, token)
+	if errors.Is(err, auth.ErrDeviceInactive) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	// A call gets a request ID like a REST request, and keeps the
+	// agent's correlation ID, for its logs and audit rows, and a logger
+	// with the request's fields
+	ctx = requestid.NewContext(ctx, firstMetadata(md, "x-request-id"), firstMetadata(md, "x-correlation-id"))
+	requestID, correlationID := requestid.FromContext(ctx)
+	method, _ := grpc.Method(ctx)
+	ctx = logging.With(ctx, "request_id", requestID, "correlation_id", correlationID,
+		"method", method, "device_id", agent.DeviceID.String())
+	return context.WithValue(ctx, agentKey{}, agent), nil
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (s *AgentService) Register(ctx context.Context, req *agentv1.RegisterRequest) (*agentv1.RegisterResponse, error) {
+	reg := RegistrationRequest{
+		DeviceID:     req.DeviceId,
+		Hostname:     req.Hostname,
+		AgentVersion: req.AgentVersion,
+		Capabilities: make([]models.Capability, len(req.Capabilities)),
+	}
+	for i, c := range req.Capabilities {
+		reg.Capabilities[i] = models.Capability{Name: c.Name, Version: c.Version}
+	}
+
+	resp, code, problem := s.registration.register(ctx, &reg)
+	if problem != nil {
+		return nil, grpcError(code, problem)
+	}
+
+	return &agentv1.RegisterResponse{
+		DeviceId:      resp.DeviceID,
+		AuthToken:     resp.AuthToken,
+		PolicyVersion: int32(resp.PolicyVersion),
+	}, nil
+}
+
+// StreamTelemetry queues each payload like POST /inventory and answers it
+// with an ack. A payload that can't be queued is acked with retry set and
+// the stream stays open.
+func (s *AgentService) StreamTelemetry(stream agentv1.AgentService_StreamTelemetryServer) error {
+	ctx := stream.Context()
+	deviceID := agentFromContext(ctx).DeviceID
+
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack, err := s.ingest(ctx, deviceID, msg)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// ingest queues one streamed payload, failing only when the device may no
+// longer report
+func (s *AgentService) ingest(ctx context.Context, deviceID uuid.UUID, msg *agentv1.TelemetryPayload) (*agentv1.TelemetryAck, error) {
+	agent, code, problem := s.inventory.loadReportingDevice(ctx, deviceID)
+	if problem != nil {
+		return nil, grpcError(code, problem)
+	}
+
+	ack := &agentv1.TelemetryAck{IngestionId: msg.IngestionId, Status: "rejected"}
+	if exceeded := s.inventory.chargeQuota(ctx, agent, 1, int64(proto.Size(msg))); exceeded != nil {
+		ack.Error = "Ingest quota exceeded: " + exceeded.Error()
+		ack.Retry = true
+		return ack, nil
+	}
+
+	payload := TelemetryPayload{
+		DeviceID:      deviceID.String(),
+		IngestionID:   msg.IngestionId,
+		AgentVersion:  msg.AgentVersion,
+		Metrics:       msg.Metrics.AsMap(),
+		Errors:        msg.Errors,
+		SchemaVersion: int(msg.SchemaVersion),
+		ClockSkewMs:   msg.ClockSkewMs,
+		Tags:          msg.Tags,
+	}
+	if msg.CollectedAt != nil {
+		payload.CollectedAt = msg.CollectedAt.AsTime()
+	}
+
+	telemetry, err := s.inventory.telemetryFromPayload(payload.DeviceID, deviceID, &payload)
+	if err != nil {
+		ack.Error = err.Error()
+		return ack, nil
+	}
+
+	if err := s.inventory.publishTelemetry(ctx, telemetry); err != nil {
+		ack.Error = "Message queue unavailable"
+		ack.Retry = true
+		return ack, nil
+	}
+
+	s.inventory.meter.RecordIngest(agent.OrgID, agent.DeviceID, 1, int64(proto.Size(msg)))
+	s.inventory.markSeen(ctx, agent, payload.ClockSkewMs)
+	return &agentv1.TelemetryAck{IngestionId: telemetry.IngestionID.String(), Status: "accepted"}, nil
+}
+
+// WatchCommands sends the device its pending commands, then each new one
+// as it is released, for as long as the stream is open. Results the agent
+// sends back are recorded like REST acks.
+func (s *AgentService) WatchCommands(stream agentv1.AgentService_WatchCommandsServer) error {
+	ctx := stream.Context()
+	deviceID := agentFromContext(ctx).DeviceID
+
+	// Subscribe before the first query so a command created in between
+	// still wakes the stream
+	var wake chan *nats.Msg
+	if s.commands.nc != nil {
+		wake = make(chan *nats.Msg, 8)
+		sub, err := s.commands.nc.ChanSubscribe(events.CommandsSubject(deviceID), wake)
+		if err != nil {
+			logging.FromContext(stream.Context()).Error("Failed to subscribe to device commands", "device_id", deviceID, "error", err)
+			wake = nil
+		} else {
+			defer sub.Unsubscribe()
+		}
+	}
+
+	results := make(chan error, 1)
+	go func() {
+		results <- s.receiveResults(stream, deviceID)
+	}()
+
+	ticker := time.NewTicker(commandRecheck)
+	defer ticker.Stop()
+
+	for {
+		commands, err := s.commands.claimCommands(ctx, deviceID)
+		if err != nil {
+			return status.Error(codes.Internal, "Failed to query commands")
+		}
+		for i := range commands {
+			if err := stream.Send(commandMessage(&commands[i])); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case err := <-results:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// receiveResults records the command results the agent sends until it
+// closes its side of the stream
+func (s *AgentService) receiveResults(stream agentv1.AgentService_WatchCommandsServer, deviceID uuid.UUID) error {
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		commandID, err := uuid.Parse(msg.CommandId)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "Invalid command ID")
+		}
+		if err := s.commands.ackCommand(stream.Context(), deviceID, commandID, msg.Result.AsMap(), msg.Error); err != nil {
+			return status.Error(codes.Internal, "Failed to update command")
+		}
+	}
+}
+
+func commandMessage(cmd *models.Command) *agentv1.Command {
+	params, err := structpb.NewStruct(cmd.Parameters)
+	if err != nil {
+		slog.Error("Failed to encode parameters of command", "command_id", cmd.CommandID, "error", err)
+	}
+	return &agentv1.Command{
+		CommandId:  cmd.CommandID.String(),
+		Type:       cmd.Type,
+		Parameters: params,
+		IssuedAt:   timestamppb.New(cmd.IssuedAt),
+		TtlSeconds: int32(cmd.TTLSeconds),
+	}
+}
+
+// GetPolicy returns the policy GET /policy serves, or not_modified when the
+// agent's ETag still matches
+func (s *AgentService) GetPolicy(ctx context.Context, req *agentv1.GetPolicyRequest) (*agentv1.GetPolicyResponse, error) {
+	deviceID := agentFromContext(ctx).DeviceID
+
+	policy, err := s.policies.effectivePolicy(ctx, deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, status.Error(codes.NotFound, "Device not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to query policies")
+	}
+
+	etag := policy.GenerateETag()
+	if req.Etag != "" && req.Etag == etag {
+		return &agentv1.GetPolicyResponse{Etag: etag, NotModified: true}, nil
+	}
+
+	// The policy travels as the same JSON document REST serves
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to encode policy")
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, status.Error(codes.Internal, "Failed to encode policy")
+	}
+	doc, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to encode policy")
+	}
+
+	return &agentv1.GetPolicyResponse{Etag: etag, Policy: doc}, nil
+}
+
+// grpcError converts the status and body a REST handler would respond with
+// into a gRPC status
+func grpcError(httpStatus int, problem fiber.Map) error {
+	msg, _ := problem["error"].(string)
+
+	code := codes.Internal
+	switch httpStatus {
+	case 400:
+		code = codes.InvalidArgument
+	case 401:
+		code = codes.Unauthenticated
+	case 403:
+		code = codes.PermissionDenied
+	case 404:
+		code = codes.NotFound
+	case 409:
+		code = codes.AlreadyExists
+	case 413:
+		code = codes.ResourceExhausted
+	case 503:
+		code = codes.Unavailable
+	}
+	return status.Error(code, msg)
+}
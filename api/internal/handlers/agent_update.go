@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/requestid"
+)
+
+// AgentUpdateHandler serves agents the release their rollout offers them and
+// records their progress installing it
+type AgentUpdateHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewAgentUpdateHandler(db *pgxpool.Pool) *AgentUpdateHandler {
+	return &AgentUpdateHandler{db: db}
+}
+
+// GetUpdate returns the update manifest for the device, or 204 when it has
+// nothing to install. Query parameters: platform (default windows), arch
+// (default amd64) and version, the running agent version, which defaults to
+// the version the agent registered with. A device that failed or rolled back
+// the release isn't offered it again by the same rollout.
+func (h *AgentUpdateHandler) GetUpdate(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	version := c.Query("version")
+	if version == "" {
+		err = h.db.QueryRow(c.UserContext(),
+			"SELECT COALESCE(agent_version, '') FROM agents WHERE device_id = $1",
+			agent.DeviceID).Scan(&version)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to load agent version"})
+		}
+	}
+
+	rollout, release, err := database.DeviceRollout(c.UserContext(), h.db, agent.DeviceID, agent.OrgID,
+		c.Query("platform", "windows"), c.Query("arch", "amd64"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query rollouts"})
+	}
+	if rollout == nil || rollout.Status == models.RolloutPaused {
+		return c.SendStatus(204)
+	}
+
+	if version == release.Version {
+		_, err = h.db.Exec(c.UserContext(), `
+			INSERT INTO agent_rollout_devices (rollout_id, device_id, status)
+			VALUES ($1, $2, 'installed')
+			ON CONFLICT (rollout_id, device_id) DO UPDATE SET status = 'installed', error = NULL
+			WHERE agent_rollout_devices.status <> 'installed'`,
+			rollout.RolloutID, agent.DeviceID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to record upgrade status"})
+		}
+		return c.SendStatus(204)
+	}
+
+	// Record the offer, keeping any progress already reported
+	var status string
+	err = h.db.QueryRow(c.UserContext(), `
+		INSERT INTO agent_rollout_devices (rollout_id, device_id, status, from_version)
+		VALUES ($1, $2, 'offered', NULLIF($3, ''))
+		ON CONFLICT (rollout_id, device_id) DO UPDATE SET status = agent_rollout_devices.status
+		RETURNING status`,
+		rollout.RolloutID, agent.DeviceID, version).Scan(&status)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record upgrade status"})
+	}
+	if status == models.UpgradeFailed || status == models.UpgradeRolledBack {
+		return c.SendStatus(204)
+	}
+
+	url := release.URL
+	if release.Uploaded {
+		url = fmt.Sprintf("%s/v1/agents/%s/releases/%d/download", c.BaseURL(), agent.DeviceID, release.ReleaseID)
+	}
+
+	return c.JSON(models.UpdateManifest{
+		RolloutID: rollout.RolloutID,
+		ReleaseID: release.ReleaseID,
+		Version:   release.Version,
+		URL:       url,
+		SHA256:    release.SHA256,
+		SizeBytes: release.SizeBytes,
+		Signature: release.Signature,
+	})
+}
+
+// ReportStatus records the agent's progress installing a rollout's release.
+// A rollout with max_failures is paused once that many devices have failed
+// or rolled back.
+func (h *AgentUpdateHandler) ReportStatus(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	var report models.UpgradeReport
+	if err := c.BodyParser(&report); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := report.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid upgrade report: " + err.Error()})
+	}
+
+	var version string
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE agent_rollout_devices d SET status = $3, error = NULLIF($4, '')
+		FROM agent_rollouts r
+		JOIN agent_releases rel ON rel.release_id = r.release_id
+		WHERE d.rollout_id = $1 AND d.device_id = $2 AND r.rollout_id = d.rollout_id
+		RETURNING rel.version`,
+		report.RolloutID, agent.DeviceID, report.Status, report.Error).Scan(&version)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Device was not offered this rollout"})
+	}
+
+	switch report.Status {
+	case models.UpgradeInstalled:
+		_, err = h.db.Exec(c.UserContext(),
+			"UPDATE agents SET agent_version = $2 WHERE device_id = $1", agent.DeviceID, version)
+		if err != nil {
+			// Log but don't fail
+		}
+	case models.UpgradeFailed, models.UpgradeRolledBack:
+		h.checkFailures(c, report.RolloutID)
+	}
+
+	return c.JSON(fiber.Map{"status": report.Status})
+}
+
+// checkFailures pauses an active rollout that has reached its max_failures
+func (h *AgentUpdateHandler) checkFailures(c *fiber.Ctx, rolloutID int64) {
+	requestID, correlationID := requestid.FromContext(c.UserContext())
+	tag, err := h.db.Exec(c.UserContext(), `
+		WITH paused AS (
+			UPDATE agent_rollouts r SET status = 'paused', paused_reason = 'max_failures reached'
+			WHERE r.rollout_id = $1 AND r.status = 'active' AND r.max_failures IS NOT NULL
+			  AND (SELECT COUNT(*) FROM agent_rollout_devices d
+			       WHERE d.rollout_id = r.rollout_id AND d.status IN ('failed', 'rolled_back')) >= r.max_failures
+			RETURNING r.rollout_id, r.max_failures
+		)
+		INSERT INTO audit_log (actor, action, resource_type, resource_id, details, request_id, correlation_id)
+		SELECT 'system', 'pause', 'rollout', rollout_id::text,
+		       jsonb_build_object('reason', 'max_failures reached', 'max_failures', max_failures),
+		       NULLIF($2, ''), NULLIF($3, '')
+		FROM paused`, rolloutID, requestID, correlationID)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to check failures of rollout", "rollout_id", rolloutID, "error", err)
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		logging.FromContext(c.UserContext()).Info("Paused rollout after reaching its failure limit", "rollout_id", rolloutID)
+	}
+}
+
+// GetReleaseManifest returns the update manifest of a release by ID, for an
+// agent.upgrade command naming it. The manifest has no rollout. Query
+// parameters platform (default windows) and arch (default amd64) describe
+// the device; a release built for another gets 409.
+func (h *AgentUpdateHandler) GetReleaseManifest(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	releaseID, err := strconv.ParseInt(c.Params("releaseId"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid release ID"})
+	}
+
+	var release models.AgentRelease
+	err = scanRelease(h.db.QueryRow(c.UserContext(), `
+		SELECT `+releaseColumns+` FROM agent_releases rel
+		WHERE rel.release_id = $1 AND rel.org_id = $2`,
+		releaseID, agent.OrgID), &release)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Release not found"})
+	}
+
+	platform, arch := c.Query("platform", "windows"), c.Query("arch", "amd64")
+	if release.Platform != platform || release.Arch != arch {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Release is for %s/%s, not %s/%s", release.Platform, release.Arch, platform, arch)})
+	}
+
+	url := release.URL
+	if release.Uploaded {
+		url = fmt.Sprintf("%s/v1/agents/%s/releases/%d/download", c.BaseURL(), agent.DeviceID, release.ReleaseID)
+	}
+
+	return c.JSON(models.UpdateManifest{
+		ReleaseID: release.ReleaseID,
+		Version:   release.Version,
+		URL:       url,
+		SHA256:    release.SHA256,
+		SizeBytes: release.SizeBytes,
+		Signature: release.Signature,
+	})
+}
+
+// DownloadRelease serves an uploaded release artifact
+func (h *AgentUpdateHandler) DownloadRelease(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	releaseID, err := strconv.ParseInt(c.Params("releaseId"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid release ID"})
+	}
+
+	var path, version, platform, arch string
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT file_path, version, platform, arch FROM agent_releases
+		WHERE release_id = $1 AND org_id = $2 AND file_path IS NOT NULL`,
+		releaseID, agent.OrgID).Scan(&path, &version, &platform, &arch)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Release not found"})
+	}
+
+	return c.Download(path, fmt.Sprintf("inventory-agent-%s-%s-%s%s", version, platform, arch, filepath.Ext(path)))
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type AlertHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewAlertHandler(db *pgxpool.Pool) *AlertHandler {
+	return &AlertHandler{db: db}
+}
+
+const alertRuleColumns = `rule_id, org_id, name, COALESCE(description, ''), kind,
+	COALESCE(metric, ''), COALESCE(field, ''), COALESCE(percent_of, ''), COALESCE(operator, ''),
+	threshold, severity, group_id, enabled, COALESCE(created_by, ''), created_at, updated_at`
+
+func scanAlertRule(row pgx.Row, r *models.AlertRule) error {
+	return row.Scan(&r.RuleID, &r.OrgID, &r.Name, &r.Description, &r.Kind,
+		&r.Metric, &r.Field, &r.PercentOf, &r.Operator,
+		&r.Threshold, &r.Severity, &r.GroupID, &r.Enabled, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt)
+}
+
+func (h *AlertHandler) GetRules(c *fiber.Ctx) error {
+	rows, err := h.db.Query(c.UserContext(), `SELECT `+alertRuleColumns+` FROM alert_rules ORDER BY name`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query alert rules"})
+	}
+	defer rows.Close()
+
+	rules := []models.AlertRule{}
+	for rows.Next() {
+		var r models.AlertRule
+		if err := scanAlertRule(rows, &r); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan alert rule"})
+		}
+		rules = append(rules, r)
+	}
+
+	return c.JSON(fiber.Map{"data": rules})
+}
+
+func (h *AlertHandler) GetRule(c *fiber.Ctx) error {
+	ruleID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule ID"})
+	}
+
+	r, err := loadAlertRule(c.UserContext(), h.db, ruleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert rule not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": r})
+}
+
+// CreateRule adds an alert rule. It is first evaluated against the whole
+// fleet on the evaluator's next pass.
+func (h *AlertHandler) CreateRule(c *fiber.Ctx) error {
+	var r models.AlertRule
+	r.Enabled = true
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule data"})
+	}
+
+	if err := r.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule: " + err.Error()})
+	}
+
+	if r.OrgID == 0 {
+		r.OrgID = 1
+	}
+	r.CreatedBy = adminUser(c)
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO alert_rules (org_id, name, description, kind, metric, field, percent_of, operator,
+		                         threshold, severity, group_id, enabled, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11, $12, $13)
+		RETURNING rule_id, created_at, updated_at`,
+		r.OrgID, r.Name, r.Description, r.Kind, r.Metric, r.Field, r.PercentOf, r.Operator,
+		r.Threshold, r.Severity, r.GroupID, r.Enabled, r.CreatedBy).Scan(
+		&r.RuleID, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return alertRuleWriteError(c, err, "Failed to create alert rule")
+	}
+
+	err = audit.Record(c.UserContext(), h.db, r.CreatedBy, "create_alert_rule", "alert_rule", strconv.FormatInt(r.RuleID, 10),
+		map[string]interface{}{"name": r.Name, "kind": r.Kind, "severity": r.Severity})
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": r})
+}
+
+// UpdateRule replaces an alert rule. Disabling a rule resolves its firing
+// alerts on the evaluator's next pass.
+func (h *AlertHandler) UpdateRule(c *fiber.Ctx) error {
+	ruleID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule ID"})
+	}
+
+	var r models.AlertRule
+	r.Enabled = true
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule data"})
+	}
+
+	if err := r.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule: " + err.Error()})
+	}
+
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE alert_rules
+		SET name = $2, description = $3, kind = $4, metric = NULLIF($5, ''), field = NULLIF($6, ''),
+		    percent_of = NULLIF($7, ''), operator = NULLIF($8, ''), threshold = $9, severity = $10,
+		    group_id = $11, enabled = $12
+		WHERE rule_id = $1
+		RETURNING rule_id, org_id, COALESCE(created_by, ''), created_at, updated_at`,
+		ruleID, r.Name, r.Description, r.Kind, r.Metric, r.Field, r.PercentOf, r.Operator,
+		r.Threshold, r.Severity, r.GroupID, r.Enabled).Scan(
+		&r.RuleID, &r.OrgID, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert rule not found"})
+	}
+	if err != nil {
+		return alertRuleWriteError(c, err, "Failed to update alert rule")
+	}
+
+	err = audit.Record(c.UserContext(), h.db, adminUser(c), "update_alert_rule", "alert_rule", strconv.FormatInt(r.RuleID, 10),
+		map[string]interface{}{"name": r.Name, "kind": r.Kind, "severity": r.Severity, "enabled": r.Enabled})
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return c.JSON(fiber.Map{"data": r})
+}
+
+func (h *AlertHandler) DeleteRule(c *fiber.Ctx) error {
+	ruleID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule ID"})
+	}
+
+	// The rule's alerts are removed by ON DELETE CASCADE
+	result, err := h.db.Exec(c.UserContext(), "DELETE FROM alert_rules WHERE rule_id = $1", ruleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete alert rule"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert rule not found"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, adminUser(c), "delete_alert_rule", "alert_rule", strconv.FormatInt(ruleID, 10),
+		map[string]interface{}{})
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return c.JSON(fiber.Map{"message": "Alert rule deleted"})
+}
+
+const alertColumns = `al.alert_id, al.rule_id, r.name, r.severity, al.device_id, a.hostname, al.status, al.value,
+	al.fired_at, al.last_evaluated_at, al.resolved_at, al.acknowledged_by, al.acknowledged_at`
+
+func scanAlert(row pgx.Row, al *models.Alert) error {
+	return row.Scan(&al.AlertID, &al.RuleID, &al.RuleName, &al.Severity, &al.DeviceID, &al.Hostname,
+		&al.Status, &al.Value, &al.FiredAt, &al.LastEvaluatedAt, &al.ResolvedAt, &al.AcknowledgedBy, &al.AcknowledgedAt)
+}
+
+// GetAlerts lists alerts newest first, filterable by status, severity,
+// rule_id and device_id
+func (h *AlertHandler) GetAlerts(c *fiber.Ctx) error {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		where += ` AND al.status = $` + strconv.Itoa(len(args))
+	}
+
+	if severity := c.Query("severity"); severity != "" {
+		args = append(args, severity)
+		where += ` AND r.severity = $` + strconv.Itoa(len(args))
+	}
+
+	if s := c.Query("rule_id"); s != "" {
+		ruleID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid alert rule ID"})
+		}
+		args = append(args, ruleID)
+		where += ` AND al.rule_id = $` + strconv.Itoa(len(args))
+	}
+
+	if s := c.Query("device_id"); s != "" {
+		deviceID, err := uuid.Parse(s)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+		}
+		args = append(args, deviceID)
+		where += ` AND al.device_id = $` + strconv.Itoa(len(args))
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.Int64CursorWhere(cur, "al.fired_at", "al.alert_id", args)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		where += cursorWhere
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT `+alertColumns+`
+		FROM alerts al
+		JOIN alert_rules r ON r.rule_id = al.rule_id
+		JOIN agents a ON a.device_id = al.device_id`+where+`
+		ORDER BY al.fired_at DESC, al.alert_id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1),
+		append(args, limit+1)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query alerts"})
+	}
+	defer rows.Close()
+
+	alerts := []models.Alert{}
+	for rows.Next() {
+		var al models.Alert
+		if err := scanAlert(rows, &al); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan alert"})
+		}
+		alerts = append(alerts, al)
+	}
+
+	var nextCursor string
+	if len(alerts) > limit {
+		alerts = alerts[:limit]
+		last := alerts[limit-1]
+		nextCursor = database.EncodeCursor(last.FiredAt, strconv.FormatInt(last.AlertID, 10))
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        alerts,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
+
+func (h *AlertHandler) GetAlert(c *fiber.Ctx) error {
+	alertID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert ID"})
+	}
+
+	var al models.Alert
+	err = scanAlert(h.db.QueryRow(c.UserContext(), `
+		SELECT `+alertColumns+`
+		FROM alerts al
+		JOIN alert_rules r ON r.rule_id = al.rule_id
+		JOIN agents a ON a.device_id = al.device_id
+		WHERE al.alert_id = $1`, alertID), &al)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": al})
+}
+
+// AcknowledgeAlert records that an admin has seen an alert. It doesn't
+// change whether the alert is firing.
+func (h *AlertHandler) AcknowledgeAlert(c *fiber.Ctx) error {
+	alertID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid alert ID"})
+	}
+
+	user := adminUser(c)
+	result, err := h.db.Exec(c.UserContext(), `
+		UPDATE alerts SET acknowledged_by = $2, acknowledged_at = NOW()
+		WHERE alert_id = $1`, alertID, user)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to acknowledge alert"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Alert not found"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, user, "acknowledge_alert", "alert", strconv.FormatInt(alertID, 10),
+		map[string]interface{}{})
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return c.JSON(fiber.Map{"message": "Alert acknowledged"})
+}
+
+// alertRuleWriteError maps constraint violations on insert or update to
+// client errors
+func alertRuleWriteError(c *fiber.Ctx, err error, message string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23503":
+			return c.Status(400).JSON(fiber.Map{"error": "Group not found"})
+		case "23505":
+			return c.Status(409).JSON(fiber.Map{"error": "An alert rule with this name already exists"})
+		}
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
+
+func loadAlertRule(ctx context.Context, db *pgxpool.Pool, ruleID int64) (*models.AlertRule, error) {
+	var r models.AlertRule
+	err := scanAlertRule(db.QueryRow(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules WHERE rule_id = $1`, ruleID), &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
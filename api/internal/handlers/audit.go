@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/export"
+)
+
+type AuditHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditHandler(db *pgxpool.Pool) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+type AuditEntry struct {
+	LogID        int64                  `json:"log_id"`
+	Timestamp    time.Time              `json:"timestamp"`
+	Actor        string                 `json:"actor"`
+	Action       string                 `json:"action"`
+	ResourceType string                 `json:"resource_type"`
+	ResourceID   string                 `json:"resource_id"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	// RequestID is the API request that wrote the entry and CorrelationID
+	// the ID its caller sent, when it sent one
+	RequestID     string `json:"request_id,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// GetAuditLog lists audit entries newest first. Query parameters: actor,
+// action, resource_type, resource_id, request_id, correlation_id, since
+// (RFC 3339) and format=csv|xlsx.
+func (h *AuditHandler) GetAuditLog(c *fiber.Ctx) error {
+	params := queryValues(c)
+	if params.Get("format") != "" {
+		return streamExport(c, h.db, nil, export.KindAudit, params)
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	where, args, err := database.AuditLogWhere(params)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// A cursor continues a keyset scan and takes precedence over offset
+	pageWhere, pageArgs := where, append([]interface{}{}, args...)
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, pageArgs, err = database.Int64CursorWhere(cur, "l.timestamp", "l.log_id", pageArgs)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		pageWhere += cursorWhere
+		offset = 0
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT l.log_id, l.timestamp,
+		       COALESCE(l.actor, ''), l.action, l.resource_type, COALESCE(l.resource_id, ''), l.details,
+		       COALESCE(l.request_id, ''), COALESCE(l.correlation_id, '')
+		FROM audit_log l`+pageWhere+`
+		ORDER BY l.timestamp DESC, l.log_id DESC
+		LIMIT $`+strconv.Itoa(len(pageArgs)+1)+` OFFSET $`+strconv.Itoa(len(pageArgs)+2),
+		append(pageArgs, limit+1, offset)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query audit log"})
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.LogID, &e.Timestamp, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID, &e.Details,
+			&e.RequestID, &e.CorrelationID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan audit entry"})
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+
+	var nextCursor string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		nextCursor = database.EncodeCursor(last.Timestamp, strconv.FormatInt(last.LogID, 10))
+	}
+
+	var total int64
+	err = h.db.QueryRow(c.UserContext(), `SELECT COUNT(*) FROM audit_log l`+where, args...).Scan(&total)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to get total count"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        entries,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// commandArtifactChunkSize is the size of each chunk but the last an agent
+// uploads an artifact in. Chunks are kept well under the request size limit
+// and few enough that an artifact doesn't exhaust the device's rate limit.
+const commandArtifactChunkSize = 4 << 20
+
+// CommandArtifactHandler takes command output too large for an ack from
+// agents in chunks, and serves it to admins
+type CommandArtifactHandler struct {
+	db       *pgxpool.Pool
+	maxBytes int64
+}
+
+func NewCommandArtifactHandler(db *pgxpool.Pool, maxBytes int64) *CommandArtifactHandler {
+	return &CommandArtifactHandler{db: db, maxBytes: maxBytes}
+}
+
+// CreateArtifact declares an artifact of a command the device is running:
+// its name, content type, size and SHA-256. The response gives the
+// artifact's ID and the chunk size to upload it in.
+func (h *CommandArtifactHandler) CreateArtifact(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	commandID, err := uuid.Parse(c.Params("cmdId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command ID"})
+	}
+
+	var a models.CommandArtifact
+	if err := c.BodyParser(&a); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid artifact"})
+	}
+	if err := a.Validate(h.maxBytes); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid artifact: " + err.Error()})
+	}
+	if a.ContentType == "" {
+		a.ContentType = "application/octet-stream"
+	}
+	a.SHA256 = strings.ToLower(a.SHA256)
+	a.ChunkSize = commandArtifactChunkSize
+
+	// Only a command the device has picked up and not yet acked takes
+	// artifacts
+	err = h.db.QueryRow(c.UserContext(), `
+		INSERT INTO command_artifacts (command_id, name, content_type, size_bytes, sha256, chunk_size)
+		SELECT command_id, $3, $4, $5, $6, $7 FROM commands
+		WHERE command_id = $1 AND device_id = $2 AND status = 'executing'
+		RETURNING artifact_id, command_id, created_at`,
+		commandID, agent.DeviceID, a.Name, a.ContentType, a.SizeBytes, a.SHA256, a.ChunkSize).Scan(
+		&a.ArtifactID, &a.CommandID, &a.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "No running command found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create artifact"})
+	}
+
+	return c.Status(201).JSON(a)
+}
+
+// PutArtifactChunk stores one chunk of an artifact. Every chunk but the
+// last is the artifact's chunk size. A chunk may be sent again, replacing
+// it, until the artifact is complete.
+func (h *CommandArtifactHandler) PutArtifactChunk(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	a, err := h.agentArtifact(c, agent.DeviceID)
+	if a == nil {
+		return err
+	}
+	if a.CompletedAt != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Artifact is already complete"})
+	}
+
+	index, err := strconv.Atoi(c.Params("index"))
+	if err != nil || index < 0 || index >= a.Chunks() {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid chunk index"})
+	}
+	want := int64(a.ChunkSize)
+	if index == a.Chunks()-1 {
+		want = a.SizeBytes - int64(index)*int64(a.ChunkSize)
+	}
+	body := c.Body()
+	if int64(len(body)) != want {
+		return c.Status(400).JSON(fiber.Map{"error": "Chunk " + strconv.Itoa(index) + " must be " + strconv.FormatInt(want, 10) + " bytes"})
+	}
+
+	_, err = h.db.Exec(c.UserContext(), `
+		INSERT INTO command_artifact_chunks (artifact_id, chunk_index, data)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (artifact_id, chunk_index) DO UPDATE SET data = EXCLUDED.data`,
+		a.ArtifactID, index, body)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to store chunk"})
+	}
+
+	return c.SendStatus(204)
+}
+
+// CompleteArtifact checks every chunk of an artifact is in and that
+// together they match its SHA-256, and marks it complete. An artifact that
+// doesn't match gets a 409 and its chunks can be sent again.
+func (h *CommandArtifactHandler) CompleteArtifact(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	a, err := h.agentArtifact(c, agent.DeviceID)
+	if a == nil {
+		return err
+	}
+	if a.CompletedAt != nil {
+		return c.JSON(a)
+	}
+
+	r := newArtifactReader(c.UserContext(), h.db, a)
+	hash := sha256.New()
+	n, err := io.Copy(hash, r)
+	if errors.Is(err, errMissingChunk) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to read artifact chunks", "artifact_id", a.ArtifactID, "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read artifact"})
+	}
+	if n != a.SizeBytes || hex.EncodeToString(hash.Sum(nil)) != a.SHA256 {
+		return c.Status(409).JSON(fiber.Map{"error": "Artifact does not match its sha256"})
+	}
+
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE command_artifacts SET completed_at = NOW()
+		WHERE artifact_id = $1
+		RETURNING completed_at`, a.ArtifactID).Scan(&a.CompletedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to complete artifact"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, "agent", "upload_command_artifact", "command", a.CommandID.String(),
+		map[string]interface{}{"artifact_id": a.ArtifactID, "name": a.Name, "size_bytes": a.SizeBytes})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to write audit log for command artifact", "artifact_id", a.ArtifactID, "error", err)
+	}
+
+	return c.JSON(a)
+}
+
+// GetCommandArtifacts lists a command's artifacts, including ones still
+// being uploaded
+func (h *CommandArtifactHandler) GetCommandArtifacts(c *fiber.Ctx) error {
+	commandID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command ID"})
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT artifact_id, command_id, name, content_type, size_bytes, sha256, chunk_size, created_at, completed_at
+		FROM command_artifacts WHERE command_id = $1
+		ORDER BY created_at`, commandID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query artifacts"})
+	}
+	artifacts, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.CommandArtifact])
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query artifacts"})
+	}
+
+	return c.JSON(fiber.Map{"data": artifacts})
+}
+
+// DownloadCommandArtifact streams a complete artifact, a chunk at a time
+func (h *CommandArtifactHandler) DownloadCommandArtifact(c *fiber.Ctx) error {
+	commandID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command ID"})
+	}
+	artifactID, err := uuid.Parse(c.Params("artifactId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid artifact ID"})
+	}
+
+	a, err := loadCommandArtifact(c.UserContext(), h.db, `a.artifact_id = $1 AND a.command_id = $2`, artifactID, commandID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Artifact not found"})
+	}
+	if a.CompletedAt == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Artifact is still being uploaded"})
+	}
+
+	c.Attachment(a.Name)
+	c.Set(fiber.HeaderContentType, a.ContentType)
+	c.Set("X-Content-SHA256", a.SHA256)
+	// Streamed after the handler returns, so not tied to its context
+	c.Context().SetBodyStream(newArtifactReader(context.Background(), h.db, a), int(a.SizeBytes))
+	return nil
+}
+
+// agentArtifact loads the artifact in the route. Unless it belongs to one
+// of the device's commands it sends an error response instead, returning
+// a nil artifact and the response's error.
+func (h *CommandArtifactHandler) agentArtifact(c *fiber.Ctx, deviceID uuid.UUID) (*models.CommandArtifact, error) {
+	commandID, err := uuid.Parse(c.Params("cmdId"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid command ID"})
+	}
+	artifactID, err := uuid.Parse(c.Params("artifactId"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid artifact ID"})
+	}
+
+	a, err := loadCommandArtifact(c.UserContext(), h.db,
+		`a.artifact_id = $1 AND a.command_id = $2 AND c.device_id = $3`, artifactID, commandID, deviceID)
+	if err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Artifact not found"})
+	}
+	return a, nil
+}
+
+func loadCommandArtifact(ctx context.Context, db *pgxpool.Pool, where string, args ...interface{}) (*models.CommandArtifact, error) {
+	var a models.CommandArtifact
+	err := db.QueryRow(ctx, `
+		SELECT a.artifact_id, a.command_id, a.name, a.content_type, a.size_bytes, a.sha256, a.chunk_size, a.created_at, a.completed_at
+		FROM command_artifacts a JOIN commands c ON c.command_id = a.command_id
+		WHERE `+where, args...).Scan(
+		&a.ArtifactID, &a.CommandID, &a.Name, &a.ContentType, &a.SizeBytes, &a.SHA256, &a.ChunkSize, &a.CreatedAt, &a.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+var errMissingChunk = errors.New("artifact is missing chunks")
+
+// artifactReader reads an artifact's chunks in order, fetching one at a
+// time so a large artifact is never held in memory whole
+type artifactReader struct {
+	ctx      context.Context
+	db       *pgxpool.Pool
+	artifact *models.CommandArtifact
+	next     int
+	buf      []byte
+}
+
+func newArtifactReader(ctx context.Context, db *pgxpool.Pool, a *models.CommandArtifact) *artifactReader {
+	return &artifactReader{ctx: ctx, db: db, artifact: a}
+}
+
+func (r *artifactReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next >= r.artifact.Chunks() {
+			return 0, io.EOF
+		}
+		err := r.db.QueryRow(r.ctx, `
+			SELECT data FROM command_artifact_chunks WHERE artifact_id = $1 AND chunk_index = $2`,
+			r.artifact.ArtifactID, r.next).Scan(&r.buf)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, errMissingChunk
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.next++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
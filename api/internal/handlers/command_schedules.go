@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+const commandScheduleColumns = `schedule_id, org_id, name, type, parameters, ttl_seconds, device_id, group_id,
+	cron, timezone, enabled, next_run_at, last_run_at, COALESCE(created_by, ''), created_at, updated_at`
+
+func scanCommandSchedule(row pgx.Row, s *models.CommandSchedule) error {
+	return row.Scan(&s.ScheduleID, &s.OrgID, &s.Name, &s.Type, &s.Parameters, &s.TTLSeconds, &s.DeviceID, &s.GroupID,
+		&s.Cron, &s.Timezone, &s.Enabled, &s.NextRunAt, &s.LastRunAt, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// parseCommandSchedule reads and validates a schedule body, applying the
+// same command schema checks as CreateCommand. It returns the 400 response
+// body when the schedule is invalid.
+func (h *CommandAdminHandler) parseCommandSchedule(c *fiber.Ctx) (*models.CommandSchedule, fiber.Map) {
+	s := models.CommandSchedule{Enabled: true, Timezone: "UTC", TTLSeconds: 3600}
+	if err := c.BodyParser(&s); err != nil {
+		return nil, fiber.Map{"error": "Invalid schedule data"}
+	}
+
+	spec := map[string]interface{}{"type": s.Type, "parameters": s.Parameters, "ttl_seconds": s.TTLSeconds}
+	if result := schemaErrors(h.validator, "command", spec); result != nil {
+		return nil, fiber.Map{"error": "Invalid command", "validation": result}
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, fiber.Map{"error": "Invalid schedule: " + err.Error()}
+	}
+
+	return &s, nil
+}
+
+func (h *CommandAdminHandler) GetCommandSchedules(c *fiber.Ctx) error {
+	rows, err := h.db.Query(c.UserContext(), `SELECT `+commandScheduleColumns+` FROM command_schedules ORDER BY name`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query schedules"})
+	}
+	defer rows.Close()
+
+	schedules := []models.CommandSchedule{}
+	for rows.Next() {
+		var s models.CommandSchedule
+		if err := scanCommandSchedule(rows, &s); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan schedule"})
+		}
+		schedules = append(schedules, s)
+	}
+
+	return c.JSON(fiber.Map{"data": schedules})
+}
+
+func (h *CommandAdminHandler) GetCommandSchedule(c *fiber.Ctx) error {
+	scheduleID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule ID"})
+	}
+
+	var s models.CommandSchedule
+	err = scanCommandSchedule(h.db.QueryRow(c.UserContext(),
+		`SELECT `+commandScheduleColumns+` FROM command_schedules WHERE schedule_id = $1`, scheduleID), &s)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Schedule not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": s})
+}
+
+// CreateCommandSchedule adds a recurring command; its first run is the next
+// time the cron expression matches
+func (h *CommandAdminHandler) CreateCommandSchedule(c *fiber.Ctx) error {
+	s, problem := h.parseCommandSchedule(c)
+	if problem != nil {
+		return c.Status(400).JSON(problem)
+	}
+
+	if s.OrgID == 0 {
+		s.OrgID = 1
+	}
+	s.CreatedBy = adminUser(c)
+	s.NextRunAt, _ = s.NextRun(time.Now())
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO command_schedules (org_id, name, type, parameters, ttl_seconds, device_id, group_id,
+		                               cron, timezone, enabled, next_run_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING schedule_id, created_at, updated_at`,
+		s.OrgID, s.Name, s.Type, s.Parameters, s.TTLSeconds, s.DeviceID, s.GroupID,
+		s.Cron, s.Timezone, s.Enabled, s.NextRunAt, s.CreatedBy).Scan(
+		&s.ScheduleID, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return commandScheduleWriteError(c, err, "Failed to create schedule")
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": s})
+}
+
+// UpdateCommandSchedule replaces a schedule and recomputes its next run
+func (h *CommandAdminHandler) UpdateCommandSchedule(c *fiber.Ctx) error {
+	scheduleID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule ID"})
+	}
+
+	s, problem := h.parseCommandSchedule(c)
+	if problem != nil {
+		return c.Status(400).JSON(problem)
+	}
+	s.NextRunAt, _ = s.NextRun(time.Now())
+
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE command_schedules
+		SET name = $2, type = $3, parameters = $4, ttl_seconds = $5, device_id = $6, group_id = $7,
+		    cron = $8, timezone = $9, enabled = $10, next_run_at = $11
+		WHERE schedule_id = $1
+		RETURNING schedule_id, org_id, last_run_at, COALESCE(created_by, ''), created_at, updated_at`,
+		scheduleID, s.Name, s.Type, s.Parameters, s.TTLSeconds, s.DeviceID, s.GroupID,
+		s.Cron, s.Timezone, s.Enabled, s.NextRunAt).Scan(
+		&s.ScheduleID, &s.OrgID, &s.LastRunAt, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Schedule not found"})
+	}
+	if err != nil {
+		return commandScheduleWriteError(c, err, "Failed to update schedule")
+	}
+
+	return c.JSON(fiber.Map{"data": s})
+}
+
+// DeleteCommandSchedule stops a schedule. Commands it already created are
+// kept.
+func (h *CommandAdminHandler) DeleteCommandSchedule(c *fiber.Ctx) error {
+	scheduleID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule ID"})
+	}
+
+	result, err := h.db.Exec(c.UserContext(), "DELETE FROM command_schedules WHERE schedule_id = $1", scheduleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete schedule"})
+	}
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Schedule not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Schedule deleted"})
+}
+
+func commandScheduleWriteError(c *fiber.Ctx, err error, message string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23503":
+			return c.Status(400).JSON(fiber.Map{"error": "Device or group not found"})
+		case "23505":
+			return c.Status(409).JSON(fiber.Map{"error": "A schedule with this name already exists"})
+		}
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
@@ -1,14 +1,30 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
 	"github.com/yourorg/inventory-agent/api/internal/models"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// maxCommandWait caps how long ?wait= holds a command poll open
+const maxCommandWait = 60 * time.Second
+
 type CommandHandler struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	publisher *events.Publisher
+	nc        *nats.Conn
 }
 
 type CommandRequest struct {
@@ -17,10 +33,13 @@ type CommandRequest struct {
 	TTLSeconds int                    `json:"ttl_seconds"`
 }
 
-func NewCommandHandler(db *pgxpool.Pool) *CommandHandler {
-	return &CommandHandler{db: db}
+func NewCommandHandler(db *pgxpool.Pool, publisher *events.Publisher, nc *nats.Conn) *CommandHandler {
+	return &CommandHandler{db: db, publisher: publisher, nc: nc}
 }
 
+// GetCommands hands the device its pending commands. With ?wait= (e.g. 30s,
+// at most a minute) and nothing pending, the request is held open until a
+// command is created for the device or the wait elapses.
 func (h *CommandHandler) GetCommands(c *fiber.Ctx) error {
 	deviceIDStr := c.Params("id")
 	deviceID, err := uuid.Parse(deviceIDStr)
@@ -28,17 +47,70 @@ func (h *CommandHandler) GetCommands(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
 	}
 
-	// Query pending commands that haven't expired
-	rows, err := h.db.Query(c.Context(), `
-		SELECT command_id, type, parameters, issued_at, ttl_seconds, status
+	var wait time.Duration
+	if s := c.Query("wait"); s != "" {
+		wait, err = time.ParseDuration(s)
+		if err != nil || wait < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid wait duration"})
+		}
+		if wait > maxCommandWait {
+			wait = maxCommandWait
+		}
+	}
+
+	// Subscribe before the first query so a command created in between
+	// still wakes the request
+	var wake chan *nats.Msg
+	if wait > 0 && h.nc != nil {
+		wake = make(chan *nats.Msg, 8)
+		sub, err := h.nc.ChanSubscribe(events.CommandsSubject(deviceID), wake)
+		if err != nil {
+			wake = nil
+		} else {
+			defer sub.Unsubscribe()
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		commands, err := h.claimCommands(c.UserContext(), deviceID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to query commands"})
+		}
+
+		remaining := time.Until(deadline)
+		if len(commands) > 0 || wake == nil || remaining <= 0 {
+			return c.JSON(commands)
+		}
+
+		// A wake-up may be for a command not released yet; the loop then
+		// finds nothing and keeps waiting
+		timer := time.NewTimer(remaining)
+		select {
+		case <-wake:
+		case <-timer.C:
+		case <-c.Context().Done():
+			timer.Stop()
+			return c.JSON(commands)
+		}
+		timer.Stop()
+	}
+}
+
+// claimCommands returns the device's released, unexpired pending commands
+// and marks them executing
+func (h *CommandHandler) claimCommands(ctx context.Context, deviceID uuid.UUID) ([]models.Command, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT command_id, type, parameters, issued_at, ttl_seconds, not_before, status
 		FROM commands
 		WHERE device_id = $1
 		  AND status = 'pending'
-		  AND issued_at + (ttl_seconds || ' seconds')::interval > NOW()
+		  AND (not_before IS NULL OR not_before <= NOW())
+		  AND COALESCE(not_before, issued_at) + (ttl_seconds || ' seconds')::interval > NOW()
 		ORDER BY issued_at ASC`,
 		deviceID)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to query commands"})
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -46,24 +118,26 @@ func (h *CommandHandler) GetCommands(c *fiber.Ctx) error {
 	for rows.Next() {
 		var cmd models.Command
 		err := rows.Scan(&cmd.CommandID, &cmd.Type, &cmd.Parameters,
-			&cmd.IssuedAt, &cmd.TTLSeconds, &cmd.Status)
+			&cmd.IssuedAt, &cmd.TTLSeconds, &cmd.NotBefore, &cmd.Status)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan command"})
+			return nil, err
 		}
 		commands = append(commands, cmd)
 	}
 
 	// Mark commands as executing
 	for _, cmd := range commands {
-		_, err = h.db.Exec(c.Context(), `
+		_, err = h.db.Exec(ctx, `
 			UPDATE commands SET status = 'executing' WHERE command_id = $1`,
 			cmd.CommandID)
 		if err != nil {
 			// Log error but continue
+			continue
 		}
+		h.publisher.Publish(models.CommandStatusEvent(cmd.CommandID, deviceID, "executing"))
 	}
 
-	return c.JSON(commands)
+	return commands, nil
 }
 
 func (h *CommandHandler) AckCommand(c *fiber.Ctx) error {
@@ -89,31 +163,142 @@ func (h *CommandHandler) AckCommand(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	if err := h.ackCommand(c.UserContext(), deviceID, commandID, ack.Result, ack.Error); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update command"})
+	}
+
+	return c.SendStatus(200)
+}
+
+// ReportProgress records a running command's partial result, such as the
+// stage an upgrade has reached, in place of the previous one. The ack
+// replaces it with the final result.
+func (h *CommandHandler) ReportProgress(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
+	}
+
+	commandID, err := uuid.Parse(c.Params("cmdId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command ID"})
+	}
+
+	var progress struct {
+		Result map[string]interface{} `json:"result"`
+	}
+	if err := c.BodyParser(&progress); err != nil || progress.Result == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var cmdType string
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE commands SET result = $3
+		WHERE command_id = $1 AND device_id = $2 AND status = 'executing'
+		RETURNING type`,
+		commandID, agent.DeviceID, progress.Result).Scan(&cmdType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "No running command found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update command"})
+	}
+
+	h.publisher.Publish(models.CommandProgressEvent(commandID, agent.DeviceID, cmdType, progress.Result))
+	return c.SendStatus(204)
+}
+
+// ackCommand records the outcome a device reported for one of its commands;
+// a non-empty errMsg marks it failed. A command that isn't the device's is
+// only audited.
+func (h *CommandHandler) ackCommand(ctx context.Context, deviceID, commandID uuid.UUID, result map[string]interface{}, errMsg string) error {
 	// Update command
 	status := "completed"
-	if ack.Error != "" {
+	if errMsg != "" {
+		// Kept with the error: a command that got partway reports what it
+		// did, such as an installer's exit code
 		status = "failed"
-		ack.Result = map[string]interface{}{"error": ack.Error}
+		if result == nil {
+			result = map[string]interface{}{}
+		}
+		result["error"] = errMsg
 	}
 
-	_, err = h.db.Exec(c.Context(), `
+	// A ping's result gets the round trip from when it was due to the ack,
+	// timed on the API's clock alone
+	var cmdType string
+	var requestedBy *string
+	err := h.db.QueryRow(ctx, `
 		UPDATE commands
-		SET status = $1, result = $2, completed_at = NOW()
-		WHERE command_id = $3 AND device_id = $4`,
-		status, ack.Result, commandID, deviceID)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to update command"})
+		SET status = $1, completed_at = NOW(),
+		    result = CASE WHEN type = 'agent.ping'
+		        THEN COALESCE($2::jsonb, '{}'::jsonb) || jsonb_build_object('round_trip_ms',
+		            (EXTRACT(EPOCH FROM NOW() - COALESCE(not_before, issued_at)) * 1000)::bigint)
+		        ELSE $2::jsonb END
+		WHERE command_id = $3 AND device_id = $4
+		RETURNING type, result, requested_by`,
+		status, result, commandID, deviceID).Scan(&cmdType, &result, &requestedBy)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		h.publisher.Publish(models.CommandStatusEvent(commandID, deviceID, status))
+		h.publisher.Publish(models.CommandCompletedEvent(commandID, deviceID, cmdType, status, result))
+	}
+
+	// An upgraded agent acks from its new version
+	if err == nil && cmdType == models.UpgradeCommand && status == "completed" {
+		if v, ok := result["version"].(string); ok && result["stage"] == models.UpgradeInstalled {
+			_, err := h.db.Exec(ctx, "UPDATE agents SET agent_version = $2 WHERE device_id = $1", deviceID, v)
+			if err != nil {
+				logging.FromContext(ctx).Error("Failed to record upgraded agent version", "device_id", deviceID, "error", err)
+			}
+		}
+	}
+
+	// The agent is removing itself, so the device leaves the fleet with it
+	if err == nil && cmdType == models.UninstallCommand && status == "completed" {
+		actor := "agent"
+		if requestedBy != nil {
+			actor = *requestedBy
+		}
+		if err := h.retireUninstalled(ctx, deviceID, commandID, actor); err != nil {
+			logging.FromContext(ctx).Error("Failed to retire uninstalled device", "device_id", deviceID, "command_id", commandID, "error", err)
+		}
 	}
 
 	// Log to audit
-	_, err = h.db.Exec(c.Context(), `
-		INSERT INTO audit_log (actor, action, resource_type, resource_id, details)
-		VALUES ($1, $2, $3, $4, $5)`,
-		"agent", "ack_command", "command", commandID.String(),
+	err = audit.Record(ctx, h.db, "agent", "ack_command", "command", commandID.String(),
 		map[string]interface{}{"status": status})
 	if err != nil {
 		// Log but don't fail
 	}
 
-	return c.SendStatus(200)
-}
\ No newline at end of file
+	return nil
+}
+
+// retireUninstalled retires a device whose agent acked agent.uninstall, on
+// behalf of the admin who requested it, unless it is already retired
+func (h *CommandHandler) retireUninstalled(ctx context.Context, deviceID, commandID uuid.UUID, actor string) error {
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx,
+		"SELECT status FROM agents WHERE device_id = $1 FOR UPDATE", deviceID).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status == "retired" {
+		return nil
+	}
+
+	details := map[string]interface{}{"command_id": commandID}
+	if _, err := database.RetireDevice(ctx, tx, deviceID, actor, false, details); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
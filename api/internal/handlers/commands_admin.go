@@ -1,50 +1,127 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/yourorg/inventory-agent/api/internal/models"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	sharedmodels "github.com/yourorg/inventory-agent/shared/models"
+	"github.com/yourorg/inventory-agent/shared/validation"
 )
 
 type CommandAdminHandler struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	validator *validation.Validator
+	publisher *events.Publisher
+	approval  map[string]bool
 }
 
-func NewCommandAdminHandler(db *pgxpool.Pool) *CommandAdminHandler {
-	return &CommandAdminHandler{db: db}
+// NewCommandAdminHandler creates the handler; commands of the approvalTypes
+// are held in awaiting_approval until a second admin approves them
+func NewCommandAdminHandler(db *pgxpool.Pool, validator *validation.Validator, publisher *events.Publisher, approvalTypes []string) *CommandAdminHandler {
+	approval := make(map[string]bool, len(approvalTypes))
+	for _, t := range approvalTypes {
+		approval[t] = true
+	}
+	return &CommandAdminHandler{db: db, validator: validator, publisher: publisher, approval: approval}
 }
 
-func (h *CommandAdminHandler) GetCommands(c *fiber.Ctx) error {
-	deviceIDStr := c.Query("device_id")
-	var deviceID *uuid.UUID
-	if deviceIDStr != "" {
-		if id, err := uuid.Parse(deviceIDStr); err == nil {
-			deviceID = &id
-		} else {
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
-		}
+// notifyCommands wakes the long-polling command requests of the devices
+// with released commands matching where, e.g. "batch_id = $1"
+func (h *CommandAdminHandler) notifyCommands(c *fiber.Ctx, where string, id uuid.UUID) {
+	deviceIDs, err := database.DueCommandDevices(c.UserContext(), h.db, where, id)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to find devices to notify of commands", "error", err)
+		return
+	}
+	h.publisher.NotifyCommands(deviceIDs...)
+}
+
+// request records the admin issuing cmd and holds it for approval if its
+// type requires dual control
+func (h *CommandAdminHandler) request(c *fiber.Ctx, cmd *models.Command) {
+	cmd.RequestedBy = adminUser(c)
+	cmd.Status = "pending"
+	if h.approval[cmd.Type] {
+		cmd.Status = "awaiting_approval"
 	}
+}
 
+func (h *CommandAdminHandler) GetCommands(c *fiber.Ctx) error {
 	query := `
 		SELECT command_id, device_id, type, parameters, issued_at, ttl_seconds,
-			   status, result, completed_at
-		FROM commands`
+			   status, result, completed_at, batch_id, not_before, parent_command_id,
+			   COALESCE(requested_by, ''), reviewed_by, reviewed_at, schedule_id
+		FROM commands
+		WHERE 1=1`
 	args := []interface{}{}
-	argCount := 0
 
-	if deviceID != nil {
-		argCount++
-		query += ` WHERE device_id = $` + fmt.Sprintf("%d", argCount)
-		args = append(args, *deviceID)
+	if deviceIDStr := c.Query("device_id"); deviceIDStr != "" {
+		deviceID, err := uuid.Parse(deviceIDStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+		}
+		args = append(args, deviceID)
+		query += ` AND device_id = $` + fmt.Sprintf("%d", len(args))
+	}
+
+	if batchIDStr := c.Query("batch_id"); batchIDStr != "" {
+		batchID, err := uuid.Parse(batchIDStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid batch ID"})
+		}
+		args = append(args, batchID)
+		query += ` AND batch_id = $` + fmt.Sprintf("%d", len(args))
+	}
+
+	if s := c.Query("schedule_id"); s != "" {
+		scheduleID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid schedule ID"})
+		}
+		args = append(args, scheduleID)
+		query += ` AND schedule_id = $` + fmt.Sprintf("%d", len(args))
+	}
+
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		query += ` AND status = $` + fmt.Sprintf("%d", len(args))
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
 	}
 
-	query += ` ORDER BY issued_at DESC`
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.UUIDCursorWhere(cur, "issued_at", "command_id", args)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		query += cursorWhere
+	}
 
-	rows, err := h.db.Query(c.Context(), query, args...)
+	// Fetch one extra row to tell whether another page follows
+	args = append(args, limit+1)
+	query += ` ORDER BY issued_at DESC, command_id DESC LIMIT $` + fmt.Sprintf("%d", len(args))
+
+	rows, err := h.db.Query(c.UserContext(), query, args...)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to query commands"})
 	}
@@ -54,44 +131,763 @@ func (h *CommandAdminHandler) GetCommands(c *fiber.Ctx) error {
 	for rows.Next() {
 		var cmd models.Command
 		err := rows.Scan(&cmd.CommandID, &cmd.DeviceID, &cmd.Type, &cmd.Parameters,
-			&cmd.IssuedAt, &cmd.TTLSeconds, &cmd.Status, &cmd.Result, &cmd.CompletedAt)
+			&cmd.IssuedAt, &cmd.TTLSeconds, &cmd.Status, &cmd.Result, &cmd.CompletedAt, &cmd.BatchID, &cmd.NotBefore, &cmd.ParentCommandID,
+			&cmd.RequestedBy, &cmd.ReviewedBy, &cmd.ReviewedAt, &cmd.ScheduleID)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan command"})
 		}
 		commands = append(commands, cmd)
 	}
 
-	return c.JSON(fiber.Map{"data": commands})
+	var nextCursor string
+	if len(commands) > limit {
+		commands = commands[:limit]
+		last := commands[limit-1]
+		nextCursor = database.EncodeCursor(last.IssuedAt, last.CommandID.String())
+	}
+
+	return c.JSON(fiber.Map{"data": commands, "next_cursor": nextCursor})
+}
+
+// maxBatchDevices caps how many device IDs one CreateCommand call may target
+const maxBatchDevices = 1000
+
+// CreateCommandRequest targets a single device, an explicit list of devices,
+// or every member of a group
+type CreateCommandRequest struct {
+	DeviceID   uuid.UUID              `json:"device_id"`
+	DeviceIDs  []uuid.UUID            `json:"device_ids,omitempty"`
+	GroupID    *int64                 `json:"group_id,omitempty"`
+	Type       string                 `json:"type"`
+	Parameters map[string]interface{} `json:"parameters"`
+	TTLSeconds int                    `json:"ttl_seconds"`
+	NotBefore  *time.Time             `json:"not_before,omitempty"`
 }
 
 func (h *CommandAdminHandler) CreateCommand(c *fiber.Ctx) error {
-	var cmd models.Command
-	if err := c.BodyParser(&cmd); err != nil {
+	if result := schemaErrors(h.validator, "command", json.RawMessage(c.Body())); result != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command", "validation": result})
+	}
+
+	var req CreateCommandRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid command data"})
 	}
 
 	// Set defaults
-	cmd.CommandID = uuid.New()
-	cmd.Status = "pending"
-	cmd.IssuedAt = time.Now()
+	cmd := models.Command{
+		Command: sharedmodels.Command{
+			CommandID:  uuid.New(),
+			Type:       req.Type,
+			Parameters: req.Parameters,
+			TTLSeconds: req.TTLSeconds,
+			IssuedAt:   time.Now(),
+			NotBefore:  req.NotBefore,
+		},
+		DeviceID: req.DeviceID,
+	}
+	h.request(c, &cmd)
 
 	if cmd.TTLSeconds == 0 {
 		cmd.TTLSeconds = 3600 // 1 hour default
 	}
 
+	targets := 0
+	for _, set := range []bool{req.DeviceID != uuid.Nil, len(req.DeviceIDs) > 0, req.GroupID != nil} {
+		if set {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command: device_id, device_ids and group_id are mutually exclusive"})
+	}
+
+	if req.GroupID != nil || len(req.DeviceIDs) > 0 {
+		if err := cmd.ValidateSpec(); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid command: " + err.Error()})
+		}
+		if req.GroupID != nil {
+			return h.createGroupCommand(c, &cmd, *req.GroupID)
+		}
+		return h.createDeviceListCommand(c, &cmd, req.DeviceIDs)
+	}
+
 	if err := cmd.Validate(); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid command: " + err.Error()})
 	}
 
-	_, err := h.db.Exec(c.Context(), `
-		INSERT INTO commands (command_id, device_id, type, parameters, issued_at, ttl_seconds, status)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+	if problem := h.checkCommandAllowed(c, &cmd); problem != nil {
+		return problem
+	}
+
+	_, err := h.db.Exec(c.UserContext(), `
+		INSERT INTO commands (command_id, device_id, type, parameters, issued_at, ttl_seconds, status, requested_by, not_before)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
 		cmd.CommandID, cmd.DeviceID, cmd.Type, cmd.Parameters, cmd.IssuedAt,
-		cmd.TTLSeconds, cmd.Status)
+		cmd.TTLSeconds, cmd.Status, cmd.RequestedBy, cmd.NotBefore)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command"})
 	}
 
+	h.notifyCommands(c, "command_id = $1", cmd.CommandID)
+
 	return c.Status(201).JSON(fiber.Map{"data": cmd})
-}
\ No newline at end of file
+}
+
+// checkCommandAllowed sends a 409 response when the device is quarantined
+// or a 403 response when its effective policy doesn't allow the command
+// type, returning the response's error, and returns nil otherwise
+func (h *CommandAdminHandler) checkCommandAllowed(c *fiber.Ctx, cmd *models.Command) error {
+	var quarantined bool
+	err := h.db.QueryRow(c.UserContext(),
+		"SELECT EXISTS (SELECT 1 FROM agents WHERE device_id = $1 AND lifecycle_state = 'quarantined')",
+		cmd.DeviceID).Scan(&quarantined)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check device lifecycle state"})
+	}
+	if quarantined {
+		return c.Status(409).JSON(fiber.Map{"error": "Device is quarantined"})
+	}
+
+	allowed, err := database.CommandAllowed(c.UserContext(), h.db, cmd.DeviceID, cmd.Type)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check device policy"})
+	}
+	if !allowed {
+		return c.Status(403).JSON(fiber.Map{"error": "Command type " + cmd.Type + " is not allowed by the device's policy"})
+	}
+	return nil
+}
+
+// createGroupCommand fans a command out into one row per group member,
+// linked through a command batch so progress can be rolled up later.
+// Quarantined members and members whose policy doesn't allow the command
+// type are skipped.
+func (h *CommandAdminHandler) createGroupCommand(c *fiber.Ctx, cmd *models.Command, groupID int64) error {
+	ctx := c.UserContext()
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command"})
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM device_groups WHERE group_id = $1)", groupID).Scan(&exists)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query group"})
+	}
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Group not found"})
+	}
+
+	batch := models.CommandBatch{
+		BatchID:       uuid.New(),
+		Type:          cmd.Type,
+		Parameters:    cmd.Parameters,
+		TTLSeconds:    cmd.TTLSeconds,
+		TargetType:    "group",
+		TargetGroupID: &groupID,
+		CreatedBy:     adminUser(c),
+		CreatedAt:     cmd.IssuedAt,
+
+		AwaitingApproval: cmd.IsAwaitingApproval(),
+	}
+
+	allowed := database.CommandAllowedSQL("m.device_id", 2)
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM device_group_members m
+		WHERE m.group_id = $1 AND NOT `+allowed, groupID, cmd.Type).Scan(&batch.BlockedCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check device policies"})
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO command_batches (batch_id, type, parameters, ttl_seconds, target_type, target_group_id, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		batch.BatchID, batch.Type, batch.Parameters, batch.TTLSeconds,
+		batch.TargetType, batch.TargetGroupID, batch.CreatedBy, batch.CreatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO commands (device_id, type, parameters, issued_at, ttl_seconds, status, batch_id, requested_by, not_before)
+		SELECT m.device_id, $2, $3, $4, $5, $7, $6, $8, $9
+		FROM device_group_members m
+		WHERE m.group_id = $1 AND `+allowed,
+		groupID, cmd.Type, cmd.Parameters, cmd.IssuedAt, cmd.TTLSeconds, batch.BatchID, cmd.Status, cmd.RequestedBy, cmd.NotBefore)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create commands"})
+	}
+
+	batch.DeviceCount = int(result.RowsAffected())
+	if batch.DeviceCount == 0 && batch.BlockedCount > 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Command type " + cmd.Type + " is not allowed on any device in the group"})
+	}
+	if batch.DeviceCount == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Group has no devices"})
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE command_batches SET device_count = $2 WHERE batch_id = $1",
+		batch.BatchID, batch.DeviceCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	h.notifyCommands(c, "batch_id = $1", batch.BatchID)
+
+	return c.Status(201).JSON(fiber.Map{"data": batch})
+}
+
+// RetryCommand clones a failed or expired command with a fresh TTL. The
+// clone records the original in parent_command_id.
+func (h *CommandAdminHandler) RetryCommand(c *fiber.Ctx) error {
+	commandID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command ID"})
+	}
+
+	var req struct {
+		TTLSeconds int `json:"ttl_seconds"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	var original models.Command
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT command_id, device_id, type, parameters, ttl_seconds, status
+		FROM commands WHERE command_id = $1`, commandID).Scan(
+		&original.CommandID, &original.DeviceID, &original.Type, &original.Parameters,
+		&original.TTLSeconds, &original.Status)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Command not found"})
+	}
+
+	if !original.IsRetryable() {
+		return c.Status(409).JSON(fiber.Map{"error": "Only failed or expired commands can be retried"})
+	}
+
+	cmd := models.Command{
+		Command: sharedmodels.Command{
+			CommandID:  uuid.New(),
+			Type:       original.Type,
+			Parameters: original.Parameters,
+			TTLSeconds: original.TTLSeconds,
+			IssuedAt:   time.Now(),
+		},
+		DeviceID:        original.DeviceID,
+		ParentCommandID: &original.CommandID,
+	}
+	h.request(c, &cmd)
+	if req.TTLSeconds != 0 {
+		cmd.TTLSeconds = req.TTLSeconds
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command: " + err.Error()})
+	}
+
+	if problem := h.checkCommandAllowed(c, &cmd); problem != nil {
+		return problem
+	}
+
+	_, err = h.db.Exec(c.UserContext(), `
+		INSERT INTO commands (command_id, device_id, type, parameters, issued_at, ttl_seconds, status, parent_command_id, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		cmd.CommandID, cmd.DeviceID, cmd.Type, cmd.Parameters, cmd.IssuedAt,
+		cmd.TTLSeconds, cmd.Status, cmd.ParentCommandID, cmd.RequestedBy)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command"})
+	}
+
+	h.notifyCommands(c, "command_id = $1", cmd.CommandID)
+
+	return c.Status(201).JSON(fiber.Map{"data": cmd})
+}
+
+// BroadcastRequest targets every device matching a filter, given inline or
+// as the ID of a saved filter
+type BroadcastRequest struct {
+	Filter        models.DeviceFilter    `json:"filter"`
+	FilterID      *int64                 `json:"filter_id"`
+	AllDevices    bool                   `json:"all_devices"`
+	Type          string                 `json:"type"`
+	Parameters    map[string]interface{} `json:"parameters"`
+	TTLSeconds    int                    `json:"ttl_seconds"`
+	DryRun        bool                   `json:"dry_run"`
+	RatePerMinute int                    `json:"rate_per_minute"` // 0 releases to all devices at once
+}
+
+// Broadcast creates a command for every device matching a filter that isn't
+// quarantined and whose policy allows the command type. An empty filter,
+// which would match every device, must be asked for with all_devices. With
+// dry_run set it only reports how many devices would be targeted. A
+// positive rate_per_minute staggers release so at most that many devices
+// receive the command each minute.
+func (h *CommandAdminHandler) Broadcast(c *fiber.Ctx) error {
+	var req BroadcastRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid broadcast data"})
+	}
+
+	if req.FilterID != nil {
+		if !req.Filter.IsEmpty() {
+			return c.Status(400).JSON(fiber.Map{"error": "filter and filter_id are mutually exclusive"})
+		}
+		saved, err := loadSavedFilter(c.UserContext(), h.db, *req.FilterID)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Filter not found"})
+		}
+		req.Filter = saved.Filter
+	}
+
+	// A body whose filter fields are missing or misspelled parses as an
+	// empty filter, so targeting every device has to be explicit
+	switch {
+	case req.AllDevices && (req.FilterID != nil || !req.Filter.IsEmpty()):
+		return c.Status(400).JSON(fiber.Map{"error": "all_devices can't be combined with filter or filter_id"})
+	case !req.AllDevices && req.FilterID == nil && req.Filter.IsEmpty():
+		return c.Status(400).JSON(fiber.Map{"error": "filter or filter_id is required; set all_devices to target every device"})
+	}
+
+	if err := req.Filter.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter: " + err.Error()})
+	}
+
+	spec := map[string]interface{}{"type": req.Type, "parameters": req.Parameters, "ttl_seconds": req.TTLSeconds}
+	if result := schemaErrors(h.validator, "command", spec); result != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command", "validation": result})
+	}
+	if req.Type == models.UninstallCommand {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command: agent.uninstall can't be broadcast; issue it to devices by ID or group"})
+	}
+
+	if req.RatePerMinute < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "rate_per_minute must be non-negative"})
+	}
+
+	cmd := models.Command{
+		Command: sharedmodels.Command{
+			Type:       req.Type,
+			Parameters: req.Parameters,
+			TTLSeconds: req.TTLSeconds,
+			IssuedAt:   time.Now(),
+		},
+	}
+	h.request(c, &cmd)
+	if cmd.TTLSeconds == 0 {
+		cmd.TTLSeconds = 3600
+	}
+
+	if err := cmd.ValidateSpec(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command: " + err.Error()})
+	}
+
+	where, args := database.DeviceFilterSQL(&req.Filter, nil)
+
+	// The command type is bound right after the filter arguments, in the
+	// count and in the insert below
+	allowed := database.CommandAllowedSQL("a.device_id", len(args)+1)
+	var count, blocked int
+	err := h.db.QueryRow(c.UserContext(), `
+		SELECT COUNT(*) FILTER (WHERE `+allowed+`), COUNT(*) FILTER (WHERE NOT `+allowed+`)
+		FROM agents a WHERE 1=1`+where, append(args[:len(args):len(args)], cmd.Type)...).Scan(&count, &blocked)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to count devices"})
+	}
+
+	if req.DryRun {
+		rolloutMinutes := 0
+		if req.RatePerMinute > 0 && count > 0 {
+			rolloutMinutes = (count + req.RatePerMinute - 1) / req.RatePerMinute
+		}
+
+		return c.JSON(fiber.Map{"data": fiber.Map{
+			"dry_run":         true,
+			"device_count":    count,
+			"blocked_count":   blocked,
+			"rollout_minutes": rolloutMinutes,
+		}})
+	}
+
+	ctx := c.UserContext()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create broadcast"})
+	}
+	defer tx.Rollback(ctx)
+
+	batch := models.CommandBatch{
+		BatchID:       uuid.New(),
+		Type:          cmd.Type,
+		Parameters:    cmd.Parameters,
+		TTLSeconds:    cmd.TTLSeconds,
+		TargetType:    "filter",
+		TargetFilter:  &req.Filter,
+		SavedFilterID: req.FilterID,
+		RatePerMinute: req.RatePerMinute,
+		CreatedBy:     adminUser(c),
+		CreatedAt:     cmd.IssuedAt,
+
+		AwaitingApproval: cmd.IsAwaitingApproval(),
+		BlockedCount:     blocked,
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO command_batches (batch_id, type, parameters, ttl_seconds, target_type, target_filter, saved_filter_id, rate_per_minute, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		batch.BatchID, batch.Type, batch.Parameters, batch.TTLSeconds, batch.TargetType,
+		batch.TargetFilter, batch.SavedFilterID, batch.RatePerMinute, batch.CreatedBy, batch.CreatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	n := len(args)
+	arg := func(i int) string { return "$" + strconv.Itoa(n+i) }
+	args = append(args, cmd.Type, cmd.Parameters, cmd.IssuedAt, cmd.TTLSeconds, batch.BatchID, req.RatePerMinute,
+		cmd.Status, cmd.RequestedBy)
+
+	// Device k (0-based) is released k/rate minutes after issue
+	result, err := tx.Exec(ctx, `
+		INSERT INTO commands (device_id, type, parameters, issued_at, ttl_seconds, status, batch_id, requested_by, not_before)
+		SELECT a.device_id, `+arg(1)+`, `+arg(2)+`, `+arg(3)+`, `+arg(4)+`, `+arg(7)+`, `+arg(5)+`, `+arg(8)+`,
+		       CASE WHEN `+arg(6)+`::int > 0
+		            THEN `+arg(3)+`::timestamptz + ((ROW_NUMBER() OVER (ORDER BY a.device_id) - 1) / `+arg(6)+`::int) * INTERVAL '1 minute'
+		       END
+		FROM agents a
+		WHERE 1=1`+where+` AND `+allowed, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create commands"})
+	}
+
+	batch.DeviceCount = int(result.RowsAffected())
+	if batch.DeviceCount == 0 && blocked > 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Command type " + cmd.Type + " is not allowed on any matching device"})
+	}
+	if batch.DeviceCount == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "No devices match the filter"})
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE command_batches SET device_count = $2 WHERE batch_id = $1",
+		batch.BatchID, batch.DeviceCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	h.notifyCommands(c, "batch_id = $1", batch.BatchID)
+
+	return c.Status(201).JSON(fiber.Map{"data": batch})
+}
+
+// BatchCommandResult maps a targeted device to the command created for it
+type BatchCommandResult struct {
+	DeviceID  uuid.UUID `json:"device_id"`
+	CommandID uuid.UUID `json:"command_id"`
+}
+
+// createDeviceListCommand inserts one command per listed device in a single
+// transaction and returns the per-device command IDs. Unknown devices, and
+// those quarantined or whose policy doesn't allow the command type, are
+// reported back rather than failing the whole batch.
+func (h *CommandAdminHandler) createDeviceListCommand(c *fiber.Ctx, cmd *models.Command, deviceIDs []uuid.UUID) error {
+	seen := make(map[uuid.UUID]bool, len(deviceIDs))
+	unique := make([]uuid.UUID, 0, len(deviceIDs))
+	for _, id := range deviceIDs {
+		if id == uuid.Nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	if len(unique) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command: device_ids is empty"})
+	}
+	if len(unique) > maxBatchDevices {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Invalid command: at most %d device_ids per request", maxBatchDevices)})
+	}
+
+	ctx := c.UserContext()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create commands"})
+	}
+	defer tx.Rollback(ctx)
+
+	batch := models.CommandBatch{
+		BatchID:    uuid.New(),
+		Type:       cmd.Type,
+		Parameters: cmd.Parameters,
+		TTLSeconds: cmd.TTLSeconds,
+		TargetType: "devices",
+		CreatedBy:  adminUser(c),
+		CreatedAt:  cmd.IssuedAt,
+
+		AwaitingApproval: cmd.IsAwaitingApproval(),
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO command_batches (batch_id, type, parameters, ttl_seconds, target_type, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		batch.BatchID, batch.Type, batch.Parameters, batch.TTLSeconds,
+		batch.TargetType, batch.CreatedBy, batch.CreatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	allowed := database.CommandAllowedSQL("a.device_id", 2)
+	rows, err := tx.Query(ctx, `
+		SELECT a.device_id FROM agents a
+		WHERE a.device_id = ANY($1) AND a.status <> 'retired' AND NOT `+allowed, unique, cmd.Type)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check device policies"})
+	}
+	blocked := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to check device policies"})
+		}
+		blocked = append(blocked, id)
+		delete(seen, id)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check device policies"})
+	}
+
+	rows, err = tx.Query(ctx, `
+		INSERT INTO commands (device_id, type, parameters, issued_at, ttl_seconds, status, batch_id, requested_by, not_before)
+		SELECT a.device_id, $2, $3, $4, $5, $7, $6, $8, $9
+		FROM agents a
+		WHERE a.device_id = ANY($1) AND a.status <> 'retired' AND `+allowed+`
+		RETURNING device_id, command_id`,
+		unique, cmd.Type, cmd.Parameters, cmd.IssuedAt, cmd.TTLSeconds, batch.BatchID, cmd.Status, cmd.RequestedBy, cmd.NotBefore)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create commands"})
+	}
+
+	var created []BatchCommandResult
+	for rows.Next() {
+		var r BatchCommandResult
+		if err := rows.Scan(&r.DeviceID, &r.CommandID); err != nil {
+			rows.Close()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to create commands"})
+		}
+		created = append(created, r)
+		delete(seen, r.DeviceID)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create commands"})
+	}
+
+	if len(created) == 0 && len(blocked) > 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Command type " + cmd.Type + " is not allowed on any listed device"})
+	}
+	if len(created) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "None of the device_ids are registered"})
+	}
+
+	batch.DeviceCount = len(created)
+	_, err = tx.Exec(ctx,
+		"UPDATE command_batches SET device_count = $2 WHERE batch_id = $1",
+		batch.BatchID, batch.DeviceCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create command batch"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create commands"})
+	}
+
+	h.notifyCommands(c, "batch_id = $1", batch.BatchID)
+
+	unknown := make([]uuid.UUID, 0, len(seen))
+	for _, id := range unique {
+		if seen[id] {
+			unknown = append(unknown, id)
+		}
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": fiber.Map{
+		"batch":              batch,
+		"commands":           created,
+		"unknown_device_ids": unknown,
+		"blocked_device_ids": blocked,
+	}})
+}
+
+// GetCommandBatch returns a batch with aggregate completion/failure counts
+func (h *CommandAdminHandler) GetCommandBatch(c *fiber.Ctx) error {
+	batchID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid batch ID"})
+	}
+
+	var batch models.CommandBatch
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT batch_id, type, parameters, ttl_seconds, target_type, target_group_id, target_filter,
+		       saved_filter_id, rate_per_minute, device_count, COALESCE(created_by, ''), created_at
+		FROM command_batches WHERE batch_id = $1`, batchID).Scan(
+		&batch.BatchID, &batch.Type, &batch.Parameters, &batch.TTLSeconds, &batch.TargetType,
+		&batch.TargetGroupID, &batch.TargetFilter, &batch.SavedFilterID, &batch.RatePerMinute,
+		&batch.DeviceCount, &batch.CreatedBy, &batch.CreatedAt)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Command batch not found"})
+	}
+
+	var rollup models.CommandBatchRollup
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'awaiting_approval'),
+			COUNT(*) FILTER (WHERE status = 'pending'),
+			COUNT(*) FILTER (WHERE status = 'executing'),
+			COUNT(*) FILTER (WHERE status = 'completed'),
+			COUNT(*) FILTER (WHERE status = 'failed'),
+			COUNT(*) FILTER (WHERE status = 'expired'),
+			COUNT(*) FILTER (WHERE status = 'cancelled'),
+			COUNT(*) FILTER (WHERE status = 'rejected')
+		FROM commands WHERE batch_id = $1`, batchID).Scan(
+		&rollup.Total, &rollup.AwaitingApproval, &rollup.Pending, &rollup.Executing,
+		&rollup.Completed, &rollup.Failed, &rollup.Expired, &rollup.Cancelled, &rollup.Rejected)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query batch status"})
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"batch":  batch,
+		"rollup": rollup,
+	}})
+}
+
+// ApproveCommand releases a command awaiting approval to its device
+func (h *CommandAdminHandler) ApproveCommand(c *fiber.Ctx) error {
+	return h.reviewCommand(c, true)
+}
+
+// RejectCommand discards a command awaiting approval. An optional reason is
+// kept in the command result.
+func (h *CommandAdminHandler) RejectCommand(c *fiber.Ctx) error {
+	return h.reviewCommand(c, false)
+}
+
+// ApproveCommandBatch releases every command of a batch awaiting approval
+func (h *CommandAdminHandler) ApproveCommandBatch(c *fiber.Ctx) error {
+	return h.reviewBatch(c, true)
+}
+
+// RejectCommandBatch discards every command of a batch awaiting approval
+func (h *CommandAdminHandler) RejectCommandBatch(c *fiber.Ctx) error {
+	return h.reviewBatch(c, false)
+}
+
+func (h *CommandAdminHandler) reviewCommand(c *fiber.Ctx, approve bool) error {
+	commandID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid command ID"})
+	}
+	return h.review(c, "command_id = $1", commandID, approve)
+}
+
+func (h *CommandAdminHandler) reviewBatch(c *fiber.Ctx, approve bool) error {
+	batchID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid batch ID"})
+	}
+	return h.review(c, "batch_id = $1", batchID, approve)
+}
+
+// review approves or rejects the commands matching where that are awaiting
+// approval. Only an admin whose token identifies them may review, and not
+// the commands they requested; commands requested under an unidentified
+// token can only be rejected, as anyone may have requested them. Approving
+// after a command's release time shifts it, and the rest of its batch, so
+// the earliest is released now; broadcast staggering and TTLs are kept.
+func (h *CommandAdminHandler) review(c *fiber.Ctx, where string, id uuid.UUID, approve bool) error {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	if !adminIdentified(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Reviewing commands requires an admin token that identifies the reviewer"})
+	}
+	reviewer := adminUser(c)
+
+	var total, awaiting, own, unidentified int
+	err := h.db.QueryRow(c.UserContext(), `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE status = 'awaiting_approval'),
+		       COUNT(*) FILTER (WHERE status = 'awaiting_approval' AND requested_by = $2),
+		       COUNT(*) FILTER (WHERE status = 'awaiting_approval' AND COALESCE(requested_by, $3) = $3)
+		FROM commands WHERE `+where, id, reviewer, auth.UnidentifiedAdmin).Scan(&total, &awaiting, &own, &unidentified)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query commands"})
+	}
+	if total == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Command not found"})
+	}
+	if awaiting == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "No commands are awaiting approval"})
+	}
+	if own > 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Commands must be reviewed by an admin other than the one who requested them"})
+	}
+	if approve && unidentified > 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Commands requested without an identifying admin token can only be rejected"})
+	}
+
+	status := "rejected"
+	update := `
+		UPDATE commands SET status = 'rejected', reviewed_by = $2, reviewed_at = NOW(), completed_at = NOW(),
+		       result = CASE WHEN $3 = '' THEN NULL ELSE jsonb_build_object('reason', $3::text) END`
+	args := []interface{}{id, reviewer, req.Reason}
+	if approve {
+		status = "pending"
+		update = `
+		UPDATE commands SET status = 'pending', reviewed_by = $2, reviewed_at = NOW(),
+		       not_before = COALESCE(not_before, issued_at) + GREATEST(INTERVAL '0', NOW() - (
+		           SELECT MIN(COALESCE(x.not_before, x.issued_at)) FROM commands x
+		           WHERE x.` + where + ` AND x.status = 'awaiting_approval'))`
+		args = args[:2]
+	}
+
+	tag, err := h.db.Exec(c.UserContext(), update+`
+		WHERE `+where+` AND status = 'awaiting_approval' AND requested_by IS DISTINCT FROM $2`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to review commands"})
+	}
+
+	if approve {
+		h.notifyCommands(c, where, id)
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"status":      status,
+		"reviewed_by": reviewer,
+		"commands":    tag.RowsAffected(),
+	}})
+}
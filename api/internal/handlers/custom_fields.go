@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type CustomFieldHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewCustomFieldHandler(db *pgxpool.Pool) *CustomFieldHandler {
+	return &CustomFieldHandler{db: db}
+}
+
+func (h *CustomFieldHandler) GetCustomFields(c *fiber.Ctx) error {
+	defs, err := loadCustomFieldDefinitions(c.UserContext(), h.db)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query custom fields"})
+	}
+
+	fields := make([]models.CustomFieldDefinition, 0, len(defs))
+	for _, def := range defs {
+		fields = append(fields, def)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+
+	return c.JSON(fiber.Map{"data": fields})
+}
+
+func (h *CustomFieldHandler) CreateCustomField(c *fiber.Ctx) error {
+	var def models.CustomFieldDefinition
+	if err := c.BodyParser(&def); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid custom field data"})
+	}
+
+	if err := def.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid custom field: " + err.Error()})
+	}
+
+	def.CreatedBy = adminUser(c)
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO custom_field_definitions (field_key, label, field_type, created_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (field_key) DO NOTHING
+		RETURNING created_at`,
+		def.Key, def.Label, def.Type, def.CreatedBy).Scan(&def.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(409).JSON(fiber.Map{"error": "Custom field already exists"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create custom field"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": def})
+}
+
+// DeleteCustomField removes a field definition along with any values stored
+// on devices under its key.
+func (h *CustomFieldHandler) DeleteCustomField(c *fiber.Ctx) error {
+	key := c.Params("key")
+	ctx := c.UserContext()
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete custom field"})
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, "DELETE FROM custom_field_definitions WHERE field_key = $1", key)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete custom field"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Custom field not found"})
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE agents SET custom_fields = custom_fields - $1::text WHERE custom_fields ? $1", key)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to clear custom field values"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete custom field"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Custom field deleted"})
+}
+
+// loadCustomFieldDefinitions returns all field definitions keyed by field key
+func loadCustomFieldDefinitions(ctx context.Context, db *pgxpool.Pool) (map[string]models.CustomFieldDefinition, error) {
+	rows, err := db.Query(ctx, `
+		SELECT field_key, label, field_type, COALESCE(created_by, ''), created_at
+		FROM custom_field_definitions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := make(map[string]models.CustomFieldDefinition)
+	for rows.Next() {
+		var def models.CustomFieldDefinition
+		if err := rows.Scan(&def.Key, &def.Label, &def.Type, &def.CreatedBy, &def.CreatedAt); err != nil {
+			return nil, err
+		}
+		defs[def.Key] = def
+	}
+
+	return defs, rows.Err()
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// snapshotLookback bounds how far before a requested time a metric's last
+// report is still considered part of the snapshot at that time
+const snapshotLookback = 7 * 24 * time.Hour
+
+// GetDeviceDiff compares the device's inventory snapshots at ?from= and
+// ?to= (RFC 3339, to defaults to now)
+func (h *DeviceHandler) GetDeviceDiff(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be an RFC 3339 timestamp"})
+	}
+
+	to := time.Now()
+	if s := c.Query("to"); s != "" {
+		to, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "to must be an RFC 3339 timestamp"})
+		}
+	}
+
+	if !from.Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be before to"})
+	}
+
+	fromSnapshot, err := h.telemetry.Snapshot(c.UserContext(), deviceID, from, snapshotLookback)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load snapshot"})
+	}
+	toSnapshot, err := h.telemetry.Snapshot(c.UserContext(), deviceID, to, snapshotLookback)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load snapshot"})
+	}
+
+	if fromSnapshot == nil || toSnapshot == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "No inventory snapshot at the requested time"})
+	}
+
+	return c.JSON(fiber.Map{"data": models.DiffSnapshots(fromSnapshot, toSnapshot)})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// GetDeviceLifecycle returns a device's lifecycle state and its
+// transitions, newest first
+func (h *DeviceHandler) GetDeviceLifecycle(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var state string
+	err = h.db.QueryRow(c.UserContext(),
+		"SELECT lifecycle_state FROM agents WHERE device_id = $1", deviceID).Scan(&state)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT transition_id, device_id, COALESCE(from_state, ''), to_state,
+		       COALESCE(actor, ''), COALESCE(reason, ''), transitioned_at
+		FROM device_lifecycle_transitions
+		WHERE device_id = $1
+		ORDER BY transitioned_at DESC, transition_id DESC`, deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query lifecycle transitions"})
+	}
+	defer rows.Close()
+
+	transitions := []models.LifecycleTransition{}
+	for rows.Next() {
+		var t models.LifecycleTransition
+		err := rows.Scan(&t.TransitionID, &t.DeviceID, &t.FromState, &t.ToState, &t.Actor, &t.Reason, &t.TransitionedAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan lifecycle transition"})
+		}
+		transitions = append(transitions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query lifecycle transitions"})
+	}
+
+	return c.JSON(fiber.Map{
+		"lifecycle_state": state,
+		"data":            transitions,
+	})
+}
+
+// TransitionDevice quarantines a device or releases it from quarantine back
+// to active. Quarantining cancels the device's commands that haven't started.
+// Enrollment and activation happen as the agent registers and reports, and
+// retirement goes through DeleteDevice.
+func (h *DeviceHandler) TransitionDevice(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var req models.LifecycleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.State != models.LifecycleQuarantined && req.State != models.LifecycleActive {
+		return c.Status(400).JSON(fiber.Map{"error": "state must be quarantined or active"})
+	}
+
+	ctx := c.UserContext()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update lifecycle state"})
+	}
+	defer tx.Rollback(ctx)
+
+	var current string
+	err = tx.QueryRow(ctx,
+		"SELECT lifecycle_state FROM agents WHERE device_id = $1 FOR UPDATE", deviceID).Scan(&current)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	// Releasing is only possible from quarantine, not a way to skip the
+	// enrolled state
+	if !models.CanTransition(current, req.State) || (req.State == models.LifecycleActive && current != models.LifecycleQuarantined) {
+		return c.Status(409).JSON(fiber.Map{"error": "Device cannot move from " + current + " to " + req.State})
+	}
+
+	if _, err := database.TransitionLifecycle(ctx, tx, deviceID, req.State, adminUser(c), req.Reason); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update lifecycle state"})
+	}
+
+	details := fiber.Map{"device_id": deviceID, "from_state": current, "lifecycle_state": req.State}
+	if req.State == models.LifecycleQuarantined {
+		cancelled, err := tx.Exec(ctx, `
+			UPDATE commands SET status = 'cancelled', completed_at = NOW()
+			WHERE device_id = $1 AND status IN ('awaiting_approval', 'pending')`, deviceID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to cancel commands"})
+		}
+		details["commands_cancelled"] = cancelled.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update lifecycle state"})
+	}
+
+	return c.JSON(fiber.Map{"data": details})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type DeviceTagsRequest struct {
+	Tags map[string]string `json:"tags"`
+}
+
+func (h *DeviceHandler) GetDeviceTags(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var exists bool
+	err = h.db.QueryRow(c.UserContext(),
+		"SELECT EXISTS (SELECT 1 FROM agents WHERE device_id = $1)", deviceID).Scan(&exists)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device"})
+	}
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	tags, err := loadDeviceTags(c.UserContext(), h.db, deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device tags"})
+	}
+
+	return c.JSON(fiber.Map{"data": tags})
+}
+
+// SetDeviceTags replaces a device's admin-assigned tags with the given set
+func (h *DeviceHandler) SetDeviceTags(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var req DeviceTagsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Tags == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "tags is required"})
+	}
+
+	if err := models.ValidateTags(req.Tags); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid tags: " + err.Error()})
+	}
+
+	ctx := c.UserContext()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update device tags"})
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM agents WHERE device_id = $1)", deviceID).Scan(&exists)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device"})
+	}
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	keys := make([]string, 0, len(req.Tags))
+	values := make([]string, 0, len(req.Tags))
+	for key, value := range req.Tags {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	_, err = tx.Exec(ctx,
+		"DELETE FROM device_tags WHERE device_id = $1 AND NOT (tag_key = ANY($2))", deviceID, keys)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update device tags"})
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO device_tags (device_id, tag_key, tag_value, updated_by)
+		SELECT $1, k, v, $4 FROM unnest($2::text[], $3::text[]) AS t(k, v)
+		ON CONFLICT (device_id, tag_key) DO UPDATE
+		SET tag_value = EXCLUDED.tag_value, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		WHERE device_tags.tag_value <> EXCLUDED.tag_value`,
+		deviceID, keys, values, adminUser(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update device tags"})
+	}
+
+	err = audit.Record(ctx, tx, adminUser(c), "set_tags", "agent", deviceID.String(), req)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record audit log"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update device tags"})
+	}
+
+	return c.JSON(fiber.Map{"data": req.Tags})
+}
+
+// loadDeviceTags returns a device's admin-assigned tags
+func loadDeviceTags(ctx context.Context, db *pgxpool.Pool, deviceID uuid.UUID) (map[string]string, error) {
+	rows, err := db.Query(ctx,
+		"SELECT tag_key, tag_value FROM device_tags WHERE device_id = $1", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+
+	return tags, rows.Err()
+}
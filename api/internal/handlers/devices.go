@@ -1,24 +1,56 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/yourorg/inventory-agent/api/internal/models"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/export"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
 )
 
+// DeviceHandler serves the device endpoints. Device lists, stats and
+// telemetry history read from the replica; everything else, including a
+// single device just updated, uses the primary.
 type DeviceHandler struct {
-	db *pgxpool.Pool
+	db             *pgxpool.Pool
+	replica        *pgxpool.Pool
+	devices        *repository.Devices
+	replicaDevices *repository.Devices
+	telemetry      *repository.Telemetry
 }
 
-func NewDeviceHandler(db *pgxpool.Pool) *DeviceHandler {
-	return &DeviceHandler{db: db}
+// NewDeviceHandler creates the handler; replica may be the primary pool
+// itself when no replica is configured. Raw telemetry is read from each
+// device's telemetry shard.
+func NewDeviceHandler(db, replica *pgxpool.Pool, telemetry *repository.Telemetry) *DeviceHandler {
+	return &DeviceHandler{
+		db:             db,
+		replica:        replica,
+		devices:        repository.NewDevices(db),
+		replicaDevices: repository.NewDevices(replica),
+		telemetry:      telemetry,
+	}
 }
 
+// GetDevices lists devices with their health, most recently seen first
+// unless ?sort= says otherwise; only that default order pages by cursor,
+// others by offset. ?include=latest_telemetry,pending_commands adds each
+// device's latest telemetry and unfinished commands to the page.
 func (h *DeviceHandler) GetDevices(c *fiber.Ctx) error {
+	params := queryValues(c)
+	if params.Get("format") != "" {
+		return streamExport(c, h.replica, nil, export.KindDevices, params)
+	}
+
 	// Parse query parameters
 	limit := 50 // default
 	if l := c.Query("limit"); l != "" {
@@ -34,75 +66,68 @@ func (h *DeviceHandler) GetDevices(c *fiber.Ctx) error {
 		}
 	}
 
-	status := c.Query("status") // active, inactive, offline, or empty for all
-	hostname := c.Query("hostname")
-
-	// Build query
-	query := `
-		SELECT device_id, hostname, status, agent_version, first_seen_at, last_seen_at
-		FROM agents
-		WHERE 1=1`
-	args := []interface{}{}
-	argCount := 0
-
-	if status != "" {
-		argCount++
-		query += ` AND status = $` + strconv.Itoa(argCount)
-		args = append(args, status)
+	var includeTelemetry, includeCommands bool
+	if include := c.Query("include"); include != "" {
+		for _, part := range strings.Split(include, ",") {
+			switch strings.TrimSpace(part) {
+			case "latest_telemetry":
+				includeTelemetry = true
+			case "pending_commands":
+				includeCommands = true
+			default:
+				return c.Status(400).JSON(fiber.Map{"error": "include must list latest_telemetry or pending_commands"})
+			}
+		}
 	}
 
-	if hostname != "" {
-		argCount++
-		query += ` AND hostname ILIKE $` + strconv.Itoa(argCount)
-		args = append(args, "%"+hostname+"%")
+	page, err := h.replicaDevices.List(c.UserContext(), repository.DeviceQuery{
+		Filters: params,
+		Sort:    c.Query("sort"),
+		Cursor:  c.Query("cursor"),
+		Limit:   limit,
+		Offset:  offset,
+	})
+	var queryErr *repository.QueryError
+	if errors.As(err, &queryErr) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	query += ` ORDER BY last_seen_at DESC LIMIT $` + strconv.Itoa(argCount+1) + ` OFFSET $` + strconv.Itoa(argCount+2)
-	args = append(args, limit, offset)
-
-	// Execute query
-	rows, err := h.db.Query(c.Context(), query, args...)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to query devices"})
 	}
-	defer rows.Close()
+	devices := page.Devices
 
-	var devices []models.Agent
-	for rows.Next() {
-		var device models.Agent
-		err := rows.Scan(&device.DeviceID, &device.Hostname, &device.Status,
-			&device.AgentVersion, &device.FirstSeenAt, &device.LastSeenAt)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan device"})
-		}
-		devices = append(devices, device)
+	// A cursor continues a keyset scan and takes precedence over offset
+	if c.Query("cursor") != "" {
+		offset = 0
 	}
 
-	// Get total count
-	countQuery := `SELECT COUNT(*) FROM agents WHERE 1=1`
-	countArgs := []interface{}{}
+	if err := h.replicaDevices.AttachGroups(c.UserContext(), devices); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device groups"})
+	}
 
-	if status != "" {
-		countQuery += ` AND status = $1`
-		countArgs = append(countArgs, status)
+	if includeTelemetry {
+		if err := h.replicaDevices.AttachLatestTelemetry(c.UserContext(), devices); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry"})
+		}
 	}
 
-	if hostname != "" {
-		countQuery += ` AND hostname ILIKE $2`
-		countArgs = append(countArgs, "%"+hostname+"%")
+	if includeCommands {
+		if err := h.replicaDevices.AttachPendingCommands(c.UserContext(), devices); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to query commands"})
+		}
 	}
 
-	var total int
-	err = h.db.QueryRow(c.Context(), countQuery, countArgs...).Scan(&total)
+	total, err := h.replicaDevices.Count(c.UserContext(), params)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to get total count"})
 	}
 
 	return c.JSON(fiber.Map{
-		"devices": devices,
-		"total":   total,
-		"limit":   limit,
-		"offset":  offset,
+		"devices":     devices,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": page.NextCursor,
 	})
 }
 
@@ -113,27 +138,26 @@ func (h *DeviceHandler) GetDevice(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
 	}
 
-	// Get device info
-	var device models.Agent
-	err = h.db.QueryRow(c.Context(), `
-		SELECT device_id, hostname, status, capabilities, agent_version,
-		       first_seen_at, last_seen_at
-		FROM agents WHERE device_id = $1`, deviceID).Scan(
-		&device.DeviceID, &device.Hostname, &device.Status, &device.Capabilities,
-		&device.AgentVersion, &device.FirstSeenAt, &device.LastSeenAt)
-	if err != nil {
+	device, err := h.devices.Get(c.UserContext(), deviceID)
+	if errors.Is(err, repository.ErrNotFound) {
 		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
 	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device"})
+	}
 
-	// Get latest telemetry
-	var telemetry models.Telemetry
-	err = h.db.QueryRow(c.Context(), `
-		SELECT collected_at, metrics
-		FROM telemetry_latest WHERE device_id = $1`, deviceID).Scan(
-		&telemetry.CollectedAt, &telemetry.Metrics)
+	device.Groups, err = loadDeviceGroups(c.UserContext(), h.db, deviceID)
 	if err != nil {
-		// No telemetry yet, that's ok
-		telemetry.Metrics = make(map[string]interface{})
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device groups"})
+	}
+
+	// A device that hasn't reported yet has empty telemetry
+	telemetry, err := h.devices.LatestTelemetry(c.UserContext(), deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry"})
+	}
+	if telemetry == nil {
+		telemetry = &models.Telemetry{Metrics: make(map[string]interface{})}
 	}
 
 	return c.JSON(fiber.Map{
@@ -149,6 +173,16 @@ func (h *DeviceHandler) GetDeviceTelemetry(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
 	}
 
+	if c.Query("format") != "" {
+		params := queryValues(c)
+		params.Set("device_id", deviceID.String())
+		return streamExport(c, h.replica, h.telemetry, export.KindTelemetry, params)
+	}
+
+	if c.Query("resolution") != "" || c.Query("metric") != "" {
+		return h.getTelemetrySeries(c, deviceID)
+	}
+
 	// Parse time range (default last 24 hours)
 	hours := 24
 	if h := c.Query("hours"); h != "" {
@@ -159,69 +193,256 @@ func (h *DeviceHandler) GetDeviceTelemetry(c *fiber.Ctx) error {
 
 	since := time.Now().Add(-time.Duration(hours) * time.Hour)
 
-	rows, err := h.db.Query(c.Context(), `
-		SELECT collected_at, metrics
-		FROM telemetry
-		WHERE device_id = $1 AND collected_at >= $2
-		ORDER BY collected_at DESC`, deviceID, since)
+	// Without limit or cursor the whole window is returned as a bare array,
+	// as before pagination was added
+	paginated := c.Query("limit") != "" || c.Query("cursor") != ""
+	limit := 500
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 5000 {
+			limit = parsed
+		}
+	}
+
+	q := repository.HistoryQuery{Since: since, Cursor: c.Query("cursor")}
+	if paginated {
+		q.Limit = limit
+	}
+	telemetry, nextCursor, err := h.telemetry.History(c.UserContext(), deviceID, q)
+	var queryErr *repository.QueryError
+	if errors.As(err, &queryErr) {
+		return c.Status(400).JSON(fiber.Map{"error": queryErr.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry"})
 	}
-	defer rows.Close()
 
-	var telemetry []models.Telemetry
-	for rows.Next() {
-		var t models.Telemetry
-		err := rows.Scan(&t.CollectedAt, &t.Metrics)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan telemetry"})
-		}
-		t.DeviceID = deviceID
-		telemetry = append(telemetry, t)
+	if !paginated {
+		return c.JSON(telemetry)
 	}
 
-	return c.JSON(telemetry)
+	return c.JSON(fiber.Map{
+		"data":        telemetry,
+		"next_cursor": nextCursor,
+	})
 }
 
 func (h *DeviceHandler) GetDeviceStats(c *fiber.Ctx) error {
 	var stats struct {
-		TotalDevices     int64 `json:"total_devices"`
-		ActiveDevices    int64 `json:"active_devices"`
-		OfflineDevices   int64 `json:"offline_devices"`
-		InactiveDevices  int64 `json:"inactive_devices"`
-		RecentTelemetry  int64 `json:"recent_telemetry"`
-		PendingCommands  int64 `json:"pending_commands"`
+		TotalDevices    int64 `json:"total_devices"`
+		ActiveDevices   int64 `json:"active_devices"`
+		OfflineDevices  int64 `json:"offline_devices"`
+		InactiveDevices int64 `json:"inactive_devices"`
+		RecentTelemetry int64 `json:"recent_telemetry"`
+		PendingCommands int64 `json:"pending_commands"`
+		Lifecycle       struct {
+			Expected    int64 `json:"expected"`
+			Enrolled    int64 `json:"enrolled"`
+			Active      int64 `json:"active"`
+			Quarantined int64 `json:"quarantined"`
+			Retired     int64 `json:"retired"`
+		} `json:"lifecycle"`
+		Health struct {
+			AverageScore *float64 `json:"average_score"`
+			Healthy      int64    `json:"healthy"`
+			Warning      int64    `json:"warning"`
+			Critical     int64    `json:"critical"`
+		} `json:"health"`
+	}
+
+	// Tag filters narrow every count to the matching devices
+	tagWhere, args := database.TagFilterSQL(queryValues(c)["tag"], "a.device_id", nil)
+	scope := ""
+	if tagWhere != "" {
+		scope = ` AND device_id IN (SELECT a.device_id FROM agents a WHERE 1=1` + tagWhere + `)`
 	}
 
 	// Get device counts by status
-	err := h.db.QueryRow(c.Context(), `
+	err := h.replica.QueryRow(c.UserContext(), `
 		SELECT
 			COUNT(*) as total,
 			COUNT(*) FILTER (WHERE status = 'active') as active,
 			COUNT(*) FILTER (WHERE status = 'offline') as offline,
 			COUNT(*) FILTER (WHERE status = 'inactive') as inactive
-		FROM agents`).Scan(&stats.TotalDevices, &stats.ActiveDevices, &stats.OfflineDevices, &stats.InactiveDevices)
+		FROM agents WHERE 1=1`+scope, args...).Scan(&stats.TotalDevices, &stats.ActiveDevices, &stats.OfflineDevices, &stats.InactiveDevices)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device stats"})
 	}
 
+	// Lifecycle counts. Expected devices have no tags, so a tag filter
+	// leaves none.
+	err = h.replica.QueryRow(c.UserContext(), `
+		SELECT
+			COUNT(*) FILTER (WHERE lifecycle_state = 'enrolled'),
+			COUNT(*) FILTER (WHERE lifecycle_state = 'active'),
+			COUNT(*) FILTER (WHERE lifecycle_state = 'quarantined'),
+			COUNT(*) FILTER (WHERE lifecycle_state = 'retired')
+		FROM agents WHERE 1=1`+scope, args...).Scan(&stats.Lifecycle.Enrolled, &stats.Lifecycle.Active,
+		&stats.Lifecycle.Quarantined, &stats.Lifecycle.Retired)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device stats"})
+	}
+	if scope == "" {
+		err = h.replica.QueryRow(c.UserContext(),
+			"SELECT COUNT(*) FROM expected_devices WHERE device_id IS NULL").Scan(&stats.Lifecycle.Expected)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to query device stats"})
+		}
+	}
+
 	// Get recent telemetry count (last 24 hours)
-	err = h.db.QueryRow(c.Context(), `
-		SELECT COUNT(*) FROM telemetry WHERE collected_at >= NOW() - INTERVAL '24 hours'`,
-	).Scan(&stats.RecentTelemetry)
+	stats.RecentTelemetry, err = h.telemetry.CountSince(c.UserContext(), time.Now().Add(-24*time.Hour), tagWhere, args)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry stats"})
 	}
 
 	// Get pending commands count
-	err = h.db.QueryRow(c.Context(), `
+	err = h.replica.QueryRow(c.UserContext(), `
 		SELECT COUNT(*) FROM commands
 		WHERE status = 'pending'
-		  AND issued_at + (ttl_seconds || ' seconds')::interval > NOW()`,
-	).Scan(&stats.PendingCommands)
+		  AND COALESCE(not_before, issued_at) + (ttl_seconds || ' seconds')::interval > NOW()`+scope,
+		args...).Scan(&stats.PendingCommands)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to query command stats"})
 	}
 
+	// Health bands: healthy 80 and up, warning 50-79, critical below 50.
+	// Retired devices are left out.
+	err = h.replica.QueryRow(c.UserContext(), `
+		SELECT ROUND(AVG(h.score), 1)::float8,
+		       COUNT(*) FILTER (WHERE h.score >= 80),
+		       COUNT(*) FILTER (WHERE h.score >= 50 AND h.score < 80),
+		       COUNT(*) FILTER (WHERE h.score < 50)
+		FROM agents a`+database.DeviceHealthJoin+`
+		WHERE a.status <> 'retired'`+scope,
+		args...).Scan(&stats.Health.AverageScore, &stats.Health.Healthy, &stats.Health.Warning, &stats.Health.Critical)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device health"})
+	}
+
 	return c.JSON(fiber.Map{"data": stats})
-}
\ No newline at end of file
+}
+
+// DeviceUpdateRequest carries the admin-editable parts of a device record.
+// A null custom field value removes that field from the device.
+type DeviceUpdateRequest struct {
+	Notes        *string                `json:"notes"`
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+// UpdateDevice applies a partial update to a device's notes and custom fields
+func (h *DeviceHandler) UpdateDevice(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var req DeviceUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Notes == nil && len(req.CustomFields) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "notes or custom_fields is required"})
+	}
+
+	if req.Notes != nil && len(*req.Notes) > 10000 {
+		return c.Status(400).JSON(fiber.Map{"error": "notes cannot exceed 10000 characters"})
+	}
+
+	set := map[string]interface{}{}
+	unset := []string{}
+	if len(req.CustomFields) > 0 {
+		defs, err := loadCustomFieldDefinitions(c.UserContext(), h.db)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to query custom fields"})
+		}
+
+		for key, value := range req.CustomFields {
+			def, ok := defs[key]
+			if !ok {
+				return c.Status(400).JSON(fiber.Map{"error": "Unknown custom field: " + key})
+			}
+			if value == nil {
+				unset = append(unset, key)
+				continue
+			}
+			if err := def.ValidateValue(value); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid custom field: " + err.Error()})
+			}
+			set[key] = value
+		}
+	}
+
+	var device models.Agent
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE agents
+		SET notes = COALESCE($2, notes),
+		    custom_fields = (custom_fields || $3::jsonb) - $4::text[]
+		WHERE device_id = $1
+		RETURNING device_id, hostname, status, lifecycle_state, agent_version, first_seen_at, last_seen_at,
+		          COALESCE(notes, ''), custom_fields`,
+		deviceID, req.Notes, set, unset).Scan(
+		&device.DeviceID, &device.Hostname, &device.Status, &device.LifecycleState, &device.AgentVersion,
+		&device.FirstSeenAt, &device.LastSeenAt, &device.Notes, &device.CustomFields)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	// Audit failures don't undo the update
+	err = audit.Record(c.UserContext(), h.db, adminUser(c), "update", "agent", deviceID.String(), req)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to audit device update", "device_id", deviceID, "error", err)
+	}
+
+	return c.JSON(fiber.Map{"data": device})
+}
+
+// DeleteDevice retires a device: its token is revoked, pending commands are
+// cancelled and device-scoped policies and group memberships are removed.
+// With ?purge=true the device's telemetry and record are also scheduled for
+// deletion by the device purger.
+func (h *DeviceHandler) DeleteDevice(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	purge := c.QueryBool("purge")
+	actor := adminUser(c)
+	ctx := c.UserContext()
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to retire device"})
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	var purgeAfter *time.Time
+	err = tx.QueryRow(ctx,
+		"SELECT status, purge_after FROM agents WHERE device_id = $1 FOR UPDATE",
+		deviceID).Scan(&status, &purgeAfter)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	if status == "retired" && (!purge || purgeAfter != nil) {
+		return c.Status(409).JSON(fiber.Map{"error": "Device is already retired"})
+	}
+
+	details := map[string]interface{}{}
+	retiredAt, err := database.RetireDevice(ctx, tx, deviceID, actor, purge, details)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to retire device"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to retire device"})
+	}
+
+	details["device_id"] = deviceID
+	details["status"] = "retired"
+	details["retired_at"] = retiredAt
+
+	return c.JSON(fiber.Map{"data": details})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+)
+
+// sseHeartbeat keeps idle connections open through proxies and detects
+// clients that went away
+const sseHeartbeat = 15 * time.Second
+
+type EventsHandler struct {
+	js nats.JetStream
+}
+
+func NewEventsHandler(js nats.JetStream) *EventsHandler {
+	return &EventsHandler{js: js}
+}
+
+// Stream serves the events stream as server-sent events. ?types= narrows it
+// to a comma-separated list of event types. Each event's id is its stream
+// sequence, so a reconnecting EventSource resumes after Last-Event-ID
+// without gaps as long as it's within the stream's retention.
+func (h *EventsHandler) Stream(c *fiber.Ctx) error {
+	types := make(map[string]bool)
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+
+	opts := []nats.SubOpt{nats.OrderedConsumer()}
+	if lastID := c.Get("Last-Event-ID"); lastID != "" {
+		seq, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid Last-Event-ID"})
+		}
+		opts = append(opts, nats.StartSequence(seq+1))
+	} else {
+		opts = append(opts, nats.DeliverNew())
+	}
+
+	msgs := make(chan *nats.Msg, 256)
+	sub, err := h.js.ChanSubscribe(events.Subject(">"), msgs, opts...)
+	if err != nil {
+		return c.Status(503).JSON(fiber.Map{"error": "Event stream unavailable"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Unsubscribe()
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case msg := <-msgs:
+				eventType := events.TypeOf(msg.Subject)
+				if len(types) > 0 && !types[eventType] {
+					continue
+				}
+
+				meta, err := msg.Metadata()
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", meta.Sequence.Stream, eventType, msg.Data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type ExpectedDeviceHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewExpectedDeviceHandler(db *pgxpool.Pool) *ExpectedDeviceHandler {
+	return &ExpectedDeviceHandler{db: db}
+}
+
+const expectedDeviceColumns = `e.expected_id, e.org_id, e.hostname, e.serial_number, e.owner, e.site,
+	e.status, e.device_id, e.linked_at, COALESCE(e.imported_by, ''), e.created_at, e.updated_at`
+
+func scanExpectedDevice(row pgx.Row, d *models.ExpectedDevice) error {
+	return row.Scan(&d.ExpectedID, &d.OrgID, &d.Hostname, &d.SerialNumber, &d.Owner, &d.Site,
+		&d.Status, &d.DeviceID, &d.LinkedAt, &d.ImportedBy, &d.CreatedAt, &d.UpdatedAt)
+}
+
+// csvColumns maps accepted CSV header names to the field they fill
+var csvColumns = map[string]string{
+	"hostname":      "hostname",
+	"serial_number": "serial_number",
+	"serial":        "serial_number",
+	"owner":         "owner",
+	"site":          "site",
+}
+
+// Import creates or updates expected devices from a JSON array or a CSV
+// file with a header row (Content-Type: text/csv). Rows are keyed by serial
+// number, or by hostname when they have none, so re-importing updates them.
+// Invalid rows are reported and skipped. Imported devices are then linked to
+// any matching devices that have already registered.
+func (h *ExpectedDeviceHandler) Import(c *fiber.Ctx) error {
+	var (
+		devices []models.ExpectedDevice
+		err     error
+	)
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv") {
+		devices, err = parseExpectedDevicesCSV(c.Body())
+	} else {
+		err = json.Unmarshal(c.Body(), &devices)
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid import data: " + err.Error()})
+	}
+
+	if len(devices) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "No devices to import"})
+	}
+	if len(devices) > models.MaxExpectedDeviceImport {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("Cannot import more than %d devices at once", models.MaxExpectedDeviceImport),
+		})
+	}
+
+	result := models.ExpectedDeviceImport{Errors: []models.ExpectedDeviceImportError{}}
+	importedBy := adminUser(c)
+
+	batch := &pgx.Batch{}
+	for i := range devices {
+		d := &devices[i]
+		d.Normalize()
+		if err := d.Validate(); err != nil {
+			result.Errors = append(result.Errors, models.ExpectedDeviceImportError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+
+		// Serial and hostname keyed rows are covered by different partial
+		// unique indexes
+		conflict := `(org_id, lower(serial_number)) WHERE serial_number IS NOT NULL`
+		if d.SerialNumber == nil {
+			conflict = `(org_id, lower(hostname)) WHERE serial_number IS NULL`
+		}
+		batch.Queue(`
+			INSERT INTO expected_devices (hostname, serial_number, owner, site, imported_by)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT `+conflict+` DO UPDATE SET
+				hostname = EXCLUDED.hostname,
+				owner = EXCLUDED.owner,
+				site = EXCLUDED.site,
+				imported_by = EXCLUDED.imported_by
+			RETURNING xmax = 0`,
+			d.Hostname, d.SerialNumber, d.Owner, d.Site, importedBy)
+	}
+
+	tx, err := h.db.Begin(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to import devices"})
+	}
+	defer tx.Rollback(c.UserContext())
+
+	results := tx.SendBatch(c.UserContext(), batch)
+	for i := 0; i < batch.Len(); i++ {
+		var created bool
+		if err := results.QueryRow().Scan(&created); err != nil {
+			results.Close()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to import devices"})
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+		}
+	}
+	if err := results.Close(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to import devices"})
+	}
+
+	if err := tx.Commit(c.UserContext()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to import devices"})
+	}
+
+	linked, err := database.LinkExpectedDevices(c.UserContext(), h.db, nil)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to link imported devices", "error", err)
+	}
+	result.Linked = int(linked)
+
+	return c.JSON(fiber.Map{"data": result})
+}
+
+// parseExpectedDevicesCSV reads hostname, serial_number (or serial), owner
+// and site columns by header name, ignoring any others
+func parseExpectedDevicesCSV(data []byte) ([]models.ExpectedDevice, error) {
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing header row")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := csvColumns[name]; ok {
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["hostname"]; !ok {
+		if _, ok := columns["serial_number"]; !ok {
+			return nil, fmt.Errorf("header must include hostname or serial_number")
+		}
+	}
+
+	field := func(record []string, name string) *string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return nil
+		}
+		value := record[i]
+		return &value
+	}
+
+	var devices []models.ExpectedDevice
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, models.ExpectedDevice{
+			Hostname:     field(record, "hostname"),
+			SerialNumber: field(record, "serial_number"),
+			Owner:        field(record, "owner"),
+			Site:         field(record, "site"),
+		})
+	}
+
+	return devices, nil
+}
+
+// GetExpectedDevices lists expected devices newest first, filtered by
+// status (expected or linked), site and owner
+func (h *ExpectedDeviceHandler) GetExpectedDevices(c *fiber.Ctx) error {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	for _, col := range []string{"status", "site", "owner"} {
+		if value := c.Query(col); value != "" {
+			args = append(args, value)
+			where += ` AND e.` + col + ` = $` + strconv.Itoa(len(args))
+		}
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.Int64CursorWhere(cur, "e.created_at", "e.expected_id", args)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		where += cursorWhere
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT `+expectedDeviceColumns+`
+		FROM expected_devices e`+where+`
+		ORDER BY e.created_at DESC, e.expected_id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1),
+		append(args, limit+1)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query expected devices"})
+	}
+	defer rows.Close()
+
+	devices := []models.ExpectedDevice{}
+	for rows.Next() {
+		var d models.ExpectedDevice
+		if err := scanExpectedDevice(rows, &d); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan expected device"})
+		}
+		devices = append(devices, d)
+	}
+
+	var nextCursor string
+	if len(devices) > limit {
+		devices = devices[:limit]
+		last := devices[limit-1]
+		nextCursor = database.EncodeCursor(last.CreatedAt, strconv.FormatInt(last.ExpectedID, 10))
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        devices,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
+
+// DeleteExpectedDevice removes an expected device, e.g. one that was never
+// delivered. A registered device it was linked to is unaffected.
+func (h *ExpectedDeviceHandler) DeleteExpectedDevice(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid expected device ID"})
+	}
+
+	tag, err := h.db.Exec(c.UserContext(), "DELETE FROM expected_devices WHERE expected_id = $1", id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete expected device"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Expected device not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Expected device deleted"})
+}
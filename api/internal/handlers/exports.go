@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/export"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// streamTimeout bounds how long a synchronous ?format= export may run;
+// larger exports should go through the export job API
+const streamTimeout = 10 * time.Minute
+
+// streamExport answers a list request carrying ?format=csv|xlsx with the
+// whole unpaginated result set as a file download. telemetry is only used
+// by telemetry exports and may be nil for the other kinds.
+func streamExport(c *fiber.Ctx, db *pgxpool.Pool, telemetry *repository.Telemetry, kind string, params url.Values) error {
+	format := params.Get("format")
+	if !export.ValidFormat(format) {
+		return c.Status(400).JSON(fiber.Map{"error": "format must be csv or xlsx"})
+	}
+
+	q, err := export.Build(kind, params)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", kind, time.Now().UTC().Format("20060102-150405"), format)
+	c.Set(fiber.HeaderContentType, export.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+
+	// The request context is recycled once the handler returns, so the
+	// stream runs on its own context, logging with the request's fields
+	logger := logging.FromContext(c.UserContext())
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+		defer cancel()
+
+		w, err := export.NewWriter(format, bw)
+		if err != nil {
+			logger.Error("Failed to start export", "kind", kind, "error", err)
+			return
+		}
+		if _, err := export.Run(ctx, db, telemetry, q, w); err != nil {
+			logger.Error("Failed to stream export", "kind", kind, "error", err)
+		}
+		if err := w.Close(); err != nil {
+			logger.Error("Failed to finish export", "kind", kind, "error", err)
+		}
+	})
+	return nil
+}
+
+type ExportHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewExportHandler(db *pgxpool.Pool) *ExportHandler {
+	return &ExportHandler{db: db}
+}
+
+// ExportRequest queues an export. Params are the query parameters the
+// matching list endpoint accepts; telemetry exports need params.device_id.
+type ExportRequest struct {
+	Kind   string              `json:"kind"`
+	Format string              `json:"format"`
+	Params map[string][]string `json:"params"`
+}
+
+func (h *ExportHandler) CreateExport(c *fiber.Ctx) error {
+	var req ExportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Format == "" {
+		req.Format = export.FormatCSV
+	}
+	if !export.ValidFormat(req.Format) {
+		return c.Status(400).JSON(fiber.Map{"error": "format must be csv or xlsx"})
+	}
+	if req.Params == nil {
+		req.Params = map[string][]string{}
+	}
+
+	// Build the query up front so bad parameters fail now rather than in the runner
+	if _, err := export.Build(req.Kind, req.Params); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	job := models.ExportJob{
+		Kind:      req.Kind,
+		Format:    req.Format,
+		Params:    req.Params,
+		Status:    models.ExportStatusPending,
+		CreatedBy: adminUser(c),
+	}
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO export_jobs (kind, format, params, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING job_id, created_at`,
+		job.Kind, job.Format, job.Params, job.CreatedBy).Scan(&job.JobID, &job.CreatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create export job"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, job.CreatedBy, "create", "export", job.JobID.String(),
+		map[string]interface{}{"kind": job.Kind, "format": job.Format, "params": job.Params})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to write audit log for export", "job_id", job.JobID, "error", err)
+	}
+
+	return c.Status(202).JSON(fiber.Map{"data": job})
+}
+
+func (h *ExportHandler) GetExport(c *fiber.Ctx) error {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid export ID"})
+	}
+
+	job, _, err := loadExportJob(c.UserContext(), h.db, jobID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Export not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": job})
+}
+
+func (h *ExportHandler) DownloadExport(c *fiber.Ctx) error {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid export ID"})
+	}
+
+	job, path, err := loadExportJob(c.UserContext(), h.db, jobID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Export not found"})
+	}
+
+	if job.Status != models.ExportStatusCompleted || path == "" {
+		return c.Status(409).JSON(fiber.Map{"error": "Export is not ready", "status": job.Status})
+	}
+
+	c.Set(fiber.HeaderContentType, export.ContentType(job.Format))
+	return c.Download(path, fmt.Sprintf("%s-%s.%s", job.Kind, job.CreatedAt.UTC().Format("20060102-150405"), job.Format))
+}
+
+// loadExportJob returns an export job and the path of its file, which is
+// empty until the job completes
+func loadExportJob(ctx context.Context, db *pgxpool.Pool, jobID uuid.UUID) (*models.ExportJob, string, error) {
+	var job models.ExportJob
+	var path string
+	err := db.QueryRow(ctx, `
+		SELECT job_id, kind, format, params, status, row_count, error, COALESCE(created_by, ''),
+		       created_at, started_at, completed_at, expires_at, COALESCE(file_path, '')
+		FROM export_jobs WHERE job_id = $1`, jobID).Scan(
+		&job.JobID, &job.Kind, &job.Format, &job.Params, &job.Status, &job.RowCount, &job.Error,
+		&job.CreatedBy, &job.CreatedAt, &job.StartedAt, &job.CompletedAt, &job.ExpiresAt, &path)
+	if err != nil {
+		return nil, "", err
+	}
+	return &job, path, nil
+}
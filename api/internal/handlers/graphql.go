@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// GraphQLHandler serves a read-only GraphQL view over devices, their latest
+// telemetry, commands and effective policy, so a dashboard can fetch a
+// device page in one round-trip. Field names match the REST JSON.
+type GraphQLHandler struct {
+	db         *pgxpool.Pool
+	deviceRepo *repository.Devices
+	schema     graphql.Schema
+}
+
+func NewGraphQLHandler(db *pgxpool.Pool) (*GraphQLHandler, error) {
+	h := &GraphQLHandler{db: db, deviceRepo: repository.NewDevices(db)}
+
+	schema, err := h.buildSchema()
+	if err != nil {
+		return nil, err
+	}
+	h.schema = schema
+
+	return h, nil
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+func (h *GraphQLHandler) Query(c *fiber.Ctx) error {
+	var req graphQLRequest
+	if err := c.BodyParser(&req); err != nil || req.Query == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Request body must contain a query"})
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        c.UserContext(),
+	})
+
+	// Per the GraphQL-over-HTTP convention, field errors still return 200
+	// alongside partial data; only requests that fail to execute are 400
+	if result.Data == nil && result.HasErrors() {
+		return c.Status(400).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+// jsonScalar passes JSONB documents (metrics, parameters, config) through
+// unchanged
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "An arbitrary JSON value",
+	Serialize:   func(value interface{}) interface{} { return value },
+	ParseValue:  func(value interface{}) interface{} { return value },
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return valueAST.GetValue()
+	},
+})
+
+func (h *GraphQLHandler) buildSchema() (graphql.Schema, error) {
+	groupType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "GroupRef",
+		Fields: graphql.Fields{
+			"group_id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"name":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	telemetryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Telemetry",
+		Fields: graphql.Fields{
+			"collected_at": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"metrics":      &graphql.Field{Type: jsonScalar},
+			"errors":       &graphql.Field{Type: jsonScalar},
+		},
+	})
+
+	commandType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Command",
+		Fields: graphql.Fields{
+			"command_id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"device_id":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"type":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"parameters":   &graphql.Field{Type: jsonScalar},
+			"status":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"issued_at":    &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"ttl_seconds":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"result":       &graphql.Field{Type: jsonScalar},
+			"completed_at": &graphql.Field{Type: graphql.DateTime},
+			"batch_id":     &graphql.Field{Type: graphql.ID},
+		},
+	})
+
+	policyType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Policy",
+		Fields: graphql.Fields{
+			"policy_id":    &graphql.Field{Type: graphql.Int},
+			"scope":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"version":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"device_id":    &graphql.Field{Type: graphql.ID},
+			"group_id":     &graphql.Field{Type: graphql.Int},
+			"config":       &graphql.Field{Type: jsonScalar},
+			"created_by":   &graphql.Field{Type: graphql.String},
+			"created_at":   &graphql.Field{Type: graphql.DateTime},
+			"effective_at": &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	deviceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Device",
+		Fields: graphql.Fields{
+			"device_id":       &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"hostname":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"status":          &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"lifecycle_state": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"agent_version":   &graphql.Field{Type: graphql.String},
+			"first_seen_at":   &graphql.Field{Type: graphql.DateTime},
+			"last_seen_at":    &graphql.Field{Type: graphql.DateTime},
+			"retired_at":      &graphql.Field{Type: graphql.DateTime},
+			"notes":           &graphql.Field{Type: graphql.String},
+			"custom_fields":   &graphql.Field{Type: jsonScalar},
+			"capabilities":    &graphql.Field{Type: jsonScalar},
+			"tags": &graphql.Field{
+				Type: jsonScalar,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					device := p.Source.(*models.Agent)
+					if device.Tags != nil {
+						return device.Tags, nil
+					}
+					return loadDeviceTags(p.Context, h.db, device.DeviceID)
+				},
+			},
+			"groups": &graphql.Field{
+				Type: graphql.NewList(groupType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadDeviceGroups(p.Context, h.db, p.Source.(*models.Agent).DeviceID)
+				},
+			},
+			"latest_telemetry": &graphql.Field{
+				Type: telemetryType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.latestTelemetry(p.Context, p.Source.(*models.Agent).DeviceID)
+				},
+			},
+			"pending_commands": &graphql.Field{
+				Type: graphql.NewList(commandType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.commands(p.Context, &p.Source.(*models.Agent).DeviceID, "pending", 100)
+				},
+			},
+			"effective_policy": &graphql.Field{
+				Type: policyType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.effectivePolicy(p.Context, p.Source.(*models.Agent))
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"device": &graphql.Field{
+				Type: deviceType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					deviceID, err := uuid.Parse(p.Args["id"].(string))
+					if err != nil {
+						return nil, fmt.Errorf("invalid device ID")
+					}
+					return h.device(p.Context, deviceID)
+				},
+			},
+			"devices": &graphql.Field{
+				Type: graphql.NewList(deviceType),
+				Description: "Devices ordered by last check-in; status, lifecycle, hostname and tag " +
+					"filter as on GET /v1/devices",
+				Args: graphql.FieldConfigArgument{
+					"status":    &graphql.ArgumentConfig{Type: graphql.String},
+					"lifecycle": &graphql.ArgumentConfig{Type: graphql.String},
+					"hostname":  &graphql.ArgumentConfig{Type: graphql.String},
+					"group_id":  &graphql.ArgumentConfig{Type: graphql.Int},
+					"tag":       &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String)},
+					"limit":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 50},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return h.devices(p.Context, p.Args)
+				},
+			},
+			"commands": &graphql.Field{
+				Type: graphql.NewList(commandType),
+				Args: graphql.FieldConfigArgument{
+					"device_id": &graphql.ArgumentConfig{Type: graphql.ID},
+					"status":    &graphql.ArgumentConfig{Type: graphql.String},
+					"limit":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 100},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var deviceID *uuid.UUID
+					if s, ok := p.Args["device_id"].(string); ok {
+						id, err := uuid.Parse(s)
+						if err != nil {
+							return nil, fmt.Errorf("invalid device ID")
+						}
+						deviceID = &id
+					}
+					status, _ := p.Args["status"].(string)
+					return h.commands(p.Context, deviceID, status, p.Args["limit"].(int))
+				},
+			},
+			"policies": &graphql.Field{
+				Type: graphql.NewList(policyType),
+				Args: graphql.FieldConfigArgument{
+					"scope": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					scope, _ := p.Args["scope"].(string)
+					return h.policies(p.Context, scope)
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func (h *GraphQLHandler) device(ctx context.Context, deviceID uuid.UUID) (*models.Agent, error) {
+	device, err := h.deviceRepo.Get(ctx, deviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// A missing device resolves to null rather than an error
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device")
+	}
+	return device, nil
+}
+
+func (h *GraphQLHandler) devices(ctx context.Context, args map[string]interface{}) ([]*models.Agent, error) {
+	limit := args["limit"].(int)
+	if limit <= 0 || limit > 100 {
+		return nil, fmt.Errorf("limit must be between 1 and 100")
+	}
+
+	params := url.Values{}
+	for _, key := range []string{"status", "lifecycle", "hostname"} {
+		if s, ok := args[key].(string); ok {
+			params.Set(key, s)
+		}
+	}
+	if groupID, ok := args["group_id"].(int); ok {
+		params.Set("group_id", strconv.Itoa(groupID))
+	}
+	if tags, ok := args["tag"].([]interface{}); ok {
+		for _, tag := range tags {
+			if s, ok := tag.(string); ok {
+				params.Add("tag", s)
+			}
+		}
+	}
+
+	page, err := h.deviceRepo.List(ctx, repository.DeviceQuery{Filters: params, Limit: limit})
+	var queryErr *repository.QueryError
+	if errors.As(err, &queryErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices")
+	}
+
+	devices := make([]*models.Agent, len(page.Devices))
+	for i := range page.Devices {
+		devices[i] = &page.Devices[i]
+	}
+	return devices, nil
+}
+
+func (h *GraphQLHandler) latestTelemetry(ctx context.Context, deviceID uuid.UUID) (*models.Telemetry, error) {
+	telemetry, err := h.deviceRepo.LatestTelemetry(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query telemetry")
+	}
+	return telemetry, nil
+}
+
+func (h *GraphQLHandler) commands(ctx context.Context, deviceID *uuid.UUID, status string, limit int) ([]models.Command, error) {
+	if limit <= 0 || limit > 1000 {
+		return nil, fmt.Errorf("limit must be between 1 and 1000")
+	}
+
+	query := `
+		SELECT command_id, device_id, type, parameters, issued_at, ttl_seconds,
+		       status, result, completed_at, batch_id
+		FROM commands
+		WHERE 1=1`
+	args := []interface{}{}
+
+	if deviceID != nil {
+		args = append(args, *deviceID)
+		query += ` AND device_id = $` + strconv.Itoa(len(args))
+	}
+	if status != "" {
+		args = append(args, status)
+		query += ` AND status = $` + strconv.Itoa(len(args))
+	}
+
+	args = append(args, limit)
+	query += ` ORDER BY issued_at DESC, command_id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := h.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query commands")
+	}
+	defer rows.Close()
+
+	commands := []models.Command{}
+	for rows.Next() {
+		var cmd models.Command
+		err := rows.Scan(&cmd.CommandID, &cmd.DeviceID, &cmd.Type, &cmd.Parameters,
+			&cmd.IssuedAt, &cmd.TTLSeconds, &cmd.Status, &cmd.Result, &cmd.CompletedAt, &cmd.BatchID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan command")
+		}
+		commands = append(commands, cmd)
+	}
+
+	return commands, rows.Err()
+}
+
+// effectivePolicy resolves the policy the agent would receive, filtered by
+// its capabilities as on GET /v1/devices/:id/effective-policy
+func (h *GraphQLHandler) effectivePolicy(ctx context.Context, device *models.Agent) (*models.Policy, error) {
+	policies, memberOf, err := loadApplicablePolicies(ctx, h.db, device.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policies")
+	}
+
+	effective := models.ResolveEffectivePolicy(policies, device.DeviceID, memberOf)
+	if effective == nil {
+		effective = models.DefaultPolicy()
+	}
+	effective.FilterByCapabilities(device.Capabilities)
+
+	return effective, nil
+}
+
+func (h *GraphQLHandler) policies(ctx context.Context, scope string) ([]models.Policy, error) {
+	query := `
+		SELECT policy_id, device_id, group_id, scope, version, config, created_by, created_at, effective_at
+		FROM policies`
+	args := []interface{}{}
+	if scope != "" {
+		query += ` WHERE scope = $1`
+		args = append(args, scope)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := h.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policies")
+	}
+	defer rows.Close()
+
+	policies := []models.Policy{}
+	for rows.Next() {
+		var policy models.Policy
+		err := rows.Scan(&policy.PolicyID, &policy.DeviceID, &policy.GroupID, &policy.Scope,
+			&policy.Version, &policy.Config, &policy.CreatedBy, &policy.CreatedAt, &policy.EffectiveAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan policy")
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
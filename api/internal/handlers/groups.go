@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/policycache"
+)
+
+type GroupHandler struct {
+	db    *pgxpool.Pool
+	cache *policycache.Cache
+}
+
+type GroupMembershipRequest struct {
+	DeviceIDs []string `json:"device_ids"`
+}
+
+// NewGroupHandler creates the group handler. Membership changes invalidate
+// the cached effective policies of the devices involved.
+func NewGroupHandler(db *pgxpool.Pool, cache *policycache.Cache) *GroupHandler {
+	return &GroupHandler{db: db, cache: cache}
+}
+
+func (h *GroupHandler) GetGroups(c *fiber.Ctx) error {
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT g.group_id, g.org_id, g.name, COALESCE(g.description, ''), COALESCE(g.created_by, ''),
+		       g.created_at, g.updated_at, g.filter_id, g.last_evaluated_at, COUNT(m.device_id)
+		FROM device_groups g
+		LEFT JOIN device_group_members m ON m.group_id = g.group_id
+		GROUP BY g.group_id
+		ORDER BY g.name`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query groups"})
+	}
+	defer rows.Close()
+
+	var groups []models.DeviceGroup
+	for rows.Next() {
+		var group models.DeviceGroup
+		err := rows.Scan(&group.GroupID, &group.OrgID, &group.Name, &group.Description,
+			&group.CreatedBy, &group.CreatedAt, &group.UpdatedAt, &group.FilterID,
+			&group.LastEvaluatedAt, &group.DeviceCount)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan group"})
+		}
+		groups = append(groups, group)
+	}
+
+	return c.JSON(fiber.Map{"data": groups})
+}
+
+func (h *GroupHandler) GetGroup(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	var group models.DeviceGroup
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT g.group_id, g.org_id, g.name, COALESCE(g.description, ''), COALESCE(g.created_by, ''),
+		       g.created_at, g.updated_at, g.filter_id, g.last_evaluated_at,
+		       (SELECT COUNT(*) FROM device_group_members m WHERE m.group_id = g.group_id)
+		FROM device_groups g WHERE g.group_id = $1`, groupID).Scan(
+		&group.GroupID, &group.OrgID, &group.Name, &group.Description,
+		&group.CreatedBy, &group.CreatedAt, &group.UpdatedAt, &group.FilterID,
+		&group.LastEvaluatedAt, &group.DeviceCount)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Group not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": group})
+}
+
+func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
+	var group models.DeviceGroup
+	if err := c.BodyParser(&group); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group data"})
+	}
+
+	if err := group.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group: " + err.Error()})
+	}
+
+	if group.OrgID == 0 {
+		group.OrgID = 1
+	}
+	group.CreatedBy = adminUser(c)
+
+	var filter *models.SavedFilter
+	if group.IsSmart() {
+		var err error
+		filter, err = loadSavedFilter(c.UserContext(), h.db, *group.FilterID)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Filter not found"})
+		}
+	}
+
+	ctx := c.UserContext()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create group"})
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO device_groups (org_id, name, description, created_by, filter_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING group_id, created_at, updated_at`,
+		group.OrgID, group.Name, group.Description, group.CreatedBy, group.FilterID).Scan(
+		&group.GroupID, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create group"})
+	}
+
+	// Smart groups are populated up front rather than waiting for the evaluator
+	if filter != nil {
+		added, _, err := database.RefreshSmartGroup(ctx, tx, group.GroupID, &filter.Filter)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to evaluate smart group"})
+		}
+		group.DeviceCount = added
+		now := time.Now()
+		group.LastEvaluatedAt = &now
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create group"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": group})
+}
+
+func (h *GroupHandler) UpdateGroup(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	var updates models.DeviceGroup
+	if err := c.BodyParser(&updates); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group data"})
+	}
+
+	if err := updates.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group: " + err.Error()})
+	}
+
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE device_groups
+		SET name = $2, description = $3
+		WHERE group_id = $1
+		RETURNING group_id, org_id, COALESCE(created_by, ''), created_at, updated_at, filter_id, last_evaluated_at`,
+		groupID, updates.Name, updates.Description).Scan(
+		&updates.GroupID, &updates.OrgID, &updates.CreatedBy, &updates.CreatedAt, &updates.UpdatedAt,
+		&updates.FilterID, &updates.LastEvaluatedAt)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Group not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": updates})
+}
+
+func (h *GroupHandler) DeleteGroup(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	// Memberships, group-scoped policies and alert rules are removed by ON
+	// DELETE CASCADE
+	result, err := h.db.Exec(c.UserContext(), "DELETE FROM device_groups WHERE group_id = $1", groupID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete group"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Group not found"})
+	}
+
+	h.cache.InvalidateAll(c.UserContext())
+
+	return c.JSON(fiber.Map{"message": "Group deleted"})
+}
+
+func (h *GroupHandler) GetGroupDevices(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT a.device_id, a.hostname, a.status, a.agent_version, a.first_seen_at, a.last_seen_at
+		FROM device_group_members m
+		JOIN agents a ON a.device_id = m.device_id
+		WHERE m.group_id = $1
+		ORDER BY a.hostname`, groupID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query group devices"})
+	}
+	defer rows.Close()
+
+	var devices []models.Agent
+	for rows.Next() {
+		var device models.Agent
+		err := rows.Scan(&device.DeviceID, &device.Hostname, &device.Status,
+			&device.AgentVersion, &device.FirstSeenAt, &device.LastSeenAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan device"})
+		}
+		devices = append(devices, device)
+	}
+
+	return c.JSON(fiber.Map{"data": devices})
+}
+
+// AddGroupDevices adds devices to a group's static membership. Devices that
+// are already members are left untouched.
+func (h *GroupHandler) AddGroupDevices(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	var req GroupMembershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if len(req.DeviceIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "device_ids is required"})
+	}
+
+	deviceIDs := make([]uuid.UUID, 0, len(req.DeviceIDs))
+	for _, idStr := range req.DeviceIDs {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID: " + idStr})
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+
+	var filterID *int64
+	err = h.db.QueryRow(c.UserContext(),
+		"SELECT filter_id FROM device_groups WHERE group_id = $1", groupID).Scan(&filterID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Group not found"})
+	}
+	if filterID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Smart group membership is managed by its filter"})
+	}
+
+	// Only known devices are added; unknown IDs are silently skipped
+	result, err := h.db.Exec(c.UserContext(), `
+		INSERT INTO device_group_members (group_id, device_id, added_by)
+		SELECT $1, a.device_id, $3
+		FROM agents a
+		WHERE a.device_id = ANY($2)
+		ON CONFLICT (group_id, device_id) DO NOTHING`,
+		groupID, deviceIDs, adminUser(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add group devices"})
+	}
+
+	if result.RowsAffected() > 0 {
+		h.cache.Invalidate(c.UserContext(), deviceIDs...)
+	}
+
+	return c.JSON(fiber.Map{
+		"group_id": groupID,
+		"added":    result.RowsAffected(),
+	})
+}
+
+func (h *GroupHandler) RemoveGroupDevice(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	deviceID, err := uuid.Parse(c.Params("deviceId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var filterID *int64
+	err = h.db.QueryRow(c.UserContext(),
+		"SELECT filter_id FROM device_groups WHERE group_id = $1", groupID).Scan(&filterID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Group not found"})
+	}
+	if filterID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Smart group membership is managed by its filter"})
+	}
+
+	result, err := h.db.Exec(c.UserContext(),
+		"DELETE FROM device_group_members WHERE group_id = $1 AND device_id = $2",
+		groupID, deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove group device"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Device is not a member of this group"})
+	}
+
+	h.cache.Invalidate(c.UserContext(), deviceID)
+
+	return c.JSON(fiber.Map{"message": "Device removed from group"})
+}
+
+// EvaluateGroup re-evaluates a smart group's membership immediately
+func (h *GroupHandler) EvaluateGroup(c *fiber.Ctx) error {
+	groupID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+	}
+
+	ctx := c.UserContext()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to evaluate smart group"})
+	}
+	defer tx.Rollback(ctx)
+
+	var filterID *int64
+	var filter models.DeviceFilter
+	err = tx.QueryRow(ctx, `
+		SELECT g.filter_id, COALESCE(f.filter, '{}'::jsonb)
+		FROM device_groups g
+		LEFT JOIN saved_filters f ON f.filter_id = g.filter_id
+		WHERE g.group_id = $1
+		FOR UPDATE OF g`, groupID).Scan(&filterID, &filter)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Group not found"})
+	}
+	if filterID == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Group is not a smart group"})
+	}
+
+	added, removed, err := database.RefreshSmartGroup(ctx, tx, groupID, &filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to evaluate smart group"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to evaluate smart group"})
+	}
+
+	if added > 0 || removed > 0 {
+		h.cache.InvalidateAll(ctx)
+	}
+
+	return c.JSON(fiber.Map{
+		"group_id": groupID,
+		"added":    added,
+		"removed":  removed,
+	})
+}
+
+// loadDeviceGroups returns the groups a device is a static member of
+func loadDeviceGroups(ctx context.Context, db *pgxpool.Pool, deviceID uuid.UUID) ([]models.GroupRef, error) {
+	rows, err := db.Query(ctx, `
+		SELECT g.group_id, g.name
+		FROM device_group_members m
+		JOIN device_groups g ON g.group_id = m.group_id
+		WHERE m.device_id = $1
+		ORDER BY g.name`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.GroupRef
+	for rows.Next() {
+		var group models.GroupRef
+		if err := rows.Scan(&group.GroupID, &group.Name); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+func groupIDs(groups []models.GroupRef) []int64 {
+	ids := make([]int64, len(groups))
+	for i, group := range groups {
+		ids[i] = group.GroupID
+	}
+	return ids
+}
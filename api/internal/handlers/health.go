@@ -1,37 +1,68 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/nats-io/nats.go"
 	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/version"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type HealthHandler struct {
-	db *pgxpool.Pool
-	nc *nats.Conn
+	db      *pgxpool.Pool
+	nc      *nats.Conn
+	started time.Time
+	// migration is the newest migration this build ships, which /readyz
+	// waits for the database to carry
+	migration uint
+	sources   []MetricsSource
+}
+
+// MetricsSource is a component adding its own series to /metrics
+type MetricsSource interface {
+	WriteMetrics(w io.Writer)
 }
 
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Database  string    `json:"database"`
-	NATS      string    `json:"nats"`
-	Version   string    `json:"version"`
-	Uptime    string    `json:"uptime"`
-	Timestamp time.Time `json:"timestamp"`
+	Status         string    `json:"status"`
+	Database       string    `json:"database"`
+	NATS           string    `json:"nats"`
+	NATSReconnects uint64    `json:"nats_reconnects"`
+	Version        string    `json:"version"`
+	Commit         string    `json:"commit"`
+	BuildDate      string    `json:"build_date"`
+	Uptime         string    `json:"uptime"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// ReadyResponse reports each dependency /readyz checks, "ok" or the reason
+// it isn't ready
+type ReadyResponse struct {
+	Status     string `json:"status"`
+	Database   string `json:"database"`
+	NATS       string `json:"nats"`
+	Migrations string `json:"migrations"`
 }
 
-func NewHealthHandler(db *pgxpool.Pool, nc *nats.Conn) *HealthHandler {
-	return &HealthHandler{db: db, nc: nc}
+// NewHealthHandler creates the health handler of a process started at
+// started, whose newest migration is migration
+func NewHealthHandler(db *pgxpool.Pool, nc *nats.Conn, started time.Time, migration uint, sources ...MetricsSource) *HealthHandler {
+	return &HealthHandler{db: db, nc: nc, started: started, migration: migration, sources: sources}
 }
 
 func (h *HealthHandler) Health(c *fiber.Ctx) error {
 	resp := HealthResponse{
 		Status:    "healthy",
-		Version:   "1.0.0",
-		Uptime:    "unknown", // TODO: Track actual uptime
+		Version:   version.Version,
+		Commit:    version.Commit,
+		BuildDate: version.Date,
+		Uptime:    time.Since(h.started).Round(time.Second).String(),
 		Timestamp: time.Now(),
 	}
 
@@ -44,18 +75,11 @@ func (h *HealthHandler) Health(c *fiber.Ctx) error {
 	}
 
 	// Check NATS
-	if h.nc == nil {
-		resp.NATS = "error: not connected"
+	if h.nc != nil {
+		resp.NATSReconnects = h.nc.Stats().Reconnects
+	}
+	if resp.NATS = h.natsStatus(); resp.NATS != "ok" {
 		resp.Status = "unhealthy"
-	} else {
-		// Simple connectivity check
-		_, err := h.nc.Request("health.check", []byte("ping"), time.Second)
-		if err != nil {
-			resp.NATS = "error: " + err.Error()
-			resp.Status = "unhealthy"
-		} else {
-			resp.NATS = "ok"
-		}
 	}
 
 	statusCode := 200
@@ -66,24 +90,85 @@ func (h *HealthHandler) Health(c *fiber.Ctx) error {
 	return c.Status(statusCode).JSON(resp)
 }
 
+// Live answers the liveness probe. It only shows the process is up and
+// serving, so a failing dependency doesn't get the API restarted.
+func (h *HealthHandler) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Ready answers the readiness probe: the database answers and carries every
+// migration of this build, and NATS is connected
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	resp := ReadyResponse{Status: "ready", Database: "ok"}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	version, dirty, err := database.MigrationVersion(ctx, h.db)
+	switch {
+	case err != nil:
+		resp.Database = "error: " + err.Error()
+		resp.Migrations = "unknown"
+	case dirty:
+		resp.Migrations = fmt.Sprintf("error: migration %d failed partway", version)
+	case version < h.migration:
+		resp.Migrations = fmt.Sprintf("error: at %d of %d", version, h.migration)
+	default:
+		resp.Migrations = "ok"
+	}
+	resp.NATS = h.natsStatus()
+
+	if resp.Database != "ok" || resp.Migrations != "ok" || resp.NATS != "ok" {
+		resp.Status = "not ready"
+		return c.Status(503).JSON(resp)
+	}
+	return c.JSON(resp)
+}
+
+// natsStatus reports the NATS connection. The client reconnects by itself,
+// so a dropped connection is reported as its current state, e.g.
+// "error: reconnecting".
+func (h *HealthHandler) natsStatus() string {
+	if h.nc == nil {
+		return "error: not connected"
+	}
+	if status := h.nc.Status(); status != nats.CONNECTED {
+		return "error: " + strings.ToLower(status.String())
+	}
+	return "ok"
+}
+
 func (h *HealthHandler) Metrics(c *fiber.Ctx) error {
 	// Basic Prometheus-style metrics
 	metrics := `# HELP inventory_api_info API information
 # TYPE inventory_api_info gauge
-inventory_api_info{version="1.0.0"} 1
+inventory_api_info{version="` + version.Version + `",commit="` + version.Commit + `",build_date="` + version.Date + `"} 1
 
 # HELP inventory_api_uptime_seconds API uptime in seconds
 # TYPE inventory_api_uptime_seconds gauge
-inventory_api_uptime_seconds 0
+inventory_api_uptime_seconds ` + fmt.Sprintf("%d", int64(time.Since(h.started).Seconds())) + `
 
 # HELP inventory_database_connections_active Active database connections
 # TYPE inventory_database_connections_active gauge
 inventory_database_connections_active 0
+`
 
+	connected, reconnects := 0, uint64(0)
+	if h.nc != nil {
+		if h.nc.IsConnected() {
+			connected = 1
+		}
+		reconnects = h.nc.Stats().Reconnects
+	}
+	metrics += fmt.Sprintf(`
 # HELP inventory_nats_connected NATS connection status
 # TYPE inventory_nats_connected gauge
-inventory_nats_connected{status="connected"} 1
-`
+inventory_nats_connected %d
+
+# HELP inventory_nats_reconnects_total NATS reconnects since startup
+# TYPE inventory_nats_reconnects_total counter
+inventory_nats_reconnects_total %d
+`, connected, reconnects)
 
 	// Add database connection info if available
 	if h.db != nil {
@@ -91,5 +176,11 @@ inventory_nats_connected{status="connected"} 1
 		// to properly instrument database stats, HTTP requests, etc.
 	}
 
-	return c.Type("text/plain").SendString(metrics)
+	var b strings.Builder
+	b.WriteString(metrics)
+	for _, source := range h.sources {
+		source.WriteMetrics(&b)
+	}
+
+	return c.Type("text/plain").SendString(b.String())
 }
\ No newline at end of file
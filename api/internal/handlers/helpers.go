@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/shared/validation"
+)
+
+// adminUser returns the admin identity set by AdminAuthMiddleware
+func adminUser(c *fiber.Ctx) string {
+	if user, ok := c.Locals("admin_user").(string); ok && user != "" {
+		return user
+	}
+	return auth.UnidentifiedAdmin
+}
+
+// adminIdentified reports whether the admin's token identified them, rather
+// than being recorded as auth.UnidentifiedAdmin
+func adminIdentified(c *fiber.Ctx) bool {
+	identified, _ := c.Locals("admin_identified").(bool)
+	return identified
+}
+
+// QueryTimeout bounds the database work of each request so a slow query
+// gives up instead of holding a pooled connection that ingest needs. A
+// request that fails because it ran out of time gets a 503.
+func QueryTimeout(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && (err != nil || c.Response().StatusCode() >= 500) {
+			return c.Status(503).JSON(fiber.Map{"error": "Request timed out"})
+		}
+		return err
+	}
+}
+
+// queryValues returns the request's query string, including repeated keys
+func queryValues(c *fiber.Ctx) url.Values {
+	values, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+	return values
+}
+
+// schemaErrors validates data against a named schema and returns the failed
+// result, or nil when the data is valid. Raw request bodies can be passed as
+// json.RawMessage so defaults applied during parsing don't mask errors.
+func schemaErrors(v *validation.Validator, name string, data interface{}) *validation.ValidationResult {
+	if raw, ok := data.(json.RawMessage); ok && !json.Valid(raw) {
+		return &validation.ValidationResult{
+			Errors: []validation.ValidationError{{Field: "root", Message: "body is not valid JSON", Code: "INVALID_JSON"}},
+		}
+	}
+
+	result, err := v.ValidateWithResult(name, data)
+	if err != nil {
+		return &validation.ValidationResult{
+			Errors: []validation.ValidationError{{Field: "root", Message: err.Error(), Code: "VALIDATION_ERROR"}},
+		}
+	}
+
+	if result.Valid {
+		return nil
+	}
+	return result
+}
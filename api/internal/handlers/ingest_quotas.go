@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/quota"
+)
+
+// IngestQuotaHandler lets admins see the ingest quotas in force for a
+// device or org, what it has used of them, and override the server's
+// defaults
+type IngestQuotaHandler struct {
+	db     *pgxpool.Pool
+	quotas *quota.Enforcer
+}
+
+func NewIngestQuotaHandler(db *pgxpool.Pool, quotas *quota.Enforcer) *IngestQuotaHandler {
+	return &IngestQuotaHandler{db: db, quotas: quotas}
+}
+
+// GetOrgQuota returns an org's ingest quotas and usage
+func (h *IngestQuotaHandler) GetOrgQuota(c *fiber.Ctx) error {
+	orgID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid org ID"})
+	}
+	return h.getQuota(c, models.QuotaScopeOrg, strconv.FormatInt(orgID, 10))
+}
+
+// UpdateOrgQuota replaces an org's quota override
+func (h *IngestQuotaHandler) UpdateOrgQuota(c *fiber.Ctx) error {
+	orgID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid org ID"})
+	}
+	return h.updateQuota(c, models.QuotaScopeOrg, strconv.FormatInt(orgID, 10))
+}
+
+// GetDeviceQuota returns a device's ingest quotas and usage
+func (h *IngestQuotaHandler) GetDeviceQuota(c *fiber.Ctx) error {
+	deviceID, status, problem := h.device(c)
+	if problem != nil {
+		return c.Status(status).JSON(problem)
+	}
+	return h.getQuota(c, models.QuotaScopeDevice, deviceID.String())
+}
+
+// UpdateDeviceQuota replaces a device's quota override
+func (h *IngestQuotaHandler) UpdateDeviceQuota(c *fiber.Ctx) error {
+	deviceID, status, problem := h.device(c)
+	if problem != nil {
+		return c.Status(status).JSON(problem)
+	}
+	return h.updateQuota(c, models.QuotaScopeDevice, deviceID.String())
+}
+
+// device checks the device in the path exists
+func (h *IngestQuotaHandler) device(c *fiber.Ctx) (uuid.UUID, int, fiber.Map) {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, 400, fiber.Map{"error": "Invalid device ID"}
+	}
+
+	var exists bool
+	err = h.db.QueryRow(c.UserContext(),
+		"SELECT EXISTS(SELECT 1 FROM agents WHERE device_id = $1)", deviceID).Scan(&exists)
+	if err != nil {
+		return uuid.Nil, 500, fiber.Map{"error": "Failed to load device"}
+	}
+	if !exists {
+		return uuid.Nil, 404, fiber.Map{"error": "Device not found"}
+	}
+	return deviceID, 0, nil
+}
+
+func (h *IngestQuotaHandler) getQuota(c *fiber.Ctx, scope, id string) error {
+	ctx := c.UserContext()
+
+	override, err := h.loadOverride(ctx, scope, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load ingest quota"})
+	}
+
+	// Read the override afresh rather than from this instance's cache
+	h.quotas.Invalidate(scope, id)
+	limits, err := h.quotas.Limits(ctx, scope, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load ingest quota"})
+	}
+
+	usage, err := h.quotas.Usage(ctx, scope, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load ingest usage"})
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"scope":    scope,
+		"scope_id": id,
+		"override": override,
+		"limits":   limits,
+		"usage":    usage,
+	}})
+}
+
+// updateQuota stores the override in the body. An override with neither
+// limit set is removed, returning the device or org to the defaults.
+func (h *IngestQuotaHandler) updateQuota(c *fiber.Ctx, scope, id string) error {
+	var q models.IngestQuota
+	if err := c.BodyParser(&q); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid quota data"})
+	}
+
+	if err := q.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid quota: " + err.Error()})
+	}
+
+	q.Scope = scope
+	q.ScopeID = id
+	q.UpdatedBy = adminUser(c)
+
+	ctx := c.UserContext()
+	var err error
+	if q.PayloadsPerHour == nil && q.BytesPerDay == nil {
+		_, err = h.db.Exec(ctx, "DELETE FROM ingest_quotas WHERE scope = $1 AND scope_id = $2", scope, id)
+	} else {
+		err = h.db.QueryRow(ctx, `
+			INSERT INTO ingest_quotas (scope, scope_id, payloads_per_hour, bytes_per_day, updated_by)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (scope, scope_id) DO UPDATE SET
+				payloads_per_hour = EXCLUDED.payloads_per_hour,
+				bytes_per_day = EXCLUDED.bytes_per_day,
+				updated_by = EXCLUDED.updated_by
+			RETURNING updated_at`,
+			scope, id, q.PayloadsPerHour, q.BytesPerDay, q.UpdatedBy).Scan(&q.UpdatedAt)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update ingest quota"})
+	}
+
+	err = audit.Record(ctx, h.db, q.UpdatedBy, "update_ingest_quota", scope, id, q)
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return h.getQuota(c, scope, id)
+}
+
+// loadOverride returns the stored override, or nil when there is none
+func (h *IngestQuotaHandler) loadOverride(ctx context.Context, scope, id string) (*models.IngestQuota, error) {
+	q := models.IngestQuota{Scope: scope, ScopeID: id}
+	err := h.db.QueryRow(ctx, `
+		SELECT payloads_per_hour, bytes_per_day, COALESCE(updated_by, ''), updated_at
+		FROM ingest_quotas WHERE scope = $1 AND scope_id = $2`, scope, id).Scan(
+		&q.PayloadsPerHour, &q.BytesPerDay, &q.UpdatedBy, &q.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
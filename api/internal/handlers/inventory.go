@@ -1,112 +1,588 @@
 package handlers
 
 import (
+	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"mime"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/metering"
 	"github.com/yourorg/inventory-agent/api/internal/models"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/quota"
+	"github.com/yourorg/inventory-agent/api/internal/requestid"
+	"github.com/yourorg/inventory-agent/api/internal/tracing"
+	telemetryv1 "github.com/yourorg/inventory-agent/shared/proto/telemetry/v1"
+	"github.com/yourorg/inventory-agent/shared/validation"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
 )
 
 type InventoryHandler struct {
-	db *pgxpool.Pool
-	js nats.JetStream
+	db        *pgxpool.Pool
+	js        nats.JetStream
+	publisher *events.Publisher
+	limits    IngestLimits
+	validator *validation.Validator
+	quotas    *quota.Enforcer
+	meter     *metering.Meter
+}
+
+// IngestLimits bound what one agent request may make the API hold in
+// memory. MaxDecompressedBytes caps the body after gzip decoding and
+// MaxMetricBytes each metric's encoded JSON; the body as sent is capped
+// before it is read, by the bodylimit middleware.
+// MaxClockSkew is how far ahead of the API's clock collected_at may be,
+// since agents correct for their skew but only once they have measured it.
+// Zero leaves a limit off.
+type IngestLimits struct {
+	MaxDecompressedBytes int64
+	MaxMetricBytes       int
+	MaxClockSkew         time.Duration
+}
+
+// errPayloadTooLarge is returned when a body decompresses past
+// MaxDecompressedBytes
+var errPayloadTooLarge = errors.New("payload too large")
+
+// errMetricTooLarge marks payloads rejected for a metric over MaxMetricBytes
+var errMetricTooLarge = errors.New("Metric too large")
+
+// invalidPayloadError rejects a payload that doesn't match the telemetry
+// schema, with the fields at fault
+type invalidPayloadError struct {
+	result *validation.ValidationResult
 }
 
-type TelemetryPayload struct {
-	DeviceID     string                 `json:"device_id"`
-	AgentVersion string                 `json:"agent_version"`
-	CollectedAt  time.Time              `json:"collected_at"`
-	Metrics      map[string]interface{} `json:"metrics"`
+func (e *invalidPayloadError) Error() string {
+	msg := "Invalid telemetry payload"
+	if len(e.result.Errors) > 0 {
+		msg += ": " + e.result.Errors[0].Field + ": " + e.result.Errors[0].Message
+	}
+	return msg
 }
 
-func NewInventoryHandler(db *pgxpool.Pool, js nats.JetStream) *InventoryHandler {
-	return &InventoryHandler{db: db, js: js}
+// NewInventoryHandler creates the ingest handler. Payloads are checked
+// against the validator's telemetry schema, whatever encoding they came in.
+func NewInventoryHandler(db *pgxpool.Pool, js nats.JetStream, publisher *events.Publisher, limits IngestLimits, validator *validation.Validator, quotas *quota.Enforcer, meter *metering.Meter) *InventoryHandler {
+	return &InventoryHandler{db: db, js: js, publisher: publisher, limits: limits, validator: validator, quotas: quotas, meter: meter}
 }
 
 func (h *InventoryHandler) Ingest(c *fiber.Ctx) error {
-	deviceIDStr := c.Params("id")
-	deviceID, err := uuid.Parse(deviceIDStr)
+	agent, status, problem := h.reportingDevice(c)
+	if problem != nil {
+		return c.Status(status).JSON(problem)
+	}
+
+	if exceeded := h.chargeQuota(c.UserContext(), agent, 1, int64(len(c.BodyRaw()))); exceeded != nil {
+		return quotaExceeded(c, exceeded)
+	}
+
+	reader, err := h.telemetryBody(c)
+	if errors.Is(err, errPayloadTooLarge) {
+		return payloadTooLarge(c)
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid gzip content"})
+	}
+
+	var payload TelemetryPayload
+	if err := decodePayload(payloadEncoding(c), reader, &payload); err != nil {
+		if errors.Is(err, errPayloadTooLarge) {
+			return payloadTooLarge(c)
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid telemetry payload"})
+	}
+
+	telemetry, err := h.telemetryFromPayload(c.Params("id"), agent.DeviceID, &payload)
+	if errors.Is(err, errMetricTooLarge) {
+		return c.Status(413).JSON(fiber.Map{"error": err.Error()})
+	}
+	var invalid *invalidPayloadError
+	if errors.As(err, &invalid) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid telemetry payload", "validation": invalid.result})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Publish to JetStream for async processing
+	if err := h.publishTelemetry(c.UserContext(), telemetry); err != nil {
+		return queueUnavailable(c)
+	}
+
+	h.meter.RecordIngest(agent.OrgID, agent.DeviceID, 1, int64(len(c.BodyRaw())))
+	h.markSeen(c.UserContext(), agent, payload.ClockSkewMs)
+
+	return c.Status(202).JSON(fiber.Map{
+		"ingestion_id": telemetry.IngestionID.String(),
+		"status":       "accepted",
+	})
+}
+
+// queueRetryAfter is the Retry-After, in seconds, sent when telemetry can't
+// be queued, long enough for the NATS client to reconnect
+const queueRetryAfter = "30"
+
+// queueUnavailable responds 503 when NATS is down, telling the agent when to
+// send the telemetry again
+func queueUnavailable(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderRetryAfter, queueRetryAfter)
+	return c.Status(503).JSON(fiber.Map{"error": "Message queue unavailable"})
+}
+
+// maxIngestBatch caps how many payloads one IngestBatch call may carry
+const maxIngestBatch = 500
+
+// BatchIngestResult reports what happened to one payload of a batch. Retry
+// is set when the payload was valid but couldn't be queued, so the agent
+// should send it again later. Validation lists the fields at fault in a
+// payload that doesn't match the telemetry schema.
+type BatchIngestResult struct {
+	Index       int                          `json:"index"`
+	Status      string                       `json:"status"`
+	IngestionID string                       `json:"ingestion_id,omitempty"`
+	Error       string                       `json:"error,omitempty"`
+	Validation  *validation.ValidationResult `json:"validation,omitempty"`
+	Retry       bool                         `json:"retry,omitempty"`
+}
+
+// IngestBatch accepts an array of telemetry payloads, such as a backlog an
+// agent replays from its offline spool, and reports per payload whether it
+// was accepted. Invalid payloads are rejected individually. If the message
+// queue fails partway, the remaining payloads are rejected with retry set.
+func (h *InventoryHandler) IngestBatch(c *fiber.Ctx) error {
+	agent, status, problem := h.reportingDevice(c)
+	if problem != nil {
+		return c.Status(status).JSON(problem)
+	}
+
+	reader, err := h.telemetryBody(c)
+	if errors.Is(err, errPayloadTooLarge) {
+		return payloadTooLarge(c)
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid gzip content"})
+	}
+
+	payloads, payloadErrs, err := decodeBatch(payloadEncoding(c), reader)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+		if errors.Is(err, errPayloadTooLarge) {
+			return payloadTooLarge(c)
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid telemetry batch: expected an array of payloads"})
+	}
+	if len(payloads) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Telemetry batch is empty"})
+	}
+	if len(payloads) > maxIngestBatch {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("At most %d payloads per batch", maxIngestBatch)})
+	}
+
+	// The whole batch is charged, or refused, at once
+	if exceeded := h.chargeQuota(c.UserContext(), agent, len(payloads), int64(len(c.BodyRaw()))); exceeded != nil {
+		return quotaExceeded(c, exceeded)
+	}
+
+	results := make([]BatchIngestResult, len(payloads))
+	accepted, rejected := 0, 0
+	var queueErr error
+	// The device's skew as of the last payload accepted
+	var clockSkewMs int64
+	for i := range payloads {
+		results[i] = BatchIngestResult{Index: i, Status: "rejected"}
+		rejected++
+
+		if queueErr != nil {
+			results[i].Error = "Message queue unavailable"
+			results[i].Retry = true
+			continue
+		}
+
+		if payloadErrs[i] != nil {
+			results[i].Error = "Invalid telemetry payload"
+			continue
+		}
+
+		telemetry, err := h.telemetryFromPayload(c.Params("id"), agent.DeviceID, &payloads[i])
+		var invalid *invalidPayloadError
+		if errors.As(err, &invalid) {
+			results[i].Error = "Invalid telemetry payload"
+			results[i].Validation = invalid.result
+			continue
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if queueErr = h.publishTelemetry(c.UserContext(), telemetry); queueErr != nil {
+			results[i].Error = "Message queue unavailable"
+			results[i].Retry = true
+			continue
+		}
+
+		results[i] = BatchIngestResult{Index: i, Status: "accepted", IngestionID: telemetry.IngestionID.String()}
+		accepted++
+		rejected--
+		clockSkewMs = payloads[i].ClockSkewMs
+	}
+
+	if accepted == 0 && queueErr != nil {
+		return queueUnavailable(c)
+	}
+	if accepted > 0 {
+		h.meter.RecordIngest(agent.OrgID, agent.DeviceID, accepted, int64(len(c.BodyRaw())))
+		h.markSeen(c.UserContext(), agent, clockSkewMs)
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"accepted": accepted,
+		"rejected": rejected,
+		"results":  results,
+	})
+}
+
+// reportingDevice loads the device in the path and checks it may report
+// telemetry, returning the response status and body when it may not
+func (h *InventoryHandler) reportingDevice(c *fiber.Ctx) (*models.Agent, int, fiber.Map) {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, 400, fiber.Map{"error": "Invalid device ID"}
 	}
 
 	// Authenticate - this is done by middleware, but verify device exists
+	return h.loadReportingDevice(c.UserContext(), deviceID)
+}
+
+// loadReportingDevice loads a device that is about to report telemetry,
+// with the state chargeQuota and markSeen need
+func (h *InventoryHandler) loadReportingDevice(ctx context.Context, deviceID uuid.UUID) (*models.Agent, int, fiber.Map) {
 	var agent models.Agent
-	err = h.db.QueryRow(c.Context(),
-		"SELECT device_id, status FROM agents WHERE device_id = $1",
-		deviceID).Scan(&agent.DeviceID, &agent.Status)
+	err := h.db.QueryRow(ctx,
+		"SELECT device_id, org_id, status, lifecycle_state FROM agents WHERE device_id = $1",
+		deviceID).Scan(&agent.DeviceID, &agent.OrgID, &agent.Status, &agent.LifecycleState)
 	if err != nil {
-		return c.Status(401).JSON(fiber.Map{"error": "Device not found"})
+		return nil, 401, fiber.Map{"error": "Device not found"}
+	}
+
+	if !agent.CanReport() {
+		return nil, 403, fiber.Map{"error": "Device is not active"}
 	}
 
-	if agent.Status != "active" {
-		return c.Status(403).JSON(fiber.Map{"error": "Device is not active"})
+	return &agent, 0, nil
+}
+
+// chargeQuota counts payloads, sent in a body of size bytes, against the
+// ingest quotas of the device and its org, returning the quota exceeded if
+// the request must be refused. A quota that can't be checked lets the
+// request through rather than failing ingest.
+func (h *InventoryHandler) chargeQuota(ctx context.Context, agent *models.Agent, payloads int, size int64) *quota.ExceededError {
+	err := h.quotas.Charge(ctx, agent.DeviceID, agent.OrgID, payloads, size)
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return exceeded
 	}
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to charge ingest quota", "device_id", agent.DeviceID, "error", err)
+	}
+	return nil
+}
+
+// quotaExceeded responds 429 to a request over an ingest quota, telling the
+// agent when the quota's window resets
+func quotaExceeded(c *fiber.Ctx, exceeded *quota.ExceededError) error {
+	retryAfter := strconv.Itoa(int(math.Ceil(exceeded.RetryAfter.Seconds())))
+	c.Set(fiber.HeaderRetryAfter, retryAfter)
+	return c.Status(429).JSON(fiber.Map{
+		"error":       "Ingest quota exceeded",
+		"scope":       exceeded.Scope,
+		"quota":       exceeded.Quota,
+		"limit":       exceeded.Limit,
+		"retry_after": retryAfter,
+	})
+}
 
-	// Parse request body (handle gzip)
-	var reader io.Reader = c.Request().BodyStream()
+// telemetryBody returns the request body, decompressed when the agent sent
+// it gzip encoded. A gzip bomb fails with errPayloadTooLarge as soon as
+// decoding passes MaxDecompressedBytes, so it is never inflated in full.
+func (h *InventoryHandler) telemetryBody(c *fiber.Ctx) (io.Reader, error) {
+	var reader io.Reader = bytes.NewReader(c.BodyRaw())
 	if c.Get("Content-Encoding") == "gzip" {
-		reader, err = gzip.NewReader(reader)
+		gz, err := gzip.NewReader(reader)
 		if err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid gzip content"})
+			return nil, err
 		}
+		reader = gz
+	}
+	if h.limits.MaxDecompressedBytes > 0 {
+		reader = &capReader{r: reader, remaining: h.limits.MaxDecompressedBytes}
 	}
+	return reader, nil
+}
 
-	var payload TelemetryPayload
-	decoder := json.NewDecoder(reader)
-	if err := decoder.Decode(&payload); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid telemetry payload"})
+// Content types agents may upload telemetry in besides JSON. The binary
+// encodings spare both sides the cost of encoding and parsing JSON.
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeMsgpack  = "application/msgpack"
+)
+
+// payloadEncoding returns the media type of the request body, folding the
+// x- alias of msgpack into its registered name. Bodies of any other type
+// are read as JSON, as they always were.
+func payloadEncoding(c *fiber.Ctx) string {
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if mediaType == "application/x-msgpack" {
+		return contentTypeMsgpack
+	}
+	return mediaType
+}
+
+// decodePayload reads one payload in the given encoding. Protobuf bodies
+// are a telemetryv1.TelemetryPayload, msgpack bodies a TelemetryPayload.
+func decodePayload(encoding string, r io.Reader, payload *TelemetryPayload) error {
+	switch encoding {
+	case contentTypeProtobuf:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var msg telemetryv1.TelemetryPayload
+		if err := proto.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		*payload = payloadFromProto(&msg)
+		return nil
+	case contentTypeMsgpack:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = payload.UnmarshalMsg(data)
+		return err
+	default:
+		return json.NewDecoder(r).Decode(payload)
+	}
+}
+
+// decodeBatch reads a batch in the given encoding. A JSON payload that
+// doesn't parse fails on its own, in its slot of errs, so the rest of the
+// batch is still ingested; a binary batch decodes or fails as a whole.
+func decodeBatch(encoding string, r io.Reader) (payloads []TelemetryPayload, errs []error, err error) {
+	switch encoding {
+	case contentTypeProtobuf:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		var msg telemetryv1.TelemetryBatch
+		if err := proto.Unmarshal(data, &msg); err != nil {
+			return nil, nil, err
+		}
+		for _, p := range msg.Payloads {
+			payloads = append(payloads, payloadFromProto(p))
+		}
+		return payloads, make([]error, len(payloads)), nil
+	case contentTypeMsgpack:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		var batch TelemetryBatch
+		if _, err := batch.UnmarshalMsg(data); err != nil {
+			return nil, nil, err
+		}
+		return batch, make([]error, len(batch)), nil
+	default:
+		var raw []json.RawMessage
+		if err := json.NewDecoder(r).Decode(&raw); err != nil {
+			return nil, nil, err
+		}
+		payloads = make([]TelemetryPayload, len(raw))
+		errs = make([]error, len(raw))
+		for i := range raw {
+			errs[i] = json.Unmarshal(raw[i], &payloads[i])
+		}
+		return payloads, errs, nil
+	}
+}
+
+// payloadFromProto converts a protobuf payload to the JSON one
+func payloadFromProto(msg *telemetryv1.TelemetryPayload) TelemetryPayload {
+	payload := TelemetryPayload{
+		DeviceID:      msg.DeviceId,
+		IngestionID:   msg.IngestionId,
+		AgentVersion:  msg.AgentVersion,
+		Metrics:       msg.Metrics.AsMap(),
+		Errors:        msg.Errors,
+		SchemaVersion: int(msg.SchemaVersion),
+		ClockSkewMs:   msg.ClockSkewMs,
+		Tags:          msg.Tags,
+	}
+	if msg.CollectedAt != nil {
+		payload.CollectedAt = msg.CollectedAt.AsTime()
+	}
+	return payload
+}
+
+// payloadTooLarge responds 413 to a body over the ingest limits
+func payloadTooLarge(c *fiber.Ctx) error {
+	return c.Status(413).JSON(fiber.Map{"error": "Telemetry payload too large"})
+}
+
+// capReader reads at most remaining bytes, failing with errPayloadTooLarge
+// rather than io.EOF when there is more
+type capReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *capReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		// Probe for one more byte to tell a body that ends exactly at the
+		// limit from one that goes past it
+		var probe [1]byte
+		n, err := r.r.Read(probe[:])
+		if n > 0 {
+			return 0, errPayloadTooLarge
+		}
+		return 0, err
 	}
 
-	// Validate payload
-	if payload.DeviceID != deviceIDStr {
-		return c.Status(400).JSON(fiber.Map{"error": "Device ID mismatch"})
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// telemetryFromPayload validates a payload the device in the path reported.
+// A payload that doesn't match the telemetry schema fails with an
+// *invalidPayloadError.
+func (h *InventoryHandler) telemetryFromPayload(pathID string, deviceID uuid.UUID, payload *TelemetryPayload) (*models.Telemetry, error) {
+	if payload.DeviceID != pathID {
+		return nil, errors.New("Device ID mismatch")
 	}
 
+	// A missing collected_at decodes as the zero time, which the schema
+	// would accept as a date
 	if payload.CollectedAt.IsZero() {
-		return c.Status(400).JSON(fiber.Map{"error": "collected_at is required"})
+		return nil, errors.New("collected_at is required")
+	}
+	if h.limits.MaxClockSkew > 0 && payload.CollectedAt.After(time.Now().Add(h.limits.MaxClockSkew)) {
+		return nil, errors.New("collected_at cannot be in the future")
+	}
+
+	if h.limits.MaxMetricBytes > 0 {
+		for name, value := range payload.Metrics {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid metric %s", name)
+			}
+			if len(data) > h.limits.MaxMetricBytes {
+				return nil, fmt.Errorf("%w: %s exceeds %d bytes", errMetricTooLarge, name, h.limits.MaxMetricBytes)
+			}
+		}
+	}
+
+	// Payloads are checked against the schema version they declare, so
+	// agents of every version keep reporting while newer ones add fields
+	version := payload.SchemaVersion
+	if version == 0 {
+		version = 1 // agents from before schema versions
+	}
+	if !h.validator.HasSchema(validation.VersionedName("telemetry", version)) {
+		return nil, fmt.Errorf("Unsupported schema_version %d; supported versions are %v", version, h.validator.Versions("telemetry"))
+	}
+	if result := schemaErrors(h.validator, validation.VersionedName("telemetry", version), payload); result != nil {
+		return nil, &invalidPayloadError{result: result}
+	}
+
+	ingestionID := uuid.New()
+	if payload.IngestionID != "" {
+		id, err := uuid.Parse(payload.IngestionID)
+		if err != nil {
+			return nil, errors.New("ingestion_id must be a UUID")
+		}
+		ingestionID = id
 	}
 
-	// Create telemetry record
 	telemetry := &models.Telemetry{
 		DeviceID:    deviceID,
 		CollectedAt: payload.CollectedAt,
 		Metrics:     payload.Metrics,
+		Tags:        payload.Tags,
+		Errors:      payload.Errors,
 		Seq:         0, // TODO: Implement sequence numbers
-		IngestionID: uuid.New(),
+		IngestionID: ingestionID,
+		// Stored rows get the database's time; this one travels with the
+		// queued message for the Kafka bridge
+		ServerReceivedAt: time.Now().UTC(),
 	}
 
-	if err := telemetry.Validate(); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid telemetry data: " + err.Error()})
-	}
+	return telemetry, nil
+}
 
-	// Publish to JetStream for async processing
+// publishTelemetry queues a report for the telemetry writer. The ingestion
+// ID doubles as the message ID, so JetStream drops a retried report that
+// arrives within the stream's duplicate window; the writer skips any that
+// arrive later. The request's trace and IDs travel in the message headers.
+func (h *InventoryHandler) publishTelemetry(ctx context.Context, telemetry *models.Telemetry) error {
 	data, err := json.Marshal(telemetry)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to serialize telemetry"})
+		return err
 	}
 
-	_, err = h.js.Publish("telemetry.ingest", data)
+	ctx, span := tracing.Tracer().Start(ctx, "telemetry.ingest publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(tracing.MessagingAttributes("telemetry.ingest")...))
+	defer span.End()
+
+	msg := &nats.Msg{Subject: "telemetry.ingest", Data: data}
+	tracing.InjectNATS(ctx, msg)
+	requestid.InjectNATS(ctx, msg)
+
+	_, err = h.js.PublishMsg(msg, nats.MsgId(telemetry.IngestionID.String()))
 	if err != nil {
-		return c.Status(503).JSON(fiber.Map{"error": "Message queue unavailable"})
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
+	return err
+}
 
-	// Update agent's last seen
-	_, err = h.db.Exec(c.Context(),
-		"UPDATE agents SET last_seen_at = $1 WHERE device_id = $2",
-		time.Now(), deviceID)
+// markSeen records that the device reported, bringing it back online, with
+// the clock skew its report carried. An enrolled device becomes active with
+// its first report.
+func (h *InventoryHandler) markSeen(ctx context.Context, agent *models.Agent, clockSkewMs int64) {
+	_, err := h.db.Exec(ctx,
+		"UPDATE agents SET last_seen_at = $1, status = 'active', clock_skew_ms = $3 WHERE device_id = $2 AND status = ANY($4)",
+		time.Now(), agent.DeviceID, clockSkewMs, models.ReportingStatuses)
 	if err != nil {
-		// Log error but don't fail the request
+		logging.FromContext(ctx).Error("Failed to mark device seen", "device_id", agent.DeviceID, "error", err)
+	} else if agent.Status == "offline" || agent.Status == "inactive" {
+		h.publisher.Publish(models.DeviceEvent(models.EventDeviceOnline, agent.DeviceID, nil))
 	}
 
-	return c.Status(202).JSON(fiber.Map{
-		"ingestion_id": telemetry.IngestionID.String(),
-		"status":       "accepted",
-	})
-}
\ No newline at end of file
+	if agent.LifecycleState == models.LifecycleEnrolled {
+		_, err := database.TransitionLifecycle(ctx, h.db, agent.DeviceID, models.LifecycleActive, "agent", "first telemetry")
+		if err != nil {
+			logging.FromContext(ctx).Error("Failed to activate device", "device_id", agent.DeviceID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type LicenseHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewLicenseHandler(db *pgxpool.Pool) *LicenseHandler {
+	return &LicenseHandler{db: db}
+}
+
+func (h *LicenseHandler) GetLicenses(c *fiber.Ctx) error {
+	licenses, err := h.loadLicenses(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query licenses"})
+	}
+
+	return c.JSON(fiber.Map{"data": licenses})
+}
+
+func (h *LicenseHandler) GetLicense(c *fiber.Ctx) error {
+	licenseID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license ID"})
+	}
+
+	license, err := h.loadLicense(c.UserContext(), licenseID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "License not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": license})
+}
+
+func (h *LicenseHandler) CreateLicense(c *fiber.Ctx) error {
+	var license models.License
+	if err := c.BodyParser(&license); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license data"})
+	}
+
+	if err := license.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license: " + err.Error()})
+	}
+
+	if license.OrgID == 0 {
+		license.OrgID = 1
+	}
+	license.CreatedBy = adminUser(c)
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO software_licenses (org_id, product, name_pattern, publisher, seats, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING license_id, created_at, updated_at`,
+		license.OrgID, license.Product, license.NamePattern, license.Publisher,
+		license.Seats, license.Notes, license.CreatedBy).Scan(
+		&license.LicenseID, &license.CreatedAt, &license.UpdatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create license"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": license})
+}
+
+func (h *LicenseHandler) UpdateLicense(c *fiber.Ctx) error {
+	licenseID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license ID"})
+	}
+
+	var license models.License
+	if err := c.BodyParser(&license); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license data"})
+	}
+
+	if err := license.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license: " + err.Error()})
+	}
+
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE software_licenses
+		SET product = $2, name_pattern = $3, publisher = $4, seats = $5, notes = $6
+		WHERE license_id = $1
+		RETURNING license_id, org_id, COALESCE(created_by, ''), created_at, updated_at`,
+		licenseID, license.Product, license.NamePattern, license.Publisher,
+		license.Seats, license.Notes).Scan(
+		&license.LicenseID, &license.OrgID, &license.CreatedBy, &license.CreatedAt, &license.UpdatedAt)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "License not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": license})
+}
+
+func (h *LicenseHandler) DeleteLicense(c *fiber.Ctx) error {
+	licenseID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license ID"})
+	}
+
+	result, err := h.db.Exec(c.UserContext(), "DELETE FROM software_licenses WHERE license_id = $1", licenseID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete license"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "License not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "License deleted"})
+}
+
+// GetCompliance compares every entitlement against installed inventory.
+// ?status=over_deployed narrows the report to licenses out of compliance.
+func (h *LicenseHandler) GetCompliance(c *fiber.Ctx) error {
+	status := c.Query("status")
+	if status != "" && status != "compliant" && status != "over_deployed" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid status"})
+	}
+
+	licenses, err := h.loadLicenses(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query licenses"})
+	}
+
+	report := []models.LicenseCompliance{}
+	for i := range licenses {
+		installed, titles, err := h.licenseUsage(c.UserContext(), &licenses[i])
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to count installs"})
+		}
+
+		compliance := licenses[i].Compliance(installed, titles)
+		if status == "" || compliance.Status == status {
+			report = append(report, compliance)
+		}
+	}
+
+	return c.JSON(fiber.Map{"data": report})
+}
+
+// GetLicenseDevices lists the devices consuming a seat of a license
+func (h *LicenseHandler) GetLicenseDevices(c *fiber.Ctx) error {
+	licenseID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid license ID"})
+	}
+
+	license, err := h.loadLicense(c.UserContext(), licenseID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "License not found"})
+	}
+
+	where, args := licenseMatchSQL(license)
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT a.device_id, a.hostname, array_agg(DISTINCT t.name || ' ' || s.version)
+		FROM device_software s
+		JOIN software_titles t ON t.title_id = s.title_id
+		JOIN agents a ON a.device_id = s.device_id`+where+`
+		GROUP BY a.device_id, a.hostname
+		ORDER BY a.hostname`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query license devices"})
+	}
+	defer rows.Close()
+
+	type licensedDevice struct {
+		models.SoftwareDevice
+		Installs []string `json:"installs"`
+	}
+
+	devices := []licensedDevice{}
+	for rows.Next() {
+		var d licensedDevice
+		if err := rows.Scan(&d.DeviceID, &d.Hostname, &d.Installs); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan device"})
+		}
+		devices = append(devices, d)
+	}
+
+	return c.JSON(fiber.Map{"data": devices})
+}
+
+// licenseUsage counts the devices with a matching install and how many
+// distinct titles the license pattern matched
+func (h *LicenseHandler) licenseUsage(ctx context.Context, license *models.License) (int64, int64, error) {
+	where, args := licenseMatchSQL(license)
+
+	var installed, titles int64
+	err := h.db.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT s.device_id), COUNT(DISTINCT s.title_id)
+		FROM device_software s
+		JOIN software_titles t ON t.title_id = s.title_id
+		JOIN agents a ON a.device_id = s.device_id`+where, args...).Scan(&installed, &titles)
+	return installed, titles, err
+}
+
+// licenseMatchSQL selects current installs on active fleet devices that a
+// license covers
+func licenseMatchSQL(license *models.License) (string, []interface{}) {
+	args := []interface{}{database.GlobToLike(license.NamePattern)}
+	where := ` WHERE s.removed_at IS NULL AND a.status <> 'retired' AND t.name ILIKE $1`
+
+	if license.Publisher != "" {
+		args = append(args, "%"+database.EscapeLike(license.Publisher)+"%")
+		where += ` AND t.publisher ILIKE $2`
+	}
+
+	return where, args
+}
+
+func (h *LicenseHandler) loadLicenses(ctx context.Context) ([]models.License, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT license_id, org_id, product, name_pattern, publisher, seats, COALESCE(notes, ''),
+		       COALESCE(created_by, ''), created_at, updated_at
+		FROM software_licenses
+		ORDER BY product`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	licenses := []models.License{}
+	for rows.Next() {
+		var l models.License
+		err := rows.Scan(&l.LicenseID, &l.OrgID, &l.Product, &l.NamePattern, &l.Publisher, &l.Seats,
+			&l.Notes, &l.CreatedBy, &l.CreatedAt, &l.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		licenses = append(licenses, l)
+	}
+
+	return licenses, rows.Err()
+}
+
+func (h *LicenseHandler) loadLicense(ctx context.Context, licenseID int64) (*models.License, error) {
+	var l models.License
+	err := h.db.QueryRow(ctx, `
+		SELECT license_id, org_id, product, name_pattern, publisher, seats, COALESCE(notes, ''),
+		       COALESCE(created_by, ''), created_at, updated_at
+		FROM software_licenses WHERE license_id = $1`, licenseID).Scan(
+		&l.LicenseID, &l.OrgID, &l.Product, &l.NamePattern, &l.Publisher, &l.Seats,
+		&l.Notes, &l.CreatedBy, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
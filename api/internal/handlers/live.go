@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+const (
+	// liveRefresh is how often a filtered subscription re-resolves which
+	// devices match, picking up group and tag changes
+	liveRefresh = time.Minute
+
+	livePing      = 30 * time.Second
+	liveWriteWait = 10 * time.Second
+)
+
+type LiveHandler struct {
+	db *pgxpool.Pool
+	nc *nats.Conn
+}
+
+// liveFilter narrows a live subscription to a group and/or tags
+type liveFilter struct {
+	GroupID *int64   `json:"group_id"`
+	Tag     []string `json:"tag"`
+}
+
+func (f liveFilter) values() url.Values {
+	q := url.Values{"tag": f.Tag}
+	if f.GroupID != nil {
+		q.Set("group_id", strconv.FormatInt(*f.GroupID, 10))
+	}
+	return q
+}
+
+func (f liveFilter) empty() bool {
+	return f.GroupID == nil && len(f.Tag) == 0
+}
+
+func NewLiveHandler(db *pgxpool.Pool, nc *nats.Conn) *LiveHandler {
+	return &LiveHandler{db: db, nc: nc}
+}
+
+// Upgrade accepts only WebSocket handshakes and parses the initial filter
+// from ?group_id= and ?tag= (repeatable, key or key=value)
+func (h *LiveHandler) Upgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(426).JSON(fiber.Map{"error": "WebSocket upgrade required"})
+	}
+
+	var filter liveFilter
+	if s := c.Query("group_id"); s != "" {
+		groupID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+		}
+		filter.GroupID = &groupID
+	}
+	filter.Tag = queryValues(c)["tag"]
+
+	c.Locals("live_filter", filter)
+	return c.Next()
+}
+
+// DeviceStatus pushes device presence and latest key metrics. The client
+// first receives a snapshot of every matching device, then presence and
+// metrics updates as they happen. Sending {"group_id": 3, "tag": ["env=prod"]}
+// replaces the filter and triggers a new snapshot.
+func (h *LiveHandler) DeviceStatus() fiber.Handler {
+	return websocket.New(h.serve)
+}
+
+func (h *LiveHandler) serve(conn *websocket.Conn) {
+	filter, _ := conn.Locals("live_filter").(liveFilter)
+
+	msgs := make(chan *nats.Msg, 256)
+	for _, subject := range []string{events.Subject("device.*"), events.MetricsSubjects} {
+		sub, err := h.nc.ChanSubscribe(subject, msgs)
+		if err != nil {
+			slog.Error("Failed to subscribe to live events", "subject", subject, "error", err)
+			return
+		}
+		defer sub.Unsubscribe()
+	}
+
+	// The reader goroutine owns reads; all writes happen below
+	filters := make(chan liveFilter)
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		defer close(done)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var next liveFilter
+			if err := json.Unmarshal(data, &next); err != nil {
+				continue
+			}
+			select {
+			case filters <- next:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	write := func(update models.LiveUpdate) bool {
+		conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+		return conn.WriteJSON(update) == nil
+	}
+
+	ctx := context.Background()
+	devices, snapshot, err := h.snapshot(ctx, filter)
+	if err != nil {
+		slog.Error("Failed to load live device snapshot", "error", err)
+		return
+	}
+	if !write(models.LiveUpdate{Type: models.LiveSnapshot, Time: time.Now().UTC(), Devices: snapshot}) {
+		return
+	}
+
+	refresh := time.NewTicker(liveRefresh)
+	defer refresh.Stop()
+	ping := time.NewTicker(livePing)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case next := <-filters:
+			filter = next
+			devices, snapshot, err = h.snapshot(ctx, filter)
+			if err != nil {
+				slog.Error("Failed to load live device snapshot", "error", err)
+				return
+			}
+			if !write(models.LiveUpdate{Type: models.LiveSnapshot, Time: time.Now().UTC(), Devices: snapshot}) {
+				return
+			}
+		case <-refresh.C:
+			if filter.empty() {
+				continue
+			}
+			if matched, err := h.matchingDevices(ctx, filter); err == nil {
+				devices = matched
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				return
+			}
+		case msg := <-msgs:
+			update, ok := liveUpdate(msg)
+			if !ok || (devices != nil && !devices[update.Device.DeviceID]) {
+				continue
+			}
+			if !write(update) {
+				return
+			}
+		}
+	}
+}
+
+// liveUpdate converts a presence event or a metrics message to the update
+// sent to clients
+func liveUpdate(msg *nats.Msg) (models.LiveUpdate, bool) {
+	if strings.HasPrefix(msg.Subject, events.SubjectPrefix) {
+		var status string
+		switch events.TypeOf(msg.Subject) {
+		case models.EventDeviceOnline:
+			status = "active"
+		case models.EventDeviceOffline:
+			status = "offline"
+		case models.EventDeviceInactive:
+			status = "inactive"
+		default:
+			return models.LiveUpdate{}, false
+		}
+
+		var evt models.Event
+		if err := json.Unmarshal(msg.Data, &evt); err != nil || evt.DeviceID == nil {
+			return models.LiveUpdate{}, false
+		}
+		return models.LiveUpdate{
+			Type:   models.LivePresence,
+			Time:   evt.Time,
+			Device: &models.DeviceLiveStatus{DeviceID: *evt.DeviceID, Status: status},
+		}, true
+	}
+
+	var status models.DeviceLiveStatus
+	if err := json.Unmarshal(msg.Data, &status); err != nil || status.DeviceID == uuid.Nil {
+		return models.LiveUpdate{}, false
+	}
+	return models.LiveUpdate{Type: models.LiveMetrics, Time: time.Now().UTC(), Device: &status}, true
+}
+
+// matchingDevices resolves a filter to the set of device IDs it covers; an
+// empty filter returns nil, meaning every device
+func (h *LiveHandler) matchingDevices(ctx context.Context, filter liveFilter) (map[uuid.UUID]bool, error) {
+	if filter.empty() {
+		return nil, nil
+	}
+
+	where, args, err := database.DeviceListWhere(filter.values())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.db.Query(ctx, `SELECT a.device_id FROM agents a`+where+` AND a.status <> 'retired'`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make(map[uuid.UUID]bool)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		devices[id] = true
+	}
+	return devices, rows.Err()
+}
+
+// snapshot returns the current status of every device matching the filter,
+// along with the matched set used to filter later updates
+func (h *LiveHandler) snapshot(ctx context.Context, filter liveFilter) (map[uuid.UUID]bool, []models.DeviceLiveStatus, error) {
+	where, args, err := database.DeviceListWhere(filter.values())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := h.db.Query(ctx, `
+		SELECT a.device_id, a.hostname, a.status, l.collected_at, l.metrics
+		FROM agents a
+		LEFT JOIN telemetry_latest l ON l.device_id = a.device_id`+where+`
+		  AND a.status <> 'retired'
+		ORDER BY a.hostname`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var devices map[uuid.UUID]bool
+	if !filter.empty() {
+		devices = make(map[uuid.UUID]bool)
+	}
+
+	statuses := []models.DeviceLiveStatus{}
+	for rows.Next() {
+		var status models.DeviceLiveStatus
+		var metrics map[string]interface{}
+		if err := rows.Scan(&status.DeviceID, &status.Hostname, &status.Status, &status.CollectedAt, &metrics); err != nil {
+			return nil, nil, err
+		}
+		status.Metrics = models.KeyMetrics(metrics)
+		statuses = append(statuses, status)
+		if devices != nil {
+			devices[status.DeviceID] = true
+		}
+	}
+	return devices, statuses, rows.Err()
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type OrgSettingsHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewOrgSettingsHandler(db *pgxpool.Pool) *OrgSettingsHandler {
+	return &OrgSettingsHandler{db: db}
+}
+
+// GetSettings returns an org's settings. An org that has never been
+// configured gets the defaults, with nil fields meaning the server default
+// applies.
+func (h *OrgSettingsHandler) GetSettings(c *fiber.Ctx) error {
+	orgID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid org ID"})
+	}
+
+	s := models.OrgSettings{OrgID: orgID, PurgeStaleDevices: true}
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT stale_device_days, purge_stale_devices,
+		       telemetry_retention_days, rollup_retention_days, software_history_retention_days,
+		       COALESCE(updated_by, ''), updated_at
+		FROM org_settings WHERE org_id = $1`, orgID).Scan(
+		&s.StaleDeviceDays, &s.PurgeStaleDevices,
+		&s.TelemetryRetentionDays, &s.RollupRetentionDays, &s.SoftwareHistoryRetentionDays,
+		&s.UpdatedBy, &s.UpdatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load org settings"})
+	}
+
+	return c.JSON(fiber.Map{"data": s})
+}
+
+// UpdateSettings replaces an org's settings
+func (h *OrgSettingsHandler) UpdateSettings(c *fiber.Ctx) error {
+	orgID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid org ID"})
+	}
+
+	s := models.OrgSettings{PurgeStaleDevices: true}
+	if err := c.BodyParser(&s); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid settings data"})
+	}
+
+	if err := s.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid settings: " + err.Error()})
+	}
+
+	s.OrgID = orgID
+	s.UpdatedBy = adminUser(c)
+
+	err = h.db.QueryRow(c.UserContext(), `
+		INSERT INTO org_settings (org_id, stale_device_days, purge_stale_devices,
+		                          telemetry_retention_days, rollup_retention_days, software_history_retention_days,
+		                          updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (org_id) DO UPDATE SET
+			stale_device_days = EXCLUDED.stale_device_days,
+			purge_stale_devices = EXCLUDED.purge_stale_devices,
+			telemetry_retention_days = EXCLUDED.telemetry_retention_days,
+			rollup_retention_days = EXCLUDED.rollup_retention_days,
+			software_history_retention_days = EXCLUDED.software_history_retention_days,
+			updated_by = EXCLUDED.updated_by
+		RETURNING updated_at`,
+		s.OrgID, s.StaleDeviceDays, s.PurgeStaleDevices,
+		s.TelemetryRetentionDays, s.RollupRetentionDays, s.SoftwareHistoryRetentionDays,
+		s.UpdatedBy).Scan(&s.UpdatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update org settings"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, s.UpdatedBy, "update_settings", "org", strconv.FormatInt(orgID, 10), s)
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return c.JSON(fiber.Map{"data": s})
+}
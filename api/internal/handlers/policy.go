@@ -1,18 +1,27 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/policycache"
 )
 
 type PolicyHandler struct {
-	db *pgxpool.Pool
+	db    *pgxpool.Pool
+	cache *policycache.Cache
 }
 
-func NewPolicyHandler(db *pgxpool.Pool) *PolicyHandler {
-	return &PolicyHandler{db: db}
+func NewPolicyHandler(db *pgxpool.Pool, cache *policycache.Cache) *PolicyHandler {
+	return &PolicyHandler{db: db, cache: cache}
 }
 
 func (h *PolicyHandler) GetPolicy(c *fiber.Ctx) error {
@@ -22,26 +31,100 @@ func (h *PolicyHandler) GetPolicy(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
 	}
 
+	effectivePolicy, err := h.effectivePolicy(c.UserContext(), deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policies"})
+	}
+
+	// Check ETag for caching
+	etag := effectivePolicy.GenerateETag()
+	if ifNoneMatch := c.Get("If-None-Match"); ifNoneMatch != "" && ifNoneMatch == etag {
+		return c.Status(304).Send(nil)
+	}
+
+	// Set ETag header
+	c.Set("ETag", etag)
+
+	return c.JSON(effectivePolicy)
+}
+
+// effectivePolicy returns the policy served to a device, from the cache
+// when it holds one. It fails with pgx.ErrNoRows for an unknown device.
+func (h *PolicyHandler) effectivePolicy(ctx context.Context, deviceID uuid.UUID) (*models.Policy, error) {
+	return h.cache.Get(ctx, deviceID, func(ctx context.Context) (*models.Policy, time.Time, error) {
+		return h.resolvePolicy(ctx, deviceID)
+	})
+}
+
+// resolvePolicy resolves the policy served to a device, filtered by the
+// device's capabilities. It also returns when the next staged policy change
+// takes effect, which may change the result.
+func (h *PolicyHandler) resolvePolicy(ctx context.Context, deviceID uuid.UUID) (*models.Policy, time.Time, error) {
 	// Get agent info
 	var agent models.Agent
-	err = h.db.QueryRow(c.Context(),
+	err := h.db.QueryRow(ctx,
 		"SELECT device_id, org_id, capabilities FROM agents WHERE device_id = $1",
 		deviceID).Scan(&agent.DeviceID, &agent.OrgID, &agent.Capabilities)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+		return nil, time.Time{}, err
+	}
+
+	policies, memberOf, err := loadApplicablePolicies(ctx, h.db, deviceID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// Resolve effective policy
+	effectivePolicy := models.ResolveEffectivePolicy(policies, deviceID, memberOf)
+	if effectivePolicy == nil {
+		// Return default policy
+		effectivePolicy = models.DefaultPolicy()
 	}
 
-	// Query all applicable policies
-	rows, err := h.db.Query(c.Context(), `
-		SELECT policy_id, device_id, group_id, scope, version, config
+	// Filter by capabilities
+	effectivePolicy.FilterByCapabilities(agent.Capabilities)
+
+	// Any staged change is taken as a change for this device, which at
+	// worst resolves its policy again early
+	var nextChange *time.Time
+	err = h.db.QueryRow(ctx,
+		"SELECT MIN(effective_at) FROM policies WHERE effective_at > NOW()").Scan(&nextChange)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if nextChange == nil {
+		return effectivePolicy, time.Time{}, nil
+	}
+	return effectivePolicy, *nextChange, nil
+}
+
+// loadApplicablePolicies returns every global, group and device policy that
+// could apply to a device, along with the device's group memberships. A
+// policy with a change staged for later is returned as its currently
+// effective version; one that has never taken effect is left out.
+func loadApplicablePolicies(ctx context.Context, db *pgxpool.Pool, deviceID uuid.UUID) ([]models.Policy, []int64, error) {
+	groups, err := loadDeviceGroups(ctx, db, deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	memberOf := groupIDs(groups)
+
+	rows, err := db.Query(ctx, `
+		SELECT policy_id, device_id, group_id, scope,
+		       CASE WHEN effective_at > NOW() THEN version - 1 ELSE version END AS version,
+		       CASE WHEN effective_at > NOW() THEN previous_config ELSE config END
 		FROM policies
-		WHERE (scope = 'global')
-		   OR (scope = 'group' AND group_id = $1)
-		   OR (scope = 'device' AND device_id = $2)
+		WHERE ((scope = 'global')
+		   OR (scope = 'group' AND group_id = ANY($1))
+		   OR (scope = 'device' AND device_id = $2))
+		  AND (effective_at <= NOW() OR previous_config IS NOT NULL)
 		ORDER BY version DESC`,
-		agent.OrgID, deviceID)
+		memberOf, deviceID)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policies"})
+		return nil, nil, err
 	}
 	defer rows.Close()
 
@@ -51,35 +134,78 @@ func (h *PolicyHandler) GetPolicy(c *fiber.Ctx) error {
 		err := rows.Scan(&policy.PolicyID, &policy.DeviceID, &policy.GroupID,
 			&policy.Scope, &policy.Version, &policy.Config)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan policy"})
+			return nil, nil, err
 		}
 		policies = append(policies, policy)
 	}
 
-	// Resolve effective policy
-	effectivePolicy := models.ResolveEffectivePolicy(policies, deviceID, agent.OrgID)
-	if effectivePolicy == nil {
-		// Return default policy
-		effectivePolicy = &models.Policy{
-			Version: 1,
-			Config: models.PolicyConfig{
-				IntervalSeconds: 900, // 15 minutes
-				Metrics:        map[string]models.MetricConfig{},
-			},
-		}
+	return policies, memberOf, rows.Err()
+}
+
+// ReportStatus records an agent's report of applying its policy, replacing
+// its previous one, and whether it converged on the policy it's due
+func (h *PolicyHandler) ReportStatus(c *fiber.Ctx) error {
+	agent, err := auth.GetAgentFromContext(c)
+	if err != nil {
+		return err
 	}
 
-	// Filter by capabilities
-	effectivePolicy.FilterByCapabilities(agent.Capabilities)
+	var report models.PolicyStatusReport
+	if err := c.BodyParser(&report); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := models.ValidatePolicyStatus(&report); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy status: " + err.Error()})
+	}
+	if report.Settings == nil {
+		report.Settings = map[string]models.SettingStatus{}
+	}
+	if report.UnsupportedMetrics == nil {
+		report.UnsupportedMetrics = []string{}
+	}
 
-	// Check ETag for caching
-	etag := effectivePolicy.GenerateETag()
-	if ifNoneMatch := c.Get("If-None-Match"); ifNoneMatch != "" && ifNoneMatch == etag {
-		return c.Status(304).Send(nil)
+	ctx := c.UserContext()
+	effective, err := h.effectivePolicy(ctx, agent.DeviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policies"})
 	}
+	failed := report.FailedSettings()
 
-	// Set ETag header
-	c.Set("ETag", etag)
+	_, err = h.db.Exec(ctx, `
+		INSERT INTO device_policy_status (device_id, policy_version, expected_version, etag, converged,
+		                                  settings, failed_settings, unsupported_metrics, applied_at, reported_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, NOW())
+		ON CONFLICT (device_id) DO UPDATE SET
+		    policy_version = EXCLUDED.policy_version,
+		    expected_version = EXCLUDED.expected_version,
+		    etag = EXCLUDED.etag,
+		    converged = EXCLUDED.converged,
+		    settings = EXCLUDED.settings,
+		    failed_settings = EXCLUDED.failed_settings,
+		    unsupported_metrics = EXCLUDED.unsupported_metrics,
+		    applied_at = EXCLUDED.applied_at,
+		    reported_at = EXCLUDED.reported_at`,
+		agent.DeviceID, report.Version, effective.Version, report.ETag,
+		policyConverged(effective, report.Version, report.ETag, failed),
+		report.Settings, failed, report.UnsupportedMetrics, report.AppliedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to store policy status", "device_id", agent.DeviceID, "error", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to store policy status"})
+	}
 
-	return c.JSON(effectivePolicy)
-}
\ No newline at end of file
+	return c.SendStatus(204)
+}
+
+// policyConverged reports whether a device that applied a policy, at
+// version and served with etag, converged on the effective one: the same
+// policy as served, or the same version when the device sent no ETag, with
+// no failed settings
+func policyConverged(effective *models.Policy, version int, etag string, failed []string) bool {
+	if len(failed) > 0 {
+		return false
+	}
+	if etag != "" {
+		return etag == effective.GenerateETag()
+	}
+	return version == effective.Version
+}
@@ -1,28 +1,56 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/policycache"
+	"github.com/yourorg/inventory-agent/shared/validation"
 )
 
 type PolicyAdminHandler struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	validator *validation.Validator
+	publisher *events.Publisher
+	cache     *policycache.Cache
 }
 
-func NewPolicyAdminHandler(db *pgxpool.Pool) *PolicyAdminHandler {
-	return &PolicyAdminHandler{db: db}
+func NewPolicyAdminHandler(db *pgxpool.Pool, validator *validation.Validator, publisher *events.Publisher, cache *policycache.Cache) *PolicyAdminHandler {
+	return &PolicyAdminHandler{db: db, validator: validator, publisher: publisher, cache: cache}
 }
 
 func (h *PolicyAdminHandler) GetPolicies(c *fiber.Ctx) error {
-	rows, err := h.db.Query(c.Context(), `
-		SELECT policy_id, scope, version, config, created_by, created_at
+	scope := c.Query("scope", "global")
+
+	query := `
+		SELECT policy_id, device_id, group_id, scope, version, config, created_by, created_at, effective_at,
+		       CASE WHEN effective_at > NOW() THEN previous_config END
 		FROM policies
-		WHERE scope = 'global'
-		ORDER BY created_at DESC`)
+		WHERE scope = $1`
+	args := []interface{}{scope}
+
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		groupID, err := strconv.ParseInt(groupIDStr, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+		}
+		query += ` AND group_id = $2`
+		args = append(args, groupID)
+	}
+
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := h.db.Query(c.UserContext(), query, args...)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policies"})
 	}
@@ -31,8 +59,9 @@ func (h *PolicyAdminHandler) GetPolicies(c *fiber.Ctx) error {
 	var policies []models.Policy
 	for rows.Next() {
 		var policy models.Policy
-		err := rows.Scan(&policy.PolicyID, &policy.Scope, &policy.Version,
-			&policy.Config, &policy.CreatedBy, &policy.CreatedAt)
+		err := rows.Scan(&policy.PolicyID, &policy.DeviceID, &policy.GroupID, &policy.Scope,
+			&policy.Version, &policy.Config, &policy.CreatedBy, &policy.CreatedAt,
+			&policy.EffectiveAt, &policy.PreviousConfig)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan policy"})
 		}
@@ -42,36 +71,69 @@ func (h *PolicyAdminHandler) GetPolicies(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"data": policies})
 }
 
+// CreatePolicy adds a policy. One with a future effective_at is not served
+// to agents until then.
 func (h *PolicyAdminHandler) CreatePolicy(c *fiber.Ctx) error {
+	if result := schemaErrors(h.validator, "policy", json.RawMessage(c.Body())); result != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy", "validation": result})
+	}
+
 	var policy models.Policy
 	if err := c.BodyParser(&policy); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy data"})
 	}
 
-	// Set defaults for global policies
-	policy.Scope = "global"
+	// Policies are global unless a group or device scope is requested
+	if policy.Scope == "" {
+		policy.Scope = "global"
+	}
 	policy.Version = 1
 	policy.CreatedAt = time.Now()
 	policy.UpdatedAt = time.Now()
-	policy.CreatedBy = "admin" // TODO: Get from context
+	policy.CreatedBy = adminUser(c)
 
 	if err := policy.Validate(); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy: " + err.Error()})
 	}
 
-	_, err := h.db.Exec(c.Context(), `
-		INSERT INTO policies (device_id, group_id, scope, version, config, created_by, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+	if policy.Scope == "group" {
+		var exists bool
+		err := h.db.QueryRow(c.UserContext(),
+			"SELECT EXISTS (SELECT 1 FROM device_groups WHERE group_id = $1)", *policy.GroupID).Scan(&exists)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to query group"})
+		}
+		if !exists {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid policy: group does not exist"})
+		}
+	}
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO policies (device_id, group_id, scope, version, config, created_by, created_at, updated_at, effective_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, NOW()))
+		RETURNING policy_id, effective_at`,
 		policy.DeviceID, policy.GroupID, policy.Scope, policy.Version,
-		policy.Config, policy.CreatedBy, policy.CreatedAt, policy.UpdatedAt)
+		policy.Config, policy.CreatedBy, policy.CreatedAt, policy.UpdatedAt,
+		policy.EffectiveAt).Scan(&policy.PolicyID, &policy.EffectiveAt)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create policy"})
 	}
 
+	src := models.PolicySource{
+		PolicyID: policy.PolicyID, Scope: policy.Scope, Version: policy.Version,
+		GroupID: policy.GroupID, DeviceID: policy.DeviceID,
+	}
+	h.invalidate(c, src)
+	h.publisher.Publish(models.PolicyUpdatedEvent(src, "created"))
+
 	return c.Status(201).JSON(fiber.Map{"data": policy})
 }
 
+// UpdatePolicy replaces a policy's config as a new version. With a future
+// effective_at the change is staged: agents keep the currently effective
+// config until then, and updating a policy that is still staged replaces
+// the staged change rather than adding another version.
 func (h *PolicyAdminHandler) UpdatePolicy(c *fiber.Ctx) error {
 	policyIDStr := c.Params("id")
 	policyID, err := strconv.ParseInt(policyIDStr, 10, 64)
@@ -79,28 +141,48 @@ func (h *PolicyAdminHandler) UpdatePolicy(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy ID"})
 	}
 
+	if result := schemaErrors(h.validator, "policy", json.RawMessage(c.Body())); result != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy", "validation": result})
+	}
+
 	var updates models.Policy
 	if err := c.BodyParser(&updates); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy data"})
 	}
 
-	updates.UpdatedAt = time.Now()
-	updates.CreatedBy = "admin" // TODO: Get from context
-
-	if err := updates.Validate(); err != nil {
+	if err := updates.ValidateEffectiveAt(); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy: " + err.Error()})
 	}
 
-	_, err = h.db.Exec(c.Context(), `
+	updates.UpdatedAt = time.Now()
+	updates.CreatedBy = adminUser(c)
+
+	// The previous config is kept only while the new one is pending
+	src := models.PolicySource{PolicyID: policyID}
+	err = h.db.QueryRow(c.UserContext(), `
 		UPDATE policies
-		SET config = $2, version = version + 1, updated_at = $3
-		WHERE policy_id = $1`,
-		policyID, updates.Config, updates.UpdatedAt)
+		SET config = $2,
+		    version = CASE WHEN effective_at > NOW() THEN version ELSE version + 1 END,
+		    previous_config = CASE WHEN COALESCE($4, NOW()) > NOW() THEN
+		        CASE WHEN effective_at > NOW() THEN previous_config ELSE config END
+		    END,
+		    effective_at = COALESCE($4, NOW()),
+		    updated_at = $3
+		WHERE policy_id = $1
+		RETURNING scope, version, group_id, device_id, effective_at`,
+		policyID, updates.Config, updates.UpdatedAt, updates.EffectiveAt).Scan(
+		&src.Scope, &src.Version, &src.GroupID, &src.DeviceID, &updates.EffectiveAt)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Policy not found"})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to update policy"})
 	}
 
+	h.invalidate(c, src)
+	h.publisher.Publish(models.PolicyUpdatedEvent(src, "updated"))
+
 	return c.JSON(fiber.Map{"data": updates})
 }
 
@@ -111,10 +193,234 @@ func (h *PolicyAdminHandler) DeletePolicy(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid policy ID"})
 	}
 
-	_, err = h.db.Exec(c.Context(), "DELETE FROM policies WHERE policy_id = $1", policyID)
+	src := models.PolicySource{PolicyID: policyID}
+	err = h.db.QueryRow(c.UserContext(),
+		"DELETE FROM policies WHERE policy_id = $1 RETURNING scope, version, group_id, device_id",
+		policyID).Scan(&src.Scope, &src.Version, &src.GroupID, &src.DeviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Policy not found"})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete policy"})
 	}
 
+	h.invalidate(c, src)
+	h.publisher.Publish(models.PolicyUpdatedEvent(src, "deleted"))
+
 	return c.JSON(fiber.Map{"message": "Policy deleted"})
-}
\ No newline at end of file
+}
+
+// invalidate drops the cached effective policies a changed policy may
+// affect: its device's for a device policy, everyone's otherwise
+func (h *PolicyAdminHandler) invalidate(c *fiber.Ctx, src models.PolicySource) {
+	if src.Scope == "device" && src.DeviceID != nil {
+		h.cache.Invalidate(c.UserContext(), *src.DeviceID)
+		return
+	}
+	h.cache.InvalidateAll(c.UserContext())
+}
+
+// policyCandidate is a stored policy that matched the device during resolution
+type policyCandidate struct {
+	models.PolicySource
+	Applied bool `json:"applied"`
+}
+
+// GetEffectivePolicy previews the policy a device receives from the agent
+// policy endpoint and reports which policy each setting came from.
+func (h *PolicyAdminHandler) GetEffectivePolicy(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var agent models.Agent
+	err = h.db.QueryRow(c.UserContext(),
+		"SELECT device_id, capabilities FROM agents WHERE device_id = $1",
+		deviceID).Scan(&agent.DeviceID, &agent.Capabilities)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+
+	policies, memberOf, err := loadApplicablePolicies(c.UserContext(), h.db, deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policies"})
+	}
+
+	effective := models.ResolveEffectivePolicy(policies, deviceID, memberOf)
+	if effective == nil {
+		effective = models.DefaultPolicy()
+	}
+	source := effective.Source()
+
+	requested := make([]string, 0, len(effective.Config.Metrics))
+	for metric := range effective.Config.Metrics {
+		requested = append(requested, metric)
+	}
+
+	// Same capability filtering the agent endpoint applies
+	effective.FilterByCapabilities(agent.Capabilities)
+
+	sources := map[string]models.PolicySource{"interval_seconds": source}
+	if effective.Config.AllowedCommands != nil {
+		sources["allowed_commands"] = source
+	}
+	if len(effective.Config.RestartableServices) > 0 {
+		sources["restartable_services"] = source
+	}
+	unsupported := []string{}
+	for _, metric := range requested {
+		if _, ok := effective.Config.Metrics[metric]; ok {
+			sources["metrics."+metric] = source
+		} else {
+			unsupported = append(unsupported, metric)
+		}
+	}
+	sort.Strings(unsupported)
+
+	candidates := make([]policyCandidate, 0, len(policies))
+	for i := range policies {
+		candidates = append(candidates, policyCandidate{
+			PolicySource: policies[i].Source(),
+			Applied:      policies[i].PolicyID == effective.PolicyID && effective.PolicyID != 0,
+		})
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"policy":              effective,
+		"etag":                effective.GenerateETag(),
+		"sources":             sources,
+		"candidates":          candidates,
+		"unsupported_metrics": unsupported,
+		"group_ids":           memberOf,
+	}})
+}
+
+const policyStatusColumns = `s.device_id, a.hostname, s.policy_version, s.expected_version, s.converged,
+	s.settings, s.failed_settings, s.unsupported_metrics, s.applied_at, s.reported_at`
+
+func scanPolicyStatus(row pgx.Row, s *models.DevicePolicyStatus) error {
+	return row.Scan(&s.DeviceID, &s.Hostname, &s.PolicyVersion, &s.ExpectedVersion, &s.Converged,
+		&s.Settings, &s.FailedSettings, &s.UnsupportedMetrics, &s.AppliedAt, &s.ReportedAt)
+}
+
+// GetPolicyStatuses lists devices' latest policy status reports, newest
+// first, filterable by converged (as of each report) and failed_setting
+func (h *PolicyAdminHandler) GetPolicyStatuses(c *fiber.Ctx) error {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if s := c.Query("converged"); s != "" {
+		converged, err := strconv.ParseBool(s)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "converged must be true or false"})
+		}
+		args = append(args, converged)
+		where += ` AND s.converged = $` + strconv.Itoa(len(args))
+	}
+
+	if setting := c.Query("failed_setting"); setting != "" {
+		args = append(args, setting)
+		where += ` AND $` + strconv.Itoa(len(args)) + ` = ANY(s.failed_settings)`
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.UUIDCursorWhere(cur, "s.reported_at", "s.device_id", args)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		where += cursorWhere
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT `+policyStatusColumns+`
+		FROM device_policy_status s
+		JOIN agents a ON a.device_id = s.device_id`+where+`
+		ORDER BY s.reported_at DESC, s.device_id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1),
+		append(args, limit+1)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policy statuses"})
+	}
+	defer rows.Close()
+
+	statuses := []models.DevicePolicyStatus{}
+	for rows.Next() {
+		var s models.DevicePolicyStatus
+		if err := scanPolicyStatus(rows, &s); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan policy status"})
+		}
+		statuses = append(statuses, s)
+	}
+
+	var nextCursor string
+	if len(statuses) > limit {
+		statuses = statuses[:limit]
+		last := statuses[limit-1]
+		nextCursor = database.EncodeCursor(last.ReportedAt, last.DeviceID.String())
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        statuses,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetDevicePolicyStatus returns a device's latest policy status report,
+// with whether it has converged on the policy it's due now, which may have
+// changed since it reported
+func (h *PolicyAdminHandler) GetDevicePolicyStatus(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var status models.DevicePolicyStatus
+	var etag *string
+	var capabilities []models.Capability
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT `+policyStatusColumns+`, s.etag, a.capabilities
+		FROM device_policy_status s
+		JOIN agents a ON a.device_id = s.device_id
+		WHERE s.device_id = $1`, deviceID).Scan(&status.DeviceID, &status.Hostname, &status.PolicyVersion,
+		&status.ExpectedVersion, &status.Converged, &status.Settings, &status.FailedSettings,
+		&status.UnsupportedMetrics, &status.AppliedAt, &status.ReportedAt, &etag, &capabilities)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Device has not reported a policy status"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policy status"})
+	}
+
+	policies, memberOf, err := loadApplicablePolicies(c.UserContext(), h.db, deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query policies"})
+	}
+	effective := models.ResolveEffectivePolicy(policies, deviceID, memberOf)
+	if effective == nil {
+		effective = models.DefaultPolicy()
+	}
+	effective.FilterByCapabilities(capabilities)
+
+	status.ExpectedVersion = effective.Version
+	var served string
+	if etag != nil {
+		served = *etag
+	}
+	status.Converged = policyConverged(effective, status.PolicyVersion, served, status.FailedSettings)
+
+	return c.JSON(fiber.Map{"data": status})
+}
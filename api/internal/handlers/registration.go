@@ -1,34 +1,49 @@
 package handlers
 
 import (
+	"context"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
 	"github.com/yourorg/inventory-agent/api/internal/auth"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
 	"github.com/yourorg/inventory-agent/api/internal/models"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/policycache"
 )
 
 type RegistrationHandler struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	publisher *events.Publisher
+	cache     *policycache.Cache
 }
 
 type RegistrationRequest struct {
-	DeviceID    string                 `json:"device_id"`
-	Hostname    string                 `json:"hostname"`
-	Capabilities []models.Capability   `json:"capabilities"`
-	AgentVersion string                 `json:"agent_version"`
+	DeviceID     string              `json:"device_id"`
+	Hostname     string              `json:"hostname"`
+	Capabilities []models.Capability `json:"capabilities"`
+	AgentVersion string              `json:"agent_version"`
+	// Build of the agent binary
+	AgentCommit    string `json:"agent_commit,omitempty"`
+	AgentBuildDate string `json:"agent_build_date,omitempty"`
+	// Organization a new device enrolls into, from the agent's bootstrap
+	// discovery; the default organization when unset. Re-registering
+	// doesn't move a device.
+	OrgID int64 `json:"org_id,omitempty"`
 }
 
 type RegistrationResponse struct {
-	DeviceID     string `json:"device_id"`
-	AuthToken    string `json:"auth_token,omitempty"`
+	DeviceID      string `json:"device_id"`
+	AuthToken     string `json:"auth_token,omitempty"`
 	PolicyVersion int    `json:"policy_version"`
 }
 
-func NewRegistrationHandler(db *pgxpool.Pool) *RegistrationHandler {
-	return &RegistrationHandler{db: db}
+func NewRegistrationHandler(db *pgxpool.Pool, publisher *events.Publisher, cache *policycache.Cache) *RegistrationHandler {
+	return &RegistrationHandler{db: db, publisher: publisher, cache: cache}
 }
 
 func (h *RegistrationHandler) Register(c *fiber.Ctx) error {
@@ -37,24 +52,48 @@ func (h *RegistrationHandler) Register(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	resp, status, problem := h.register(c.UserContext(), &req)
+	if problem != nil {
+		return c.Status(status).JSON(problem)
+	}
+
+	return c.Status(200).JSON(resp)
+}
+
+// register enrolls a new device or re-enrolls a known one, issuing a new
+// auth token either way. It returns the response status and body when the
+// registration fails.
+func (h *RegistrationHandler) register(ctx context.Context, req *RegistrationRequest) (*RegistrationResponse, int, fiber.Map) {
 	// Validate required fields
 	if req.DeviceID == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "device_id is required"})
+		return nil, 400, fiber.Map{"error": "device_id is required"}
 	}
 
 	deviceID, err := uuid.Parse(req.DeviceID)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid device_id format"})
+		return nil, 400, fiber.Map{"error": "invalid device_id format"}
+	}
+	if req.OrgID < 0 {
+		return nil, 400, fiber.Map{"error": "invalid org_id"}
+	}
+	orgID := req.OrgID
+	if orgID == 0 {
+		orgID = 1
 	}
 
 	// Check if agent already exists
 	var existingAgent models.Agent
-	err = h.db.QueryRow(c.Context(),
+	err = h.db.QueryRow(ctx,
 		"SELECT device_id, auth_token_hash, status FROM agents WHERE device_id = $1",
 		deviceID).Scan(&existingAgent.DeviceID, &existingAgent.AuthTokenHash, &existingAgent.Status)
 
 	isNewAgent := err != nil // pgx.ErrNoRows
 
+	// Retired devices stay retired until purged
+	if !isNewAgent && existingAgent.IsRetired() {
+		return nil, 403, fiber.Map{"error": "Device has been retired"}
+	}
+
 	var authToken string
 	var authTokenHash string
 
@@ -63,56 +102,81 @@ func (h *RegistrationHandler) Register(c *fiber.Ctx) error {
 		authToken = uuid.New().String()
 		authTokenHash, err = auth.HashToken(authToken)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate auth token"})
+			return nil, 500, fiber.Map{"error": "Failed to generate auth token"}
 		}
 
 		// Insert new agent
-		_, err = h.db.Exec(c.Context(), `
-			INSERT INTO agents (device_id, hostname, capabilities, first_seen_at, last_seen_at, auth_token_hash, agent_version, status)
-			VALUES ($1, $2, $3, $4, $4, $5, $6, 'active')`,
-			deviceID, req.Hostname, req.Capabilities, time.Now(), authTokenHash, req.AgentVersion)
+		_, err = h.db.Exec(ctx, `
+			INSERT INTO agents (device_id, hostname, capabilities, first_seen_at, last_seen_at, auth_token_hash, agent_version, status, org_id)
+			VALUES ($1, $2, $3, $4, $4, $5, $6, 'active', $7)`,
+			deviceID, req.Hostname, req.Capabilities, time.Now(), authTokenHash, req.AgentVersion, orgID)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to register agent"})
+			return nil, 500, fiber.Map{"error": "Failed to register agent"}
 		}
 	} else {
 		// Update existing agent
 		authTokenHash, err = auth.HashToken(uuid.New().String()) // Generate new token for re-registration
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate auth token"})
+			return nil, 500, fiber.Map{"error": "Failed to generate auth token"}
 		}
 
 		authToken = uuid.New().String()
 		newHash, err := auth.HashToken(authToken)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate auth token"})
+			return nil, 500, fiber.Map{"error": "Failed to generate auth token"}
 		}
 
-		_, err = h.db.Exec(c.Context(), `
+		_, err = h.db.Exec(ctx, `
 			UPDATE agents
 			SET hostname = $2, capabilities = $3, last_seen_at = $4, auth_token_hash = $5, agent_version = $6, status = 'active'
-			WHERE device_id = $1`,
+			WHERE device_id = $1 AND status <> 'retired'`,
 			deviceID, req.Hostname, req.Capabilities, time.Now(), newHash, req.AgentVersion)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to update agent"})
+			return nil, 500, fiber.Map{"error": "Failed to update agent"}
 		}
+
+		// The policy it is served depends on its capabilities
+		h.cache.Invalidate(ctx, deviceID)
 	}
 
 	// Log registration event
-	_, err = h.db.Exec(c.Context(), `
-		INSERT INTO audit_log (actor, action, resource_type, resource_id, details)
-		VALUES ($1, $2, $3, $4, $5)`,
-		"agent", "register", "agent", deviceID.String(),
-		map[string]interface{}{"hostname": req.Hostname, "agent_version": req.AgentVersion})
+	err = audit.Record(ctx, h.db, "agent", "register", "agent", deviceID.String(),
+		map[string]interface{}{"hostname": req.Hostname, "agent_version": req.AgentVersion,
+			"agent_commit": req.AgentCommit, "agent_build_date": req.AgentBuildDate})
 	if err != nil {
-		// Log error but don't fail registration
-		// TODO: Add proper logging
+		logging.FromContext(ctx).Error("Failed to audit registration", "device_id", deviceID, "error", err)
+	}
+
+	// Link the device to its imported procurement record, if any
+	linked, err := database.LinkExpectedDevices(ctx, h.db, &deviceID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to link expected device", "device_id", deviceID, "error", err)
+	}
+
+	// A new device starts out enrolled; re-registering keeps its state
+	if isNewAgent {
+		if err := database.RecordEnrollment(ctx, h.db, deviceID, linked > 0); err != nil {
+			logging.FromContext(ctx).Error("Failed to record enrollment", "device_id", deviceID, "error", err)
+		}
+	}
+
+	if isNewAgent {
+		h.publisher.Publish(models.DeviceEvent(models.EventDeviceRegistered, deviceID, map[string]interface{}{
+			"hostname":      req.Hostname,
+			"agent_version": req.AgentVersion,
+		}))
+	}
+	if isNewAgent || !existingAgent.IsActive() {
+		h.publisher.Publish(models.DeviceEvent(models.EventDeviceOnline, deviceID, map[string]interface{}{
+			"hostname": req.Hostname,
+		}))
 	}
 
 	resp := RegistrationResponse{
-		DeviceID:     deviceID.String(),
-		AuthToken:    authToken, // Only sent on registration/re-registration
-		PolicyVersion: 1,        // TODO: Get actual policy version
+		DeviceID:      deviceID.String(),
+		AuthToken:     authToken, // Only sent on registration/re-registration
+		PolicyVersion: 1,         // TODO: Get actual policy version
 	}
 
-	return c.Status(200).JSON(resp)
-}
\ No newline at end of file
+	return &resp, 0, nil
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/logging"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// ReleaseHandler manages agent releases and their rollouts
+type ReleaseHandler struct {
+	db         *pgxpool.Pool
+	releaseDir string
+}
+
+func NewReleaseHandler(db *pgxpool.Pool, releaseDir string) *ReleaseHandler {
+	return &ReleaseHandler{db: db, releaseDir: releaseDir}
+}
+
+const releaseColumns = `rel.release_id, rel.org_id, rel.version, rel.platform, rel.arch, COALESCE(rel.url, ''),
+	rel.file_path IS NOT NULL, rel.sha256, rel.size_bytes, COALESCE(rel.signature, ''), COALESCE(rel.notes, ''),
+	COALESCE(rel.created_by, ''), rel.created_at, rel.updated_at`
+
+func scanRelease(row pgx.Row, r *models.AgentRelease) error {
+	return row.Scan(&r.ReleaseID, &r.OrgID, &r.Version, &r.Platform, &r.Arch, &r.URL,
+		&r.Uploaded, &r.SHA256, &r.SizeBytes, &r.Signature, &r.Notes,
+		&r.CreatedBy, &r.CreatedAt, &r.UpdatedAt)
+}
+
+const rolloutColumns = `r.rollout_id, r.org_id, r.release_id, rel.version, r.platform, r.arch, r.name, r.rings,
+	r.current_ring, r.status, r.max_failures, COALESCE(r.paused_reason, ''), COALESCE(r.created_by, ''),
+	r.created_at, r.updated_at`
+
+func scanRollout(row pgx.Row, r *models.Rollout) error {
+	return row.Scan(&r.RolloutID, &r.OrgID, &r.ReleaseID, &r.Version, &r.Platform, &r.Arch, &r.Name, &r.Rings,
+		&r.CurrentRing, &r.Status, &r.MaxFailures, &r.PausedReason, &r.CreatedBy,
+		&r.CreatedAt, &r.UpdatedAt)
+}
+
+func (h *ReleaseHandler) GetReleases(c *fiber.Ctx) error {
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT `+releaseColumns+`
+		FROM agent_releases rel
+		ORDER BY rel.created_at DESC`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query releases"})
+	}
+	defer rows.Close()
+
+	releases := []models.AgentRelease{}
+	for rows.Next() {
+		var r models.AgentRelease
+		if err := scanRelease(rows, &r); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan release"})
+		}
+		releases = append(releases, r)
+	}
+
+	return c.JSON(fiber.Map{"data": releases})
+}
+
+func (h *ReleaseHandler) GetRelease(c *fiber.Ctx) error {
+	releaseID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid release ID"})
+	}
+
+	var r models.AgentRelease
+	err = scanRelease(h.db.QueryRow(c.UserContext(), `
+		SELECT `+releaseColumns+` FROM agent_releases rel WHERE rel.release_id = $1`, releaseID), &r)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Release not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": r})
+}
+
+// CreateRelease registers a release hosted elsewhere from a JSON body with
+// its url and sha256, or uploads one as multipart/form-data with the file
+// in "artifact" and the other fields as form values. Uploaded artifacts are
+// stored under the release directory named by their SHA-256.
+func (h *ReleaseHandler) CreateRelease(c *fiber.Ctx) error {
+	r := models.AgentRelease{Platform: "windows", Arch: "amd64"}
+	var filePath string
+
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		r.Version = c.FormValue("version")
+		r.Platform = c.FormValue("platform", r.Platform)
+		r.Arch = c.FormValue("arch", r.Arch)
+		r.Signature = c.FormValue("signature")
+		r.Notes = c.FormValue("notes")
+
+		artifact, err := c.FormFile("artifact")
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "artifact file is required"})
+		}
+
+		filePath, err = h.storeArtifact(artifact, &r)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to store release artifact", "error", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to store release artifact"})
+		}
+	} else {
+		if err := c.BodyParser(&r); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid release data"})
+		}
+		if r.URL == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid release: url is required unless the artifact is uploaded"})
+		}
+	}
+
+	if err := r.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid release: " + err.Error()})
+	}
+
+	r.CreatedBy = adminUser(c)
+	r.Uploaded = filePath != ""
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO agent_releases (version, platform, arch, url, file_path, sha256, size_bytes, signature, notes, created_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10)
+		RETURNING release_id, org_id, created_at, updated_at`,
+		r.Version, r.Platform, r.Arch, r.URL, filePath, r.SHA256, r.SizeBytes, r.Signature, r.Notes, r.CreatedBy,
+	).Scan(&r.ReleaseID, &r.OrgID, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return c.Status(409).JSON(fiber.Map{"error": "Release already exists for this version and platform"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create release"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": r})
+}
+
+// storeArtifact copies an uploaded artifact into the release directory,
+// filling in the release's hash and size, and returns its path
+func (h *ReleaseHandler) storeArtifact(artifact *multipart.FileHeader, r *models.AgentRelease) (string, error) {
+	if err := os.MkdirAll(h.releaseDir, 0o755); err != nil {
+		return "", err
+	}
+
+	src, err := artifact.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(h.releaseDir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	r.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	r.SizeBytes = &size
+
+	path := filepath.Join(h.releaseDir, r.SHA256+strings.ToLower(filepath.Ext(artifact.Filename)))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// DeleteRelease deletes a release no rollout uses, and its uploaded artifact
+// unless another release shares it
+func (h *ReleaseHandler) DeleteRelease(c *fiber.Ctx) error {
+	releaseID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid release ID"})
+	}
+
+	var filePath *string
+	err = h.db.QueryRow(c.UserContext(),
+		"DELETE FROM agent_releases WHERE release_id = $1 RETURNING file_path", releaseID).Scan(&filePath)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{"error": "Release not found"})
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return c.Status(409).JSON(fiber.Map{"error": "Release is used by a rollout"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete release"})
+	}
+
+	if filePath != nil {
+		var shared bool
+		err = h.db.QueryRow(c.UserContext(),
+			"SELECT EXISTS (SELECT 1 FROM agent_releases WHERE file_path = $1)", *filePath).Scan(&shared)
+		if err == nil && !shared {
+			if err := os.Remove(*filePath); err != nil && !os.IsNotExist(err) {
+				logging.FromContext(c.UserContext()).Error("Failed to remove release artifact", "path", *filePath, "error", err)
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"message": "Release deleted"})
+}
+
+// GetRollouts lists rollouts newest first, optionally narrowed by ?status=
+func (h *ReleaseHandler) GetRollouts(c *fiber.Ctx) error {
+	where := ``
+	args := []interface{}{}
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		where = ` WHERE r.status = $1`
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT `+rolloutColumns+`
+		FROM agent_rollouts r
+		JOIN agent_releases rel ON rel.release_id = r.release_id`+where+`
+		ORDER BY r.created_at DESC`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query rollouts"})
+	}
+	defer rows.Close()
+
+	rollouts := []models.Rollout{}
+	for rows.Next() {
+		var r models.Rollout
+		if err := scanRollout(rows, &r); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan rollout"})
+		}
+		rollouts = append(rollouts, r)
+	}
+
+	return c.JSON(fiber.Map{"data": rollouts})
+}
+
+// GetRollout returns a rollout with its device counts by upgrade status
+func (h *ReleaseHandler) GetRollout(c *fiber.Ctx) error {
+	rolloutID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	r, err := loadRollout(c.UserContext(), h.db, rolloutID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Rollout not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": r})
+}
+
+func loadRollout(ctx context.Context, db *pgxpool.Pool, rolloutID int64) (*models.Rollout, error) {
+	var r models.Rollout
+	err := scanRollout(db.QueryRow(ctx, `
+		SELECT `+rolloutColumns+`
+		FROM agent_rollouts r
+		JOIN agent_releases rel ON rel.release_id = r.release_id
+		WHERE r.rollout_id = $1`, rolloutID), &r)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT status, COUNT(*) FROM agent_rollout_devices WHERE rollout_id = $1 GROUP BY status`, rolloutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r.Devices = map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		r.Devices[status] = count
+	}
+
+	return &r, rows.Err()
+}
+
+// CreateRollout starts rolling a release out from its first ring. Only one
+// rollout per platform can be active or paused at a time.
+func (h *ReleaseHandler) CreateRollout(c *fiber.Ctx) error {
+	var r models.Rollout
+	if err := c.BodyParser(&r); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout data"})
+	}
+
+	if err := r.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout: " + err.Error()})
+	}
+
+	var rolloutID int64
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO agent_rollouts (org_id, release_id, platform, arch, name, rings, max_failures, created_by)
+		SELECT org_id, release_id, platform, arch, $2, $3, $4, $5
+		FROM agent_releases WHERE release_id = $1
+		RETURNING rollout_id`,
+		r.ReleaseID, r.Name, r.Rings, r.MaxFailures, adminUser(c)).Scan(&rolloutID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(400).JSON(fiber.Map{"error": "Release not found"})
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return c.Status(409).JSON(fiber.Map{"error": "A rollout is already in progress for this platform"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create rollout"})
+	}
+
+	created, err := loadRollout(c.UserContext(), h.db, rolloutID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load rollout"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": created})
+}
+
+// AdvanceRollout opens the next ring of an active rollout; advancing past
+// the last ring completes it
+func (h *ReleaseHandler) AdvanceRollout(c *fiber.Ctx) error {
+	return h.transitionRollout(c, `
+		current_ring = LEAST(current_ring + 1, jsonb_array_length(rings) - 1),
+		status = CASE WHEN current_ring + 1 >= jsonb_array_length(rings) THEN 'completed' ELSE status END`,
+		models.RolloutActive)
+}
+
+// PauseRollout stops offering an active rollout's release
+func (h *ReleaseHandler) PauseRollout(c *fiber.Ctx) error {
+	return h.transitionRollout(c, `status = 'paused', paused_reason = NULL`, models.RolloutActive)
+}
+
+// ResumeRollout resumes a paused rollout at the ring it reached
+func (h *ReleaseHandler) ResumeRollout(c *fiber.Ctx) error {
+	return h.transitionRollout(c, `status = 'active', paused_reason = NULL`, models.RolloutPaused)
+}
+
+// CancelRollout ends a rollout. Devices it reached are offered the release
+// of the last completed rollout instead, rolling them back.
+func (h *ReleaseHandler) CancelRollout(c *fiber.Ctx) error {
+	return h.transitionRollout(c, `status = 'cancelled', paused_reason = NULL`, models.RolloutActive, models.RolloutPaused)
+}
+
+// transitionRollout applies set to a rollout in one of the from statuses
+func (h *ReleaseHandler) transitionRollout(c *fiber.Ctx, set string, from ...string) error {
+	rolloutID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	tag, err := h.db.Exec(c.UserContext(), `
+		UPDATE agent_rollouts SET `+set+`
+		WHERE rollout_id = $1 AND status = ANY($2)`,
+		rolloutID, from)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return c.Status(409).JSON(fiber.Map{"error": "A rollout is already in progress for this platform"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update rollout"})
+	}
+
+	r, err := loadRollout(c.UserContext(), h.db, rolloutID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Rollout not found"})
+	}
+
+	if tag.RowsAffected() == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Rollout is " + r.Status})
+	}
+
+	return c.JSON(fiber.Map{"data": r})
+}
+
+// GetRolloutDevices lists the devices a rollout has reached, most recently
+// updated first, optionally narrowed by ?status=
+func (h *ReleaseHandler) GetRolloutDevices(c *fiber.Ctx) error {
+	rolloutID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	where := ` WHERE d.rollout_id = $1`
+	args := []interface{}{rolloutID}
+
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		where += ` AND d.status = $` + strconv.Itoa(len(args))
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.UUIDCursorWhere(cur, "d.updated_at", "d.device_id", args)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		where += cursorWhere
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT d.device_id, a.hostname, d.status, d.from_version, d.error, d.offered_at, d.updated_at
+		FROM agent_rollout_devices d
+		JOIN agents a ON a.device_id = d.device_id`+where+`
+		ORDER BY d.updated_at DESC, d.device_id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1),
+		append(args, limit+1)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query rollout devices"})
+	}
+	defer rows.Close()
+
+	devices := []models.RolloutDevice{}
+	for rows.Next() {
+		var d models.RolloutDevice
+		if err := rows.Scan(&d.DeviceID, &d.Hostname, &d.Status, &d.FromVersion, &d.Error, &d.OfferedAt, &d.UpdatedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan rollout device"})
+		}
+		devices = append(devices, d)
+	}
+
+	var nextCursor string
+	if len(devices) > limit {
+		devices = devices[:limit]
+		last := devices[limit-1]
+		nextCursor = database.EncodeCursor(last.UpdatedAt, last.DeviceID.String())
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        devices,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type ReportHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewReportHandler(db *pgxpool.Pool) *ReportHandler {
+	return &ReportHandler{db: db}
+}
+
+// Per-device capacity expressions over telemetry_latest aliased as "t".
+// disk.utilization may be a single disk object or an array of disks; a
+// total_bytes that isn't a JSON number counts as unknown.
+const (
+	memoryBytesSQL = `CASE WHEN jsonb_typeof(t.metrics->'memory.usage'->'total_bytes') = 'number'
+		THEN (t.metrics->'memory.usage'->>'total_bytes')::numeric END`
+	diskBytesSQL = `(SELECT SUM((d->>'total_bytes')::numeric)
+		FROM jsonb_array_elements(CASE jsonb_typeof(t.metrics->'disk.utilization')
+			WHEN 'array' THEN t.metrics->'disk.utilization'
+			WHEN 'object' THEN jsonb_build_array(t.metrics->'disk.utilization')
+			ELSE '[]'::jsonb END) d
+		WHERE jsonb_typeof(d->'total_bytes') = 'number')`
+)
+
+// aggregateMetricSQL maps the metrics GetMetricAggregate can summarize to
+// their per-device value over telemetry_latest aliased as "t": CPU percent,
+// and percent used for memory and for all disks together. CPU and memory
+// read generated columns.
+var aggregateMetricSQL = map[string]string{
+	"cpu.utilization": `t.cpu_percent`,
+	"memory.usage":    `t.memory_used_pct`,
+	"disk.utilization": `(SELECT ((SUM((d->>'total_bytes')::numeric) - SUM((d->>'free_bytes')::numeric)) * 100
+			/ NULLIF(SUM((d->>'total_bytes')::numeric), 0))::float8
+		FROM jsonb_array_elements(CASE jsonb_typeof(t.metrics->'disk.utilization')
+			WHEN 'array' THEN t.metrics->'disk.utilization'
+			WHEN 'object' THEN jsonb_build_array(t.metrics->'disk.utilization')
+			ELSE '[]'::jsonb END) d
+		WHERE jsonb_typeof(d->'free_bytes') = 'number' AND jsonb_typeof(d->'total_bytes') = 'number')`,
+}
+
+// GetFleetReport returns OS, agent version and hardware model distributions
+// plus memory and disk capacity histograms. ?group_id limits the report to
+// one group.
+func (h *ReportHandler) GetFleetReport(c *fiber.Ctx) error {
+	where := ` WHERE a.status <> 'retired'`
+	args := []interface{}{}
+
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		groupID, err := strconv.ParseInt(groupIDStr, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+		}
+		args = append(args, groupID)
+		where += ` AND a.device_id IN (SELECT device_id FROM device_group_members WHERE group_id = $1)`
+	}
+
+	ctx := c.UserContext()
+	report := models.FleetReport{GeneratedAt: time.Now()}
+
+	err := h.db.QueryRow(ctx, `SELECT COUNT(*) FROM agents a`+where, args...).Scan(&report.DeviceCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to count devices"})
+	}
+
+	report.OSVersions, err = h.distribution(ctx, `
+		SELECT COALESCE(NULLIF(TRIM(CONCAT_WS(' ', t.metrics->'os.info'->>'caption', t.metrics->'os.info'->>'version')), ''), 'unknown')
+		FROM agents a
+		LEFT JOIN telemetry_latest t ON t.device_id = a.device_id`+where, args)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query OS versions"})
+	}
+
+	report.AgentVersions, err = h.distribution(ctx, `
+		SELECT COALESCE(NULLIF(a.agent_version, ''), 'unknown')
+		FROM agents a`+where, args)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query agent versions"})
+	}
+
+	report.HardwareModels, err = h.distribution(ctx, `
+		SELECT COALESCE(NULLIF(TRIM(CONCAT_WS(' ', t.metrics->'os.info'->>'make', t.metrics->'os.info'->>'model')), ''), 'unknown')
+		FROM agents a
+		LEFT JOIN telemetry_latest t ON t.device_id = a.device_id`+where, args)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query hardware models"})
+	}
+
+	report.MemoryCapacity, err = h.histogram(ctx, memoryBytesSQL, models.MemoryCapacityBuckets(), where, args)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query memory capacity"})
+	}
+
+	report.DiskCapacity, err = h.histogram(ctx, diskBytesSQL, models.DiskCapacityBuckets(), where, args)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query disk capacity"})
+	}
+
+	return c.JSON(fiber.Map{"data": report})
+}
+
+// GetMetricAggregate serves /metrics/aggregate?metric=disk.utilization:
+// avg, min, max, p50 and p95 of a metric across devices' latest telemetry,
+// optionally per group_by=tag:<key> (agent-reported tag) or
+// admin_tag:<key>. Devices without the tag fall under "unknown"; devices
+// that haven't reported the metric are left out.
+func (h *ReportHandler) GetMetricAggregate(c *fiber.Ctx) error {
+	metric := c.Query("metric")
+	valueSQL, ok := aggregateMetricSQL[metric]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "metric must be cpu.utilization, memory.usage or disk.utilization"})
+	}
+
+	where := ` WHERE a.status <> 'retired'`
+	args := []interface{}{}
+
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		groupID, err := strconv.ParseInt(groupIDStr, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid group ID"})
+		}
+		args = append(args, groupID)
+		where += ` AND a.device_id IN (SELECT device_id FROM device_group_members WHERE group_id = $1)`
+	}
+
+	groupSQL := `'all'`
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		kind, key, _ := strings.Cut(groupBy, ":")
+		if key == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "group_by must be tag:<key> or admin_tag:<key>"})
+		}
+		args = append(args, key)
+		switch kind {
+		case "tag":
+			groupSQL = `COALESCE(NULLIF(t.tags->>$` + strconv.Itoa(len(args)) + `, ''), 'unknown')`
+		case "admin_tag":
+			groupSQL = `COALESCE(NULLIF((SELECT tg.tag_value FROM device_tags tg
+				WHERE tg.device_id = a.device_id AND tg.tag_key = $` + strconv.Itoa(len(args)) + `), ''), 'unknown')`
+		default:
+			return c.Status(400).JSON(fiber.Map{"error": "group_by must be tag:<key> or admin_tag:<key>"})
+		}
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT g, COUNT(*), AVG(v), MIN(v), MAX(v),
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY v),
+		       percentile_cont(0.95) WITHIN GROUP (ORDER BY v)
+		FROM (
+			SELECT `+groupSQL+` AS g, `+valueSQL+` AS v
+			FROM agents a
+			JOIN telemetry_latest t ON t.device_id = a.device_id`+where+`
+		) AS m
+		WHERE v IS NOT NULL
+		GROUP BY g
+		ORDER BY g`, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to aggregate metric"})
+	}
+	defer rows.Close()
+
+	groups := []models.MetricAggregate{}
+	for rows.Next() {
+		var m models.MetricAggregate
+		if err := rows.Scan(&m.Group, &m.Devices, &m.Avg, &m.Min, &m.Max, &m.P50, &m.P95); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan metric aggregate"})
+		}
+		groups = append(groups, m)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to aggregate metric"})
+	}
+
+	return c.JSON(fiber.Map{
+		"metric":       metric,
+		"group_by":     c.Query("group_by"),
+		"generated_at": time.Now(),
+		"data":         groups,
+	})
+}
+
+// GetStaleDeviceReport lists stale device cleanup runs newest first, each
+// with the devices it retired. ?org_id limits the report to one org.
+func (h *ReportHandler) GetStaleDeviceReport(c *fiber.Ctx) error {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+
+	if orgIDStr := c.Query("org_id"); orgIDStr != "" {
+		orgID, err := strconv.ParseInt(orgIDStr, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid org ID"})
+		}
+		args = append(args, orgID)
+		where += ` AND r.org_id = $` + strconv.Itoa(len(args))
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.Int64CursorWhere(cur, "r.ran_at", "r.run_id", args)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		where += cursorWhere
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT r.run_id, r.org_id, r.stale_device_days, r.purge, r.devices_retired, r.devices, r.ran_at
+		FROM stale_device_runs r`+where+`
+		ORDER BY r.ran_at DESC, r.run_id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1),
+		append(args, limit+1)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query stale device runs"})
+	}
+	defer rows.Close()
+
+	runs := []models.StaleDeviceRun{}
+	for rows.Next() {
+		var r models.StaleDeviceRun
+		err := rows.Scan(&r.RunID, &r.OrgID, &r.StaleDeviceDays, &r.Purge, &r.DevicesRetired, &r.Devices, &r.RanAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan stale device run"})
+		}
+		runs = append(runs, r)
+	}
+
+	var nextCursor string
+	if len(runs) > limit {
+		runs = runs[:limit]
+		last := runs[limit-1]
+		nextCursor = database.EncodeCursor(last.RanAt, strconv.FormatInt(last.RunID, 10))
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        runs,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
+
+// distribution groups the single label column produced by query and counts
+// devices per label, largest first
+func (h *ReportHandler) distribution(ctx context.Context, query string, args []interface{}) ([]models.ReportBucket, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT label, COUNT(*) FROM (`+query+`) AS d(label)
+		GROUP BY label
+		ORDER BY COUNT(*) DESC, label`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []models.ReportBucket{}
+	for rows.Next() {
+		var b models.ReportBucket
+		if err := rows.Scan(&b.Label, &b.Count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// histogram counts devices per capacity bucket. Devices that haven't
+// reported the metric are left out.
+func (h *ReportHandler) histogram(ctx context.Context, valueSQL string, buckets []models.CapacityBucket, where string, args []interface{}) ([]models.CapacityBucket, error) {
+	boundsArg := "$" + strconv.Itoa(len(args)+1)
+	rows, err := h.db.Query(ctx, `
+		SELECT width_bucket(v, `+boundsArg+`::numeric[]), COUNT(*)
+		FROM (
+			SELECT `+valueSQL+` AS v
+			FROM agents a
+			JOIN telemetry_latest t ON t.device_id = a.device_id`+where+`
+		) AS capacity
+		WHERE v IS NOT NULL
+		GROUP BY 1`, append(args, models.BucketBounds(buckets))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var index int
+		var count int64
+		if err := rows.Scan(&index, &count); err != nil {
+			return nil, err
+		}
+		if index >= 0 && index < len(buckets) {
+			buckets[index].Count = count
+		}
+	}
+
+	return buckets, rows.Err()
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type SavedFilterHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewSavedFilterHandler(db *pgxpool.Pool) *SavedFilterHandler {
+	return &SavedFilterHandler{db: db}
+}
+
+func (h *SavedFilterHandler) GetFilters(c *fiber.Ctx) error {
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT filter_id, org_id, name, COALESCE(description, ''), filter,
+		       COALESCE(created_by, ''), created_at, updated_at
+		FROM saved_filters
+		ORDER BY name`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query filters"})
+	}
+	defer rows.Close()
+
+	var filters []models.SavedFilter
+	for rows.Next() {
+		var f models.SavedFilter
+		err := rows.Scan(&f.FilterID, &f.OrgID, &f.Name, &f.Description, &f.Filter,
+			&f.CreatedBy, &f.CreatedAt, &f.UpdatedAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan filter"})
+		}
+		filters = append(filters, f)
+	}
+
+	return c.JSON(fiber.Map{"data": filters})
+}
+
+func (h *SavedFilterHandler) GetFilter(c *fiber.Ctx) error {
+	filterID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter ID"})
+	}
+
+	f, err := loadSavedFilter(c.UserContext(), h.db, filterID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Filter not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": f})
+}
+
+func (h *SavedFilterHandler) CreateFilter(c *fiber.Ctx) error {
+	var f models.SavedFilter
+	if err := c.BodyParser(&f); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter data"})
+	}
+
+	if err := f.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter: " + err.Error()})
+	}
+
+	if f.OrgID == 0 {
+		f.OrgID = 1
+	}
+	f.CreatedBy = adminUser(c)
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO saved_filters (org_id, name, description, filter, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING filter_id, created_at, updated_at`,
+		f.OrgID, f.Name, f.Description, f.Filter, f.CreatedBy).Scan(
+		&f.FilterID, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create filter"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": f})
+}
+
+// UpdateFilter replaces a saved filter. Smart groups built on it pick up the
+// change on their next evaluation.
+func (h *SavedFilterHandler) UpdateFilter(c *fiber.Ctx) error {
+	filterID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter ID"})
+	}
+
+	var f models.SavedFilter
+	if err := c.BodyParser(&f); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter data"})
+	}
+
+	if err := f.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter: " + err.Error()})
+	}
+
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE saved_filters
+		SET name = $2, description = $3, filter = $4
+		WHERE filter_id = $1
+		RETURNING filter_id, org_id, COALESCE(created_by, ''), created_at, updated_at`,
+		filterID, f.Name, f.Description, f.Filter).Scan(
+		&f.FilterID, &f.OrgID, &f.CreatedBy, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Filter not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": f})
+}
+
+func (h *SavedFilterHandler) DeleteFilter(c *fiber.Ctx) error {
+	filterID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter ID"})
+	}
+
+	result, err := h.db.Exec(c.UserContext(), "DELETE FROM saved_filters WHERE filter_id = $1", filterID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return c.Status(409).JSON(fiber.Map{"error": "Filter is used by a smart group"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete filter"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Filter not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Filter deleted"})
+}
+
+// GetFilterDevices previews the devices a saved filter currently matches
+func (h *SavedFilterHandler) GetFilterDevices(c *fiber.Ctx) error {
+	filterID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid filter ID"})
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	f, err := loadSavedFilter(c.UserContext(), h.db, filterID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Filter not found"})
+	}
+
+	where, args := database.DeviceFilterSQL(&f.Filter, nil)
+
+	var total int
+	err = h.db.QueryRow(c.UserContext(), `SELECT COUNT(*) FROM agents a WHERE 1=1`+where, args...).Scan(&total)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to count devices"})
+	}
+
+	args = append(args, limit)
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT a.device_id, a.hostname, a.status, a.agent_version, a.first_seen_at, a.last_seen_at
+		FROM agents a
+		WHERE 1=1`+where+`
+		ORDER BY a.hostname
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query devices"})
+	}
+	defer rows.Close()
+
+	var devices []models.Agent
+	for rows.Next() {
+		var device models.Agent
+		err := rows.Scan(&device.DeviceID, &device.Hostname, &device.Status,
+			&device.AgentVersion, &device.FirstSeenAt, &device.LastSeenAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan device"})
+		}
+		devices = append(devices, device)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  devices,
+		"total": total,
+	})
+}
+
+func loadSavedFilter(ctx context.Context, db *pgxpool.Pool, filterID int64) (*models.SavedFilter, error) {
+	var f models.SavedFilter
+	err := db.QueryRow(ctx, `
+		SELECT filter_id, org_id, name, COALESCE(description, ''), filter,
+		       COALESCE(created_by, ''), created_at, updated_at
+		FROM saved_filters WHERE filter_id = $1`, filterID).Scan(
+		&f.FilterID, &f.OrgID, &f.Name, &f.Description, &f.Filter,
+		&f.CreatedBy, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
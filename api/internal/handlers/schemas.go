@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/inventory-agent/shared/schemas"
+	"github.com/yourorg/inventory-agent/shared/validation"
+)
+
+// SchemaHandler serves the telemetry schema versions ingest accepts, so
+// agents can pick a version the API understands and tools can fetch the
+// schemas themselves, and the schema of each collector's output, so agents
+// can check it before sending
+type SchemaHandler struct {
+	validator *validation.Validator
+}
+
+// SchemaVersions lists the versions of a schema the API validates against
+type SchemaVersions struct {
+	Name     string `json:"name"`
+	Versions []int  `json:"versions"`
+	Latest   int    `json:"latest"`
+}
+
+func NewSchemaHandler(validator *validation.Validator) *SchemaHandler {
+	return &SchemaHandler{validator: validator}
+}
+
+// GetTelemetryVersions lists the telemetry schema versions ingest accepts
+func (h *SchemaHandler) GetTelemetryVersions(c *fiber.Ctx) error {
+	versions := h.validator.Versions("telemetry")
+	resp := SchemaVersions{Name: "telemetry", Versions: versions}
+	if len(versions) > 0 {
+		resp.Latest = versions[len(versions)-1]
+	}
+	return c.JSON(fiber.Map{"data": resp})
+}
+
+// GetTelemetrySchema serves one version of the telemetry schema
+func (h *SchemaHandler) GetTelemetrySchema(c *fiber.Ctx) error {
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil || !h.validator.HasSchema(validation.VersionedName("telemetry", version)) {
+		return c.Status(404).JSON(fiber.Map{"error": "Schema version not found"})
+	}
+
+	data, err := fs.ReadFile(schemas.FS, schemas.VersionPath("telemetry", version))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read schema"})
+	}
+	c.Set(fiber.HeaderContentType, "application/schema+json")
+	return c.Send(data)
+}
+
+// GetMetricSchema serves the schema of one collector's output, taken from
+// the latest telemetry schema version or the one given by ?version
+func (h *SchemaHandler) GetMetricSchema(c *fiber.Ctx) error {
+	versions := h.validator.Versions("telemetry")
+	if len(versions) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Schema version not found"})
+	}
+	version := versions[len(versions)-1]
+	if v := c.Query("version"); v != "" {
+		var err error
+		version, err = strconv.Atoi(v)
+		if err != nil || !h.validator.HasSchema(validation.VersionedName("telemetry", version)) {
+			return c.Status(404).JSON(fiber.Map{"error": "Schema version not found"})
+		}
+	}
+
+	data, err := schemas.MetricSchema(version, c.Params("metric"))
+	if errors.Is(err, schemas.ErrUnknownMetric) {
+		return c.Status(404).JSON(fiber.Map{"error": "Metric not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read schema"})
+	}
+	c.Set(fiber.HeaderContentType, "application/schema+json")
+	return c.Send(data)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type SearchHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewSearchHandler(db *pgxpool.Pool) *SearchHandler {
+	return &SearchHandler{db: db}
+}
+
+// Search matches ?q= against device hostnames, serials, last users and tags
+// and against installed software names. Each device or title is returned
+// once, under its best-scoring match. ?type=device|software narrows the hits.
+func (h *SearchHandler) Search(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < 2 {
+		return c.Status(400).JSON(fiber.Map{"error": "q must be at least 2 characters"})
+	}
+
+	hitType := c.Query("type")
+	if hitType != "" && hitType != models.SearchHitDevice && hitType != models.SearchHitSoftware {
+		return c.Status(400).JSON(fiber.Map{"error": "type must be device or software"})
+	}
+
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	// ILIKE on a %term% pattern is served by the trigram indexes;
+	// similarity() ranks the candidates
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT type, id, label, field, value, score::float8 FROM (
+			SELECT DISTINCT ON (type, id) type, id, label, field, value, score
+			FROM (
+				SELECT 'device' AS type, a.device_id::text AS id, a.hostname AS label,
+				       'hostname' AS field, a.hostname AS value, similarity(a.hostname, $1) AS score
+				FROM agents a
+				WHERE a.status <> 'retired' AND a.hostname ILIKE $2
+
+				UNION ALL
+				SELECT 'device', a.device_id::text, a.hostname, 'serial', t.metrics->'os.info'->>'serial',
+				       similarity(t.metrics->'os.info'->>'serial', $1)
+				FROM telemetry_latest t
+				JOIN agents a ON a.device_id = t.device_id
+				WHERE a.status <> 'retired' AND (t.metrics->'os.info'->>'serial') ILIKE $2
+
+				UNION ALL
+				SELECT 'device', a.device_id::text, a.hostname, 'last_user', t.metrics->'os.info'->>'last_user',
+				       similarity(t.metrics->'os.info'->>'last_user', $1)
+				FROM telemetry_latest t
+				JOIN agents a ON a.device_id = t.device_id
+				WHERE a.status <> 'retired' AND (t.metrics->'os.info'->>'last_user') ILIKE $2
+
+				UNION ALL
+				SELECT 'device', a.device_id::text, a.hostname, 'tag', tg.tag_key || '=' || tg.tag_value,
+				       GREATEST(similarity(tg.tag_key, $1), similarity(tg.tag_value, $1))
+				FROM device_tags tg
+				JOIN agents a ON a.device_id = tg.device_id
+				WHERE a.status <> 'retired' AND (tg.tag_key ILIKE $2 OR tg.tag_value ILIKE $2)
+
+				UNION ALL
+				SELECT 'software', st.title_id::text, st.name, 'name', st.name, similarity(st.name, $1)
+				FROM software_titles st
+				WHERE st.name ILIKE $2
+				  AND EXISTS (SELECT 1 FROM device_software s WHERE s.title_id = st.title_id AND s.removed_at IS NULL)
+			) hits
+			WHERE $3 = '' OR type = $3
+			ORDER BY type, id, score DESC
+		) best
+		ORDER BY score DESC, label
+		LIMIT $4`,
+		q, "%"+database.EscapeLike(q)+"%", hitType, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to search"})
+	}
+	defer rows.Close()
+
+	hits := []models.SearchHit{}
+	for rows.Next() {
+		var hit models.SearchHit
+		if err := rows.Scan(&hit.Type, &hit.ID, &hit.Label, &hit.Field, &hit.Value, &hit.Score); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan search hit"})
+		}
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to search"})
+	}
+
+	return c.JSON(fiber.Map{"data": hits})
+}
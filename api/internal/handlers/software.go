@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/export"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type SoftwareHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewSoftwareHandler(db *pgxpool.Pool) *SoftwareHandler {
+	return &SoftwareHandler{db: db}
+}
+
+// SearchSoftware finds installed software across the fleet. Each result is a
+// name/version pair with the number of devices it is installed on and up to
+// device_limit of those devices.
+//
+// Query parameters: name (substring), publisher (substring), version (exact),
+// version_lt / version_lte / version_gt / version_gte (numeric comparison).
+// With format=csv|xlsx every matching install is exported, one row per device.
+func (h *SoftwareHandler) SearchSoftware(c *fiber.Ctx) error {
+	params := queryValues(c)
+	if params.Get("format") != "" {
+		return streamExport(c, h.db, nil, export.KindSoftware, params)
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	deviceLimit := 100
+	if l := c.Query("device_limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed >= 0 && parsed <= 10000 {
+			deviceLimit = parsed
+		}
+	}
+
+	where, args, err := database.SoftwareSearchWhere(params)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Distinct devices across all matching entries, not just the returned page
+	var deviceCount int64
+	err = h.db.QueryRow(c.UserContext(), `
+		SELECT COUNT(DISTINCT s.device_id)
+		FROM device_software s
+		JOIN software_titles t ON t.title_id = s.title_id
+		JOIN agents a ON a.device_id = s.device_id`+where, args...).Scan(&deviceCount)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to count devices"})
+	}
+
+	args = append(args, deviceLimit, limit)
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT t.title_id, t.name, s.version, t.publisher, COUNT(*), MIN(s.first_seen_at),
+		       COALESCE(to_jsonb((array_agg(jsonb_build_object('device_id', a.device_id, 'hostname', a.hostname)
+		                ORDER BY a.hostname))[1:$`+strconv.Itoa(len(args)-1)+`]), '[]'::jsonb)
+		FROM device_software s
+		JOIN software_titles t ON t.title_id = s.title_id
+		JOIN agents a ON a.device_id = s.device_id`+where+`
+		GROUP BY t.title_id, s.version, s.version_parts
+		ORDER BY t.name, s.version_parts DESC
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to search software"})
+	}
+	defer rows.Close()
+
+	entries := []models.SoftwareEntry{}
+	for rows.Next() {
+		var entry models.SoftwareEntry
+		err := rows.Scan(&entry.TitleID, &entry.Name, &entry.Version, &entry.Publisher,
+			&entry.DeviceCount, &entry.FirstSeenAt, &entry.Devices)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan software"})
+		}
+		entries = append(entries, entry)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":         entries,
+		"device_count": deviceCount,
+	})
+}
+
+// GetDeviceSoftware lists the software installed on a device. With
+// ?include_removed=true, installs no longer reported are included too.
+func (h *SoftwareHandler) GetDeviceSoftware(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	query := `
+		SELECT s.device_id, s.title_id, t.name, t.publisher, s.version, COALESCE(s.install_date, ''),
+		       s.first_seen_at, s.last_seen_at, s.removed_at
+		FROM device_software s
+		JOIN software_titles t ON t.title_id = s.title_id
+		WHERE s.device_id = $1`
+	if !c.QueryBool("include_removed") {
+		query += ` AND s.removed_at IS NULL`
+	}
+	query += ` ORDER BY t.name, s.version_parts`
+
+	rows, err := h.db.Query(c.UserContext(), query, deviceID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query device software"})
+	}
+	defer rows.Close()
+
+	software := []models.DeviceSoftware{}
+	for rows.Next() {
+		var item models.DeviceSoftware
+		err := rows.Scan(&item.DeviceID, &item.TitleID, &item.Name, &item.Publisher, &item.Version,
+			&item.InstallDate, &item.FirstSeenAt, &item.LastSeenAt, &item.RemovedAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan device software"})
+		}
+		software = append(software, item)
+	}
+
+	return c.JSON(fiber.Map{"data": software})
+}
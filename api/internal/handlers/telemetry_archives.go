@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+const telemetryArchiveColumns = `
+	archive_id, partition_name, partition_date::text, bucket, object_key, manifest_key, format,
+	row_count, device_count, size_bytes, sha256, first_collected_at, last_collected_at, archived_at`
+
+// TelemetryArchiveHandler serves the metadata of telemetry partitions the
+// partition manager archived to object storage, so archived days can be
+// located in the bucket
+type TelemetryArchiveHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewTelemetryArchiveHandler(db *pgxpool.Pool) *TelemetryArchiveHandler {
+	return &TelemetryArchiveHandler{db: db}
+}
+
+// GetArchives lists archives newest day first. Query parameters: from and
+// to (YYYY-MM-DD, inclusive) bound the archived day.
+func (h *TelemetryArchiveHandler) GetArchives(c *fiber.Ctx) error {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	where := " WHERE TRUE"
+	var args []interface{}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<="}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": bound.param + " must be a date (YYYY-MM-DD)"})
+		}
+		args = append(args, day)
+		where += " AND partition_date " + bound.op + " $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT`+telemetryArchiveColumns+`
+		FROM telemetry_archives`+where+`
+		ORDER BY partition_date DESC, archive_id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1)+` OFFSET $`+strconv.Itoa(len(args)+2),
+		append(args, limit, offset)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry archives"})
+	}
+	defer rows.Close()
+
+	archives := []models.TelemetryArchive{}
+	for rows.Next() {
+		var a models.TelemetryArchive
+		if err := scanTelemetryArchive(rows, &a); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan telemetry archive"})
+		}
+		archives = append(archives, a)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry archives"})
+	}
+	rows.Close()
+
+	var total int64
+	err = h.db.QueryRow(c.UserContext(), `SELECT COUNT(*) FROM telemetry_archives`+where, args...).Scan(&total)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to get total count"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   archives,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (h *TelemetryArchiveHandler) GetArchive(c *fiber.Ctx) error {
+	archiveID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid archive ID"})
+	}
+
+	var a models.TelemetryArchive
+	row := h.db.QueryRow(c.UserContext(), `
+		SELECT`+telemetryArchiveColumns+`
+		FROM telemetry_archives WHERE archive_id = $1`, archiveID)
+	if err := scanTelemetryArchive(row, &a); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Archive not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": a})
+}
+
+func scanTelemetryArchive(row pgx.Row, a *models.TelemetryArchive) error {
+	return row.Scan(&a.ArchiveID, &a.PartitionName, &a.PartitionDate, &a.Bucket, &a.ObjectKey, &a.ManifestKey,
+		&a.Format, &a.RowCount, &a.DeviceCount, &a.SizeBytes, &a.SHA256,
+		&a.FirstCollectedAt, &a.LastCollectedAt, &a.ArchivedAt)
+}
@@ -0,0 +1,10 @@
+package handlers
+
+import sharedmodels "github.com/yourorg/inventory-agent/shared/models"
+
+// TelemetryPayload and TelemetryBatch are shared with the agent, which
+// uploads them as JSON, msgpack or protobuf
+type (
+	TelemetryPayload = sharedmodels.TelemetryPayload
+	TelemetryBatch   = sharedmodels.TelemetryBatch
+)
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// getTelemetrySeries serves ?resolution=5m|1h|1d&metric=cpu.utilization.
+// Buckets covered by telemetry_rollups are read from there; the rest are
+// aggregated from raw telemetry on the fly.
+func (h *DeviceHandler) getTelemetrySeries(c *fiber.Ctx, deviceID uuid.UUID) error {
+	resolution := c.Query("resolution", "5m")
+	if _, ok := models.SeriesResolutions[resolution]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "resolution must be 5m, 1h or 1d"})
+	}
+
+	if c.Query("metric") == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "metric is required with resolution"})
+	}
+	metric, field, err := models.ParseSeriesMetric(c.Query("metric"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	hours := 24
+	if h := c.Query("hours"); h != "" {
+		if parsed, err := strconv.Atoi(h); err == nil && parsed > 0 && parsed <= models.SeriesMaxHours[resolution] {
+			hours = parsed
+		}
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	buckets, err := h.telemetry.Series(c.UserContext(), deviceID, repository.SeriesQuery{
+		Metric:     metric,
+		Field:      field,
+		Resolution: resolution,
+		Since:      since,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry"})
+	}
+
+	series := models.TelemetrySeries{
+		DeviceID:   deviceID.String(),
+		Metric:     metric,
+		Field:      field,
+		Resolution: resolution,
+		Timestamps: []time.Time{},
+		Avg:        []float64{},
+		Min:        []float64{},
+		Max:        []float64{},
+		Samples:    []int64{},
+	}
+
+	var fromRollup, fromRaw int
+	for _, b := range buckets {
+		if b.Rollup {
+			fromRollup++
+		} else {
+			fromRaw++
+		}
+		series.Timestamps = append(series.Timestamps, b.Bucket)
+		series.Avg = append(series.Avg, b.Avg)
+		series.Min = append(series.Min, b.Min)
+		series.Max = append(series.Max, b.Max)
+		series.Samples = append(series.Samples, b.Samples)
+	}
+
+	switch {
+	case fromRollup > 0 && fromRaw > 0:
+		series.Source = "mixed"
+	case fromRollup > 0:
+		series.Source = "rollup"
+	default:
+		series.Source = "raw"
+	}
+
+	return c.JSON(series)
+}
+
+// GetDeviceMetric serves /devices/:id/metrics/:metric: the raw samples of one
+// metric, or one field of it (memory.usage.used_bytes), extracted from the
+// telemetry documents so charts don't download every other metric too.
+// Samples without the metric are skipped.
+func (h *DeviceHandler) GetDeviceMetric(c *fiber.Ctx) error {
+	deviceID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	metric, field, err := models.ParseMetricPath(c.Params("metric"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	hours := 24
+	if h := c.Query("hours"); h != "" {
+		if parsed, err := strconv.Atoi(h); err == nil && parsed > 0 && parsed <= 168 {
+			hours = parsed
+		}
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	limit := 500
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 5000 {
+			limit = parsed
+		}
+	}
+
+	points, nextCursor, err := h.telemetry.MetricSamples(c.UserContext(), deviceID, repository.MetricQuery{
+		Metric: metric,
+		Field:  field,
+		Since:  since,
+		Cursor: c.Query("cursor"),
+		Limit:  limit,
+	})
+	var queryErr *repository.QueryError
+	if errors.As(err, &queryErr) {
+		return c.Status(400).JSON(fiber.Map{"error": queryErr.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query telemetry"})
+	}
+
+	return c.JSON(fiber.Map{
+		"device_id":   deviceID,
+		"metric":      metric,
+		"field":       field,
+		"data":        points,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/metering"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// UsageHandler serves the metered usage of orgs, summarized per month for
+// chargeback between business units
+type UsageHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewUsageHandler(db *pgxpool.Pool) *UsageHandler {
+	return &UsageHandler{db: db}
+}
+
+// GetUsage summarizes every org's usage in a month. Query parameters:
+// month (YYYY-MM, the current month by default) and org_id.
+func (h *UsageHandler) GetUsage(c *fiber.Ctx) error {
+	month, err := usageMonth(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+
+	var orgID *int64
+	if o := c.Query("org_id"); o != "" {
+		id, err := strconv.ParseInt(o, 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid org ID"})
+		}
+		orgID = &id
+	}
+
+	summaries, err := h.summaries(c.UserContext(), month, orgID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load usage"})
+	}
+
+	return c.JSON(fiber.Map{"data": summaries, "month": month.Format("2006-01")})
+}
+
+// GetOrgUsage returns an org's usage in a month with its daily breakdown
+func (h *UsageHandler) GetOrgUsage(c *fiber.Ctx) error {
+	orgID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid org ID"})
+	}
+
+	month, err := usageMonth(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+
+	ctx := c.UserContext()
+	summaries, err := h.summaries(ctx, month, &orgID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load usage"})
+	}
+	summary := models.UsageSummary{OrgID: orgID, Month: month.Format("2006-01")}
+	if len(summaries) > 0 {
+		summary = summaries[0]
+	}
+
+	rows, err := h.db.Query(ctx, `
+		SELECT day::text, ingested_payloads, ingested_bytes, commands_issued, active_devices, stored_rows
+		FROM usage_metering
+		WHERE org_id = $1 AND day >= $2 AND day < $3
+		ORDER BY day`, orgID, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load usage"})
+	}
+	defer rows.Close()
+
+	summary.Days = []models.UsageDay{}
+	for rows.Next() {
+		var d models.UsageDay
+		err := rows.Scan(&d.Day, &d.IngestedPayloads, &d.IngestedBytes, &d.CommandsIssued, &d.ActiveDevices, &d.StoredRows)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan usage"})
+		}
+		summary.Days = append(summary.Days, d)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load usage"})
+	}
+
+	return c.JSON(fiber.Map{"data": summary})
+}
+
+// summaries adds up the month's daily usage per org, optionally of one org
+func (h *UsageHandler) summaries(ctx context.Context, month time.Time, orgID *int64) ([]models.UsageSummary, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT m.org_id, SUM(m.ingested_payloads)::bigint, SUM(m.ingested_bytes)::bigint,
+		       SUM(m.commands_issued)::bigint, SUM(m.active_devices)::bigint, MAX(m.updated_at),
+		       (SELECT COUNT(DISTINCT d.device_id) FROM usage_active_devices d
+		        WHERE d.org_id = m.org_id AND d.day >= $1 AND d.day < $2),
+		       (SELECT s.stored_rows FROM usage_metering s
+		        WHERE s.org_id = m.org_id AND s.day >= $1 AND s.day < $2 AND s.stored_rows IS NOT NULL
+		        ORDER BY s.day DESC LIMIT 1)
+		FROM usage_metering m
+		WHERE m.day >= $1 AND m.day < $2 AND ($3::bigint IS NULL OR m.org_id = $3)
+		GROUP BY m.org_id
+		ORDER BY m.org_id`, month, month.AddDate(0, 1, 0), orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.UsageSummary{}
+	for rows.Next() {
+		s := models.UsageSummary{Month: month.Format("2006-01")}
+		err := rows.Scan(&s.OrgID, &s.IngestedPayloads, &s.IngestedBytes, &s.CommandsIssued,
+			&s.DeviceDays, &s.UpdatedAt, &s.ActiveDevices, &s.StoredRows)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// usageMonth parses the month query parameter, defaulting to the current
+// UTC month, and returns its first day
+func usageMonth(c *fiber.Ctx) (time.Time, error) {
+	value := c.Query("month")
+	if value == "" {
+		day := metering.Day(time.Now())
+		return day.AddDate(0, 0, 1-day.Day()), nil
+	}
+	return time.Parse("2006-01", value)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+type WebhookHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewWebhookHandler(db *pgxpool.Pool) *WebhookHandler {
+	return &WebhookHandler{db: db}
+}
+
+func (h *WebhookHandler) GetWebhooks(c *fiber.Ctx) error {
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT webhook_id, org_id, url, event_types, enabled, COALESCE(description, ''),
+		       COALESCE(created_by, ''), created_at, updated_at
+		FROM webhooks
+		ORDER BY webhook_id`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query webhooks"})
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		err := rows.Scan(&w.WebhookID, &w.OrgID, &w.URL, &w.EventTypes, &w.Enabled, &w.Description,
+			&w.CreatedBy, &w.CreatedAt, &w.UpdatedAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan webhook"})
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return c.JSON(fiber.Map{"data": webhooks})
+}
+
+func (h *WebhookHandler) GetWebhook(c *fiber.Ctx) error {
+	webhookID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	w, err := loadWebhook(c.UserContext(), h.db, webhookID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Webhook not found"})
+	}
+
+	return c.JSON(fiber.Map{"data": w})
+}
+
+// CreateWebhook registers a subscription. When no secret is supplied one is
+// generated; either way it is returned only in this response.
+func (h *WebhookHandler) CreateWebhook(c *fiber.Ctx) error {
+	var w models.Webhook
+	w.Enabled = true
+	if err := c.BodyParser(&w); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook data"})
+	}
+
+	if err := w.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook: " + err.Error()})
+	}
+
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate webhook secret"})
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+
+	if w.OrgID == 0 {
+		w.OrgID = 1
+	}
+	w.CreatedBy = adminUser(c)
+
+	err := h.db.QueryRow(c.UserContext(), `
+		INSERT INTO webhooks (org_id, url, secret, event_types, enabled, description, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING webhook_id, created_at, updated_at`,
+		w.OrgID, w.URL, w.Secret, w.EventTypes, w.Enabled, w.Description, w.CreatedBy).Scan(
+		&w.WebhookID, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create webhook"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, w.CreatedBy, "create_webhook", "webhook", strconv.FormatInt(w.WebhookID, 10),
+		map[string]interface{}{"url": w.URL, "event_types": w.EventTypes})
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": w})
+}
+
+// UpdateWebhook replaces a webhook's URL, event types, enabled flag and
+// description. A non-empty secret rotates the signing secret.
+func (h *WebhookHandler) UpdateWebhook(c *fiber.Ctx) error {
+	webhookID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	var w models.Webhook
+	w.Enabled = true
+	if err := c.BodyParser(&w); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook data"})
+	}
+
+	if err := w.Validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook: " + err.Error()})
+	}
+
+	err = h.db.QueryRow(c.UserContext(), `
+		UPDATE webhooks
+		SET url = $2, event_types = $3, enabled = $4, description = $5,
+		    secret = COALESCE(NULLIF($6, ''), secret)
+		WHERE webhook_id = $1
+		RETURNING webhook_id, org_id, COALESCE(created_by, ''), created_at, updated_at`,
+		webhookID, w.URL, w.EventTypes, w.Enabled, w.Description, w.Secret).Scan(
+		&w.WebhookID, &w.OrgID, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Webhook not found"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, adminUser(c), "update_webhook", "webhook", strconv.FormatInt(w.WebhookID, 10),
+		map[string]interface{}{"url": w.URL, "event_types": w.EventTypes, "enabled": w.Enabled, "secret_rotated": w.Secret != ""})
+	if err != nil {
+		// Log but don't fail
+	}
+
+	w.Secret = ""
+	return c.JSON(fiber.Map{"data": w})
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *fiber.Ctx) error {
+	webhookID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	result, err := h.db.Exec(c.UserContext(), "DELETE FROM webhooks WHERE webhook_id = $1", webhookID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete webhook"})
+	}
+
+	if result.RowsAffected() == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Webhook not found"})
+	}
+
+	err = audit.Record(c.UserContext(), h.db, adminUser(c), "delete_webhook", "webhook", strconv.FormatInt(webhookID, 10),
+		map[string]interface{}{})
+	if err != nil {
+		// Log but don't fail
+	}
+
+	return c.JSON(fiber.Map{"message": "Webhook deleted"})
+}
+
+// GetWebhookDeliveries lists a webhook's delivery log newest first,
+// optionally narrowed by ?status=pending|succeeded|failed
+func (h *WebhookHandler) GetWebhookDeliveries(c *fiber.Ctx) error {
+	webhookID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid webhook ID"})
+	}
+
+	if _, err := loadWebhook(c.UserContext(), h.db, webhookID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Webhook not found"})
+	}
+
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	where := ` WHERE d.webhook_id = $1`
+	args := []interface{}{webhookID}
+
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		where += ` AND d.status = $` + strconv.Itoa(len(args))
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		cur, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.Int64CursorWhere(cur, "d.created_at", "d.delivery_id", args)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		where += cursorWhere
+	}
+
+	rows, err := h.db.Query(c.UserContext(), `
+		SELECT d.delivery_id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts,
+		       CASE WHEN d.status = 'pending' THEN d.next_attempt_at END,
+		       d.response_status, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d`+where+`
+		ORDER BY d.created_at DESC, d.delivery_id DESC
+		LIMIT $`+strconv.Itoa(len(args)+1),
+		append(args, limit+1)...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to query deliveries"})
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(&d.DeliveryID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to scan delivery"})
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	var nextCursor string
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		last := deliveries[limit-1]
+		nextCursor = database.EncodeCursor(last.CreatedAt, strconv.FormatInt(last.DeliveryID, 10))
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        deliveries,
+		"limit":       limit,
+		"next_cursor": nextCursor,
+	})
+}
+
+func loadWebhook(ctx context.Context, db *pgxpool.Pool, webhookID int64) (*models.Webhook, error) {
+	var w models.Webhook
+	err := db.QueryRow(ctx, `
+		SELECT webhook_id, org_id, url, event_types, enabled, COALESCE(description, ''),
+		       COALESCE(created_by, ''), created_at, updated_at
+		FROM webhooks WHERE webhook_id = $1`, webhookID).Scan(
+		&w.WebhookID, &w.OrgID, &w.URL, &w.EventTypes, &w.Enabled, &w.Description,
+		&w.CreatedBy, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
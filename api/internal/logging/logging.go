@@ -0,0 +1,100 @@
+// Package logging sets up the API's structured logger. Logs are written as
+// JSON lines through log/slog at the configured level. Each request carries
+// a logger with its request ID, correlation ID and route, and the device or
+// admin once authenticated, so handlers log with the request's fields
+// through FromContext.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/yourorg/inventory-agent/api/internal/requestid"
+)
+
+// Init makes a JSON logger at level (debug, info, warn or error, info when
+// unrecognized) the default, including for the standard log package, which
+// libraries still write to
+func Init(level string) {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: ParseLevel(level)})
+	slog.SetDefault(slog.New(handler))
+}
+
+// ParseLevel reads a LOG_LEVEL value
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+type loggerKey struct{}
+
+// FromContext returns the logger of the request ctx belongs to, or the
+// default logger outside a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With returns ctx whose logger adds the given fields
+func With(ctx context.Context, args ...interface{}) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(args...))
+}
+
+// Middleware gives each request a logger with its request and correlation
+// IDs, method and path, and logs the request once it is handled. It must run
+// after requestid.Middleware.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		requestID, correlationID := requestid.FromContext(c.UserContext())
+		args := []interface{}{"request_id", requestID, "method", c.Method(), "path", c.Path()}
+		if correlationID != "" {
+			args = append(args, "correlation_id", correlationID)
+		}
+		c.SetUserContext(With(c.UserContext(), args...))
+
+		err := c.Next()
+
+		// An error returned by the handler becomes the response after this
+		// runs, so take its status instead
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		FromContext(c.UserContext()).Log(c.UserContext(), level, "Request handled",
+			"route", c.Route().Path,
+			"status", status,
+			"latency_ms", time.Since(start).Milliseconds(),
+			"ip", c.IP())
+
+		return err
+	}
+}
+
+// Fatal logs an error and exits, for failures the API can't start without
+func Fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,203 @@
+// Package metering records each org's usage of the service, day by day, in
+// usage_metering for chargeback between business units. The Meter adds up
+// the telemetry an instance accepts; the metering worker fills in what is
+// measured from the database.
+package metering
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Meter counts accepted telemetry per org and day in memory and adds it to
+// usage_metering every flush interval, so ingest doesn't write a shared
+// row per request. Counts not yet flushed when an instance dies are lost.
+type Meter struct {
+	db       *pgxpool.Pool
+	interval time.Duration
+
+	mu      sync.Mutex
+	ingest  map[orgDay]*ingestCounts
+	devices map[deviceDay]bool
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+type orgDay struct {
+	orgID int64
+	day   time.Time
+}
+
+type deviceDay struct {
+	orgDay
+	deviceID uuid.UUID
+}
+
+type ingestCounts struct {
+	payloads int64
+	bytes    int64
+}
+
+func NewMeter(db *pgxpool.Pool, interval time.Duration) *Meter {
+	return &Meter{
+		db:       db,
+		interval: interval,
+		ingest:   make(map[orgDay]*ingestCounts),
+		devices:  make(map[deviceDay]bool),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// RecordIngest counts payloads accepted from a device in a request of size
+// bytes, as sent
+func (m *Meter) RecordIngest(orgID int64, deviceID uuid.UUID, payloads int, size int64) {
+	key := orgDay{orgID: orgID, day: Day(time.Now())}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts, ok := m.ingest[key]
+	if !ok {
+		counts = &ingestCounts{}
+		m.ingest[key] = counts
+	}
+	counts.payloads += int64(payloads)
+	counts.bytes += size
+	m.devices[deviceDay{orgDay: key, deviceID: deviceID}] = true
+}
+
+func (m *Meter) Start(ctx context.Context) error {
+	m.wg.Add(1)
+	go m.run(ctx)
+	slog.Info("Usage meter started")
+	return nil
+}
+
+// Stop flushes what has been counted since the last flush
+func (m *Meter) Stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.flush(ctx); err != nil {
+		slog.Error("Failed to flush usage metering", "error", err)
+	}
+	slog.Info("Usage meter stopped")
+}
+
+func (m *Meter) run(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.flush(ctx); err != nil {
+				slog.Error("Failed to flush usage metering", "error", err)
+			}
+		}
+	}
+}
+
+// flush adds the counts since the last flush to usage_metering and records
+// the devices seen. Counts that fail to flush are kept for the next one.
+func (m *Meter) flush(ctx context.Context) error {
+	m.mu.Lock()
+	ingest, devices := m.ingest, m.devices
+	m.ingest = make(map[orgDay]*ingestCounts)
+	m.devices = make(map[deviceDay]bool)
+	m.mu.Unlock()
+
+	if len(ingest) == 0 {
+		return nil
+	}
+
+	var orgIDs, payloads, bytes []int64
+	var days []time.Time
+	for key, counts := range ingest {
+		orgIDs = append(orgIDs, key.orgID)
+		days = append(days, key.day)
+		payloads = append(payloads, counts.payloads)
+		bytes = append(bytes, counts.bytes)
+	}
+	var deviceOrgs []int64
+	var deviceDays []time.Time
+	var deviceIDs []uuid.UUID
+	for key := range devices {
+		deviceOrgs = append(deviceOrgs, key.orgID)
+		deviceDays = append(deviceDays, key.day)
+		deviceIDs = append(deviceIDs, key.deviceID)
+	}
+
+	err := m.write(ctx, orgIDs, days, payloads, bytes, deviceOrgs, deviceDays, deviceIDs)
+	if err != nil {
+		m.restore(ingest, devices)
+	}
+	return err
+}
+
+func (m *Meter) write(ctx context.Context, orgIDs []int64, days []time.Time, payloads, bytes []int64,
+	deviceOrgs []int64, deviceDays []time.Time, deviceIDs []uuid.UUID) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO usage_metering (org_id, day, ingested_payloads, ingested_bytes)
+		SELECT * FROM unnest($1::bigint[], $2::date[], $3::bigint[], $4::bigint[])
+		ON CONFLICT (org_id, day) DO UPDATE SET
+			ingested_payloads = usage_metering.ingested_payloads + EXCLUDED.ingested_payloads,
+			ingested_bytes = usage_metering.ingested_bytes + EXCLUDED.ingested_bytes,
+			updated_at = NOW()`,
+		orgIDs, days, payloads, bytes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO usage_active_devices (org_id, day, device_id)
+		SELECT * FROM unnest($1::bigint[], $2::date[], $3::uuid[])
+		ON CONFLICT DO NOTHING`,
+		deviceOrgs, deviceDays, deviceIDs)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// restore puts counts that failed to flush back with those counted since
+func (m *Meter) restore(ingest map[orgDay]*ingestCounts, devices map[deviceDay]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, counts := range ingest {
+		if current, ok := m.ingest[key]; ok {
+			current.payloads += counts.payloads
+			current.bytes += counts.bytes
+		} else {
+			m.ingest[key] = counts
+		}
+	}
+	for key := range devices {
+		m.devices[key] = true
+	}
+}
+
+// Day returns the UTC day t falls in, the day usage is metered under
+func Day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -1,35 +1,81 @@
 package models
 
 import (
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	sharedmodels "github.com/yourorg/inventory-agent/shared/models"
 )
 
 type Agent struct {
-	DeviceID       uuid.UUID              `json:"device_id" db:"device_id"`
-	OrgID          int64                  `json:"org_id" db:"org_id"`
-	Hostname       string                 `json:"hostname" db:"hostname"`
-	Status         string                 `json:"status" db:"status"`
-	Capabilities   []Capability           `json:"capabilities" db:"capabilities"`
-	FirstSeenAt    time.Time              `json:"first_seen_at" db:"first_seen_at"`
-	LastSeenAt     time.Time              `json:"last_seen_at" db:"last_seen_at"`
-	AuthTokenHash  string                 `json:"-" db:"auth_token_hash"`
-	AgentVersion   string                 `json:"agent_version" db:"agent_version"`
-	Meta           map[string]interface{} `json:"meta" db:"meta"`
-	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
-	UpdatedAt      time.Time              `json:"updated_at" db:"updated_at"`
+	DeviceID        uuid.UUID              `json:"device_id" db:"device_id"`
+	OrgID           int64                  `json:"org_id" db:"org_id"`
+	Hostname        string                 `json:"hostname" db:"hostname"`
+	Status          string                 `json:"status" db:"status"`
+	LifecycleState  string                 `json:"lifecycle_state" db:"lifecycle_state"`
+	Capabilities    []Capability           `json:"capabilities" db:"capabilities"`
+	FirstSeenAt     time.Time              `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt      time.Time              `json:"last_seen_at" db:"last_seen_at"`
+	AuthTokenHash   string                 `json:"-" db:"auth_token_hash"`
+	AgentVersion    string                 `json:"agent_version" db:"agent_version"`
+	Meta            map[string]interface{} `json:"meta" db:"meta"`
+	Notes           string                 `json:"notes" db:"notes"`
+	CustomFields    map[string]interface{} `json:"custom_fields" db:"custom_fields"`
+	Tags            map[string]string      `json:"tags" db:"-"`
+	Groups          []GroupRef             `json:"groups,omitempty" db:"-"`
+	Health          *DeviceHealth          `json:"health,omitempty" db:"-"`
+	LatestTelemetry *Telemetry             `json:"latest_telemetry,omitempty" db:"-"`
+	PendingCommands []Command              `json:"pending_commands,omitempty" db:"-"`
+	RetiredAt       *time.Time             `json:"retired_at,omitempty" db:"retired_at"`
+	ClockSkewMs     *int64                 `json:"clock_skew_ms,omitempty" db:"clock_skew_ms"`
+	CreatedAt       time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at" db:"updated_at"`
 }
 
-type Capability struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+// Capability is shared with the agent, which registers its capabilities
+type Capability = sharedmodels.Capability
+
+// ValidateTags checks admin-assigned tags against the device_tags limits
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > 50 {
+		return fmt.Errorf("a device cannot have more than 50 tags")
+	}
+
+	for key, value := range tags {
+		if key == "" || len(key) > 128 {
+			return fmt.Errorf("tag keys must be 1-128 characters")
+		}
+		if strings.Contains(key, "=") {
+			return fmt.Errorf("tag key %q cannot contain '='", key)
+		}
+		if len(value) > 256 {
+			return fmt.Errorf("tag %q value cannot exceed 256 characters", key)
+		}
+	}
+
+	return nil
 }
 
 func (a *Agent) IsActive() bool {
 	return a.Status == "active"
 }
 
+func (a *Agent) IsRetired() bool {
+	return a.Status == "retired"
+}
+
+// ReportingStatuses are the statuses a device may report telemetry in.
+// Offline and inactive devices come back online by reporting again.
+var ReportingStatuses = []string{"active", "offline", "inactive"}
+
+// CanReport reports whether the device may report telemetry
+func (a *Agent) CanReport() bool {
+	return slices.Contains(ReportingStatuses, a.Status)
+}
+
 func (a *Agent) HasCapability(name string) bool {
 	for _, cap := range a.Capabilities {
 		if cap.Name == name {
@@ -37,4 +83,15 @@ func (a *Agent) HasCapability(name string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
+
+// DeviceHealth is a device's health score (0-100, higher is healthier) and
+// the signals it was computed from
+type DeviceHealth struct {
+	Score              int      `json:"score"`
+	LastSeenHours      float64  `json:"last_seen_hours"`
+	FailedCommands     int      `json:"failed_commands"`
+	MinDiskFreePercent *float64 `json:"min_disk_free_percent,omitempty"`
+	PatchAgeDays       *int     `json:"patch_age_days,omitempty"`
+	CollectorErrors    int      `json:"collector_errors"`
+}
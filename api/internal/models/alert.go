@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alert rule kinds
+const (
+	// AlertThreshold compares a numeric telemetry field against Threshold.
+	// With PercentOf set the value is Field as a percentage of PercentOf,
+	// e.g. free_bytes of total_bytes. For array metrics such as
+	// disk.utilization the rule fires if any element matches.
+	AlertThreshold = "threshold"
+
+	// AlertAge fires when a timestamp field is more than Threshold hours old,
+	// e.g. antivirus signatures last updated over 168 hours ago
+	AlertAge = "age"
+
+	// AlertNoTelemetry fires when a device hasn't reported for Threshold hours
+	AlertNoTelemetry = "no_telemetry"
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertOperators are the comparisons a threshold rule may use
+var AlertOperators = []string{"<", "<=", ">", ">=", "=", "!="}
+
+// AlertSeverities in increasing order of urgency
+var AlertSeverities = []string{"info", "warning", "critical"}
+
+type AlertRule struct {
+	RuleID      int64     `json:"rule_id" db:"rule_id"`
+	OrgID       int64     `json:"org_id" db:"org_id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Kind        string    `json:"kind" db:"kind"`
+	Metric      string    `json:"metric,omitempty" db:"metric"`
+	Field       string    `json:"field,omitempty" db:"field"`
+	PercentOf   string    `json:"percent_of,omitempty" db:"percent_of"`
+	Operator    string    `json:"operator,omitempty" db:"operator"`
+	Threshold   float64   `json:"threshold" db:"threshold"`
+	Severity    string    `json:"severity" db:"severity"`
+	GroupID     *int64    `json:"group_id,omitempty" db:"group_id"`
+	Enabled     bool      `json:"enabled" db:"enabled"`
+	CreatedBy   string    `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Alert is a rule firing for a device. It stays firing until an evaluation
+// finds the device no longer matches, then becomes resolved.
+type Alert struct {
+	AlertID         int64      `json:"alert_id" db:"alert_id"`
+	RuleID          int64      `json:"rule_id" db:"rule_id"`
+	RuleName        string     `json:"rule_name" db:"rule_name"`
+	Severity        string     `json:"severity" db:"severity"`
+	DeviceID        uuid.UUID  `json:"device_id" db:"device_id"`
+	Hostname        *string    `json:"hostname,omitempty" db:"hostname"`
+	Status          string     `json:"status" db:"status"`
+	Value           *float64   `json:"value,omitempty" db:"value"`
+	FiredAt         time.Time  `json:"fired_at" db:"fired_at"`
+	LastEvaluatedAt time.Time  `json:"last_evaluated_at" db:"last_evaluated_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+	AcknowledgedBy  *string    `json:"acknowledged_by,omitempty" db:"acknowledged_by"`
+	AcknowledgedAt  *time.Time `json:"acknowledged_at,omitempty" db:"acknowledged_at"`
+}
+
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	if !slices.Contains(AlertSeverities, r.Severity) {
+		return fmt.Errorf("invalid severity: %s", r.Severity)
+	}
+
+	switch r.Kind {
+	case AlertThreshold:
+		if r.Metric == "" || r.Field == "" {
+			return fmt.Errorf("threshold rules require metric and field")
+		}
+		if !slices.Contains(AlertOperators, r.Operator) {
+			return fmt.Errorf("invalid operator: %s", r.Operator)
+		}
+	case AlertAge:
+		if r.Metric == "" || r.Field == "" {
+			return fmt.Errorf("age rules require metric and field")
+		}
+		if r.PercentOf != "" || r.Operator != "" {
+			return fmt.Errorf("age rules take no percent_of or operator")
+		}
+		if r.Threshold <= 0 {
+			return fmt.Errorf("threshold must be a positive number of hours")
+		}
+	case AlertNoTelemetry:
+		if r.Metric != "" || r.Field != "" || r.PercentOf != "" || r.Operator != "" {
+			return fmt.Errorf("no_telemetry rules take only a threshold")
+		}
+		if r.Threshold <= 0 {
+			return fmt.Errorf("threshold must be a positive number of hours")
+		}
+	default:
+		return fmt.Errorf("invalid kind: %s", r.Kind)
+	}
+
+	return nil
+}
@@ -1,27 +1,121 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	sharedmodels "github.com/yourorg/inventory-agent/shared/models"
 )
 
+// UninstallCommand removes the agent from its device, which is retired
+// when the agent acks it. It always needs a second admin's approval, and is
+// only issued to devices chosen by ID or group, never by a broadcast filter
+// or on a schedule.
+const UninstallCommand = "agent.uninstall"
+
+// UpgradeCommand installs a release on its device on demand, outside any
+// rollout. Its result's stage follows the rollout statuses: downloading,
+// verifying, then installed or rolled_back.
+const UpgradeCommand = "agent.upgrade"
+
 type Command struct {
-	CommandID   uuid.UUID              `json:"command_id" db:"command_id"`
-	DeviceID    uuid.UUID              `json:"device_id" db:"device_id"`
-	Type        string                 `json:"type" db:"type"`
-	Parameters  map[string]interface{} `json:"parameters" db:"parameters"`
-	IssuedAt    time.Time              `json:"issued_at" db:"issued_at"`
-	TTLSeconds  int                    `json:"ttl_seconds" db:"ttl_seconds"`
-	Status      string                 `json:"status" db:"status"`
-	Result      map[string]interface{} `json:"result" db:"result"`
-	CompletedAt *time.Time             `json:"completed_at" db:"completed_at"`
+	// Command holds the fields agents poll: ID, type, parameters, issue
+	// time, TTL, release time, status, result and completion time
+	sharedmodels.Command
+	DeviceID        uuid.UUID  `json:"device_id" db:"device_id"`
+	BatchID         *uuid.UUID `json:"batch_id,omitempty" db:"batch_id"`
+	ParentCommandID *uuid.UUID `json:"parent_command_id,omitempty" db:"parent_command_id"`
+	RequestedBy     string     `json:"requested_by,omitempty" db:"requested_by"`
+	ReviewedBy      *string    `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	ScheduleID      *int64     `json:"schedule_id,omitempty" db:"schedule_id"`
+}
+
+// CommandBatch records a command fanned out to every device in a target
+type CommandBatch struct {
+	BatchID       uuid.UUID              `json:"batch_id" db:"batch_id"`
+	Type          string                 `json:"type" db:"type"`
+	Parameters    map[string]interface{} `json:"parameters" db:"parameters"`
+	TTLSeconds    int                    `json:"ttl_seconds" db:"ttl_seconds"`
+	TargetType    string                 `json:"target_type" db:"target_type"`
+	TargetGroupID *int64                 `json:"target_group_id,omitempty" db:"target_group_id"`
+	TargetFilter  *DeviceFilter          `json:"target_filter,omitempty" db:"target_filter"`
+	SavedFilterID *int64                 `json:"saved_filter_id,omitempty" db:"saved_filter_id"`
+	RatePerMinute int                    `json:"rate_per_minute" db:"rate_per_minute"`
+	DeviceCount   int                    `json:"device_count" db:"device_count"`
+	// AwaitingApproval is set on a newly created batch whose commands are
+	// held for a second admin
+	AwaitingApproval bool `json:"awaiting_approval,omitempty" db:"-"`
+	// BlockedCount is set on a newly created batch to the number of
+	// targeted devices skipped because their policy doesn't allow the type
+	BlockedCount int       `json:"blocked_count,omitempty" db:"-"`
+	CreatedBy    string    `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// CommandArtifact is command output uploaded apart from the ack, in
+// chunks, because it is too large to ack inline. The ack's result refers to
+// it by ID. It is complete once every chunk is in and they match SHA256.
+type CommandArtifact struct {
+	ArtifactID  uuid.UUID  `json:"artifact_id" db:"artifact_id"`
+	CommandID   uuid.UUID  `json:"command_id" db:"command_id"`
+	Name        string     `json:"name" db:"name"`
+	ContentType string     `json:"content_type" db:"content_type"`
+	SizeBytes   int64      `json:"size_bytes" db:"size_bytes"`
+	SHA256      string     `json:"sha256" db:"sha256"`
+	ChunkSize   int        `json:"chunk_size_bytes" db:"chunk_size"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// Chunks returns how many chunks the artifact is uploaded in; an empty
+// artifact has none
+func (a *CommandArtifact) Chunks() int {
+	return int((a.SizeBytes + int64(a.ChunkSize) - 1) / int64(a.ChunkSize))
+}
+
+// Validate checks an artifact as an agent declares it, before its chunks
+// are uploaded
+func (a *CommandArtifact) Validate(maxBytes int64) error {
+	if a.Name == "" || len(a.Name) > 255 {
+		return fmt.Errorf("name is required and at most 255 characters")
+	}
+	if a.SizeBytes < 0 {
+		return fmt.Errorf("size_bytes must not be negative")
+	}
+	if a.SizeBytes > maxBytes {
+		return fmt.Errorf("size_bytes cannot exceed %d", maxBytes)
+	}
+	if b, err := hex.DecodeString(a.SHA256); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("sha256 must be a hex-encoded SHA-256")
+	}
+	return nil
+}
+
+// CommandBatchRollup aggregates per-device command status for a batch
+type CommandBatchRollup struct {
+	Total            int64 `json:"total"`
+	AwaitingApproval int64 `json:"awaiting_approval"`
+	Pending          int64 `json:"pending"`
+	Executing        int64 `json:"executing"`
+	Completed        int64 `json:"completed"`
+	Failed           int64 `json:"failed"`
+	Expired          int64 `json:"expired"`
+	Cancelled        int64 `json:"cancelled"`
+	Rejected         int64 `json:"rejected"`
+}
+
+// IsAwaitingApproval reports whether the command is held for a second admin
+func (c *Command) IsAwaitingApproval() bool {
+	return c.Status == "awaiting_approval"
 }
 
 func (c *Command) IsExpired() bool {
-	expiration := c.IssuedAt.Add(time.Duration(c.TTLSeconds) * time.Second)
-	return time.Now().After(expiration)
+	// TTL starts when the command is released to the agent
+	return time.Now().After(c.ExpiresAt())
 }
 
 func (c *Command) MarkExecuting() {
@@ -46,11 +140,22 @@ func (c *Command) MarkExpired() {
 	c.Status = "expired"
 }
 
+// IsRetryable reports whether the command ended without succeeding
+func (c *Command) IsRetryable() bool {
+	return c.Status == "failed" || c.Status == "expired"
+}
+
 func (c *Command) Validate() error {
 	if c.DeviceID == uuid.Nil {
 		return fmt.Errorf("device_id is required")
 	}
 
+	return c.ValidateSpec()
+}
+
+// ValidateSpec checks the fields of a command that do not depend on the
+// target device, so batch commands can be validated before fan-out.
+func (c *Command) ValidateSpec() error {
 	if c.Type == "" {
 		return fmt.Errorf("type is required")
 	}
@@ -63,5 +168,70 @@ func (c *Command) Validate() error {
 		return fmt.Errorf("ttl_seconds cannot exceed 3600")
 	}
 
+	if c.NotBefore != nil && c.NotBefore.After(time.Now().AddDate(1, 0, 0)) {
+		return fmt.Errorf("not_before cannot be more than a year ahead")
+	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+// CommandSchedule issues a command to a device or group whenever its cron
+// expression, evaluated in Timezone, comes due
+type CommandSchedule struct {
+	ScheduleID int64                  `json:"schedule_id" db:"schedule_id"`
+	OrgID      int64                  `json:"org_id" db:"org_id"`
+	Name       string                 `json:"name" db:"name"`
+	Type       string                 `json:"type" db:"type"`
+	Parameters map[string]interface{} `json:"parameters" db:"parameters"`
+	TTLSeconds int                    `json:"ttl_seconds" db:"ttl_seconds"`
+	DeviceID   *uuid.UUID             `json:"device_id,omitempty" db:"device_id"`
+	GroupID    *int64                 `json:"group_id,omitempty" db:"group_id"`
+	Cron       string                 `json:"cron" db:"cron"`
+	Timezone   string                 `json:"timezone" db:"timezone"`
+	Enabled    bool                   `json:"enabled" db:"enabled"`
+	NextRunAt  time.Time              `json:"next_run_at" db:"next_run_at"`
+	LastRunAt  *time.Time             `json:"last_run_at,omitempty" db:"last_run_at"`
+	CreatedBy  string                 `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+func (s *CommandSchedule) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if (s.DeviceID == nil) == (s.GroupID == nil) {
+		return fmt.Errorf("exactly one of device_id and group_id is required")
+	}
+
+	if _, err := s.NextRun(time.Now()); err != nil {
+		return err
+	}
+
+	if s.Type == UninstallCommand {
+		return fmt.Errorf("%s can't be scheduled", UninstallCommand)
+	}
+
+	cmd := Command{Command: sharedmodels.Command{Type: s.Type, TTLSeconds: s.TTLSeconds}}
+	return cmd.ValidateSpec()
+}
+
+// NextRun returns the first time after t the schedule comes due
+func (s *CommandSchedule) NextRun(t time.Time) (time.Time, error) {
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron: %w", err)
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+
+	next := cron.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron %q never comes due", s.Cron)
+	}
+	return next, nil
+}
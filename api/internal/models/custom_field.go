@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var customFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// CustomFieldDefinition declares an admin-defined device attribute such as an
+// asset tag or cost center. Values are stored on the device keyed by Key.
+type CustomFieldDefinition struct {
+	Key       string    `json:"key" db:"field_key"`
+	Label     string    `json:"label" db:"label"`
+	Type      string    `json:"type" db:"field_type"` // string, number, boolean or date
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (d *CustomFieldDefinition) Validate() error {
+	if !customFieldKeyPattern.MatchString(d.Key) {
+		return fmt.Errorf("key must be lowercase letters, digits and underscores, starting with a letter")
+	}
+
+	if d.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+
+	switch d.Type {
+	case "string", "number", "boolean", "date":
+	default:
+		return fmt.Errorf("invalid type: %s", d.Type)
+	}
+
+	return nil
+}
+
+// ValidateValue checks a decoded JSON value against the field's type. Dates
+// are YYYY-MM-DD strings.
+func (d *CustomFieldDefinition) ValidateValue(value interface{}) error {
+	switch d.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", d.Key)
+		}
+		if len(s) > 1000 {
+			return fmt.Errorf("%s cannot exceed 1000 characters", d.Key)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s must be a number", d.Key)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", d.Key)
+		}
+	case "date":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a date string", d.Key)
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return fmt.Errorf("%s must be a date in YYYY-MM-DD form", d.Key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SnapshotDiff describes what changed on a device between two inventory
+// snapshots. Utilization figures (CPU, used memory and disk) are ignored;
+// only installed software, hardware identity/capacity and configuration
+// values are compared.
+type SnapshotDiff struct {
+	DeviceID         uuid.UUID               `json:"device_id"`
+	From             time.Time               `json:"from"`
+	To               time.Time               `json:"to"`
+	SoftwareAdded    []SoftwareItem          `json:"software_added"`
+	SoftwareRemoved  []SoftwareItem          `json:"software_removed"`
+	SoftwareUpdated  []SoftwareVersionChange `json:"software_updated"`
+	HardwareChanges  []ValueChange           `json:"hardware_changes"`
+	ConfigChanges    []ValueChange           `json:"config_changes"`
+	SoftwareCompared bool                    `json:"software_compared"`
+}
+
+// SoftwareVersionChange is a title present in both snapshots whose set of
+// installed versions changed from a single version to another
+type SoftwareVersionChange struct {
+	Name        string `json:"name"`
+	Publisher   string `json:"publisher"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+}
+
+// ValueChange is a single field whose value differs. From or To is nil when
+// the field is absent from that snapshot.
+type ValueChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// DiffSnapshots compares the metrics of two snapshots of the same device
+func DiffSnapshots(from, to *Telemetry) *SnapshotDiff {
+	diff := &SnapshotDiff{
+		DeviceID:        to.DeviceID,
+		From:            from.CollectedAt,
+		To:              to.CollectedAt,
+		SoftwareAdded:   []SoftwareItem{},
+		SoftwareRemoved: []SoftwareItem{},
+		SoftwareUpdated: []SoftwareVersionChange{},
+	}
+
+	fromSoftware, okFrom := from.SoftwareInventory()
+	toSoftware, okTo := to.SoftwareInventory()
+	if okFrom && okTo {
+		diff.SoftwareCompared = true
+		diffSoftware(diff, fromSoftware, toSoftware)
+	}
+
+	fromHW, fromConfig := snapshotFields(from)
+	toHW, toConfig := snapshotFields(to)
+	diff.HardwareChanges = diffFields(fromHW, toHW)
+	diff.ConfigChanges = diffFields(fromConfig, toConfig)
+
+	return diff
+}
+
+func diffSoftware(diff *SnapshotDiff, from, to SoftwareInventory) {
+	type key struct{ name, version string }
+	fromSet := make(map[key]SoftwareItem, len(from))
+	for _, item := range from {
+		fromSet[key{strings.ToLower(item.Name), item.Version}] = item
+	}
+	toSet := make(map[key]SoftwareItem, len(to))
+	for _, item := range to {
+		toSet[key{strings.ToLower(item.Name), item.Version}] = item
+	}
+
+	var added, removed []SoftwareItem
+	for k, item := range toSet {
+		if _, ok := fromSet[k]; !ok {
+			added = append(added, item)
+		}
+	}
+	for k, item := range fromSet {
+		if _, ok := toSet[k]; !ok {
+			removed = append(removed, item)
+		}
+	}
+
+	// A title that lost exactly one version and gained exactly one is
+	// reported as an update rather than a remove/add pair
+	byName := func(items []SoftwareItem) map[string][]int {
+		m := make(map[string][]int)
+		for i, item := range items {
+			name := strings.ToLower(item.Name)
+			m[name] = append(m[name], i)
+		}
+		return m
+	}
+	addedByName, removedByName := byName(added), byName(removed)
+	skipAdded, skipRemoved := map[int]bool{}, map[int]bool{}
+	for name, ai := range addedByName {
+		ri := removedByName[name]
+		if len(ai) != 1 || len(ri) != 1 {
+			continue
+		}
+		diff.SoftwareUpdated = append(diff.SoftwareUpdated, SoftwareVersionChange{
+			Name:        added[ai[0]].Name,
+			Publisher:   added[ai[0]].Publisher,
+			FromVersion: removed[ri[0]].Version,
+			ToVersion:   added[ai[0]].Version,
+		})
+		skipAdded[ai[0]], skipRemoved[ri[0]] = true, true
+	}
+
+	for i, item := range added {
+		if !skipAdded[i] {
+			diff.SoftwareAdded = append(diff.SoftwareAdded, item)
+		}
+	}
+	for i, item := range removed {
+		if !skipRemoved[i] {
+			diff.SoftwareRemoved = append(diff.SoftwareRemoved, item)
+		}
+	}
+
+	sortItems := func(items []SoftwareItem) {
+		sort.Slice(items, func(i, j int) bool {
+			if !strings.EqualFold(items[i].Name, items[j].Name) {
+				return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+			}
+			return items[i].Version < items[j].Version
+		})
+	}
+	sortItems(diff.SoftwareAdded)
+	sortItems(diff.SoftwareRemoved)
+	sort.Slice(diff.SoftwareUpdated, func(i, j int) bool {
+		return strings.ToLower(diff.SoftwareUpdated[i].Name) < strings.ToLower(diff.SoftwareUpdated[j].Name)
+	})
+}
+
+// snapshotFields flattens the comparable fields of a snapshot into
+// hardware and configuration values keyed by dotted path
+func snapshotFields(t *Telemetry) (map[string]interface{}, map[string]interface{}) {
+	hardware := map[string]interface{}{}
+	config := map[string]interface{}{}
+
+	var osInfo OSInfo
+	if decodeMetric(t.Metrics["os.info"], &osInfo) {
+		hardware["os.info.make"] = osInfo.Make
+		hardware["os.info.model"] = osInfo.Model
+		hardware["os.info.serial"] = osInfo.Serial
+		config["os.info.caption"] = osInfo.Caption
+		config["os.info.version"] = osInfo.Version
+		config["os.info.hostname"] = osInfo.Hostname
+		config["os.info.domain"] = osInfo.Domain
+		config["os.info.last_user"] = osInfo.LastUser
+	}
+
+	var memory MemoryUsage
+	if decodeMetric(t.Metrics["memory.usage"], &memory) {
+		hardware["memory.usage.total_bytes"] = memory.TotalBytes
+	}
+
+	// disk.utilization is an object for a single disk or an array
+	var disks []DiskUtilization
+	if !decodeMetric(t.Metrics["disk.utilization"], &disks) {
+		var disk DiskUtilization
+		if decodeMetric(t.Metrics["disk.utilization"], &disk) {
+			disks = []DiskUtilization{disk}
+		}
+	}
+	for _, disk := range disks {
+		hardware["disk.utilization."+disk.Name+".total_bytes"] = disk.TotalBytes
+	}
+
+	return hardware, config
+}
+
+func decodeMetric(raw interface{}, target interface{}) bool {
+	if raw == nil {
+		return false
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, target) == nil
+}
+
+func diffFields(from, to map[string]interface{}) []ValueChange {
+	changes := []ValueChange{}
+	for path, toValue := range to {
+		if fromValue, ok := from[path]; !ok || fromValue != toValue {
+			changes = append(changes, ValueChange{Path: path, From: from[path], To: toValue})
+		}
+	}
+	for path, fromValue := range from {
+		if _, ok := to[path]; !ok {
+			changes = append(changes, ValueChange{Path: path, From: fromValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
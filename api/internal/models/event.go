@@ -0,0 +1,111 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published on the events stream
+const (
+	EventDeviceRegistered = "device.registered"
+	EventDeviceOnline     = "device.online"
+	EventDeviceOffline    = "device.offline"
+	EventDeviceInactive   = "device.inactive"
+	EventCommandStatus    = "command.status"
+	EventCommandCompleted = "command.completed"
+	EventCommandProgress  = "command.progress"
+	EventPolicyUpdated    = "policy.updated"
+	EventAlertFiring      = "alert.firing"
+	EventAlertResolved    = "alert.resolved"
+)
+
+// EventTypes lists every event type, for validating subscriptions
+var EventTypes = []string{
+	EventDeviceRegistered,
+	EventDeviceOnline,
+	EventDeviceOffline,
+	EventDeviceInactive,
+	EventCommandStatus,
+	EventCommandCompleted,
+	EventCommandProgress,
+	EventPolicyUpdated,
+	EventAlertFiring,
+	EventAlertResolved,
+}
+
+// Event is a state change pushed to live admin clients
+type Event struct {
+	Type     string                 `json:"type"`
+	Time     time.Time              `json:"time"`
+	DeviceID *uuid.UUID             `json:"device_id,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// DeviceEvent builds an event about a single device
+func DeviceEvent(eventType string, deviceID uuid.UUID, data map[string]interface{}) Event {
+	return Event{Type: eventType, Time: time.Now().UTC(), DeviceID: &deviceID, Data: data}
+}
+
+// CommandStatusEvent reports a command moving to a new status
+func CommandStatusEvent(commandID, deviceID uuid.UUID, status string) Event {
+	return DeviceEvent(EventCommandStatus, deviceID, map[string]interface{}{
+		"command_id": commandID.String(),
+		"status":     status,
+	})
+}
+
+// CommandCompletedEvent reports an agent acknowledging a command, with its
+// final status (completed or failed) and result
+func CommandCompletedEvent(commandID, deviceID uuid.UUID, commandType, status string, result map[string]interface{}) Event {
+	return DeviceEvent(EventCommandCompleted, deviceID, map[string]interface{}{
+		"command_id": commandID.String(),
+		"type":       commandType,
+		"status":     status,
+		"result":     result,
+	})
+}
+
+// CommandProgressEvent reports a running command's partial result, such as
+// the stage an upgrade has reached
+func CommandProgressEvent(commandID, deviceID uuid.UUID, commandType string, result map[string]interface{}) Event {
+	return DeviceEvent(EventCommandProgress, deviceID, map[string]interface{}{
+		"command_id": commandID.String(),
+		"type":       commandType,
+		"result":     result,
+	})
+}
+
+// PolicyUpdatedEvent reports a policy being created, updated or deleted
+func PolicyUpdatedEvent(src PolicySource, action string) Event {
+	data := map[string]interface{}{
+		"policy_id": src.PolicyID,
+		"scope":     src.Scope,
+		"version":   src.Version,
+		"action":    action,
+	}
+	if src.GroupID != nil {
+		data["group_id"] = *src.GroupID
+	}
+	return Event{Type: EventPolicyUpdated, Time: time.Now().UTC(), DeviceID: src.DeviceID, Data: data}
+}
+
+// AlertEvent reports an alert firing or resolving
+func AlertEvent(alert Alert) Event {
+	eventType := EventAlertFiring
+	if alert.Status == AlertResolved {
+		eventType = EventAlertResolved
+	}
+
+	data := map[string]interface{}{
+		"alert_id":  alert.AlertID,
+		"rule_id":   alert.RuleID,
+		"rule_name": alert.RuleName,
+		"severity":  alert.Severity,
+		"fired_at":  alert.FiredAt,
+	}
+	if alert.Value != nil {
+		data["value"] = *alert.Value
+	}
+	return DeviceEvent(eventType, alert.DeviceID, data)
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExpectedDeviceExpected = "expected"
+	ExpectedDeviceLinked   = "linked"
+)
+
+// MaxExpectedDeviceImport bounds the rows accepted by one import
+const MaxExpectedDeviceImport = 10000
+
+// ExpectedDevice is a device known from procurement data before its agent
+// registers. It is linked to the registered device with the same serial
+// number, or failing that the same hostname.
+type ExpectedDevice struct {
+	ExpectedID   int64      `json:"expected_id" db:"expected_id"`
+	OrgID        int64      `json:"org_id" db:"org_id"`
+	Hostname     *string    `json:"hostname" db:"hostname"`
+	SerialNumber *string    `json:"serial_number" db:"serial_number"`
+	Owner        *string    `json:"owner" db:"owner"`
+	Site         *string    `json:"site" db:"site"`
+	Status       string     `json:"status" db:"status"`
+	DeviceID     *uuid.UUID `json:"device_id,omitempty" db:"device_id"`
+	LinkedAt     *time.Time `json:"linked_at,omitempty" db:"linked_at"`
+	ImportedBy   string     `json:"imported_by,omitempty" db:"imported_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Normalize trims the imported fields, turning blank ones into nil
+func (d *ExpectedDevice) Normalize() {
+	for _, field := range []**string{&d.Hostname, &d.SerialNumber, &d.Owner, &d.Site} {
+		if *field == nil {
+			continue
+		}
+		if value := strings.TrimSpace(**field); value != "" {
+			*field = &value
+		} else {
+			*field = nil
+		}
+	}
+}
+
+func (d *ExpectedDevice) Validate() error {
+	if d.Hostname == nil && d.SerialNumber == nil {
+		return fmt.Errorf("hostname or serial_number is required")
+	}
+	return nil
+}
+
+// ExpectedDeviceImportError reports a row of an import that was skipped.
+// Rows are numbered from 1, excluding a CSV header.
+type ExpectedDeviceImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ExpectedDeviceImport summarizes an import
+type ExpectedDeviceImport struct {
+	Created int                         `json:"created"`
+	Updated int                         `json:"updated"`
+	Linked  int                         `json:"linked"`
+	Errors  []ExpectedDeviceImportError `json:"errors"`
+}
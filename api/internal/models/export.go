@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// ExportJob is an asynchronous export of one of the list endpoints to a
+// downloadable file. Params holds the list endpoint's query parameters.
+type ExportJob struct {
+	JobID       uuid.UUID           `json:"job_id" db:"job_id"`
+	Kind        string              `json:"kind" db:"kind"`
+	Format      string              `json:"format" db:"format"`
+	Params      map[string][]string `json:"params" db:"params"`
+	Status      string              `json:"status" db:"status"`
+	RowCount    *int64              `json:"row_count,omitempty" db:"row_count"`
+	Error       *string             `json:"error,omitempty" db:"error"`
+	CreatedBy   string              `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time           `json:"created_at" db:"created_at"`
+	StartedAt   *time.Time          `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt   *time.Time          `json:"expires_at,omitempty" db:"expires_at"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeviceFilter selects devices by server-known attributes
+type DeviceFilter struct {
+	Status                 string `json:"status,omitempty"`
+	Lifecycle              string `json:"lifecycle,omitempty"`
+	Tag                    string `json:"tag,omitempty"`        // key=value, matched against reported tags
+	AdminTag               string `json:"admin_tag,omitempty"`  // key=value, matched against admin-assigned tags
+	OSVersion              string `json:"os_version,omitempty"` // prefix match on os.info version
+	OSCaption              string `json:"os_caption,omitempty"` // substring match on os.info caption, e.g. "Windows 10"
+	Hostname               string `json:"hostname,omitempty"`   // glob pattern, * matches any run of characters
+	LastSeenOlderThanHours int    `json:"last_seen_older_than_hours,omitempty"`
+	LastSeenWithinHours    int    `json:"last_seen_within_hours,omitempty"`
+	// Latest telemetry thresholds, in percent: any disk with less free
+	// space, CPU or memory use above
+	DiskFreeBelowPercent float64 `json:"disk_free_below_percent,omitempty"`
+	CPUAbovePercent      float64 `json:"cpu_above_percent,omitempty"`
+	MemoryAbovePercent   float64 `json:"memory_above_percent,omitempty"`
+}
+
+func (f *DeviceFilter) Validate() error {
+	if f.Status != "" && f.Status != "active" && f.Status != "inactive" && f.Status != "offline" {
+		return fmt.Errorf("invalid status: %s", f.Status)
+	}
+
+	if f.Lifecycle != "" && !IsLifecycleState(f.Lifecycle) {
+		return fmt.Errorf("invalid lifecycle state: %s", f.Lifecycle)
+	}
+
+	if f.Tag != "" && !strings.Contains(f.Tag, "=") {
+		return fmt.Errorf("tag must be in key=value form")
+	}
+
+	if f.AdminTag != "" && !strings.Contains(f.AdminTag, "=") {
+		return fmt.Errorf("admin_tag must be in key=value form")
+	}
+
+	if f.LastSeenOlderThanHours < 0 || f.LastSeenWithinHours < 0 {
+		return fmt.Errorf("last seen hours must be non-negative")
+	}
+
+	for _, percent := range []float64{f.DiskFreeBelowPercent, f.CPUAbovePercent, f.MemoryAbovePercent} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("metric thresholds must be between 0 and 100")
+		}
+	}
+
+	return nil
+}
+
+// IsEmpty reports whether the filter matches the whole fleet
+func (f *DeviceFilter) IsEmpty() bool {
+	return *f == DeviceFilter{}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type DeviceGroup struct {
+	GroupID     int64     `json:"group_id" db:"group_id"`
+	OrgID       int64     `json:"org_id" db:"org_id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	DeviceCount int64     `json:"device_count" db:"-"`
+	CreatedBy   string    `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+
+	// FilterID makes this a smart group whose members are the devices
+	// matching the saved filter, refreshed on a schedule
+	FilterID        *int64     `json:"filter_id,omitempty" db:"filter_id"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty" db:"last_evaluated_at"`
+}
+
+// GroupRef is the compact form of a group surfaced on device records
+type GroupRef struct {
+	GroupID int64  `json:"group_id"`
+	Name    string `json:"name"`
+}
+
+func (g *DeviceGroup) IsSmart() bool {
+	return g.FilterID != nil
+}
+
+func (g *DeviceGroup) Validate() error {
+	if g.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if len(g.Name) > 200 {
+		return fmt.Errorf("name cannot exceed 200 characters")
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scopes an ingest quota applies to: one device, whose token sends the
+// telemetry, or every device of an org together
+const (
+	QuotaScopeDevice = "device"
+	QuotaScopeOrg    = "org"
+)
+
+// IngestQuota overrides the server's default ingest quotas for one device
+// or org. A nil field keeps the default and 0 lifts the limit.
+type IngestQuota struct {
+	Scope           string     `json:"scope" db:"scope"`
+	ScopeID         string     `json:"scope_id" db:"scope_id"`
+	PayloadsPerHour *int64     `json:"payloads_per_hour" db:"payloads_per_hour"`
+	BytesPerDay     *int64     `json:"bytes_per_day" db:"bytes_per_day"`
+	UpdatedBy       string     `json:"updated_by,omitempty" db:"updated_by"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+func (q *IngestQuota) Validate() error {
+	if q.PayloadsPerHour != nil && *q.PayloadsPerHour < 0 {
+		return fmt.Errorf("payloads_per_hour must be non-negative")
+	}
+	if q.BytesPerDay != nil && *q.BytesPerDay < 0 {
+		return fmt.Errorf("bytes_per_day must be non-negative")
+	}
+	return nil
+}
+
+// IngestUsage is what a device or org has sent in the current quota
+// windows: the clock hour for payloads and the UTC day for bytes
+type IngestUsage struct {
+	PayloadsThisHour int64     `json:"payloads_this_hour"`
+	BytesToday       int64     `json:"bytes_today"`
+	HourResetsAt     time.Time `json:"hour_resets_at"`
+	DayResetsAt      time.Time `json:"day_resets_at"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// License is a purchased entitlement for a software product. Installs are
+// matched by NamePattern, a glob over software title names, and optionally
+// by publisher.
+type License struct {
+	LicenseID   int64     `json:"license_id" db:"license_id"`
+	OrgID       int64     `json:"org_id" db:"org_id"`
+	Product     string    `json:"product" db:"product"`
+	NamePattern string    `json:"name_pattern" db:"name_pattern"`
+	Publisher   string    `json:"publisher" db:"publisher"`
+	Seats       int       `json:"seats" db:"seats"`
+	Notes       string    `json:"notes" db:"notes"`
+	CreatedBy   string    `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// LicenseCompliance compares an entitlement against installed devices
+type LicenseCompliance struct {
+	License       License `json:"license"`
+	Installed     int64   `json:"installed"`
+	Available     int64   `json:"available"`
+	Status        string  `json:"status"` // compliant or over_deployed
+	MatchedTitles int64   `json:"matched_titles"`
+}
+
+func (l *License) Validate() error {
+	if l.Product == "" {
+		return fmt.Errorf("product is required")
+	}
+
+	if l.NamePattern == "" {
+		return fmt.Errorf("name_pattern is required")
+	}
+
+	if l.Seats < 0 {
+		return fmt.Errorf("seats must be non-negative")
+	}
+
+	return nil
+}
+
+// Compliance evaluates the entitlement against an installed device count
+func (l *License) Compliance(installed, matchedTitles int64) LicenseCompliance {
+	status := "compliant"
+	if installed > int64(l.Seats) {
+		status = "over_deployed"
+	}
+
+	return LicenseCompliance{
+		License:       *l,
+		Installed:     installed,
+		Available:     int64(l.Seats) - installed,
+		Status:        status,
+		MatchedTitles: matchedTitles,
+	}
+}
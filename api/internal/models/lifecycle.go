@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Device lifecycle states. A device is enrolled when its agent registers,
+// active once it has reported telemetry, and quarantined by an admin to
+// withhold commands from it. Retired is final. A device's status only
+// reports connectivity, except that it is retired exactly when its
+// lifecycle state is, as the database enforces.
+const (
+	LifecycleEnrolled    = "enrolled"
+	LifecycleActive      = "active"
+	LifecycleQuarantined = "quarantined"
+	LifecycleRetired     = "retired"
+)
+
+// LifecycleStates lists the lifecycle states in order
+var LifecycleStates = []string{LifecycleEnrolled, LifecycleActive, LifecycleQuarantined, LifecycleRetired}
+
+// lifecycleTransitions maps each state to the states a device may move to
+// from it
+var lifecycleTransitions = map[string][]string{
+	LifecycleEnrolled:    {LifecycleActive, LifecycleQuarantined, LifecycleRetired},
+	LifecycleActive:      {LifecycleQuarantined, LifecycleRetired},
+	LifecycleQuarantined: {LifecycleActive, LifecycleRetired},
+}
+
+// CanTransition reports whether a device may move from one lifecycle state
+// to another
+func CanTransition(from, to string) bool {
+	for _, next := range lifecycleTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LifecycleSources returns the states a device may move to the given state
+// from
+func LifecycleSources(to string) []string {
+	sources := []string{}
+	for _, from := range LifecycleStates {
+		if CanTransition(from, to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
+
+// IsLifecycleState reports whether s is a lifecycle state
+func IsLifecycleState(s string) bool {
+	for _, state := range LifecycleStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// LifecycleTransition is one recorded change of a device's lifecycle state.
+// FromState is empty for the transition that enrolled the device.
+type LifecycleTransition struct {
+	TransitionID   int64     `json:"transition_id" db:"transition_id"`
+	DeviceID       uuid.UUID `json:"device_id" db:"device_id"`
+	FromState      string    `json:"from_state,omitempty" db:"from_state"`
+	ToState        string    `json:"to_state" db:"to_state"`
+	Actor          string    `json:"actor,omitempty" db:"actor"`
+	Reason         string    `json:"reason,omitempty" db:"reason"`
+	TransitionedAt time.Time `json:"transitioned_at" db:"transitioned_at"`
+}
+
+// LifecycleRequest is an admin's request to move a device to another
+// lifecycle state
+type LifecycleRequest struct {
+	State  string `json:"state"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Live device update types
+const (
+	LiveSnapshot = "snapshot"
+	LivePresence = "presence"
+	LiveMetrics  = "metrics"
+)
+
+// DeviceLiveStatus is a device's presence and latest key metrics
+type DeviceLiveStatus struct {
+	DeviceID    uuid.UUID          `json:"device_id"`
+	Hostname    string             `json:"hostname,omitempty"`
+	Status      string             `json:"status,omitempty"`
+	CollectedAt *time.Time         `json:"collected_at,omitempty"`
+	Metrics     map[string]float64 `json:"metrics,omitempty"`
+}
+
+// LiveUpdate is a message on the live device status channel. Snapshots
+// carry Devices; presence and metrics updates carry a single Device.
+type LiveUpdate struct {
+	Type    string             `json:"type"`
+	Time    time.Time          `json:"time"`
+	Device  *DeviceLiveStatus  `json:"device,omitempty"`
+	Devices []DeviceLiveStatus `json:"devices,omitempty"`
+}
+
+// KeyMetrics picks the default field of each charted metric out of a
+// telemetry payload, keyed by metric name as in the series API
+func KeyMetrics(metrics map[string]interface{}) map[string]float64 {
+	out := make(map[string]float64)
+	for metric, field := range SeriesMetrics {
+		values, ok := metrics[metric].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := values[field].(float64); ok {
+			out[metric] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrgSettings holds per-org overrides of server-wide defaults. A nil field
+// falls back to the server's configured default.
+type OrgSettings struct {
+	OrgID int64 `json:"org_id" db:"org_id"`
+
+	// StaleDeviceDays retires devices unseen for this many days; 0 turns
+	// automatic retirement off for the org
+	StaleDeviceDays *int `json:"stale_device_days" db:"stale_device_days"`
+
+	// PurgeStaleDevices also deletes the telemetry and records of devices
+	// retired for being stale
+	PurgeStaleDevices bool `json:"purge_stale_devices" db:"purge_stale_devices"`
+
+	// Retention in days of raw telemetry, hourly and daily rollups, and
+	// removed software installs
+	TelemetryRetentionDays       *int `json:"telemetry_retention_days" db:"telemetry_retention_days"`
+	RollupRetentionDays          *int `json:"rollup_retention_days" db:"rollup_retention_days"`
+	SoftwareHistoryRetentionDays *int `json:"software_history_retention_days" db:"software_history_retention_days"`
+
+	UpdatedBy string     `json:"updated_by,omitempty" db:"updated_by"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+func (s *OrgSettings) Validate() error {
+	if s.StaleDeviceDays != nil && *s.StaleDeviceDays < 0 {
+		return fmt.Errorf("stale_device_days must be non-negative")
+	}
+
+	for name, days := range map[string]*int{
+		"telemetry_retention_days":        s.TelemetryRetentionDays,
+		"rollup_retention_days":           s.RollupRetentionDays,
+		"software_history_retention_days": s.SoftwareHistoryRetentionDays,
+	} {
+		if days != nil && *days <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+
+	return nil
+}
+
+// StaleDevice is a device retired by the stale device cleanup
+type StaleDevice struct {
+	DeviceID   uuid.UUID `json:"device_id"`
+	Hostname   *string   `json:"hostname,omitempty"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// StaleDeviceRun summarizes one org's stale device cleanup
+type StaleDeviceRun struct {
+	RunID           int64         `json:"run_id" db:"run_id"`
+	OrgID           int64         `json:"org_id" db:"org_id"`
+	StaleDeviceDays int           `json:"stale_device_days" db:"stale_device_days"`
+	Purge           bool          `json:"purge" db:"purge"`
+	DevicesRetired  int           `json:"devices_retired" db:"devices_retired"`
+	Devices         []StaleDevice `json:"devices" db:"devices"`
+	RanAt           time.Time     `json:"ran_at" db:"ran_at"`
+}
@@ -2,31 +2,115 @@ package models
 
 import (
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	sharedmodels "github.com/yourorg/inventory-agent/shared/models"
 )
 
 type Policy struct {
-	PolicyID   int64                  `json:"policy_id" db:"policy_id"`
-	DeviceID   *uuid.UUID             `json:"device_id,omitempty" db:"device_id"`
-	GroupID    *int64                 `json:"group_id,omitempty" db:"group_id"`
-	Scope      string                 `json:"scope" db:"scope"`
-	Version    int                    `json:"version" db:"version"`
-	Config     PolicyConfig           `json:"config" db:"config"`
-	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
-	CreatedBy  string                 `json:"created_by" db:"created_by"`
-	UpdatedAt  time.Time              `json:"updated_at" db:"updated_at"`
+	PolicyID int64      `json:"policy_id" db:"policy_id"`
+	DeviceID *uuid.UUID `json:"device_id,omitempty" db:"device_id"`
+	GroupID  *int64     `json:"group_id,omitempty" db:"group_id"`
+	Scope    string     `json:"scope" db:"scope"`
+	// Policy holds the version and config, as agents are served them
+	sharedmodels.Policy
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// EffectiveAt is when Config takes effect. Until then agents are
+	// served PreviousConfig at the previous version, or nothing for a new
+	// policy.
+	EffectiveAt    *time.Time    `json:"effective_at,omitempty" db:"effective_at"`
+	PreviousConfig *PolicyConfig `json:"previous_config,omitempty" db:"previous_config"`
 }
 
-type PolicyConfig struct {
-	IntervalSeconds int                    `json:"interval_seconds"`
-	Metrics         map[string]MetricConfig `json:"metrics"`
+// PolicyConfig and MetricConfig are shared with the agent, which decodes
+// them from the policy endpoint
+type (
+	PolicyConfig = sharedmodels.PolicyConfig
+	MetricConfig = sharedmodels.MetricConfig
+)
+
+// PolicyStatusReport is an agent's report of applying its policy, shared
+// with the agent
+type (
+	PolicyStatusReport = sharedmodels.PolicyStatus
+	SettingStatus      = sharedmodels.SettingStatus
+)
+
+// maxPolicyStatusSettings caps the settings one report may carry
+const maxPolicyStatusSettings = 1000
+
+// ValidatePolicyStatus checks an agent's policy status report
+func ValidatePolicyStatus(r *PolicyStatusReport) error {
+	if r.Version < 1 {
+		return fmt.Errorf("version is required")
+	}
+	if r.AppliedAt.IsZero() {
+		return fmt.Errorf("applied_at is required")
+	}
+	if len(r.Settings)+len(r.UnsupportedMetrics) > maxPolicyStatusSettings {
+		return fmt.Errorf("at most %d settings and unsupported metrics may be reported", maxPolicyStatusSettings)
+	}
+	for name := range r.Settings {
+		if name == "" {
+			return fmt.Errorf("setting names cannot be empty")
+		}
+	}
+	return nil
+}
+
+// DevicePolicyStatus is the latest report of a device applying its policy.
+// It converged if it applied the policy it was due, ExpectedVersion, with
+// no failed settings; metrics it has no collector for don't count against
+// it.
+type DevicePolicyStatus struct {
+	DeviceID           uuid.UUID                `json:"device_id"`
+	Hostname           string                   `json:"hostname"`
+	PolicyVersion      int                      `json:"policy_version"`
+	ExpectedVersion    int                      `json:"expected_version"`
+	Converged          bool                     `json:"converged"`
+	Settings           map[string]SettingStatus `json:"settings"`
+	FailedSettings     []string                 `json:"failed_settings"`
+	UnsupportedMetrics []string                 `json:"unsupported_metrics"`
+	AppliedAt          time.Time                `json:"applied_at"`
+	ReportedAt         time.Time                `json:"reported_at"`
+}
+
+// PolicySource identifies the policy a setting was taken from
+type PolicySource struct {
+	PolicyID int64      `json:"policy_id,omitempty"`
+	Scope    string     `json:"scope"`
+	Version  int        `json:"version"`
+	GroupID  *int64     `json:"group_id,omitempty"`
+	DeviceID *uuid.UUID `json:"device_id,omitempty"`
+}
+
+// DefaultPolicy is served when no stored policy applies to a device
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Scope: "default",
+		Policy: sharedmodels.Policy{
+			Version: 1,
+			Config: PolicyConfig{
+				IntervalSeconds: 900, // 15 minutes
+				Metrics:         map[string]MetricConfig{},
+			},
+		},
+	}
 }
 
-type MetricConfig struct {
-	Enabled bool `json:"enabled"`
+func (p *Policy) Source() PolicySource {
+	return PolicySource{
+		PolicyID: p.PolicyID,
+		Scope:    p.Scope,
+		Version:  p.Version,
+		GroupID:  p.GroupID,
+		DeviceID: p.DeviceID,
+	}
 }
 
 func (p *Policy) Validate() error {
@@ -46,21 +130,42 @@ func (p *Policy) Validate() error {
 		return fmt.Errorf("interval_seconds must be between 60 and 3600")
 	}
 
+	return p.ValidateEffectiveAt()
+}
+
+// ValidateEffectiveAt rejects changes staged more than a year ahead
+func (p *Policy) ValidateEffectiveAt() error {
+	if p.EffectiveAt != nil && p.EffectiveAt.After(time.Now().AddDate(1, 0, 0)) {
+		return fmt.Errorf("effective_at cannot be more than a year ahead")
+	}
 	return nil
 }
 
+// GenerateETag identifies the policy as served to a device. Its metrics are
+// included because FilterByCapabilities serves one policy version
+// differently to agents whose collectors differ, and an agent whose
+// collectors are upgraded must not be told its old copy is current.
 func (p *Policy) GenerateETag() string {
-	data := fmt.Sprintf("%d-%s-%d", p.PolicyID, p.Scope, p.Version)
+	metrics, _ := json.Marshal(p.Config.Metrics)
+	data := fmt.Sprintf("%d-%s-%d-%s", p.PolicyID, p.Scope, p.Version, metrics)
 	hash := md5.Sum([]byte(data))
 	return fmt.Sprintf(`"%x"`, hash)
 }
 
-func (p *Policy) MatchesDevice(deviceID uuid.UUID, groupID int64) bool {
+func (p *Policy) MatchesDevice(deviceID uuid.UUID, groupIDs []int64) bool {
 	switch p.Scope {
 	case "global":
 		return true
 	case "group":
-		return p.GroupID != nil && *p.GroupID == groupID
+		if p.GroupID == nil {
+			return false
+		}
+		for _, groupID := range groupIDs {
+			if *p.GroupID == groupID {
+				return true
+			}
+		}
+		return false
 	case "device":
 		return p.DeviceID != nil && *p.DeviceID == deviceID
 	default:
@@ -69,13 +174,14 @@ func (p *Policy) MatchesDevice(deviceID uuid.UUID, groupID int64) bool {
 }
 
 // ResolveEffectivePolicy returns the effective policy for a device
-// Priority: device > group > global
-func ResolveEffectivePolicy(policies []Policy, deviceID uuid.UUID, groupID int64) *Policy {
+// Priority: device > group > global. When a device belongs to several
+// groups, the highest-versioned group policy wins.
+func ResolveEffectivePolicy(policies []Policy, deviceID uuid.UUID, groupIDs []int64) *Policy {
 	var global, group, device *Policy
 
 	for i := range policies {
 		p := &policies[i]
-		if !p.MatchesDevice(deviceID, groupID) {
+		if !p.MatchesDevice(deviceID, groupIDs) {
 			continue
 		}
 
@@ -105,20 +211,39 @@ func ResolveEffectivePolicy(policies []Policy, deviceID uuid.UUID, groupID int64
 	return global
 }
 
-// FilterByCapabilities removes metrics not supported by the agent
+// FilterByCapabilities removes the metrics the agent doesn't collect or
+// whose collector is older than the metric's min_version, and the features
+// of the remaining metrics that its collectors are too old for
 func (p *Policy) FilterByCapabilities(capabilities []Capability) {
 	if p.Config.Metrics == nil {
 		return
 	}
 
-	supported := make(map[string]bool)
+	supported := make(map[string]Capability)
 	for _, cap := range capabilities {
-		supported[cap.Name] = true
+		supported[cap.Name] = cap
 	}
 
-	for metric := range p.Config.Metrics {
-		if !supported[metric] {
+	for metric, config := range p.Config.Metrics {
+		cap, ok := supported[metric]
+		if !ok || !cap.Supports(config.MinVersion) {
 			delete(p.Config.Metrics, metric)
+			continue
+		}
+		if len(config.Features) == 0 {
+			continue
+		}
+
+		features := make(map[string]string)
+		for feature, version := range config.Features {
+			if cap.Supports(version) {
+				features[feature] = version
+			}
 		}
+		if len(features) == 0 {
+			features = nil
+		}
+		config.Features = features
+		p.Config.Metrics[metric] = config
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RolloutActive    = "active"
+	RolloutPaused    = "paused"
+	RolloutCompleted = "completed"
+	RolloutCancelled = "cancelled"
+)
+
+// Upgrade statuses of a device in a rollout. The server records offered
+// when it hands out the manifest; the agent reports the rest.
+const (
+	UpgradeOffered     = "offered"
+	UpgradeDownloading = "downloading"
+	UpgradeVerifying   = "verifying"
+	UpgradeInstalled   = "installed"
+	UpgradeFailed      = "failed"
+	UpgradeRolledBack  = "rolled_back"
+)
+
+// UpgradeReportStatuses are the statuses an agent may report
+var UpgradeReportStatuses = []string{UpgradeDownloading, UpgradeVerifying, UpgradeInstalled, UpgradeFailed, UpgradeRolledBack}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// AgentRelease is an agent build for one platform. The artifact is either
+// hosted at URL or uploaded to the server and downloaded through the agent
+// API.
+type AgentRelease struct {
+	ReleaseID int64     `json:"release_id" db:"release_id"`
+	OrgID     int64     `json:"org_id" db:"org_id"`
+	Version   string    `json:"version" db:"version"`
+	Platform  string    `json:"platform" db:"platform"`
+	Arch      string    `json:"arch" db:"arch"`
+	URL       string    `json:"url,omitempty" db:"url"`
+	Uploaded  bool      `json:"uploaded" db:"-"`
+	SHA256    string    `json:"sha256" db:"sha256"`
+	SizeBytes *int64    `json:"size_bytes,omitempty" db:"size_bytes"`
+	Signature string    `json:"signature,omitempty" db:"signature"`
+	Notes     string    `json:"notes,omitempty" db:"notes"`
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Validate checks a release registered by URL; uploaded releases have their
+// hash computed by the server
+func (r *AgentRelease) Validate() error {
+	if r.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	if r.Platform == "" || r.Arch == "" {
+		return fmt.Errorf("platform and arch cannot be empty")
+	}
+
+	if r.URL != "" {
+		u, err := url.Parse(r.URL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("url must be an absolute https URL")
+		}
+	}
+
+	if !sha256Pattern.MatchString(r.SHA256) {
+		return fmt.Errorf("sha256 must be 64 lowercase hex characters")
+	}
+
+	return nil
+}
+
+// RolloutRing is one stage of a rollout. A device is in the ring if it
+// belongs to one of GroupIDs or its stable hash bucket (0-99) is below
+// Percent, so successive rings usually raise Percent.
+type RolloutRing struct {
+	Name     string  `json:"name"`
+	Percent  int     `json:"percent"`
+	GroupIDs []int64 `json:"group_ids,omitempty"`
+}
+
+// Rollout offers a release to devices ring by ring. Rings up to
+// CurrentRing are open; a completed rollout is open to every device.
+type Rollout struct {
+	RolloutID    int64          `json:"rollout_id" db:"rollout_id"`
+	OrgID        int64          `json:"org_id" db:"org_id"`
+	ReleaseID    int64          `json:"release_id" db:"release_id"`
+	Version      string         `json:"version" db:"-"`
+	Platform     string         `json:"platform" db:"platform"`
+	Arch         string         `json:"arch" db:"arch"`
+	Name         string         `json:"name" db:"name"`
+	Rings        []RolloutRing  `json:"rings" db:"rings"`
+	CurrentRing  int            `json:"current_ring" db:"current_ring"`
+	Status       string         `json:"status" db:"status"`
+	MaxFailures  *int           `json:"max_failures,omitempty" db:"max_failures"`
+	PausedReason string         `json:"paused_reason,omitempty" db:"paused_reason"`
+	Devices      map[string]int `json:"devices,omitempty" db:"-"`
+	CreatedBy    string         `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+func (r *Rollout) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if len(r.Rings) == 0 {
+		return fmt.Errorf("rings must define at least one ring")
+	}
+
+	for i, ring := range r.Rings {
+		if ring.Name == "" {
+			return fmt.Errorf("ring %d needs a name", i)
+		}
+		if ring.Percent < 0 || ring.Percent > 100 {
+			return fmt.Errorf("ring %q percent must be between 0 and 100", ring.Name)
+		}
+		if ring.Percent == 0 && len(ring.GroupIDs) == 0 {
+			return fmt.Errorf("ring %q must set a percent or group_ids", ring.Name)
+		}
+	}
+
+	if r.MaxFailures != nil && *r.MaxFailures <= 0 {
+		return fmt.Errorf("max_failures must be positive")
+	}
+
+	return nil
+}
+
+// RolloutDevice is a device's progress through a rollout
+type RolloutDevice struct {
+	DeviceID    uuid.UUID `json:"device_id" db:"device_id"`
+	Hostname    *string   `json:"hostname,omitempty" db:"hostname"`
+	Status      string    `json:"status" db:"status"`
+	FromVersion *string   `json:"from_version,omitempty" db:"from_version"`
+	Error       *string   `json:"error,omitempty" db:"error"`
+	OfferedAt   time.Time `json:"offered_at" db:"offered_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// UpdateManifest tells an agent which release to install and how to verify
+// it. RolloutID is 0 in the manifest of a release an agent.upgrade command
+// names.
+type UpdateManifest struct {
+	RolloutID int64  `json:"rollout_id"`
+	ReleaseID int64  `json:"release_id"`
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	SizeBytes *int64 `json:"size_bytes,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// UpgradeReport is an agent's report of its progress installing a release
+type UpgradeReport struct {
+	RolloutID int64  `json:"rollout_id"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (r *UpgradeReport) Validate() error {
+	if r.RolloutID <= 0 {
+		return fmt.Errorf("rollout_id is required")
+	}
+	if !slices.Contains(UpgradeReportStatuses, r.Status) {
+		return fmt.Errorf("status must be one of %v", UpgradeReportStatuses)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// ReportBucket is one row of a distribution: a label and how many devices
+// fall under it
+type ReportBucket struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// CapacityBucket is a half-open [MinBytes, MaxBytes) range in a capacity
+// histogram. MaxBytes of 0 means unbounded.
+type CapacityBucket struct {
+	Label    string `json:"label"`
+	MinBytes int64  `json:"min_bytes"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+	Count    int64  `json:"count"`
+}
+
+// FleetReport summarizes fleet composition from the latest telemetry of
+// every non-retired device
+type FleetReport struct {
+	GeneratedAt    time.Time        `json:"generated_at"`
+	DeviceCount    int64            `json:"device_count"`
+	OSVersions     []ReportBucket   `json:"os_versions"`
+	AgentVersions  []ReportBucket   `json:"agent_versions"`
+	HardwareModels []ReportBucket   `json:"hardware_models"`
+	MemoryCapacity []CapacityBucket `json:"memory_capacity"`
+	DiskCapacity   []CapacityBucket `json:"disk_capacity"`
+}
+
+const gib = int64(1) << 30
+
+// MemoryCapacityBuckets returns empty installed-memory histogram buckets
+func MemoryCapacityBuckets() []CapacityBucket {
+	return []CapacityBucket{
+		{Label: "<4 GB", MinBytes: 0, MaxBytes: 4 * gib},
+		{Label: "4-8 GB", MinBytes: 4 * gib, MaxBytes: 8 * gib},
+		{Label: "8-16 GB", MinBytes: 8 * gib, MaxBytes: 16 * gib},
+		{Label: "16-32 GB", MinBytes: 16 * gib, MaxBytes: 32 * gib},
+		{Label: "32-64 GB", MinBytes: 32 * gib, MaxBytes: 64 * gib},
+		{Label: ">=64 GB", MinBytes: 64 * gib},
+	}
+}
+
+// DiskCapacityBuckets returns empty total-disk histogram buckets
+func DiskCapacityBuckets() []CapacityBucket {
+	return []CapacityBucket{
+		{Label: "<128 GB", MinBytes: 0, MaxBytes: 128 * gib},
+		{Label: "128-256 GB", MinBytes: 128 * gib, MaxBytes: 256 * gib},
+		{Label: "256-512 GB", MinBytes: 256 * gib, MaxBytes: 512 * gib},
+		{Label: "512 GB-1 TB", MinBytes: 512 * gib, MaxBytes: 1024 * gib},
+		{Label: "1-2 TB", MinBytes: 1024 * gib, MaxBytes: 2048 * gib},
+		{Label: ">=2 TB", MinBytes: 2048 * gib},
+	}
+}
+
+// BucketBounds returns the lower bounds of every bucket after the first, in
+// the form expected by Postgres width_bucket(value, thresholds)
+func BucketBounds(buckets []CapacityBucket) []int64 {
+	bounds := make([]int64, 0, len(buckets)-1)
+	for _, b := range buckets[1:] {
+		bounds = append(bounds, b.MinBytes)
+	}
+	return bounds
+}
+
+// MetricAggregate summarizes one metric across the devices of a group, from
+// each device's latest telemetry
+type MetricAggregate struct {
+	Group   string  `json:"group"`
+	Devices int64   `json:"devices"`
+	Avg     float64 `json:"avg"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+}
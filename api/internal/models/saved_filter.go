@@ -0,0 +1,35 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// SavedFilter is a named, persisted DeviceFilter. Saved filters can target
+// broadcast commands and back smart groups.
+type SavedFilter struct {
+	FilterID    int64        `json:"filter_id" db:"filter_id"`
+	OrgID       int64        `json:"org_id" db:"org_id"`
+	Name        string       `json:"name" db:"name"`
+	Description string       `json:"description" db:"description"`
+	Filter      DeviceFilter `json:"filter" db:"filter"`
+	CreatedBy   string       `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+func (s *SavedFilter) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if len(s.Name) > 200 {
+		return fmt.Errorf("name cannot exceed 200 characters")
+	}
+
+	if s.Filter.IsEmpty() {
+		return fmt.Errorf("filter must have at least one condition")
+	}
+
+	return s.Filter.Validate()
+}
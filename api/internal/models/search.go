@@ -0,0 +1,18 @@
+package models
+
+const (
+	SearchHitDevice   = "device"
+	SearchHitSoftware = "software"
+)
+
+// SearchHit is one result of the global search. ID is a device UUID for
+// device hits and a software title ID for software hits; Field and Value
+// say what matched (hostname, serial, last_user, tag or name).
+type SearchHit struct {
+	Type  string  `json:"type"`
+	ID    string  `json:"id"`
+	Label string  `json:"label"`
+	Field string  `json:"field"`
+	Value string  `json:"value"`
+	Score float64 `json:"score"`
+}
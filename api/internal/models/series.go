@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SeriesMetrics are the telemetry metrics that can be charted, each mapped
+// to the numeric field used when the request names only the metric
+var SeriesMetrics = map[string]string{
+	"cpu.utilization": "cpu_percent",
+	"memory.usage":    "used_bytes",
+}
+
+// SeriesResolutions are the supported bucket widths. 1h and 1d are also
+// materialized in telemetry_rollups.
+var SeriesResolutions = map[string]time.Duration{
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// SeriesMaxHours bounds the query window per resolution so responses stay
+// a few thousand points at most
+var SeriesMaxHours = map[string]int{
+	"5m": 168,
+	"1h": 24 * 31,
+	"1d": 24 * 366,
+}
+
+// SeriesOrigin is the date_bin origin shared by series queries and the
+// rollup worker so their buckets line up
+const SeriesOrigin = "2000-01-01T00:00:00Z"
+
+var seriesFieldPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ParseSeriesMetric splits "cpu.utilization" or "memory.usage.total_bytes"
+// into the metric name and numeric field
+func ParseSeriesMetric(s string) (string, string, error) {
+	if field, ok := SeriesMetrics[s]; ok {
+		return s, field, nil
+	}
+
+	if i := strings.LastIndex(s, "."); i > 0 {
+		metric, field := s[:i], s[i+1:]
+		if _, ok := SeriesMetrics[metric]; ok && seriesFieldPattern.MatchString(field) {
+			return metric, field, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("unsupported metric: %s", s)
+}
+
+// TelemetryMetrics are the metric names agents report in telemetry
+var TelemetryMetrics = []string{"os.info", "cpu.utilization", "memory.usage", "disk.utilization", "software.inventory", "network.wireless", "power.settings", "runtimes.installed", "compliance.screenlock", "network.listeners", "sessions.resources"}
+
+// ParseMetricPath splits "cpu.utilization" or "memory.usage.used_bytes" into
+// a reported metric and an optional field within it
+func ParseMetricPath(s string) (string, string, error) {
+	for _, metric := range TelemetryMetrics {
+		if s == metric {
+			return metric, "", nil
+		}
+		if field := strings.TrimPrefix(s, metric+"."); field != s && seriesFieldPattern.MatchString(field) {
+			return metric, field, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("unsupported metric: %s", s)
+}
+
+// MetricPoint is one telemetry sample's value of a single metric or field
+type MetricPoint struct {
+	CollectedAt time.Time       `json:"collected_at"`
+	Seq         int64           `json:"seq"`
+	Value       json.RawMessage `json:"value"`
+}
+
+// TelemetrySeries is a downsampled metric in columnar form: the i-th entry
+// of every slice describes the bucket starting at Timestamps[i]
+type TelemetrySeries struct {
+	DeviceID   string      `json:"device_id"`
+	Metric     string      `json:"metric"`
+	Field      string      `json:"field"`
+	Resolution string      `json:"resolution"`
+	Source     string      `json:"source"`
+	Timestamps []time.Time `json:"timestamps"`
+	Avg        []float64   `json:"avg"`
+	Min        []float64   `json:"min"`
+	Max        []float64   `json:"max"`
+	Samples    []int64     `json:"samples"`
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SoftwareTitle is a distinct product, deduplicated case-insensitively on
+// name and publisher
+type SoftwareTitle struct {
+	TitleID   int64     `json:"title_id" db:"title_id"`
+	Name      string    `json:"name" db:"name"`
+	Publisher string    `json:"publisher" db:"publisher"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// DeviceSoftware is one title/version installed on a device. RemovedAt is
+// set once a later inventory report no longer lists it.
+type DeviceSoftware struct {
+	DeviceID     uuid.UUID  `json:"device_id" db:"device_id"`
+	TitleID      int64      `json:"title_id" db:"title_id"`
+	Name         string     `json:"name" db:"-"`
+	Publisher    string     `json:"publisher" db:"-"`
+	Version      string     `json:"version" db:"version"`
+	VersionParts []int32    `json:"-" db:"version_parts"`
+	InstallDate  string     `json:"install_date" db:"install_date"`
+	FirstSeenAt  time.Time  `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	RemovedAt    *time.Time `json:"removed_at,omitempty" db:"removed_at"`
+}
+
+// SoftwareEntry is one installed title/version aggregated across the fleet
+type SoftwareEntry struct {
+	TitleID     int64            `json:"title_id"`
+	Name        string           `json:"name"`
+	Version     string           `json:"version"`
+	Publisher   string           `json:"publisher"`
+	DeviceCount int64            `json:"device_count"`
+	FirstSeenAt time.Time        `json:"first_seen_at"`
+	Devices     []SoftwareDevice `json:"devices"`
+}
+
+// SoftwareDevice identifies a device with a given software entry installed
+type SoftwareDevice struct {
+	DeviceID uuid.UUID `json:"device_id"`
+	Hostname string    `json:"hostname"`
+}
+
+// SoftwareInventory decodes the software.inventory metric, if present.
+// Items without a name are dropped and duplicate name/version pairs
+// (e.g. from the 32- and 64-bit uninstall keys) are collapsed.
+func (t *Telemetry) SoftwareInventory() (SoftwareInventory, bool) {
+	raw, ok := t.Metrics["software.inventory"]
+	if !ok {
+		return nil, false
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false
+	}
+
+	var items SoftwareInventory
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, false
+	}
+
+	type key struct{ name, version string }
+	seen := make(map[key]bool, len(items))
+	unique := items[:0]
+	for _, item := range items {
+		item.Name = strings.TrimSpace(item.Name)
+		item.Version = strings.TrimSpace(item.Version)
+		k := key{item.Name, item.Version}
+		if item.Name == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		unique = append(unique, item)
+	}
+
+	return unique, true
+}
+
+// ParseVersion splits a version string into its numeric components so
+// versions can be compared as integer arrays ("119.0.6045.160" sorts before
+// "120"). Each run of digits is a component, including those of a suffix,
+// so "1.2-beta4" parses as 1, 2, 4; other characters only separate them. A
+// version without digits parses as no components.
+func ParseVersion(version string) []int32 {
+	parts := []int32{}
+	for _, field := range strings.FieldsFunc(version, func(r rune) bool { return r < '0' || r > '9' }) {
+		n, err := strconv.ParseInt(field, 10, 32)
+		if err != nil {
+			break
+		}
+		parts = append(parts, int32(n))
+	}
+	return parts
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// TelemetryArchive describes a telemetry partition exported to object
+// storage before it was dropped. PartitionDate is the first day it held.
+// The object holds one JSON row per line, gzip-compressed; the manifest
+// object next to it repeats this metadata.
+type TelemetryArchive struct {
+	ArchiveID        int64      `json:"archive_id" db:"archive_id"`
+	PartitionName    string     `json:"partition_name" db:"partition_name"`
+	PartitionDate    string     `json:"partition_date" db:"partition_date"`
+	Bucket           string     `json:"bucket" db:"bucket"`
+	ObjectKey        string     `json:"object_key" db:"object_key"`
+	ManifestKey      string     `json:"manifest_key" db:"manifest_key"`
+	Format           string     `json:"format" db:"format"`
+	RowCount         int64      `json:"row_count" db:"row_count"`
+	DeviceCount      int        `json:"device_count" db:"device_count"`
+	SizeBytes        int64      `json:"size_bytes" db:"size_bytes"`
+	SHA256           string     `json:"sha256" db:"sha256"`
+	FirstCollectedAt *time.Time `json:"first_collected_at,omitempty" db:"first_collected_at"`
+	LastCollectedAt  *time.Time `json:"last_collected_at,omitempty" db:"last_collected_at"`
+	ArchivedAt       time.Time  `json:"archived_at" db:"archived_at"`
+}
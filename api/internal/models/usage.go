@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// UsageDay is an org's metered usage on one UTC day
+type UsageDay struct {
+	Day              string `json:"day" db:"day"`
+	IngestedPayloads int64  `json:"ingested_payloads" db:"ingested_payloads"`
+	IngestedBytes    int64  `json:"ingested_bytes" db:"ingested_bytes"`
+	CommandsIssued   int64  `json:"commands_issued" db:"commands_issued"`
+	ActiveDevices    int    `json:"active_devices" db:"active_devices"`
+	StoredRows       *int64 `json:"stored_rows" db:"stored_rows"`
+}
+
+// UsageSummary is an org's metered usage over a month. ActiveDevices
+// counts each device that reported in the month once, DeviceDays once per
+// day it reported. StoredRows is the month's latest measurement.
+type UsageSummary struct {
+	OrgID            int64      `json:"org_id" db:"org_id"`
+	Month            string     `json:"month" db:"month"`
+	IngestedPayloads int64      `json:"ingested_payloads" db:"ingested_payloads"`
+	IngestedBytes    int64      `json:"ingested_bytes" db:"ingested_bytes"`
+	CommandsIssued   int64      `json:"commands_issued" db:"commands_issued"`
+	ActiveDevices    int        `json:"active_devices" db:"active_devices"`
+	DeviceDays       int64      `json:"device_days" db:"device_days"`
+	StoredRows       *int64     `json:"stored_rows" db:"stored_rows"`
+	UpdatedAt        *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+	Days             []UsageDay `json:"days,omitempty" db:"-"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook subscribes a URL to event types. Deliveries are signed with
+// Secret, which is only returned when the webhook is created.
+type Webhook struct {
+	WebhookID   int64     `json:"webhook_id" db:"webhook_id"`
+	OrgID       int64     `json:"org_id" db:"org_id"`
+	URL         string    `json:"url" db:"url"`
+	Secret      string    `json:"secret,omitempty" db:"secret"`
+	EventTypes  []string  `json:"event_types" db:"event_types"`
+	Enabled     bool      `json:"enabled" db:"enabled"`
+	Description string    `json:"description" db:"description"`
+	CreatedBy   string    `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// WebhookDelivery is one attempt series to deliver an event to a webhook
+type WebhookDelivery struct {
+	DeliveryID     int64                  `json:"delivery_id" db:"delivery_id"`
+	WebhookID      int64                  `json:"webhook_id" db:"webhook_id"`
+	EventType      string                 `json:"event_type" db:"event_type"`
+	Payload        map[string]interface{} `json:"payload" db:"payload"`
+	Status         string                 `json:"status" db:"status"`
+	Attempts       int                    `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time             `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	ResponseStatus *int                   `json:"response_status,omitempty" db:"response_status"`
+	LastError      *string                `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty" db:"delivered_at"`
+}
+
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	if len(w.EventTypes) == 0 {
+		return fmt.Errorf("event_types must name at least one event type")
+	}
+
+	for _, t := range w.EventTypes {
+		if !slices.Contains(EventTypes, t) {
+			return fmt.Errorf("unknown event type: %s", t)
+		}
+	}
+
+	if w.Secret != "" && len(w.Secret) < 16 {
+		return fmt.Errorf("secret must be at least 16 characters")
+	}
+
+	return nil
+}
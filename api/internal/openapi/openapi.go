@@ -0,0 +1,210 @@
+// Package openapi embeds the OpenAPI 3 description of the v1 API and
+// validates incoming requests against it
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/yourorg/inventory-agent/shared/validation"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+// uuidFormat accepts any RFC 4122 layout, matching what uuid.Parse accepts
+// in the handlers rather than only versions 1-5
+const uuidFormat = `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
+
+// Spec is the parsed API description together with its request router
+type Spec struct {
+	doc    *openapi3.T
+	router routers.Router
+	json   []byte
+}
+
+// Load parses and validates the embedded document
+func Load() (*Spec, error) {
+	openapi3.DefineStringFormat("uuid", uuidFormat)
+
+	doc, err := openapi3.NewLoader().LoadFromData(specYAML)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+
+	return &Spec{doc: doc, router: router, json: data}, nil
+}
+
+// Handler serves the document as JSON
+func (s *Spec) Handler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(s.json)
+}
+
+// Middleware rejects requests whose parameters or body don't match the
+// operation they route to with a 400 in the same shape as the handlers'
+// schema errors. Requests for routes the document doesn't describe pass
+// through untouched so the handler's own 404/405 applies.
+func (s *Spec) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := adaptor.ConvertRequest(c, false)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		route, pathParams, err := s.router.FindRoute(req)
+		if err != nil {
+			return c.Next()
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				// Compressed and binary bodies (gzip, protobuf and msgpack
+				// inventory uploads) are decoded and validated by the
+				// handler itself
+				ExcludeRequestBody: c.Get(fiber.HeaderContentEncoding) != "" || binaryBody(c),
+			},
+		}
+
+		if err := openapi3filter.ValidateRequest(c.Context(), input); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":      "Invalid request",
+				"validation": validationResult(err),
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// binaryBody reports whether the request body is in one of the binary
+// encodings the inventory endpoints accept
+func binaryBody(c *fiber.Ctx) bool {
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	switch mediaType {
+	case "application/x-protobuf", "application/msgpack", "application/x-msgpack":
+		return true
+	}
+	return false
+}
+
+// UndocumentedRoutes lists routes registered on the app under /v1 that have
+// no matching operation in the document, as "METHOD /path"
+func (s *Spec) UndocumentedRoutes(app *fiber.App) []string {
+	var missing []string
+	seen := make(map[string]bool)
+
+	for _, r := range app.GetRoutes(true) {
+		if !strings.HasPrefix(r.Path, "/v1/") || r.Method == fiber.MethodHead {
+			continue
+		}
+
+		key := r.Method + " " + r.Path
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		item := s.doc.Paths.Find(fiberPathPattern.ReplaceAllString(r.Path, "{$1}"))
+		if item == nil || item.GetOperation(r.Method) == nil {
+			missing = append(missing, key)
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
+
+var fiberPathPattern = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// validationResult flattens kin-openapi's nested errors into the shared
+// validation result used by the schema-validated handlers
+func validationResult(err error) *validation.ValidationResult {
+	result := &validation.ValidationResult{}
+
+	var walk func(error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, inner := range e {
+				walk(inner)
+			}
+		case *openapi3filter.RequestError:
+			result.Errors = append(result.Errors, requestErrors(e)...)
+		default:
+			result.Errors = append(result.Errors, validation.ValidationError{
+				Field: "root", Message: err.Error(), Code: "VALIDATION_ERROR",
+			})
+		}
+	}
+	walk(err)
+
+	return result
+}
+
+// requestErrors reports one entry per schema violation in a parameter or
+// body, with the JSON pointer into the body appended to the field name
+func requestErrors(reqErr *openapi3filter.RequestError) []validation.ValidationError {
+	field, code := "body", "INVALID_BODY"
+	if reqErr.Parameter != nil {
+		field, code = reqErr.Parameter.Name, "INVALID_PARAMETER"
+	}
+
+	var schemaErrs openapi3.MultiError
+	if !errors.As(reqErr.Err, &schemaErrs) {
+		schemaErrs = openapi3.MultiError{reqErr.Err}
+	}
+
+	var out []validation.ValidationError
+	for _, e := range schemaErrs {
+		var schemaErr *openapi3.SchemaError
+		if e != nil && errors.As(e, &schemaErr) {
+			path := field
+			if ptr := schemaErr.JSONPointer(); len(ptr) > 0 {
+				path = field + "." + strings.Join(ptr, ".")
+			}
+			out = append(out, validation.ValidationError{Field: path, Message: schemaErr.Reason, Code: code})
+			continue
+		}
+
+		message := reqErr.Reason
+		if e != nil {
+			message = e.Error()
+		}
+		out = append(out, validation.ValidationError{Field: field, Message: message, Code: code})
+	}
+
+	return out
+}
@@ -0,0 +1,339 @@
+// Package policycache caches the effective policy served to each agent so
+// that policy polls don't resolve it from the database every time. Entries
+// are kept in memory and, when Redis is configured, in Redis shared by all
+// API instances. Invalidations reach every instance over NATS.
+package policycache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+const (
+	// invalidateSubject carries invalidations between API instances. Like
+	// command notifications it is a plain NATS subject: an instance that
+	// misses one serves its entries until they expire.
+	invalidateSubject = "policies.invalidate"
+
+	// generationKey holds the Redis generation. Redis keys include it, so
+	// bumping it drops every shared entry at once.
+	generationKey = "policy:generation"
+
+	sweepInterval = time.Minute
+)
+
+// LoadFunc resolves a device's effective policy from the database. It also
+// returns when the resolution may next change by itself, such as when a
+// staged policy change takes effect, or the zero time if nothing is staged.
+type LoadFunc func(ctx context.Context) (*models.Policy, time.Time, error)
+
+// Cache holds resolved effective policies by device. A nil Cache caches
+// nothing. Cached policies are shared and must not be modified.
+type Cache struct {
+	ttl   time.Duration
+	redis *redis.Client
+	nc    *nats.Conn
+	sub   *nats.Subscription
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]entry
+	// generation namespaces the Redis keys; epoch counts every
+	// invalidation seen so a load that raced one isn't stored
+	generation int64
+	epoch      uint64
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+type entry struct {
+	policy  *models.Policy
+	expires time.Time
+}
+
+// invalidation is the message published on invalidateSubject. No device IDs
+// means every device.
+type invalidation struct {
+	Generation int64       `json:"generation"`
+	DeviceIDs  []uuid.UUID `json:"device_ids,omitempty"`
+}
+
+// New creates a cache keeping entries for at most ttl. rdb and nc are
+// optional: without Redis each instance keeps its own entries, and without
+// NATS invalidations only reach the instance that made them.
+func New(ttl time.Duration, rdb *redis.Client, nc *nats.Conn) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		redis:   rdb,
+		nc:      nc,
+		entries: make(map[uuid.UUID]entry),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Start subscribes to invalidations from other instances and sweeps
+// expired entries until ctx is done
+func (c *Cache) Start(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+
+	if c.redis != nil {
+		gen, err := c.redis.Get(ctx, generationKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		c.generation = gen
+	}
+
+	if c.nc != nil {
+		sub, err := c.nc.Subscribe(invalidateSubject, c.handleInvalidation)
+		if err != nil {
+			return err
+		}
+		c.sub = sub
+	}
+
+	c.wg.Add(1)
+	go c.sweep(ctx)
+	slog.Info("Policy cache started")
+	return nil
+}
+
+func (c *Cache) Stop() {
+	if c == nil {
+		return
+	}
+	if c.sub != nil {
+		c.sub.Unsubscribe()
+	}
+	close(c.stopCh)
+	c.wg.Wait()
+	slog.Info("Policy cache stopped")
+}
+
+// Get returns the device's cached effective policy, resolving and caching
+// it with load on a miss
+func (c *Cache) Get(ctx context.Context, deviceID uuid.UUID, load LoadFunc) (*models.Policy, error) {
+	if c == nil {
+		policy, _, err := load(ctx)
+		return policy, err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[deviceID]
+	gen, epoch := c.generation, c.epoch
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.policy, nil
+	}
+
+	if e, ok := c.getShared(ctx, gen, deviceID); ok {
+		c.store(deviceID, e, epoch)
+		return e.policy, nil
+	}
+
+	policy, changesAt, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e = entry{policy: policy, expires: now.Add(c.ttl)}
+	if !changesAt.IsZero() && changesAt.Before(e.expires) {
+		e.expires = changesAt
+	}
+	if c.store(deviceID, e, epoch) {
+		c.setShared(ctx, gen, deviceID, e)
+	}
+	return policy, nil
+}
+
+// Invalidate drops the cached policies of the given devices on every
+// instance
+func (c *Cache) Invalidate(ctx context.Context, deviceIDs ...uuid.UUID) {
+	if c == nil || len(deviceIDs) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	gen := c.generation
+	c.mu.Unlock()
+
+	if c.redis != nil {
+		keys := make([]string, len(deviceIDs))
+		for i, deviceID := range deviceIDs {
+			keys[i] = redisKey(gen, deviceID)
+		}
+		if err := c.redis.Del(ctx, keys...).Err(); err != nil {
+			slog.Error("Failed to invalidate cached policies in Redis", "error", err)
+		}
+	}
+
+	c.apply(invalidation{Generation: gen, DeviceIDs: deviceIDs})
+	c.broadcast(invalidation{Generation: gen, DeviceIDs: deviceIDs})
+}
+
+// InvalidateAll drops every cached policy on every instance, for changes
+// that can affect any number of devices
+func (c *Cache) InvalidateAll(ctx context.Context) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	gen := c.generation + 1
+	c.mu.Unlock()
+
+	if c.redis != nil {
+		next, err := c.redis.Incr(ctx, generationKey).Result()
+		if err != nil {
+			slog.Error("Failed to invalidate cached policies in Redis", "error", err)
+		} else {
+			gen = next
+		}
+	}
+
+	c.apply(invalidation{Generation: gen})
+	c.broadcast(invalidation{Generation: gen})
+}
+
+func (c *Cache) handleInvalidation(msg *nats.Msg) {
+	var inv invalidation
+	if err := json.Unmarshal(msg.Data, &inv); err != nil {
+		slog.Error("Invalid policy cache invalidation", "error", err)
+		return
+	}
+	c.apply(inv)
+}
+
+// apply drops the invalidated entries from memory. An instance also
+// receives its own broadcasts, which is harmless.
+func (c *Cache) apply(inv invalidation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	if inv.Generation > c.generation {
+		c.generation = inv.Generation
+	}
+	if len(inv.DeviceIDs) == 0 {
+		c.entries = make(map[uuid.UUID]entry)
+		return
+	}
+	for _, deviceID := range inv.DeviceIDs {
+		delete(c.entries, deviceID)
+	}
+}
+
+func (c *Cache) broadcast(inv invalidation) {
+	if c.nc == nil {
+		return
+	}
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		slog.Error("Failed to encode policy cache invalidation", "error", err)
+		return
+	}
+	if err := c.nc.Publish(invalidateSubject, data); err != nil {
+		slog.Error("Failed to publish policy cache invalidation", "error", err)
+	}
+}
+
+// store keeps an entry in memory unless an invalidation arrived since
+// epoch, in which case the entry may already be stale
+func (c *Cache) store(deviceID uuid.UUID, e entry, epoch uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch != epoch {
+		return false
+	}
+	c.entries[deviceID] = e
+	return true
+}
+
+func (c *Cache) getShared(ctx context.Context, gen int64, deviceID uuid.UUID) (entry, bool) {
+	if c.redis == nil {
+		return entry{}, false
+	}
+
+	key := redisKey(gen, deviceID)
+	data, err := c.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			slog.Error("Failed to read cached policy from Redis", "error", err)
+		}
+		return entry{}, false
+	}
+	ttl, err := c.redis.PTTL(ctx, key).Result()
+	if err != nil || ttl <= 0 {
+		return entry{}, false
+	}
+
+	var policy models.Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return entry{}, false
+	}
+	return entry{policy: &policy, expires: time.Now().Add(ttl)}, true
+}
+
+func (c *Cache) setShared(ctx context.Context, gen int64, deviceID uuid.UUID, e entry) {
+	if c.redis == nil {
+		return
+	}
+
+	ttl := time.Until(e.expires)
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(e.policy)
+	if err != nil {
+		return
+	}
+	if err := c.redis.Set(ctx, redisKey(gen, deviceID), data, ttl).Err(); err != nil {
+		slog.Error("Failed to cache policy in Redis", "error", err)
+	}
+}
+
+// sweep removes expired entries so devices that stopped polling don't
+// hold memory
+func (c *Cache) sweep(ctx context.Context) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			c.mu.Lock()
+			for deviceID, e := range c.entries {
+				if !now.Before(e.expires) {
+					delete(c.entries, deviceID)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func redisKey(gen int64, deviceID uuid.UUID) string {
+	return "policy:" + strconv.FormatInt(gen, 10) + ":" + deviceID.String()
+}
@@ -0,0 +1,212 @@
+// Package quota enforces ingest quotas: how many telemetry payloads a
+// device or an org may send per hour and how many bytes per day. Usage is
+// counted in Postgres, so every API instance enforces the same totals,
+// in fixed windows of a clock hour and a UTC day.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// Limits caps ingest in each window. 0 leaves a limit off.
+type Limits struct {
+	PayloadsPerHour int64 `json:"payloads_per_hour"`
+	BytesPerDay     int64 `json:"bytes_per_day"`
+}
+
+func (l Limits) any() bool {
+	return l.PayloadsPerHour > 0 || l.BytesPerDay > 0
+}
+
+// ExceededError is returned when a request would take a device or org
+// past a quota. RetryAfter is when the window that quota counts resets.
+type ExceededError struct {
+	Scope      string
+	Quota      string
+	Limit      int64
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s %s quota of %d exceeded", e.Scope, e.Quota, e.Limit)
+}
+
+// Enforcer charges ingest against quotas. Devices and orgs without any
+// quota in force aren't counted, so ingest costs nothing extra until
+// quotas are configured.
+type Enforcer struct {
+	db       *pgxpool.Pool
+	defaults map[string]Limits
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	limits map[string]cachedLimits
+}
+
+type cachedLimits struct {
+	limits  Limits
+	expires time.Time
+}
+
+// NewEnforcer creates an enforcer with the server's default limits per
+// device and per org. Overrides read from ingest_quotas are kept for ttl.
+func NewEnforcer(db *pgxpool.Pool, device, org Limits, ttl time.Duration) *Enforcer {
+	return &Enforcer{
+		db: db,
+		defaults: map[string]Limits{
+			models.QuotaScopeDevice: device,
+			models.QuotaScopeOrg:    org,
+		},
+		ttl:    ttl,
+		limits: make(map[string]cachedLimits),
+	}
+}
+
+// Charge counts a request of payloads payloads and bytes bytes against the
+// device's quotas and its org's. When that would take either over a
+// quota, nothing is counted and an *ExceededError is returned: a throttled
+// agent isn't locked out for longer by retrying.
+func (e *Enforcer) Charge(ctx context.Context, deviceID uuid.UUID, orgID int64, payloads int, bytes int64) error {
+	type charge struct {
+		scope, id string
+		limits    Limits
+	}
+	var charges []charge
+	for _, c := range []charge{
+		{scope: models.QuotaScopeDevice, id: deviceID.String()},
+		{scope: models.QuotaScopeOrg, id: strconv.FormatInt(orgID, 10)},
+	} {
+		limits, err := e.Limits(ctx, c.scope, c.id)
+		if err != nil {
+			return err
+		}
+		if limits.any() {
+			c.limits = limits
+			charges = append(charges, c)
+		}
+	}
+	if len(charges) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	hour, day := windows(now)
+
+	tx, err := e.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Rows are always locked in the same order, the device's before its
+	// org's, so concurrent requests can't deadlock
+	for _, c := range charges {
+		var hourPayloads, dayBytes int64
+		err := tx.QueryRow(ctx, `
+			WITH charged AS (
+				INSERT INTO ingest_usage (scope, scope_id, period, window_start, payloads, bytes)
+				VALUES ($1, $2, 'hour', $3, $5, $6), ($1, $2, 'day', $4, $5, $6)
+				ON CONFLICT (scope, scope_id, period, window_start) DO UPDATE SET
+					payloads = ingest_usage.payloads + EXCLUDED.payloads,
+					bytes = ingest_usage.bytes + EXCLUDED.bytes
+				RETURNING period, payloads, bytes
+			)
+			SELECT COALESCE(SUM(payloads) FILTER (WHERE period = 'hour'), 0),
+			       COALESCE(SUM(bytes) FILTER (WHERE period = 'day'), 0)
+			FROM charged`,
+			c.scope, c.id, hour, day, payloads, bytes).Scan(&hourPayloads, &dayBytes)
+		if err != nil {
+			return err
+		}
+
+		if c.limits.PayloadsPerHour > 0 && hourPayloads > c.limits.PayloadsPerHour {
+			return &ExceededError{Scope: c.scope, Quota: "payloads_per_hour", Limit: c.limits.PayloadsPerHour,
+				RetryAfter: hour.Add(time.Hour).Sub(now)}
+		}
+		if c.limits.BytesPerDay > 0 && dayBytes > c.limits.BytesPerDay {
+			return &ExceededError{Scope: c.scope, Quota: "bytes_per_day", Limit: c.limits.BytesPerDay,
+				RetryAfter: day.AddDate(0, 0, 1).Sub(now)}
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Limits returns the limits in force for a device or org: its override
+// where it has one, the server default otherwise
+func (e *Enforcer) Limits(ctx context.Context, scope, id string) (Limits, error) {
+	key := scope + ":" + id
+	e.mu.Lock()
+	cached, ok := e.limits[key]
+	e.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.limits, nil
+	}
+
+	limits := e.defaults[scope]
+	var payloadsPerHour, bytesPerDay *int64
+	err := e.db.QueryRow(ctx,
+		"SELECT payloads_per_hour, bytes_per_day FROM ingest_quotas WHERE scope = $1 AND scope_id = $2",
+		scope, id).Scan(&payloadsPerHour, &bytesPerDay)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return Limits{}, err
+	}
+	if payloadsPerHour != nil {
+		limits.PayloadsPerHour = *payloadsPerHour
+	}
+	if bytesPerDay != nil {
+		limits.BytesPerDay = *bytesPerDay
+	}
+
+	e.mu.Lock()
+	e.limits[key] = cachedLimits{limits: limits, expires: time.Now().Add(e.ttl)}
+	e.mu.Unlock()
+	return limits, nil
+}
+
+// Invalidate drops the cached limits of a device or org, so a change to
+// its override applies on this instance at once. Other instances pick it
+// up when their cached copy expires.
+func (e *Enforcer) Invalidate(scope, id string) {
+	e.mu.Lock()
+	delete(e.limits, scope+":"+id)
+	e.mu.Unlock()
+}
+
+// Usage returns what a device or org has sent in the current windows. Only
+// ingest while a quota applied to it was counted.
+func (e *Enforcer) Usage(ctx context.Context, scope, id string) (models.IngestUsage, error) {
+	hour, day := windows(time.Now().UTC())
+	usage := models.IngestUsage{HourResetsAt: hour.Add(time.Hour), DayResetsAt: day.AddDate(0, 0, 1)}
+	err := e.db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(payloads) FILTER (WHERE period = 'hour' AND window_start = $3), 0),
+		       COALESCE(SUM(bytes) FILTER (WHERE period = 'day' AND window_start = $4), 0)
+		FROM ingest_usage WHERE scope = $1 AND scope_id = $2`,
+		scope, id, hour, day).Scan(&usage.PayloadsThisHour, &usage.BytesToday)
+	return usage, err
+}
+
+// PruneUsage deletes usage windows that ended before a day ago
+func PruneUsage(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	_, day := windows(time.Now().UTC())
+	tag, err := db.Exec(ctx, "DELETE FROM ingest_usage WHERE window_start < $1", day.AddDate(0, 0, -1))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// windows returns the start of the hour and the UTC day now falls in
+func windows(now time.Time) (hour, day time.Time) {
+	return now.Truncate(time.Hour), time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,288 @@
+// Package repository holds typed queries over the device and telemetry
+// tables, shared by the REST and GraphQL handlers so each query and its
+// scanning is written once. Query text is fixed for a given set of filters,
+// so pgx prepares each statement once per connection and reuses it.
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// ErrNotFound is returned when the requested device doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// QueryError reports a list request that can't be run as asked, such as an
+// invalid filter, sort or cursor. Handlers answer it with a 400.
+type QueryError struct {
+	Err error
+}
+
+func (e *QueryError) Error() string { return e.Err.Error() }
+func (e *QueryError) Unwrap() error { return e.Err }
+
+// deviceColumns are the columns scanDevice reads, selected from agents a
+// joined with database.DeviceHealthJoin
+const deviceColumns = `a.device_id, a.hostname, a.status, a.lifecycle_state, a.capabilities, a.agent_version,
+	a.first_seen_at, a.last_seen_at, a.retired_at, a.clock_skew_ms, COALESCE(a.notes, ''), a.custom_fields,
+	COALESCE((SELECT jsonb_object_agg(tag_key, tag_value) FROM device_tags WHERE device_tags.device_id = a.device_id), '{}'),
+	` + database.DeviceHealthColumns
+
+func scanDevice(row pgx.Row, device *models.Agent) error {
+	var health models.DeviceHealth
+	err := row.Scan(&device.DeviceID, &device.Hostname, &device.Status, &device.LifecycleState, &device.Capabilities,
+		&device.AgentVersion, &device.FirstSeenAt, &device.LastSeenAt, &device.RetiredAt, &device.ClockSkewMs,
+		&device.Notes, &device.CustomFields, &device.Tags,
+		&health.Score, &health.LastSeenHours, &health.FailedCommands,
+		&health.MinDiskFreePercent, &health.PatchAgeDays, &health.CollectorErrors)
+	if err != nil {
+		return err
+	}
+	device.Health = &health
+	return nil
+}
+
+// Devices queries devices with their tags and health
+type Devices struct {
+	db *pgxpool.Pool
+}
+
+func NewDevices(db *pgxpool.Pool) *Devices {
+	return &Devices{db: db}
+}
+
+// DeviceQuery selects a page of devices. Filters are the device list query
+// parameters understood by database.DeviceListWhere and Sort the ?sort=
+// value of database.DeviceListOrder. Cursor is only valid with the default
+// order and takes precedence over Offset.
+type DeviceQuery struct {
+	Filters url.Values
+	Sort    string
+	Cursor  string
+	Limit   int
+	Offset  int
+}
+
+// DevicePage is one page of devices. NextCursor is set when another page
+// follows and the order pages by cursor.
+type DevicePage struct {
+	Devices    []models.Agent
+	NextCursor string
+}
+
+// List returns a page of devices
+func (r *Devices) List(ctx context.Context, q DeviceQuery) (*DevicePage, error) {
+	where, args, err := database.DeviceListWhere(q.Filters)
+	if err != nil {
+		return nil, &QueryError{err}
+	}
+
+	orderBy, keyset, err := database.DeviceListOrder(q.Sort)
+	if err != nil {
+		return nil, &QueryError{err}
+	}
+
+	offset := q.Offset
+	if q.Cursor != "" {
+		if !keyset {
+			return nil, &QueryError{errors.New("cursor can only be used with sort=last_seen_at:desc; use offset")}
+		}
+		cur, err := database.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, &QueryError{err}
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.UUIDCursorWhere(cur, "a.last_seen_at", "a.device_id", args)
+		if err != nil {
+			return nil, &QueryError{err}
+		}
+		where += cursorWhere
+		offset = 0
+	}
+
+	// Fetch one extra row to tell whether another page follows
+	query := `SELECT ` + deviceColumns + ` FROM agents a` + database.DeviceHealthJoin + where + orderBy +
+		` LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	args = append(args, q.Limit+1, offset)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &DevicePage{Devices: []models.Agent{}}
+	for rows.Next() {
+		var device models.Agent
+		if err := scanDevice(rows, &device); err != nil {
+			return nil, err
+		}
+		page.Devices = append(page.Devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Devices) > q.Limit {
+		page.Devices = page.Devices[:q.Limit]
+		if keyset {
+			last := page.Devices[q.Limit-1]
+			page.NextCursor = database.EncodeCursor(last.LastSeenAt, last.DeviceID.String())
+		}
+	}
+
+	return page, nil
+}
+
+// Count returns how many devices match the filters
+func (r *Devices) Count(ctx context.Context, filters url.Values) (int, error) {
+	where, args, err := database.DeviceListWhere(filters)
+	if err != nil {
+		return 0, &QueryError{err}
+	}
+
+	var total int
+	err = r.db.QueryRow(ctx, `SELECT COUNT(*) FROM agents a`+where, args...).Scan(&total)
+	return total, err
+}
+
+// Get returns one device, retired or not
+func (r *Devices) Get(ctx context.Context, deviceID uuid.UUID) (*models.Agent, error) {
+	var device models.Agent
+	err := scanDevice(r.db.QueryRow(ctx,
+		`SELECT `+deviceColumns+` FROM agents a`+database.DeviceHealthJoin+` WHERE a.device_id = $1`, deviceID), &device)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// LatestTelemetry returns a device's latest report, or nil when it hasn't
+// reported yet
+func (r *Devices) LatestTelemetry(ctx context.Context, deviceID uuid.UUID) (*models.Telemetry, error) {
+	telemetry := models.Telemetry{DeviceID: deviceID}
+	err := r.db.QueryRow(ctx,
+		"SELECT collected_at, metrics, tags, errors FROM telemetry_latest WHERE device_id = $1", deviceID).Scan(
+		&telemetry.CollectedAt, &telemetry.Metrics, &telemetry.Tags, &telemetry.Errors)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &telemetry, nil
+}
+
+// deviceIndex returns the IDs of a page of devices and each one's position
+func deviceIndex(devices []models.Agent) ([]uuid.UUID, map[uuid.UUID]int) {
+	ids := make([]uuid.UUID, len(devices))
+	index := make(map[uuid.UUID]int, len(devices))
+	for i, device := range devices {
+		ids[i] = device.DeviceID
+		index[device.DeviceID] = i
+	}
+	return ids, index
+}
+
+// AttachGroups fills in group memberships for a page of devices in one query
+func (r *Devices) AttachGroups(ctx context.Context, devices []models.Agent) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	ids, index := deviceIndex(devices)
+
+	rows, err := r.db.Query(ctx, `
+		SELECT m.device_id, g.group_id, g.name
+		FROM device_group_members m
+		JOIN device_groups g ON g.group_id = m.group_id
+		WHERE m.device_id = ANY($1)
+		ORDER BY g.name`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deviceID uuid.UUID
+		var group models.GroupRef
+		if err := rows.Scan(&deviceID, &group.GroupID, &group.Name); err != nil {
+			return err
+		}
+		i := index[deviceID]
+		devices[i].Groups = append(devices[i].Groups, group)
+	}
+
+	return rows.Err()
+}
+
+// AttachLatestTelemetry fills in the latest telemetry of a page of devices
+// in one query. Devices that haven't reported are left without.
+func (r *Devices) AttachLatestTelemetry(ctx context.Context, devices []models.Agent) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	ids, index := deviceIndex(devices)
+
+	rows, err := r.db.Query(ctx, `
+		SELECT device_id, collected_at, metrics, tags, errors
+		FROM telemetry_latest
+		WHERE device_id = ANY($1)`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.Telemetry
+		if err := rows.Scan(&t.DeviceID, &t.CollectedAt, &t.Metrics, &t.Tags, &t.Errors); err != nil {
+			return err
+		}
+		devices[index[t.DeviceID]].LatestTelemetry = &t
+	}
+
+	return rows.Err()
+}
+
+// AttachPendingCommands fills in the commands a page of devices haven't
+// picked up yet, awaiting approval or pending and not expired, oldest first
+func (r *Devices) AttachPendingCommands(ctx context.Context, devices []models.Agent) error {
+	if len(devices) == 0 {
+		return nil
+	}
+	ids, index := deviceIndex(devices)
+
+	rows, err := r.db.Query(ctx, `
+		SELECT command_id, device_id, type, parameters, issued_at, ttl_seconds, status, not_before
+		FROM commands
+		WHERE device_id = ANY($1) AND status IN ('awaiting_approval', 'pending')
+		  AND COALESCE(not_before, issued_at) + (ttl_seconds || ' seconds')::interval > NOW()
+		ORDER BY issued_at`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cmd models.Command
+		err := rows.Scan(&cmd.CommandID, &cmd.DeviceID, &cmd.Type, &cmd.Parameters, &cmd.IssuedAt,
+			&cmd.TTLSeconds, &cmd.Status, &cmd.NotBefore)
+		if err != nil {
+			return err
+		}
+		i := index[cmd.DeviceID]
+		devices[i].PendingCommands = append(devices[i].PendingCommands, cmd)
+	}
+
+	return rows.Err()
+}
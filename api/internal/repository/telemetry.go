@@ -0,0 +1,446 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// HistoryQuery selects a device's raw telemetry since Since, newest first.
+// A zero Limit returns the whole window.
+type HistoryQuery struct {
+	Since  time.Time
+	Cursor string
+	Limit  int
+}
+
+// History returns a device's raw telemetry and, when Limit cut the page
+// short, the cursor of the next page
+func (r *Telemetry) History(ctx context.Context, deviceID uuid.UUID, q HistoryQuery) ([]models.Telemetry, string, error) {
+	shard, err := r.ForDevice(ctx, deviceID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := `
+		SELECT collected_at, seq, metrics, tags, errors
+		FROM ` + shard.Table() + `
+		WHERE device_id = $1 AND collected_at >= $2`
+	args := []interface{}{deviceID, q.Since}
+
+	if q.Cursor != "" {
+		cur, err := database.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", &QueryError{err}
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.Int64CursorWhere(cur, "collected_at", "seq", args)
+		if err != nil {
+			return nil, "", &QueryError{err}
+		}
+		query += cursorWhere
+	}
+
+	query += ` ORDER BY collected_at DESC, seq DESC`
+	if q.Limit > 0 {
+		args = append(args, q.Limit+1)
+		query += ` LIMIT $` + strconv.Itoa(len(args))
+	}
+
+	rows, err := shard.replica.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var telemetry []models.Telemetry
+	for rows.Next() {
+		t := models.Telemetry{DeviceID: deviceID}
+		if err := rows.Scan(&t.CollectedAt, &t.Seq, &t.Metrics, &t.Tags, &t.Errors); err != nil {
+			return nil, "", err
+		}
+		telemetry = append(telemetry, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if q.Limit > 0 && len(telemetry) > q.Limit {
+		telemetry = telemetry[:q.Limit]
+		last := telemetry[q.Limit-1]
+		nextCursor = database.EncodeCursor(last.CollectedAt, strconv.FormatInt(last.Seq, 10))
+	}
+	return telemetry, nextCursor, nil
+}
+
+// MetricQuery selects the samples of one metric, or one field of it, since
+// Since, newest first
+type MetricQuery struct {
+	Metric string
+	Field  string
+	Since  time.Time
+	Cursor string
+	Limit  int
+}
+
+// MetricSamples returns a page of a device's samples of one metric and the
+// cursor of the next page. Samples without the metric are skipped.
+func (r *Telemetry) MetricSamples(ctx context.Context, deviceID uuid.UUID, q MetricQuery) ([]models.MetricPoint, string, error) {
+	shard, err := r.ForDevice(ctx, deviceID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	value := "metrics->$3"
+	args := []interface{}{deviceID, q.Since, q.Metric}
+	if q.Field != "" {
+		value += "->$4"
+		args = append(args, q.Field)
+	}
+
+	query := `
+		SELECT collected_at, seq, ` + value + `
+		FROM ` + shard.Table() + `
+		WHERE device_id = $1 AND collected_at >= $2 AND ` + value + ` IS NOT NULL`
+
+	if q.Cursor != "" {
+		cur, err := database.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", &QueryError{err}
+		}
+		var cursorWhere string
+		cursorWhere, args, err = database.Int64CursorWhere(cur, "collected_at", "seq", args)
+		if err != nil {
+			return nil, "", &QueryError{err}
+		}
+		query += cursorWhere
+	}
+
+	args = append(args, q.Limit+1)
+	query += ` ORDER BY collected_at DESC, seq DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := shard.replica.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	points := []models.MetricPoint{}
+	for rows.Next() {
+		var p models.MetricPoint
+		if err := rows.Scan(&p.CollectedAt, &p.Seq, &p.Value); err != nil {
+			return nil, "", err
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(points) > q.Limit {
+		points = points[:q.Limit]
+		last := points[q.Limit-1]
+		nextCursor = database.EncodeCursor(last.CollectedAt, strconv.FormatInt(last.Seq, 10))
+	}
+	return points, nextCursor, nil
+}
+
+// SeriesQuery selects a downsampled metric field at one of
+// models.SeriesResolutions
+type SeriesQuery struct {
+	Metric     string
+	Field      string
+	Resolution string
+	Since      time.Time
+}
+
+// SeriesBucket is one bucket of a series. Rollup tells whether it was read
+// from telemetry_rollups rather than aggregated from raw telemetry.
+type SeriesBucket struct {
+	Bucket  time.Time
+	Avg     float64
+	Min     float64
+	Max     float64
+	Samples int64
+	Rollup  bool
+}
+
+// Series returns a device's metric buckets in time order. Buckets covered
+// by telemetry_rollups are read from there; the rest are aggregated from
+// the device's shard on the fly. Only 1h and 1d are rolled up, so 5m is
+// always aggregated.
+func (r *Telemetry) Series(ctx context.Context, deviceID uuid.UUID, q SeriesQuery) ([]SeriesBucket, error) {
+	width := models.SeriesResolutions[q.Resolution]
+
+	rows, err := r.primary.replica.Query(ctx, `
+		SELECT bucket, avg_value, min_value, max_value, samples
+		FROM telemetry_rollups
+		WHERE device_id = $1 AND metric = $2 AND field = $3 AND resolution = $4
+		  AND bucket >= date_bin(make_interval(secs => $5), $6::timestamptz, $7::timestamptz)
+		ORDER BY bucket`,
+		deviceID, q.Metric, q.Field, q.Resolution, width.Seconds(), q.Since, models.SeriesOrigin)
+	if err != nil {
+		return nil, err
+	}
+	rollups, err := scanSeriesBuckets(rows, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Raw telemetry fills in around the rolled-up range
+	var lo, hi *time.Time
+	if len(rollups) > 0 {
+		first, last := rollups[0].Bucket, rollups[len(rollups)-1].Bucket.Add(width)
+		lo, hi = &first, &last
+	}
+
+	shard, err := r.ForDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = shard.replica.Query(ctx, `
+		SELECT date_bin(make_interval(secs => $4), t.collected_at, $5::timestamptz) AS bucket,
+		       AVG(v), MIN(v), MAX(v), COUNT(*)
+		FROM `+shard.Table()+` t
+		CROSS JOIN LATERAL (SELECT (t.metrics->$2->>$3)::double precision AS v) m
+		WHERE t.device_id = $1 AND t.collected_at >= $6
+		  AND jsonb_typeof(t.metrics->$2->$3) = 'number'
+		  AND ($7::timestamptz IS NULL OR t.collected_at < $7 OR t.collected_at >= $8)
+		GROUP BY 1
+		ORDER BY 1`,
+		deviceID, q.Metric, q.Field, width.Seconds(), models.SeriesOrigin, q.Since, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := scanSeriesBuckets(rows, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both are ordered and don't overlap, so merging keeps time order
+	buckets := make([]SeriesBucket, 0, len(rollups)+len(raw))
+	for len(rollups) > 0 || len(raw) > 0 {
+		if len(raw) == 0 || (len(rollups) > 0 && rollups[0].Bucket.Before(raw[0].Bucket)) {
+			buckets, rollups = append(buckets, rollups[0]), rollups[1:]
+		} else {
+			buckets, raw = append(buckets, raw[0]), raw[1:]
+		}
+	}
+	return buckets, nil
+}
+
+func scanSeriesBuckets(rows pgx.Rows, rollup bool) ([]SeriesBucket, error) {
+	defer rows.Close()
+
+	var buckets []SeriesBucket
+	for rows.Next() {
+		b := SeriesBucket{Rollup: rollup}
+		if err := rows.Scan(&b.Bucket, &b.Avg, &b.Min, &b.Max, &b.Samples); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+// Snapshot assembles a device's inventory as of the given time from the
+// latest report of each metric since at minus lookback, since agents report
+// metrics on different schedules. It returns nil when nothing was reported.
+func (r *Telemetry) Snapshot(ctx context.Context, deviceID uuid.UUID, at time.Time, lookback time.Duration) (*models.Telemetry, error) {
+	shard, err := r.ForDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := shard.replica.Query(ctx, `
+		SELECT DISTINCT ON (m.key) m.key, m.value, t.collected_at
+		FROM `+shard.Table()+` t, jsonb_each(t.metrics) m
+		WHERE t.device_id = $1 AND t.collected_at <= $2 AND t.collected_at > $3
+		ORDER BY m.key, t.collected_at DESC`,
+		deviceID, at, at.Add(-lookback))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshot := &models.Telemetry{
+		DeviceID: deviceID,
+		Metrics:  make(map[string]interface{}),
+	}
+	for rows.Next() {
+		var (
+			key         string
+			value       interface{}
+			collectedAt time.Time
+		)
+		if err := rows.Scan(&key, &value, &collectedAt); err != nil {
+			return nil, err
+		}
+		snapshot.Metrics[key] = value
+		if collectedAt.After(snapshot.CollectedAt) {
+			snapshot.CollectedAt = collectedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(snapshot.Metrics) == 0 {
+		return nil, nil
+	}
+	return snapshot, nil
+}
+
+// CountSince counts the telemetry collected since the given time across
+// every shard. deviceWhere optionally narrows the count to devices matching
+// a condition on agents a, with its arguments.
+func (r *Telemetry) CountSince(ctx context.Context, since time.Time, deviceWhere string, args []interface{}) (int64, error) {
+	var total int64
+	for _, shard := range r.Shards() {
+		var query string
+		var shardArgs []interface{}
+		switch {
+		case deviceWhere == "":
+			query = `SELECT COUNT(*) FROM ` + shard.Table() + ` WHERE collected_at >= $1`
+			shardArgs = []interface{}{since}
+		case shard.local:
+			query = `SELECT COUNT(*) FROM ` + shard.Table() + `
+				WHERE device_id IN (SELECT a.device_id FROM agents a WHERE TRUE` + deviceWhere + `)
+				  AND collected_at >= $` + strconv.Itoa(len(args)+1)
+			shardArgs = append(args[:len(args):len(args)], since)
+		default:
+			ids, err := r.shardDevices(ctx, shard, deviceWhere, args)
+			if err != nil {
+				return 0, err
+			}
+			query = `SELECT COUNT(*) FROM ` + shard.Table() + ` WHERE device_id = ANY($1) AND collected_at >= $2`
+			shardArgs = []interface{}{ids, since}
+		}
+
+		var count int64
+		if err := shard.replica.QueryRow(ctx, query, shardArgs...).Scan(&count); err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// DeleteDevice deletes a device's telemetry history from its shard and
+// returns how many rows went
+func (r *Telemetry) DeleteDevice(ctx context.Context, deviceID uuid.UUID) (int64, error) {
+	shard, err := r.ForDevice(ctx, deviceID)
+	if err != nil {
+		return 0, err
+	}
+	tag, err := shard.db.Exec(ctx, `DELETE FROM `+shard.Table()+` WHERE device_id = $1`, deviceID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// PruneOrg deletes an org's telemetry older than days and returns how many
+// rows went
+func (r *Telemetry) PruneOrg(ctx context.Context, orgID int64, days int) (int64, error) {
+	shard := r.ForOrg(orgID)
+	query := `DELETE FROM ` + shard.Table() + `
+		WHERE device_id IN (SELECT device_id FROM agents WHERE org_id = $1)
+		  AND collected_at < NOW() - make_interval(days => $2)`
+	args := []interface{}{orgID, days}
+	if !shard.local {
+		ids, err := r.shardDevices(ctx, shard, " AND a.org_id = $1", []interface{}{orgID})
+		if err != nil {
+			return 0, err
+		}
+		query = `DELETE FROM ` + shard.Table() + `
+			WHERE device_id = ANY($1) AND collected_at < NOW() - make_interval(days => $2)`
+		args = []interface{}{ids, days}
+	}
+
+	tag, err := shard.db.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RowsByOrg counts the raw telemetry rows each org has stored across every
+// shard. Rows of devices no longer registered aren't counted. It reads
+// every shard in full, so it is meant for occasional metering runs.
+func (r *Telemetry) RowsByOrg(ctx context.Context) (map[int64]int64, error) {
+	counts := make(map[int64]int64)
+	for _, shard := range r.Shards() {
+		if shard.local {
+			rows, err := shard.replica.Query(ctx, `
+				SELECT a.org_id, COUNT(*) FROM `+shard.Table()+` t
+				JOIN agents a ON a.device_id = t.device_id
+				WHERE a.org_id IS NOT NULL
+				GROUP BY a.org_id`)
+			if err != nil {
+				return nil, err
+			}
+			if err := scanOrgCounts(rows, counts); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// A shard in another database can't join agents, so its counts per
+		// device are attributed to orgs on the primary
+		rows, err := shard.replica.Query(ctx, `SELECT device_id, COUNT(*) FROM `+shard.Table()+` GROUP BY device_id`)
+		if err != nil {
+			return nil, err
+		}
+		var ids []uuid.UUID
+		var deviceCounts []int64
+		for rows.Next() {
+			var id uuid.UUID
+			var count int64
+			if err := rows.Scan(&id, &count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+			deviceCounts = append(deviceCounts, count)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		rows, err = r.primary.replica.Query(ctx, `
+			SELECT a.org_id, SUM(d.count)::bigint
+			FROM unnest($1::uuid[], $2::bigint[]) AS d(device_id, count)
+			JOIN agents a ON a.device_id = d.device_id
+			WHERE a.org_id IS NOT NULL
+			GROUP BY a.org_id`, ids, deviceCounts)
+		if err != nil {
+			return nil, err
+		}
+		if err := scanOrgCounts(rows, counts); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// scanOrgCounts adds rows of org IDs and counts to counts
+func scanOrgCounts(rows pgx.Rows, counts map[int64]int64) error {
+	defer rows.Close()
+	for rows.Next() {
+		var orgID, count int64
+		if err := rows.Scan(&orgID, &count); err != nil {
+			return err
+		}
+		counts[orgID] += count
+	}
+	return rows.Err()
+}
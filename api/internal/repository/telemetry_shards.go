@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+)
+
+// DefaultShard names the telemetry table in the primary database, which
+// holds the telemetry of every org the shard map doesn't assign elsewhere
+const DefaultShard = "default"
+
+// ShardMap moves the raw telemetry of large orgs out of the shared
+// telemetry table. Each shard is a schema in the primary database, a
+// separate database, or a schema in a separate database.
+type ShardMap struct {
+	Shards []ShardConfig `json:"shards"`
+}
+
+// ShardConfig is one shard and the orgs whose telemetry it holds.
+// DatabaseURL empty means the primary database and Schema empty means
+// public; at least one of them must be set. ReplicaURL optionally serves
+// the shard's reads.
+type ShardConfig struct {
+	Name        string  `json:"name"`
+	DatabaseURL string  `json:"database_url"`
+	ReplicaURL  string  `json:"replica_url"`
+	Schema      string  `json:"schema"`
+	Orgs        []int64 `json:"orgs"`
+}
+
+// LoadShardMap reads a shard map from a JSON file
+func LoadShardMap(path string) (*ShardMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m ShardMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid shard map: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("invalid shard map: %w", err)
+	}
+	return &m, nil
+}
+
+func (m *ShardMap) validate() error {
+	names := make(map[string]bool)
+	orgs := make(map[int64]string)
+	for _, shard := range m.Shards {
+		if shard.Name == "" || shard.Name == DefaultShard {
+			return fmt.Errorf("shard name %q is reserved or empty", shard.Name)
+		}
+		if names[shard.Name] {
+			return fmt.Errorf("shard %s is defined twice", shard.Name)
+		}
+		names[shard.Name] = true
+		if shard.DatabaseURL == "" && (shard.Schema == "" || shard.Schema == "public") {
+			return fmt.Errorf("shard %s needs a database_url or a schema other than public", shard.Name)
+		}
+		for _, orgID := range shard.Orgs {
+			if other, ok := orgs[orgID]; ok {
+				return fmt.Errorf("org %d is assigned to shards %s and %s", orgID, other, shard.Name)
+			}
+			orgs[orgID] = shard.Name
+		}
+	}
+	return nil
+}
+
+// TelemetryShard is where the raw telemetry of a set of orgs is stored
+type TelemetryShard struct {
+	name    string
+	db      *pgxpool.Pool
+	replica *pgxpool.Pool
+	schema  string
+	local   bool
+	orgs    []int64
+	owned   []*pgxpool.Pool
+}
+
+func (s *TelemetryShard) Name() string { return s.name }
+
+// DB is the pool writes to the shard go through
+func (s *TelemetryShard) DB() *pgxpool.Pool { return s.db }
+
+// Replica is the pool the shard is read from, which may be DB itself
+func (s *TelemetryShard) Replica() *pgxpool.Pool { return s.replica }
+
+// Schema is the schema holding the shard's telemetry table and partitions
+func (s *TelemetryShard) Schema() string { return s.schema }
+
+// Table is the quoted, schema-qualified name of the shard's telemetry table
+func (s *TelemetryShard) Table() string {
+	return pgx.Identifier{s.schema, "telemetry"}.Sanitize()
+}
+
+// Local reports whether the shard is in the primary database, so its
+// queries can join agents and the other central tables and its writes can
+// share a transaction with them
+func (s *TelemetryShard) Local() bool { return s.local }
+
+// Telemetry routes raw telemetry reads and writes to the shard holding each
+// org's telemetry. telemetry_latest, rollups and every other table stay in
+// the primary database; only the history table is sharded. Without a shard
+// map everything goes to the default shard, the primary's telemetry table.
+type Telemetry struct {
+	db      *pgxpool.Pool
+	primary *TelemetryShard
+	shards  []*TelemetryShard
+	orgs    map[int64]*TelemetryShard
+}
+
+// NewTelemetry creates the router, connecting to the databases of shards
+// not in the primary. m may be nil. opts size the pools of those databases.
+func NewTelemetry(db, replica *pgxpool.Pool, m *ShardMap, opts database.PoolOptions) (*Telemetry, error) {
+	r := &Telemetry{
+		db:      db,
+		primary: &TelemetryShard{name: DefaultShard, db: db, replica: replica, schema: "public", local: true},
+		orgs:    make(map[int64]*TelemetryShard),
+	}
+	if m == nil {
+		return r, nil
+	}
+
+	for _, cfg := range m.Shards {
+		shard := &TelemetryShard{name: cfg.Name, db: db, replica: replica, schema: cfg.Schema, local: true, orgs: cfg.Orgs}
+		if shard.schema == "" {
+			shard.schema = "public"
+		}
+		if cfg.DatabaseURL != "" {
+			pool, err := database.Connect(cfg.DatabaseURL, opts)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("shard %s: %w", cfg.Name, err)
+			}
+			shard.db, shard.replica, shard.local = pool, pool, false
+			shard.owned = append(shard.owned, pool)
+		}
+		if cfg.ReplicaURL != "" {
+			pool, err := database.Connect(cfg.ReplicaURL, opts)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("shard %s replica: %w", cfg.Name, err)
+			}
+			shard.replica = pool
+			shard.owned = append(shard.owned, pool)
+		}
+		r.shards = append(r.shards, shard)
+		for _, orgID := range cfg.Orgs {
+			r.orgs[orgID] = shard
+		}
+	}
+	return r, nil
+}
+
+// Close closes the pools of shards in other databases
+func (r *Telemetry) Close() {
+	for _, shard := range r.shards {
+		for _, pool := range shard.owned {
+			pool.Close()
+		}
+	}
+}
+
+// Shards returns every shard, the default one first
+func (r *Telemetry) Shards() []*TelemetryShard {
+	return append([]*TelemetryShard{r.primary}, r.shards...)
+}
+
+// ForOrg returns the shard holding an org's telemetry
+func (r *Telemetry) ForOrg(orgID int64) *TelemetryShard {
+	if shard, ok := r.orgs[orgID]; ok {
+		return shard
+	}
+	return r.primary
+}
+
+// ForDevice returns the shard holding a device's telemetry. An unknown
+// device belongs to the default shard.
+func (r *Telemetry) ForDevice(ctx context.Context, deviceID uuid.UUID) (*TelemetryShard, error) {
+	if len(r.orgs) == 0 {
+		return r.primary, nil
+	}
+	var orgID *int64
+	err := r.db.QueryRow(ctx, "SELECT org_id FROM agents WHERE device_id = $1", deviceID).Scan(&orgID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if orgID == nil {
+		return r.primary, nil
+	}
+	return r.ForOrg(*orgID), nil
+}
+
+// ForDevices returns the shard of each device in one query
+func (r *Telemetry) ForDevices(ctx context.Context, deviceIDs []uuid.UUID) (map[uuid.UUID]*TelemetryShard, error) {
+	shards := make(map[uuid.UUID]*TelemetryShard, len(deviceIDs))
+	for _, id := range deviceIDs {
+		shards[id] = r.primary
+	}
+	if len(r.orgs) == 0 {
+		return shards, nil
+	}
+
+	rows, err := r.db.Query(ctx,
+		"SELECT device_id, org_id FROM agents WHERE device_id = ANY($1) AND org_id IS NOT NULL", deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var orgID int64
+		if err := rows.Scan(&id, &orgID); err != nil {
+			return nil, err
+		}
+		shards[id] = r.ForOrg(orgID)
+	}
+	return shards, rows.Err()
+}
+
+// EnsureTables creates the telemetry table of each shard kept outside the
+// public schema, shaped like public.telemetry with its generated columns,
+// keys and indexes, and adds columns public.telemetry gained since to one
+// created earlier. A shard in another database must have had the API's
+// migrations applied there first.
+func (r *Telemetry) EnsureTables(ctx context.Context) error {
+	for _, shard := range r.shards {
+		if shard.schema == "public" {
+			continue
+		}
+		_, err := shard.db.Exec(ctx, fmt.Sprintf(`
+			CREATE SCHEMA IF NOT EXISTS %s;
+			CREATE TABLE IF NOT EXISTS %s (LIKE public.telemetry INCLUDING ALL) PARTITION BY RANGE (collected_at);
+			ALTER TABLE %[2]s ADD COLUMN IF NOT EXISTS errors JSONB`,
+			pgx.Identifier{shard.schema}.Sanitize(), shard.Table()))
+		if err != nil {
+			return fmt.Errorf("shard %s: %w", shard.name, err)
+		}
+	}
+	return nil
+}
+
+// shardDevices returns the IDs of the devices of the shard's orgs matching
+// deviceWhere, a condition on agents a with its arguments. It lets queries
+// on a shard in another database filter by what only the primary knows.
+func (r *Telemetry) shardDevices(ctx context.Context, shard *TelemetryShard, deviceWhere string, args []interface{}) ([]uuid.UUID, error) {
+	query := `SELECT a.device_id FROM agents a WHERE a.org_id = ANY($` + strconv.Itoa(len(args)+1) + `)` + deviceWhere
+	rows, err := r.primary.replica.Query(ctx, query, append(args[:len(args):len(args)], shard.orgs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,121 @@
+// Package requestid identifies each API call so it can be followed through
+// logs, audit rows and the workers it queues work for. Every request gets a
+// request ID, taken from the caller's X-Request-ID or generated, and returned
+// in the response. Agents also send an X-Correlation-ID of their own with
+// each upload and command ack, which they log alongside their outcome, so a
+// failed ingestion can be traced from the agent to the database write.
+package requestid
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+// Headers carrying the IDs on HTTP requests and responses and on queued
+// NATS messages
+const (
+	HeaderRequestID     = "X-Request-ID"
+	HeaderCorrelationID = "X-Correlation-ID"
+)
+
+// Locals under which Middleware stores the IDs, for the request logger
+const (
+	LocalRequestID     = "request_id"
+	LocalCorrelationID = "correlation_id"
+)
+
+// maxIDLength bounds the IDs accepted from callers, which end up in logs and
+// audit rows
+const maxIDLength = 128
+
+type idsKey struct{}
+
+type ids struct {
+	requestID     string
+	correlationID string
+}
+
+// Middleware assigns the request its ID and keeps the caller's correlation
+// ID. Both are stored in c.UserContext() and in locals, and the request ID
+// is set on the response.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := NewContext(c.UserContext(), c.Get(HeaderRequestID), c.Get(HeaderCorrelationID))
+		c.SetUserContext(ctx)
+
+		requestID, correlationID := FromContext(ctx)
+		c.Locals(LocalRequestID, requestID)
+		c.Locals(LocalCorrelationID, correlationID)
+		c.Set(HeaderRequestID, requestID)
+		if correlationID != "" {
+			c.Set(HeaderCorrelationID, correlationID)
+		}
+
+		return c.Next()
+	}
+}
+
+// NewContext returns ctx carrying a request ID, the given one when it is
+// usable and a new one otherwise, and the caller's correlation ID, which is
+// dropped when unusable
+func NewContext(ctx context.Context, requestID, correlationID string) context.Context {
+	if !valid(requestID) {
+		requestID = uuid.NewString()
+	}
+	if !valid(correlationID) {
+		correlationID = ""
+	}
+	return context.WithValue(ctx, idsKey{}, ids{requestID: requestID, correlationID: correlationID})
+}
+
+// FromContext returns the request and correlation IDs ctx carries, empty
+// outside a request, e.g. in a worker's own runs
+func FromContext(ctx context.Context) (requestID, correlationID string) {
+	v, _ := ctx.Value(idsKey{}).(ids)
+	return v.requestID, v.correlationID
+}
+
+// InjectNATS copies the IDs in ctx into a message's headers
+func InjectNATS(ctx context.Context, msg *nats.Msg) {
+	requestID, correlationID := FromContext(ctx)
+	if requestID == "" {
+		return
+	}
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	msg.Header.Set(HeaderRequestID, requestID)
+	if correlationID != "" {
+		msg.Header.Set(HeaderCorrelationID, correlationID)
+	}
+}
+
+// Describe names the request a message was queued by, for log lines, e.g.
+// "request 3f0c..., correlation 9a1b...", or "request unknown" for a
+// message carrying no request ID.
+func Describe(msg *nats.Msg) string {
+	requestID := msg.Header.Get(HeaderRequestID)
+	if requestID == "" {
+		return "request unknown"
+	}
+	if correlationID := msg.Header.Get(HeaderCorrelationID); correlationID != "" {
+		return "request " + requestID + ", correlation " + correlationID
+	}
+	return "request " + requestID
+}
+
+// valid accepts IDs of printable ASCII up to maxIDLength
+func valid(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+// Package tracing sets up OpenTelemetry tracing: spans for HTTP requests,
+// propagation through NATS messages to the workers that consume them, and
+// spans for database queries. Spans are exported over OTLP/HTTP when an
+// endpoint is configured; otherwise tracing is a no-op.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/yourorg/inventory-agent/api"
+
+// Tracer creates the API's spans. Until Init installs a provider its spans
+// are discarded.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Init exports spans to the OTLP/HTTP endpoint, e.g.
+// http://otel-collector:4318. It returns a function that flushes pending
+// spans on shutdown. With no endpoint nothing is exported, but trace context
+// arriving from agents is still passed along to the workers.
+func Init(ctx context.Context, endpoint, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	// The sampler follows OTEL_TRACES_SAMPLER, sampling every trace by default
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for each request, continuing the trace of
+// the caller's traceparent header if it sent one. Handlers reach the span
+// through c.UserContext().
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := http.Header{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			header.Add(string(key), string(value))
+		})
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), propagation.HeaderCarrier(header))
+
+		ctx, span := Tracer().Start(ctx, c.Method()+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(c.Path()),
+			))
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		// The route is only known once routing has matched the request
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			if fe, ok := err.(*fiber.Error); ok {
+				status = fe.Code
+			}
+			span.RecordError(err)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
+
+// InjectNATS adds the trace context of ctx to a message's headers so its
+// consumer can continue the trace
+func InjectNATS(ctx context.Context, msg *nats.Msg) {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+}
+
+// ExtractNATS returns the span context a message was published under, which
+// is invalid when the message carries none
+func ExtractNATS(msg *nats.Msg) trace.SpanContext {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(msg.Header))
+	return trace.SpanContextFromContext(ctx)
+}
+
+// MessagingAttributes describe a NATS subject on producer and consumer spans
+func MessagingAttributes(subject string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "nats"),
+		semconv.MessagingDestinationName(subject),
+	}
+}
@@ -0,0 +1,22 @@
+// Package version holds the API's build metadata, set at link time:
+//
+//	go build -ldflags "-X github.com/yourorg/inventory-agent/api/internal/version.Version=1.4.0 \
+//	  -X github.com/yourorg/inventory-agent/api/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/yourorg/inventory-agent/api/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// The Makefile and Dockerfile pass them. Plain go build leaves the defaults.
+package version
+
+var (
+	// Version is the release, e.g. "1.4.0"
+	Version = "dev"
+	// Commit is the git commit built from
+	Commit = "unknown"
+	// Date is when the binary was built, in RFC 3339
+	Date = "unknown"
+)
+
+// String describes the build, e.g. "1.4.0 (commit 3f0c2a1, built 2024-05-01T12:00:00Z)"
+func String() string {
+	return Version + " (commit " + Commit + ", built " + Date + ")"
+}
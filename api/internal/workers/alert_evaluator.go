@@ -0,0 +1,138 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// AlertEvaluator evaluates alert rules against latest telemetry. Each device
+// is evaluated as its telemetry is written; a periodic pass over the whole
+// fleet catches devices that stop reporting and rules that were just added
+// or changed. State changes are published as alert events, which webhooks
+// can subscribe to.
+type AlertEvaluator struct {
+	db        *pgxpool.Pool
+	publisher *events.Publisher
+	interval  time.Duration
+	pending   chan uuid.UUID
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewAlertEvaluator(db *pgxpool.Pool, publisher *events.Publisher, interval time.Duration) *AlertEvaluator {
+	return &AlertEvaluator{
+		db:        db,
+		publisher: publisher,
+		interval:  interval,
+		pending:   make(chan uuid.UUID, 1024),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+func (e *AlertEvaluator) Start(ctx context.Context) error {
+	e.wg.Add(1)
+	go e.run(ctx)
+	slog.Info("Alert evaluator started")
+	return nil
+}
+
+func (e *AlertEvaluator) Stop() {
+	close(e.stopCh)
+	e.wg.Wait()
+	slog.Info("Alert evaluator stopped")
+}
+
+func (e *AlertEvaluator) run(ctx context.Context) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case deviceID := <-e.pending:
+			e.evaluate(ctx, &deviceID)
+		case <-ticker.C:
+			e.evaluate(ctx, nil)
+
+			resolved, err := database.ResolveDisabledAlerts(ctx, e.db)
+			if err != nil {
+				slog.Error("Failed to resolve alerts of disabled rules", "error", err)
+			}
+			e.publish(resolved)
+		}
+	}
+}
+
+// EvaluateDevice queues a device for evaluation against every enabled rule
+// without blocking the caller. When the queue is full the device waits for
+// the next periodic pass. A nil AlertEvaluator does nothing.
+func (e *AlertEvaluator) EvaluateDevice(deviceID uuid.UUID) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.pending <- deviceID:
+	default:
+	}
+}
+
+func (e *AlertEvaluator) evaluate(ctx context.Context, deviceID *uuid.UUID) {
+	rules, err := e.enabledRules(ctx)
+	if err != nil {
+		slog.Error("Failed to load alert rules", "error", err)
+		return
+	}
+
+	for i := range rules {
+		changed, err := database.EvaluateAlertRule(ctx, e.db, &rules[i], deviceID)
+		if err != nil {
+			slog.Error("Failed to evaluate alert rule", "rule_id", rules[i].RuleID, "error", err)
+			continue
+		}
+		e.publish(changed)
+	}
+}
+
+func (e *AlertEvaluator) publish(alerts []models.Alert) {
+	for _, alert := range alerts {
+		e.publisher.Publish(models.AlertEvent(alert))
+	}
+}
+
+func (e *AlertEvaluator) enabledRules(ctx context.Context) ([]models.AlertRule, error) {
+	rows, err := e.db.Query(ctx, `
+		SELECT rule_id, name, kind, COALESCE(metric, ''), COALESCE(field, ''), COALESCE(percent_of, ''),
+		       COALESCE(operator, ''), threshold, severity, group_id
+		FROM alert_rules
+		WHERE enabled
+		ORDER BY rule_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.AlertRule
+	for rows.Next() {
+		var r models.AlertRule
+		err := rows.Scan(&r.RuleID, &r.Name, &r.Kind, &r.Metric, &r.Field, &r.PercentOf,
+			&r.Operator, &r.Threshold, &r.Severity, &r.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
@@ -2,37 +2,42 @@ package workers
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/models"
 )
 
 type CommandExpirer struct {
-	db     *pgxpool.Pool
-	stopCh chan struct{}
-	wg     sync.WaitGroup
+	db        *pgxpool.Pool
+	publisher *events.Publisher
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
 }
 
-func NewCommandExpirer(db *pgxpool.Pool) *CommandExpirer {
+func NewCommandExpirer(db *pgxpool.Pool, publisher *events.Publisher) *CommandExpirer {
 	return &CommandExpirer{
-		db:     db,
-		stopCh: make(chan struct{}),
+		db:        db,
+		publisher: publisher,
+		stopCh:    make(chan struct{}),
 	}
 }
 
 func (e *CommandExpirer) Start(ctx context.Context) error {
 	e.wg.Add(1)
 	go e.run(ctx)
-	log.Println("Command expirer started")
+	slog.Info("Command expirer started")
 	return nil
 }
 
 func (e *CommandExpirer) Stop() {
 	close(e.stopCh)
 	e.wg.Wait()
-	log.Println("Command expirer stopped")
+	slog.Info("Command expirer stopped")
 }
 
 func (e *CommandExpirer) run(ctx context.Context) {
@@ -49,6 +54,7 @@ func (e *CommandExpirer) run(ctx context.Context) {
 			return
 		case <-ticker.C:
 			e.expireCommands()
+			e.pruneArtifacts()
 		}
 	}
 }
@@ -56,18 +62,50 @@ func (e *CommandExpirer) run(ctx context.Context) {
 func (e *CommandExpirer) expireCommands() {
 	ctx := context.Background()
 
-	result, err := e.db.Exec(ctx, `
+	rows, err := e.db.Query(ctx, `
 		UPDATE commands
 		SET status = 'expired'
 		WHERE status = 'pending'
-		  AND issued_at + (ttl_seconds || ' seconds')::interval < NOW()`)
+		  AND COALESCE(not_before, issued_at) + (ttl_seconds || ' seconds')::interval < NOW()
+		RETURNING command_id, device_id`)
 
 	if err != nil {
-		log.Printf("Failed to expire commands: %v", err)
+		slog.Error("Failed to expire commands", "error", err)
 		return
 	}
+	defer rows.Close()
 
-	if rowsAffected := result.RowsAffected(); rowsAffected > 0 {
-		log.Printf("Expired %d stale commands", rowsAffected)
+	var rowsAffected int
+	for rows.Next() {
+		var commandID, deviceID uuid.UUID
+		if err := rows.Scan(&commandID, &deviceID); err != nil {
+			slog.Error("Failed to scan expired command", "error", err)
+			return
+		}
+		e.publisher.Publish(models.CommandStatusEvent(commandID, deviceID, "expired"))
+		rowsAffected++
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Failed to expire commands", "error", err)
+		return
 	}
-}
\ No newline at end of file
+
+	if rowsAffected > 0 {
+		slog.Info("Expired stale commands", "count", rowsAffected)
+	}
+}
+
+// pruneArtifacts deletes command artifacts whose upload was abandoned: not
+// complete a day after it started
+func (e *CommandExpirer) pruneArtifacts() {
+	tag, err := e.db.Exec(context.Background(), `
+		DELETE FROM command_artifacts
+		WHERE completed_at IS NULL AND created_at < NOW() - INTERVAL '1 day'`)
+	if err != nil {
+		slog.Error("Failed to prune abandoned command artifacts", "error", err)
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		slog.Info("Pruned abandoned command artifacts", "count", tag.RowsAffected())
+	}
+}
@@ -0,0 +1,213 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// CommandScheduler creates the commands of schedules that have come due: one
+// command for a device schedule, a command batch for a group schedule.
+// Quarantined devices and devices whose policy doesn't allow the command
+// type are skipped. A schedule that missed runs while the API was down runs
+// once and then resumes at its next future time.
+type CommandScheduler struct {
+	db        *pgxpool.Pool
+	publisher *events.Publisher
+	approval  map[string]bool
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewCommandScheduler creates the scheduler; commands of the approvalTypes
+// are created awaiting approval, requested by the schedule's creator
+func NewCommandScheduler(db *pgxpool.Pool, publisher *events.Publisher, approvalTypes []string) *CommandScheduler {
+	approval := make(map[string]bool, len(approvalTypes))
+	for _, t := range approvalTypes {
+		approval[t] = true
+	}
+	return &CommandScheduler{
+		db:        db,
+		publisher: publisher,
+		approval:  approval,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+func (s *CommandScheduler) Start(ctx context.Context) error {
+	s.wg.Add(1)
+	go s.run(ctx)
+	slog.Info("Command scheduler started")
+	return nil
+}
+
+func (s *CommandScheduler) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+	slog.Info("Command scheduler stopped")
+}
+
+func (s *CommandScheduler) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDue(ctx)
+		}
+	}
+}
+
+// runDue runs every due schedule, each in its own transaction. A schedule
+// that fails is skipped for the rest of the pass so it can't hold up the
+// others.
+func (s *CommandScheduler) runDue(ctx context.Context) {
+	failed := []int64{}
+	for {
+		scheduleID, err := s.runNext(ctx, failed)
+		if err != nil {
+			slog.Error("Failed to run command schedule", "schedule_id", scheduleID, "error", err)
+			if scheduleID == 0 {
+				return
+			}
+			failed = append(failed, scheduleID)
+			continue
+		}
+		if scheduleID == 0 {
+			return
+		}
+	}
+}
+
+// runNext runs the earliest due schedule not in skip and returns its ID, or
+// 0 when none is due
+func (s *CommandScheduler) runNext(ctx context.Context, skip []int64) (int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var sch models.CommandSchedule
+	err = tx.QueryRow(ctx, `
+		SELECT schedule_id, name, type, parameters, ttl_seconds, device_id, group_id, cron, timezone,
+		       COALESCE(created_by, '')
+		FROM command_schedules
+		WHERE enabled AND next_run_at <= NOW() AND schedule_id <> ALL($1)
+		ORDER BY next_run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`, skip).Scan(
+		&sch.ScheduleID, &sch.Name, &sch.Type, &sch.Parameters, &sch.TTLSeconds, &sch.DeviceID, &sch.GroupID,
+		&sch.Cron, &sch.Timezone, &sch.CreatedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	status := "pending"
+	if s.approval[sch.Type] {
+		status = "awaiting_approval"
+	}
+
+	var created int64
+	if sch.DeviceID != nil {
+		created, err = s.createDeviceCommand(ctx, tx, &sch, status)
+	} else {
+		created, err = s.createGroupCommands(ctx, tx, &sch, status)
+	}
+	if err != nil {
+		return sch.ScheduleID, err
+	}
+
+	// A schedule whose cron or timezone no longer resolves is disabled
+	// rather than retried every pass
+	next, err := sch.NextRun(time.Now())
+	enabled := err == nil
+	if err != nil {
+		slog.Warn("Disabling command schedule", "schedule", sch.Name, "reason", err)
+		next = time.Now()
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE command_schedules SET last_run_at = NOW(), next_run_at = $2, enabled = $3
+		WHERE schedule_id = $1`, sch.ScheduleID, next, enabled)
+	if err != nil {
+		return sch.ScheduleID, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return sch.ScheduleID, err
+	}
+
+	if deviceIDs, err := database.DueCommandDevices(ctx, s.db, "schedule_id = $1", sch.ScheduleID); err != nil {
+		slog.Error("Failed to find devices to notify of commands", "error", err)
+	} else {
+		s.publisher.NotifyCommands(deviceIDs...)
+	}
+
+	slog.Info("Command schedule created commands", "schedule", sch.Name, "count", created)
+	return sch.ScheduleID, nil
+}
+
+func (s *CommandScheduler) createDeviceCommand(ctx context.Context, tx pgx.Tx, sch *models.CommandSchedule, status string) (int64, error) {
+	result, err := tx.Exec(ctx, `
+		INSERT INTO commands (device_id, type, parameters, ttl_seconds, status, requested_by, schedule_id)
+		SELECT a.device_id, $2, $3, $4, $5, NULLIF($6, ''), $7
+		FROM agents a WHERE a.device_id = $1 AND a.status <> 'retired' AND `+database.CommandAllowedSQL("a.device_id", 2),
+		sch.DeviceID, sch.Type, sch.Parameters, sch.TTLSeconds, status, sch.CreatedBy, sch.ScheduleID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// createGroupCommands fans the schedule's command out to the group's
+// members through a command batch, like a group command created by an
+// admin. Nothing is recorded if no member may receive the command.
+func (s *CommandScheduler) createGroupCommands(ctx context.Context, tx pgx.Tx, sch *models.CommandSchedule, status string) (int64, error) {
+	batchID := uuid.New()
+	_, err := tx.Exec(ctx, `
+		INSERT INTO command_batches (batch_id, type, parameters, ttl_seconds, target_type, target_group_id, created_by, schedule_id)
+		VALUES ($1, $2, $3, $4, 'group', $5, NULLIF($6, ''), $7)`,
+		batchID, sch.Type, sch.Parameters, sch.TTLSeconds, sch.GroupID, sch.CreatedBy, sch.ScheduleID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO commands (device_id, type, parameters, ttl_seconds, status, batch_id, requested_by, schedule_id)
+		SELECT m.device_id, $2, $3, $4, $5, $6, NULLIF($7, ''), $8
+		FROM device_group_members m
+		WHERE m.group_id = $1 AND `+database.CommandAllowedSQL("m.device_id", 2),
+		sch.GroupID, sch.Type, sch.Parameters, sch.TTLSeconds, status, batchID, sch.CreatedBy, sch.ScheduleID)
+	if err != nil {
+		return 0, err
+	}
+
+	created := result.RowsAffected()
+	if created == 0 {
+		_, err = tx.Exec(ctx, "DELETE FROM command_batches WHERE batch_id = $1", batchID)
+	} else {
+		_, err = tx.Exec(ctx,
+			"UPDATE command_batches SET device_count = $2 WHERE batch_id = $1", batchID, created)
+	}
+	return created, err
+}
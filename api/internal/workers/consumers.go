@@ -0,0 +1,35 @@
+package workers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// TelemetryStream is the JetStream stream agents' reports are queued on
+const TelemetryStream = "TELEMETRY"
+
+// ensureConsumer creates a durable pull consumer, or brings an existing
+// one's ack wait and redelivery limit up to date. JetStream won't change
+// where an existing consumer starts delivering, so that is kept.
+func ensureConsumer(js nats.JetStreamContext, stream string, cfg *nats.ConsumerConfig) error {
+	info, err := js.ConsumerInfo(stream, cfg.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(stream, cfg)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg.DeliverPolicy = info.Config.DeliverPolicy
+	cfg.OptStartSeq = info.Config.OptStartSeq
+	cfg.OptStartTime = info.Config.OptStartTime
+	_, err = js.UpdateConsumer(stream, cfg)
+	return err
+}
+
+// fetchBackoff is how long a consumer waits after a failed fetch, such as
+// while NATS is reconnecting, before fetching again
+const fetchBackoff = 2 * time.Second
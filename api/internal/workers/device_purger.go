@@ -0,0 +1,125 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/audit"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// DevicePurger deletes the telemetry and records of retired devices whose
+// purge has been requested through the device delete endpoint.
+type DevicePurger struct {
+	db        *pgxpool.Pool
+	telemetry *repository.Telemetry
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewDevicePurger(db *pgxpool.Pool, telemetry *repository.Telemetry) *DevicePurger {
+	return &DevicePurger{
+		db:        db,
+		telemetry: telemetry,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+func (p *DevicePurger) Start(ctx context.Context) error {
+	p.wg.Add(1)
+	go p.run(ctx)
+	slog.Info("Device purger started")
+	return nil
+}
+
+func (p *DevicePurger) Stop() {
+	close(p.stopCh)
+	p.wg.Wait()
+	slog.Info("Device purger stopped")
+}
+
+func (p *DevicePurger) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.purgeDevices()
+		}
+	}
+}
+
+func (p *DevicePurger) purgeDevices() {
+	ctx := context.Background()
+
+	rows, err := p.db.Query(ctx, `
+		SELECT device_id FROM agents
+		WHERE status = 'retired' AND purge_after IS NOT NULL AND purge_after <= NOW()
+		LIMIT 100`)
+	if err != nil {
+		slog.Error("Failed to query devices to purge", "error", err)
+		return
+	}
+
+	var deviceIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			slog.Error("Failed to scan device to purge", "error", err)
+			rows.Close()
+			return
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	rows.Close()
+
+	for _, id := range deviceIDs {
+		if err := p.purgeDevice(ctx, id); err != nil {
+			slog.Error("Failed to purge device", "device_id", id, "error", err)
+		}
+	}
+
+	if len(deviceIDs) > 0 {
+		slog.Info("Purged retired devices", "count", len(deviceIDs))
+	}
+}
+
+// purgeDevice removes a device's telemetry history and then its record;
+// telemetry_latest, policies and commands go with it via ON DELETE CASCADE.
+// The history is deleted first, while the record still locates its shard.
+func (p *DevicePurger) purgeDevice(ctx context.Context, deviceID uuid.UUID) error {
+	telemetryRows, err := p.telemetry.DeleteDevice(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM agents WHERE device_id = $1 AND status = 'retired'", deviceID)
+	if err != nil {
+		return err
+	}
+
+	err = audit.Record(ctx, tx, "system", "purge", "agent", deviceID.String(),
+		map[string]interface{}{"telemetry_rows": telemetryRows})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,192 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/export"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// ExportRunner produces the files for queued export jobs and deletes them
+// once they expire.
+type ExportRunner struct {
+	db        *pgxpool.Pool
+	telemetry *repository.Telemetry
+	dir       string
+	retention time.Duration
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewExportRunner(db *pgxpool.Pool, telemetry *repository.Telemetry, dir string, retention time.Duration) *ExportRunner {
+	return &ExportRunner{
+		db:        db,
+		telemetry: telemetry,
+		dir:       dir,
+		retention: retention,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+func (r *ExportRunner) Start(ctx context.Context) error {
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		return err
+	}
+
+	r.wg.Add(1)
+	go r.run(ctx)
+	slog.Info("Export runner started", "dir", r.dir)
+	return nil
+}
+
+func (r *ExportRunner) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+	slog.Info("Export runner stopped")
+}
+
+func (r *ExportRunner) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Drain the queue before waiting for the next tick
+			for r.runNext(ctx) {
+			}
+		case <-cleanup.C:
+			r.removeExpired(ctx)
+		}
+	}
+}
+
+// runNext claims and runs one pending job, reporting whether one was found
+func (r *ExportRunner) runNext(ctx context.Context) bool {
+	var (
+		jobID  uuid.UUID
+		kind   string
+		format string
+		params url.Values
+	)
+	err := r.db.QueryRow(ctx, `
+		UPDATE export_jobs SET status = 'running', started_at = NOW()
+		WHERE job_id = (
+			SELECT job_id FROM export_jobs
+			WHERE status = 'pending'
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING job_id, kind, format, params`).Scan(&jobID, &kind, &format, &params)
+	if err == pgx.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to claim export job", "error", err)
+		return false
+	}
+
+	path := filepath.Join(r.dir, jobID.String()+"."+format)
+	rowCount, err := r.writeFile(ctx, kind, format, params, path)
+	if err != nil {
+		slog.Error("Export job failed", "job_id", jobID, "error", err)
+		os.Remove(path)
+		_, err = r.db.Exec(ctx, `
+			UPDATE export_jobs SET status = 'failed', error = $2, completed_at = NOW(),
+			       expires_at = NOW() + make_interval(secs => $3)
+			WHERE job_id = $1`, jobID, err.Error(), r.retention.Seconds())
+		if err != nil {
+			slog.Error("Failed to mark export job failed", "job_id", jobID, "error", err)
+		}
+		return true
+	}
+
+	_, err = r.db.Exec(ctx, `
+		UPDATE export_jobs SET status = 'completed', row_count = $2, file_path = $3,
+		       completed_at = NOW(), expires_at = NOW() + make_interval(secs => $4)
+		WHERE job_id = $1`, jobID, rowCount, path, r.retention.Seconds())
+	if err != nil {
+		slog.Error("Failed to mark export job completed", "job_id", jobID, "error", err)
+		return true
+	}
+
+	slog.Info("Export job completed", "job_id", jobID, "rows", rowCount, "kind", kind)
+	return true
+}
+
+func (r *ExportRunner) writeFile(ctx context.Context, kind, format string, params url.Values, path string) (int64, error) {
+	q, err := export.Build(kind, params)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w, err := export.NewWriter(format, f)
+	if err != nil {
+		return 0, err
+	}
+
+	rowCount, err := export.Run(ctx, r.db, r.telemetry, q, w)
+	if err != nil {
+		return rowCount, err
+	}
+	if err := w.Close(); err != nil {
+		return rowCount, err
+	}
+	return rowCount, f.Close()
+}
+
+// removeExpired deletes expired jobs and their files
+func (r *ExportRunner) removeExpired(ctx context.Context) {
+	rows, err := r.db.Query(ctx, `
+		DELETE FROM export_jobs WHERE expires_at <= NOW()
+		RETURNING COALESCE(file_path, '')`)
+	if err != nil {
+		slog.Error("Failed to delete expired export jobs", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	var removed int
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			slog.Error("Failed to scan expired export job", "error", err)
+			return
+		}
+		if path != "" {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				slog.Error("Failed to remove export file", "path", path, "error", err)
+			}
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		slog.Info("Removed expired export jobs", "count", removed)
+	}
+}
@@ -0,0 +1,62 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/quota"
+)
+
+// IngestUsagePruner deletes the ingest usage counted in quota windows
+// that have ended, keeping the previous day for admins to look back on
+type IngestUsagePruner struct {
+	db     *pgxpool.Pool
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewIngestUsagePruner(db *pgxpool.Pool) *IngestUsagePruner {
+	return &IngestUsagePruner{
+		db:     db,
+		stopCh: make(chan struct{}),
+	}
+}
+
+func (p *IngestUsagePruner) Start(ctx context.Context) error {
+	p.wg.Add(1)
+	go p.run(ctx)
+	slog.Info("Ingest usage pruner started")
+	return nil
+}
+
+func (p *IngestUsagePruner) Stop() {
+	close(p.stopCh)
+	p.wg.Wait()
+	slog.Info("Ingest usage pruner stopped")
+}
+
+func (p *IngestUsagePruner) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := quota.PruneUsage(ctx, p.db)
+			if err != nil {
+				slog.Error("Failed to prune ingest usage", "error", err)
+			} else if deleted > 0 {
+				slog.Info("Pruned ingest usage windows", "count", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	telemetryv1 "github.com/yourorg/inventory-agent/shared/proto/telemetry/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	kafkaConsumerName = "kafka-bridge"
+	kafkaConsumerWait = time.Minute
+	kafkaBatchSize    = 500
+	// kafkaBackoff is how long the bridge waits after Kafka rejects a
+	// batch before fetching it again
+	kafkaBackoff = 10 * time.Second
+)
+
+// Serializations the Kafka bridge can publish telemetry in
+const (
+	KafkaSerializationJSON     = "json"
+	KafkaSerializationProtobuf = "protobuf"
+)
+
+// KafkaBridge mirrors telemetry queued on JetStream to a Kafka topic. It
+// reads through a durable consumer of its own, so it sees every report the
+// telemetry writer does and a Kafka outage doesn't hold up ingest. Records
+// are keyed by device ID, keeping each device's reports in order within a
+// partition.
+type KafkaBridge struct {
+	js            nats.JetStreamContext
+	writer        *kafka.Writer
+	serialization string
+	sub           *nats.Subscription
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewKafkaBridge creates a bridge publishing to topic on brokers, with
+// records serialized as json or protobuf (telemetryv1.TelemetryRecord)
+func NewKafkaBridge(js nats.JetStreamContext, brokers []string, topic, serialization string) (*KafkaBridge, error) {
+	if serialization != KafkaSerializationJSON && serialization != KafkaSerializationProtobuf {
+		return nil, fmt.Errorf("unknown Kafka serialization %q", serialization)
+	}
+
+	return &KafkaBridge{
+		js: js,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchSize:    kafkaBatchSize,
+			Compression:  kafka.Snappy,
+		},
+		serialization: serialization,
+		stopCh:        make(chan struct{}),
+	}, nil
+}
+
+func (b *KafkaBridge) Start(ctx context.Context) error {
+	// A new durable consumer starts with new telemetry rather than
+	// replaying the stream. Deliveries aren't limited: telemetry waits on
+	// the stream for as long as Kafka is unavailable.
+	err := ensureConsumer(b.js, TelemetryStream, &nats.ConsumerConfig{
+		Durable:       kafkaConsumerName,
+		FilterSubject: "telemetry.ingest",
+		DeliverPolicy: nats.DeliverNewPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       kafkaConsumerWait,
+		MaxDeliver:    -1,
+	})
+	if err != nil {
+		return err
+	}
+
+	sub, err := b.js.PullSubscribe("telemetry.ingest", kafkaConsumerName, nats.Bind(TelemetryStream, kafkaConsumerName))
+	if err != nil {
+		return err
+	}
+	b.sub = sub
+
+	b.wg.Add(1)
+	go b.run(ctx)
+	slog.Info("Kafka bridge started", "serialization", b.serialization, "topic", b.writer.Topic)
+	return nil
+}
+
+func (b *KafkaBridge) Stop() {
+	if b.sub != nil {
+		b.sub.Unsubscribe()
+	}
+	close(b.stopCh)
+	b.wg.Wait()
+	if err := b.writer.Close(); err != nil {
+		slog.Error("Failed to close Kafka writer", "error", err)
+	}
+	slog.Info("Kafka bridge stopped")
+}
+
+func (b *KafkaBridge) run(ctx context.Context) {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		default:
+			msgs, err := b.sub.Fetch(kafkaBatchSize, nats.MaxWait(5*time.Second))
+			if err != nil {
+				if err != nats.ErrTimeout {
+					slog.Error("Failed to fetch telemetry for Kafka", "error", err)
+					b.wait(ctx, fetchBackoff)
+				}
+				continue
+			}
+
+			if err := b.publish(ctx, msgs); err != nil {
+				slog.Error("Failed to publish telemetry to Kafka", "error", err)
+				for _, msg := range msgs {
+					msg.Nak()
+				}
+				b.wait(ctx, kafkaBackoff)
+			}
+		}
+	}
+}
+
+// publish writes a fetched batch to Kafka and acks it once Kafka has. A
+// message that can't be decoded is terminated: it would never succeed.
+func (b *KafkaBridge) publish(ctx context.Context, msgs []*nats.Msg) error {
+	records := make([]kafka.Message, 0, len(msgs))
+	published := make([]*nats.Msg, 0, len(msgs))
+	for _, msg := range msgs {
+		record, err := b.record(msg.Data)
+		if err != nil {
+			slog.Error("Failed to encode telemetry for Kafka", "error", err)
+			msg.Term()
+			continue
+		}
+		records = append(records, record)
+		published = append(published, msg)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := b.writer.WriteMessages(ctx, records...); err != nil {
+		return err
+	}
+	for _, msg := range published {
+		msg.Ack()
+	}
+	return nil
+}
+
+// record converts a queued telemetry message to a Kafka record. The
+// ingestion ID travels as a header so consumers can drop the duplicates a
+// redelivery may produce.
+func (b *KafkaBridge) record(data []byte) (kafka.Message, error) {
+	var telemetry models.Telemetry
+	if err := json.Unmarshal(data, &telemetry); err != nil {
+		return kafka.Message{}, err
+	}
+
+	value := data
+	contentType := "application/json"
+	if b.serialization == KafkaSerializationProtobuf {
+		metrics, err := structpb.NewStruct(telemetry.Metrics)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		value, err = proto.Marshal(&telemetryv1.TelemetryRecord{
+			DeviceId:         telemetry.DeviceID.String(),
+			IngestionId:      telemetry.IngestionID.String(),
+			CollectedAt:      timestamppb.New(telemetry.CollectedAt),
+			ServerReceivedAt: timestamppb.New(telemetry.ServerReceivedAt),
+			Seq:              telemetry.Seq,
+			Metrics:          metrics,
+			Tags:             telemetry.Tags,
+			Errors:           telemetry.Errors,
+		})
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		contentType = "application/x-protobuf"
+	}
+
+	return kafka.Message{
+		Key:   []byte(telemetry.DeviceID.String()),
+		Value: value,
+		Time:  telemetry.CollectedAt,
+		Headers: []kafka.Header{
+			{Key: "ingestion_id", Value: []byte(telemetry.IngestionID.String())},
+			{Key: "content-type", Value: []byte(contentType)},
+		},
+	}, nil
+}
+
+func (b *KafkaBridge) wait(ctx context.Context, d time.Duration) {
+	select {
+	case <-b.stopCh:
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,139 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// leaderLock names the Postgres advisory lock held by the instance running
+// the singleton workers
+const leaderLock = "inventory-api:workers"
+
+// Worker is a background worker that runs until its context is done
+type Worker interface {
+	Start(ctx context.Context) error
+}
+
+// Leader runs workers that must not run on more than one API instance at a
+// time, such as those that expire commands or create partitions. Every
+// instance campaigns for a session-level advisory lock; the one holding it
+// runs the workers. The lock is released when the leader's connection
+// ends, so another instance takes over within one check interval if the
+// leader dies.
+type Leader struct {
+	db       *pgxpool.Pool
+	workers  []Worker
+	interval time.Duration
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewLeader creates a leader that checks for, and holds on to, leadership
+// every interval
+func NewLeader(db *pgxpool.Pool, interval time.Duration, workers ...Worker) *Leader {
+	return &Leader{
+		db:       db,
+		workers:  workers,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func (l *Leader) Start(ctx context.Context) error {
+	l.wg.Add(1)
+	go l.run(ctx)
+	slog.Info("Leader election started")
+	return nil
+}
+
+func (l *Leader) Stop() {
+	close(l.stopCh)
+	l.wg.Wait()
+	slog.Info("Leader election stopped")
+}
+
+func (l *Leader) run(ctx context.Context) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		conn, err := l.acquire(ctx)
+		if err != nil {
+			slog.Error("Failed to campaign for worker leadership", "error", err)
+		}
+		if conn != nil {
+			l.lead(ctx, conn)
+		}
+
+		select {
+		case <-l.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// acquire takes the leader lock on a connection of its own, or returns nil
+// when another instance holds it. The connection is taken out of the pool
+// so that the lock lives exactly as long as it does.
+func (l *Leader) acquire(ctx context.Context) (*pgx.Conn, error) {
+	pooled, err := l.db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn := pooled.Hijack()
+
+	var locked bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", leaderLock).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// lead runs the workers until leadership is lost or ctx is done. Leadership
+// is lost when the lock's connection stops answering: the server may
+// already have released the lock to another instance.
+func (l *Leader) lead(ctx context.Context, conn *pgx.Conn) {
+	defer conn.Close(context.Background())
+
+	slog.Info("Acquired worker leadership")
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for _, w := range l.workers {
+		if err := w.Start(workerCtx); err != nil {
+			slog.Error("Failed to start worker", "error", err)
+		}
+	}
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, l.interval)
+			err := conn.Ping(pingCtx)
+			pingCancel()
+			if err != nil {
+				slog.Error("Lost worker leadership", "error", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// OfflineDetector marks devices offline once they miss check-ins for
+// offlineAfter, and inactive after inactiveAfter. Each transition is audited
+// and published as a device event. Devices return to active the next time
+// they report.
+type OfflineDetector struct {
+	db            *pgxpool.Pool
+	publisher     *events.Publisher
+	offlineAfter  time.Duration
+	inactiveAfter time.Duration
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+}
+
+func NewOfflineDetector(db *pgxpool.Pool, publisher *events.Publisher, offlineAfter, inactiveAfter time.Duration) *OfflineDetector {
+	return &OfflineDetector{
+		db:            db,
+		publisher:     publisher,
+		offlineAfter:  offlineAfter,
+		inactiveAfter: inactiveAfter,
+		stopCh:        make(chan struct{}),
+	}
+}
+
+func (d *OfflineDetector) Start(ctx context.Context) error {
+	d.wg.Add(1)
+	go d.run(ctx)
+	slog.Info("Offline detector started", "offline_after", d.offlineAfter.String(), "inactive_after", d.inactiveAfter.String())
+	return nil
+}
+
+func (d *OfflineDetector) Stop() {
+	close(d.stopCh)
+	d.wg.Wait()
+	slog.Info("Offline detector stopped")
+}
+
+func (d *OfflineDetector) run(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Inactive first, so a device silent for longer than both
+			// thresholds moves straight to inactive
+			d.transition(ctx, "inactive", []string{"active", "offline"}, d.inactiveAfter, models.EventDeviceInactive)
+			d.transition(ctx, "offline", []string{"active"}, d.offlineAfter, models.EventDeviceOffline)
+		}
+	}
+}
+
+// transition moves devices in one of the from statuses that haven't been
+// seen for the threshold to status, auditing each change in the same
+// statement
+func (d *OfflineDetector) transition(ctx context.Context, status string, from []string, threshold time.Duration, eventType string) {
+	rows, err := d.db.Query(ctx, `
+		WITH stale AS (
+			SELECT device_id, status FROM agents
+			WHERE status = ANY($2) AND last_seen_at < NOW() - make_interval(secs => $3)
+			FOR UPDATE SKIP LOCKED
+		),
+		changed AS (
+			UPDATE agents a SET status = $1
+			FROM stale s
+			WHERE a.device_id = s.device_id
+			RETURNING a.device_id, a.last_seen_at, s.status AS previous_status
+		),
+		audited AS (
+			INSERT INTO audit_log (actor, action, resource_type, resource_id, details)
+			SELECT 'system', $1, 'agent', device_id::text,
+			       jsonb_build_object('previous_status', previous_status, 'last_seen_at', last_seen_at)
+			FROM changed
+		)
+		SELECT device_id, last_seen_at, previous_status FROM changed`,
+		status, from, threshold.Seconds())
+	if err != nil {
+		slog.Error("Failed to mark devices", "status", status, "error", err)
+		return
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		var (
+			deviceID       uuid.UUID
+			lastSeenAt     time.Time
+			previousStatus string
+		)
+		if err := rows.Scan(&deviceID, &lastSeenAt, &previousStatus); err != nil {
+			slog.Error("Failed to scan device", "status", status, "error", err)
+			return
+		}
+		d.publisher.Publish(models.DeviceEvent(eventType, deviceID, map[string]interface{}{
+			"previous_status": previousStatus,
+			"last_seen_at":    lastSeenAt,
+		}))
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Failed to mark devices", "status", status, "error", err)
+		return
+	}
+
+	if count > 0 {
+		slog.Info("Marked devices", "count", count, "status", status)
+	}
+}
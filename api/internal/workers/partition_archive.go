@@ -0,0 +1,166 @@
+package workers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// archiveFormat is the only archive format written so far: one JSON row
+// per line, gzip-compressed
+const archiveFormat = "ndjson.gz"
+
+// archivePartition exports a partition of a shard's telemetry, whose range
+// begins at start, to the archive store and records it in
+// telemetry_archives. Partitions of shards other than the default one are
+// recorded and stored under the shard's name. It returns nil without doing
+// anything when the partition was already archived, so a partition whose
+// drop failed isn't uploaded twice. The partition may only be dropped once
+// this returns nil.
+func (pm *PartitionManager) archivePartition(ctx context.Context, shard *repository.TelemetryShard, partition string, start time.Time) error {
+	name := strings.Trim(partition, `"`)
+	dir := start.Format("telemetry/2006/01/02/")
+	if shard.Name() != repository.DefaultShard {
+		name = shard.Name() + "/" + name
+		dir = "telemetry/" + shard.Name() + start.Format("/2006/01/02/")
+	}
+
+	var archived bool
+	err := pm.db.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM telemetry_archives WHERE partition_name = $1)", name).Scan(&archived)
+	if err != nil || archived {
+		return err
+	}
+
+	archive := models.TelemetryArchive{
+		PartitionName: name,
+		PartitionDate: start.Format("2006-01-02"),
+		Bucket:        pm.archive.Bucket(),
+		Format:        archiveFormat,
+	}
+	err = shard.DB().QueryRow(ctx, fmt.Sprintf(`
+		SELECT COUNT(DISTINCT device_id), MIN(collected_at), MAX(collected_at) FROM %s`, partition)).
+		Scan(&archive.DeviceCount, &archive.FirstCollectedAt, &archive.LastCollectedAt)
+	if err != nil {
+		return fmt.Errorf("failed to summarize partition: %w", err)
+	}
+
+	base := path.Base(name)
+	archive.ObjectKey = pm.archive.Key(dir + base + "." + archiveFormat)
+	archive.ManifestKey = pm.archive.Key(dir + base + ".manifest.json")
+
+	if err := pm.uploadPartition(ctx, shard.DB(), partition, &archive); err != nil {
+		return err
+	}
+
+	// The manifest makes the archive self-describing for whoever reads the
+	// bucket long after this database is gone
+	archive.ArchivedAt = time.Now().UTC()
+	manifest, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = pm.archive.Put(ctx, archive.ManifestKey, bytes.NewReader(manifest), "application/json")
+	if err != nil {
+		return fmt.Errorf("failed to upload manifest: %w", err)
+	}
+
+	_, err = pm.db.Exec(ctx, `
+		INSERT INTO telemetry_archives (partition_name, partition_date, bucket, object_key, manifest_key,
+		                                format, row_count, device_count, size_bytes, sha256,
+		                                first_collected_at, last_collected_at, archived_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		archive.PartitionName, start, archive.Bucket, archive.ObjectKey, archive.ManifestKey,
+		archive.Format, archive.RowCount, archive.DeviceCount, archive.SizeBytes, archive.SHA256,
+		archive.FirstCollectedAt, archive.LastCollectedAt, archive.ArchivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record archive: %w", err)
+	}
+
+	return nil
+}
+
+// uploadPartition streams the partition's rows to the archive object,
+// filling in the archive's row count, size and checksum. Rows are
+// compressed as they are read, so the partition is never held in memory.
+func (pm *PartitionManager) uploadPartition(ctx context.Context, db *pgxpool.Pool, partition string, archive *models.TelemetryArchive) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	object := &countingWriter{w: pw, hash: sha256.New()}
+
+	written := make(chan error, 1)
+	go func() {
+		err := writePartition(ctx, db, partition, object, &archive.RowCount)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	err := pm.archive.Put(ctx, archive.ObjectKey, pr, "application/gzip")
+	// Unblock the writer if the upload gave up part way
+	pr.CloseWithError(io.ErrClosedPipe)
+	cancel()
+	if writeErr := <-written; writeErr != nil && err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload partition: %w", err)
+	}
+
+	archive.SizeBytes = object.n
+	archive.SHA256 = hex.EncodeToString(object.hash.Sum(nil))
+	return nil
+}
+
+// writePartition writes every row of the partition to w as gzipped NDJSON
+func writePartition(ctx context.Context, db *pgxpool.Pool, partition string, w io.Writer, count *int64) error {
+	rows, err := db.Query(ctx, fmt.Sprintf("SELECT row_to_json(t)::text FROM %s t", partition))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	gz := gzip.NewWriter(w)
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(gz, line+"\n"); err != nil {
+			return err
+		}
+		*count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// countingWriter tracks the size and checksum of what passes through it
+type countingWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	n    int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.hash.Write(p[:n])
+	cw.n += int64(n)
+	return n, err
+}
@@ -3,37 +3,82 @@ package workers
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/archive"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
 )
 
+// Partition intervals: how much telemetry each partition holds
+const (
+	PartitionDaily   = "daily"
+	PartitionWeekly  = "weekly"
+	PartitionMonthly = "monthly"
+)
+
+// partitionLock names the advisory lock serializing partition creation, so
+// instances starting together don't race to create the same partitions
+const partitionLock = "inventory-api:partitions"
+
+// telemetryPartitions lists the partitions of the telemetry table named by
+// $1 with their bounds, read from the catalog so partitions of any interval
+// or naming are handled alike
+const telemetryPartitions = `
+	SELECT inhrelid::regclass::text,
+	       substring(pg_get_expr(child.relpartbound, child.oid) from 'FROM \(''([^'']+)''\)')::timestamptz,
+	       substring(pg_get_expr(child.relpartbound, child.oid) from 'TO \(''([^'']+)''\)')::timestamptz
+	FROM pg_inherits
+	JOIN pg_class child ON pg_inherits.inhrelid = child.oid
+	WHERE pg_inherits.inhparent = $1::regclass`
+
+// PartitionManager creates upcoming telemetry partitions in every telemetry
+// shard and enforces retention of raw telemetry and software history.
+// Retention defaults to the given number of days and can be overridden per
+// org. With an archive store, each telemetry partition is archived to it
+// before being dropped.
 type PartitionManager struct {
-	db     *pgxpool.Pool
-	stopCh chan struct{}
-	wg     sync.WaitGroup
+	db                  *pgxpool.Pool
+	telemetry           *repository.Telemetry
+	archive             *archive.Store
+	interval            string
+	horizonDays         int
+	telemetryDays       int
+	softwareHistoryDays int
+	stopCh              chan struct{}
+	wg                  sync.WaitGroup
 }
 
-func NewPartitionManager(db *pgxpool.Pool) *PartitionManager {
+// NewPartitionManager creates a manager keeping telemetry partitions of the
+// given interval created horizonDays ahead
+func NewPartitionManager(db *pgxpool.Pool, telemetry *repository.Telemetry, store *archive.Store, interval string, horizonDays, telemetryDays, softwareHistoryDays int) *PartitionManager {
 	return &PartitionManager{
-		db:     db,
-		stopCh: make(chan struct{}),
+		db:                  db,
+		telemetry:           telemetry,
+		archive:             store,
+		interval:            interval,
+		horizonDays:         horizonDays,
+		telemetryDays:       telemetryDays,
+		softwareHistoryDays: softwareHistoryDays,
+		stopCh:              make(chan struct{}),
 	}
 }
 
 func (pm *PartitionManager) Start(ctx context.Context) error {
 	pm.wg.Add(1)
 	go pm.run(ctx)
-	log.Println("Partition manager started")
+	slog.Info("Partition manager started")
 	return nil
 }
 
 func (pm *PartitionManager) Stop() {
 	close(pm.stopCh)
 	pm.wg.Wait()
-	log.Println("Partition manager stopped")
+	slog.Info("Partition manager stopped")
 }
 
 func (pm *PartitionManager) run(ctx context.Context) {
@@ -66,84 +111,296 @@ func (pm *PartitionManager) run(ctx context.Context) {
 func (pm *PartitionManager) managePartitions() {
 	ctx := context.Background()
 
-	// Create future partitions (7 days ahead)
-	if err := pm.createFuturePartitions(ctx); err != nil {
-		log.Printf("Failed to create future partitions: %v", err)
+	if err := pm.EnsurePartitions(ctx); err != nil {
+		slog.Error("Failed to create future partitions", "error", err)
 	}
 
 	// Drop old partitions (beyond retention period)
 	if err := pm.dropOldPartitions(ctx); err != nil {
-		log.Printf("Failed to drop old partitions: %v", err)
+		slog.Error("Failed to drop old partitions", "error", err)
+	}
+
+	if err := pm.pruneSoftwareHistory(ctx); err != nil {
+		slog.Error("Failed to prune software history", "error", err)
 	}
 }
 
-func (pm *PartitionManager) createFuturePartitions(ctx context.Context) error {
-	startDate := time.Now().AddDate(0, 0, 1) // Tomorrow
-	endDate := startDate.AddDate(0, 0, 7)    // 7 days ahead
+// partitionRange is a telemetry partition and the collected_at range it
+// holds, from inclusive to exclusive
+type partitionRange struct {
+	name     string
+	from, to time.Time
+}
 
-	current := startDate
-	for current.Before(endDate) {
-		partitionName := fmt.Sprintf("telemetry_y%sm%sd%s",
-			current.Format("2006"), current.Format("01"), current.Format("02"))
-		partitionStart := current.Format("2006-01-02")
+func (r partitionRange) overlaps(from, to time.Time) bool {
+	return from.Before(r.to) && r.from.Before(to)
+}
 
-		_, err := pm.db.Exec(ctx, fmt.Sprintf(`
-			CREATE TABLE IF NOT EXISTS %s PARTITION OF telemetry
-			FOR VALUES FROM ('%s') TO ('%s')`,
-			partitionName, partitionStart, current.AddDate(0, 0, 1).Format("2006-01-02")))
+// EnsurePartitions creates any missing partitions of each shard from the
+// current one through the horizon. The API runs it at startup so telemetry
+// has somewhere to go before the manager's first nightly run. A period that
+// existing partitions already cover in part, e.g. after the interval was
+// changed, has its remaining days created as daily partitions.
+func (pm *PartitionManager) EnsurePartitions(ctx context.Context) error {
+	for _, shard := range pm.telemetry.Shards() {
+		if err := pm.ensureShardPartitions(ctx, shard); err != nil {
+			return fmt.Errorf("shard %s: %w", shard.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (pm *PartitionManager) ensureShardPartitions(ctx context.Context, shard *repository.TelemetryShard) error {
+	tx, err := shard.DB().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", partitionLock); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, telemetryPartitions, shard.Table())
+	if err != nil {
+		return err
+	}
+	var existing []partitionRange
+	for rows.Next() {
+		var r partitionRange
+		var from, to *time.Time
+		if err := rows.Scan(&r.name, &from, &to); err != nil {
+			rows.Close()
+			return err
+		}
+		// A default partition has no bounds and holds whatever the others
+		// don't
+		if from != nil && to != nil {
+			r.from, r.to = *from, *to
+			existing = append(existing, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	covered := func(from, to time.Time) bool {
+		for _, r := range existing {
+			if r.overlaps(from, to) {
+				return true
+			}
+		}
+		return false
+	}
 
+	var created []string
+	create := func(r partitionRange) error {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s PARTITION OF %s
+			FOR VALUES FROM ('%s') TO ('%s')`,
+			pgx.Identifier{shard.Schema(), r.name}.Sanitize(), shard.Table(),
+			r.from.Format(time.RFC3339), r.to.Format(time.RFC3339)))
 		if err != nil {
-			return fmt.Errorf("failed to create partition %s: %w", partitionName, err)
+			return fmt.Errorf("failed to create partition %s: %w", r.name, err)
 		}
+		existing = append(existing, r)
+		created = append(created, r.name)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	horizon := now.AddDate(0, 0, pm.horizonDays)
+	for from := periodStart(now, pm.interval); !from.After(horizon); {
+		to := periodEnd(from, pm.interval)
+		if !covered(from, to) {
+			if err := create(partitionRange{name: partitionName(from, pm.interval), from: from, to: to}); err != nil {
+				return err
+			}
+		} else {
+			for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+				next := day.AddDate(0, 0, 1)
+				if covered(day, next) {
+					continue
+				}
+				if err := create(partitionRange{name: partitionName(day, PartitionDaily), from: day, to: next}); err != nil {
+					return err
+				}
+			}
+		}
+		from = to
+	}
 
-		current = current.AddDate(0, 0, 1)
+	if err := tx.Commit(ctx); err != nil {
+		return err
 	}
 
-	log.Println("Created future telemetry partitions")
+	if len(created) > 0 {
+		slog.Info("Created telemetry partitions", "shard", shard.Name(), "partitions", created)
+	}
 	return nil
 }
 
+// periodStart returns the start, in UTC, of the partition period holding t.
+// Weeks start on Monday.
+func periodStart(t time.Time, interval string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case PartitionWeekly:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case PartitionMonthly:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+func periodEnd(start time.Time, interval string) time.Time {
+	switch interval {
+	case PartitionWeekly:
+		return start.AddDate(0, 0, 7)
+	case PartitionMonthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// partitionName names a partition after its period: telemetry_y2024m05d17
+// for a day, telemetry_y2024w20 for an ISO week and telemetry_y2024m05 for
+// a month
+func partitionName(start time.Time, interval string) string {
+	switch interval {
+	case PartitionWeekly:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("telemetry_y%04dw%02d", year, week)
+	case PartitionMonthly:
+		return start.Format("telemetry_y2006m01")
+	}
+	return start.Format("telemetry_y2006m01d02")
+}
+
 func (pm *PartitionManager) dropOldPartitions(ctx context.Context) error {
-	retentionDays := 30
-	cutoffDate := time.Now().AddDate(0, 0, -retentionDays)
-
-	// Query for partitions older than retention period using pg_inherits
-	rows, err := pm.db.Query(ctx, `
-		SELECT inhrelid::regclass::text as partition_name
-		FROM pg_inherits
-		JOIN pg_class parent ON pg_inherits.inhparent = parent.oid
-		JOIN pg_class child ON pg_inherits.inhrelid = child.oid
-		WHERE parent.relname = 'telemetry'
-		  AND child.relname LIKE 'telemetry_y%sm%sd%'
-		  AND substring(child.relname from 'telemetry_y(\d{4})m(\d{2})d(\d{2})')::date < $1`,
-		cutoffDate.Format("2006-01-02"))
+	retention, err := database.OrgRetentionDays(ctx, pm.db, database.RetentionTelemetry, pm.telemetryDays)
+	if err != nil {
+		return err
+	}
+
+	// Partitions hold every org of their shard, so only those past the
+	// longest retention among the shard's orgs can be dropped; orgs keeping
+	// less are pruned row by row
+	shardDays := make(map[*repository.TelemetryShard]int)
+	for orgID, days := range retention {
+		shard := pm.telemetry.ForOrg(orgID)
+		shardDays[shard] = max(shardDays[shard], days)
+	}
+	pm.pruneOrgTelemetry(ctx, retention, shardDays)
+
+	for _, shard := range pm.telemetry.Shards() {
+		retentionDays, ok := shardDays[shard]
+		if !ok {
+			retentionDays = pm.telemetryDays
+		}
+		if err := pm.dropShardPartitions(ctx, shard, retentionDays); err != nil {
+			slog.Error("Failed to drop old partitions of shard", "shard", shard.Name(), "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (pm *PartitionManager) dropShardPartitions(ctx context.Context, shard *repository.TelemetryShard, retentionDays int) error {
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+
+	// A partition is dropped once all of its range is past retention
+	rows, err := shard.DB().Query(ctx, `
+		SELECT name, range_from FROM (`+telemetryPartitions+`) AS p(name, range_from, range_to)
+		WHERE range_to <= $2
+		ORDER BY range_from`, shard.Table(), cutoff)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	var partitionsToDrop []string
+	var partitionStarts []time.Time
 	for rows.Next() {
 		var partitionName string
-		if err := rows.Scan(&partitionName); err != nil {
+		var from time.Time
+		if err := rows.Scan(&partitionName, &from); err != nil {
 			return err
 		}
 		partitionsToDrop = append(partitionsToDrop, partitionName)
+		partitionStarts = append(partitionStarts, from)
 	}
+	rows.Close()
 
-	// Drop old partitions
-	for _, partition := range partitionsToDrop {
-		_, err := pm.db.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", partition))
+	// Drop old partitions, archiving them first when an archive store is
+	// configured. A partition that fails to archive is kept and retried on
+	// the next run.
+	for i, partition := range partitionsToDrop {
+		if pm.archive != nil {
+			if err := pm.archivePartition(ctx, shard, partition, partitionStarts[i]); err != nil {
+				slog.Error("Failed to archive partition, keeping it", "partition", partition, "error", err)
+				continue
+			}
+		}
+
+		_, err := shard.DB().Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", partition))
 		if err != nil {
-			log.Printf("Failed to drop partition %s: %v", partition, err)
+			slog.Error("Failed to drop partition", "partition", partition, "error", err)
 			continue
 		}
-		log.Printf("Dropped old partition: %s", partition)
+		slog.Info("Dropped old partition", "partition", partition)
 	}
 
 	if len(partitionsToDrop) > 0 {
-		log.Printf("Dropped %d old partitions", len(partitionsToDrop))
+		slog.Info("Dropped old partitions", "count", len(partitionsToDrop))
+	}
+
+	return nil
+}
+
+// pruneOrgTelemetry deletes telemetry of orgs whose retention is shorter
+// than the partition retention of their shard
+func (pm *PartitionManager) pruneOrgTelemetry(ctx context.Context, retention map[int64]int, shardDays map[*repository.TelemetryShard]int) {
+	for orgID, days := range retention {
+		if days >= shardDays[pm.telemetry.ForOrg(orgID)] {
+			continue
+		}
+
+		n, err := pm.telemetry.PruneOrg(ctx, orgID, days)
+		if err != nil {
+			slog.Error("Failed to prune telemetry for org", "org_id", orgID, "error", err)
+			continue
+		}
+
+		if n > 0 {
+			slog.Info("Pruned org telemetry", "org_id", orgID, "rows", n, "retention_days", days)
+		}
+	}
+}
+
+// pruneSoftwareHistory deletes software installs removed longer ago than
+// each org's software history retention
+func (pm *PartitionManager) pruneSoftwareHistory(ctx context.Context) error {
+	retention, err := database.OrgRetentionDays(ctx, pm.db, database.RetentionSoftwareHistory, pm.softwareHistoryDays)
+	if err != nil {
+		return err
+	}
+
+	for orgID, days := range retention {
+		result, err := pm.db.Exec(ctx, `
+			DELETE FROM device_software
+			WHERE device_id IN (SELECT device_id FROM agents WHERE org_id = $1)
+			  AND removed_at < NOW() - make_interval(days => $2)`, orgID, days)
+		if err != nil {
+			slog.Error("Failed to prune software history for org", "org_id", orgID, "error", err)
+			continue
+		}
+
+		if n := result.RowsAffected(); n > 0 {
+			slog.Info("Pruned removed software installs", "org_id", orgID, "count", n, "retention_days", days)
+		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
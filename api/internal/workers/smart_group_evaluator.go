@@ -0,0 +1,130 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/policycache"
+)
+
+// SmartGroupEvaluator periodically recomputes the membership of groups that
+// are backed by a saved filter. Membership changes invalidate cached
+// effective policies.
+type SmartGroupEvaluator struct {
+	db       *pgxpool.Pool
+	cache    *policycache.Cache
+	interval time.Duration
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewSmartGroupEvaluator(db *pgxpool.Pool, cache *policycache.Cache, interval time.Duration) *SmartGroupEvaluator {
+	return &SmartGroupEvaluator{
+		db:       db,
+		cache:    cache,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func (e *SmartGroupEvaluator) Start(ctx context.Context) error {
+	e.wg.Add(1)
+	go e.run(ctx)
+	slog.Info("Smart group evaluator started")
+	return nil
+}
+
+func (e *SmartGroupEvaluator) Stop() {
+	close(e.stopCh)
+	e.wg.Wait()
+	slog.Info("Smart group evaluator stopped")
+}
+
+func (e *SmartGroupEvaluator) run(ctx context.Context) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.evaluateGroups()
+		}
+	}
+}
+
+func (e *SmartGroupEvaluator) evaluateGroups() {
+	ctx := context.Background()
+
+	rows, err := e.db.Query(ctx, `
+		SELECT g.group_id, f.filter
+		FROM device_groups g
+		JOIN saved_filters f ON f.filter_id = g.filter_id`)
+	if err != nil {
+		slog.Error("Failed to query smart groups", "error", err)
+		return
+	}
+
+	type smartGroup struct {
+		id     int64
+		filter models.DeviceFilter
+	}
+
+	var groups []smartGroup
+	for rows.Next() {
+		var g smartGroup
+		if err := rows.Scan(&g.id, &g.filter); err != nil {
+			slog.Error("Failed to scan smart group", "error", err)
+			rows.Close()
+			return
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+
+	changed := false
+	for _, g := range groups {
+		groupChanged, err := e.evaluateGroup(ctx, g.id, &g.filter)
+		if err != nil {
+			slog.Error("Failed to evaluate smart group", "group_id", g.id, "error", err)
+		}
+		changed = changed || groupChanged
+	}
+
+	if changed {
+		e.cache.InvalidateAll(ctx)
+	}
+}
+
+func (e *SmartGroupEvaluator) evaluateGroup(ctx context.Context, groupID int64, filter *models.DeviceFilter) (bool, error) {
+	tx, err := e.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	added, removed, err := database.RefreshSmartGroup(ctx, tx, groupID, filter)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+
+	if added > 0 || removed > 0 {
+		slog.Info("Smart group membership updated", "group_id", groupID, "added", added, "removed", removed)
+	}
+
+	return added > 0 || removed > 0, nil
+}
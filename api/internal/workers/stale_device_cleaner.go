@@ -0,0 +1,182 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+)
+
+// staleBatchSize bounds how many devices one org retires per run
+const staleBatchSize = 500
+
+// StaleDeviceCleaner retires devices that haven't been seen for their org's
+// stale_device_days (or the server default), optionally scheduling their
+// purge, and records a summary of each run so the retirements can be
+// reviewed.
+type StaleDeviceCleaner struct {
+	db          *pgxpool.Pool
+	defaultDays int
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewStaleDeviceCleaner(db *pgxpool.Pool, defaultDays int) *StaleDeviceCleaner {
+	return &StaleDeviceCleaner{
+		db:          db,
+		defaultDays: defaultDays,
+		stopCh:      make(chan struct{}),
+	}
+}
+
+func (s *StaleDeviceCleaner) Start(ctx context.Context) error {
+	s.wg.Add(1)
+	go s.run(ctx)
+	slog.Info("Stale device cleaner started")
+	return nil
+}
+
+func (s *StaleDeviceCleaner) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+	slog.Info("Stale device cleaner stopped")
+}
+
+func (s *StaleDeviceCleaner) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.cleanup(ctx)
+		}
+	}
+}
+
+func (s *StaleDeviceCleaner) cleanup(ctx context.Context) {
+	rows, err := s.db.Query(ctx, `
+		SELECT o.org_id, COALESCE(st.stale_device_days, $1), COALESCE(st.purge_stale_devices, TRUE)
+		FROM (SELECT DISTINCT org_id FROM agents WHERE status <> 'retired' AND org_id IS NOT NULL) o
+		LEFT JOIN org_settings st ON st.org_id = o.org_id`, s.defaultDays)
+	if err != nil {
+		slog.Error("Failed to query stale device settings", "error", err)
+		return
+	}
+
+	type orgPolicy struct {
+		orgID int64
+		days  int
+		purge bool
+	}
+
+	var orgs []orgPolicy
+	for rows.Next() {
+		var o orgPolicy
+		if err := rows.Scan(&o.orgID, &o.days, &o.purge); err != nil {
+			slog.Error("Failed to scan stale device settings", "error", err)
+			rows.Close()
+			return
+		}
+		if o.days > 0 {
+			orgs = append(orgs, o)
+		}
+	}
+	rows.Close()
+
+	for _, o := range orgs {
+		if err := s.cleanupOrg(ctx, o.orgID, o.days, o.purge); err != nil {
+			slog.Error("Failed to clean up stale devices for org", "org_id", o.orgID, "error", err)
+		}
+	}
+}
+
+// cleanupOrg retires one org's stale devices, each in its own transaction,
+// and records the run if any were retired
+func (s *StaleDeviceCleaner) cleanupOrg(ctx context.Context, orgID int64, days int, purge bool) error {
+	rows, err := s.db.Query(ctx, `
+		SELECT device_id, hostname, last_seen_at FROM agents
+		WHERE org_id = $1 AND status <> 'retired' AND last_seen_at < NOW() - make_interval(days => $2)
+		ORDER BY last_seen_at
+		LIMIT $3`, orgID, days, staleBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var candidates []models.StaleDevice
+	for rows.Next() {
+		var d models.StaleDevice
+		if err := rows.Scan(&d.DeviceID, &d.Hostname, &d.LastSeenAt); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, d)
+	}
+	rows.Close()
+
+	retired := []models.StaleDevice{}
+	for _, d := range candidates {
+		ok, err := s.retire(ctx, d, days, purge)
+		if err != nil {
+			slog.Error("Failed to retire stale device", "device_id", d.DeviceID, "error", err)
+			continue
+		}
+		if ok {
+			retired = append(retired, d)
+		}
+	}
+
+	if len(retired) == 0 {
+		return nil
+	}
+
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO stale_device_runs (org_id, stale_device_days, purge, devices_retired, devices)
+		VALUES ($1, $2, $3, $4, $5)`,
+		orgID, days, purge, len(retired), retired)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Retired stale devices", "org_id", orgID, "count", len(retired))
+	return nil
+}
+
+// retire re-checks under lock that the device is still stale, since it may
+// have reported since it was selected, then retires it
+func (s *StaleDeviceCleaner) retire(ctx context.Context, d models.StaleDevice, days int, purge bool) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var stale bool
+	err = tx.QueryRow(ctx, `
+		SELECT status <> 'retired' AND last_seen_at < NOW() - make_interval(days => $2)
+		FROM agents WHERE device_id = $1 FOR UPDATE`, d.DeviceID, days).Scan(&stale)
+	if err != nil || !stale {
+		return false, err
+	}
+
+	details := map[string]interface{}{
+		"reason":            "stale",
+		"last_seen_at":      d.LastSeenAt,
+		"stale_device_days": days,
+	}
+	if _, err := database.RetireDevice(ctx, tx, d.DeviceID, "system", purge, details); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
@@ -0,0 +1,317 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// TableMaintenance keeps the telemetry tables healthy beyond what
+// autovacuum does. It analyzes each telemetry partition once it has filled,
+// since autovacuum may not reach a partition that is no longer written
+// before it is queried, and watches dead tuples in telemetry_latest, which
+// every report rewrites. During the off-hours window it vacuums
+// telemetry_latest when its dead tuples pass bloatPercent and rebuilds its
+// indexes once they have grown bloatPercent larger per live row than after
+// their last rebuild.
+type TableMaintenance struct {
+	db           *pgxpool.Pool
+	telemetry    *repository.Telemetry
+	interval     time.Duration
+	windowStart  int
+	windowEnd    int
+	bloatPercent int
+	// indexBytesPerRow is the size per live row of each telemetry_latest
+	// index after its last rebuild. It is kept in memory, so each index is
+	// rebuilt once in the first window after the leader changes.
+	indexBytesPerRow map[string]float64
+	metrics          *MaintenanceMetrics
+	stopCh           chan struct{}
+	wg               sync.WaitGroup
+}
+
+// MaintenanceMetrics counts the table maintenance done by this instance and
+// the last bloat measured, for /metrics. Only the leader runs maintenance,
+// so other instances report no measurements.
+type MaintenanceMetrics struct {
+	mu             sync.Mutex
+	analyzed       int64
+	vacuumed       int64
+	reindexed      int64
+	failures       int64
+	measured       bool
+	deadTuples     int64
+	deadTupleRatio float64
+	lastRun        time.Time
+}
+
+// NewTableMaintenance creates a maintenance worker checking every interval.
+// The off-hours window runs from windowStart up to windowEnd, hours of the
+// day in server time; it may wrap past midnight.
+func NewTableMaintenance(db *pgxpool.Pool, telemetry *repository.Telemetry, interval time.Duration, windowStart, windowEnd, bloatPercent int) *TableMaintenance {
+	return &TableMaintenance{
+		db:               db,
+		telemetry:        telemetry,
+		interval:         interval,
+		windowStart:      windowStart,
+		windowEnd:        windowEnd,
+		bloatPercent:     bloatPercent,
+		indexBytesPerRow: make(map[string]float64),
+		metrics:          &MaintenanceMetrics{},
+		stopCh:           make(chan struct{}),
+	}
+}
+
+// Metrics returns the worker's metrics, updated as it runs
+func (tm *TableMaintenance) Metrics() *MaintenanceMetrics {
+	return tm.metrics
+}
+
+func (tm *TableMaintenance) Start(ctx context.Context) error {
+	tm.wg.Add(1)
+	go tm.run(ctx)
+	slog.Info("Table maintenance started")
+	return nil
+}
+
+func (tm *TableMaintenance) Stop() {
+	close(tm.stopCh)
+	tm.wg.Wait()
+	slog.Info("Table maintenance stopped")
+}
+
+func (tm *TableMaintenance) run(ctx context.Context) {
+	defer tm.wg.Done()
+
+	tm.maintain(ctx)
+
+	ticker := time.NewTicker(tm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tm.maintain(ctx)
+		}
+	}
+}
+
+func (tm *TableMaintenance) maintain(ctx context.Context) {
+	for _, shard := range tm.telemetry.Shards() {
+		if err := tm.analyzeFilledPartitions(ctx, shard); err != nil {
+			tm.metrics.add(&tm.metrics.failures, 1)
+			slog.Error("Failed to analyze telemetry partitions of shard", "shard", shard.Name(), "error", err)
+		}
+	}
+
+	deadRatio, err := tm.measureBloat(ctx)
+	if err != nil {
+		tm.metrics.add(&tm.metrics.failures, 1)
+		slog.Error("Failed to measure telemetry_latest bloat", "error", err)
+	}
+
+	if tm.inWindow(time.Now()) {
+		if err == nil && deadRatio*100 > float64(tm.bloatPercent) {
+			tm.vacuumLatest(ctx, deadRatio)
+		}
+		if err := tm.reindexLatest(ctx); err != nil {
+			tm.metrics.add(&tm.metrics.failures, 1)
+			slog.Error("Failed to check telemetry_latest indexes", "error", err)
+		}
+	}
+
+	tm.metrics.mu.Lock()
+	tm.metrics.lastRun = time.Now()
+	tm.metrics.mu.Unlock()
+}
+
+// inWindow reports whether t falls in the off-hours window
+func (tm *TableMaintenance) inWindow(t time.Time) bool {
+	hour := t.Hour()
+	if tm.windowStart <= tm.windowEnd {
+		return hour >= tm.windowStart && hour < tm.windowEnd
+	}
+	return hour >= tm.windowStart || hour < tm.windowEnd
+}
+
+// analyzeFilledPartitions analyzes the partitions of a shard whose range has
+// passed and that haven't been analyzed since
+func (tm *TableMaintenance) analyzeFilledPartitions(ctx context.Context, shard *repository.TelemetryShard) error {
+	rows, err := shard.DB().Query(ctx, `
+		SELECT p.name FROM (`+telemetryPartitions+`) AS p(name, range_from, range_to)
+		JOIN pg_stat_user_tables s ON s.relid = p.name::regclass
+		WHERE p.range_to <= NOW()
+		  AND COALESCE(GREATEST(s.last_analyze, s.last_autoanalyze), '-infinity') < p.range_to
+		ORDER BY p.range_from`, shard.Table())
+	if err != nil {
+		return err
+	}
+	partitions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	for _, partition := range partitions {
+		if _, err := shard.DB().Exec(ctx, "ANALYZE "+partition); err != nil {
+			tm.metrics.add(&tm.metrics.failures, 1)
+			slog.Error("Failed to analyze partition", "partition", partition, "error", err)
+			continue
+		}
+		tm.metrics.add(&tm.metrics.analyzed, 1)
+		slog.Info("Analyzed filled partition", "partition", partition)
+	}
+	return nil
+}
+
+// measureBloat records telemetry_latest's dead tuples and returns their
+// share of its tuples
+func (tm *TableMaintenance) measureBloat(ctx context.Context) (float64, error) {
+	var live, dead int64
+	err := tm.db.QueryRow(ctx, `
+		SELECT n_live_tup, n_dead_tup FROM pg_stat_user_tables
+		WHERE relid = 'telemetry_latest'::regclass`).Scan(&live, &dead)
+	if err != nil {
+		return 0, err
+	}
+
+	var ratio float64
+	if live+dead > 0 {
+		ratio = float64(dead) / float64(live+dead)
+	}
+
+	tm.metrics.mu.Lock()
+	tm.metrics.measured = true
+	tm.metrics.deadTuples = dead
+	tm.metrics.deadTupleRatio = ratio
+	tm.metrics.mu.Unlock()
+	return ratio, nil
+}
+
+func (tm *TableMaintenance) vacuumLatest(ctx context.Context, deadRatio float64) {
+	if _, err := tm.db.Exec(ctx, "VACUUM (ANALYZE) telemetry_latest"); err != nil {
+		tm.metrics.add(&tm.metrics.failures, 1)
+		slog.Error("Failed to vacuum telemetry_latest", "error", err)
+		return
+	}
+	tm.metrics.add(&tm.metrics.vacuumed, 1)
+	slog.Info("Vacuumed telemetry_latest", "dead_tuple_percent", deadRatio*100)
+}
+
+// reindexLatest rebuilds the telemetry_latest indexes that have bloated
+// since their last rebuild. Indexes are rebuilt concurrently, so reports
+// keep being written meanwhile.
+func (tm *TableMaintenance) reindexLatest(ctx context.Context) error {
+	rows, err := tm.db.Query(ctx, `
+		SELECT i.indexrelid::regclass::text, pg_relation_size(i.indexrelid),
+		       GREATEST(s.n_live_tup, 1)
+		FROM pg_index i
+		JOIN pg_stat_user_tables s ON s.relid = i.indrelid
+		WHERE i.indrelid = 'telemetry_latest'::regclass`)
+	if err != nil {
+		return err
+	}
+	type index struct {
+		name       string
+		size, live int64
+	}
+	var indexes []index
+	for rows.Next() {
+		var ix index
+		if err := rows.Scan(&ix.name, &ix.size, &ix.live); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, ix)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ix := range indexes {
+		perRow := float64(ix.size) / float64(ix.live)
+		if baseline, ok := tm.indexBytesPerRow[ix.name]; ok && perRow <= baseline*(1+float64(tm.bloatPercent)/100) {
+			continue
+		}
+
+		if _, err := tm.db.Exec(ctx, "REINDEX INDEX CONCURRENTLY "+ix.name); err != nil {
+			tm.metrics.add(&tm.metrics.failures, 1)
+			slog.Error("Failed to rebuild index", "index", ix.name, "error", err)
+			continue
+		}
+
+		var size, live int64
+		err := tm.db.QueryRow(ctx, `
+			SELECT pg_relation_size($1::regclass), GREATEST(n_live_tup, 1)
+			FROM pg_stat_user_tables WHERE relid = 'telemetry_latest'::regclass`, ix.name).Scan(&size, &live)
+		if err != nil {
+			slog.Error("Failed to measure index after rebuilding it", "index", ix.name, "error", err)
+			continue
+		}
+		tm.indexBytesPerRow[ix.name] = float64(size) / float64(live)
+		tm.metrics.add(&tm.metrics.reindexed, 1)
+		slog.Info("Rebuilt index", "index", ix.name, "bytes_before", ix.size, "bytes_after", size)
+	}
+	return nil
+}
+
+func (m *MaintenanceMetrics) add(counter *int64, n int64) {
+	m.mu.Lock()
+	*counter += n
+	m.mu.Unlock()
+}
+
+// WriteMetrics writes the metrics in the Prometheus text format
+func (m *MaintenanceMetrics) WriteMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, `
+# HELP inventory_maintenance_partitions_analyzed_total Filled telemetry partitions analyzed
+# TYPE inventory_maintenance_partitions_analyzed_total counter
+inventory_maintenance_partitions_analyzed_total %d
+
+# HELP inventory_maintenance_vacuums_total Off-hours vacuums of telemetry_latest
+# TYPE inventory_maintenance_vacuums_total counter
+inventory_maintenance_vacuums_total %d
+
+# HELP inventory_maintenance_reindexes_total Off-hours rebuilds of telemetry_latest indexes
+# TYPE inventory_maintenance_reindexes_total counter
+inventory_maintenance_reindexes_total %d
+
+# HELP inventory_maintenance_failures_total Table maintenance steps that failed
+# TYPE inventory_maintenance_failures_total counter
+inventory_maintenance_failures_total %d
+`, m.analyzed, m.vacuumed, m.reindexed, m.failures)
+
+	if m.measured {
+		fmt.Fprintf(w, `
+# HELP inventory_telemetry_latest_dead_tuples Dead tuples in telemetry_latest
+# TYPE inventory_telemetry_latest_dead_tuples gauge
+inventory_telemetry_latest_dead_tuples %d
+
+# HELP inventory_telemetry_latest_dead_tuple_ratio Share of telemetry_latest tuples that are dead
+# TYPE inventory_telemetry_latest_dead_tuple_ratio gauge
+inventory_telemetry_latest_dead_tuple_ratio %g
+`, m.deadTuples, m.deadTupleRatio)
+	}
+
+	if !m.lastRun.IsZero() {
+		fmt.Fprintf(w, `
+# HELP inventory_maintenance_last_run_timestamp_seconds When table maintenance last ran
+# TYPE inventory_maintenance_last_run_timestamp_seconds gauge
+inventory_maintenance_last_run_timestamp_seconds %d
+`, m.lastRun.Unix())
+	}
+}
@@ -0,0 +1,274 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// rollupBackfill is how far back the first run aggregates raw telemetry
+const rollupBackfill = 7 * 24 * time.Hour
+
+// TelemetryRollup materializes hourly and daily aggregates of the default
+// field of each chartable metric into telemetry_rollups. Only complete
+// buckets are written; the latest rolled-up bucket is recomputed each run
+// to pick up late samples. Once a day rollups older than each org's rollup
+// retention are deleted.
+type TelemetryRollup struct {
+	db            *pgxpool.Pool
+	telemetry     *repository.Telemetry
+	retentionDays int
+	lastPrune     time.Time
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+}
+
+func NewTelemetryRollup(db *pgxpool.Pool, telemetry *repository.Telemetry, retentionDays int) *TelemetryRollup {
+	return &TelemetryRollup{
+		db:            db,
+		telemetry:     telemetry,
+		retentionDays: retentionDays,
+		stopCh:        make(chan struct{}),
+	}
+}
+
+func (r *TelemetryRollup) Start(ctx context.Context) error {
+	r.wg.Add(1)
+	go r.run(ctx)
+	slog.Info("Telemetry rollup started")
+	return nil
+}
+
+func (r *TelemetryRollup) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+	slog.Info("Telemetry rollup stopped")
+}
+
+func (r *TelemetryRollup) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(15 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.rollup(ctx)
+			if time.Since(r.lastPrune) >= 24*time.Hour {
+				r.prune(ctx)
+				r.lastPrune = time.Now()
+			}
+		}
+	}
+}
+
+func (r *TelemetryRollup) rollup(ctx context.Context) {
+	for metric, field := range models.SeriesMetrics {
+		hourly, err := r.rollupHourly(ctx, metric, field)
+		if err != nil {
+			slog.Error("Failed to roll up hourly buckets", "metric", metric, "field", field, "error", err)
+			continue
+		}
+
+		daily, err := r.rollupDaily(ctx, metric, field)
+		if err != nil {
+			slog.Error("Failed to roll up daily buckets", "metric", metric, "field", field, "error", err)
+			continue
+		}
+
+		if hourly > 0 || daily > 0 {
+			slog.Info("Rolled up metric", "metric", metric, "field", field, "hourly", hourly, "daily", daily)
+		}
+	}
+}
+
+// rollupHourly aggregates raw telemetry into 1h buckets, shard by shard.
+// The bounds are taken once from telemetry_rollups so every shard covers
+// the same hours.
+func (r *TelemetryRollup) rollupHourly(ctx context.Context, metric, field string) (int64, error) {
+	var lo, hi time.Time
+	err := r.db.QueryRow(ctx, `
+		SELECT COALESCE(
+		           (SELECT MAX(bucket) FROM telemetry_rollups
+		            WHERE resolution = '1h' AND metric = $1 AND field = $2),
+		           date_bin('1 hour', NOW() - make_interval(secs => $3), $4::timestamptz)),
+		       date_bin('1 hour', NOW(), $4::timestamptz)`,
+		metric, field, rollupBackfill.Seconds(), models.SeriesOrigin).Scan(&lo, &hi)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, shard := range r.telemetry.Shards() {
+		var n int64
+		if shard.Local() {
+			n, err = r.rollupLocalShard(ctx, shard, metric, field, lo, hi)
+		} else {
+			n, err = r.rollupRemoteShard(ctx, shard, metric, field, lo, hi)
+		}
+		if err != nil {
+			return total, fmt.Errorf("shard %s: %w", shard.Name(), err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// hourlyAggregate selects the 1h buckets of one metric field of a shard's
+// telemetry between $3 and $4
+const hourlyAggregate = `
+	SELECT t.device_id, date_bin('1 hour', t.collected_at, $5::timestamptz) AS bucket,
+	       AVG(m.v) AS avg_value, MIN(m.v) AS min_value, MAX(m.v) AS max_value, COUNT(*) AS samples
+	FROM %s t
+	CROSS JOIN LATERAL (SELECT (t.metrics->$1->>$2)::double precision AS v) m
+	WHERE t.collected_at >= $3 AND t.collected_at < $4
+	  AND jsonb_typeof(t.metrics->$1->$2) = 'number'
+	GROUP BY t.device_id, 2`
+
+// rollupUpsert ends the insert of hourly buckets into telemetry_rollups
+const rollupUpsert = `
+	ON CONFLICT (device_id, metric, field, resolution, bucket) DO UPDATE SET
+		avg_value = EXCLUDED.avg_value,
+		min_value = EXCLUDED.min_value,
+		max_value = EXCLUDED.max_value,
+		samples = EXCLUDED.samples`
+
+// rollupLocalShard aggregates a shard in the primary database in one
+// statement
+func (r *TelemetryRollup) rollupLocalShard(ctx context.Context, shard *repository.TelemetryShard, metric, field string, lo, hi time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+		INSERT INTO telemetry_rollups (device_id, metric, field, resolution, bucket,
+		                               avg_value, min_value, max_value, samples)
+		SELECT h.device_id, $1, $2, '1h', h.bucket, h.avg_value, h.min_value, h.max_value, h.samples
+		FROM (`+fmt.Sprintf(hourlyAggregate, shard.Table())+`) h
+		JOIN agents a ON a.device_id = h.device_id`+rollupUpsert,
+		metric, field, lo, hi, models.SeriesOrigin)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// rollupRemoteShard aggregates a shard in another database there and
+// writes the buckets to the primary
+func (r *TelemetryRollup) rollupRemoteShard(ctx context.Context, shard *repository.TelemetryShard, metric, field string, lo, hi time.Time) (int64, error) {
+	rows, err := shard.Replica().Query(ctx, fmt.Sprintf(hourlyAggregate, shard.Table()),
+		metric, field, lo, hi, models.SeriesOrigin)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var (
+		deviceIDs        []uuid.UUID
+		buckets          []time.Time
+		avgs, mins, maxs []float64
+		samples          []int64
+	)
+	for rows.Next() {
+		var (
+			deviceID        uuid.UUID
+			bucket          time.Time
+			avg, minV, maxV float64
+			n               int64
+		)
+		if err := rows.Scan(&deviceID, &bucket, &avg, &minV, &maxV, &n); err != nil {
+			return 0, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+		buckets = append(buckets, bucket)
+		avgs = append(avgs, avg)
+		mins = append(mins, minV)
+		maxs = append(maxs, maxV)
+		samples = append(samples, n)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+	if len(deviceIDs) == 0 {
+		return 0, nil
+	}
+
+	tag, err := r.db.Exec(ctx, `
+		INSERT INTO telemetry_rollups (device_id, metric, field, resolution, bucket,
+		                               avg_value, min_value, max_value, samples)
+		SELECT h.device_id, $1, $2, '1h', h.bucket, h.avg_value, h.min_value, h.max_value, h.samples
+		FROM unnest($3::uuid[], $4::timestamptz[], $5::float8[], $6::float8[], $7::float8[], $8::bigint[])
+		     AS h(device_id, bucket, avg_value, min_value, max_value, samples)
+		JOIN agents a ON a.device_id = h.device_id`+rollupUpsert,
+		metric, field, deviceIDs, buckets, avgs, mins, maxs, samples)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// rollupDaily combines hourly rollups into 1d buckets, weighting each hour
+// by its sample count
+func (r *TelemetryRollup) rollupDaily(ctx context.Context, metric, field string) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+		WITH bounds AS (
+			SELECT COALESCE(
+			           (SELECT MAX(bucket) FROM telemetry_rollups
+			            WHERE resolution = '1d' AND metric = $1 AND field = $2),
+			           date_bin('1 day', NOW() - make_interval(secs => $3), $4::timestamptz)) AS lo,
+			       date_bin('1 day', NOW(), $4::timestamptz) AS hi
+		)
+		INSERT INTO telemetry_rollups (device_id, metric, field, resolution, bucket,
+		                               avg_value, min_value, max_value, samples)
+		SELECT h.device_id, $1, $2, '1d', date_bin('1 day', h.bucket, $4::timestamptz),
+		       SUM(h.avg_value * h.samples) / SUM(h.samples), MIN(h.min_value), MAX(h.max_value), SUM(h.samples)
+		FROM telemetry_rollups h
+		CROSS JOIN bounds
+		WHERE h.resolution = '1h' AND h.metric = $1 AND h.field = $2
+		  AND h.bucket >= bounds.lo AND h.bucket < bounds.hi
+		GROUP BY h.device_id, 5
+		ON CONFLICT (device_id, metric, field, resolution, bucket) DO UPDATE SET
+			avg_value = EXCLUDED.avg_value,
+			min_value = EXCLUDED.min_value,
+			max_value = EXCLUDED.max_value,
+			samples = EXCLUDED.samples`,
+		metric, field, rollupBackfill.Seconds(), models.SeriesOrigin)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// prune deletes rollups older than each org's rollup retention
+func (r *TelemetryRollup) prune(ctx context.Context) {
+	retention, err := database.OrgRetentionDays(ctx, r.db, database.RetentionRollups, r.retentionDays)
+	if err != nil {
+		slog.Error("Failed to load rollup retention", "error", err)
+		return
+	}
+
+	for orgID, days := range retention {
+		result, err := r.db.Exec(ctx, `
+			DELETE FROM telemetry_rollups
+			WHERE device_id IN (SELECT device_id FROM agents WHERE org_id = $1)
+			  AND bucket < NOW() - make_interval(days => $2)`, orgID, days)
+		if err != nil {
+			slog.Error("Failed to prune rollups for org", "org_id", orgID, "error", err)
+			continue
+		}
+
+		if n := result.RowsAffected(); n > 0 {
+			slog.Info("Pruned org rollups", "org_id", orgID, "count", n, "retention_days", days)
+		}
+	}
+}
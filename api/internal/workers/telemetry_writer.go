@@ -3,34 +3,83 @@ package workers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/database"
+	"github.com/yourorg/inventory-agent/api/internal/events"
 	"github.com/yourorg/inventory-agent/api/internal/models"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+	"github.com/yourorg/inventory-agent/api/internal/requestid"
+	"github.com/yourorg/inventory-agent/api/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// telemetryConsumer is the durable consumer the telemetry writer pulls from
+const telemetryConsumer = "telemetry-writer"
+
+// Agents inside the datacenter may publish their reports to the stream
+// themselves rather than upload them. Such a message carries the agent's
+// version in DirectAgentHeader and its clock skew in ClockSkewHeader, and
+// the writer marks the device seen as the ingest handler would have.
+const (
+	DirectAgentHeader = "Agent-Version"
+	ClockSkewHeader   = "Agent-Clock-Skew-Ms"
 )
 
 type TelemetryWriter struct {
-	db     *pgxpool.Pool
-	js     nats.JetStream
-	sub    *nats.Subscription
-	stopCh chan struct{}
-	wg     sync.WaitGroup
+	db         *pgxpool.Pool
+	telemetry  *repository.Telemetry
+	js         nats.JetStreamContext
+	publisher  *events.Publisher
+	alerts     *AlertEvaluator
+	ackWait    time.Duration
+	maxDeliver int
+	sub        *nats.Subscription
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
 }
 
-func NewTelemetryWriter(db *pgxpool.Pool, js nats.JetStream) *TelemetryWriter {
+// NewTelemetryWriter creates the writer. Reports are stored in the
+// telemetry shard of their device's org. A message not written within
+// ackWait is redelivered, up to maxDeliver deliveries in all.
+func NewTelemetryWriter(db *pgxpool.Pool, telemetry *repository.Telemetry, js nats.JetStreamContext, publisher *events.Publisher, alerts *AlertEvaluator, ackWait time.Duration, maxDeliver int) *TelemetryWriter {
 	return &TelemetryWriter{
-		db:     db,
-		js:     js,
-		stopCh: make(chan struct{}),
+		db:         db,
+		telemetry:  telemetry,
+		js:         js,
+		publisher:  publisher,
+		alerts:     alerts,
+		ackWait:    ackWait,
+		maxDeliver: maxDeliver,
+		stopCh:     make(chan struct{}),
 	}
 }
 
 func (w *TelemetryWriter) Start(ctx context.Context) error {
-	// Subscribe to telemetry stream using JetStream
-	sub, err := w.js.PullSubscribe("telemetry.ingest", "telemetry-writer")
+	err := ensureConsumer(w.js, TelemetryStream, &nats.ConsumerConfig{
+		Durable:       telemetryConsumer,
+		FilterSubject: "telemetry.ingest",
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       w.ackWait,
+		MaxDeliver:    w.maxDeliver,
+	})
+	if err != nil {
+		return err
+	}
+
+	sub, err := w.js.PullSubscribe("telemetry.ingest", telemetryConsumer, nats.Bind(TelemetryStream, telemetryConsumer))
 	if err != nil {
 		return err
 	}
@@ -39,7 +88,7 @@ func (w *TelemetryWriter) Start(ctx context.Context) error {
 	w.wg.Add(1)
 	go w.run(ctx)
 
-	log.Println("Telemetry writer started with JetStream")
+	slog.Info("Telemetry writer started with JetStream")
 	return nil
 }
 
@@ -49,9 +98,12 @@ func (w *TelemetryWriter) Stop() {
 	}
 	close(w.stopCh)
 	w.wg.Wait()
-	log.Println("Telemetry writer stopped")
+	slog.Info("Telemetry writer stopped")
 }
 
+// telemetryBatchSize is the most messages fetched and written together
+const telemetryBatchSize = 500
+
 func (w *TelemetryWriter) run(ctx context.Context) {
 	defer w.wg.Done()
 
@@ -63,85 +115,457 @@ func (w *TelemetryWriter) run(ctx context.Context) {
 			return
 		default:
 			// Fetch messages from JetStream
-			msgs, err := w.sub.Fetch(100, nats.MaxWait(5*time.Second))
+			msgs, err := w.sub.Fetch(telemetryBatchSize, nats.MaxWait(5*time.Second))
 			if err != nil {
 				if err != nats.ErrTimeout {
-					log.Printf("Failed to fetch messages: %v", err)
+					slog.Error("Failed to fetch messages", "error", err)
+					select {
+					case <-w.stopCh:
+						return
+					case <-ctx.Done():
+						return
+					case <-time.After(fetchBackoff):
+					}
 				}
 				continue
 			}
 
-			// Process messages
-			for _, msg := range msgs {
-				w.handleMessage(msg)
-			}
+			w.handleMessages(msgs)
 		}
 	}
 }
 
-func (w *TelemetryWriter) handleMessage(msg *nats.Msg) {
-	var telemetry models.Telemetry
-	if err := json.Unmarshal(msg.Data, &telemetry); err != nil {
-		log.Printf("Failed to unmarshal telemetry: %v", err)
-		msg.Nak()
+// handleMessages writes a fetched batch of messages in one transaction and
+// acks them once it commits. If the batch fails, each message is retried on
+// its own so one bad message can't hold back the rest; those that still
+// fail are nakked for redelivery. Reports that were already stored are
+// acked without being published or evaluated again, and reports an agent
+// published directly from a device that may not report are acked unwritten.
+func (w *TelemetryWriter) handleMessages(msgs []*nats.Msg) {
+	batch := make([]*models.Telemetry, 0, len(msgs))
+	batchMsgs := make([]*nats.Msg, 0, len(msgs))
+	for _, msg := range msgs {
+		var telemetry models.Telemetry
+		if err := json.Unmarshal(msg.Data, &telemetry); err != nil {
+			slog.Error("Failed to unmarshal telemetry", "request", requestid.Describe(msg), "error", err)
+			w.nak(msg)
+			continue
+		}
+		if !w.directMayReport(&telemetry, msg) {
+			msg.Ack()
+			continue
+		}
+		batch = append(batch, &telemetry)
+		batchMsgs = append(batchMsgs, msg)
+	}
+	if len(batch) == 0 {
 		return
 	}
 
-	// For now, process immediately (could batch here too)
-	if err := w.writeTelemetry(&telemetry); err != nil {
-		log.Printf("Failed to write telemetry: %v", err)
-		msg.Nak()
+	// One span covers the batch, linked to the request that queued each
+	// message
+	links := make([]trace.Link, 0, len(batchMsgs))
+	for _, msg := range batchMsgs {
+		if sc := tracing.ExtractNATS(msg); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	ctx, span := tracing.Tracer().Start(context.Background(), "telemetry.ingest process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(tracing.MessagingAttributes("telemetry.ingest")...),
+		trace.WithAttributes(attribute.Int("messaging.batch.message_count", len(batch))))
+	defer span.End()
+
+	written, err := w.writeBatch(ctx, batch)
+	if err == nil {
+		for i, msg := range batchMsgs {
+			msg.Ack()
+			w.markDirectSeen(batch[i], msg)
+			// The same report fetched twice is only followed up once
+			if written[batch[i].IngestionID] {
+				delete(written, batch[i].IngestionID)
+				w.afterWrite(batch[i])
+			}
+		}
+		return
+	}
+	span.RecordError(err)
+	if len(batch) == 1 {
+		span.SetStatus(codes.Error, err.Error())
+		slog.Error("Failed to write telemetry", "report", messageRef(batch[0], batchMsgs[0]), "error", err)
+		w.nak(batchMsgs[0])
 		return
 	}
 
-	msg.Ack()
+	slog.Error("Failed to write telemetry batch, writing individually", "batch_size", len(batch), "error", err)
+	for i, msg := range batchMsgs {
+		written, err := w.writeBatch(ctx, batch[i:i+1])
+		if err != nil {
+			slog.Error("Failed to write telemetry", "report", messageRef(batch[i], msg), "error", err)
+			w.nak(msg)
+			continue
+		}
+		msg.Ack()
+		w.markDirectSeen(batch[i], msg)
+		if written[batch[i].IngestionID] {
+			w.afterWrite(batch[i])
+		}
+	}
+}
+
+// messageRef names a queued report in log lines by its ingestion ID and the
+// request that queued it, so a failed write can be traced back to the
+// upload and the agent's correlation ID
+func messageRef(telemetry *models.Telemetry, msg *nats.Msg) string {
+	return "ingestion " + telemetry.IngestionID.String() + ", " + requestid.Describe(msg)
+}
+
+// nak returns a message for redelivery, logging when it has used up its
+// deliveries and JetStream will drop it
+func (w *TelemetryWriter) nak(msg *nats.Msg) {
+	if meta, err := msg.Metadata(); err == nil && w.maxDeliver > 0 && meta.NumDelivered >= uint64(w.maxDeliver) {
+		slog.Warn("Dropping telemetry message", "deliveries", meta.NumDelivered, "request", requestid.Describe(msg))
+	}
+	msg.Nak()
 }
 
-func (w *TelemetryWriter) writeTelemetry(telemetry *models.Telemetry) error {
+// directMayReport checks that a device whose agent published its report
+// directly may report, by the rules the ingest handler applies to uploads,
+// so a retired or disabled device's reports are dropped. When the lookup
+// fails the report is let through; markDirectSeen still won't revive it.
+func (w *TelemetryWriter) directMayReport(telemetry *models.Telemetry, msg *nats.Msg) bool {
+	if msg.Header.Get(DirectAgentHeader) == "" {
+		return true
+	}
+	agent := models.Agent{DeviceID: telemetry.DeviceID}
+	err := w.db.QueryRow(context.Background(),
+		"SELECT status FROM agents WHERE device_id = $1", telemetry.DeviceID).Scan(&agent.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		slog.Warn("Dropping telemetry from unknown device", "report", messageRef(telemetry, msg))
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to load reporting device", "device_id", telemetry.DeviceID, "error", err)
+		return true
+	}
+	if !agent.CanReport() {
+		slog.Warn("Dropping telemetry from device that may not report", "report", messageRef(telemetry, msg), "status", agent.Status)
+		return false
+	}
+	return true
+}
+
+// markDirectSeen records that a device whose agent published its report
+// directly reported, bringing it back online, and activates an enrolled
+// device with its first report. Reports uploaded through the API were
+// already recorded by the ingest handler.
+func (w *TelemetryWriter) markDirectSeen(telemetry *models.Telemetry, msg *nats.Msg) {
+	if msg.Header.Get(DirectAgentHeader) == "" {
+		return
+	}
+	// A missing or invalid skew is recorded as none
+	skew, _ := strconv.ParseInt(msg.Header.Get(ClockSkewHeader), 10, 64)
+
 	ctx := context.Background()
+	var status, lifecycle string
+	err := w.db.QueryRow(ctx, `
+		UPDATE agents a SET last_seen_at = NOW(), status = 'active', clock_skew_ms = $2
+		FROM agents prev
+		WHERE a.device_id = $1 AND prev.device_id = a.device_id AND a.status = ANY($3)
+		RETURNING prev.status, prev.lifecycle_state`, telemetry.DeviceID, skew, models.ReportingStatuses).Scan(&status, &lifecycle)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Retired or disabled since its report was checked
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to mark device seen", "device_id", telemetry.DeviceID, "error", err)
+		return
+	}
+	if status == "offline" || status == "inactive" {
+		w.publisher.Publish(models.DeviceEvent(models.EventDeviceOnline, telemetry.DeviceID, nil))
+	}
+
+	if lifecycle == models.LifecycleEnrolled {
+		_, err := database.TransitionLifecycle(ctx, w.db, telemetry.DeviceID, models.LifecycleActive, "agent", "first telemetry")
+		if err != nil {
+			slog.Error("Failed to activate device", "device_id", telemetry.DeviceID, "error", err)
+		}
+	}
+}
+
+// afterWrite publishes a written report to live subscribers and runs what
+// depends on the device's latest telemetry
+func (w *TelemetryWriter) afterWrite(telemetry *models.Telemetry) {
+	w.publisher.PublishMetrics(models.DeviceLiveStatus{
+		DeviceID:    telemetry.DeviceID,
+		CollectedAt: &telemetry.CollectedAt,
+		Metrics:     models.KeyMetrics(telemetry.Metrics),
+	})
+	w.alerts.EvaluateDevice(telemetry.DeviceID)
+
+	// A serial number first arrives with os.info, which may link the
+	// device to an imported expected device
+	if _, ok := telemetry.Metrics["os.info"]; ok {
+		if _, err := database.LinkExpectedDevices(context.Background(), w.db, &telemetry.DeviceID); err != nil {
+			slog.Error("Failed to link expected device", "device_id", telemetry.DeviceID, "error", err)
+		}
+	}
+}
+
+// writeBatch writes reports in one transaction and returns the ingestion
+// IDs of those it stored. They are copied into a staging table and inserted
+// into their device's telemetry shard, skipping any whose ingestion ID is
+// already stored, so a redelivered or retried report is written once. Each
+// device's newest new report then replaces its telemetry_latest row in a
+// single upsert, unless the row is newer, as a late report must not roll
+// it back; software inventories are merged oldest first.
+func (w *TelemetryWriter) writeBatch(ctx context.Context, batch []*models.Telemetry) (map[uuid.UUID]bool, error) {
+	deviceIDs := make([]uuid.UUID, len(batch))
+	for i, t := range batch {
+		deviceIDs[i] = t.DeviceID
+	}
+	shards, err := w.telemetry.ForDevices(ctx, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	byShard := make(map[*repository.TelemetryShard][]*models.Telemetry)
+	for _, t := range batch {
+		byShard[shards[t.DeviceID]] = append(byShard[shards[t.DeviceID]], t)
+	}
 
-	// Begin transaction
 	tx, err := w.db.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
-	// Insert into telemetry table
-	_, err = tx.Exec(ctx, `
-		INSERT INTO telemetry (device_id, collected_at, metrics, tags, seq, ingestion_id)
-		VALUES ($1, $2, $3, $4, $5, $6)`,
-		telemetry.DeviceID, telemetry.CollectedAt, telemetry.Metrics,
-		telemetry.Tags, telemetry.Seq, telemetry.IngestionID)
-	if err != nil {
-		return err
+	if err := stageTelemetry(ctx, tx, batch); err != nil {
+		return nil, err
+	}
+
+	// Reports of shards in other databases are inserted in a transaction
+	// there, committed right after the primary's. Should that commit fail,
+	// the redelivered reports are inserted then and telemetry_latest is
+	// written again with the same rows.
+	var remote []pgx.Tx
+	defer func() {
+		for _, rtx := range remote {
+			rtx.Rollback(ctx)
+		}
+	}()
+
+	written := make(map[uuid.UUID]bool, len(batch))
+	ids := make([]uuid.UUID, 0, len(batch))
+	for _, shard := range w.telemetry.Shards() {
+		reports := byShard[shard]
+		if len(reports) == 0 {
+			continue
+		}
+		shardTx := tx
+		if !shard.Local() {
+			if shardTx, err = shard.DB().Begin(ctx); err != nil {
+				return nil, err
+			}
+			remote = append(remote, shardTx)
+			if err := stageTelemetry(ctx, shardTx, reports); err != nil {
+				return nil, err
+			}
+		}
+
+		inserted, err := insertTelemetry(ctx, shardTx, shard.Table(), reports)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range inserted {
+			written[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	// Duplicates must not roll telemetry_latest back or merge software twice
+	if len(ids) < len(batch) {
+		_, err = tx.Exec(ctx, "DELETE FROM telemetry_stage WHERE ingestion_id <> ALL($1)", ids)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Upsert latest telemetry
 	_, err = tx.Exec(ctx, `
-		INSERT INTO telemetry_latest (device_id, collected_at, metrics, tags, seq, ingestion_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO telemetry_latest (device_id, collected_at, metrics, tags, seq, errors)
+		SELECT DISTINCT ON (device_id) device_id, collected_at, metrics, tags, seq, errors
+		FROM telemetry_stage
+		ORDER BY device_id, collected_at DESC, seq DESC
 		ON CONFLICT (device_id) DO UPDATE SET
 			collected_at = EXCLUDED.collected_at,
 			metrics = EXCLUDED.metrics,
 			tags = EXCLUDED.tags,
 			seq = EXCLUDED.seq,
-			server_received_at = NOW()`,
-		telemetry.DeviceID, telemetry.CollectedAt, telemetry.Metrics,
-		telemetry.Tags, telemetry.Seq, telemetry.IngestionID)
+			errors = EXCLUDED.errors,
+			server_received_at = NOW()
+		WHERE telemetry_latest.collected_at <= EXCLUDED.collected_at`)
+	if err != nil {
+		return nil, err
+	}
+
+	byTime := append([]*models.Telemetry(nil), batch...)
+	sort.SliceStable(byTime, func(i, j int) bool { return byTime[i].CollectedAt.Before(byTime[j].CollectedAt) })
+	for _, telemetry := range byTime {
+		if !written[telemetry.IngestionID] {
+			continue
+		}
+		if software, ok := telemetry.SoftwareInventory(); ok {
+			if err := w.writeSoftware(ctx, tx, telemetry, software); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	for _, rtx := range remote {
+		if err := rtx.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+// stageTelemetry copies reports into a telemetry_stage table dropped when
+// tx ends
+func stageTelemetry(ctx context.Context, tx pgx.Tx, batch []*models.Telemetry) error {
+	_, err := tx.Exec(ctx, `
+		CREATE TEMP TABLE telemetry_stage (
+			device_id UUID NOT NULL,
+			collected_at TIMESTAMPTZ NOT NULL,
+			metrics JSONB,
+			tags JSONB,
+			seq BIGINT NOT NULL,
+			ingestion_id UUID NOT NULL,
+			errors JSONB
+		) ON COMMIT DROP`)
 	if err != nil {
 		return err
 	}
 
-	// Commit transaction
-	return tx.Commit(ctx)
+	rows := make([][]interface{}, len(batch))
+	for i, t := range batch {
+		rows[i] = []interface{}{t.DeviceID, t.CollectedAt, t.Metrics, t.Tags, t.Seq, t.IngestionID, t.Errors}
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"telemetry_stage"},
+		[]string{"device_id", "collected_at", "metrics", "tags", "seq", "ingestion_id", "errors"},
+		pgx.CopyFromRows(rows))
+	return err
+}
+
+// insertTelemetry inserts the staged reports into a shard's telemetry table
+// and returns the ingestion IDs of those not already stored
+func insertTelemetry(ctx context.Context, tx pgx.Tx, table string, reports []*models.Telemetry) ([]uuid.UUID, error) {
+	deviceIDs := make([]uuid.UUID, len(reports))
+	for i, t := range reports {
+		deviceIDs[i] = t.DeviceID
+	}
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO `+table+` (device_id, collected_at, metrics, tags, seq, ingestion_id, errors)
+		SELECT device_id, collected_at, metrics, tags, seq, ingestion_id, errors FROM telemetry_stage
+		WHERE device_id = ANY($1)
+		ON CONFLICT DO NOTHING
+		RETURNING ingestion_id`, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
-func (w *TelemetryWriter) processBatch(batch []*models.Telemetry) {
-	// TODO: Implement batch insert for better performance
-	for _, telemetry := range batch {
-		if err := w.writeTelemetry(telemetry); err != nil {
-			log.Printf("Failed to write telemetry batch item: %v", err)
+// writeSoftware merges a software.inventory report into software_titles and
+// device_software. Installs seen again have last_seen_at bumped, new ones
+// start a first_seen_at, and installs missing from the report are marked
+// removed. Reports older than the last one applied are ignored.
+func (w *TelemetryWriter) writeSoftware(ctx context.Context, tx pgx.Tx, telemetry *models.Telemetry, software models.SoftwareInventory) error {
+	var newer bool
+	err := tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM device_software WHERE device_id = $1 AND last_seen_at > $2)",
+		telemetry.DeviceID, telemetry.CollectedAt).Scan(&newer)
+	if err != nil || newer {
+		return err
+	}
+
+	// A batch may merge several reports in one transaction, so the staging
+	// table is reused and emptied first
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE IF NOT EXISTS software_stage (
+			name TEXT NOT NULL,
+			version TEXT NOT NULL,
+			version_parts INT[] NOT NULL,
+			publisher TEXT NOT NULL,
+			install_date TEXT
+		) ON COMMIT DROP`)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "TRUNCATE software_stage"); err != nil {
+		return err
+	}
+
+	rows := make([][]interface{}, len(software))
+	for i, item := range software {
+		rows[i] = []interface{}{
+			item.Name, item.Version, models.ParseVersion(item.Version),
+			strings.TrimSpace(item.Publisher), item.InstallDate,
 		}
 	}
-}
\ No newline at end of file
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"software_stage"},
+		[]string{"name", "version", "version_parts", "publisher", "install_date"},
+		pgx.CopyFromRows(rows))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO software_titles (name, publisher)
+		SELECT DISTINCT ON (lower(name), lower(publisher)) name, publisher
+		FROM software_stage
+		ORDER BY lower(name), lower(publisher), name
+		ON CONFLICT ((lower(name)), (lower(publisher))) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO device_software (device_id, title_id, version, version_parts, install_date, first_seen_at, last_seen_at)
+		SELECT DISTINCT ON (t.title_id, s.version) $1, t.title_id, s.version, s.version_parts, s.install_date, $2, $2
+		FROM software_stage s
+		JOIN software_titles t ON lower(t.name) = lower(s.name) AND lower(t.publisher) = lower(s.publisher)
+		ORDER BY t.title_id, s.version
+		ON CONFLICT (device_id, title_id, version) DO UPDATE SET
+			install_date = EXCLUDED.install_date,
+			last_seen_at = EXCLUDED.last_seen_at,
+			first_seen_at = CASE WHEN device_software.removed_at IS NULL
+			                     THEN device_software.first_seen_at ELSE EXCLUDED.first_seen_at END,
+			removed_at = NULL`,
+		telemetry.DeviceID, telemetry.CollectedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE device_software SET removed_at = $2
+		WHERE device_id = $1 AND removed_at IS NULL AND last_seen_at < $2`,
+		telemetry.DeviceID, telemetry.CollectedAt)
+	return err
+}
@@ -0,0 +1,139 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yourorg/inventory-agent/api/internal/metering"
+	"github.com/yourorg/inventory-agent/api/internal/repository"
+)
+
+// UsageMetering fills in the usage_metering figures measured from the
+// database rather than counted at ingest: each org's active devices and
+// commands issued, for today and, to close it off, yesterday, and once a
+// day the raw telemetry rows it stores. It also prunes the record of which
+// devices were active once it is older than retentionDays.
+type UsageMetering struct {
+	db            *pgxpool.Pool
+	telemetry     *repository.Telemetry
+	retentionDays int
+	// storedDay is the last day stored rows were measured
+	storedDay time.Time
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewUsageMetering(db *pgxpool.Pool, telemetry *repository.Telemetry, retentionDays int) *UsageMetering {
+	return &UsageMetering{
+		db:            db,
+		telemetry:     telemetry,
+		retentionDays: retentionDays,
+		stopCh:        make(chan struct{}),
+	}
+}
+
+func (u *UsageMetering) Start(ctx context.Context) error {
+	u.wg.Add(1)
+	go u.run(ctx)
+	slog.Info("Usage metering started")
+	return nil
+}
+
+func (u *UsageMetering) Stop() {
+	close(u.stopCh)
+	u.wg.Wait()
+	slog.Info("Usage metering stopped")
+}
+
+func (u *UsageMetering) run(ctx context.Context) {
+	defer u.wg.Done()
+
+	u.measure(ctx)
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.measure(ctx)
+		}
+	}
+}
+
+func (u *UsageMetering) measure(ctx context.Context) {
+	today := metering.Day(time.Now())
+	yesterday := today.AddDate(0, 0, -1)
+
+	_, err := u.db.Exec(ctx, `
+		INSERT INTO usage_metering (org_id, day, active_devices)
+		SELECT org_id, day, COUNT(*) FROM usage_active_devices
+		WHERE day >= $1
+		GROUP BY org_id, day
+		ON CONFLICT (org_id, day) DO UPDATE SET
+			active_devices = EXCLUDED.active_devices,
+			updated_at = NOW()`, yesterday)
+	if err != nil {
+		slog.Error("Failed to meter active devices", "error", err)
+	}
+
+	_, err = u.db.Exec(ctx, `
+		INSERT INTO usage_metering (org_id, day, commands_issued)
+		SELECT a.org_id, (c.created_at AT TIME ZONE 'UTC')::date, COUNT(*)
+		FROM commands c
+		JOIN agents a ON a.device_id = c.device_id
+		WHERE c.created_at >= $1 AND a.org_id IS NOT NULL
+		GROUP BY 1, 2
+		ON CONFLICT (org_id, day) DO UPDATE SET
+			commands_issued = EXCLUDED.commands_issued,
+			updated_at = NOW()`, yesterday)
+	if err != nil {
+		slog.Error("Failed to meter commands", "error", err)
+	}
+
+	if u.storedDay.Before(today) {
+		if err := u.measureStoredRows(ctx, today); err != nil {
+			slog.Error("Failed to meter stored telemetry rows", "error", err)
+		} else {
+			u.storedDay = today
+		}
+	}
+
+	tag, err := u.db.Exec(ctx, "DELETE FROM usage_active_devices WHERE day < $1",
+		today.AddDate(0, 0, -u.retentionDays))
+	if err != nil {
+		slog.Error("Failed to prune metered active devices", "error", err)
+	} else if tag.RowsAffected() > 0 {
+		slog.Info("Pruned metered active devices", "count", tag.RowsAffected())
+	}
+}
+
+// measureStoredRows records the raw telemetry rows each org holds today
+func (u *UsageMetering) measureStoredRows(ctx context.Context, today time.Time) error {
+	counts, err := u.telemetry.RowsByOrg(ctx)
+	if err != nil {
+		return err
+	}
+
+	orgIDs := make([]int64, 0, len(counts))
+	rows := make([]int64, 0, len(counts))
+	for orgID, count := range counts {
+		orgIDs = append(orgIDs, orgID)
+		rows = append(rows, count)
+	}
+
+	_, err = u.db.Exec(ctx, `
+		INSERT INTO usage_metering (org_id, day, stored_rows)
+		SELECT org_id, $1::date, stored_rows FROM unnest($2::bigint[], $3::bigint[]) AS s(org_id, stored_rows)
+		ON CONFLICT (org_id, day) DO UPDATE SET
+			stored_rows = EXCLUDED.stored_rows,
+			updated_at = NOW()`, today, orgIDs, rows)
+	return err
+}
@@ -0,0 +1,293 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nats-io/nats.go"
+	"github.com/yourorg/inventory-agent/api/internal/events"
+	"github.com/yourorg/inventory-agent/api/internal/models"
+	"github.com/yourorg/inventory-agent/api/internal/version"
+)
+
+const (
+	webhookMaxAttempts   = 8
+	webhookBaseBackoff   = 30 * time.Second
+	webhookMaxBackoff    = time.Hour
+	webhookTimeout       = 10 * time.Second
+	webhookLogRetention  = 30 * 24 * time.Hour
+	webhookConsumerName  = "webhook-dispatcher"
+	webhookConsumerWait  = 30 * time.Second
+	webhookMaxDeliver    = 20
+	webhookSignatureHead = "X-Webhook-Signature"
+)
+
+// WebhookDispatcher queues a delivery for every enabled webhook subscribed
+// to each event on the events stream, then POSTs due deliveries, retrying
+// failures with exponential backoff.
+type WebhookDispatcher struct {
+	db     *pgxpool.Pool
+	js     nats.JetStreamContext
+	sub    *nats.Subscription
+	client *http.Client
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewWebhookDispatcher(db *pgxpool.Pool, js nats.JetStreamContext) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:     db,
+		js:     js,
+		client: &http.Client{Timeout: webhookTimeout},
+		stopCh: make(chan struct{}),
+	}
+}
+
+func (d *WebhookDispatcher) Start(ctx context.Context) error {
+	// A new durable consumer starts with new events rather than replaying
+	// the stream's retention window
+	err := ensureConsumer(d.js, events.StreamName, &nats.ConsumerConfig{
+		Durable:       webhookConsumerName,
+		FilterSubject: events.Subject(">"),
+		DeliverPolicy: nats.DeliverNewPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       webhookConsumerWait,
+		MaxDeliver:    webhookMaxDeliver,
+	})
+	if err != nil {
+		return err
+	}
+
+	sub, err := d.js.PullSubscribe(events.Subject(">"), webhookConsumerName,
+		nats.Bind(events.StreamName, webhookConsumerName))
+	if err != nil {
+		return err
+	}
+	d.sub = sub
+
+	d.wg.Add(2)
+	go d.consume(ctx)
+	go d.deliver(ctx)
+	slog.Info("Webhook dispatcher started")
+	return nil
+}
+
+func (d *WebhookDispatcher) Stop() {
+	close(d.stopCh)
+	d.wg.Wait()
+	if d.sub != nil {
+		d.sub.Unsubscribe()
+	}
+	slog.Info("Webhook dispatcher stopped")
+}
+
+// consume turns stream events into pending deliveries
+func (d *WebhookDispatcher) consume(ctx context.Context) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		default:
+			msgs, err := d.sub.Fetch(100, nats.MaxWait(5*time.Second))
+			if err != nil {
+				if err != nats.ErrTimeout {
+					slog.Error("Failed to fetch events for webhooks", "error", err)
+					select {
+					case <-d.stopCh:
+						return
+					case <-ctx.Done():
+						return
+					case <-time.After(fetchBackoff):
+					}
+				}
+				continue
+			}
+
+			for _, msg := range msgs {
+				_, err := d.db.Exec(ctx, `
+					INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+					SELECT webhook_id, $1, $2::jsonb FROM webhooks
+					WHERE enabled AND $1 = ANY(event_types)`,
+					events.TypeOf(msg.Subject), string(msg.Data))
+				if err != nil {
+					slog.Error("Failed to queue webhook deliveries", "error", err)
+					msg.Nak()
+					continue
+				}
+				msg.Ack()
+			}
+		}
+	}
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Drain due deliveries before waiting for the next tick
+			for d.deliverNext(ctx) {
+			}
+		case <-cleanup.C:
+			d.removeOld(ctx)
+		}
+	}
+}
+
+// deliverNext claims one due delivery and attempts it, reporting whether
+// one was found. Claiming pushes next_attempt_at past the request timeout
+// so another instance won't pick it up while the request is in flight.
+func (d *WebhookDispatcher) deliverNext(ctx context.Context) bool {
+	var (
+		deliveryID int64
+		eventType  string
+		payload    string
+		attempts   int
+		url        string
+		secret     string
+		enabled    bool
+	)
+	err := d.db.QueryRow(ctx, `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = NOW() + interval '2 minutes'
+		FROM webhooks w
+		WHERE w.webhook_id = d.webhook_id
+		  AND d.delivery_id = (
+			SELECT delivery_id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING d.delivery_id, d.event_type, d.payload::text, d.attempts, w.url, w.secret, w.enabled`).Scan(
+		&deliveryID, &eventType, &payload, &attempts, &url, &secret, &enabled)
+	if err == pgx.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to claim webhook delivery", "error", err)
+		return false
+	}
+
+	if !enabled {
+		d.finish(ctx, deliveryID, models.WebhookDeliveryFailed, nil, "webhook disabled", 0)
+		return true
+	}
+
+	statusCode, err := d.post(ctx, url, secret, eventType, deliveryID, []byte(payload))
+	switch {
+	case err == nil:
+		d.finish(ctx, deliveryID, models.WebhookDeliverySucceeded, &statusCode, "", 0)
+	case attempts >= webhookMaxAttempts:
+		d.finish(ctx, deliveryID, models.WebhookDeliveryFailed, responseCode(statusCode), err.Error(), 0)
+	default:
+		d.finish(ctx, deliveryID, models.WebhookDeliveryPending, responseCode(statusCode), err.Error(), webhookBackoff(attempts))
+	}
+	return true
+}
+
+// post sends one signed delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret.
+func (d *WebhookDispatcher) post(ctx context.Context, url, secret, eventType string, deliveryID int64, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "inventory-agent-webhooks/"+version.Version)
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set(webhookSignatureHead, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// finish records an attempt's outcome; retry is the delay before the next
+// attempt of a delivery left pending
+func (d *WebhookDispatcher) finish(ctx context.Context, deliveryID int64, status string, responseStatus *int, lastError string, retry time.Duration) {
+	_, err := d.db.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, response_status = $3, last_error = NULLIF($4, ''),
+		    next_attempt_at = NOW() + make_interval(secs => $5),
+		    delivered_at = CASE WHEN $2 = 'succeeded' THEN NOW() END
+		WHERE delivery_id = $1`,
+		deliveryID, status, responseStatus, lastError, retry.Seconds())
+	if err != nil {
+		slog.Error("Failed to record webhook delivery", "delivery_id", deliveryID, "error", err)
+	}
+}
+
+func (d *WebhookDispatcher) removeOld(ctx context.Context) {
+	result, err := d.db.Exec(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status <> 'pending' AND created_at < NOW() - make_interval(secs => $1)`,
+		webhookLogRetention.Seconds())
+	if err != nil {
+		slog.Error("Failed to remove old webhook deliveries", "error", err)
+		return
+	}
+
+	if n := result.RowsAffected(); n > 0 {
+		slog.Info("Removed old webhook deliveries", "count", n)
+	}
+}
+
+// webhookBackoff doubles the delay after each failed attempt, starting at
+// 30 seconds and capped at an hour
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookBaseBackoff << (attempts - 1)
+	if delay <= 0 || delay > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return delay
+}
+
+func responseCode(code int) *int {
+	if code == 0 {
+		return nil
+	}
+	return &code
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Capability is a metric an agent can collect, at the version of its
+// collector
+type Capability struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Supports reports whether the capability's collector is at least version,
+// which an empty version always is
+func (c Capability) Supports(version string) bool {
+	return version == "" || CompareVersions(c.Version, version) >= 0
+}
+
+// CompareVersions compares dotted numeric versions such as "1.0" and "2",
+// returning -1, 0 or 1. Missing parts count as 0, so "2" equals "2.0", and
+// so does a part that isn't a number.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
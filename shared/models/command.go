@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Command is a command as agents poll it. The API's stored command adds its
+// device, batch, review and scheduling fields to the same JSON object.
+type Command struct {
+	CommandID  uuid.UUID              `json:"command_id"`
+	Type       string                 `json:"type"`
+	Parameters map[string]interface{} `json:"parameters"`
+	IssuedAt   time.Time              `json:"issued_at"`
+	TTLSeconds int                    `json:"ttl_seconds"`
+	// NotBefore is when the command was released to the agent, if later
+	// than IssuedAt, such as once it was approved; its TTL runs from then
+	NotBefore   *time.Time             `json:"not_before,omitempty"`
+	Status      string                 `json:"status"`
+	Result      map[string]interface{} `json:"result"`
+	CompletedAt *time.Time             `json:"completed_at"`
+}
+
+// ReleasedAt is when the command was released to the agent, which its TTL
+// runs from
+func (c *Command) ReleasedAt() time.Time {
+	if c.NotBefore != nil && c.NotBefore.After(c.IssuedAt) {
+		return *c.NotBefore
+	}
+	return c.IssuedAt
+}
+
+// ExpiresAt is when the command expires if it hasn't run. The API stops
+// serving it then and the agent refuses it after.
+func (c *Command) ExpiresAt() time.Time {
+	return c.ReleasedAt().Add(time.Duration(c.TTLSeconds) * time.Second)
+}
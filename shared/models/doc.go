@@ -0,0 +1,7 @@
+// Package models holds the types the agent and the API exchange: the
+// capabilities an agent registers, the policy it is served and its report of
+// applying it, the commands it polls and the telemetry it uploads. Both
+// sides build on these definitions, so their JSON (and, for telemetry,
+// msgpack) encodings can't drift apart; a field renamed or retagged here
+// changes the wire format for both.
+package models
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Policy is a policy as agents are served it. The API's stored policy adds
+// its scope, ownership and timestamps to the same JSON object.
+type Policy struct {
+	Version int          `json:"version"`
+	Config  PolicyConfig `json:"config"`
+}
+
+// PolicyConfig is what a policy has devices under it collect and run
+type PolicyConfig struct {
+	IntervalSeconds int                     `json:"interval_seconds"`
+	Metrics         map[string]MetricConfig `json:"metrics"`
+	// AllowedCommands limits the command types devices under the policy
+	// accept. Null allows every type; an empty list allows none.
+	AllowedCommands []string `json:"allowed_commands"`
+	// RestartableServices names the Windows services service.restart may
+	// restart on devices under the policy; none when empty
+	RestartableServices []string `json:"restartable_services,omitempty"`
+}
+
+type MetricConfig struct {
+	Enabled bool `json:"enabled"`
+	// MinVersion is the oldest collector version the metric is served to;
+	// agents with an older collector don't get the metric at all
+	MinVersion string `json:"min_version,omitempty"`
+	// Features turns on optional parts of a collector, each naming the
+	// collector version that introduced it, e.g. {"winget": "2.0"} for
+	// software.inventory. Agents are only served the features their
+	// collector supports.
+	Features map[string]string `json:"features,omitempty"`
+}
+
+// PolicyStatus is an agent's report of applying the policy it was served
+type PolicyStatus struct {
+	Version int `json:"version"`
+	// ETag is the one the policy was served with, which tells apart
+	// policies of the same version
+	ETag      string    `json:"etag,omitempty"`
+	AppliedAt time.Time `json:"applied_at"`
+	// Settings has the outcome of each setting applied, keyed as the
+	// effective policy's sources are: interval_seconds, metrics.<name>,
+	// allowed_commands, restartable_services, and config_save for
+	// persisting them
+	Settings map[string]SettingStatus `json:"settings"`
+	// UnsupportedMetrics are metrics the policy configures that the agent
+	// has no collector for
+	UnsupportedMetrics []string `json:"unsupported_metrics"`
+}
+
+// SettingStatus is the outcome of applying one policy setting
+type SettingStatus struct {
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// FailedSettings returns the settings that weren't applied, sorted
+func (s *PolicyStatus) FailedSettings() []string {
+	failed := []string{}
+	for name, setting := range s.Settings {
+		if !setting.Applied {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
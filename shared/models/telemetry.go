@@ -0,0 +1,33 @@
+package models
+
+//go:generate msgp -tests=false -io=false
+
+import "time"
+
+// TelemetryPayload is one collection run as an agent uploads it. The agent
+// fixes IngestionID when the run is collected, so the API stores the payload
+// once however often it's resent, and assigns one itself when an older agent
+// sends none. The msg tags give the msgpack encoding the JSON field names;
+// Metrics must hold only plain values (maps, slices, strings, numbers) to
+// encode as msgpack.
+type TelemetryPayload struct {
+	DeviceID     string                 `json:"device_id" msg:"device_id"`
+	IngestionID  string                 `json:"ingestion_id,omitempty" msg:"ingestion_id"`
+	AgentVersion string                 `json:"agent_version" msg:"agent_version"`
+	CollectedAt  time.Time              `json:"collected_at" msg:"collected_at"`
+	Metrics      map[string]interface{} `json:"metrics" msg:"metrics"`
+	Errors       map[string]string      `json:"errors,omitempty" msg:"errors"`
+	// SchemaVersion is the telemetry schema version the payload follows,
+	// 0 from agents that predate versioning
+	SchemaVersion int `json:"schema_version,omitempty" msg:"schema_version"`
+	// ClockSkewMs is how far the agent's clock was from the API's, API
+	// minus agent, when it last heard from it. CollectedAt is already
+	// corrected for it.
+	ClockSkewMs int64 `json:"clock_skew_ms,omitempty" msg:"clock_skew_ms"`
+	// Tags describe where the device runs, such as a Kubernetes node's
+	// labels, and are stored with the report
+	Tags map[string]string `json:"tags,omitempty" msg:"tags"`
+}
+
+// TelemetryBatch is the msgpack body of a batch upload
+type TelemetryBatch []TelemetryPayload
@@ -0,0 +1,286 @@
+package models
+
+// Code generated by github.com/tinylib/msgp DO NOT EDIT.
+
+import (
+	"github.com/tinylib/msgp/msgp"
+)
+
+// MarshalMsg implements msgp.Marshaler
+func (z TelemetryBatch) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	o = msgp.AppendArrayHeader(o, uint32(len(z)))
+	for za0001 := range z {
+		o, err = z[za0001].MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, za0001)
+			return
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *TelemetryBatch) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zb0002 uint32
+	zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	if cap((*z)) >= int(zb0002) {
+		(*z) = (*z)[:zb0002]
+	} else {
+		(*z) = make(TelemetryBatch, zb0002)
+	}
+	for zb0001 := range *z {
+		bts, err = (*z)[zb0001].UnmarshalMsg(bts)
+		if err != nil {
+			err = msgp.WrapError(err, zb0001)
+			return
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z TelemetryBatch) Msgsize() (s int) {
+	s = msgp.ArrayHeaderSize
+	for zb0003 := range z {
+		s += z[zb0003].Msgsize()
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *TelemetryPayload) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 9
+	// string "device_id"
+	o = append(o, 0x89, 0xa9, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x69, 0x64)
+	o = msgp.AppendString(o, z.DeviceID)
+	// string "ingestion_id"
+	o = append(o, 0xac, 0x69, 0x6e, 0x67, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64)
+	o = msgp.AppendString(o, z.IngestionID)
+	// string "agent_version"
+	o = append(o, 0xad, 0x61, 0x67, 0x65, 0x6e, 0x74, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendString(o, z.AgentVersion)
+	// string "collected_at"
+	o = append(o, 0xac, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74)
+	o = msgp.AppendTime(o, z.CollectedAt)
+	// string "metrics"
+	o = append(o, 0xa7, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Metrics)))
+	for za0001, za0002 := range z.Metrics {
+		o = msgp.AppendString(o, za0001)
+		o, err = msgp.AppendIntf(o, za0002)
+		if err != nil {
+			err = msgp.WrapError(err, "Metrics", za0001)
+			return
+		}
+	}
+	// string "errors"
+	o = append(o, 0xa6, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Errors)))
+	for za0003, za0004 := range z.Errors {
+		o = msgp.AppendString(o, za0003)
+		o = msgp.AppendString(o, za0004)
+	}
+	// string "schema_version"
+	o = append(o, 0xae, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e)
+	o = msgp.AppendInt(o, z.SchemaVersion)
+	// string "clock_skew_ms"
+	o = append(o, 0xad, 0x63, 0x6c, 0x6f, 0x63, 0x6b, 0x5f, 0x73, 0x6b, 0x65, 0x77, 0x5f, 0x6d, 0x73)
+	o = msgp.AppendInt64(o, z.ClockSkewMs)
+	// string "tags"
+	o = append(o, 0xa4, 0x74, 0x61, 0x67, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Tags)))
+	for za0005, za0006 := range z.Tags {
+		o = msgp.AppendString(o, za0005)
+		o = msgp.AppendString(o, za0006)
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *TelemetryPayload) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "device_id":
+			z.DeviceID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "DeviceID")
+				return
+			}
+		case "ingestion_id":
+			z.IngestionID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "IngestionID")
+				return
+			}
+		case "agent_version":
+			z.AgentVersion, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "AgentVersion")
+				return
+			}
+		case "collected_at":
+			z.CollectedAt, bts, err = msgp.ReadTimeBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "CollectedAt")
+				return
+			}
+		case "metrics":
+			var zb0002 uint32
+			zb0002, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Metrics")
+				return
+			}
+			if z.Metrics == nil {
+				z.Metrics = make(map[string]interface{}, zb0002)
+			} else if len(z.Metrics) > 0 {
+				for key := range z.Metrics {
+					delete(z.Metrics, key)
+				}
+			}
+			for zb0002 > 0 {
+				var za0001 string
+				var za0002 interface{}
+				zb0002--
+				za0001, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Metrics")
+					return
+				}
+				za0002, bts, err = msgp.ReadIntfBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Metrics", za0001)
+					return
+				}
+				z.Metrics[za0001] = za0002
+			}
+		case "errors":
+			var zb0003 uint32
+			zb0003, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Errors")
+				return
+			}
+			if z.Errors == nil {
+				z.Errors = make(map[string]string, zb0003)
+			} else if len(z.Errors) > 0 {
+				for key := range z.Errors {
+					delete(z.Errors, key)
+				}
+			}
+			for zb0003 > 0 {
+				var za0003 string
+				var za0004 string
+				zb0003--
+				za0003, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Errors")
+					return
+				}
+				za0004, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Errors", za0003)
+					return
+				}
+				z.Errors[za0003] = za0004
+			}
+		case "schema_version":
+			z.SchemaVersion, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "SchemaVersion")
+				return
+			}
+		case "clock_skew_ms":
+			z.ClockSkewMs, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ClockSkewMs")
+				return
+			}
+		case "tags":
+			var zb0004 uint32
+			zb0004, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Tags")
+				return
+			}
+			if z.Tags == nil {
+				z.Tags = make(map[string]string, zb0004)
+			} else if len(z.Tags) > 0 {
+				for key := range z.Tags {
+					delete(z.Tags, key)
+				}
+			}
+			for zb0004 > 0 {
+				var za0005 string
+				var za0006 string
+				zb0004--
+				za0005, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Tags")
+					return
+				}
+				za0006, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Tags", za0005)
+					return
+				}
+				z.Tags[za0005] = za0006
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *TelemetryPayload) Msgsize() (s int) {
+	s = 1 + 10 + msgp.StringPrefixSize + len(z.DeviceID) + 13 + msgp.StringPrefixSize + len(z.IngestionID) + 14 + msgp.StringPrefixSize + len(z.AgentVersion) + 13 + msgp.TimeSize + 8 + msgp.MapHeaderSize
+	if z.Metrics != nil {
+		for za0001, za0002 := range z.Metrics {
+			_ = za0002
+			s += msgp.StringPrefixSize + len(za0001) + msgp.GuessSize(za0002)
+		}
+	}
+	s += 7 + msgp.MapHeaderSize
+	if z.Errors != nil {
+		for za0003, za0004 := range z.Errors {
+			_ = za0004
+			s += msgp.StringPrefixSize + len(za0003) + msgp.StringPrefixSize + len(za0004)
+		}
+	}
+	s += 15 + msgp.IntSize + 14 + msgp.Int64Size + 5 + msgp.MapHeaderSize
+	if z.Tags != nil {
+		for za0005, za0006 := range z.Tags {
+			_ = za0006
+			s += msgp.StringPrefixSize + len(za0005) + msgp.StringPrefixSize + len(za0006)
+		}
+	}
+	return
+}
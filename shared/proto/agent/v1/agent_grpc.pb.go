@@ -0,0 +1,303 @@
+// Agent protocol over gRPC: the same operations as the agent REST endpoints,
+// with telemetry and commands carried over long-lived bidirectional streams
+// instead of repeated requests. Regenerate the Go code with `make proto`.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: shared/proto/agent/v1/agent.proto
+
+package agentv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	AgentService_Register_FullMethodName        = "/inventory.agent.v1.AgentService/Register"
+	AgentService_StreamTelemetry_FullMethodName = "/inventory.agent.v1.AgentService/StreamTelemetry"
+	AgentService_WatchCommands_FullMethodName   = "/inventory.agent.v1.AgentService/WatchCommands"
+	AgentService_GetPolicy_FullMethodName       = "/inventory.agent.v1.AgentService/GetPolicy"
+)
+
+// AgentServiceClient is the client API for AgentService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AgentServiceClient interface {
+	// Register enrolls a device, or re-enrolls a known one, and issues its
+	// auth token
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// StreamTelemetry accepts telemetry payloads for as long as the stream is
+	// open, answering each with an acknowledgement in the order received
+	StreamTelemetry(ctx context.Context, opts ...grpc.CallOption) (AgentService_StreamTelemetryClient, error)
+	// WatchCommands pushes the device's commands as they are released. The
+	// agent reports each command's outcome on the same stream.
+	WatchCommands(ctx context.Context, opts ...grpc.CallOption) (AgentService_WatchCommandsClient, error)
+	// GetPolicy returns the device's effective policy
+	GetPolicy(ctx context.Context, in *GetPolicyRequest, opts ...grpc.CallOption) (*GetPolicyResponse, error)
+}
+
+type agentServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAgentServiceClient(cc grpc.ClientConnInterface) AgentServiceClient {
+	return &agentServiceClient{cc}
+}
+
+func (c *agentServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, AgentService_Register_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) StreamTelemetry(ctx context.Context, opts ...grpc.CallOption) (AgentService_StreamTelemetryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[0], AgentService_StreamTelemetry_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceStreamTelemetryClient{stream}
+	return x, nil
+}
+
+type AgentService_StreamTelemetryClient interface {
+	Send(*TelemetryPayload) error
+	Recv() (*TelemetryAck, error)
+	grpc.ClientStream
+}
+
+type agentServiceStreamTelemetryClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceStreamTelemetryClient) Send(m *TelemetryPayload) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceStreamTelemetryClient) Recv() (*TelemetryAck, error) {
+	m := new(TelemetryAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) WatchCommands(ctx context.Context, opts ...grpc.CallOption) (AgentService_WatchCommandsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[1], AgentService_WatchCommands_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceWatchCommandsClient{stream}
+	return x, nil
+}
+
+type AgentService_WatchCommandsClient interface {
+	Send(*CommandResult) error
+	Recv() (*Command, error)
+	grpc.ClientStream
+}
+
+type agentServiceWatchCommandsClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceWatchCommandsClient) Send(m *CommandResult) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceWatchCommandsClient) Recv() (*Command, error) {
+	m := new(Command)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) GetPolicy(ctx context.Context, in *GetPolicyRequest, opts ...grpc.CallOption) (*GetPolicyResponse, error) {
+	out := new(GetPolicyResponse)
+	err := c.cc.Invoke(ctx, AgentService_GetPolicy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AgentServiceServer is the server API for AgentService service.
+// All implementations must embed UnimplementedAgentServiceServer
+// for forward compatibility
+type AgentServiceServer interface {
+	// Register enrolls a device, or re-enrolls a known one, and issues its
+	// auth token
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// StreamTelemetry accepts telemetry payloads for as long as the stream is
+	// open, answering each with an acknowledgement in the order received
+	StreamTelemetry(AgentService_StreamTelemetryServer) error
+	// WatchCommands pushes the device's commands as they are released. The
+	// agent reports each command's outcome on the same stream.
+	WatchCommands(AgentService_WatchCommandsServer) error
+	// GetPolicy returns the device's effective policy
+	GetPolicy(context.Context, *GetPolicyRequest) (*GetPolicyResponse, error)
+	mustEmbedUnimplementedAgentServiceServer()
+}
+
+// UnimplementedAgentServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAgentServiceServer struct {
+}
+
+func (UnimplementedAgentServiceServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedAgentServiceServer) StreamTelemetry(AgentService_StreamTelemetryServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTelemetry not implemented")
+}
+func (UnimplementedAgentServiceServer) WatchCommands(AgentService_WatchCommandsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchCommands not implemented")
+}
+func (UnimplementedAgentServiceServer) GetPolicy(context.Context, *GetPolicyRequest) (*GetPolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPolicy not implemented")
+}
+func (UnimplementedAgentServiceServer) mustEmbedUnimplementedAgentServiceServer() {}
+
+// UnsafeAgentServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AgentServiceServer will
+// result in compilation errors.
+type UnsafeAgentServiceServer interface {
+	mustEmbedUnimplementedAgentServiceServer()
+}
+
+func RegisterAgentServiceServer(s grpc.ServiceRegistrar, srv AgentServiceServer) {
+	s.RegisterService(&AgentService_ServiceDesc, srv)
+}
+
+func _AgentService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentService_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_StreamTelemetry_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).StreamTelemetry(&agentServiceStreamTelemetryServer{stream})
+}
+
+type AgentService_StreamTelemetryServer interface {
+	Send(*TelemetryAck) error
+	Recv() (*TelemetryPayload, error)
+	grpc.ServerStream
+}
+
+type agentServiceStreamTelemetryServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceStreamTelemetryServer) Send(m *TelemetryAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceStreamTelemetryServer) Recv() (*TelemetryPayload, error) {
+	m := new(TelemetryPayload)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AgentService_WatchCommands_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).WatchCommands(&agentServiceWatchCommandsServer{stream})
+}
+
+type AgentService_WatchCommandsServer interface {
+	Send(*Command) error
+	Recv() (*CommandResult, error)
+	grpc.ServerStream
+}
+
+type agentServiceWatchCommandsServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceWatchCommandsServer) Send(m *Command) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceWatchCommandsServer) Recv() (*CommandResult, error) {
+	m := new(CommandResult)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AgentService_GetPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).GetPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AgentService_GetPolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).GetPolicy(ctx, req.(*GetPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AgentService_ServiceDesc is the grpc.ServiceDesc for AgentService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AgentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "inventory.agent.v1.AgentService",
+	HandlerType: (*AgentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _AgentService_Register_Handler,
+		},
+		{
+			MethodName: "GetPolicy",
+			Handler:    _AgentService_GetPolicy_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTelemetry",
+			Handler:       _AgentService_StreamTelemetry_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchCommands",
+			Handler:       _AgentService_WatchCommands_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "shared/proto/agent/v1/agent.proto",
+}
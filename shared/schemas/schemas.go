@@ -0,0 +1,95 @@
+// Package schemas embeds the JSON schemas shared by the agent, API and web console
+package schemas
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FS holds every *.schema.json file in this directory
+//
+//go:embed *.schema.json
+var FS embed.FS
+
+// Path returns the file name of a named schema within FS
+func Path(name string) string {
+	return name + ".schema.json"
+}
+
+// VersionPath returns the file name of one version of a versioned schema,
+// e.g. telemetry.v2.schema.json
+func VersionPath(name string, version int) string {
+	return Path(fmt.Sprintf("%s.v%d", name, version))
+}
+
+// Versions lists the versions of a versioned schema in FS, oldest first
+func Versions(name string) ([]int, error) {
+	paths, err := fs.Glob(FS, name+".v*.schema.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, path := range paths {
+		v := strings.TrimSuffix(strings.TrimPrefix(path, name+".v"), ".schema.json")
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: bad version %q", path, v)
+		}
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// ErrUnknownMetric is returned for a metric a telemetry schema doesn't
+// describe
+var ErrUnknownMetric = errors.New("metric not described by the telemetry schema")
+
+// MetricSchema returns a standalone schema for one collector's output, cut
+// from a version of the telemetry schema along with the definitions it may
+// refer to, so agents and tools can check a collector's output on its own
+func MetricSchema(version int, metric string) ([]byte, error) {
+	data, err := fs.ReadFile(FS, VersionPath("telemetry", version))
+	if err != nil {
+		return nil, err
+	}
+
+	var telemetry struct {
+		Schema     string                     `json:"$schema"`
+		Defs       map[string]json.RawMessage `json:"$defs"`
+		Properties struct {
+			Metrics struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"metrics"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &telemetry); err != nil {
+		return nil, fmt.Errorf("schema %s: %w", VersionPath("telemetry", version), err)
+	}
+
+	sub, ok := telemetry.Properties.Metrics.Properties[metric]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMetric, metric)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(sub, &schema); err != nil {
+		return nil, fmt.Errorf("schema of metric %s: %w", metric, err)
+	}
+
+	schema["$schema"] = telemetry.Schema
+	schema["$id"] = fmt.Sprintf("https://inventory-agent.com/schemas/metrics/%s/v%d", metric, version)
+	if _, ok := schema["title"]; !ok {
+		schema["title"] = metric
+	}
+	if len(telemetry.Defs) > 0 {
+		schema["$defs"] = telemetry.Defs
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
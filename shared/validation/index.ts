@@ -4,7 +4,8 @@ import Ajv, { ValidateFunction, ErrorObject } from 'ajv'
 import addFormats from 'ajv-formats'
 
 // Import schemas
-import telemetrySchema from '../schemas/telemetry.schema.json'
+import telemetryV1Schema from '../schemas/telemetry.v1.schema.json'
+import telemetryV2Schema from '../schemas/telemetry.v2.schema.json'
 import policySchema from '../schemas/policy.schema.json'
 import commandSchema from '../schemas/command.schema.json'
 
@@ -74,7 +75,8 @@ export class SchemaValidator {
 
   private loadSchemas(): void {
     // Compile and store validators
-    this.validators.set('telemetry', this.ajv.compile(telemetrySchema))
+    this.validators.set('telemetry.v1', this.ajv.compile(telemetryV1Schema))
+    this.validators.set('telemetry.v2', this.ajv.compile(telemetryV2Schema))
     this.validators.set('policy', this.ajv.compile(policySchema))
     this.validators.set('command', this.ajv.compile(commandSchema))
   }
@@ -102,9 +104,10 @@ export class SchemaValidator {
     return { valid: false, errors }
   }
 
-  // Validate telemetry data
+  // Validate telemetry data against the schema version it declares;
+  // payloads without schema_version are version 1
   validateTelemetry(data: any): ValidationResult {
-    return this.validate('telemetry', data)
+    return this.validate(`telemetry.v${data?.schema_version ?? 1}`, data)
   }
 
   // Validate policy data
@@ -2,24 +2,37 @@
 package validation
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/fs"
+	"sort"
 
 	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
-// Validator provides JSON schema validation functionality
+// Validator provides JSON schema validation functionality. A schema may be
+// loaded in several versions, so payloads are checked against the version
+// they declare.
 type Validator struct {
-	schemas map[string]*jsonschema.Schema
+	schemas  map[string]*jsonschema.Schema
+	versions map[string][]int
 }
 
 // NewValidator creates a new schema validator instance
 func NewValidator() *Validator {
 	return &Validator{
-		schemas: make(map[string]*jsonschema.Schema),
+		schemas:  make(map[string]*jsonschema.Schema),
+		versions: make(map[string][]int),
 	}
 }
 
+// VersionedName is the name one version of a schema is loaded under, e.g.
+// "telemetry.v2"
+func VersionedName(name string, version int) string {
+	return fmt.Sprintf("%s.v%d", name, version)
+}
+
 // LoadSchema loads and compiles a JSON schema from a file path
 func (v *Validator) LoadSchema(name, schemaPath string) error {
 	schema, err := jsonschema.Compile(schemaPath)
@@ -32,7 +45,16 @@ func (v *Validator) LoadSchema(name, schemaPath string) error {
 
 // LoadSchemaFromBytes loads and compiles a JSON schema from byte data
 func (v *Validator) LoadSchemaFromBytes(name string, schemaData []byte) error {
-	schema, err := jsonschema.Compile(string(schemaData))
+	compiler := jsonschema.NewCompiler()
+	// Formats such as uuid and date-time are only annotations in newer
+	// drafts unless asserted, and the schemas rely on them
+	compiler.AssertFormat = true
+	url := name + ".schema.json"
+	if err := compiler.AddResource(url, bytes.NewReader(schemaData)); err != nil {
+		return fmt.Errorf("failed to add schema %s: %w", name, err)
+	}
+
+	schema, err := compiler.Compile(url)
 	if err != nil {
 		return fmt.Errorf("failed to compile schema %s: %w", name, err)
 	}
@@ -40,6 +62,37 @@ func (v *Validator) LoadSchemaFromBytes(name string, schemaData []byte) error {
 	return nil
 }
 
+// LoadSchemaFS loads and compiles a JSON schema from a file in fsys
+func (v *Validator) LoadSchemaFS(name string, fsys fs.FS, path string) error {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return fmt.Errorf("failed to read schema %s: %w", name, err)
+	}
+	return v.LoadSchemaFromBytes(name, data)
+}
+
+// LoadSchemaVersionFS loads and compiles one version of a named schema from
+// a file in fsys
+func (v *Validator) LoadSchemaVersionFS(name string, version int, fsys fs.FS, path string) error {
+	if err := v.LoadSchemaFS(VersionedName(name, version), fsys, path); err != nil {
+		return err
+	}
+	v.versions[name] = append(v.versions[name], version)
+	sort.Ints(v.versions[name])
+	return nil
+}
+
+// Versions lists the loaded versions of a named schema, oldest first
+func (v *Validator) Versions(name string) []int {
+	return v.versions[name]
+}
+
+// HasSchema reports whether a named schema has been loaded
+func (v *Validator) HasSchema(name string) bool {
+	_, exists := v.schemas[name]
+	return exists
+}
+
 // Validate validates data against a named schema
 func (v *Validator) Validate(name string, data interface{}) error {
 	schema, exists := v.schemas[name]
@@ -101,6 +154,15 @@ func (v *Validator) ValidateWithResult(name string, data interface{}) (*Validati
 	return result, nil
 }
 
+// ValidateVersionWithResult validates data against one version of a named
+// schema and returns detailed validation results
+func (v *Validator) ValidateVersionWithResult(name string, version int, data interface{}) (*ValidationResult, error) {
+	if !v.HasSchema(VersionedName(name, version)) {
+		return nil, fmt.Errorf("schema %s version %d not found", name, version)
+	}
+	return v.ValidateWithResult(VersionedName(name, version), data)
+}
+
 // ValidationResult contains the result of a validation operation
 type ValidationResult struct {
 	Valid  bool              `json:"valid"`
@@ -114,16 +176,23 @@ type ValidationError struct {
 	Code    string `json:"code,omitempty"`
 }
 
-// convertValidationErrors converts jsonschema validation errors to our format
+// convertValidationErrors converts jsonschema validation errors to our format.
+// Only leaf errors are reported; the wrapping "doesn't validate" errors add
+// no information for callers.
 func convertValidationErrors(err *jsonschema.ValidationError) []ValidationError {
 	var errors []ValidationError
 
-	// Add the main error
-	errors = append(errors, ValidationError{
-		Field:   err.InstanceLocation,
-		Message: err.Message,
-		Code:    err.KeywordLocation,
-	})
+	if len(err.Causes) == 0 {
+		field := err.InstanceLocation
+		if field == "" {
+			field = "root"
+		}
+		errors = append(errors, ValidationError{
+			Field:   field,
+			Message: err.Message,
+			Code:    err.KeywordLocation,
+		})
+	}
 
 	// Add nested errors recursively
 	for _, childErr := range err.Causes {
@@ -134,9 +203,10 @@ func convertValidationErrors(err *jsonschema.ValidationError) []ValidationError
 	return errors
 }
 
-// ValidateTelemetry validates telemetry data against the telemetry schema
-func (v *Validator) ValidateTelemetry(data interface{}) error {
-	return v.Validate("telemetry", data)
+// ValidateTelemetry validates telemetry data against a version of the
+// telemetry schema
+func (v *Validator) ValidateTelemetry(version int, data interface{}) error {
+	return v.Validate(VersionedName("telemetry", version), data)
 }
 
 // ValidatePolicy validates policy data against the policy schema
@@ -149,9 +219,10 @@ func (v *Validator) ValidateCommand(data interface{}) error {
 	return v.Validate("command", data)
 }
 
-// ValidateTelemetryWithResult validates telemetry data and returns detailed results
-func (v *Validator) ValidateTelemetryWithResult(data interface{}) (*ValidationResult, error) {
-	return v.ValidateWithResult("telemetry", data)
+// ValidateTelemetryWithResult validates telemetry data against a version of
+// the telemetry schema and returns detailed results
+func (v *Validator) ValidateTelemetryWithResult(version int, data interface{}) (*ValidationResult, error) {
+	return v.ValidateVersionWithResult("telemetry", version, data)
 }
 
 // ValidatePolicyWithResult validates policy data and returns detailed results
@@ -162,4 +233,4 @@ func (v *Validator) ValidatePolicyWithResult(data interface{}) (*ValidationResul
 // ValidateCommandWithResult validates command data and returns detailed results
 func (v *Validator) ValidateCommandWithResult(data interface{}) (*ValidationResult, error) {
 	return v.ValidateWithResult("command", data)
-}
\ No newline at end of file
+}
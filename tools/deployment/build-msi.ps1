@@ -56,8 +56,15 @@ Write-Host "Building Windows Inventory Agent executable..." -ForegroundColor Gre
 
 Push-Location $ProjectRoot
 try {
-    # Build Go executable
-    $goCmd = "go build -o `"$OutputDir\WindowsInventoryAgent.exe`" -ldflags `"-X main.version=$Version`" .\agent"
+    # Build Go executable, stamped with the version, commit and build date
+    $commit = git rev-parse --short HEAD 2>$null
+    if ([string]::IsNullOrEmpty($commit)) {
+        $commit = "unknown"
+    }
+    $buildDate = (Get-Date).ToUniversalTime().ToString("yyyy-MM-ddTHH:mm:ssZ")
+    $versionPkg = "github.com/yourorg/inventory-agent/agent/internal/version"
+    $ldflags = "-X $versionPkg.Version=$Version -X $versionPkg.Commit=$commit -X $versionPkg.Date=$buildDate"
+    $goCmd = "go build -o `"$OutputDir\WindowsInventoryAgent.exe`" -ldflags `"$ldflags`" .\agent"
     Invoke-Expression $goCmd
 
     if ($LASTEXITCODE -ne 0) {